@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// clientCommands lists the subcommands offered for completion
+var clientCommands = []string{"loki_query", "loki_tail", "loki_label_names", "loki_label_values", "call", "list_tools", "completion"}
+
+// clientFlags lists the global flags offered for completion
+var clientFlags = []string{"--server-url", "--config", "--loki-url", "--org", "--output", "--json", "--output-file", "--verbose", "--retries", "--timeout"}
+
+// clientQueryFlags lists the loki_query flags offered for completion after the subcommand
+var clientQueryFlags = []string{"--query", "--since", "--until", "--limit", "--url", "--org"}
+
+// bashCompletion completes subcommands and flags, the loki_query flags after loki_query, file
+// names for --config and --output-file and formats for --output
+const bashCompletion = `# bash completion for the loki-mcp client
+# Load with: source <(loki-mcp-client completion bash)
+_loki_mcp_client() {
+    local cur prev
+    cur="${COMP_WORDS[COMP_CWORD]}"
+    prev="${COMP_WORDS[COMP_CWORD-1]}"
+
+    case "$prev" in
+        --config|--output-file)
+            COMPREPLY=($(compgen -f -- "$cur"))
+            return
+            ;;
+        --output)
+            COMPREPLY=($(compgen -W "text json" -- "$cur"))
+            return
+            ;;
+        --server-url|--loki-url|--org|--retries|--timeout|--query|--since|--until|--limit|--url)
+            return
+            ;;
+        completion)
+            COMPREPLY=($(compgen -W "bash zsh" -- "$cur"))
+            return
+            ;;
+    esac
+
+    local i
+    for ((i = 1; i < COMP_CWORD; i++)); do
+        case "${COMP_WORDS[i]}" in
+            loki_query)
+                if [[ "$cur" == -* ]]; then
+                    COMPREPLY=($(compgen -W "{{query_flags}}" -- "$cur"))
+                fi
+                return
+                ;;
+            {{commands_case}})
+                return
+                ;;
+        esac
+    done
+
+    if [[ "$cur" == -* ]]; then
+        COMPREPLY=($(compgen -W "{{flags}}" -- "$cur"))
+    else
+        COMPREPLY=($(compgen -W "{{commands}}" -- "$cur"))
+    fi
+}
+complete -F _loki_mcp_client loki-mcp-client client
+`
+
+// zshCompletion completes the same words as bashCompletion using _arguments
+const zshCompletion = `#compdef loki-mcp-client client
+# zsh completion for the loki-mcp client
+# Load with: source <(loki-mcp-client completion zsh)
+_loki_mcp_client() {
+    local -a commands
+    commands=(
+        'loki_query:Run a LogQL query'
+        'loki_tail:Print new entries of a LogQL query as they arrive'
+        'loki_label_names:List label names'
+        'loki_label_values:List values of a label'
+        'call:Call any tool with JSON arguments'
+        'list_tools:List the tools the server offers'
+        'completion:Print a shell completion script'
+    )
+
+    _arguments \
+        '--server-url[MCP server URL]:url:' \
+        '--config[YAML or JSON config file]:file:_files' \
+        '--loki-url[Default Loki URL sent with tool calls]:url:' \
+        '--org[Default organization ID sent with tool calls]:org:' \
+        '--output[Output format]:format:(text json)' \
+        '--json[Print the raw tool result as JSON]' \
+        '--output-file[Write results to a file instead of stdout]:file:_files' \
+        '--verbose[Print each request and raw response to stderr]' \
+        '--retries[Retries after a transport error]:count:' \
+        '--timeout[Timeout for the command, e.g. 45s or 60]:timeout:' \
+        '1: :->command' \
+        '*:: :->args'
+
+    case $state in
+        command)
+            _describe 'command' commands
+            ;;
+        args)
+            case $words[1] in
+                completion)
+                    _values 'shell' bash zsh
+                    ;;
+                loki_query)
+                    _arguments \
+                        '--query[LogQL query]:query:' \
+                        '--since[Start time, e.g. -1h or RFC3339]:start:' \
+                        '--until[End time, e.g. now or RFC3339]:end:' \
+                        '--limit[Maximum number of entries]:limit:' \
+                        '--url[Loki URL]:url:' \
+                        '--org[Organization ID]:org:'
+                    ;;
+            esac
+            ;;
+    esac
+}
+compdef _loki_mcp_client loki-mcp-client client
+`
+
+// completionScript returns the completion script for shell
+func completionScript(shell string) (string, error) {
+	switch shell {
+	case "bash":
+		return strings.NewReplacer(
+			"{{commands_case}}", strings.Join(clientCommands, "|"),
+			"{{commands}}", strings.Join(clientCommands, " "),
+			"{{flags}}", strings.Join(clientFlags, " "),
+			"{{query_flags}}", strings.Join(clientQueryFlags, " "),
+		).Replace(bashCompletion), nil
+	case "zsh":
+		return zshCompletion, nil
+	default:
+		return "", fmt.Errorf("unsupported shell %q: must be bash or zsh", shell)
+	}
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestCompletionScript verifies that the scripts cover the subcommands and flags
+func TestCompletionScript(t *testing.T) {
+	for _, shell := range []string{"bash", "zsh"} {
+		script, err := completionScript(shell)
+		if err != nil {
+			t.Fatalf("completionScript(%s) failed: %v", shell, err)
+		}
+		if strings.Contains(script, "{{") {
+			t.Errorf("Unreplaced placeholder in the %s script", shell)
+		}
+		words := append(append(append([]string{}, clientCommands...), clientFlags...), clientQueryFlags...)
+		for _, word := range words {
+			if !strings.Contains(script, word) {
+				t.Errorf("Expected the %s script to mention %s", shell, word)
+			}
+		}
+	}
+
+	if _, err := completionScript("fish"); err == nil {
+		t.Error("Expected an error for an unsupported shell")
+	}
+}
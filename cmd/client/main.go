@@ -1,12 +1,16 @@
 package main
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"os"
+	"os/signal"
 	"strconv"
 	"strings"
 	"time"
@@ -14,205 +18,361 @@ import (
 	"github.com/ThinkInAIXYZ/go-mcp/client"
 	"github.com/ThinkInAIXYZ/go-mcp/protocol"
 	"github.com/ThinkInAIXYZ/go-mcp/transport"
+	"gopkg.in/yaml.v3"
 )
 
 // Config holds the client configuration
 type Config struct {
-	ServerURL string
-	Timeout   time.Duration
+	ServerURL  string
+	Timeout    time.Duration
+	AuthToken  string
+	LokiURL    string
+	Org        string
+	Output     string
+	OutputFile string
+	Verbose    bool
+	Retries    int
+	Args       []string
 }
 
-// LoadConfig loads configuration from environment variables and command-line flags
-func LoadConfig() *Config {
-	return LoadConfigWithArgs(os.Args[1:])
+// ConfigFile holds the settings that can be kept in a YAML or JSON config file
+type ConfigFile struct {
+	ServerURL string `yaml:"server_url"`
+	LokiURL   string `yaml:"loki_url"`
+	Org       string `yaml:"org"`
+	AuthToken string `yaml:"auth_token"`
+	Output    string `yaml:"output"`
 }
 
-// LoadConfigWithArgs loads configuration from environment variables and provided arguments
-// This function is useful for testing
+// LoadConfigWithArgs loads configuration from environment variables and the command-line arguments args
 func LoadConfigWithArgs(args []string) *Config {
+	cfg, err := ParseConfig(args)
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+	return cfg
+}
+
+// ParseConfig builds the configuration from the provided arguments, environment variables and
+// config file, in that order of precedence, falling back to defaults
+func ParseConfig(args []string) (*Config, error) {
 	// Create a new flag set for parsing
 	fs := flag.NewFlagSet("client", flag.ContinueOnError)
 	serverURL := fs.String("server-url", "", "Server URL (overrides MCP_SERVER_URL environment variable)")
+	configPath := fs.String("config", "", "Path to a YAML or JSON config file (overrides MCP_CONFIG environment variable)")
+	lokiURL := fs.String("loki-url", "", "Default Loki URL sent with tool calls (overrides MCP_LOKI_URL environment variable)")
+	org := fs.String("org", "", "Default organization ID sent with tool calls (overrides MCP_LOKI_ORG environment variable)")
+	output := fs.String("output", "", "Output format: text or json (overrides MCP_OUTPUT environment variable)")
+	jsonOutput := fs.Bool("json", false, "Shorthand for --output json")
+	verbose := fs.Bool("verbose", false, "Print the tool arguments, server URL, elapsed time and raw result of each call to stderr")
+	retries := fs.Int("retries", 2, "Number of times a call is retried after a transport error such as connection refused")
+	outputFile := fs.String("output-file", "", "Write results to this file, created or truncated, instead of stdout")
+	timeout := fs.String("timeout", "", "Timeout for each command as a duration (e.g. 45s) or seconds (overrides LOKI_QUERY_TIMEOUT environment variable)")
 
 	// Parse the provided arguments
-	fs.Parse(args)
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
 
 	// Default values
 	cfg := &Config{
-		ServerURL: "http://localhost:8000/mcp",
-		Timeout:   30 * time.Second,
+		ServerURL:  "http://localhost:8000/mcp",
+		Timeout:    30 * time.Second,
+		Output:     "text",
+		OutputFile: *outputFile,
+		Verbose:    *verbose,
+		Retries:    *retries,
+		Args:       fs.Args(),
 	}
 
-	// Check environment variable for server URL
-	if envURL := os.Getenv("MCP_SERVER_URL"); envURL != "" {
-		cfg.ServerURL = envURL
+	// The config file overrides the defaults
+	path := *configPath
+	if path == "" {
+		path = os.Getenv("MCP_CONFIG")
 	}
+	if path != "" {
+		file, err := loadConfigFile(path)
+		if err != nil {
+			return nil, err
+		}
+		cfg.ServerURL = valueOr(file.ServerURL, cfg.ServerURL)
+		cfg.LokiURL = file.LokiURL
+		cfg.Org = file.Org
+		cfg.AuthToken = file.AuthToken
+		cfg.Output = valueOr(file.Output, cfg.Output)
+	}
+
+	// Check environment variable for server URL
+	cfg.ServerURL = valueOr(os.Getenv("MCP_SERVER_URL"), cfg.ServerURL)
+
+	// Check environment variables for the defaults sent with tool calls
+	cfg.LokiURL = valueOr(os.Getenv("MCP_LOKI_URL"), cfg.LokiURL)
+	cfg.Org = valueOr(os.Getenv("MCP_LOKI_ORG"), cfg.Org)
+	cfg.Output = valueOr(os.Getenv("MCP_OUTPUT"), cfg.Output)
 
-	// Command-line flag takes precedence
-	if *serverURL != "" {
-		cfg.ServerURL = *serverURL
+	// Check environment variable for the server's bearer token; the first one is used if several are listed
+	if envToken := os.Getenv("MCP_AUTH_TOKEN"); envToken != "" {
+		token, _, _ := strings.Cut(envToken, ",")
+		cfg.AuthToken = strings.TrimSpace(token)
 	}
 
 	// Check environment variable for timeout
 	if envTimeout := os.Getenv("LOKI_QUERY_TIMEOUT"); envTimeout != "" {
-		if timeoutSecs, err := strconv.Atoi(envTimeout); err == nil && timeoutSecs > 0 {
-			cfg.Timeout = time.Duration(timeoutSecs) * time.Second
+		envValue, err := parseTimeout(envTimeout)
+		if err != nil {
+			return nil, fmt.Errorf("LOKI_QUERY_TIMEOUT: %v", err)
 		}
+		cfg.Timeout = envValue
 	}
 
-	return cfg
+	// Command-line flags take precedence
+	cfg.ServerURL = valueOr(*serverURL, cfg.ServerURL)
+	cfg.LokiURL = valueOr(*lokiURL, cfg.LokiURL)
+	cfg.Org = valueOr(*org, cfg.Org)
+	cfg.Output = valueOr(*output, cfg.Output)
+	if *timeout != "" {
+		flagTimeout, err := parseTimeout(*timeout)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Timeout = flagTimeout
+	}
+	if *jsonOutput {
+		cfg.Output = "json"
+	}
+
+	if cfg.Retries < 0 {
+		return nil, fmt.Errorf("invalid retries %d: must not be negative", cfg.Retries)
+	}
+
+	if cfg.Output != "text" && cfg.Output != "json" {
+		return nil, fmt.Errorf("invalid output %q: must be text or json", cfg.Output)
+	}
+
+	return cfg, nil
+}
+
+// parseTimeout parses a positive timeout given as a duration such as 45s or as whole seconds
+func parseTimeout(value string) (time.Duration, error) {
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second, nil
+	}
+	timeout, err := time.ParseDuration(value)
+	if err != nil || timeout <= 0 {
+		return 0, fmt.Errorf("invalid timeout %q: must be a positive duration such as 45s or a number of seconds", value)
+	}
+	return timeout, nil
+}
+
+// loadConfigFile reads a client config file; JSON files are accepted as they are valid YAML
+func loadConfigFile(path string) (*ConfigFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %v", err)
+	}
+
+	file := &ConfigFile{}
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(file); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("failed to parse config file %s: %v", path, err)
+	}
+	return file, nil
+}
+
+// valueOr returns value, or fallback when value is empty
+func valueOr(value, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+	return value
+}
+
+// applyConfigDefaults adds the configured Loki URL and org to tool arguments that do not set them
+func applyConfigDefaults(toolArgs map[string]interface{}, cfg *Config) {
+	if _, ok := toolArgs["url"]; !ok && cfg.LokiURL != "" {
+		toolArgs["url"] = cfg.LokiURL
+	}
+	if _, ok := toolArgs["org"]; !ok && cfg.Org != "" {
+		toolArgs["org"] = cfg.Org
+	}
 }
 
 func main() {
+	os.Exit(run(os.Args[1:]))
+}
+
+// run runs the command given by the command-line arguments args and returns the exit code. Every
+// path returns rather than exiting, so that the output file is flushed and closed whatever happens.
+func run(args []string) (code int) {
 	// Load configuration
-	cfg := LoadConfig()
+	cfg := LoadConfigWithArgs(args)
 
-	// Parse remaining arguments (after flags)
-	fs := flag.NewFlagSet("client", flag.ContinueOnError)
-	fs.String("server-url", "", "Server URL (overrides MCP_SERVER_URL environment variable)")
-	fs.Parse(os.Args[1:])
-	args := fs.Args()
+	// Remaining arguments (after flags)
+	args = cfg.Args
 
 	if len(args) < 1 {
 		showUsage()
-		os.Exit(1)
+		return 1
+	}
+
+	// Completion scripts are printed without contacting the server
+	if args[0] == "completion" {
+		if len(args) < 2 {
+			fmt.Println("Usage: client completion bash|zsh")
+			return 1
+		}
+		script, err := completionScript(args[1])
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return 1
+		}
+		fmt.Print(script)
+		return 0
+	}
+
+	// Results go to stdout, or to the output file with a summary on the terminal
+	var out io.Writer = os.Stdout
+	var file *outputFile
+	if cfg.OutputFile != "" {
+		var err error
+		if file, err = createOutputFile(cfg.OutputFile); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
+		}
+		out = file
+
+		// Make sure everything reached the output file before reporting it, also when the
+		// command fails after writing part of its results
+		defer func() {
+			if err := file.Close(); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				code = 1
+				return
+			}
+			fmt.Fprintln(os.Stderr, file.Summary())
+		}()
 	}
 
 	// Create transport client
-	transportClient, err := transport.NewStreamableHTTPClientTransport(cfg.ServerURL)
-	if err != nil {
-		log.Fatalf("Failed to create transport client: %v", err)
+	var transportOptions []transport.StreamableHTTPClientTransportOption
+	if cfg.AuthToken != "" {
+		transportOptions = append(transportOptions, transport.WithStreamableHTTPClientOptionHeader(map[string]string{
+			"Authorization": "Bearer " + cfg.AuthToken,
+		}))
 	}
+	connect := func() (*client.Client, error) {
+		transportClient, err := transport.NewStreamableHTTPClientTransport(cfg.ServerURL, transportOptions...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create transport client: %v", err)
+		}
+		return client.NewClient(transportClient)
+	}
+
+	// Bound the whole command so that a slow server or Loki cannot hang the client
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Timeout)
+	defer cancel()
 
-	// Initialize MCP client
-	mcpClient, err := client.NewClient(transportClient)
+	// Connect to the MCP server, retrying on transport errors up to --retries times
+	mcpSession, err := newSession(ctx, connect, cfg.Retries)
 	if err != nil {
-		log.Fatalf("Failed to create MCP client: %v", err)
+		log.Printf("Failed to create MCP client: %v", err)
+		return 1
 	}
-	defer mcpClient.Close()
+	defer mcpSession.Close()
 
-	ctx := context.Background()
+	// With --verbose, each round-trip is traced to stderr so that piped output stays clean
+	trace := &tracer{w: os.Stderr, serverURL: cfg.ServerURL, enabled: cfg.Verbose}
 
 	// Process commands
 	switch args[0] {
 	case "loki_query":
-		if len(args) < 2 {
-			fmt.Println("Usage: client loki_query [url] <query> [start] [end] [limit]")
+		toolArgs, err := parseQueryArgs(args[1:])
+		if err != nil {
+			if len(args) > 1 {
+				fmt.Printf("Error: %v\n", err)
+			}
+			fmt.Println("Usage: client loki_query [url] <query> [start] [end] [limit] [org]")
+			fmt.Println("       client loki_query --query <query> [--since start] [--until end] [--limit n] [--url url] [--org org]")
 			fmt.Println("Examples:")
 			fmt.Println("  client loki_query \"{job=\\\"varlogs\\\"}\"")
 			fmt.Println("  client loki_query http://localhost:3100 \"{job=\\\"varlogs\\\"}\"")
 			fmt.Println("  client loki_query \"{job=\\\"varlogs\\\"}\" \"-1h\" \"now\" 100")
-			os.Exit(1)
+			fmt.Println("  client loki_query --query \"{job=\\\"varlogs\\\"}\" --since -1h --until now --limit 200")
+			return 1
 		}
 
-		var lokiURL, query, start, end, org string
-		var limit float64
-
-		// Check if the first argument is a URL or a query
-		if strings.HasPrefix(args[1], "http") {
-			// First arg is URL, second is query
-			if len(args) < 3 {
-				fmt.Println("Error: When providing a URL, you must also provide a query")
-				os.Exit(1)
-			}
-			lokiURL = args[1]
-			query = args[2]
-			argOffset := 3
-
-			// Optional parameters with URL
-			if len(args) > argOffset {
-				start = args[argOffset]
-			}
-
-			if len(args) > argOffset+1 {
-				end = args[argOffset+1]
-			}
-
-			if len(args) > argOffset+2 {
-				limitVal, err := strconv.ParseFloat(args[argOffset+2], 64)
-				if err != nil {
-					log.Fatalf("Invalid number for limit: %v", err)
-				}
-				limit = limitVal
-			}
-
-			if len(args) > argOffset+3 {
-				org = args[argOffset+3]
-			}
-		} else {
-			// First arg is the query (URL comes from environment)
-			query = args[1]
-			argOffset := 2
-
-			// Optional parameters without URL
-			if len(args) > argOffset {
-				start = args[argOffset]
-			}
-
-			if len(args) > argOffset+1 {
-				end = args[argOffset+1]
-			}
+		// Color lines by level when a person is reading the output in a terminal
+		if useColor(cfg, os.Stdout) {
+			toolArgs["format"] = "color"
+		}
 
-			if len(args) > argOffset+2 {
-				limitVal, err := strconv.ParseFloat(args[argOffset+2], 64)
-				if err != nil {
-					log.Fatalf("Invalid number for limit: %v", err)
-				}
-				limit = limitVal
-			}
+		applyConfigDefaults(toolArgs, cfg)
 
-			if len(args) > argOffset+3 {
-				org = args[argOffset+3]
-			}
+		// Marshal arguments to JSON
+		argsJSON, err := json.Marshal(toolArgs)
+		if err != nil {
+			log.Printf("Failed to marshal arguments: %v", err)
+			return 1
 		}
 
-		// Create arguments map
-		toolArgs := map[string]interface{}{
-			"query": query,
+		// Call the tool
+		result, err := callTool(ctx, trace, mcpSession, &protocol.CallToolRequest{
+			Name:         "loki_query",
+			RawArguments: argsJSON,
+		})
+		if err != nil {
+			reportRequestError("Failed to call tool", err, cfg)
+			return 1
 		}
 
-		// Add URL parameter if provided
-		if lokiURL != "" {
-			toolArgs["url"] = lokiURL
+		// Print the result
+		if err := printResult(out, result, cfg.Output); err != nil {
+			log.Printf("Failed to print result: %v", err)
+			return 1
 		}
 
-		// Add optional parameters if provided
-		if start != "" {
-			toolArgs["start"] = start
+	case "loki_tail":
+		query, duration, err := parseTailArgs(args[1:])
+		if err != nil {
+			fmt.Println("Usage: client loki_tail <query> [duration]")
+			fmt.Println("Examples:")
+			fmt.Println("  client loki_tail \"{job=\\\"varlogs\\\"}\"")
+			fmt.Println("  client loki_tail \"{job=\\\"varlogs\\\"} |= \\\"error\\\"\" 2m")
+			return 1
 		}
 
-		if end != "" {
-			toolArgs["end"] = end
-		}
+		// Stop on Ctrl+C, keeping the entries already printed
+		tailCtx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
 
-		if limit > 0 {
-			toolArgs["limit"] = limit
+		toolArgs := map[string]interface{}{
+			"query": query,
 		}
+		applyConfigDefaults(toolArgs, cfg)
 
-		if org != "" {
-			toolArgs["org"] = org
-		}
+		call := func(ctx context.Context, toolArgs map[string]interface{}) (*protocol.CallToolResult, error) {
+			argsJSON, err := json.Marshal(toolArgs)
+			if err != nil {
+				return nil, fmt.Errorf("failed to marshal arguments: %v", err)
+			}
 
-		// Marshal arguments to JSON
-		argsJSON, err := json.Marshal(toolArgs)
-		if err != nil {
-			log.Fatalf("Failed to marshal arguments: %v", err)
+			// Each call may take its window plus the usual command timeout
+			ctx, cancel := context.WithTimeout(ctx, tailWindow+cfg.Timeout)
+			defer cancel()
+			return callTool(ctx, trace, mcpSession, &protocol.CallToolRequest{
+				Name:         "loki_tail",
+				RawArguments: argsJSON,
+			})
 		}
 
-		// Call the tool
-		result, err := mcpClient.CallTool(ctx, &protocol.CallToolRequest{
-			Name:         "loki_query",
-			RawArguments: argsJSON,
-		})
+		total, err := runTail(tailCtx, call, toolArgs, duration, out, cfg.Output)
 		if err != nil {
-			log.Fatalf("Failed to call tool: %v", err)
+			reportRequestError("Failed to call tool", err, cfg)
+			return 1
 		}
-
-		// Print the result
-		for _, content := range result.Content {
-			if textContent, ok := content.(*protocol.TextContent); ok {
-				fmt.Println(textContent.Text)
-			}
+		if tailCtx.Err() != nil && cfg.Output == "text" {
+			fmt.Fprintf(os.Stderr, "Stopped after %d entries\n", total)
 		}
 
 	case "loki_label_names":
@@ -224,26 +384,29 @@ func main() {
 			toolArgs["url"] = args[1]
 		}
 
+		applyConfigDefaults(toolArgs, cfg)
+
 		// Marshal arguments to JSON
 		argsJSON, err := json.Marshal(toolArgs)
 		if err != nil {
-			log.Fatalf("Failed to marshal arguments: %v", err)
+			log.Printf("Failed to marshal arguments: %v", err)
+			return 1
 		}
 
 		// Call the tool
-		result, err := mcpClient.CallTool(ctx, &protocol.CallToolRequest{
+		result, err := callTool(ctx, trace, mcpSession, &protocol.CallToolRequest{
 			Name:         "loki_label_names",
 			RawArguments: argsJSON,
 		})
 		if err != nil {
-			log.Fatalf("Failed to call tool: %v", err)
+			reportRequestError("Failed to call tool", err, cfg)
+			return 1
 		}
 
 		// Print the result
-		for _, content := range result.Content {
-			if textContent, ok := content.(*protocol.TextContent); ok {
-				fmt.Println(textContent.Text)
-			}
+		if err := printResult(out, result, cfg.Output); err != nil {
+			log.Printf("Failed to print result: %v", err)
+			return 1
 		}
 
 	case "loki_label_values":
@@ -252,7 +415,7 @@ func main() {
 			fmt.Println("Examples:")
 			fmt.Println("  client loki_label_values job")
 			fmt.Println("  client loki_label_values job http://localhost:3100")
-			os.Exit(1)
+			return 1
 		}
 
 		// Create arguments map
@@ -265,54 +428,290 @@ func main() {
 			toolArgs["url"] = args[2]
 		}
 
+		applyConfigDefaults(toolArgs, cfg)
+
 		// Marshal arguments to JSON
 		argsJSON, err := json.Marshal(toolArgs)
 		if err != nil {
-			log.Fatalf("Failed to marshal arguments: %v", err)
+			log.Printf("Failed to marshal arguments: %v", err)
+			return 1
 		}
 
 		// Call the tool
-		result, err := mcpClient.CallTool(ctx, &protocol.CallToolRequest{
+		result, err := callTool(ctx, trace, mcpSession, &protocol.CallToolRequest{
 			Name:         "loki_label_values",
 			RawArguments: argsJSON,
 		})
 		if err != nil {
-			log.Fatalf("Failed to call tool: %v", err)
+			reportRequestError("Failed to call tool", err, cfg)
+			return 1
 		}
 
 		// Print the result
-		for _, content := range result.Content {
-			if textContent, ok := content.(*protocol.TextContent); ok {
-				fmt.Println(textContent.Text)
+		if err := printResult(out, result, cfg.Output); err != nil {
+			log.Printf("Failed to print result: %v", err)
+			return 1
+		}
+
+	case "call":
+		if len(args) < 2 {
+			fmt.Println("Usage: client call <tool-name> [json-args]")
+			fmt.Println("Examples:")
+			fmt.Println("  client call loki_series '{\"match\": \"{job=\\\"varlogs\\\"}\"}'")
+			fmt.Println("  client call loki_label_names")
+			return 1
+		}
+
+		// Validate the arguments before contacting the server
+		rawArgs := "{}"
+		if len(args) > 2 {
+			rawArgs = args[2]
+		}
+		toolArgs, err := parseCallArguments(rawArgs)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return 1
+		}
+
+		// Look the tool up so that a typo gets a helpful message rather than a server error
+		tools, err := listTools(ctx, trace, mcpSession)
+		if err != nil {
+			reportRequestError("Failed to list tools", err, cfg)
+			return 1
+		}
+		tool := findTool(tools.Tools, args[1])
+		if tool == nil {
+			names := make([]string, 0, len(tools.Tools))
+			for _, t := range tools.Tools {
+				names = append(names, t.Name)
 			}
+			fmt.Printf("Error: unknown tool %q. Available tools: %s\n", args[1], strings.Join(names, ", "))
+			return 1
+		}
+
+		applyToolConfigDefaults(toolArgs, cfg, tool)
+
+		// Marshal arguments to JSON
+		argsJSON, err := json.Marshal(toolArgs)
+		if err != nil {
+			log.Printf("Failed to marshal arguments: %v", err)
+			return 1
+		}
+
+		// Call the tool
+		result, err := callTool(ctx, trace, mcpSession, &protocol.CallToolRequest{
+			Name:         tool.Name,
+			RawArguments: argsJSON,
+		})
+		if err != nil {
+			reportRequestError("Failed to call tool", err, cfg)
+			return 1
+		}
+
+		// Print the result
+		if err := printResult(out, result, cfg.Output); err != nil {
+			log.Printf("Failed to print result: %v", err)
+			return 1
 		}
 
 	case "list_tools":
 		// Get available tools
-		tools, err := mcpClient.ListTools(ctx)
+		tools, err := listTools(ctx, trace, mcpSession)
 		if err != nil {
-			log.Fatalf("Failed to list tools: %v", err)
+			reportRequestError("Failed to list tools", err, cfg)
+			return 1
+		}
+
+		if cfg.Output == "json" {
+			if err := printJSON(out, tools); err != nil {
+				log.Printf("Failed to print result: %v", err)
+				return 1
+			}
+			break
 		}
 
-		fmt.Println("Available tools:")
+		fmt.Fprintln(out, "Available tools:")
 		for _, tool := range tools.Tools {
-			fmt.Printf("  - %s: %s\n", tool.Name, tool.Description)
+			fmt.Fprintf(out, "  - %s: %s\n", tool.Name, tool.Description)
 		}
 
 	default:
 		showUsage()
-		os.Exit(1)
+		return 1
+	}
+
+	return 0
+}
+
+// parseQueryArgs builds the loki_query arguments from either flags (--query, --since, --until,
+// --limit, --url, --org) or the positional form [url] <query> [start] [end] [limit] [org]. Flags
+// come before any positional arguments and take precedence over them.
+func parseQueryArgs(args []string) (map[string]interface{}, error) {
+	fs := flag.NewFlagSet("loki_query", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	query := fs.String("query", "", "LogQL query")
+	since := fs.String("since", "", "Start time, e.g. -1h or RFC3339")
+	until := fs.String("until", "", "End time, e.g. now or RFC3339")
+	limit := fs.String("limit", "", "Maximum number of entries")
+	lokiURL := fs.String("url", "", "Loki URL")
+	org := fs.String("org", "", "Organization ID")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	// Positional arguments, with an optional leading URL
+	var values struct{ url, query, start, end, limit, org string }
+	positional := fs.Args()
+	if *query != "" && len(positional) > 0 {
+		return nil, fmt.Errorf("unexpected arguments %q: the query is already given by --query", positional)
+	}
+	if len(positional) > 0 && strings.HasPrefix(positional[0], "http") {
+		values.url, positional = positional[0], positional[1:]
+		if len(positional) == 0 && *query == "" {
+			return nil, fmt.Errorf("when providing a URL, you must also provide a query")
+		}
+	}
+	if len(positional) > 5 {
+		return nil, fmt.Errorf("too many arguments: %q", positional[5:])
+	}
+	for i, field := range []*string{&values.query, &values.start, &values.end, &values.limit, &values.org} {
+		if i < len(positional) {
+			*field = positional[i]
+		}
 	}
+
+	// Flags take precedence
+	values.query = valueOr(*query, values.query)
+	values.start = valueOr(*since, values.start)
+	values.end = valueOr(*until, values.end)
+	values.limit = valueOr(*limit, values.limit)
+	values.url = valueOr(*lokiURL, values.url)
+	values.org = valueOr(*org, values.org)
+	if values.query == "" {
+		return nil, fmt.Errorf("a query is required")
+	}
+
+	toolArgs := map[string]interface{}{
+		"query": values.query,
+	}
+	if values.url != "" {
+		toolArgs["url"] = values.url
+	}
+	if values.start != "" {
+		toolArgs["start"] = values.start
+	}
+	if values.end != "" {
+		toolArgs["end"] = values.end
+	}
+	if values.limit != "" {
+		limitVal, err := strconv.ParseFloat(values.limit, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number for limit: %v", err)
+		}
+		if limitVal > 0 {
+			toolArgs["limit"] = limitVal
+		}
+	}
+	if values.org != "" {
+		toolArgs["org"] = values.org
+	}
+	return toolArgs, nil
+}
+
+// parseCallArguments parses the JSON arguments of the call command, which must be an object
+func parseCallArguments(raw string) (map[string]interface{}, error) {
+	var toolArgs map[string]interface{}
+	if err := json.Unmarshal([]byte(raw), &toolArgs); err != nil || toolArgs == nil {
+		return nil, fmt.Errorf("arguments must be a JSON object such as '{\"query\": \"{job=\\\"varlogs\\\"}\"}', got %s", raw)
+	}
+	return toolArgs, nil
+}
+
+// findTool returns the tool with the given name, or nil if the server does not offer it
+func findTool(tools []*protocol.Tool, name string) *protocol.Tool {
+	for _, tool := range tools {
+		if tool.Name == name {
+			return tool
+		}
+	}
+	return nil
+}
+
+// applyToolConfigDefaults adds the configured Loki URL and org to arguments that do not set them,
+// for tools that accept them
+func applyToolConfigDefaults(toolArgs map[string]interface{}, cfg *Config, tool *protocol.Tool) {
+	defaults := map[string]interface{}{}
+	applyConfigDefaults(defaults, cfg)
+	for name, value := range defaults {
+		if _, accepted := tool.InputSchema.Properties[name]; !accepted {
+			continue
+		}
+		if _, set := toolArgs[name]; !set {
+			toolArgs[name] = value
+		}
+	}
+}
+
+// useColor reports whether query results should be colored: only for text output to a terminal,
+// and never when NO_COLOR is set (https://no-color.org) or results go to an output file
+func useColor(cfg *Config, out *os.File) bool {
+	if cfg.Output != "text" || cfg.OutputFile != "" || os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	info, err := out.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// reportRequestError reports a failed request, explaining how to raise the timeout when it elapsed
+func reportRequestError(msg string, err error, cfg *Config) {
+	if errors.Is(err, context.DeadlineExceeded) {
+		fmt.Fprintf(os.Stderr, "Error: request timed out after %s; raise the limit with --timeout or LOKI_QUERY_TIMEOUT\n", cfg.Timeout)
+		return
+	}
+	log.Printf("%s: %v", msg, err)
+}
+
+// printResult writes a tool result to w: the text content for text output, or the whole
+// CallToolResult, including all content items and metadata, for json output
+func printResult(w io.Writer, result *protocol.CallToolResult, output string) error {
+	if output == "json" {
+		return printJSON(w, result)
+	}
+	for _, content := range result.Content {
+		if textContent, ok := content.(*protocol.TextContent); ok {
+			fmt.Fprintln(w, textContent.Text)
+		}
+	}
+	return nil
+}
+
+// printJSON writes v to w as indented JSON
+func printJSON(w io.Writer, v interface{}) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(v); err != nil {
+		return fmt.Errorf("failed to marshal result: %v", err)
+	}
+	return nil
 }
 
 func showUsage() {
 	fmt.Println("Usage:")
-	fmt.Println("  client loki_query [url] <query> [start] [end] [limit]")
+	fmt.Println("  client loki_query [url] <query> [start] [end] [limit] [org]")
 	fmt.Println("    Examples:")
 	fmt.Println("      client loki_query \"{job=\\\"varlogs\\\"}\"")
 	fmt.Println("      client loki_query http://localhost:3100 \"{job=\\\"varlogs\\\"}\"")
 	fmt.Println("      client loki_query \"{job=\\\"varlogs\\\"}\" \"-1h\" \"now\" 100")
 	fmt.Println("      client loki_query \"{job=\\\"varlogs\\\"}\" \"-1h\" \"now\" 100 \"tenant-123\"")
+	fmt.Println("  client loki_query --query <query> [--since start] [--until end] [--limit n] [--url url] [--org org]")
+	fmt.Println("    Examples:")
+	fmt.Println("      client loki_query --query \"{job=\\\"varlogs\\\"}\" --since -1h --until now --limit 200")
+	fmt.Println()
+	fmt.Println("  client loki_tail <query> [duration]")
+	fmt.Println("    Print new entries as they arrive, until the duration elapses or Ctrl+C")
+	fmt.Println("    Examples:")
+	fmt.Println("      client loki_tail \"{job=\\\"varlogs\\\"}\"")
+	fmt.Println("      client loki_tail \"{job=\\\"varlogs\\\"} |= \\\"error\\\"\" 2m")
 	fmt.Println()
 	fmt.Println("  client loki_label_names [url]")
 	fmt.Println("    Examples:")
@@ -324,6 +723,27 @@ func showUsage() {
 	fmt.Println("      client loki_label_values job")
 	fmt.Println("      client loki_label_values job http://localhost:3100")
 	fmt.Println()
+	fmt.Println("  client call <tool-name> [json-args]")
+	fmt.Println("    Call any tool the server offers with JSON arguments")
+	fmt.Println("    Examples:")
+	fmt.Println("      client call loki_series '{\"match\": \"{job=\\\"varlogs\\\"}\"}'")
+	fmt.Println("      client call loki_stats '{\"query\": \"{job=\\\"varlogs\\\"}\", \"start\": \"-24h\"}'")
+	fmt.Println()
 	fmt.Println("  client list_tools")
 	fmt.Println("    List all available tools")
+	fmt.Println()
+	fmt.Println("  client completion bash|zsh")
+	fmt.Println("    Print a shell completion script, e.g. source <(client completion bash)")
+	fmt.Println()
+	fmt.Println("Flags (before the command):")
+	fmt.Println("  --server-url <url>    MCP server URL")
+	fmt.Println("  --config <path>       YAML or JSON config file")
+	fmt.Println("  --loki-url <url>      Default Loki URL sent with tool calls")
+	fmt.Println("  --org <id>            Default organization ID sent with tool calls")
+	fmt.Println("  --output <format>     Output format: text (default) or json")
+	fmt.Println("  --json                Print the raw tool result as JSON")
+	fmt.Println("  --timeout <value>     Timeout for the command, e.g. 45s or 60 (default: 30s)")
+	fmt.Println("  --output-file <path>  Write results to a file instead of stdout")
+	fmt.Println("  --verbose             Print each request and raw response to stderr")
+	fmt.Println("  --retries <n>         Retries after a transport error (default: 2)")
 }
@@ -1,9 +1,15 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
+
+	"github.com/ThinkInAIXYZ/go-mcp/protocol"
 )
 
 // TestLoadConfigDefaults verifies that LoadConfig returns default values
@@ -106,3 +112,363 @@ func TestLoadConfigPrecedence(t *testing.T) {
 		t.Errorf("Expected ServerURL from flag (highest precedence) '%s', got '%s'", flagURL, cfg.ServerURL)
 	}
 }
+
+// TestLoadConfigAuthToken verifies that the bearer token is read from MCP_AUTH_TOKEN
+func TestLoadConfigAuthToken(t *testing.T) {
+	t.Setenv("MCP_AUTH_TOKEN", "first-token,second-token")
+
+	cfg := LoadConfigWithArgs([]string{})
+
+	if cfg.AuthToken != "first-token" {
+		t.Errorf("Expected AuthToken 'first-token', got '%s'", cfg.AuthToken)
+	}
+}
+
+// writeConfigFile writes a client config file into a temporary directory and returns its path
+func writeConfigFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+	return path
+}
+
+// TestLoadConfigFile verifies that settings are read from a YAML config file
+func TestLoadConfigFile(t *testing.T) {
+	t.Setenv("MCP_SERVER_URL", "")
+	t.Setenv("MCP_AUTH_TOKEN", "")
+	t.Setenv("MCP_LOKI_URL", "")
+	t.Setenv("MCP_LOKI_ORG", "")
+	t.Setenv("MCP_OUTPUT", "")
+	path := writeConfigFile(t, "client.yaml", `
+server_url: http://file-server:8000/mcp
+loki_url: http://loki:3100
+org: tenant-file
+auth_token: file-token
+output: text
+`)
+	t.Setenv("MCP_CONFIG", path)
+
+	cfg, err := ParseConfig([]string{"loki_label_names"})
+	if err != nil {
+		t.Fatalf("ParseConfig failed: %v", err)
+	}
+
+	if cfg.ServerURL != "http://file-server:8000/mcp" {
+		t.Errorf("Expected ServerURL from file, got '%s'", cfg.ServerURL)
+	}
+	if cfg.LokiURL != "http://loki:3100" || cfg.Org != "tenant-file" || cfg.AuthToken != "file-token" {
+		t.Errorf("Unexpected settings from file: %+v", cfg)
+	}
+	if len(cfg.Args) != 1 || cfg.Args[0] != "loki_label_names" {
+		t.Errorf("Expected the command to remain in Args, got %v", cfg.Args)
+	}
+}
+
+// TestLoadConfigFilePrecedence verifies that flags take precedence over environment variables,
+// which take precedence over the config file
+func TestLoadConfigFilePrecedence(t *testing.T) {
+	t.Setenv("MCP_CONFIG", "")
+	t.Setenv("MCP_SERVER_URL", "http://env-server:8000/mcp")
+	t.Setenv("MCP_LOKI_URL", "")
+	t.Setenv("MCP_LOKI_ORG", "tenant-env")
+	path := writeConfigFile(t, "client.json", `{"server_url": "http://file-server:8000/mcp", "loki_url": "http://file-loki:3100", "org": "tenant-file"}`)
+
+	cfg, err := ParseConfig([]string{"--config", path, "--org", "tenant-flag"})
+	if err != nil {
+		t.Fatalf("ParseConfig failed: %v", err)
+	}
+
+	if cfg.ServerURL != "http://env-server:8000/mcp" {
+		t.Errorf("Expected ServerURL from environment, got '%s'", cfg.ServerURL)
+	}
+	if cfg.LokiURL != "http://file-loki:3100" {
+		t.Errorf("Expected LokiURL from file, got '%s'", cfg.LokiURL)
+	}
+	if cfg.Org != "tenant-flag" {
+		t.Errorf("Expected Org from flag, got '%s'", cfg.Org)
+	}
+}
+
+// TestLoadConfigFileInvalid verifies that missing files, unknown keys and bad values are reported
+func TestLoadConfigFileInvalid(t *testing.T) {
+	t.Setenv("MCP_CONFIG", "")
+	t.Setenv("MCP_OUTPUT", "")
+	paths := []string{
+		filepath.Join(t.TempDir(), "missing.yaml"),
+		writeConfigFile(t, "typo.yaml", "serverurl: http://file-server:8000/mcp\n"),
+		writeConfigFile(t, "output.yaml", "output: xml\n"),
+	}
+	for _, path := range paths {
+		if _, err := ParseConfig([]string{"--config", path}); err == nil {
+			t.Errorf("Expected an error for %s", path)
+		}
+	}
+}
+
+// TestApplyConfigDefaults verifies that configured defaults never replace explicit arguments
+func TestApplyConfigDefaults(t *testing.T) {
+	cfg := &Config{LokiURL: "http://loki:3100", Org: "tenant-default"}
+	toolArgs := map[string]interface{}{"url": "http://other-loki:3100"}
+
+	applyConfigDefaults(toolArgs, cfg)
+
+	if toolArgs["url"] != "http://other-loki:3100" {
+		t.Errorf("Expected the explicit url to be kept, got %v", toolArgs["url"])
+	}
+	if toolArgs["org"] != "tenant-default" {
+		t.Errorf("Expected the default org, got %v", toolArgs["org"])
+	}
+}
+
+// TestLoadConfigOutput verifies that --json and --output select the output format
+func TestLoadConfigOutput(t *testing.T) {
+	t.Setenv("MCP_CONFIG", "")
+	t.Setenv("MCP_OUTPUT", "")
+
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{}, "text"},
+		{[]string{"--json"}, "json"},
+		{[]string{"--output", "json"}, "json"},
+	}
+	for _, tt := range tests {
+		cfg, err := ParseConfig(tt.args)
+		if err != nil {
+			t.Fatalf("ParseConfig(%v) failed: %v", tt.args, err)
+		}
+		if cfg.Output != tt.want {
+			t.Errorf("ParseConfig(%v): expected Output '%s', got '%s'", tt.args, tt.want, cfg.Output)
+		}
+	}
+
+	if _, err := ParseConfig([]string{"--output", "yaml"}); err == nil {
+		t.Error("Expected an error for an unknown output format")
+	}
+
+	cfg, err := ParseConfig([]string{"--json", "--output-file", "incident.json", "loki_query", `{job="x"}`})
+	if err != nil {
+		t.Fatalf("ParseConfig failed: %v", err)
+	}
+	if cfg.OutputFile != "incident.json" || cfg.Output != "json" || len(cfg.Args) != 2 {
+		t.Errorf("Unexpected config %+v", cfg)
+	}
+	if cfg.Verbose {
+		t.Error("Expected verbose to be off by default")
+	}
+	if cfg, err := ParseConfig([]string{"--verbose", "list_tools"}); err != nil || !cfg.Verbose {
+		t.Errorf("Expected verbose with --verbose, got %+v, %v", cfg, err)
+	}
+
+	if cfg.Retries != 2 {
+		t.Errorf("Expected 2 retries by default, got %d", cfg.Retries)
+	}
+	if cfg, err := ParseConfig([]string{"--retries", "0", "list_tools"}); err != nil || cfg.Retries != 0 {
+		t.Errorf("Expected no retries with --retries 0, got %+v, %v", cfg, err)
+	}
+	if _, err := ParseConfig([]string{"--retries", "-1"}); err == nil {
+		t.Error("Expected an error for negative retries")
+	}
+}
+
+// TestPrintResult verifies the text and JSON renderings of a tool result
+func TestPrintResult(t *testing.T) {
+	result := &protocol.CallToolResult{
+		Content: []protocol.Content{
+			&protocol.TextContent{Type: "text", Text: "line one"},
+			&protocol.TextContent{Type: "text", Text: `{"stats":{}}`},
+		},
+	}
+
+	var text bytes.Buffer
+	printResult(&text, result, "text")
+	if text.String() != "line one\n{\"stats\":{}}\n" {
+		t.Errorf("Unexpected text output: %q", text.String())
+	}
+
+	var raw bytes.Buffer
+	printResult(&raw, result, "json")
+	var decoded protocol.CallToolResult
+	if err := json.Unmarshal(raw.Bytes(), &decoded); err != nil {
+		t.Fatalf("Expected a JSON CallToolResult, got %q: %v", raw.String(), err)
+	}
+	if len(decoded.Content) != 2 {
+		t.Errorf("Expected both content items, got %d", len(decoded.Content))
+	}
+}
+
+// TestParseCallArguments verifies that call arguments must be a JSON object
+func TestParseCallArguments(t *testing.T) {
+	toolArgs, err := parseCallArguments(`{"match": "{job=\"varlogs\"}", "limit": 10}`)
+	if err != nil {
+		t.Fatalf("parseCallArguments failed: %v", err)
+	}
+	if toolArgs["match"] != `{job="varlogs"}` || toolArgs["limit"] != float64(10) {
+		t.Errorf("Unexpected arguments: %v", toolArgs)
+	}
+
+	for _, raw := range []string{"", "null", "[1]", `"query"`, "{match: 1}"} {
+		if _, err := parseCallArguments(raw); err == nil {
+			t.Errorf("Expected an error for %q", raw)
+		}
+	}
+}
+
+// TestParseQueryArgsPositional verifies that the positional loki_query form is unchanged
+func TestParseQueryArgsPositional(t *testing.T) {
+	toolArgs, err := parseQueryArgs([]string{"http://loki:3100", `{job="x"}`, "-1h", "now", "100", "tenant-a"})
+	if err != nil {
+		t.Fatalf("parseQueryArgs failed: %v", err)
+	}
+	expected := map[string]interface{}{"url": "http://loki:3100", "query": `{job="x"}`, "start": "-1h", "end": "now", "limit": float64(100), "org": "tenant-a"}
+	if len(toolArgs) != len(expected) {
+		t.Errorf("Expected %v, got %v", expected, toolArgs)
+	}
+	for k, v := range expected {
+		if toolArgs[k] != v {
+			t.Errorf("Expected %s=%v, got %v", k, v, toolArgs[k])
+		}
+	}
+
+	toolArgs, err = parseQueryArgs([]string{`{job="x"}`})
+	if err != nil || len(toolArgs) != 1 || toolArgs["query"] != `{job="x"}` {
+		t.Errorf("Expected only the query, got %v, %v", toolArgs, err)
+	}
+}
+
+// TestParseQueryArgsFlags verifies the flag form of loki_query and that flags take precedence
+func TestParseQueryArgsFlags(t *testing.T) {
+	toolArgs, err := parseQueryArgs([]string{"--query", `{job="x"}`, "--since", "-1h", "--until", "now", "--limit", "200", "--org", "tenant-a"})
+	if err != nil {
+		t.Fatalf("parseQueryArgs failed: %v", err)
+	}
+	if toolArgs["query"] != `{job="x"}` || toolArgs["start"] != "-1h" || toolArgs["end"] != "now" || toolArgs["limit"] != float64(200) || toolArgs["org"] != "tenant-a" {
+		t.Errorf("Unexpected arguments: %v", toolArgs)
+	}
+	if _, ok := toolArgs["url"]; ok {
+		t.Errorf("Expected no url, got %v", toolArgs["url"])
+	}
+
+	// Flags can be combined with a positional query and override positional values
+	toolArgs, err = parseQueryArgs([]string{"--since=-30m", "--limit", "5", `{job="x"}`, "-1h"})
+	if err != nil {
+		t.Fatalf("parseQueryArgs failed: %v", err)
+	}
+	if toolArgs["query"] != `{job="x"}` || toolArgs["start"] != "-30m" || toolArgs["limit"] != float64(5) {
+		t.Errorf("Unexpected arguments: %v", toolArgs)
+	}
+
+	invalid := [][]string{
+		{},
+		{"--since", "-1h"},
+		{"http://loki:3100"},
+		{"--query", `{job="x"}`, `{job="y"}`},
+		{"--query", `{job="x"}`, "--limit", "many"},
+		{"--unknown", "1", `{job="x"}`},
+		{`{job="x"}`, "-1h", "now", "1", "org", "extra"},
+	}
+	for _, args := range invalid {
+		if _, err := parseQueryArgs(args); err == nil {
+			t.Errorf("Expected an error for %q", args)
+		}
+	}
+}
+
+// TestApplyToolConfigDefaults verifies that defaults are only added for tools that accept them
+func TestApplyToolConfigDefaults(t *testing.T) {
+	cfg := &Config{LokiURL: "http://loki:3100", Org: "tenant-default"}
+	tools := []*protocol.Tool{
+		{Name: "loki_series", InputSchema: protocol.InputSchema{Properties: map[string]*protocol.Property{"url": {}, "org": {}}}},
+		{Name: "echo", InputSchema: protocol.InputSchema{Properties: map[string]*protocol.Property{"text": {}}}},
+	}
+
+	if findTool(tools, "loki_stats") != nil {
+		t.Error("Expected no tool for an unknown name")
+	}
+
+	toolArgs := map[string]interface{}{"org": "tenant-explicit"}
+	applyToolConfigDefaults(toolArgs, cfg, findTool(tools, "loki_series"))
+	if toolArgs["url"] != "http://loki:3100" || toolArgs["org"] != "tenant-explicit" {
+		t.Errorf("Unexpected arguments for loki_series: %v", toolArgs)
+	}
+
+	toolArgs = map[string]interface{}{}
+	applyToolConfigDefaults(toolArgs, cfg, findTool(tools, "echo"))
+	if len(toolArgs) != 0 {
+		t.Errorf("Expected no defaults for a tool without url and org, got %v", toolArgs)
+	}
+}
+
+// TestLoadConfigTimeoutFlag verifies that --timeout overrides LOKI_QUERY_TIMEOUT
+func TestLoadConfigTimeoutFlag(t *testing.T) {
+	t.Setenv("MCP_CONFIG", "")
+	t.Setenv("LOKI_QUERY_TIMEOUT", "60")
+
+	tests := []struct {
+		args []string
+		want time.Duration
+	}{
+		{[]string{}, 60 * time.Second},
+		{[]string{"--timeout", "45s"}, 45 * time.Second},
+		{[]string{"--timeout", "90"}, 90 * time.Second},
+		{[]string{"--timeout", "2m"}, 2 * time.Minute},
+	}
+	for _, tt := range tests {
+		cfg, err := ParseConfig(tt.args)
+		if err != nil {
+			t.Fatalf("ParseConfig(%v) failed: %v", tt.args, err)
+		}
+		if cfg.Timeout != tt.want {
+			t.Errorf("ParseConfig(%v): expected Timeout %v, got %v", tt.args, tt.want, cfg.Timeout)
+		}
+	}
+
+	for _, value := range []string{"0", "-5s", "soon"} {
+		if _, err := ParseConfig([]string{"--timeout", value}); err == nil {
+			t.Errorf("Expected an error for --timeout %s", value)
+		}
+	}
+
+	// LOKI_QUERY_TIMEOUT accepts the same values and reports invalid ones
+	t.Setenv("LOKI_QUERY_TIMEOUT", "2m")
+	if cfg, err := ParseConfig([]string{}); err != nil || cfg.Timeout != 2*time.Minute {
+		t.Errorf("Expected LOKI_QUERY_TIMEOUT=2m to give 2m, got %v", err)
+	}
+	for _, value := range []string{"0", "-5s", "soon"} {
+		t.Setenv("LOKI_QUERY_TIMEOUT", value)
+		if _, err := ParseConfig([]string{}); err == nil || !strings.Contains(err.Error(), "LOKI_QUERY_TIMEOUT") {
+			t.Errorf("Expected an error naming LOKI_QUERY_TIMEOUT for %s, got %v", value, err)
+		}
+	}
+}
+
+// TestUseColor verifies that color is disabled for files, json output and NO_COLOR
+func TestUseColor(t *testing.T) {
+	t.Setenv("NO_COLOR", "")
+	file, err := os.Create(filepath.Join(t.TempDir(), "out.txt"))
+	if err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+	defer file.Close()
+
+	if useColor(&Config{Output: "text"}, file) {
+		t.Error("Expected no color when writing to a file")
+	}
+
+	if tty, err := os.OpenFile("/dev/tty", os.O_WRONLY, 0); err == nil {
+		defer tty.Close()
+		if !useColor(&Config{Output: "text"}, tty) {
+			t.Error("Expected color when writing to a terminal")
+		}
+		if useColor(&Config{Output: "json"}, tty) {
+			t.Error("Expected no color for json output")
+		}
+		t.Setenv("NO_COLOR", "1")
+		if useColor(&Config{Output: "text"}, tty) {
+			t.Error("Expected no color when NO_COLOR is set")
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+)
+
+// outputFile receives the results of a command when --output-file is set. Writes are buffered
+// and the first write error is kept, so that it is reported once when the file is closed.
+type outputFile struct {
+	path    string
+	file    *os.File
+	buf     *bufio.Writer
+	written int64
+	err     error
+}
+
+// createOutputFile creates path, or truncates it if it exists
+func createOutputFile(path string) (*outputFile, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create output file: %v", err)
+	}
+	return &outputFile{path: path, file: file, buf: bufio.NewWriter(file)}, nil
+}
+
+// Write buffers p for the file, failing from the first write error on
+func (o *outputFile) Write(p []byte) (int, error) {
+	if o.err != nil {
+		return 0, o.err
+	}
+	n, err := o.buf.Write(p)
+	o.written += int64(n)
+	o.err = err
+	return n, err
+}
+
+// Close flushes and closes the file, returning the first error met while writing it
+func (o *outputFile) Close() error {
+	if o.err == nil {
+		o.err = o.buf.Flush()
+	}
+	if err := o.file.Close(); err != nil && o.err == nil {
+		o.err = err
+	}
+	if o.err != nil {
+		return fmt.Errorf("failed to write output file %s: %v", o.path, o.err)
+	}
+	return nil
+}
+
+// Summary describes what was written, for the terminal
+func (o *outputFile) Summary() string {
+	return fmt.Sprintf("Wrote %d bytes to %s", o.written, o.path)
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ThinkInAIXYZ/go-mcp/protocol"
+	"github.com/ThinkInAIXYZ/go-mcp/server"
+	"github.com/ThinkInAIXYZ/go-mcp/transport"
+)
+
+// TestOutputFile verifies that results are flushed to the file, replacing what it held
+func TestOutputFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "incident.log")
+	if err := os.WriteFile(path, []byte("older and longer content\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := createOutputFile(path)
+	if err != nil {
+		t.Fatalf("createOutputFile failed: %v", err)
+	}
+	printResult(file, tailResult("line one\nline two"), "text")
+	if err := file.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "line one\nline two\n" {
+		t.Errorf("Unexpected file content %q", data)
+	}
+	if file.Summary() != "Wrote 18 bytes to "+path {
+		t.Errorf("Unexpected summary %q", file.Summary())
+	}
+}
+
+// TestOutputFileErrors verifies that create and write errors are reported
+func TestOutputFileErrors(t *testing.T) {
+	if _, err := createOutputFile(filepath.Join(t.TempDir(), "missing", "out.json")); err == nil {
+		t.Error("Expected an error for a missing directory")
+	}
+
+	file, err := createOutputFile(filepath.Join(t.TempDir(), "out.json"))
+	if err != nil {
+		t.Fatalf("createOutputFile failed: %v", err)
+	}
+	file.file.Close()
+	file.Write([]byte(strings.Repeat("x", 10000)))
+	if err := file.Close(); err == nil || !strings.Contains(err.Error(), "failed to write output file") {
+		t.Errorf("Expected a write error, got %v", err)
+	}
+}
+
+// TestRunOutputFileOnError verifies that entries already written reach the output file when a
+// later loki_tail window fails
+func TestRunOutputFileOnError(t *testing.T) {
+	mcpTransport, mcpHandler, err := transport.NewStreamableHTTPServerTransportAndHandler(
+		transport.WithStreamableHTTPServerTransportAndHandlerOptionStateMode(transport.Stateless),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mcpServer, err := server.NewServer(mcpTransport)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tool, err := protocol.NewTool("loki_tail", "Tail", struct {
+		Query string `json:"query"`
+	}{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	calls := 0
+	mcpServer.RegisterTool(tool, func(ctx context.Context, request *protocol.CallToolRequest) (*protocol.CallToolResult, error) {
+		if calls++; calls > 1 {
+			return nil, fmt.Errorf("loki is down")
+		}
+		return tailResult(`{"data":{"result":[{"stream":{"job":"a"},"values":[["1705312801000000000","buffered line"]]}]}}`), nil
+	})
+	go mcpServer.Run()
+	defer mcpServer.Shutdown(context.Background())
+	httpServer := httptest.NewServer(mcpHandler.HandleMCP())
+	defer httpServer.Close()
+
+	t.Setenv("MCP_CONFIG", "")
+	path := filepath.Join(t.TempDir(), "tail.log")
+	code := run([]string{"--server-url", httpServer.URL, "--output-file", path, "--retries", "0", "loki_tail", `{job="a"}`, "1m"})
+	if code != 1 {
+		t.Errorf("Expected exit code 1, got %d", code)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "buffered line") {
+		t.Errorf("Expected the entries of the first window in the file, got %q", data)
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"syscall"
+	"time"
+
+	"github.com/ThinkInAIXYZ/go-mcp/client"
+	"github.com/ThinkInAIXYZ/go-mcp/pkg"
+)
+
+// Delay before the first retry of a call that failed on a transport error, doubled for each retry
+const retryBackoff = 500 * time.Millisecond
+
+// session holds the connection to the MCP server. When a call fails on a transport error, such as
+// the server restarting, the connection is dropped and the next attempt opens a new one.
+type session struct {
+	connect func() (*client.Client, error)
+	client  *client.Client
+	retries int
+	backoff time.Duration
+	log     io.Writer
+}
+
+// Tools that change data in Loki, whose calls are only retried when they cannot have reached the
+// server, so that a call that was carried out before the connection dropped is not repeated
+var destructiveTools = map[string]bool{"loki_delete": true}
+
+// newSession connects to the server with connect, retrying on transport errors
+func newSession(ctx context.Context, connect func() (*client.Client, error), retries int) (*session, error) {
+	s := &session{connect: connect, retries: retries, backoff: retryBackoff, log: os.Stderr}
+	mcpClient, err := withRetries(ctx, s, isTransportError, connect)
+	if err != nil {
+		return nil, err
+	}
+	s.client = mcpClient
+	return s, nil
+}
+
+// Close closes the current connection, if any
+func (s *session) Close() {
+	if s.client != nil {
+		s.client.Close()
+		s.client = nil
+	}
+}
+
+// sessionCall runs fn with a connected client, reconnecting after transport errors and retrying
+// those for which retry returns true. Errors returned by the server, such as an invalid query,
+// are not retried.
+func sessionCall[T any](ctx context.Context, s *session, retry func(error) bool, fn func(*client.Client) (T, error)) (T, error) {
+	return withRetries(ctx, s, retry, func() (T, error) {
+		var zero T
+		if s.client == nil {
+			mcpClient, err := s.connect()
+			if err != nil {
+				return zero, err
+			}
+			s.client = mcpClient
+		}
+		result, err := fn(s.client)
+		if err != nil && isTransportError(err) {
+			// The server may have restarted and forgotten the session, so start a new one
+			s.Close()
+		}
+		return result, err
+	})
+}
+
+// withRetries runs fn, and runs it again up to s.retries times with a doubling backoff for as
+// long as it fails on an error for which retry returns true and ctx is not done
+func withRetries[T any](ctx context.Context, s *session, retry func(error) bool, fn func() (T, error)) (T, error) {
+	delay := s.backoff
+	for attempt := 0; ; attempt++ {
+		result, err := fn()
+		if err == nil || attempt >= s.retries || !retry(err) {
+			return result, err
+		}
+		fmt.Fprintf(s.log, "Retrying in %s after transport error (%d of %d): %v\n", delay, attempt+1, s.retries, err)
+		select {
+		case <-ctx.Done():
+			return result, err
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+// isTransportError reports whether err means the server could not be reached or dropped the
+// connection or session, as opposed to an error returned by the server or a timeout
+func isTransportError(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+		return false
+	}
+	return errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, pkg.ErrSessionClosed)
+}
+
+// isUndeliveredError reports whether err is a transport error that means the request never reached
+// a tool: the server refused the connection or no longer knew the session. After other transport
+// errors, such as a dropped connection, the server may have run the call.
+func isUndeliveredError(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+		return false
+	}
+	return errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, pkg.ErrSessionClosed)
+}
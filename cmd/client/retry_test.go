@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/ThinkInAIXYZ/go-mcp/client"
+	"github.com/ThinkInAIXYZ/go-mcp/pkg"
+	"github.com/ThinkInAIXYZ/go-mcp/protocol"
+	"github.com/ThinkInAIXYZ/go-mcp/server"
+	"github.com/ThinkInAIXYZ/go-mcp/transport"
+)
+
+// TestWithRetries verifies that only transport errors are retried, at most --retries times
+func TestWithRetries(t *testing.T) {
+	var log bytes.Buffer
+	s := &session{retries: 2, backoff: time.Millisecond, log: &log}
+
+	attempts := 0
+	result, err := withRetries(context.Background(), s, isTransportError, func() (string, error) {
+		attempts++
+		if attempts < 3 {
+			return "", fmt.Errorf("callServer: %w", io.EOF)
+		}
+		return "ok", nil
+	})
+	if err != nil || result != "ok" || attempts != 3 {
+		t.Errorf("Expected success on the third attempt, got %q, %v after %d attempts", result, err, attempts)
+	}
+	if !bytes.Contains(log.Bytes(), []byte("Retrying in 1ms after transport error (1 of 2)")) {
+		t.Errorf("Unexpected retry log %q", log.String())
+	}
+
+	attempts = 0
+	if _, err := withRetries(context.Background(), s, isTransportError, func() (string, error) {
+		attempts++
+		return "", pkg.ErrSessionClosed
+	}); err == nil || attempts != 3 {
+		t.Errorf("Expected the error after 3 attempts, got %v after %d", err, attempts)
+	}
+
+	// Errors from the server are returned at once
+	attempts = 0
+	if _, err := withRetries(context.Background(), s, isTransportError, func() (string, error) {
+		attempts++
+		return "", pkg.NewResponseError(-32602, "invalid query", nil)
+	}); err == nil || attempts != 1 {
+		t.Errorf("Expected no retry of a server error, got %v after %d attempts", err, attempts)
+	}
+
+	// A done context stops the retries
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	s.backoff = time.Hour
+	attempts = 0
+	if _, err := withRetries(ctx, s, isTransportError, func() (string, error) {
+		attempts++
+		return "", io.ErrUnexpectedEOF
+	}); err == nil || attempts != 1 {
+		t.Errorf("Expected to stop with the context, got %v after %d attempts", err, attempts)
+	}
+}
+
+// TestIsTransportError verifies that a server that is down is recognized as a transport error
+func TestIsTransportError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	server.Close()
+
+	transportClient, err := transport.NewStreamableHTTPClientTransport(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = client.NewClient(transportClient)
+	if err == nil || !isTransportError(err) {
+		t.Errorf("Expected a transport error connecting to a stopped server, got %v", err)
+	}
+
+	for _, err := range []error{context.DeadlineExceeded, errors.New("invalid query"), fmt.Errorf("wrapped: %w", context.Canceled)} {
+		if isTransportError(err) {
+			t.Errorf("Expected %v not to be a transport error", err)
+		}
+	}
+}
+
+// TestCallToolRetries verifies that a call the server received before the connection dropped is
+// retried for read-only tools, but not for destructive ones such as loki_delete
+func TestCallToolRetries(t *testing.T) {
+	mcpTransport, mcpHandler, err := transport.NewStreamableHTTPServerTransportAndHandler(
+		transport.WithStreamableHTTPServerTransportAndHandlerOptionStateMode(transport.Stateless),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mcpServer, err := server.NewServer(mcpTransport)
+	if err != nil {
+		t.Fatal(err)
+	}
+	calls := map[string]int{}
+	for _, name := range []string{"loki_query", "loki_delete"} {
+		tool, err := protocol.NewTool(name, name, struct {
+			Query string `json:"query"`
+		}{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		mcpServer.RegisterTool(tool, func(ctx context.Context, request *protocol.CallToolRequest) (*protocol.CallToolResult, error) {
+			calls[request.Name]++
+			return &protocol.CallToolResult{Content: []protocol.Content{&protocol.TextContent{Type: "text", Text: "done"}}}, nil
+		})
+	}
+	go mcpServer.Run()
+	defer mcpServer.Shutdown(context.Background())
+
+	// Run every tool call, then drop the connection instead of answering
+	handler := mcpHandler.HandleMCP()
+	httpServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		if !bytes.Contains(body, []byte(`"tools/call"`)) {
+			handler.ServeHTTP(w, r)
+			return
+		}
+		handler.ServeHTTP(httptest.NewRecorder(), r)
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err == nil {
+			conn.Close()
+		}
+	}))
+	defer httpServer.Close()
+
+	connect := func() (*client.Client, error) {
+		transportClient, err := transport.NewStreamableHTTPClientTransport(httpServer.URL)
+		if err != nil {
+			return nil, err
+		}
+		return client.NewClient(transportClient)
+	}
+	s, err := newSession(context.Background(), connect, 2)
+	if err != nil {
+		t.Fatalf("newSession failed: %v", err)
+	}
+	defer s.Close()
+	s.backoff = time.Millisecond
+	s.log = io.Discard
+	trace := &tracer{w: io.Discard}
+
+	for _, name := range []string{"loki_query", "loki_delete"} {
+		request := &protocol.CallToolRequest{Name: name, RawArguments: []byte(`{"query":"{job=\"a\"}"}`)}
+		if _, err := callTool(context.Background(), trace, s, request); err == nil {
+			t.Errorf("Expected %s to fail on the dropped connection", name)
+		}
+	}
+	if calls["loki_query"] != 3 {
+		t.Errorf("Expected loki_query to be retried twice, got %d calls", calls["loki_query"])
+	}
+	if calls["loki_delete"] != 1 {
+		t.Errorf("Expected loki_delete not to be retried, got %d calls", calls["loki_delete"])
+	}
+
+	// A refused connection never reaches the server, so even loki_delete is retried
+	attempts := 0
+	if _, err := withRetries(context.Background(), s, isUndeliveredError, func() (string, error) {
+		attempts++
+		return "", fmt.Errorf("dial: %w", syscall.ECONNREFUSED)
+	}); err == nil || attempts != 3 {
+		t.Errorf("Expected a refused connection to be retried, got %v after %d attempts", err, attempts)
+	}
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ThinkInAIXYZ/go-mcp/protocol"
+)
+
+// Longest loki_tail call made by the tail command, so that entries are printed soon after they arrive
+const tailWindow = 5 * time.Second
+
+// Entries asked for in each loki_tail call; the server caps it at LOKI_MAX_LIMIT, and a window that
+// stops at the limit is picked up by the next one
+const tailLimit = 5000
+
+// tailCaller calls the loki_tail tool with the given arguments
+type tailCaller func(ctx context.Context, toolArgs map[string]interface{}) (*protocol.CallToolResult, error)
+
+// parseTailArgs parses the arguments of the loki_tail command: a query and an optional duration,
+// which is zero when the tail should run until interrupted
+func parseTailArgs(args []string) (string, time.Duration, error) {
+	if len(args) < 1 || len(args) > 2 {
+		return "", 0, fmt.Errorf("expected a query and an optional duration")
+	}
+	if len(args) == 1 {
+		return args[0], 0, nil
+	}
+	duration, err := parseTimeout(args[1])
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid duration %q: must be a positive duration such as 2m or a number of seconds", args[1])
+	}
+	return args[0], duration, nil
+}
+
+// runTail tails the query by calling loki_tail for successive windows of at most tailWindow, and
+// writes the entries of each window to w as soon as it returns, until duration has elapsed (or
+// forever when it is zero) or ctx is cancelled. Each window starts 1ns after the newest entry
+// written so far, so entries arriving between calls are not lost; only entries sharing that
+// entry's exact timestamp could be. Entries already written stay written when ctx is cancelled,
+// so interrupting the tail loses at most the window in progress. It returns the number of entries
+// written.
+func runTail(ctx context.Context, call tailCaller, toolArgs map[string]interface{}, duration time.Duration, w io.Writer, output string) (int, error) {
+	var deadline time.Time
+	if duration > 0 {
+		deadline = time.Now().Add(duration)
+	}
+
+	total := 0
+	var newest int64
+	for ctx.Err() == nil {
+		window := tailWindow
+		if !deadline.IsZero() {
+			remaining := time.Until(deadline)
+			if remaining <= 0 {
+				break
+			}
+			window = min(window, remaining)
+		}
+
+		args := make(map[string]interface{}, len(toolArgs)+4)
+		for k, v := range toolArgs {
+			args[k] = v
+		}
+		args["duration"] = window.String()
+		args["format"] = "json"
+		args["limit"] = tailLimit
+		if newest > 0 {
+			args["start"] = strconv.FormatInt(newest+1, 10)
+		}
+
+		result, err := call(ctx, args)
+		if err != nil {
+			// An interrupted tail stops with the entries written so far
+			if ctx.Err() != nil {
+				break
+			}
+			return total, err
+		}
+
+		lines, last, err := formatTailEntries(result)
+		newest = max(newest, last)
+		if output == "json" {
+			// The raw result is printed as is, so a failed window is shown rather than returned
+			if err := printJSON(w, result); err != nil {
+				return total, err
+			}
+			total += len(lines)
+			continue
+		}
+		if err != nil {
+			return total, err
+		}
+		for _, line := range lines {
+			fmt.Fprintln(w, line)
+		}
+		total += len(lines)
+	}
+	return total, nil
+}
+
+// formatTailEntries turns the json output of loki_tail into one line per entry, oldest first,
+// each with its timestamp and stream labels, like tail -f. It also returns the timestamp of the
+// newest entry in Unix nanoseconds, 0 if there is none.
+func formatTailEntries(result *protocol.CallToolResult) ([]string, int64, error) {
+	if len(result.Content) == 0 {
+		return nil, 0, nil
+	}
+	textContent, ok := result.Content[0].(*protocol.TextContent)
+	if !ok {
+		return nil, 0, nil
+	}
+	if result.IsError {
+		return nil, 0, fmt.Errorf("loki_tail failed: %s", textContent.Text)
+	}
+
+	var response struct {
+		Data struct {
+			Result []struct {
+				Stream map[string]string `json:"stream"`
+				Values [][]string        `json:"values"`
+			} `json:"result"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal([]byte(textContent.Text), &response); err != nil {
+		return nil, 0, fmt.Errorf("unexpected loki_tail output: %v", err)
+	}
+
+	type entry struct {
+		ts   int64
+		line string
+	}
+	var entries []entry
+	for _, stream := range response.Data.Result {
+		labels := formatTailLabels(stream.Stream)
+		for _, value := range stream.Values {
+			if len(value) < 2 {
+				continue
+			}
+			ts, err := strconv.ParseInt(value[0], 10, 64)
+			if err != nil {
+				continue
+			}
+			stamp := time.Unix(0, ts).UTC().Format("2006-01-02T15:04:05.000Z07:00")
+			entries = append(entries, entry{ts: ts, line: fmt.Sprintf("%s %s %s", stamp, labels, value[1])})
+		}
+	}
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].ts < entries[j].ts })
+
+	lines := make([]string, len(entries))
+	for i, e := range entries {
+		lines[i] = e.line
+	}
+	if len(entries) == 0 {
+		return lines, 0, nil
+	}
+	return lines, entries[len(entries)-1].ts, nil
+}
+
+// formatTailLabels renders stream labels as {k="v", ...} with sorted keys
+func formatTailLabels(stream map[string]string) string {
+	keys := make([]string, 0, len(stream))
+	for k := range stream {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		parts = append(parts, fmt.Sprintf("%s=%q", k, stream[k]))
+	}
+	return "{" + strings.Join(parts, ", ") + "}"
+}
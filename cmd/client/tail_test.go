@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ThinkInAIXYZ/go-mcp/protocol"
+)
+
+// tailResult returns a loki_tail result in json format
+func tailResult(text string) *protocol.CallToolResult {
+	return &protocol.CallToolResult{Content: []protocol.Content{&protocol.TextContent{Type: "text", Text: text}}}
+}
+
+// TestParseTailArgs verifies the query and optional duration of the loki_tail command
+func TestParseTailArgs(t *testing.T) {
+	query, duration, err := parseTailArgs([]string{`{job="a"}`})
+	if err != nil || query != `{job="a"}` || duration != 0 {
+		t.Errorf("Unexpected %q, %s, %v", query, duration, err)
+	}
+	if _, duration, err = parseTailArgs([]string{`{job="a"}`, "2m"}); err != nil || duration != 2*time.Minute {
+		t.Errorf("Expected 2m, got %s, %v", duration, err)
+	}
+	for _, args := range [][]string{nil, {`{job="a"}`, "soon"}, {`{job="a"}`, "1m", "extra"}} {
+		if _, _, err := parseTailArgs(args); err == nil {
+			t.Errorf("Expected error for %v", args)
+		}
+	}
+}
+
+// TestFormatTailEntries verifies that entries are printed oldest first with their labels
+func TestFormatTailEntries(t *testing.T) {
+	lines, newest, err := formatTailEntries(tailResult(`{"status":"success","data":{"resultType":"streams","result":[
+		{"stream":{"pod":"b","job":"api"},"values":[["1705312802000000000","second"]]},
+		{"stream":{"job":"api","pod":"a"},"values":[["1705312801500000000","first"]]}]}}`))
+	if err != nil {
+		t.Fatalf("formatTailEntries failed: %v", err)
+	}
+	want := []string{
+		`2024-01-15T10:00:01.500Z {job="api", pod="a"} first`,
+		`2024-01-15T10:00:02.000Z {job="api", pod="b"} second`,
+	}
+	if strings.Join(lines, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Expected %q, got %q", want, lines)
+	}
+	if newest != 1705312802000000000 {
+		t.Errorf("Expected the newest timestamp 1705312802000000000, got %d", newest)
+	}
+
+	failed := tailResult("tail execution failed")
+	failed.IsError = true
+	if _, _, err := formatTailEntries(failed); err == nil {
+		t.Error("Expected error for a failed call")
+	}
+}
+
+// TestRunTail verifies that windows are printed as they return and that an interrupt keeps them
+func TestRunTail(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	calls := 0
+	call := func(ctx context.Context, toolArgs map[string]interface{}) (*protocol.CallToolResult, error) {
+		calls++
+		if toolArgs["format"] != "json" || toolArgs["query"] != `{job="a"}` || toolArgs["duration"] != tailWindow.String() || toolArgs["limit"] != tailLimit {
+			t.Errorf("Unexpected arguments %v", toolArgs)
+		}
+		// Each window resumes right after the newest entry of the previous ones
+		if start, _ := toolArgs["start"].(string); (calls == 1 && start != "") || (calls > 1 && start != "1705312801000000001") {
+			t.Errorf("Unexpected start %q for call %d", start, calls)
+		}
+		if calls == 3 {
+			// Ctrl+C while the third window is in progress
+			cancel()
+			return nil, ctx.Err()
+		}
+		return tailResult(`{"data":{"result":[{"stream":{"job":"a"},"values":[["1705312801000000000","line"]]}]}}`), nil
+	}
+
+	var out bytes.Buffer
+	total, err := runTail(ctx, call, map[string]interface{}{"query": `{job="a"}`}, 0, &out, "text")
+	if err != nil {
+		t.Fatalf("runTail failed: %v", err)
+	}
+	if total != 2 || strings.Count(out.String(), "line\n") != 2 {
+		t.Errorf("Expected the entries of the first two windows, got %d: %q", total, out.String())
+	}
+
+	// The entries of raw json results are counted too
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	calls = 0
+	out.Reset()
+	total, err = runTail(ctx, func(ctx context.Context, toolArgs map[string]interface{}) (*protocol.CallToolResult, error) {
+		if calls++; calls == 2 {
+			cancel()
+			return nil, ctx.Err()
+		}
+		return tailResult(`{"data":{"result":[{"stream":{"job":"a"},"values":[["1705312801000000000","a"],["1705312802000000000","b"]]}]}}`), nil
+	}, map[string]interface{}{}, 0, &out, "json")
+	if err != nil || total != 2 {
+		t.Errorf("Expected 2 entries counted in json output, got %d, %v", total, err)
+	}
+
+	// A duration shorter than a window makes a single shorter call
+	call = func(ctx context.Context, toolArgs map[string]interface{}) (*protocol.CallToolResult, error) {
+		if d, _ := time.ParseDuration(toolArgs["duration"].(string)); d > 50*time.Millisecond {
+			t.Errorf("Expected a window within the duration, got %v", toolArgs["duration"])
+		}
+		time.Sleep(60 * time.Millisecond)
+		return tailResult(`{"data":{"result":[]}}`), nil
+	}
+	if _, err := runTail(context.Background(), call, map[string]interface{}{}, 50*time.Millisecond, &out, "text"); err != nil {
+		t.Errorf("runTail failed: %v", err)
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/ThinkInAIXYZ/go-mcp/client"
+	"github.com/ThinkInAIXYZ/go-mcp/protocol"
+)
+
+// tracer prints each MCP round-trip to w when --verbose is set: the server URL, the method and its
+// marshaled arguments, then the elapsed time and the raw result. It writes nothing otherwise.
+type tracer struct {
+	w         io.Writer
+	serverURL string
+	enabled   bool
+}
+
+// traced runs fn as the MCP method with the given arguments, tracing it with t
+func traced[T any](t *tracer, method string, rawArgs json.RawMessage, fn func() (T, error)) (T, error) {
+	if !t.enabled {
+		return fn()
+	}
+
+	fmt.Fprintf(t.w, "[verbose] server: %s\n", t.serverURL)
+	if rawArgs != nil {
+		fmt.Fprintf(t.w, "[verbose] request: %s %s\n", method, rawArgs)
+	} else {
+		fmt.Fprintf(t.w, "[verbose] request: %s\n", method)
+	}
+
+	start := time.Now()
+	result, err := fn()
+	elapsed := time.Since(start).Round(time.Millisecond)
+	if err != nil {
+		fmt.Fprintf(t.w, "[verbose] error after %s: %v\n", elapsed, err)
+		return result, err
+	}
+	fmt.Fprintf(t.w, "[verbose] response after %s:\n", elapsed)
+	printJSON(t.w, result)
+	return result, nil
+}
+
+// callTool calls a tool through s, tracing the call with t. Calls of destructive tools are only
+// retried when they cannot have reached the server.
+func callTool(ctx context.Context, t *tracer, s *session, request *protocol.CallToolRequest) (*protocol.CallToolResult, error) {
+	retry := isTransportError
+	if destructiveTools[request.Name] {
+		retry = isUndeliveredError
+	}
+	return traced(t, "tools/call "+request.Name, request.RawArguments, func() (*protocol.CallToolResult, error) {
+		return sessionCall(ctx, s, retry, func(mcpClient *client.Client) (*protocol.CallToolResult, error) {
+			return mcpClient.CallTool(ctx, request)
+		})
+	})
+}
+
+// listTools lists the tools of the server through s, tracing the call with t
+func listTools(ctx context.Context, t *tracer, s *session) (*protocol.ListToolsResult, error) {
+	return traced(t, "tools/list", nil, func() (*protocol.ListToolsResult, error) {
+		return sessionCall(ctx, s, isTransportError, func(mcpClient *client.Client) (*protocol.ListToolsResult, error) {
+			return mcpClient.ListTools(ctx)
+		})
+	})
+}
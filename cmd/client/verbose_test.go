@@ -0,0 +1,52 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/ThinkInAIXYZ/go-mcp/protocol"
+)
+
+// TestTraced verifies what --verbose prints around a call, and that nothing is printed without it
+func TestTraced(t *testing.T) {
+	var buf bytes.Buffer
+	trace := &tracer{w: &buf, serverURL: "http://localhost:8000/mcp", enabled: true}
+
+	result, err := traced(trace, "tools/call loki_query", json.RawMessage(`{"query":"{job=\"x\"}"}`), func() (*protocol.CallToolResult, error) {
+		return tailResult("3 entries"), nil
+	})
+	if err != nil || result == nil {
+		t.Fatalf("traced failed: %v", err)
+	}
+	out := buf.String()
+	for _, want := range []string{
+		"[verbose] server: http://localhost:8000/mcp\n",
+		`[verbose] request: tools/call loki_query {"query":"{job=\"x\"}"}` + "\n",
+		"[verbose] response after ",
+		`"text": "3 entries"`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Expected %q in %q", want, out)
+		}
+	}
+
+	buf.Reset()
+	if _, err := traced(trace, "tools/list", nil, func() (*protocol.ListToolsResult, error) {
+		return nil, errors.New("connection refused")
+	}); err == nil {
+		t.Error("Expected the error of the call")
+	}
+	if !strings.Contains(buf.String(), "[verbose] request: tools/list\n") || !strings.Contains(buf.String(), ": connection refused") {
+		t.Errorf("Unexpected trace %q", buf.String())
+	}
+
+	buf.Reset()
+	trace.enabled = false
+	traced(trace, "tools/list", nil, func() (*protocol.ListToolsResult, error) { return &protocol.ListToolsResult{}, nil })
+	if buf.Len() != 0 {
+		t.Errorf("Expected no output without --verbose, got %q", buf.String())
+	}
+}
@@ -3,11 +3,16 @@ package main
 import (
 	"context"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
+	"time"
+
+	// Embed the IANA timezone database; the Alpine runtime image ships without one
+	_ "time/tzdata"
 
 	"github.com/ThinkInAIXYZ/go-mcp/protocol"
 	"github.com/ThinkInAIXYZ/go-mcp/server"
@@ -18,143 +23,510 @@ import (
 
 const (
 	version = "0.1.0"
+
+	// Values of the MCP_TRANSPORT environment variable
+	transportHTTP  = "http"
+	transportStdio = "stdio"
 )
 
 func main() {
-	log.Println("=== Loki MCP Server Starting ===")
-	log.Printf("Version: %s", version)
-
-	// Get port from environment variable or use default
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8000"
-		log.Println("PORT environment variable not set, using default: 8000")
-	} else {
-		log.Printf("PORT environment variable set to: %s", port)
+	// Configure the logger first so that everything below goes through it
+	if err := handlers.SetupLogging(); err != nil {
+		fatal("Failed to configure logging", err)
 	}
 
-	// Get host from environment variable or use default (0.0.0.0 to listen on all interfaces)
-	host := os.Getenv("HOST")
-	if host == "" {
-		host = "0.0.0.0"
-		log.Println("HOST environment variable not set, using default: 0.0.0.0 (all interfaces)")
-	} else {
-		log.Printf("HOST environment variable set to: %s", host)
+	slog.Info("=== Loki MCP Server Starting ===", "version", version)
+
+	// Get transport from environment variable or use default
+	transportMode := os.Getenv("MCP_TRANSPORT")
+	switch transportMode {
+	case "":
+		transportMode = transportHTTP
+		slog.Info("MCP_TRANSPORT environment variable not set, using default", "MCP_TRANSPORT", transportMode)
+	case transportHTTP, transportStdio:
+		slog.Info("MCP_TRANSPORT environment variable set", "MCP_TRANSPORT", transportMode)
+	default:
+		fatal("Invalid MCP_TRANSPORT", fmt.Errorf("%q must be %s or %s", transportMode, transportHTTP, transportStdio))
 	}
 
-	// Log Loki configuration
-	log.Println("Checking Loki configuration...")
-	if lokiURL := os.Getenv("LOKI_URL"); lokiURL != "" {
-		log.Printf("  - LOKI_URL: %s", lokiURL)
-	} else {
-		log.Println("  - LOKI_URL: not set (will use default or per-request URL)")
+	var host, port string
+	if transportMode == transportHTTP {
+		// Get port from environment variable or use default
+		port = os.Getenv("PORT")
+		if port == "" {
+			port = "8000"
+			slog.Info("PORT environment variable not set, using default", "PORT", port)
+		} else {
+			slog.Info("PORT environment variable set", "PORT", port)
+		}
+
+		// Get host from environment variable or use default (0.0.0.0 to listen on all interfaces)
+		host = os.Getenv("HOST")
+		if host == "" {
+			host = "0.0.0.0"
+			slog.Info("HOST environment variable not set, using default (all interfaces)", "HOST", host)
+		} else {
+			slog.Info("HOST environment variable set", "HOST", host)
+		}
 	}
-	if lokiOrgID := os.Getenv("LOKI_ORG_ID"); lokiOrgID != "" {
-		log.Printf("  - LOKI_ORG_ID: %s", lokiOrgID)
-	} else {
-		log.Println("  - LOKI_ORG_ID: not set")
+
+	// Log Loki configuration, without revealing secrets
+	slog.Info("Checking Loki configuration...",
+		"LOKI_URL", envOrNotSet("LOKI_URL", os.Getenv("LOKI_URL"), "not set (will use default or per-request URL)"),
+		"LOKI_ORG_ID", envOrNotSet("LOKI_ORG_ID", os.Getenv("LOKI_ORG_ID"), "not set"),
+		"LOKI_USERNAME", envOrNotSet("LOKI_USERNAME", os.Getenv("LOKI_USERNAME"), "not set"),
+		"LOKI_PASSWORD", envOrNotSet("LOKI_PASSWORD", "****** (set)", "not set"),
+		"LOKI_TOKEN", envOrNotSet("LOKI_TOKEN", "****** (set)", "not set"),
+	)
+
+	// Load centralized Loki defaults, failing fast on malformed configuration
+	lokiDefaults, err := handlers.LoadLokiDefaults()
+	if err != nil {
+		fatal("Failed to load Loki defaults", err)
 	}
-	if lokiUsername := os.Getenv("LOKI_USERNAME"); lokiUsername != "" {
-		log.Printf("  - LOKI_USERNAME: %s", lokiUsername)
+	if os.Getenv(handlers.EnvLokiDefaults) != "" {
+		slog.Info(handlers.EnvLokiDefaults+" loaded", "url", lokiDefaults.URL, "org", lokiDefaults.Org,
+			"limit", lokiDefaults.Limit, "format", lokiDefaults.Format,
+			"headers", len(lokiDefaults.Headers), "params", len(lokiDefaults.Params))
 	} else {
-		log.Println("  - LOKI_USERNAME: not set")
+		slog.Info(handlers.EnvLokiDefaults + " not set")
+	}
+
+	// Refuse to start with redaction patterns that cannot be applied, rather than return unmasked lines
+	redactNames, err := handlers.CheckLokiRedact()
+	if err != nil {
+		fatal("Failed to configure redaction", err)
+	}
+	if len(redactNames) > 0 {
+		slog.Info("Returned log lines are redacted", handlers.EnvLokiRedact, strings.Join(redactNames, ","))
+	}
+
+	// Reject an unknown default format rather than silently falling back to raw
+	defaultFormat, err := handlers.CheckLokiDefaultFormat()
+	if err != nil {
+		fatal("Failed to configure default output format", err)
+	}
+	if defaultFormat != "" {
+		slog.Info("Default output format configured", handlers.EnvLokiDefaultFormat, defaultFormat)
 	}
-	if os.Getenv("LOKI_PASSWORD") != "" {
-		log.Println("  - LOKI_PASSWORD: ****** (set)")
+
+	// Validate the width lines are cut to in the markdown format
+	if _, err := handlers.CheckLokiMarkdownMaxWidth(); err != nil {
+		fatal("Failed to configure markdown format", err)
+	}
+
+	// Validate the query cache settings, since a typo would otherwise silently leave the cache off
+	queryCacheTTL, queryCacheSize, err := handlers.CheckLokiQueryCache()
+	if err != nil {
+		fatal("Failed to configure query cache", err)
+	}
+	if queryCacheTTL > 0 {
+		slog.Info("Query cache configured", "ttl", queryCacheTTL, "size", queryCacheSize)
+	}
+
+	// Validate the label cache settings, since a typo would otherwise silently cache for the default TTL
+	labelCacheTTL, labelCacheSize, err := handlers.CheckLokiLabelCache()
+	if err != nil {
+		fatal("Failed to configure label cache", err)
+	}
+	if labelCacheTTL == 0 {
+		slog.Info("Label cache disabled", handlers.EnvLokiLabelCacheTTL, os.Getenv(handlers.EnvLokiLabelCacheTTL))
 	} else {
-		log.Println("  - LOKI_PASSWORD: not set")
+		slog.Info("Label cache configured", "ttl", labelCacheTTL, "size", labelCacheSize)
+	}
+
+	// Validate the default Loki URL so that a typo stops startup rather than the first query
+	lokiURL, err := handlers.CheckLokiURL()
+	if err != nil {
+		fatal("Failed to configure Loki URL", err)
+	}
+	slog.Info("Loki URL configured", "url", lokiURL)
+	replicas, err := handlers.CheckLokiURLs()
+	if err != nil {
+		fatal("Failed to configure Loki replicas", err)
+	}
+	if len(replicas) > 1 {
+		slog.Info("Loki requests fail over across replicas", "urls", strings.Join(replicas, ","))
+	}
+
+	// Validate the named Loki backends that requests can select
+	backends, err := handlers.CheckLokiBackends()
+	if err != nil {
+		fatal("Failed to load Loki backends", err)
+	}
+	if len(backends) > 0 {
+		slog.Info("Loki backends configured", "backends", strings.Join(backends, ", "))
+	}
+
+	// Check whether every request must name its tenant
+	requireOrg, err := handlers.LokiRequireOrg()
+	if err != nil {
+		fatal("Failed to configure org enforcement", err)
+	}
+	if requireOrg {
+		slog.Info("Requests without an org ID are refused", handlers.EnvLokiRequireOrg, true, "default_org", os.Getenv(handlers.EnvLokiOrgID))
+	}
+
+	// Report credentials that are configured but never used
+	if err := handlers.CheckLokiCredentials(); err != nil {
+		slog.Warn(err.Error())
+	}
+
+	// Report an unusable default time window; queries fall back to the last hour
+	if lookback, err := handlers.LokiDefaultLookback(); err != nil {
+		slog.Warn(err.Error())
+	} else if os.Getenv(handlers.EnvLokiDefaultLookback) != "" {
+		slog.Info("Default query window configured", handlers.EnvLokiDefaultLookback, lookback.String())
+	}
+
+	// Refuse to start with an unusable maximum time range, since every query would fail on it
+	maxRange, err := handlers.LokiMaxTimeRange()
+	if err != nil {
+		fatal("Failed to configure maximum query time range", err)
+	}
+	if maxRange > 0 {
+		slog.Info("Query time ranges are limited", handlers.EnvLokiMaxTimeRange, maxRange.String())
+	}
+
+	// Validate the connection pool options shared by all Loki requests
+	if err := handlers.CheckLokiPool(); err != nil {
+		fatal("Failed to configure Loki connection pool", err)
+	}
+
+	// Validate the cap on Loki response sizes
+	if err := handlers.CheckLokiMaxResponseBytes(); err != nil {
+		fatal("Failed to configure Loki response size limit", err)
+	}
+
+	// Validate the size above which query results are returned as resource links
+	threshold, err := handlers.CheckLokiResourceThreshold()
+	if err != nil {
+		fatal("Failed to configure result resource links", err)
+	}
+	resourceTTL, resourceMax, err := handlers.CheckLokiResourceStore()
+	if err != nil {
+		fatal("Failed to configure result resource links", err)
+	}
+	if threshold > 0 {
+		slog.Info("Large query results are returned as resource links", handlers.EnvLokiResourceThreshold, threshold, "ttl", resourceTTL, "max", resourceMax)
+	}
+
+	// Validate the limit on concurrent Loki requests
+	if err := handlers.CheckLokiConcurrency(); err != nil {
+		fatal("Failed to configure Loki concurrency", err)
 	}
-	if os.Getenv("LOKI_TOKEN") != "" {
-		log.Println("  - LOKI_TOKEN: ****** (set)")
+
+	// Validate how org IDs are labeled in the per-org metrics
+	metricsOrgs, orgBuckets, err := handlers.CheckLokiMetricsOrgs()
+	if err != nil {
+		fatal("Failed to configure per-org metrics", err)
+	}
+	if len(metricsOrgs) > 0 || orgBuckets > 0 {
+		slog.Info("Per-org metrics are bounded", handlers.EnvLokiMetricsOrgs, metricsOrgs, handlers.EnvLokiMetricsOrgBuckets, orgBuckets)
+	}
+
+	// Validate the per-tenant rate limit
+	rate, burst, err := handlers.CheckLokiRateLimit()
+	if err != nil {
+		fatal("Failed to configure Loki rate limit", err)
+	}
+	if rate > 0 {
+		slog.Info("Loki requests are rate limited per tenant", handlers.EnvLokiRateLimit, rate, handlers.EnvLokiRateLimitBurst, burst)
+	}
+
+	// Load TLS certificates up front so a bad CA bundle or client key pair stops startup
+	if err := handlers.CheckLokiTLS(); err != nil {
+		fatal("Failed to configure Loki TLS", err)
+	}
+
+	// Report whether requests to Loki go through a proxy
+	proxy, err := handlers.CheckLokiProxy()
+	if err != nil {
+		fatal("Failed to configure Loki proxy", err)
+	}
+	if proxy != "" {
+		slog.Info("Loki requests go through a proxy", "proxy", proxy)
 	} else {
-		log.Println("  - LOKI_TOKEN: not set")
+		slog.Info("Loki requests are sent directly, no proxy in effect")
 	}
 
-	// Create Streamable HTTP transport
-	// The message endpoint is where the MCP protocol messages are sent
-	log.Println("Creating Streamable HTTP transport...")
+	// Resolve AWS credentials up front when requests to Loki are signed with SigV4
+	if err := handlers.CheckLokiAuth(context.Background()); err != nil {
+		fatal("Failed to configure Loki authentication", err)
+	}
+	if mode := os.Getenv(handlers.EnvLokiAuthMode); mode != "" {
+		slog.Info("Loki authentication configured", handlers.EnvLokiAuthMode, mode)
+	}
 
-	streamableTransport, mcpHandler, err := transport.NewStreamableHTTPServerTransportAndHandler(
-		transport.WithStreamableHTTPServerTransportAndHandlerOptionStateMode(transport.Stateless),
-	)
+	// Optionally check that Loki answers before serving, to catch misconfiguration early
+	probe, err := handlers.LokiStartupProbeEnabled()
+	if err != nil {
+		fatal("Failed to configure Loki startup probe", err)
+	}
+	if probe {
+		if err := handlers.ProbeLoki(context.Background()); err != nil {
+			slog.Warn("Loki startup probe failed", "url", lokiURL, "error", err)
+		} else {
+			slog.Info("Loki startup probe succeeded", "url", lokiURL)
+		}
+	}
+
+	// Bound how long shutdown waits for in-flight requests so a stuck request cannot hang it
+	shutdownTimeout, err := handlers.ShutdownTimeout()
 	if err != nil {
-		log.Fatalf("Failed to create streamable HTTP transport: %v", err)
+		fatal("Failed to configure shutdown", err)
+	}
+	slog.Info("Shutdown timeout configured", handlers.EnvShutdownTimeout, shutdownTimeout.String())
+
+	// Export traces when an OTLP endpoint is configured; tracing is a no-op otherwise
+	shutdownTracing, err := handlers.InitLokiTracing(context.Background())
+	if err != nil {
+		fatal("Failed to configure tracing", err)
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			slog.Error("Error flushing traces", "error", err)
+		}
+	}()
+	if endpoint := os.Getenv(handlers.EnvOTelExporterEndpoint); endpoint != "" {
+		slog.Info("Tracing enabled", handlers.EnvOTelExporterEndpoint, endpoint)
+	}
+
+	// Validate the readiness probe options
+	readiness, err := handlers.NewLokiReadiness()
+	if err != nil {
+		fatal("Failed to configure readiness probe", err)
+	}
+	if value := os.Getenv(handlers.EnvLokiReadyCheck); value != "" {
+		slog.Info("Readiness probe configured", handlers.EnvLokiReadyCheck, value)
+	}
+
+	var mcpTransport transport.ServerTransport
+	var mcpHandler *transport.StreamableHTTPHandler
+	if transportMode == transportStdio {
+		// Create stdio transport
+		// Protocol messages are exchanged over stdin and stdout; the logger writes to stderr
+		slog.Info("Creating stdio transport...")
+		mcpTransport = transport.NewStdioServerTransport(transport.WithStdioServerOptionLogger(slogLogger{}))
+		slog.Info("Stdio transport created successfully")
+	} else {
+		// Create Streamable HTTP transport
+		// The message endpoint is where the MCP protocol messages are sent
+		slog.Info("Creating Streamable HTTP transport...")
+
+		mcpTransport, mcpHandler, err = transport.NewStreamableHTTPServerTransportAndHandler(
+			transport.WithStreamableHTTPServerTransportAndHandlerOptionStateMode(transport.Stateless),
+		)
+		if err != nil {
+			fatal("Failed to create streamable HTTP transport", err)
+		}
+		slog.Info("Streamable HTTP transport created successfully (Stateless mode)")
 	}
-	log.Println("Streamable HTTP transport created successfully (Stateless mode)")
 
 	// Initialize MCP server
-	log.Println("Initializing MCP server...")
-	mcpServer, err := server.NewServer(streamableTransport, server.WithServerInfo(protocol.Implementation{
+	slog.Info("Initializing MCP server...")
+	mcpServer, err := server.NewServer(mcpTransport, server.WithServerInfo(protocol.Implementation{
 		Name:    "Loki MCP Server",
 		Version: version,
-	}))
+	}), server.WithLogger(slogLogger{}))
 	if err != nil {
-		log.Fatalf("Failed to create MCP server: %v", err)
+		fatal("Failed to create MCP server", err)
 	}
-	log.Println("MCP server initialized successfully")
+	slog.Info("MCP server initialized successfully")
 
 	// Register Loki query tool
-	log.Println("Registering Loki tools...")
+	slog.Info("Registering Loki tools...")
 
 	// Create and register loki_query tool
 	lokiQueryTool, err := handlers.NewLokiQueryToolProtocol()
 	if err != nil {
-		log.Fatalf("Failed to create loki_query tool: %v", err)
+		fatal("Failed to create loki_query tool", err)
 	}
-	mcpServer.RegisterTool(lokiQueryTool, handlers.HandleLokiQueryProtocol)
-	log.Println("  - loki_query tool registered")
+	mcpServer.RegisterTool(lokiQueryTool, handlers.InstrumentLokiTool(lokiQueryTool.Name, handlers.HandleLokiQueryProtocol))
+	slog.Info("Tool registered", "tool", "loki_query")
+
+	// Create and register loki_query_batch tool
+	lokiQueryBatchTool, err := handlers.NewLokiQueryBatchToolProtocol()
+	if err != nil {
+		fatal("Failed to create loki_query_batch tool", err)
+	}
+	mcpServer.RegisterTool(lokiQueryBatchTool, handlers.InstrumentLokiTool(lokiQueryBatchTool.Name, handlers.HandleLokiQueryBatchProtocol))
+	slog.Info("Tool registered", "tool", "loki_query_batch")
 
 	// Create and register loki_label_names tool
 	lokiLabelNamesTool, err := handlers.NewLokiLabelNamesToolProtocol()
 	if err != nil {
-		log.Fatalf("Failed to create loki_label_names tool: %v", err)
+		fatal("Failed to create loki_label_names tool", err)
 	}
-	mcpServer.RegisterTool(lokiLabelNamesTool, handlers.HandleLokiLabelNamesProtocol)
-	log.Println("  - loki_label_names tool registered")
+	mcpServer.RegisterTool(lokiLabelNamesTool, handlers.InstrumentLokiTool(lokiLabelNamesTool.Name, handlers.HandleLokiLabelNamesProtocol))
+	slog.Info("Tool registered", "tool", "loki_label_names")
 
 	// Create and register loki_label_values tool
 	lokiLabelValuesTool, err := handlers.NewLokiLabelValuesToolProtocol()
 	if err != nil {
-		log.Fatalf("Failed to create loki_label_values tool: %v", err)
+		fatal("Failed to create loki_label_values tool", err)
+	}
+	mcpServer.RegisterTool(lokiLabelValuesTool, handlers.InstrumentLokiTool(lokiLabelValuesTool.Name, handlers.HandleLokiLabelValuesProtocol))
+	slog.Info("Tool registered", "tool", "loki_label_values")
+
+	// Create and register loki_query_range tool
+	lokiQueryRangeTool, err := handlers.NewLokiQueryRangeToolProtocol()
+	if err != nil {
+		fatal("Failed to create loki_query_range tool", err)
+	}
+	mcpServer.RegisterTool(lokiQueryRangeTool, handlers.InstrumentLokiTool(lokiQueryRangeTool.Name, handlers.HandleLokiQueryRangeProtocol))
+	slog.Info("Tool registered", "tool", "loki_query_range")
+
+	// Create and register loki_tail tool
+	lokiTailTool, err := handlers.NewLokiTailToolProtocol()
+	if err != nil {
+		fatal("Failed to create loki_tail tool", err)
+	}
+	mcpServer.RegisterTool(lokiTailTool, handlers.InstrumentLokiTool(lokiTailTool.Name, handlers.HandleLokiTailProtocol))
+	slog.Info("Tool registered", "tool", "loki_tail")
+
+	// Create and register loki_series tool
+	lokiSeriesTool, err := handlers.NewLokiSeriesToolProtocol()
+	if err != nil {
+		fatal("Failed to create loki_series tool", err)
+	}
+	mcpServer.RegisterTool(lokiSeriesTool, handlers.InstrumentLokiTool(lokiSeriesTool.Name, handlers.HandleLokiSeriesProtocol))
+	slog.Info("Tool registered", "tool", "loki_series")
+
+	// Create and register loki_stats tool
+	lokiStatsTool, err := handlers.NewLokiStatsToolProtocol()
+	if err != nil {
+		fatal("Failed to create loki_stats tool", err)
+	}
+	mcpServer.RegisterTool(lokiStatsTool, handlers.InstrumentLokiTool(lokiStatsTool.Name, handlers.HandleLokiStatsProtocol))
+	slog.Info("Tool registered", "tool", "loki_stats")
+
+	// Create and register loki_detected_labels tool
+	lokiDetectedLabelsTool, err := handlers.NewLokiDetectedLabelsToolProtocol()
+	if err != nil {
+		fatal("Failed to create loki_detected_labels tool", err)
+	}
+	mcpServer.RegisterTool(lokiDetectedLabelsTool, handlers.InstrumentLokiTool(lokiDetectedLabelsTool.Name, handlers.HandleLokiDetectedLabelsProtocol))
+	slog.Info("Tool registered", "tool", "loki_detected_labels")
+
+	// Create and register loki_patterns tool
+	lokiPatternsTool, err := handlers.NewLokiPatternsToolProtocol()
+	if err != nil {
+		fatal("Failed to create loki_patterns tool", err)
+	}
+	mcpServer.RegisterTool(lokiPatternsTool, handlers.InstrumentLokiTool(lokiPatternsTool.Name, handlers.HandleLokiPatternsProtocol))
+	slog.Info("Tool registered", "tool", "loki_patterns")
+
+	// Create and register loki_capabilities tool
+	lokiCapabilitiesTool, err := handlers.NewLokiCapabilitiesToolProtocol()
+	if err != nil {
+		fatal("Failed to create loki_capabilities tool", err)
+	}
+	mcpServer.RegisterTool(lokiCapabilitiesTool, handlers.InstrumentLokiTool(lokiCapabilitiesTool.Name, handlers.HandleLokiCapabilitiesProtocol))
+	slog.Info("Tool registered", "tool", "loki_capabilities")
+
+	// Create and register loki_delete tool only when deleting logs was explicitly allowed
+	allowDelete, err := handlers.LokiDeleteEnabled()
+	if err != nil {
+		fatal("Failed to configure loki_delete", err)
+	}
+	if allowDelete {
+		lokiDeleteTool, err := handlers.NewLokiDeleteToolProtocol()
+		if err != nil {
+			fatal("Failed to create loki_delete tool", err)
+		}
+		mcpServer.RegisterTool(lokiDeleteTool, handlers.InstrumentLokiTool(lokiDeleteTool.Name, handlers.HandleLokiDeleteProtocol))
+		slog.Warn("Tool registered; it deletes logs from Loki", "tool", "loki_delete", handlers.EnvLokiAllowDelete, true)
+	}
+
+	// Register the resource template under which results too large to return inline are read
+	resultTemplate := handlers.NewLokiResultResourceTemplate()
+	if err := mcpServer.RegisterResourceTemplate(resultTemplate, handlers.HandleLokiResultResource); err != nil {
+		fatal("Failed to register loki_result resource template", err)
 	}
-	mcpServer.RegisterTool(lokiLabelValuesTool, handlers.HandleLokiLabelValuesProtocol)
-	log.Println("  - loki_label_values tool registered")
+	slog.Info("Resource template registered", "template", resultTemplate.URITemplate)
 
-	log.Println("All tools registered successfully")
+	slog.Info("All tools registered successfully")
+	readiness.MarkReady()
+
+	if transportMode == transportStdio {
+		runStdio(mcpServer, shutdownTimeout)
+		return
+	}
 
 	// Start MCP server in a goroutine
 	go func() {
-		log.Println("Starting MCP server...")
+		slog.Info("Starting MCP server...")
 		if err := mcpServer.Run(); err != nil {
-			log.Fatalf("MCP server error: %v", err)
+			fatal("MCP server error", err)
 		}
 	}()
 
 	// Create HTTP server with the MCP handler
 	mux := http.NewServeMux()
 
+	// Require a bearer token on the endpoints serving Loki data when MCP_AUTH_TOKEN is set
+	if os.Getenv(handlers.EnvMCPAuthToken) == "" {
+		slog.Warn(handlers.EnvMCPAuthToken + " not set, /mcp and /export accept unauthenticated requests")
+	} else {
+		slog.Info("Bearer token authentication enabled for /mcp and /export")
+	}
+
 	// Register the MCP endpoint (Bedrock AgentCore compliant)
-	mux.Handle("/mcp", mcpHandler.HandleMCP())
-	log.Println("Registered endpoint: /mcp (Bedrock AgentCore compliant)")
+	mux.Handle("/mcp", handlers.RequestIDHandler(handlers.TraceHTTPHandler(handlers.NewMCPAuthHandler(mcpHandler.HandleMCP()))))
+	slog.Info("Registered endpoint", "path", "/mcp", "description", "Bedrock AgentCore compliant")
+
+	// Register the streaming export endpoint for large result sets
+	mux.Handle("/export", handlers.RequestIDHandler(handlers.TraceHTTPHandler(handlers.NewMCPAuthHandler(http.HandlerFunc(handlers.HandleLokiExport)))))
+	slog.Info("Registered endpoint", "path", "/export", "description", "chunked streaming export")
+
+	// Register the liveness and readiness probes
+	mux.HandleFunc("/healthz", handlers.HandleHealthz)
+	mux.Handle("/readyz", readiness)
+	slog.Info("Registered endpoints", "paths", "/healthz, /readyz", "description", "health probes")
+
+	// Register the Prometheus metrics endpoint
+	mux.Handle("/metrics", handlers.MetricsHandler())
+	slog.Info("Registered endpoint", "path", "/metrics", "description", "Prometheus metrics")
 
 	// Start HTTP server
 	addr := fmt.Sprintf("%s:%s", host, port)
-	log.Println("=== Starting HTTP Server ===")
-	log.Printf("Server Address: http://%s", addr)
-	log.Printf("Streamable HTTP Endpoint: http://%s/mcp", addr)
-	log.Println("Server is ready to accept connections")
-	log.Println("Press Ctrl+C to shutdown")
+	slog.Info("=== Starting HTTP Server ===",
+		"address", "http://"+addr,
+		"mcp", "http://"+addr+"/mcp",
+		"export", "http://"+addr+"/export",
+		"health", "http://"+addr+"/healthz",
+		"ready", "http://"+addr+"/readyz",
+		"metrics", "http://"+addr+"/metrics")
+	slog.Info("Server is ready to accept connections")
+	slog.Info("Press Ctrl+C to shutdown")
 
+	// Allow browser-based clients from the configured origins; CORS is disabled by default
+	handler, err := handlers.NewCORSHandler(mux)
+	if err != nil {
+		fatal("Failed to configure CORS", err)
+	}
+	if origins := os.Getenv(handlers.EnvCORSAllowedOrigins); origins != "" {
+		slog.Info("CORS enabled", handlers.EnvCORSAllowedOrigins, origins)
+		if strings.Contains(origins, "*") {
+			slog.Warn("CORS allows any origin; use a wildcard origin for development only")
+		}
+	}
+
+	// Count requests in flight so that shutdown can report how many it drained
+	var inFlight handlers.InFlightRequests
 	httpServer := &http.Server{
 		Addr:    addr,
-		Handler: mux,
+		Handler: inFlight.Track(handler),
 	}
 
 	// Start HTTP server in a goroutine
 	go func() {
-		log.Printf("HTTP server listening on %s...", addr)
+		slog.Info("HTTP server listening", "address", addr)
 		if err := httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Fatalf("HTTP server error: %v", err)
+			fatal("HTTP server error", err)
 		}
 	}()
 
@@ -163,18 +535,92 @@ func main() {
 	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
 	<-stop
 
-	log.Println("=== Shutdown signal received ===")
-	log.Println("Shutting down server gracefully...")
+	slog.Info("=== Shutdown signal received ===")
+	draining := inFlight.Active()
+	slog.Info("Shutting down server gracefully...", "in_flight", draining, "timeout", shutdownTimeout.String())
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
 
-	// Shutdown MCP server
-	if err := mcpServer.Shutdown(context.Background()); err != nil {
-		log.Printf("Error shutting down MCP server: %v", err)
+	// Shutdown MCP server; it waits for in-flight tool calls until the deadline
+	if err := mcpServer.Shutdown(ctx); err != nil {
+		slog.Error("Error shutting down MCP server", "error", err)
 	}
 
 	// Shutdown HTTP server
-	if err := httpServer.Shutdown(context.Background()); err != nil {
-		log.Printf("Error shutting down HTTP server: %v", err)
+	if err := httpServer.Shutdown(ctx); err != nil {
+		slog.Error("Error shutting down HTTP server", "error", err)
 	}
 
-	log.Println("Server stopped")
+	if ctx.Err() != nil {
+		remaining := inFlight.Active()
+		slog.Error("Shutdown timed out, closing remaining connections",
+			"timeout", shutdownTimeout.String(), "drained", draining-remaining, "abandoned", remaining)
+		httpServer.Close()
+		os.Exit(1)
+	}
+
+	slog.Info("Server stopped", "drained", draining)
 }
+
+// runStdio serves MCP over stdin and stdout until the client closes stdin or a shutdown signal arrives
+func runStdio(mcpServer *server.Server, shutdownTimeout time.Duration) {
+	done := make(chan error, 1)
+	go func() {
+		slog.Info("Starting MCP server on stdio...")
+		done <- mcpServer.Run()
+	}()
+	slog.Info("Server is ready to accept messages on stdin")
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+
+	select {
+	case err := <-done:
+		if err != nil {
+			fatal("MCP server error", err)
+		}
+		slog.Info("=== Input closed ===")
+	case <-stop:
+		slog.Info("=== Shutdown signal received ===")
+	}
+
+	slog.Info("Shutting down server gracefully...", "timeout", shutdownTimeout.String())
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := mcpServer.Shutdown(ctx); err != nil {
+		slog.Error("Error shutting down MCP server", "error", err)
+	}
+	if ctx.Err() != nil {
+		slog.Error("Shutdown timed out", "timeout", shutdownTimeout.String())
+		os.Exit(1)
+	}
+
+	slog.Info("Server stopped")
+}
+
+// envOrNotSet returns shown when the environment variable name is set and notSet otherwise
+func envOrNotSet(name, shown, notSet string) string {
+	if os.Getenv(name) == "" {
+		return notSet
+	}
+	return shown
+}
+
+// fatal logs err and exits
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
+}
+
+// slogLogger sends go-mcp log output to the default structured logger, which writes to stderr. The
+// library default writes informational messages to stdout, which would corrupt the stdio stream.
+type slogLogger struct{}
+
+func (slogLogger) Debugf(format string, a ...any) { slog.Debug(fmt.Sprintf(format, a...)) }
+
+func (slogLogger) Infof(format string, a ...any) { slog.Info(fmt.Sprintf(format, a...)) }
+
+func (slogLogger) Warnf(format string, a ...any) { slog.Warn(fmt.Sprintf(format, a...)) }
+
+func (slogLogger) Errorf(format string, a ...any) { slog.Error(fmt.Sprintf(format, a...)) }
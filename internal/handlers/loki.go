@@ -1,10 +1,13 @@
 package handlers
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"math"
 	"net/http"
 	"net/url"
 	"os"
@@ -17,15 +20,21 @@ import (
 
 // LokiResult represents the structure of Loki query results
 type LokiResult struct {
-	Status string   `json:"status"`
-	Data   LokiData `json:"data"`
-	Error  string   `json:"error,omitempty"`
+	Status   string   `json:"status"`
+	Data     LokiData `json:"data"`
+	Error    string   `json:"error,omitempty"`
+	Warnings []string `json:"warnings,omitempty"`
+
+	// Metric holds the series of a metric query such as count_over_time, which returns a matrix
+	// or vector instead of streams; Data.Result is then empty
+	Metric *LokiMetricResult `json:"-"`
 }
 
 // LokiData represents the data portion of Loki results
 type LokiData struct {
-	ResultType string      `json:"resultType"`
-	Result     []LokiEntry `json:"result"`
+	ResultType string          `json:"resultType"`
+	Result     []LokiEntry     `json:"result"`
+	Stats      json.RawMessage `json:"stats,omitempty"`
 }
 
 // LokiEntry represents a single log entry from Loki
@@ -57,9 +66,27 @@ const EnvLokiPassword = "LOKI_PASSWORD"
 // Environment variable name for Loki Token
 const EnvLokiToken = "LOKI_TOKEN"
 
+// Environment variable name for Loki query timeout
+const EnvLokiQueryTimeout = "LOKI_QUERY_TIMEOUT"
+
+// Environment variable name for the number of retries of transient Loki errors
+const EnvLokiMaxRetries = "LOKI_MAX_RETRIES"
+
+// Environment variable name for the base delay between retries of Loki requests
+const EnvLokiRetryBaseDelay = "LOKI_RETRY_BASE_DELAY"
+
 // Default Loki URL when environment variable is not set
 const DefaultLokiURL = "http://localhost:3100"
 
+// Default timeout for Loki HTTP requests when neither the request nor the environment sets one
+const DefaultLokiQueryTimeout = 30 * time.Second
+
+// Default number of retries of transient Loki errors
+const DefaultLokiMaxRetries = 3
+
+// Default base delay between retries of Loki requests
+const DefaultLokiRetryBaseDelay = 500 * time.Millisecond
+
 // LokiLabelsResult represents the structure of Loki label names response
 type LokiLabelsResult struct {
 	Status string   `json:"status"`
@@ -110,20 +137,25 @@ func NewLokiQueryTool() mcp.Tool {
 			mcp.Description(fmt.Sprintf("Bearer token for authentication (default: %s from %s env var)", token, EnvLokiToken)),
 		),
 		mcp.WithString("start",
-			mcp.Description("Start time for the query (default: 1h ago)"),
+			mcp.Description(fmt.Sprintf("Start time for the query (default: %s env var or 1h ago)", EnvLokiDefaultLookback)),
 		),
 		mcp.WithString("end",
 			mcp.Description("End time for the query (default: now)"),
 		),
+		mcp.WithString("timezone",
+			mcp.Description(fmt.Sprintf("IANA timezone for start and end times without a zone, e.g. America/New_York (default: %s env var or UTC)", EnvLokiTimezone)),
+		),
 		mcp.WithNumber("limit",
 			mcp.Description("Maximum number of entries to return (default: 100)"),
 		),
+		mcp.WithString("direction",
+			mcp.Description("Which entries to return when the limit is hit: backward (newest first) or forward (oldest first) (default: backward)"),
+		),
 		mcp.WithString("org",
 			mcp.Description(fmt.Sprintf("Organization ID for the query (default: %s from %s env var)", orgID, EnvLokiOrgID)),
 		),
 		mcp.WithString("format",
-			mcp.Description("Output format: raw, json, or text (default: raw)"),
-			mcp.DefaultString("raw"),
+			mcp.Description("Output format: raw, json, text, signatures, push, or logfmt (default: LOKI_DEFAULT_FORMAT or raw)"),
 		),
 	)
 }
@@ -172,41 +204,58 @@ func HandleLokiQuery(ctx context.Context, request mcp.CallToolRequest) (*mcp.Cal
 		// Fallback to environment variable
 		orgID = os.Getenv(EnvLokiOrgID)
 	}
+	// A bearer token wins over basic auth, unless the request gave basic auth of its own
+	reqUsername, _ := args["username"].(string)
+	reqPassword, _ := args["password"].(string)
+	reqToken, _ := args["token"].(string)
+	username, password, token = resolveLokiAuth(reqUsername, reqPassword, reqToken, username, password, token)
 
 	// Set defaults for optional parameters
-	start := time.Now().Add(-1 * time.Hour).Unix()
-	end := time.Now().Unix()
+	start := defaultLokiStart().UnixNano()
+	end := time.Now().UnixNano()
 	limit := 100
 
+	timezone, _ := args["timezone"].(string)
+	loc, err := resolveLokiTimezone(timezone)
+	if err != nil {
+		return nil, err
+	}
+
 	// Override defaults if parameters are provided
 	if startStr, ok := args["start"].(string); ok && startStr != "" {
-		startTime, err := parseTime(startStr)
+		startTime, err := parseTime(startStr, loc)
 		if err != nil {
 			return nil, fmt.Errorf("invalid start time: %v", err)
 		}
-		start = startTime.Unix()
+		start = startTime.UnixNano()
 	}
 
 	if endStr, ok := args["end"].(string); ok && endStr != "" {
-		endTime, err := parseTime(endStr)
+		endTime, err := parseEndTime(endStr, loc)
 		if err != nil {
 			return nil, fmt.Errorf("invalid end time: %v", err)
 		}
-		end = endTime.Unix()
+		end = endTime.UnixNano()
 	}
 
 	if limitVal, ok := args["limit"].(float64); ok {
 		limit = int(limitVal)
 	}
 
-	// Extract format parameter
-	format := "raw" // default
-	if formatArg, ok := args["format"].(string); ok && formatArg != "" {
-		format = formatArg
+	direction := ""
+	if directionArg, ok := args["direction"].(string); ok {
+		var err error
+		if direction, err = parseDirection(directionArg); err != nil {
+			return nil, err
+		}
 	}
 
+	// Extract format parameter
+	formatArg, _ := args["format"].(string)
+	format := resolveLokiFormat(formatArg, lokiQueryFormats)
+
 	// Build query URL
-	queryURL, err := buildLokiQueryURL(lokiURL, queryString, start, end, limit)
+	queryURL, err := buildLokiQueryURL(lokiURL, queryString, start, end, limit, direction)
 	if err != nil {
 		return nil, fmt.Errorf("failed to build query URL: %v", err)
 	}
@@ -217,6 +266,13 @@ func HandleLokiQuery(ctx context.Context, request mcp.CallToolRequest) (*mcp.Cal
 		return nil, fmt.Errorf("query execution failed: %v", err)
 	}
 
+	// Mask the patterns of LOKI_REDACT before the lines are returned or broadcast
+	redact, err := compileLokiRedact(nil)
+	if err != nil {
+		return nil, err
+	}
+	result, _ = redactLokiResult(result, redact)
+
 	// Format results
 	formattedResult, err := formatLokiResults(result, format)
 	if err != nil {
@@ -238,11 +294,40 @@ func broadcastQueryResults(ctx context.Context, queryString string, result *Loki
 	// or if you decide to implement custom broadcasting later
 }
 
-// parseTime parses a time string in various formats
-func parseTime(timeStr string) (time.Time, error) {
-	// Handle "now" keyword
-	if timeStr == "now" {
-		return time.Now(), nil
+// parseDirection validates a query direction. An empty string leaves the direction to Loki,
+// which defaults to backward (newest entries first).
+func parseDirection(direction string) (string, error) {
+	switch direction {
+	case "", "forward", "backward":
+		return direction, nil
+	default:
+		return "", fmt.Errorf("invalid direction: %q, must be forward or backward", direction)
+	}
+}
+
+// Description of the time formats accepted by parseTime, used in error messages
+const acceptedTimeFormats = `"now", Grafana expressions such as "now-15m" or "now-1d/d", relative durations such as "-1h", RFC3339 such as "2024-01-02T15:04:05Z" (optionally with fractional seconds), ` +
+	`"2006-01-02T15:04:05", "2006-01-02 15:04:05", "2006-01-02", or Unix timestamps in seconds, milliseconds, microseconds or nanoseconds`
+
+// parseTime parses a time string in various formats. Absolute times without a zone offset
+// are read in loc; RFC3339 and Unix timestamps carry their own zone.
+func parseTime(timeStr string, loc *time.Location) (time.Time, error) {
+	return parseTimeRounding(timeStr, loc, false)
+}
+
+// parseEndTime parses the end of a range like parseTime, except that Grafana rounding such as
+// "now/d" moves to the end of the unit, so "now/d" to "now/d" covers the whole day as in Grafana
+func parseEndTime(timeStr string, loc *time.Location) (time.Time, error) {
+	return parseTimeRounding(timeStr, loc, true)
+}
+
+// parseTimeRounding implements parseTime and parseEndTime
+func parseTimeRounding(timeStr string, loc *time.Location, roundUp bool) (time.Time, error) {
+	timeStr = strings.TrimSpace(timeStr)
+
+	// Handle "now" and Grafana expressions like "now-15m", "now/d"
+	if t, ok, err := parseTimeMath(timeStr, time.Now(), loc, roundUp); ok {
+		return t, err
 	}
 
 	// Handle relative time strings like "-1h", "-30m"
@@ -253,8 +338,8 @@ func parseTime(timeStr string) (time.Time, error) {
 		}
 	}
 
-	// Try parsing as RFC3339
-	t, err := time.Parse(time.RFC3339, timeStr)
+	// Try parsing as RFC3339, which also accepts fractional seconds as in RFC3339Nano
+	t, err := time.Parse(time.RFC3339Nano, timeStr)
 	if err == nil {
 		return t, nil
 	}
@@ -267,17 +352,59 @@ func parseTime(timeStr string) (time.Time, error) {
 	}
 
 	for _, format := range formats {
-		t, err := time.Parse(format, timeStr)
+		t, err := time.ParseInLocation(format, timeStr, loc)
 		if err == nil {
 			return t, nil
 		}
 	}
 
-	return time.Time{}, fmt.Errorf("unsupported time format: %s", timeStr)
+	// Try Unix timestamps in any precision
+	if t, ok := parseUnixTimestamp(timeStr); ok {
+		return t, nil
+	}
+
+	return time.Time{}, fmt.Errorf("unsupported time format: %q, accepted formats: %s", timeStr, acceptedTimeFormats)
+}
+
+// parseUnixTimestamp parses a non-negative Unix timestamp. The unit is inferred from the
+// magnitude: values below 1e11 are seconds (and may have a fractional part), below 1e14
+// milliseconds, below 1e17 microseconds, and anything larger nanoseconds. This keeps dates
+// between 1973 and 5138 unambiguous in every unit, which covers any realistic log timestamp.
+func parseUnixTimestamp(value string) (time.Time, bool) {
+	if value == "" || value[0] == '-' || value[0] == '+' {
+		return time.Time{}, false
+	}
+
+	if strings.Contains(value, ".") {
+		seconds, err := strconv.ParseFloat(value, 64)
+		if err != nil || seconds >= 1e11 {
+			return time.Time{}, false
+		}
+		sec, frac := math.Modf(seconds)
+		return time.Unix(int64(sec), int64(math.Round(frac*1e9))), true
+	}
+
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	switch {
+	case n < 1e11:
+		return time.Unix(n, 0), true
+	case n < 1e14:
+		return time.UnixMilli(n), true
+	case n < 1e17:
+		return time.UnixMicro(n), true
+	default:
+		return time.Unix(0, n), true
+	}
 }
 
-// buildLokiQueryURL constructs the Loki query URL
-func buildLokiQueryURL(baseURL, query string, start, end int64, limit int) (string, error) {
+// buildLokiQueryURL constructs the Loki query URL. The handlers pass start and end as Unix
+// nanoseconds, so that sub-second ranges are kept; Loki also accepts seconds, which it tells apart
+// by their number of digits.
+func buildLokiQueryURL(baseURL, query string, start, end int64, limit int, direction string) (string, error) {
 	u, err := url.Parse(baseURL)
 	if err != nil {
 		return "", err
@@ -303,74 +430,57 @@ func buildLokiQueryURL(baseURL, query string, start, end int64, limit int) (stri
 	q.Set("start", fmt.Sprintf("%d", start))
 	q.Set("end", fmt.Sprintf("%d", end))
 	q.Set("limit", fmt.Sprintf("%d", limit))
+	if direction != "" {
+		q.Set("direction", direction)
+	}
 	u.RawQuery = q.Encode()
 
 	return u.String(), nil
 }
 
-// executeLokiQuery sends the HTTP request to Loki
+// executeLokiQuery sends the HTTP request to Loki and decodes the response as it arrives, so that
+// large results are not held in memory twice. A query Loki rejects is reported with the reason
+// Loki gave, so that LogQL mistakes can be corrected from the error alone. Cancelling ctx, as
+// happens when the MCP client goes away, aborts the request and closes its connection, also
+// while the body is being read, and the error then wraps context.Canceled.
 func executeLokiQuery(ctx context.Context, queryURL string, username, password, token, orgID string) (*LokiResult, error) {
-	// Create HTTP request
-	req, err := http.NewRequestWithContext(ctx, "GET", queryURL, nil)
-	if err != nil {
-		return nil, err
-	}
-
-	// Add authentication if provided
-	if token != "" {
-		// Bearer token authentication
-		req.Header.Add("Authorization", "Bearer "+token)
-	} else if username != "" || password != "" {
-		// Basic authentication
-		req.SetBasicAuth(username, password)
-	}
-
-	// Add orgid if provided
-	if orgID != "" {
-		req.Header.Add("X-Scope-OrgID", orgID)
-	}
-
-	// Execute request
-	client := &http.Client{
-		Timeout: 30 * time.Second,
-	}
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	// Read response
-	body, err := io.ReadAll(resp.Body)
+	var result *LokiResult
+	err := streamLokiRequest(ctx, queryURL, username, password, token, orgID, func(r io.Reader) (err error) {
+		result, err = decodeLokiQueryStream(r)
+		return err
+	})
 	if err != nil {
+		// Loki answers 400 with the reason it rejected the query, e.g. a LogQL parse error
+		var httpErr *LokiHTTPError
+		if errors.As(err, &httpErr) && httpErr.StatusCode == http.StatusBadRequest {
+			return nil, fmt.Errorf("loki rejected the query: %w", err)
+		}
 		return nil, err
 	}
+	return result, nil
+}
 
-	// Check for HTTP errors
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("HTTP error: %d - %s", resp.StatusCode, string(body))
-	}
-
-	// Parse JSON response
-	var result LokiResult
-	if err := json.Unmarshal(body, &result); err != nil {
-		return nil, err
-	}
+// decodeLokiQueryResult parses a query_range response body, turning Loki errors into Go errors
+func decodeLokiQueryResult(body []byte) (*LokiResult, error) {
+	return decodeLokiQueryStream(bytes.NewReader(body))
+}
 
-	// Check for Loki errors
-	if result.Status == "error" {
-		return nil, fmt.Errorf("loki error: %s", result.Error)
-	}
+// lokiQueryFormats lists the output formats supported by formatLokiResults
+var lokiQueryFormats = []string{"raw", "json", "text", "signatures", "push", "logfmt", "color", "markdown"}
 
-	return &result, nil
-}
+// lokiLabelFormats lists the output formats supported by the label formatters
+var lokiLabelFormats = []string{"raw", "json", "text"}
 
 // formatLokiResults formats the Loki query results into a readable string
 func formatLokiResults(result *LokiResult, format string) (string, error) {
-	if len(result.Data.Result) == 0 {
+	if result.Metric != nil {
+		return formatLokiQueryMetric(result.Metric, format)
+	}
+
+	if len(result.Data.Result) == 0 && format != "json" {
 		switch format {
-		case "json":
-			return "{\"message\": \"No logs found matching the query\"}", nil
+		case "push":
+			return "{\"streams\": []}", nil
 		default:
 			return "No logs found matching the query", nil
 		}
@@ -378,7 +488,13 @@ func formatLokiResults(result *LokiResult, format string) (string, error) {
 
 	switch format {
 	case "json":
-		// Return raw JSON response
+		// Return raw JSON response; a result without streams keeps an empty array so that it
+		// parses like any other
+		if result.Data.Result == nil {
+			empty := *result
+			empty.Data.Result = []LokiEntry{}
+			result = &empty
+		}
 		jsonBytes, err := json.MarshalIndent(result, "", "  ")
 		if err != nil {
 			return "", fmt.Errorf("failed to marshal JSON: %v", err)
@@ -387,81 +503,145 @@ func formatLokiResults(result *LokiResult, format string) (string, error) {
 
 	case "raw":
 		// Return raw log lines with timestamps and labels in simple format
-		var output string
-		for _, entry := range result.Data.Result {
-			// Build labels string
-			var labels string
-			if len(entry.Stream) > 0 {
-				labelParts := make([]string, 0, len(entry.Stream))
-				for k, v := range entry.Stream {
-					labelParts = append(labelParts, fmt.Sprintf("%s=%s", k, v))
-				}
-				labels = "{" + strings.Join(labelParts, ",") + "} "
+		var b strings.Builder
+		if err := writeLokiRaw(&b, result); err != nil {
+			return "", err
+		}
+		return b.String() + lokiResultFooter(result), nil
+
+	case "text":
+		// Return formatted text with timestamps and stream info (original behavior)
+		var b strings.Builder
+		if err := writeLokiText(&b, result); err != nil {
+			return "", err
+		}
+		return b.String() + lokiResultFooter(result), nil
+
+	case "signatures":
+		// Return lines grouped by normalized signature with counts and an example
+		return formatLokiSignatures(result) + lokiResultFooter(result), nil
+
+	case "push":
+		// Return results in Loki push format so they can be replayed into another Loki
+		return formatLokiPush(result)
+
+	case "logfmt":
+		// Return logfmt lines expanded into aligned key/value tables
+		return formatLokiLogfmt(result) + lokiResultFooter(result), nil
+
+	case "color":
+		// Return the text format with lines colored by level for display in a terminal
+		output, err := formatLokiColor(result)
+		if err != nil {
+			return "", err
+		}
+		return output + lokiResultFooter(result), nil
+
+	case "markdown":
+		// Return a table with a row per entry for chat interfaces that render Markdown
+		output, err := formatLokiMarkdown(result)
+		if err != nil {
+			return "", err
+		}
+		return output + lokiResultFooter(result), nil
+
+	default:
+		return "", fmt.Errorf("unsupported format: %s. Supported formats: %s", format, strings.Join(lokiQueryFormats, ", "))
+	}
+}
+
+// writeLokiRaw writes raw log lines with timestamps and labels, one entry per line
+func writeLokiRaw(w io.Writer, result *LokiResult) error {
+	for _, entry := range result.Data.Result {
+		// Build labels string
+		var labels string
+		if len(entry.Stream) > 0 {
+			labelParts := make([]string, 0, len(entry.Stream))
+			for k, v := range entry.Stream {
+				labelParts = append(labelParts, fmt.Sprintf("%s=%s", k, v))
 			}
+			labels = "{" + strings.Join(labelParts, ",") + "} "
+		}
+
+		for _, val := range entry.Values {
+			if len(val) >= 2 {
+				// Parse timestamp and convert to readable format
+				ts, err := strconv.ParseFloat(val[0], 64)
+				var timestamp string
+				if err == nil {
+					// Convert to time - Loki returns timestamps in nanoseconds
+					t := time.Unix(0, int64(ts))
+					timestamp = t.Format(time.RFC3339)
+				} else {
+					timestamp = val[0]
+				}
 
-			for _, val := range entry.Values {
-				if len(val) >= 2 {
-					// Parse timestamp and convert to readable format
-					ts, err := strconv.ParseFloat(val[0], 64)
-					var timestamp string
-					if err == nil {
-						// Convert to time - Loki returns timestamps in nanoseconds
-						t := time.Unix(0, int64(ts))
-						timestamp = t.Format(time.RFC3339)
-					} else {
-						timestamp = val[0]
-					}
-
-					output += fmt.Sprintf("%s %s%s\n", timestamp, labels, val[1])
+				if _, err := fmt.Fprintf(w, "%s %s%s\n", timestamp, labels, val[1]); err != nil {
+					return err
 				}
 			}
 		}
-		return output, nil
+	}
+	return nil
+}
 
-	case "text":
-		// Return formatted text with timestamps and stream info (original behavior)
-		var output string
-		output = fmt.Sprintf("Found %d streams:\n\n", len(result.Data.Result))
-
-		for i, entry := range result.Data.Result {
-			// Format stream labels
-			streamInfo := "Stream "
-			if len(entry.Stream) > 0 {
-				streamInfo += "("
-				first := true
-				for k, v := range entry.Stream {
-					if !first {
-						streamInfo += ", "
-					}
-					streamInfo += fmt.Sprintf("%s=%s", k, v)
-					first = false
+// writeLokiText writes formatted text with timestamps, grouped under a header per stream. Streams
+// are numbered by label set, so a stream split up by sorting keeps its number under each header.
+func writeLokiText(w io.Writer, result *LokiResult) error {
+	return writeLokiTextLines(w, result, func(line string) string { return line })
+}
+
+// writeLokiTextLines writes the text format with each log line passed through render
+func writeLokiTextLines(w io.Writer, result *LokiResult, render func(string) string) error {
+	numbers := make(map[string]int, len(result.Data.Result))
+	for _, entry := range result.Data.Result {
+		if key := streamKey(entry.Stream); numbers[key] == 0 {
+			numbers[key] = len(numbers) + 1
+		}
+	}
+	if _, err := fmt.Fprintf(w, "Found %d streams:\n\n", len(numbers)); err != nil {
+		return err
+	}
+
+	for _, entry := range result.Data.Result {
+		// Format stream labels
+		streamInfo := "Stream "
+		if len(entry.Stream) > 0 {
+			streamInfo += "("
+			first := true
+			for k, v := range entry.Stream {
+				if !first {
+					streamInfo += ", "
 				}
-				streamInfo += ")"
+				streamInfo += fmt.Sprintf("%s=%s", k, v)
+				first = false
 			}
+			streamInfo += ")"
+		}
+
+		if _, err := fmt.Fprintf(w, "%s %d:\n", streamInfo, numbers[streamKey(entry.Stream)]); err != nil {
+			return err
+		}
 
-			output += fmt.Sprintf("%s %d:\n", streamInfo, i+1)
-
-			// Format log entries
-			for _, val := range entry.Values {
-				if len(val) >= 2 {
-					// Parse timestamp
-					ts, err := strconv.ParseFloat(val[0], 64)
-					if err == nil {
-						// Convert to time - Loki returns timestamps in nanoseconds already
-						timestamp := time.Unix(0, int64(ts))
-						output += fmt.Sprintf("[%s] %s\n", timestamp.Format(time.RFC3339), val[1])
-					} else {
-						output += fmt.Sprintf("[%s] %s\n", val[0], val[1])
-					}
+		// Format log entries
+		for _, val := range entry.Values {
+			if len(val) >= 2 {
+				timestamp := val[0]
+				// Parse timestamp
+				if ts, err := strconv.ParseFloat(val[0], 64); err == nil {
+					// Convert to time - Loki returns timestamps in nanoseconds already
+					timestamp = time.Unix(0, int64(ts)).Format(time.RFC3339)
+				}
+				if _, err := fmt.Fprintf(w, "[%s] %s\n", timestamp, render(val[1])); err != nil {
+					return err
 				}
 			}
-			output += "\n"
 		}
-		return output, nil
-
-	default:
-		return "", fmt.Errorf("unsupported format: %s. Supported formats: raw, json, text", format)
+		if _, err := io.WriteString(w, "\n"); err != nil {
+			return err
+		}
 	}
+	return nil
 }
 
 // NewLokiLabelNamesTool creates and returns a tool for getting all label names from Grafana Loki
@@ -494,17 +674,19 @@ func NewLokiLabelNamesTool() mcp.Tool {
 			mcp.Description(fmt.Sprintf("Bearer token for authentication (default: %s from %s env var)", token, EnvLokiToken)),
 		),
 		mcp.WithString("start",
-			mcp.Description("Start time for the query (default: 1h ago)"),
+			mcp.Description(fmt.Sprintf("Start time for the query (default: %s env var or 1h ago)", EnvLokiDefaultLookback)),
 		),
 		mcp.WithString("end",
 			mcp.Description("End time for the query (default: now)"),
 		),
+		mcp.WithString("timezone",
+			mcp.Description(fmt.Sprintf("IANA timezone for start and end times without a zone, e.g. America/New_York (default: %s env var or UTC)", EnvLokiTimezone)),
+		),
 		mcp.WithString("org",
 			mcp.Description(fmt.Sprintf("Organization ID for the query (default: %s from %s env var)", orgID, EnvLokiOrgID)),
 		),
 		mcp.WithString("format",
-			mcp.Description("Output format: raw, json, or text (default: raw)"),
-			mcp.DefaultString("raw"),
+			mcp.Description("Output format: raw, json, or text (default: LOKI_DEFAULT_FORMAT or raw)"),
 		),
 	)
 }
@@ -543,17 +725,19 @@ func NewLokiLabelValuesTool() mcp.Tool {
 			mcp.Description(fmt.Sprintf("Bearer token for authentication (default: %s from %s env var)", token, EnvLokiToken)),
 		),
 		mcp.WithString("start",
-			mcp.Description("Start time for the query (default: 1h ago)"),
+			mcp.Description(fmt.Sprintf("Start time for the query (default: %s env var or 1h ago)", EnvLokiDefaultLookback)),
 		),
 		mcp.WithString("end",
 			mcp.Description("End time for the query (default: now)"),
 		),
+		mcp.WithString("timezone",
+			mcp.Description(fmt.Sprintf("IANA timezone for start and end times without a zone, e.g. America/New_York (default: %s env var or UTC)", EnvLokiTimezone)),
+		),
 		mcp.WithString("org",
 			mcp.Description(fmt.Sprintf("Organization ID for the query (default: %s from %s env var)", orgID, EnvLokiOrgID)),
 		),
 		mcp.WithString("format",
-			mcp.Description("Output format: raw, json, or text (default: raw)"),
-			mcp.DefaultString("raw"),
+			mcp.Description("Output format: raw, json, or text (default: LOKI_DEFAULT_FORMAT or raw)"),
 		),
 	)
 }
@@ -597,36 +781,45 @@ func HandleLokiLabelNames(ctx context.Context, request mcp.CallToolRequest) (*mc
 	} else {
 		orgID = os.Getenv(EnvLokiOrgID)
 	}
+	// A bearer token wins over basic auth, unless the request gave basic auth of its own
+	reqUsername, _ := args["username"].(string)
+	reqPassword, _ := args["password"].(string)
+	reqToken, _ := args["token"].(string)
+	username, password, token = resolveLokiAuth(reqUsername, reqPassword, reqToken, username, password, token)
 
 	// Set defaults for optional parameters
-	start := time.Now().Add(-1 * time.Hour).Unix()
-	end := time.Now().Unix()
+	start := defaultLokiStart().UnixNano()
+	end := time.Now().UnixNano()
+
+	timezone, _ := args["timezone"].(string)
+	loc, err := resolveLokiTimezone(timezone)
+	if err != nil {
+		return nil, err
+	}
 
 	// Override defaults if parameters are provided
 	if startStr, ok := args["start"].(string); ok && startStr != "" {
-		startTime, err := parseTime(startStr)
+		startTime, err := parseTime(startStr, loc)
 		if err != nil {
 			return nil, fmt.Errorf("invalid start time: %v", err)
 		}
-		start = startTime.Unix()
+		start = startTime.UnixNano()
 	}
 
 	if endStr, ok := args["end"].(string); ok && endStr != "" {
-		endTime, err := parseTime(endStr)
+		endTime, err := parseEndTime(endStr, loc)
 		if err != nil {
 			return nil, fmt.Errorf("invalid end time: %v", err)
 		}
-		end = endTime.Unix()
+		end = endTime.UnixNano()
 	}
 
 	// Extract format parameter
-	format := "raw" // default
-	if formatArg, ok := args["format"].(string); ok && formatArg != "" {
-		format = formatArg
-	}
+	formatArg, _ := args["format"].(string)
+	format := resolveLokiFormat(formatArg, lokiLabelFormats)
 
 	// Build labels URL
-	labelsURL, err := buildLokiLabelsURL(lokiURL, start, end)
+	labelsURL, err := buildLokiLabelsURL(lokiURL, "", start, end)
 	if err != nil {
 		return nil, fmt.Errorf("failed to build labels URL: %v", err)
 	}
@@ -686,36 +879,45 @@ func HandleLokiLabelValues(ctx context.Context, request mcp.CallToolRequest) (*m
 	} else {
 		orgID = os.Getenv(EnvLokiOrgID)
 	}
+	// A bearer token wins over basic auth, unless the request gave basic auth of its own
+	reqUsername, _ := args["username"].(string)
+	reqPassword, _ := args["password"].(string)
+	reqToken, _ := args["token"].(string)
+	username, password, token = resolveLokiAuth(reqUsername, reqPassword, reqToken, username, password, token)
 
 	// Set defaults for optional parameters
-	start := time.Now().Add(-1 * time.Hour).Unix()
-	end := time.Now().Unix()
+	start := defaultLokiStart().UnixNano()
+	end := time.Now().UnixNano()
+
+	timezone, _ := args["timezone"].(string)
+	loc, err := resolveLokiTimezone(timezone)
+	if err != nil {
+		return nil, err
+	}
 
 	// Override defaults if parameters are provided
 	if startStr, ok := args["start"].(string); ok && startStr != "" {
-		startTime, err := parseTime(startStr)
+		startTime, err := parseTime(startStr, loc)
 		if err != nil {
 			return nil, fmt.Errorf("invalid start time: %v", err)
 		}
-		start = startTime.Unix()
+		start = startTime.UnixNano()
 	}
 
 	if endStr, ok := args["end"].(string); ok && endStr != "" {
-		endTime, err := parseTime(endStr)
+		endTime, err := parseEndTime(endStr, loc)
 		if err != nil {
 			return nil, fmt.Errorf("invalid end time: %v", err)
 		}
-		end = endTime.Unix()
+		end = endTime.UnixNano()
 	}
 
 	// Extract format parameter
-	format := "raw" // default
-	if formatArg, ok := args["format"].(string); ok && formatArg != "" {
-		format = formatArg
-	}
+	formatArg, _ := args["format"].(string)
+	format := resolveLokiFormat(formatArg, lokiLabelFormats)
 
 	// Build label values URL
-	labelValuesURL, err := buildLokiLabelValuesURL(lokiURL, labelName, start, end)
+	labelValuesURL, err := buildLokiLabelValuesURL(lokiURL, labelName, "", start, end)
 	if err != nil {
 		return nil, fmt.Errorf("failed to build label values URL: %v", err)
 	}
@@ -735,8 +937,9 @@ func HandleLokiLabelValues(ctx context.Context, request mcp.CallToolRequest) (*m
 	return mcp.NewToolResultText(formattedResult), nil
 }
 
-// buildLokiLabelsURL constructs the Loki labels URL
-func buildLokiLabelsURL(baseURL string, start, end int64) (string, error) {
+// buildLokiLabelsURL constructs the Loki labels URL; a non-empty query is a stream selector
+// limiting the names to labels of matching streams
+func buildLokiLabelsURL(baseURL, query string, start, end int64) (string, error) {
 	u, err := url.Parse(baseURL)
 	if err != nil {
 		return "", err
@@ -758,6 +961,9 @@ func buildLokiLabelsURL(baseURL string, start, end int64) (string, error) {
 
 	// Add query parameters
 	q := u.Query()
+	if query != "" {
+		q.Set("query", query)
+	}
 	q.Set("start", fmt.Sprintf("%d", start))
 	q.Set("end", fmt.Sprintf("%d", end))
 	u.RawQuery = q.Encode()
@@ -765,8 +971,9 @@ func buildLokiLabelsURL(baseURL string, start, end int64) (string, error) {
 	return u.String(), nil
 }
 
-// buildLokiLabelValuesURL constructs the Loki label values URL
-func buildLokiLabelValuesURL(baseURL, labelName string, start, end int64) (string, error) {
+// buildLokiLabelValuesURL constructs the Loki label values URL; a non-empty query is a stream
+// selector limiting the values to those of matching streams
+func buildLokiLabelValuesURL(baseURL, labelName, query string, start, end int64) (string, error) {
 	u, err := url.Parse(baseURL)
 	if err != nil {
 		return "", err
@@ -788,6 +995,9 @@ func buildLokiLabelValuesURL(baseURL, labelName string, start, end int64) (strin
 
 	// Add query parameters
 	q := u.Query()
+	if query != "" {
+		q.Set("query", query)
+	}
 	q.Set("start", fmt.Sprintf("%d", start))
 	q.Set("end", fmt.Sprintf("%d", end))
 	u.RawQuery = q.Encode()
@@ -795,114 +1005,60 @@ func buildLokiLabelValuesURL(baseURL, labelName string, start, end int64) (strin
 	return u.String(), nil
 }
 
-// executeLokiLabelsQuery sends the HTTP request to Loki labels endpoint
+// executeLokiLabelsQuery sends the HTTP request to Loki labels endpoint, unless the answer is cached
 func executeLokiLabelsQuery(ctx context.Context, queryURL string, username, password, token, orgID string) (*LokiLabelsResult, error) {
-	// Create HTTP request
-	req, err := http.NewRequestWithContext(ctx, "GET", queryURL, nil)
-	if err != nil {
-		return nil, err
-	}
-
-	// Add authentication if provided
-	if token != "" {
-		req.Header.Add("Authorization", "Bearer "+token)
-	} else if username != "" || password != "" {
-		req.SetBasicAuth(username, password)
-	}
+	data, err := cachedLokiLabels(ctx, queryURL, username, password, token, orgID, func() ([]string, error) {
+		body, err := doLokiRequest(ctx, queryURL, username, password, token, orgID)
+		if err != nil {
+			return nil, err
+		}
 
-	// Add orgid if provided
-	if orgID != "" {
-		req.Header.Add("X-Scope-OrgID", orgID)
-	}
+		// Parse JSON response
+		var result LokiLabelsResult
+		if err := json.Unmarshal(body, &result); err != nil {
+			return nil, err
+		}
 
-	// Execute request
-	client := &http.Client{
-		Timeout: 30 * time.Second,
-	}
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
+		// Check for Loki errors
+		if result.Status == "error" {
+			return nil, fmt.Errorf("loki error: %s", result.Error)
+		}
 
-	// Read response
-	body, err := io.ReadAll(resp.Body)
+		return result.Data, nil
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	// Check for HTTP errors
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("HTTP error: %d - %s", resp.StatusCode, string(body))
-	}
-
-	// Parse JSON response
-	var result LokiLabelsResult
-	if err := json.Unmarshal(body, &result); err != nil {
-		return nil, err
-	}
-
-	// Check for Loki errors
-	if result.Status == "error" {
-		return nil, fmt.Errorf("loki error: %s", result.Error)
-	}
-
-	return &result, nil
+	return &LokiLabelsResult{Status: "success", Data: data}, nil
 }
 
-// executeLokiLabelValuesQuery sends the HTTP request to Loki label values endpoint
+// executeLokiLabelValuesQuery sends the HTTP request to Loki label values endpoint, unless the answer is cached
 func executeLokiLabelValuesQuery(ctx context.Context, queryURL string, username, password, token, orgID string) (*LokiLabelValuesResult, error) {
-	// Create HTTP request
-	req, err := http.NewRequestWithContext(ctx, "GET", queryURL, nil)
-	if err != nil {
-		return nil, err
-	}
-
-	// Add authentication if provided
-	if token != "" {
-		req.Header.Add("Authorization", "Bearer "+token)
-	} else if username != "" || password != "" {
-		req.SetBasicAuth(username, password)
-	}
+	data, err := cachedLokiLabels(ctx, queryURL, username, password, token, orgID, func() ([]string, error) {
+		body, err := doLokiRequest(ctx, queryURL, username, password, token, orgID)
+		if err != nil {
+			return nil, err
+		}
 
-	// Add orgid if provided
-	if orgID != "" {
-		req.Header.Add("X-Scope-OrgID", orgID)
-	}
+		// Parse JSON response
+		var result LokiLabelValuesResult
+		if err := json.Unmarshal(body, &result); err != nil {
+			return nil, err
+		}
 
-	// Execute request
-	client := &http.Client{
-		Timeout: 30 * time.Second,
-	}
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
+		// Check for Loki errors
+		if result.Status == "error" {
+			return nil, fmt.Errorf("loki error: %s", result.Error)
+		}
 
-	// Read response
-	body, err := io.ReadAll(resp.Body)
+		return result.Data, nil
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	// Check for HTTP errors
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("HTTP error: %d - %s", resp.StatusCode, string(body))
-	}
-
-	// Parse JSON response
-	var result LokiLabelValuesResult
-	if err := json.Unmarshal(body, &result); err != nil {
-		return nil, err
-	}
-
-	// Check for Loki errors
-	if result.Status == "error" {
-		return nil, fmt.Errorf("loki error: %s", result.Error)
-	}
-
-	return &result, nil
+	return &LokiLabelValuesResult{Status: "success", Data: data}, nil
 }
 
 // formatLokiLabelsResults formats the Loki labels results into a readable string
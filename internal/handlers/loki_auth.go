@@ -0,0 +1,29 @@
+package handlers
+
+import (
+	"fmt"
+	"os"
+)
+
+// resolveLokiAuth returns the username, password and token to send to Loki, given the values from
+// the request and the values resolved with their defaults. Loki accepts a single Authorization
+// header, so a bearer token wins over basic auth. Credentials given in a request are taken as a
+// whole, though: a username or password in the request is not overridden by a configured token.
+func resolveLokiAuth(reqUsername, reqPassword, reqToken, username, password, token string) (string, string, string) {
+	if reqToken == "" && (reqUsername != "" || reqPassword != "") {
+		token = ""
+	}
+	if token != "" {
+		return "", "", token
+	}
+	return username, password, ""
+}
+
+// CheckLokiCredentials reports when both a token and basic auth credentials are configured, since
+// the basic auth credentials are then only used by requests that give their own
+func CheckLokiCredentials() error {
+	if os.Getenv(EnvLokiToken) != "" && (os.Getenv(EnvLokiUsername) != "" || os.Getenv(EnvLokiPassword) != "") {
+		return fmt.Errorf("both %s and %s/%s are set; the bearer token is used and basic auth is ignored", EnvLokiToken, EnvLokiUsername, EnvLokiPassword)
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ThinkInAIXYZ/go-mcp/protocol"
+)
+
+// TestResolveLokiAuth verifies that a token wins over basic auth unless the request gave basic auth of its own
+func TestResolveLokiAuth(t *testing.T) {
+	tests := []struct {
+		name                                  string
+		reqUsername, reqPassword, reqToken    string
+		username, password, token             string
+		wantUsername, wantPassword, wantToken string
+	}{
+		{name: "None"},
+		{name: "Basic only", username: "u", password: "p", wantUsername: "u", wantPassword: "p"},
+		{name: "Token only", token: "t", wantToken: "t"},
+		{name: "Both configured", username: "u", password: "p", token: "t", wantToken: "t"},
+		{name: "Both in request", reqUsername: "ru", reqPassword: "rp", reqToken: "rt", username: "ru", password: "rp", token: "rt", wantToken: "rt"},
+		{name: "Request basic over configured token", reqUsername: "ru", reqPassword: "rp", username: "ru", password: "rp", token: "t", wantUsername: "ru", wantPassword: "rp"},
+		{name: "Request token over configured basic", reqToken: "rt", username: "u", password: "p", token: "rt", wantToken: "rt"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			username, password, token := resolveLokiAuth(tt.reqUsername, tt.reqPassword, tt.reqToken, tt.username, tt.password, tt.token)
+			if username != tt.wantUsername || password != tt.wantPassword || token != tt.wantToken {
+				t.Errorf("Expected (%q, %q, %q), got (%q, %q, %q)", tt.wantUsername, tt.wantPassword, tt.wantToken, username, password, token)
+			}
+		})
+	}
+}
+
+// TestCheckLokiCredentials verifies the warning for a token configured together with basic auth
+func TestCheckLokiCredentials(t *testing.T) {
+	t.Setenv(EnvLokiUsername, "u")
+	t.Setenv(EnvLokiPassword, "p")
+	t.Setenv(EnvLokiToken, "")
+	if err := CheckLokiCredentials(); err != nil {
+		t.Errorf("Expected no warning for basic auth alone, got %v", err)
+	}
+
+	t.Setenv(EnvLokiToken, "t")
+	if err := CheckLokiCredentials(); err == nil || !strings.Contains(err.Error(), "bearer token is used") {
+		t.Errorf("Expected a warning for token and basic auth, got %v", err)
+	}
+}
+
+// TestLokiTools_AuthPrecedence verifies that the query and label tools send the same Authorization
+// header for the same credentials, and that the org ID is sent with either kind of auth
+func TestLokiTools_AuthPrecedence(t *testing.T) {
+	type captured struct{ auth, org string }
+	var requests []captured
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, captured{r.Header.Get("Authorization"), r.Header.Get("X-Scope-OrgID")})
+		if strings.HasSuffix(r.URL.Path, "query_range") {
+			w.Write([]byte(`{"status":"success","data":{"resultType":"streams","result":[]}}`))
+			return
+		}
+		w.Write([]byte(`{"status":"success","data":["job"]}`))
+	}))
+	defer server.Close()
+
+	t.Setenv(EnvLokiUsername, "env-user")
+	t.Setenv(EnvLokiPassword, "env-pass")
+	t.Setenv(EnvLokiToken, "env-token")
+	t.Setenv(EnvLokiOrgID, "")
+	t.Setenv(EnvLokiLabelCacheTTL, "0")
+	if _, err := NewLokiQueryToolProtocol(); err != nil {
+		t.Fatalf("Failed to create tool: %v", err)
+	}
+	if _, err := NewLokiLabelNamesToolProtocol(); err != nil {
+		t.Fatalf("Failed to create tool: %v", err)
+	}
+	if _, err := NewLokiLabelValuesToolProtocol(); err != nil {
+		t.Fatalf("Failed to create tool: %v", err)
+	}
+
+	basic := "Basic " + base64.StdEncoding.EncodeToString([]byte("req-user:req-pass"))
+	tools := []struct {
+		name    string
+		handler func(context.Context, *protocol.CallToolRequest) (*protocol.CallToolResult, error)
+		args    map[string]any
+	}{
+		{"loki_query", HandleLokiQueryProtocol, map[string]any{"query": `{job="a"}`}},
+		{"loki_label_names", HandleLokiLabelNamesProtocol, map[string]any{}},
+		{"loki_label_values", HandleLokiLabelValuesProtocol, map[string]any{"label": "job"}},
+	}
+	cases := []struct {
+		name     string
+		args     map[string]any
+		wantAuth string
+	}{
+		{name: "Configured token wins", args: map[string]any{"org": "tenant-1"}, wantAuth: "Bearer env-token"},
+		{name: "Request basic auth", args: map[string]any{"username": "req-user", "password": "req-pass", "org": "tenant-1"}, wantAuth: basic},
+		{name: "Request token and basic auth", args: map[string]any{"username": "req-user", "password": "req-pass", "token": "req-token", "org": "tenant-1"}, wantAuth: "Bearer req-token"},
+	}
+
+	for _, tc := range cases {
+		for _, tool := range tools {
+			t.Run(tc.name+"/"+tool.name, func(t *testing.T) {
+				args := map[string]any{"url": server.URL}
+				for k, v := range tool.args {
+					args[k] = v
+				}
+				for k, v := range tc.args {
+					args[k] = v
+				}
+				raw, _ := json.Marshal(args)
+
+				requests = nil
+				if _, err := tool.handler(context.Background(), &protocol.CallToolRequest{Name: tool.name, RawArguments: raw}); err != nil {
+					t.Fatalf("%s failed: %v", tool.name, err)
+				}
+				if len(requests) != 1 || requests[0].auth != tc.wantAuth || requests[0].org != "tenant-1" {
+					t.Errorf("Expected Authorization %q and X-Scope-OrgID tenant-1, got %+v", tc.wantAuth, requests)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Environment variable name for the named Loki backends, e.g. prod=http://loki-prod:3100,audit=https://loki-audit:3100
+const EnvLokiBackends = "LOKI_BACKENDS"
+
+// Prefix of the environment variables holding the credentials of a named backend, followed by
+// the upper-cased name and _USERNAME, _PASSWORD, _TOKEN or _ORG_ID, e.g. LOKI_BACKEND_PROD_TOKEN
+const lokiBackendEnvPrefix = "LOKI_BACKEND_"
+
+// lokiBackendName matches valid backend names
+var lokiBackendName = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// lokiConnection holds the URL, credentials and tenant used to reach Loki for a request
+type lokiConnection struct {
+	URL      string
+	Username string
+	Password string
+	Token    string
+	OrgID    string
+}
+
+// loadLokiBackends parses LOKI_BACKENDS into backend names and URLs, in the order listed
+func loadLokiBackends() (map[string]string, []string, error) {
+	backends := map[string]string{}
+	var names []string
+	for _, item := range strings.Split(os.Getenv(EnvLokiBackends), ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		name, backendURL, ok := strings.Cut(item, "=")
+		name, backendURL = strings.TrimSpace(name), strings.TrimSpace(backendURL)
+		if !ok || !lokiBackendName.MatchString(name) {
+			return nil, nil, fmt.Errorf("invalid %s entry %q: must be name=url with a lower-case name such as prod", EnvLokiBackends, item)
+		}
+		if _, dup := backends[name]; dup {
+			return nil, nil, fmt.Errorf("invalid %s: backend %q is listed twice", EnvLokiBackends, name)
+		}
+		if err := validateLokiURL(backendURL); err != nil {
+			return nil, nil, fmt.Errorf("invalid %s: backend %q: %v", EnvLokiBackends, name, err)
+		}
+		backends[name] = backendURL
+		names = append(names, name)
+	}
+	return backends, names, nil
+}
+
+// CheckLokiBackends validates LOKI_BACKENDS so that mistakes are reported at startup, returning the backend names
+func CheckLokiBackends() ([]string, error) {
+	_, names, err := loadLokiBackends()
+	return names, err
+}
+
+// lokiBackendEnv returns the value of a setting of the named backend, such as LOKI_BACKEND_PROD_TOKEN
+func lokiBackendEnv(name, setting string) string {
+	return os.Getenv(lokiBackendEnvPrefix + lokiBackendEnvName(name) + "_" + setting)
+}
+
+// lokiBackendEnvName returns the part of the variable names of the named backend's settings that
+// names it, such as PROD_EU for prod-eu
+func lokiBackendEnvName(name string) string {
+	return strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+// resolveLokiConnection returns the URL, credentials and tenant for a request, see
+// lookupLokiConnection, failing when LOKI_REQUIRE_ORG is set and no tenant was found
+func resolveLokiConnection(backend, lokiURL, username, password, token, org string) (lokiConnection, error) {
+	conn, err := lookupLokiConnection(backend, lokiURL, username, password, token, org)
+	if err != nil {
+		return lokiConnection{}, err
+	}
+	if err := requireLokiOrg(backend, conn.OrgID); err != nil {
+		return lokiConnection{}, err
+	}
+	return conn, nil
+}
+
+// lookupLokiConnection returns the URL, credentials and tenant for a request. Values given in
+// the request win. Without a backend, the LOKI_URL or LOKI_URLS, LOKI_USERNAME, LOKI_PASSWORD,
+// LOKI_TOKEN and LOKI_ORG_ID variables and LOKI_DEFAULTS fill the rest. With a backend, its URL and its
+// LOKI_BACKEND_<NAME>_* variables are used instead, so the default Loki's credentials are never
+// sent to another cluster, and a url is refused so that the backend's are never sent elsewhere.
+// Either way a bearer token wins over basic auth, see resolveLokiAuth.
+func lookupLokiConnection(backend, lokiURL, username, password, token, org string) (lokiConnection, error) {
+	if backend == "" {
+		conn := lokiConnection{
+			URL:   valueOrDefault(lokiURL, lokiDefaultURL()),
+			OrgID: getEnvOrDefault(org, EnvLokiOrgID, activeLokiDefaults.Org),
+		}
+		conn.Username, conn.Password, conn.Token = resolveLokiAuth(username, password, token,
+			getEnvOrDefault(username, EnvLokiUsername, ""),
+			getEnvOrDefault(password, EnvLokiPassword, ""),
+			getEnvOrDefault(token, EnvLokiToken, ""))
+		return conn, nil
+	}
+
+	// The backend's credentials are only ever sent to its own URL
+	if lokiURL != "" {
+		return lokiConnection{}, fmt.Errorf("url and backend cannot be combined: backend %q supplies its own URL and credentials", backend)
+	}
+	backends, names, err := loadLokiBackends()
+	if err != nil {
+		return lokiConnection{}, err
+	}
+	backendURL, ok := backends[backend]
+	if !ok {
+		if len(names) == 0 {
+			return lokiConnection{}, fmt.Errorf("unknown backend %q: no backends are configured in %s", backend, EnvLokiBackends)
+		}
+		slices.Sort(names)
+		return lokiConnection{}, fmt.Errorf("unknown backend %q, configured backends: %s", backend, strings.Join(names, ", "))
+	}
+
+	conn := lokiConnection{
+		URL:   backendURL,
+		OrgID: valueOrDefault(org, lokiBackendEnv(backend, "ORG_ID")),
+	}
+	conn.Username, conn.Password, conn.Token = resolveLokiAuth(username, password, token,
+		valueOrDefault(username, lokiBackendEnv(backend, "USERNAME")),
+		valueOrDefault(password, lokiBackendEnv(backend, "PASSWORD")),
+		valueOrDefault(token, lokiBackendEnv(backend, "TOKEN")))
+	return conn, nil
+}
+
+// valueOrDefault returns value, or defaultValue when value is empty
+func valueOrDefault(value, defaultValue string) string {
+	if value != "" {
+		return value
+	}
+	return defaultValue
+}
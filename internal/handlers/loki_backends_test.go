@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ThinkInAIXYZ/go-mcp/protocol"
+)
+
+// TestResolveLokiConnection_Backend verifies that a backend supplies its own URL and credentials
+func TestResolveLokiConnection_Backend(t *testing.T) {
+	t.Setenv(EnvLokiBackends, "prod=http://loki-prod:3100, audit-eu=https://loki-audit:3100")
+	t.Setenv(EnvLokiURL, "http://loki-default:3100")
+	t.Setenv(EnvLokiToken, "default-token")
+	t.Setenv(EnvLokiOrgID, "default-org")
+	t.Setenv("LOKI_BACKEND_AUDIT_EU_TOKEN", "audit-token")
+	t.Setenv("LOKI_BACKEND_AUDIT_EU_ORG_ID", "audit-org")
+
+	conn, err := resolveLokiConnection("audit-eu", "", "", "", "", "")
+	if err != nil {
+		t.Fatalf("resolveLokiConnection failed: %v", err)
+	}
+	want := lokiConnection{URL: "https://loki-audit:3100", Token: "audit-token", OrgID: "audit-org"}
+	if conn != want {
+		t.Errorf("Expected %+v, got %+v", want, conn)
+	}
+
+	// The default Loki's credentials are not sent to a backend without its own
+	conn, err = resolveLokiConnection("prod", "", "", "", "", "tenant-1")
+	if err != nil {
+		t.Fatalf("resolveLokiConnection failed: %v", err)
+	}
+	want = lokiConnection{URL: "http://loki-prod:3100", OrgID: "tenant-1"}
+	if conn != want {
+		t.Errorf("Expected %+v, got %+v", want, conn)
+	}
+
+	// The backend's credentials are never sent to another URL
+	if _, err := resolveLokiConnection("audit-eu", "http://attacker:3100", "", "", "", ""); err == nil || !strings.Contains(err.Error(), "url and backend cannot be combined") {
+		t.Errorf("Expected an error for url with backend, got %v", err)
+	}
+
+	// Without a backend the environment is used as before
+	conn, _ = resolveLokiConnection("", "", "", "", "", "")
+	if conn.URL != "http://loki-default:3100" || conn.Token != "default-token" || conn.OrgID != "default-org" {
+		t.Errorf("Unexpected default connection %+v", conn)
+	}
+}
+
+// TestResolveLokiConnection_UnknownBackend verifies the errors for unknown backends
+func TestResolveLokiConnection_UnknownBackend(t *testing.T) {
+	t.Setenv(EnvLokiBackends, "")
+	if _, err := resolveLokiConnection("prod", "", "", "", "", ""); err == nil || !strings.Contains(err.Error(), "no backends are configured") {
+		t.Errorf("Expected an error naming the missing configuration, got %v", err)
+	}
+
+	t.Setenv(EnvLokiBackends, "staging=http://loki-staging:3100,prod=http://loki-prod:3100")
+	if _, err := resolveLokiConnection("dev", "", "", "", "", ""); err == nil || !strings.Contains(err.Error(), "configured backends: prod, staging") {
+		t.Errorf("Expected an error listing the backends, got %v", err)
+	}
+}
+
+// TestCheckLokiBackends verifies validation of LOKI_BACKENDS
+func TestCheckLokiBackends(t *testing.T) {
+	t.Setenv(EnvLokiBackends, "prod=http://loki-prod:3100,audit=https://loki-audit:3100")
+	names, err := CheckLokiBackends()
+	if err != nil || strings.Join(names, ",") != "prod,audit" {
+		t.Errorf("Unexpected backends %v (%v)", names, err)
+	}
+
+	for _, invalid := range []string{"prod", "Prod=http://loki:3100", "prod=loki:3100", "prod=http://a:3100,prod=http://b:3100"} {
+		t.Setenv(EnvLokiBackends, invalid)
+		if _, err := CheckLokiBackends(); err == nil {
+			t.Errorf("Expected an error for %q", invalid)
+		}
+	}
+}
+
+// TestHandleLokiSeriesProtocol_Backend verifies that tools send requests to the selected backend
+func TestHandleLokiSeriesProtocol_Backend(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer prod-token" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{"status":"success","data":[{"job":"api"}]}`))
+	}))
+	defer server.Close()
+
+	for _, env := range []string{EnvLokiURL, EnvLokiOrgID, EnvLokiUsername, EnvLokiPassword, EnvLokiToken} {
+		t.Setenv(env, "")
+	}
+	t.Setenv(EnvLokiBackends, "prod="+server.URL)
+	t.Setenv("LOKI_BACKEND_PROD_TOKEN", "prod-token")
+	if _, err := NewLokiSeriesToolProtocol(); err != nil {
+		t.Fatalf("Failed to create tool: %v", err)
+	}
+
+	raw, _ := json.Marshal(map[string]any{"match": `{job="api"}`, "backend": "prod"})
+	result, err := HandleLokiSeriesProtocol(context.Background(), &protocol.CallToolRequest{Name: "loki_series", RawArguments: raw})
+	if err != nil {
+		t.Fatalf("HandleLokiSeriesProtocol failed: %v", err)
+	}
+	if text := result.Content[0].(*protocol.TextContent).Text; !strings.Contains(text, "api") {
+		t.Errorf("Unexpected result %q", text)
+	}
+}
@@ -0,0 +1,181 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/ThinkInAIXYZ/go-mcp/protocol"
+)
+
+// Maximum number of queries in one loki_query_batch call
+const MaxLokiBatchQueries = 20
+
+// Number of batch queries run at the same time
+const lokiBatchWorkers = 4
+
+// LokiQueryBatchRequest represents the arguments for loki_query_batch tool. Connection settings
+// are shared by all queries; start, end, limit and format apply to queries that do not set them.
+type LokiQueryBatchRequest struct {
+	Queries         []LokiBatchQuery  `json:"queries" description:"Queries to run, at most 20, each with its own query and optional name, start, end, limit, direction and format"`
+	URL             string            `json:"url,omitempty" description:"Loki server URL"`
+	Backend         string            `json:"backend,omitempty" description:"Name of a Loki backend from LOKI_BACKENDS, e.g. prod, whose URL and credentials to use; cannot be combined with url, and an explicit credential still wins"`
+	Username        string            `json:"username,omitempty" description:"Username for basic authentication"`
+	Password        string            `json:"password,omitempty" description:"Password for basic authentication"`
+	Token           string            `json:"token,omitempty" description:"Bearer token for authentication"`
+	Start           string            `json:"start,omitempty" description:"Start time for queries that do not set one"`
+	End             string            `json:"end,omitempty" description:"End time for queries that do not set one"`
+	Timezone        string            `json:"timezone,omitempty" description:"IANA timezone for start and end times without a zone, e.g. America/New_York (default: LOKI_TIMEZONE or UTC)"`
+	AllowLargeRange bool              `json:"allowLargeRange,omitempty" description:"Run queries over time ranges longer than LOKI_MAX_TIME_RANGE anyway (default: false)"`
+	Limit           float64           `json:"limit,omitempty" description:"Maximum number of entries per query for queries that do not set one (default: LOKI_DEFAULT_LIMIT or 100)"`
+	Org             string            `json:"org,omitempty" description:"Organization ID for the queries"`
+	Headers         map[string]string `json:"headers,omitempty" description:"Extra HTTP headers to send to Loki, e.g. {\"X-Api-Key\": \"...\"}; never replaces the auth or org headers"`
+	Timeout         string            `json:"timeout,omitempty" description:"Timeout for each Loki request as a duration (e.g. 45s) or seconds (default: LOKI_QUERY_TIMEOUT or 30s)"`
+	Format          string            `json:"format,omitempty" description:"Output format for queries that do not set one, as for loki_query (default: LOKI_DEFAULT_FORMAT or raw)"`
+	Redact          []string          `json:"redact,omitempty" description:"Patterns to mask with *** in the lines of every query, as for loki_query"`
+}
+
+// LokiBatchQuery is a single query of a loki_query_batch call
+type LokiBatchQuery struct {
+	Name      string  `json:"name,omitempty" description:"Label for this query in the combined result, e.g. errors (default: its position)"`
+	Query     string  `json:"query" description:"LogQL query string"`
+	Start     string  `json:"start,omitempty" description:"Start time for the query"`
+	End       string  `json:"end,omitempty" description:"End time for the query"`
+	Limit     float64 `json:"limit,omitempty" description:"Maximum number of entries to return"`
+	Direction string  `json:"direction,omitempty" description:"backward (newest first) or forward (oldest first) (default: backward)"`
+	Format    string  `json:"format,omitempty" description:"Output format, as for loki_query"`
+}
+
+// lokiBatchResult is the outcome of one query of a batch
+type lokiBatchResult struct {
+	text string
+	err  error
+}
+
+// NewLokiQueryBatchToolProtocol creates a tool using the protocol library
+func NewLokiQueryBatchToolProtocol() (*protocol.Tool, error) {
+	return protocol.NewTool("loki_query_batch", "Run several LogQL queries against Grafana Loki in one call, e.g. errors, warnings and a trace, returning each result under its name", LokiQueryBatchRequest{})
+}
+
+// HandleLokiQueryBatchProtocol handles Loki batch query tool requests using protocol library. Each
+// query runs through the loki_query handler; a failing query is reported in its section of the
+// result without failing the others.
+func HandleLokiQueryBatchProtocol(ctx context.Context, request *protocol.CallToolRequest) (*protocol.CallToolResult, error) {
+	req := new(LokiQueryBatchRequest)
+	if err := protocol.VerifyAndUnmarshal(request.RawArguments, req); err != nil {
+		return nil, err
+	}
+
+	if len(req.Queries) == 0 {
+		return nil, fmt.Errorf("queries must contain at least one query")
+	}
+	if len(req.Queries) > MaxLokiBatchQueries {
+		return nil, fmt.Errorf("queries must contain at most %d queries, got %d", MaxLokiBatchQueries, len(req.Queries))
+	}
+
+	// The items are validated by the loki_query schema
+	if _, err := NewLokiQueryToolProtocol(); err != nil {
+		return nil, fmt.Errorf("failed to create loki_query tool: %v", err)
+	}
+
+	results := make([]lokiBatchResult, len(req.Queries))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for range min(lokiBatchWorkers, len(req.Queries)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				results[i] = runLokiBatchQuery(ctx, req, req.Queries[i])
+			}
+		}()
+	}
+	for i := range req.Queries {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	failed := 0
+	content := make([]protocol.Content, 0, len(results))
+	for i, result := range results {
+		name := req.Queries[i].Name
+		if name == "" {
+			name = fmt.Sprintf("query %d", i+1)
+		}
+		text := result.text
+		if result.err != nil {
+			failed++
+			text = "Error: " + result.err.Error()
+		}
+		content = append(content, &protocol.TextContent{
+			Type: "text",
+			Text: fmt.Sprintf("=== %s: %s ===\n%s", name, req.Queries[i].Query, text),
+		})
+	}
+	if failed > 0 {
+		content = append(content, &protocol.TextContent{
+			Type: "text",
+			Text: fmt.Sprintf("Note: %d of %d queries failed", failed, len(results)),
+		})
+	}
+
+	return &protocol.CallToolResult{
+		Content: content,
+	}, nil
+}
+
+// runLokiBatchQuery runs one query of a batch through the loki_query handler, combining the
+// shared settings with those of the query
+func runLokiBatchQuery(ctx context.Context, batch *LokiQueryBatchRequest, query LokiBatchQuery) lokiBatchResult {
+	req := LokiQueryRequest{
+		Query:           query.Query,
+		URL:             batch.URL,
+		Backend:         batch.Backend,
+		Username:        batch.Username,
+		Password:        batch.Password,
+		Token:           batch.Token,
+		Start:           batch.Start,
+		End:             batch.End,
+		Timezone:        batch.Timezone,
+		AllowLargeRange: batch.AllowLargeRange,
+		Limit:           batch.Limit,
+		Direction:       query.Direction,
+		Org:             batch.Org,
+		Headers:         batch.Headers,
+		Timeout:         batch.Timeout,
+		Format:          batch.Format,
+		Redact:          batch.Redact,
+	}
+	if query.Start != "" {
+		req.Start = query.Start
+	}
+	if query.End != "" {
+		req.End = query.End
+	}
+	if query.Limit != 0 {
+		req.Limit = query.Limit
+	}
+	if query.Format != "" {
+		req.Format = query.Format
+	}
+
+	raw, err := json.Marshal(req)
+	if err != nil {
+		return lokiBatchResult{err: fmt.Errorf("failed to marshal query: %v", err)}
+	}
+	result, err := HandleLokiQueryProtocol(ctx, &protocol.CallToolRequest{Name: "loki_query", RawArguments: raw})
+	if err != nil {
+		return lokiBatchResult{err: err}
+	}
+
+	texts := make([]string, 0, len(result.Content))
+	for _, item := range result.Content {
+		if text, ok := item.(*protocol.TextContent); ok {
+			texts = append(texts, text.Text)
+		}
+	}
+	return lokiBatchResult{text: strings.Join(texts, "\n")}
+}
@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ThinkInAIXYZ/go-mcp/protocol"
+)
+
+// TestHandleLokiQueryBatchProtocol verifies that queries run with shared settings and that a
+// failing query is reported without failing the others
+func TestHandleLokiQueryBatchProtocol(t *testing.T) {
+	var active, peak atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := active.Add(1)
+		defer active.Add(-1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+
+		if r.Header.Get("X-Scope-OrgID") != "tenant-1" {
+			http.Error(w, "missing org", http.StatusBadRequest)
+			return
+		}
+		query := r.URL.Query().Get("query")
+		if strings.Contains(query, "broken") {
+			http.Error(w, "parse error", http.StatusBadRequest)
+			return
+		}
+		result := &LokiResult{Status: "success", Data: LokiData{ResultType: "streams", Result: []LokiEntry{{
+			Stream: map[string]string{"app": "api"},
+			Values: [][]string{{"1705312245000000000", strings.Trim(query, "{}") + " line"}},
+		}}}}
+		json.NewEncoder(w).Encode(result)
+	}))
+	defer server.Close()
+
+	for _, env := range []string{EnvLokiURL, EnvLokiOrgID, EnvLokiUsername, EnvLokiPassword, EnvLokiToken} {
+		t.Setenv(env, "")
+	}
+	if _, err := NewLokiQueryBatchToolProtocol(); err != nil {
+		t.Fatalf("Failed to create tool: %v", err)
+	}
+
+	queries := []map[string]any{
+		{"name": "errors", "query": `{level="error"}`},
+		{"query": `{level="broken"}`},
+	}
+	for i := 0; i < 6; i++ {
+		queries = append(queries, map[string]any{"query": `{app="api"}`, "limit": 10})
+	}
+	raw, _ := json.Marshal(map[string]any{"url": server.URL, "org": "tenant-1", "queries": queries})
+	result, err := HandleLokiQueryBatchProtocol(context.Background(), &protocol.CallToolRequest{Name: "loki_query_batch", RawArguments: raw})
+	if err != nil {
+		t.Fatalf("HandleLokiQueryBatchProtocol failed: %v", err)
+	}
+
+	if len(result.Content) != len(queries)+1 {
+		t.Fatalf("Expected a section per query and a note, got %d items", len(result.Content))
+	}
+	first := result.Content[0].(*protocol.TextContent).Text
+	if !strings.HasPrefix(first, `=== errors: {level="error"} ===`) || !strings.Contains(first, `level="error" line`) {
+		t.Errorf("Unexpected first section:\n%s", first)
+	}
+	second := result.Content[1].(*protocol.TextContent).Text
+	if !strings.HasPrefix(second, "=== query 2: ") || !strings.Contains(second, "Error: ") {
+		t.Errorf("Expected the failing query to be reported in its section:\n%s", second)
+	}
+	if note := result.Content[len(queries)].(*protocol.TextContent).Text; note != "Note: 1 of 8 queries failed" {
+		t.Errorf("Unexpected note %q", note)
+	}
+	if got := peak.Load(); got > lokiBatchWorkers {
+		t.Errorf("Expected at most %d concurrent requests, got %d", lokiBatchWorkers, got)
+	}
+}
+
+// TestHandleLokiQueryBatchProtocol_Invalid verifies the bounds on the number of queries
+func TestHandleLokiQueryBatchProtocol_Invalid(t *testing.T) {
+	if _, err := NewLokiQueryBatchToolProtocol(); err != nil {
+		t.Fatalf("Failed to create tool: %v", err)
+	}
+
+	tooMany := make([]map[string]any, MaxLokiBatchQueries+1)
+	for i := range tooMany {
+		tooMany[i] = map[string]any{"query": `{app="api"}`}
+	}
+	for _, queries := range [][]map[string]any{{}, tooMany} {
+		raw, _ := json.Marshal(map[string]any{"queries": queries})
+		if _, err := HandleLokiQueryBatchProtocol(context.Background(), &protocol.CallToolRequest{Name: "loki_query_batch", RawArguments: raw}); err == nil {
+			t.Errorf("Expected an error for %d queries", len(queries))
+		}
+	}
+}
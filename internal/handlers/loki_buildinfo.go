@@ -0,0 +1,154 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// How long a Loki version is remembered; Loki is rarely upgraded under a running server
+const lokiBuildInfoTTL = 10 * time.Minute
+
+// How long a failed version lookup is remembered, so that best-effort lookups do not add a
+// request to every tool call while Loki or its buildinfo endpoint is unavailable
+const lokiBuildInfoFailureTTL = time.Minute
+
+// How long a version lookup may take before it is given up
+const lokiBuildInfoTimeout = 5 * time.Second
+
+// LokiBuildInfo holds the version details Loki reports at /loki/api/v1/status/buildinfo
+type LokiBuildInfo struct {
+	Version   string `json:"version"`
+	Revision  string `json:"revision,omitempty"`
+	Branch    string `json:"branch,omitempty"`
+	BuildDate string `json:"buildDate,omitempty"`
+	GoVersion string `json:"goVersion,omitempty"`
+}
+
+// lokiBuildInfoEntry is a cached version lookup, successful or not
+type lokiBuildInfoEntry struct {
+	info    *LokiBuildInfo
+	err     error
+	expires time.Time
+}
+
+// Version lookups by Loki URL
+var lokiBuildInfoCache = struct {
+	sync.Mutex
+	entries map[string]lokiBuildInfoEntry
+}{entries: map[string]lokiBuildInfoEntry{}}
+
+// lokiBuildInfo returns the build information of the Loki at conn.URL, asking Loki at most once
+// per lokiBuildInfoTTL. The lookup is a single request without retries or a concurrency slot.
+func lokiBuildInfo(ctx context.Context, conn lokiConnection) (*LokiBuildInfo, error) {
+	lokiBuildInfoCache.Lock()
+	entry, ok := lokiBuildInfoCache.entries[conn.URL]
+	lokiBuildInfoCache.Unlock()
+	if ok && time.Now().Before(entry.expires) {
+		return entry.info, entry.err
+	}
+
+	info, err := fetchLokiBuildInfo(ctx, conn)
+	ttl := lokiBuildInfoTTL
+	if err != nil {
+		ttl = lokiBuildInfoFailureTTL
+	}
+
+	lokiBuildInfoCache.Lock()
+	lokiBuildInfoCache.entries[conn.URL] = lokiBuildInfoEntry{info: info, err: err, expires: time.Now().Add(ttl)}
+	lokiBuildInfoCache.Unlock()
+	return info, err
+}
+
+// fetchLokiBuildInfo asks Loki for its build information
+func fetchLokiBuildInfo(ctx context.Context, conn lokiConnection) (*LokiBuildInfo, error) {
+	buildInfoURL, err := buildLokiBuildInfoURL(conn.URL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build buildinfo URL: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, lokiBuildInfoTimeout)
+	defer cancel()
+	body, _, err := sendLokiRequest(ctx, buildInfoURL, conn.Username, conn.Password, conn.Token, conn.OrgID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the Loki version: %v", err)
+	}
+
+	var info LokiBuildInfo
+	if err := json.Unmarshal(body, &info); err != nil || info.Version == "" {
+		return nil, fmt.Errorf("failed to get the Loki version: unexpected buildinfo response")
+	}
+	return &info, nil
+}
+
+// buildLokiBuildInfoURL constructs the URL of Loki's buildinfo endpoint
+func buildLokiBuildInfoURL(baseURL string) (string, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return "", err
+	}
+
+	path := u.Path
+	if i := strings.Index(path, "/loki/api/v1"); i >= 0 {
+		path = path[:i]
+	}
+	u.Path = strings.TrimSuffix(path, "/") + "/loki/api/v1/status/buildinfo"
+	u.RawQuery = ""
+
+	return u.String(), nil
+}
+
+// lokiVersion is a Loki release, compared by major and minor version
+type lokiVersion struct {
+	Major, Minor int
+}
+
+// String renders v as major.minor
+func (v lokiVersion) String() string {
+	return fmt.Sprintf("%d.%d", v.Major, v.Minor)
+}
+
+// Oldest Loki releases with the endpoints that not every supported Loki has
+var (
+	lokiDetectedLabelsVersion = lokiVersion{3, 0}
+	lokiIndexStatsVersion     = lokiVersion{2, 8}
+	lokiPatternsVersion       = lokiVersion{3, 0}
+)
+
+// parseLokiVersion reads the major and minor version from versions such as 3.1.0 or v2.9.4-rc.1.
+// Development builds such as main-4f3a2b1 have no release number and are reported as not ok.
+func parseLokiVersion(version string) (lokiVersion, bool) {
+	parts := strings.SplitN(strings.TrimPrefix(version, "v"), ".", 3)
+	if len(parts) < 2 {
+		return lokiVersion{}, false
+	}
+	major, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return lokiVersion{}, false
+	}
+	minor, err := strconv.Atoi(strings.TrimRightFunc(parts[1], func(r rune) bool { return r < '0' || r > '9' }))
+	if err != nil {
+		return lokiVersion{}, false
+	}
+	return lokiVersion{major, minor}, true
+}
+
+// checkLokiVersion returns an error when the Loki at conn is known to be older than required
+// by tool. The check is best-effort: when the version cannot be looked up or parsed, the call
+// proceeds and Loki's own answer decides.
+func checkLokiVersion(ctx context.Context, conn lokiConnection, tool string, required lokiVersion) error {
+	info, err := lokiBuildInfo(ctx, conn)
+	if err != nil {
+		return nil
+	}
+	version, ok := parseLokiVersion(info.Version)
+	if !ok || version.Major > required.Major || (version.Major == required.Major && version.Minor >= required.Minor) {
+		return nil
+	}
+	return fmt.Errorf("%s requires Loki >= %s, but %s runs Loki %s", tool, required, redactLokiURL(conn.URL), info.Version)
+}
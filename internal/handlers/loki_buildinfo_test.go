@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ThinkInAIXYZ/go-mcp/protocol"
+)
+
+// TestParseLokiVersion verifies release and development version strings
+func TestParseLokiVersion(t *testing.T) {
+	tests := map[string]struct {
+		want lokiVersion
+		ok   bool
+	}{
+		"3.1.0":          {lokiVersion{3, 1}, true},
+		"v2.9.4":         {lokiVersion{2, 9}, true},
+		"2.8-rc.1":       {lokiVersion{2, 8}, true},
+		"main-4f3a2b1":   {lokiVersion{}, false},
+		"k215-8e6a7f1b2": {lokiVersion{}, false},
+		"":               {lokiVersion{}, false},
+	}
+	for version, tt := range tests {
+		got, ok := parseLokiVersion(version)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("parseLokiVersion(%q) = %v, %v, want %v, %v", version, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+// versionTestServer returns a Loki reporting version at the buildinfo endpoint, recording the
+// other paths requested
+func versionTestServer(t *testing.T, version string, paths *[]string) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/loki/api/v1/status/buildinfo" {
+			if version == "" {
+				http.NotFound(w, r)
+				return
+			}
+			w.Write([]byte(`{"version":"` + version + `"}`))
+			return
+		}
+		*paths = append(*paths, r.URL.Path)
+		w.Write([]byte(`{"detectedLabels":[{"label":"app","cardinality":3}]}`))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// TestHandleLokiDetectedLabelsProtocol_Version verifies the version check before newer endpoints
+func TestHandleLokiDetectedLabelsProtocol_Version(t *testing.T) {
+	if _, err := NewLokiDetectedLabelsToolProtocol(); err != nil {
+		t.Fatalf("Failed to create tool: %v", err)
+	}
+	call := func(serverURL string) error {
+		raw, _ := json.Marshal(map[string]any{"url": serverURL})
+		_, err := HandleLokiDetectedLabelsProtocol(context.Background(), &protocol.CallToolRequest{Name: "loki_detected_labels", RawArguments: raw})
+		return err
+	}
+
+	var paths []string
+	old := versionTestServer(t, "2.9.4", &paths)
+	if err := call(old.URL); err == nil || !strings.Contains(err.Error(), "loki_detected_labels requires Loki >= 3.0, but "+old.URL+" runs Loki 2.9.4") {
+		t.Errorf("Expected a version error, got %v", err)
+	}
+	if len(paths) != 0 {
+		t.Errorf("Expected the endpoint not to be called, got %v", paths)
+	}
+
+	// New and unknown versions go ahead
+	for _, version := range []string{"3.2.1", "main-4f3a2b1", ""} {
+		paths = nil
+		server := versionTestServer(t, version, &paths)
+		if err := call(server.URL); err != nil {
+			t.Errorf("Version %q: unexpected error %v", version, err)
+		}
+		if len(paths) != 1 {
+			t.Errorf("Version %q: expected the endpoint to be called once, got %v", version, paths)
+		}
+	}
+}
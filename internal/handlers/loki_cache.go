@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// lokiCacheEntry is a cached Loki response
+type lokiCacheEntry[T any] struct {
+	key     string
+	data    T
+	expires time.Time
+}
+
+// lokiCache is a concurrency-safe TTL cache of Loki responses that evicts the least recently used
+// entry once it holds more than the configured number of entries. Data is copied on the way in
+// and out, so that callers cannot modify what other calls get.
+type lokiCache[T any] struct {
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	order   *list.List // most recently used first
+	now     func() time.Time
+	clone   func(T) T
+}
+
+// newLokiCache creates an empty cache that copies its data with clone
+func newLokiCache[T any](clone func(T) T) *lokiCache[T] {
+	return &lokiCache[T]{
+		entries: make(map[string]*list.Element),
+		order:   list.New(),
+		now:     time.Now,
+		clone:   clone,
+	}
+}
+
+// get returns a copy of the cached data for key, if present and not expired
+func (c *lokiCache[T]) get(key string) (T, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var zero T
+	element, ok := c.entries[key]
+	if !ok {
+		return zero, false
+	}
+	entry := element.Value.(*lokiCacheEntry[T])
+	if !c.now().Before(entry.expires) {
+		c.order.Remove(element)
+		delete(c.entries, key)
+		return zero, false
+	}
+	c.order.MoveToFront(element)
+	return c.clone(entry.data), true
+}
+
+// put caches a copy of data for key for ttl, evicting the least recently used entries beyond size
+func (c *lokiCache[T]) put(key string, data T, ttl time.Duration, size int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry := &lokiCacheEntry[T]{key: key, data: c.clone(data), expires: c.now().Add(ttl)}
+	if element, ok := c.entries[key]; ok {
+		element.Value = entry
+		c.order.MoveToFront(element)
+	} else {
+		c.entries[key] = c.order.PushFront(entry)
+	}
+
+	for c.order.Len() > size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*lokiCacheEntry[T]).key)
+	}
+}
+
+// lokiRequestKey identifies a Loki request by its URL, tenant, credentials and extra headers. The
+// key is a digest, so no credentials are kept.
+func lokiRequestKey(ctx context.Context, requestURL, username, password, token, orgID string) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00%s\x00%s\x00%s\x00%s", requestURL, orgID, username, password, token)
+
+	headers, _ := ctx.Value(lokiHeadersKey{}).(map[string]string)
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(h, "\x00%s=%s", name, headers[name])
+	}
+
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// resolveLokiCall resolves the Loki URL, credentials and tenant of a tool call, and returns ctx
+// with the call's timeout and extra headers applied for the requests made on its behalf
+func resolveLokiCall(ctx context.Context, backend, lokiURL, username, password, token, org, timeout string, headers map[string]string) (context.Context, lokiConnection, error) {
+	conn, err := resolveLokiConnection(backend, lokiURL, username, password, token, org)
+	if err != nil {
+		return nil, lokiConnection{}, err
+	}
+
+	d, err := resolveLokiTimeout(timeout)
+	if err != nil {
+		return nil, lokiConnection{}, err
+	}
+	ctx = withLokiTimeout(ctx, d)
+	ctx = withLokiHeaders(ctx, headers)
+	return ctx, conn, nil
+}
+
+// parseLokiRange returns the range (Unix ns) given by the start and end arguments of a tool call,
+// read in timezone, or in LOKI_TIMEZONE when it is empty. A missing start defaults to the default
+// lookback before now and a missing end to now. The end must be after the start.
+func parseLokiRange(startArg, endArg, timezone string) (int64, int64, error) {
+	loc, err := resolveLokiTimezone(timezone)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	start, end := defaultLokiStart(), time.Now()
+	if startArg != "" {
+		if start, err = parseTime(startArg, loc); err != nil {
+			return 0, 0, fmt.Errorf("invalid start time: %v", err)
+		}
+	}
+	if endArg != "" {
+		if end, err = parseEndTime(endArg, loc); err != nil {
+			return 0, 0, fmt.Errorf("invalid end time: %v", err)
+		}
+	}
+
+	if !end.After(start) {
+		return 0, 0, fmt.Errorf("end time must be after start time")
+	}
+	return start.UnixNano(), end.UnixNano(), nil
+}
+
+// resolveLokiRange returns the range of a tool call like parseLokiRange, refusing ranges longer
+// than LOKI_MAX_TIME_RANGE unless allowLargeRange is set
+func resolveLokiRange(startArg, endArg, timezone string, allowLargeRange bool) (int64, int64, error) {
+	start, end, err := parseLokiRange(startArg, endArg, timezone)
+	if err != nil {
+		return 0, 0, err
+	}
+	if err := checkLokiTimeRange(time.Unix(0, start), time.Unix(0, end), allowLargeRange); err != nil {
+		return 0, 0, err
+	}
+	return start, end, nil
+}
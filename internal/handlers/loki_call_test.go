@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestResolveLokiCall verifies that the connection, timeout and headers of a call are resolved together
+func TestResolveLokiCall(t *testing.T) {
+	t.Setenv(EnvLokiURL, "http://loki.example:3100")
+	t.Setenv(EnvLokiOrgID, "")
+
+	ctx, conn, err := resolveLokiCall(context.Background(), "", "", "", "", "", "tenant-a", "5s", map[string]string{"X-Scope": "a"})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if conn.URL != "http://loki.example:3100" || conn.OrgID != "tenant-a" {
+		t.Errorf("Expected LOKI_URL and the request org, got %+v", conn)
+	}
+	if ctx.Value(lokiTimeoutKey{}) != 5*time.Second {
+		t.Errorf("Expected a 5s timeout on the context, got %v", ctx.Value(lokiTimeoutKey{}))
+	}
+
+	if _, _, err := resolveLokiCall(context.Background(), "", "", "", "", "", "", "soon", nil); err == nil {
+		t.Error("Expected an error for an invalid timeout")
+	}
+}
+
+// TestResolveLokiRange verifies defaults, timezones, ordering and the LOKI_MAX_TIME_RANGE check
+func TestResolveLokiRange(t *testing.T) {
+	t.Setenv(EnvLokiMaxTimeRange, "")
+	t.Setenv(EnvLokiTimezone, "")
+
+	start, end, err := resolveLokiRange("", "", "", false)
+	if err != nil {
+		t.Fatalf("Expected no error for the default range, got %v", err)
+	}
+	if end <= start || time.Since(time.Unix(0, end)) > time.Minute {
+		t.Errorf("Expected the default range to end now, got %d-%d", start, end)
+	}
+
+	start, _, err = resolveLokiRange("2024-01-15T10:00:00", "2024-01-15T11:00:00", "Europe/Paris", false)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if want := time.Date(2024, 1, 15, 9, 0, 0, 0, time.UTC).UnixNano(); start != want {
+		t.Errorf("Expected start read in Europe/Paris (%d), got %d", want, start)
+	}
+
+	tests := []struct {
+		name, start, end, timezone, want string
+	}{
+		{"bad start", "yesterday", "", "", "invalid start time"},
+		{"bad end", "", "tomorrow", "", "invalid end time"},
+		{"bad timezone", "", "", "Mars/Olympus", "invalid timezone"},
+		{"reversed", "2024-01-15T11:00:00Z", "2024-01-15T10:00:00Z", "", "end time must be after start time"},
+	}
+	for _, tt := range tests {
+		if _, _, err := resolveLokiRange(tt.start, tt.end, tt.timezone, false); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: expected error containing %q, got %v", tt.name, tt.want, err)
+		}
+	}
+
+	t.Setenv(EnvLokiMaxTimeRange, "24h")
+	if _, _, err := resolveLokiRange("2024-01-01T00:00:00Z", "2024-01-15T00:00:00Z", "", false); err == nil {
+		t.Error("Expected a 14d range to exceed LOKI_MAX_TIME_RANGE")
+	}
+	if _, _, err := resolveLokiRange("2024-01-01T00:00:00Z", "2024-01-15T00:00:00Z", "", true); err != nil {
+		t.Errorf("Expected allowLargeRange to lift the limit, got %v", err)
+	}
+}
@@ -0,0 +1,197 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/ThinkInAIXYZ/go-mcp/protocol"
+)
+
+// LokiCapabilitiesRequest represents the arguments for loki_capabilities tool
+type LokiCapabilitiesRequest struct {
+	Backend string `json:"backend,omitempty" description:"Name of a Loki backend from LOKI_BACKENDS, e.g. prod, to describe instead of the default Loki"`
+	Format  string `json:"format,omitempty" description:"Output format: json or text (default: json)"`
+}
+
+// LokiCapabilities describes the effective server configuration so that agents can craft valid
+// calls. It never holds credentials: the URL is redacted and auth is reported by kind only.
+type LokiCapabilities struct {
+	LokiURL          string   `json:"lokiUrl"`
+	LokiVersion      string   `json:"lokiVersion,omitempty"`
+	LokiVersionError string   `json:"lokiVersionError,omitempty"`
+	Auth             string   `json:"auth"`
+	DefaultOrg       string   `json:"defaultOrg,omitempty"`
+	RequireOrg       bool     `json:"requireOrg"`
+	Backends         []string `json:"backends,omitempty"`
+	DefaultLookback  string   `json:"defaultLookback"`
+	DefaultLimit     int      `json:"defaultLimit"`
+	MaxLimit         int      `json:"maxLimit"`
+	QueryTimeout     string   `json:"queryTimeout"`
+	Timezone         string   `json:"timezone"`
+	QueryFormats     []string `json:"queryFormats"`
+	LabelFormats     []string `json:"labelFormats"`
+	SortOrders       []string `json:"sortOrders"`
+}
+
+// NewLokiCapabilitiesToolProtocol creates a tool using the protocol library
+func NewLokiCapabilitiesToolProtocol() (*protocol.Tool, error) {
+	return protocol.NewTool("loki_capabilities", "Describe the Loki server and defaults this MCP server uses: Loki URL and version, default lookback, default and maximum limit, timeout, timezone, whether auth is configured, and the supported output formats. Read-only; call it first to craft valid queries", LokiCapabilitiesRequest{})
+}
+
+// HandleLokiCapabilitiesProtocol handles Loki capabilities tool requests using protocol library
+func HandleLokiCapabilitiesProtocol(ctx context.Context, request *protocol.CallToolRequest) (*protocol.CallToolResult, error) {
+	req := new(LokiCapabilitiesRequest)
+	if err := protocol.VerifyAndUnmarshal(request.RawArguments, req); err != nil {
+		return nil, err
+	}
+
+	format := "json"
+	if req.Format != "" {
+		format = req.Format
+	}
+	if format != "json" && format != "text" {
+		return nil, fmt.Errorf("unsupported format: %s. Supported formats: json, text", format)
+	}
+
+	capabilities, err := describeLokiCapabilities(ctx, req.Backend)
+	if err != nil {
+		return nil, err
+	}
+
+	formattedResult, err := formatLokiCapabilities(capabilities, format)
+	if err != nil {
+		return nil, fmt.Errorf("failed to format results: %v", err)
+	}
+
+	return &protocol.CallToolResult{
+		Content: []protocol.Content{
+			&protocol.TextContent{
+				Type: "text",
+				Text: formattedResult,
+			},
+		},
+	}, nil
+}
+
+// describeLokiCapabilities gathers the effective configuration for backend, or the default Loki.
+// The Loki version is looked up best-effort; a failure is reported next to it instead of failing.
+func describeLokiCapabilities(ctx context.Context, backend string) (*LokiCapabilities, error) {
+	conn, err := lookupLokiConnection(backend, "", "", "", "", "")
+	if err != nil {
+		return nil, err
+	}
+	backends, err := CheckLokiBackends()
+	if err != nil {
+		return nil, err
+	}
+	defaultLimit, _, err := resolveLokiLimit(0)
+	if err != nil {
+		return nil, err
+	}
+	maxLimit, err := lokiLimitFromEnv(EnvLokiMaxLimit, DefaultLokiMaxLimit)
+	if err != nil {
+		return nil, err
+	}
+	timeout, err := resolveLokiTimeout("")
+	if err != nil {
+		return nil, err
+	}
+	loc, err := resolveLokiTimezone("")
+	if err != nil {
+		return nil, err
+	}
+	auth, err := describeLokiAuth(conn)
+	if err != nil {
+		return nil, err
+	}
+	requireOrg, err := LokiRequireOrg()
+	if err != nil {
+		return nil, err
+	}
+	lookback, _ := LokiDefaultLookback()
+
+	capabilities := &LokiCapabilities{
+		LokiURL:         redactLokiURL(conn.URL),
+		Auth:            auth,
+		DefaultOrg:      lokiOrgIDHeader(conn.OrgID),
+		RequireOrg:      requireOrg,
+		Backends:        backends,
+		DefaultLookback: lookback.String(),
+		DefaultLimit:    defaultLimit,
+		MaxLimit:        maxLimit,
+		QueryTimeout:    timeout.String(),
+		Timezone:        loc.String(),
+		QueryFormats:    lokiQueryFormats,
+		LabelFormats:    lokiLabelFormats,
+		SortOrders:      lokiSortOrders,
+	}
+
+	if info, err := lokiBuildInfo(ctx, conn); err != nil {
+		capabilities.LokiVersionError = err.Error()
+	} else {
+		capabilities.LokiVersion = info.Version
+	}
+	return capabilities, nil
+}
+
+// describeLokiAuth names the kind of authentication used with conn: sigv4, bearer, basic or none
+func describeLokiAuth(conn lokiConnection) (string, error) {
+	sigv4, err := lokiSigV4Enabled()
+	if err != nil {
+		return "", err
+	}
+	switch {
+	case sigv4:
+		return LokiAuthModeSigV4, nil
+	case conn.Token != "":
+		return "bearer", nil
+	case conn.Username != "" || conn.Password != "":
+		return "basic", nil
+	default:
+		return "none", nil
+	}
+}
+
+// formatLokiCapabilities renders capabilities as indented JSON or as one setting per line
+func formatLokiCapabilities(capabilities *LokiCapabilities, format string) (string, error) {
+	if format == "json" {
+		jsonBytes, err := json.MarshalIndent(capabilities, "", "  ")
+		if err != nil {
+			return "", fmt.Errorf("failed to marshal JSON: %v", err)
+		}
+		return string(jsonBytes), nil
+	}
+
+	version := capabilities.LokiVersion
+	if version == "" {
+		version = "unknown (" + capabilities.LokiVersionError + ")"
+	}
+	org := capabilities.DefaultOrg
+	if org == "" {
+		org = "(none)"
+	}
+	backends := strings.Join(capabilities.Backends, ", ")
+	if backends == "" {
+		backends = "(none)"
+	}
+
+	var b strings.Builder
+	b.WriteString("Loki MCP server capabilities:\n\n")
+	fmt.Fprintf(&b, "Loki URL:         %s\n", capabilities.LokiURL)
+	fmt.Fprintf(&b, "Loki version:     %s\n", version)
+	fmt.Fprintf(&b, "Auth:             %s\n", capabilities.Auth)
+	fmt.Fprintf(&b, "Default org:      %s\n", org)
+	fmt.Fprintf(&b, "Org required:     %t\n", capabilities.RequireOrg)
+	fmt.Fprintf(&b, "Backends:         %s\n", backends)
+	fmt.Fprintf(&b, "Default lookback: %s\n", capabilities.DefaultLookback)
+	fmt.Fprintf(&b, "Default limit:    %d\n", capabilities.DefaultLimit)
+	fmt.Fprintf(&b, "Max limit:        %d\n", capabilities.MaxLimit)
+	fmt.Fprintf(&b, "Query timeout:    %s\n", capabilities.QueryTimeout)
+	fmt.Fprintf(&b, "Timezone:         %s\n", capabilities.Timezone)
+	fmt.Fprintf(&b, "Query formats:    %s\n", strings.Join(capabilities.QueryFormats, ", "))
+	fmt.Fprintf(&b, "Label formats:    %s\n", strings.Join(capabilities.LabelFormats, ", "))
+	fmt.Fprintf(&b, "Sort orders:      %s\n", strings.Join(capabilities.SortOrders, ", "))
+	return b.String(), nil
+}
@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/ThinkInAIXYZ/go-mcp/protocol"
+)
+
+// TestHandleLokiCapabilitiesProtocol verifies the reported settings, redaction and version caching
+func TestHandleLokiCapabilitiesProtocol(t *testing.T) {
+	var lookups atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/loki/api/v1/status/buildinfo" {
+			http.NotFound(w, r)
+			return
+		}
+		lookups.Add(1)
+		w.Write([]byte(`{"version":"3.1.0","revision":"abc123","branch":"HEAD","goVersion":"go1.22"}`))
+	}))
+	defer server.Close()
+
+	t.Setenv(EnvLokiURL, strings.Replace(server.URL, "http://", "http://admin:hunter2@", 1))
+	t.Setenv(EnvLokiToken, "sekrit")
+	t.Setenv(EnvLokiOrgID, "tenant-1")
+	t.Setenv(EnvLokiAuthMode, "")
+	t.Setenv(EnvLokiBackends, "")
+	t.Setenv(EnvLokiMaxLimit, "2000")
+	t.Setenv(EnvLokiDefaultLimit, "")
+	t.Setenv(EnvLokiDefaultLookback, "6h")
+	t.Setenv(EnvLokiQueryTimeout, "")
+	t.Setenv(EnvLokiTimezone, "")
+
+	if _, err := NewLokiCapabilitiesToolProtocol(); err != nil {
+		t.Fatalf("Failed to create tool: %v", err)
+	}
+
+	var capabilities LokiCapabilities
+	for i := 0; i < 2; i++ {
+		result, err := HandleLokiCapabilitiesProtocol(context.Background(), &protocol.CallToolRequest{Name: "loki_capabilities", RawArguments: json.RawMessage(`{}`)})
+		if err != nil {
+			t.Fatalf("HandleLokiCapabilitiesProtocol failed: %v", err)
+		}
+		text := result.Content[0].(*protocol.TextContent).Text
+		if strings.Contains(text, "hunter2") || strings.Contains(text, "sekrit") {
+			t.Errorf("Expected secrets to be left out: %s", text)
+		}
+		if err := json.Unmarshal([]byte(text), &capabilities); err != nil {
+			t.Fatalf("Expected JSON output: %v", err)
+		}
+	}
+
+	if capabilities.LokiURL != server.URL || capabilities.LokiVersion != "3.1.0" || capabilities.Auth != "bearer" ||
+		capabilities.DefaultOrg != "tenant-1" || capabilities.DefaultLookback != "6h0m0s" ||
+		capabilities.DefaultLimit != DefaultLokiLimit || capabilities.MaxLimit != 2000 || capabilities.Timezone != "UTC" {
+		t.Errorf("Unexpected capabilities: %+v", capabilities)
+	}
+	if got := lookups.Load(); got != 1 {
+		t.Errorf("Expected the version to be looked up once, got %d lookups", got)
+	}
+}
+
+// TestHandleLokiCapabilitiesProtocol_Unreachable verifies that a missing version does not fail the call
+func TestHandleLokiCapabilitiesProtocol_Unreachable(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+
+	t.Setenv(EnvLokiURL, server.URL)
+	t.Setenv(EnvLokiToken, "")
+	t.Setenv(EnvLokiUsername, "")
+	t.Setenv(EnvLokiPassword, "")
+	t.Setenv(EnvLokiBackends, "")
+
+	if _, err := NewLokiCapabilitiesToolProtocol(); err != nil {
+		t.Fatalf("Failed to create tool: %v", err)
+	}
+	result, err := HandleLokiCapabilitiesProtocol(context.Background(), &protocol.CallToolRequest{Name: "loki_capabilities", RawArguments: json.RawMessage(`{"format":"text"}`)})
+	if err != nil {
+		t.Fatalf("HandleLokiCapabilitiesProtocol failed: %v", err)
+	}
+	text := result.Content[0].(*protocol.TextContent).Text
+	if !strings.Contains(text, "Loki version:     unknown (failed to get the Loki version") || !strings.Contains(text, "Auth:             none") {
+		t.Errorf("Unexpected output:\n%s", text)
+	}
+}
@@ -0,0 +1,448 @@
+package handlers
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Maximum delay between two retries of a Loki request
+const maxLokiRetryDelay = 10 * time.Second
+
+// Maximum time to wait for a Retry-After header before retrying a rate-limited request
+const maxLokiRetryAfter = 30 * time.Second
+
+// Maximum number of bytes of a Loki error body quoted in an error message
+const maxLokiErrorBodyBytes = 1024
+
+// LokiRateLimitError is returned when Loki keeps answering 429 Too Many Requests
+type LokiRateLimitError struct {
+	RetryAfter time.Duration // wait requested by the last response, zero if none
+	Body       string
+}
+
+// Error implements the error interface
+func (e *LokiRateLimitError) Error() string {
+	if e.RetryAfter > 0 {
+		return fmt.Sprintf("loki rate limit exceeded (retry after %s): %s", e.RetryAfter, lokiErrorBody(e.Body))
+	}
+	return fmt.Sprintf("loki rate limit exceeded: %s", lokiErrorBody(e.Body))
+}
+
+// LokiHTTPError is returned when Loki answers with a status other than 200 OK or 429
+type LokiHTTPError struct {
+	StatusCode int
+	Body       string
+}
+
+// Error implements the error interface, quoting the body Loki sent, which usually explains the failure
+func (e *LokiHTTPError) Error() string {
+	body := lokiErrorBody(e.Body)
+	if body == "" {
+		return fmt.Sprintf("HTTP error: %d %s", e.StatusCode, http.StatusText(e.StatusCode))
+	}
+	return fmt.Sprintf("HTTP error: %d - %s", e.StatusCode, body)
+}
+
+// lokiErrorBody returns the message of a Loki error body for an error message: the error field of
+// a JSON body, or the trimmed text, cut to maxLokiErrorBodyBytes without splitting a character
+func lokiErrorBody(body string) string {
+	var decoded struct {
+		Error   string `json:"error"`
+		Message string `json:"message"`
+	}
+	if err := json.Unmarshal([]byte(body), &decoded); err == nil {
+		if decoded.Error != "" {
+			body = decoded.Error
+		} else if decoded.Message != "" {
+			body = decoded.Message
+		}
+	}
+
+	body = strings.TrimSpace(body)
+	if len(body) <= maxLokiErrorBodyBytes {
+		return body
+	}
+	cut := maxLokiErrorBodyBytes
+	for cut > 0 && !utf8.RuneStart(body[cut]) {
+		cut--
+	}
+	return fmt.Sprintf("%s... (%d more bytes)", body[:cut], len(body)-cut)
+}
+
+// lokiTimeoutKey is the context key holding the timeout requested for Loki calls
+type lokiTimeoutKey struct{}
+
+// withLokiTimeout records the timeout that doLokiRequest should apply to calls made with ctx
+func withLokiTimeout(ctx context.Context, timeout time.Duration) context.Context {
+	return context.WithValue(ctx, lokiTimeoutKey{}, timeout)
+}
+
+// lokiMethodKey is the context key holding the HTTP method for Loki calls other than GET
+type lokiMethodKey struct{}
+
+// withLokiMethod records the HTTP method, such as POST, that calls made with ctx use
+func withLokiMethod(ctx context.Context, method string) context.Context {
+	return context.WithValue(ctx, lokiMethodKey{}, method)
+}
+
+// lokiRequestMethod returns the HTTP method recorded by withLokiMethod, or GET
+func lokiRequestMethod(ctx context.Context) string {
+	if method, ok := ctx.Value(lokiMethodKey{}).(string); ok {
+		return method
+	}
+	return http.MethodGet
+}
+
+// resolveLokiTimeout returns the timeout for a tool call: the request value if set, then
+// LOKI_QUERY_TIMEOUT, then DefaultLokiQueryTimeout. Values may be durations ("45s") or seconds ("45").
+func resolveLokiTimeout(value string) (time.Duration, error) {
+	if value != "" {
+		return parsePositiveDuration("timeout", value)
+	}
+
+	if envValue := os.Getenv(EnvLokiQueryTimeout); envValue != "" {
+		return parsePositiveDuration(EnvLokiQueryTimeout, envValue)
+	}
+
+	return DefaultLokiQueryTimeout, nil
+}
+
+// doLokiRequest sends an authenticated GET request, or one with the method set by withLokiMethod, to Loki and returns the response body.
+// It is shared by all Loki executors so that transport concerns live in one place.
+func doLokiRequest(ctx context.Context, queryURL string, username, password, token, orgID string) ([]byte, error) {
+	var body []byte
+	err := streamLokiRequest(ctx, queryURL, username, password, token, orgID, func(r io.Reader) (err error) {
+		body, err = io.ReadAll(r)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return body, nil
+}
+
+// streamLokiRequest sends an authenticated GET request to Loki and hands the body of a successful
+// response to read as it arrives, so that large results can be decoded without first holding the
+// whole body in memory. Transient failures are retried with exponential backoff as configured by
+// resolveLokiRetryPolicy, and a 429 response is retried once after the wait given by its
+// Retry-After header; a failure while reading a successful response is not retried, and neither
+// is a request sent with another method than GET. Each attempt fails over across the replicas of
+// LOKI_URLS, within the same timeout.
+func streamLokiRequest(ctx context.Context, queryURL string, username, password, token, orgID string, read func(io.Reader) error) (err error) {
+	// Bound the call by the timeout attached to ctx, falling back to the environment default
+	timeout, ok := ctx.Value(lokiTimeoutKey{}).(time.Duration)
+	if !ok {
+		if timeout, err = resolveLokiTimeout(""); err != nil {
+			return err
+		}
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	logLokiURL(ctx, queryURL)
+
+	// Report the outcome for the tool metrics; timeouts are reported by cause
+	defer func() {
+		if err != nil && ctx.Err() != nil {
+			recordLokiCall(ctx, ctx.Err())
+		} else {
+			recordLokiCall(ctx, err)
+		}
+	}()
+
+	// Refuse the request outright when its tenant is over LOKI_RATE_LIMIT
+	if err := checkLokiRateLimit(ctx, username, token, orgID); err != nil {
+		return err
+	}
+
+	// Account the request and the bytes Loki returns for it to its tenant
+	read, observeOrg := countLokiOrgRequest(orgID, queryURL, read)
+	defer observeOrg()
+
+	maxRetries, baseDelay, err := resolveLokiRetryPolicy()
+	if err != nil {
+		return err
+	}
+	// Only reads are retried, since repeating a write could apply it twice
+	if lokiRequestMethod(ctx) != http.MethodGet {
+		maxRetries = 0
+	}
+
+	rateLimited := false
+	for attempt := 1; ; attempt++ {
+		// Hold a slot only while the request is in flight, not while backing off
+		release, err := acquireLokiSlot(ctx)
+		if err != nil {
+			return err
+		}
+		retryable, err := sendLokiFailoverRequest(ctx, queryURL, username, password, token, orgID, read)
+		release()
+		if err == nil {
+			return nil
+		}
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return fmt.Errorf("loki query timed out after %s", timeout)
+		}
+
+		delay := retryBackoff(baseDelay, attempt)
+		var rateLimitErr *LokiRateLimitError
+		if errors.As(err, &rateLimitErr) {
+			// Rate limiting is retried only once, after the wait Loki asked for
+			if rateLimited || maxRetries == 0 || ctx.Err() != nil {
+				return err
+			}
+			rateLimited = true
+			if rateLimitErr.RetryAfter > 0 {
+				delay = min(rateLimitErr.RetryAfter, maxLokiRetryAfter)
+			}
+		} else if !retryable || ctx.Err() != nil || attempt > maxRetries {
+			if attempt > 1 {
+				return fmt.Errorf("%w (after %d attempts)", err, attempt)
+			}
+			return err
+		}
+
+		// Wait before the next attempt, giving up early if the caller goes away
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				return fmt.Errorf("loki query timed out after %s", timeout)
+			}
+			return fmt.Errorf("%w (after %d attempts)", err, attempt)
+		}
+	}
+}
+
+// sendLokiRequest performs a single request to Loki. The returned bool reports whether
+// the failure is transient and the request may be retried.
+func sendLokiRequest(ctx context.Context, queryURL string, username, password, token, orgID string) ([]byte, bool, error) {
+	var body []byte
+	retryable, err := sendLokiStreamRequest(ctx, queryURL, username, password, token, orgID, func(r io.Reader) (err error) {
+		body, err = io.ReadAll(r)
+		return err
+	})
+	if err != nil {
+		return nil, retryable, err
+	}
+	return body, false, nil
+}
+
+// sendLokiStreamRequest performs a single request to Loki, handing the body of a successful
+// response to read. The returned bool reports whether the failure is transient and the request
+// may be retried.
+func sendLokiStreamRequest(ctx context.Context, queryURL string, username, password, token, orgID string, read func(io.Reader) error) (_ bool, err error) {
+	// Create HTTP request
+	req, err := http.NewRequestWithContext(ctx, lokiRequestMethod(ctx), queryURL, nil)
+	if err != nil {
+		return false, err
+	}
+	if err := setLokiRequestHeaders(req, username, password, token, orgID); err != nil {
+		return false, err
+	}
+
+	// Ask for a compressed response. Setting the header explicitly turns off the transport's
+	// transparent decompression, so the body is decoded in openLokiBody instead.
+	req.Header.Set("Accept-Encoding", "gzip")
+
+	// Trace the request; the trace context headers are added before signing
+	ctx, span := startLokiRequestSpan(ctx, req, orgID)
+	defer func() { endLokiSpan(span, err) }()
+
+	// Sign last, since the signature covers the headers set above
+	if err := signLokiRequest(ctx, req); err != nil {
+		return false, err
+	}
+
+	client, err := lokiHTTPClient()
+	if err != nil {
+		return false, err
+	}
+
+	// Execute request; network errors such as connection resets are transient
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		observeLokiRequest(queryURL, "error", start)
+		return true, err
+	}
+	defer resp.Body.Close()
+
+	setLokiSpanStatusCode(ctx, resp.StatusCode)
+	bodyReader, err := openLokiBody(resp)
+	if err != nil {
+		observeLokiRequest(queryURL, strconv.Itoa(resp.StatusCode), start)
+		return false, err
+	}
+
+	// Hand a successful response to read as it arrives; the observed duration includes reading it
+	if resp.StatusCode == http.StatusOK || resp.StatusCode == http.StatusNoContent {
+		err := read(bodyReader)
+		observeLokiRequest(queryURL, strconv.Itoa(resp.StatusCode), start)
+		return false, err
+	}
+
+	// Read an error response in full to quote it
+	body, err := io.ReadAll(bodyReader)
+	observeLokiRequest(queryURL, strconv.Itoa(resp.StatusCode), start)
+	if err != nil {
+		return false, err
+	}
+
+	// Check for HTTP errors
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return false, &LokiRateLimitError{
+			RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()),
+			Body:       string(body),
+		}
+	}
+	return isRetryableStatus(resp.StatusCode), &LokiHTTPError{StatusCode: resp.StatusCode, Body: string(body)}
+}
+
+// parseRetryAfter parses a Retry-After header given as delay seconds or an HTTP date.
+// It returns zero when the header is missing, malformed or already in the past.
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds <= 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil && date.After(now) {
+		return date.Sub(now)
+	}
+	return 0
+}
+
+// isRetryableStatus reports whether an HTTP status from Loki indicates a transient failure
+func isRetryableStatus(status int) bool {
+	switch status {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	default:
+		return false
+	}
+}
+
+// resolveLokiRetryPolicy returns the number of retries and the base backoff delay from
+// LOKI_MAX_RETRIES and LOKI_RETRY_BASE_DELAY, falling back to the defaults
+func resolveLokiRetryPolicy() (int, time.Duration, error) {
+	maxRetries := DefaultLokiMaxRetries
+	if value := os.Getenv(EnvLokiMaxRetries); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 0 {
+			return 0, 0, fmt.Errorf("invalid %s: %q must be a non-negative integer", EnvLokiMaxRetries, value)
+		}
+		maxRetries = parsed
+	}
+
+	baseDelay := DefaultLokiRetryBaseDelay
+	if value := os.Getenv(EnvLokiRetryBaseDelay); value != "" {
+		parsed, err := parsePositiveDuration(EnvLokiRetryBaseDelay, value)
+		if err != nil {
+			return 0, 0, err
+		}
+		baseDelay = parsed
+	}
+
+	return maxRetries, baseDelay, nil
+}
+
+// retryBackoff returns the delay before retry number attempt: the base delay doubled per
+// attempt, capped at maxLokiRetryDelay, with jitter to spread out concurrent retries
+func retryBackoff(baseDelay time.Duration, attempt int) time.Duration {
+	delay := baseDelay << (attempt - 1)
+	if delay <= 0 || delay > maxLokiRetryDelay {
+		delay = maxLokiRetryDelay
+	}
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+// openLokiBody returns a reader of a Loki response body, decompressing it when the server gzipped
+// it. Servers that ignore Accept-Encoding return plain JSON, which is read as is. The decompressed
+// size is bounded by LOKI_MAX_RESPONSE_BYTES.
+func openLokiBody(resp *http.Response) (io.Reader, error) {
+	maxBytes, err := lokiMaxResponseBytes()
+	if err != nil {
+		return nil, err
+	}
+	if !strings.EqualFold(resp.Header.Get("Content-Encoding"), "gzip") {
+		return newLokiLimitedReader(resp.Body, maxBytes), nil
+	}
+
+	gz, err := gzip.NewReader(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("malformed gzip response from Loki: %v", err)
+	}
+	return newLokiLimitedReader(lokiGzipReader{gz}, maxBytes), nil
+}
+
+// lokiGzipReader reports errors reading a gzipped body as a malformed response
+type lokiGzipReader struct {
+	r io.Reader
+}
+
+func (g lokiGzipReader) Read(p []byte) (int, error) {
+	n, err := g.r.Read(p)
+	if err != nil && err != io.EOF {
+		err = fmt.Errorf("malformed gzip response from Loki: %v", err)
+	}
+	return n, err
+}
+
+// lokiOrgIDHeader turns an org ID, or several separated by commas or pipes, into the
+// X-Scope-OrgID value Loki expects, joining tenants with "|" for multi-tenant query federation
+func lokiOrgIDHeader(orgID string) string {
+	var tenants []string
+	for _, tenant := range strings.FieldsFunc(orgID, func(r rune) bool { return r == ',' || r == '|' }) {
+		if tenant = strings.TrimSpace(tenant); tenant != "" {
+			tenants = append(tenants, tenant)
+		}
+	}
+	return strings.Join(tenants, "|")
+}
+
+// setLokiRequestHeaders adds authentication, tenant, extra and operator-configured headers to a Loki request
+func setLokiRequestHeaders(req *http.Request, username, password, token, orgID string) error {
+	// Add authentication if provided; a bearer token wins over basic auth
+	if token != "" {
+		// Bearer token authentication
+		req.Header.Add("Authorization", "Bearer "+token)
+	} else if username != "" || password != "" {
+		// Basic authentication
+		req.SetBasicAuth(username, password)
+	}
+
+	// Add orgid if provided
+	if orgID = lokiOrgIDHeader(orgID); orgID != "" {
+		req.Header.Add("X-Scope-OrgID", orgID)
+	}
+
+	// Forward the request ID so that Loki's access logs can be matched with ours
+	if id := lokiRequestID(req.Context()); id != "" {
+		req.Header.Set(RequestIDHeader, id)
+	}
+
+	// Add per-request and LOKI_EXTRA_HEADERS headers without replacing the ones above
+	if err := applyLokiExtraHeaders(req.Context(), req); err != nil {
+		return err
+	}
+
+	// Add operator-configured default headers and params
+	applyLokiDefaults(req)
+	return nil
+}
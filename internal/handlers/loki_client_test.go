@@ -0,0 +1,404 @@
+package handlers
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ThinkInAIXYZ/go-mcp/protocol"
+)
+
+// TestResolveLokiTimeout verifies the request > environment > default precedence
+func TestResolveLokiTimeout(t *testing.T) {
+	t.Setenv(EnvLokiQueryTimeout, "")
+	if got, err := resolveLokiTimeout(""); err != nil || got != DefaultLokiQueryTimeout {
+		t.Errorf("Expected default timeout, got %v (%v)", got, err)
+	}
+
+	t.Setenv(EnvLokiQueryTimeout, "60")
+	if got, err := resolveLokiTimeout(""); err != nil || got != 60*time.Second {
+		t.Errorf("Expected environment timeout of 60s, got %v (%v)", got, err)
+	}
+	if got, err := resolveLokiTimeout("45s"); err != nil || got != 45*time.Second {
+		t.Errorf("Expected request timeout of 45s, got %v (%v)", got, err)
+	}
+
+	for _, invalid := range []string{"soon", "0", "-5s"} {
+		if _, err := resolveLokiTimeout(invalid); err == nil {
+			t.Errorf("Expected error for timeout %q", invalid)
+		}
+	}
+}
+
+// TestHandleLokiQueryProtocol_Timeout verifies that a slow Loki produces a readable timeout error
+func TestHandleLokiQueryProtocol_Timeout(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	for _, env := range []string{EnvLokiURL, EnvLokiOrgID, EnvLokiUsername, EnvLokiPassword, EnvLokiToken, EnvLokiQueryTimeout} {
+		t.Setenv(env, "")
+	}
+
+	if _, err := NewLokiQueryToolProtocol(); err != nil {
+		t.Fatalf("Failed to create tool: %v", err)
+	}
+
+	raw, _ := json.Marshal(map[string]any{"query": `{job="x"}`, "url": server.URL, "timeout": "100ms"})
+	_, err := HandleLokiQueryProtocol(context.Background(), &protocol.CallToolRequest{Name: "loki_query", RawArguments: raw})
+	if err == nil {
+		t.Fatal("Expected timeout error, got nil")
+	}
+	if !strings.Contains(err.Error(), "loki query timed out after 100ms") {
+		t.Errorf("Expected readable timeout error, got %v", err)
+	}
+}
+
+// TestDoLokiRequest_Gzip verifies gzip negotiation, plain fallbacks and malformed gzip bodies
+func TestDoLokiRequest_Gzip(t *testing.T) {
+	payload := `{"status":"success","data":["job","host"]}`
+	var compressed bytes.Buffer
+	gz := gzip.NewWriter(&compressed)
+	gz.Write([]byte(payload))
+	gz.Close()
+
+	testCases := []struct {
+		name     string
+		encoding string
+		body     []byte
+		wantErr  string
+	}{
+		{name: "Gzipped", encoding: "gzip", body: compressed.Bytes()},
+		{name: "Plain", body: []byte(payload)},
+		{name: "Malformed", encoding: "gzip", body: []byte("not gzip"), wantErr: "malformed gzip response"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if got := r.Header.Get("Accept-Encoding"); got != "gzip" {
+					t.Errorf("Expected Accept-Encoding gzip, got %q", got)
+				}
+				if tc.encoding != "" {
+					w.Header().Set("Content-Encoding", tc.encoding)
+				}
+				w.Write(tc.body)
+			}))
+			defer server.Close()
+
+			result, err := executeLokiLabelsQuery(context.Background(), server.URL+"/loki/api/v1/labels", "", "", "", "")
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Errorf("Expected error containing %q, got %v", tc.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("executeLokiLabelsQuery failed: %v", err)
+			}
+			if len(result.Data) != 2 || result.Data[0] != "job" {
+				t.Errorf("Unexpected labels: %v", result.Data)
+			}
+		})
+	}
+}
+
+// TestDoLokiRequest_Retries verifies that transient errors are retried and permanent ones are not
+func TestDoLokiRequest_Retries(t *testing.T) {
+	t.Setenv(EnvLokiMaxRetries, "2")
+	t.Setenv(EnvLokiRetryBaseDelay, "1ms")
+
+	testCases := []struct {
+		name         string
+		statuses     []int
+		wantAttempts int
+		wantErr      string
+	}{
+		{name: "Recovers after 503", statuses: []int{503, 502, 200}, wantAttempts: 3},
+		{name: "Gives up after max retries", statuses: []int{504, 504, 504, 504}, wantAttempts: 3, wantErr: "(after 3 attempts)"},
+		{name: "No retry on 400", statuses: []int{400, 200}, wantAttempts: 1, wantErr: "HTTP error: 400"},
+		{name: "No retry on 401", statuses: []int{401, 200}, wantAttempts: 1, wantErr: "HTTP error: 401"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			attempts := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				status := tc.statuses[attempts]
+				attempts++
+				w.WriteHeader(status)
+				w.Write([]byte(`{"status":"success","data":["job"]}`))
+			}))
+			defer server.Close()
+
+			_, err := doLokiRequest(context.Background(), server.URL, "", "", "", "")
+			if attempts != tc.wantAttempts {
+				t.Errorf("Expected %d attempts, got %d", tc.wantAttempts, attempts)
+			}
+			if tc.wantErr == "" && err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+			if tc.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tc.wantErr)) {
+				t.Errorf("Expected error containing %q, got %v", tc.wantErr, err)
+			}
+		})
+	}
+}
+
+// TestLokiErrorBody verifies that error bodies are unwrapped from JSON, trimmed and truncated
+func TestLokiErrorBody(t *testing.T) {
+	if got := lokiErrorBody("parse error at line 1, col 5: syntax error: unexpected IDENTIFIER\n"); got != "parse error at line 1, col 5: syntax error: unexpected IDENTIFIER" {
+		t.Errorf("Unexpected plain body %q", got)
+	}
+	if got := lokiErrorBody(`{"status":"error","errorType":"bad_data","error":"invalid duration"}`); got != "invalid duration" {
+		t.Errorf("Unexpected JSON body %q", got)
+	}
+	if got := lokiErrorBody(`{"message":"no org id"}`); got != "no org id" {
+		t.Errorf("Unexpected JSON message %q", got)
+	}
+
+	long := strings.Repeat("a", maxLokiErrorBodyBytes-1) + "é" + strings.Repeat("b", 99)
+	got := lokiErrorBody(long)
+	if want := strings.Repeat("a", maxLokiErrorBodyBytes-1) + "... (101 more bytes)"; got != want {
+		t.Errorf("Expected truncation before the split character, got %q", got[maxLokiErrorBodyBytes-10:])
+	}
+
+	if got := (&LokiHTTPError{StatusCode: 403}).Error(); got != "HTTP error: 403 Forbidden" {
+		t.Errorf("Unexpected error for empty body %q", got)
+	}
+}
+
+// TestHandleLokiQueryProtocol_BadRequest verifies that the reason Loki rejected a query reaches the caller
+func TestHandleLokiQueryProtocol_BadRequest(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "parse error at line 1, col 12: syntax error: unexpected IDENTIFIER", http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	if _, err := NewLokiQueryToolProtocol(); err != nil {
+		t.Fatalf("Failed to create tool: %v", err)
+	}
+
+	raw, _ := json.Marshal(map[string]any{"query": `{job="x"} |= "a"`, "url": server.URL})
+	_, err := HandleLokiQueryProtocol(context.Background(), &protocol.CallToolRequest{Name: "loki_query", RawArguments: raw})
+	want := "loki rejected the query: HTTP error: 400 - parse error at line 1, col 12: syntax error: unexpected IDENTIFIER"
+	if err == nil || !strings.Contains(err.Error(), want) {
+		t.Errorf("Expected error containing %q, got %v", want, err)
+	}
+}
+
+// TestDoLokiRequest_RetryCancelled verifies that cancellation stops the backoff wait
+func TestDoLokiRequest_RetryCancelled(t *testing.T) {
+	t.Setenv(EnvLokiMaxRetries, "5")
+	t.Setenv(EnvLokiRetryBaseDelay, "10s")
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+
+	started := time.Now()
+	if _, err := doLokiRequest(ctx, server.URL, "", "", "", ""); err == nil {
+		t.Fatal("Expected error after cancellation")
+	}
+	if elapsed := time.Since(started); elapsed > 2*time.Second {
+		t.Errorf("Expected cancellation to interrupt the backoff, took %s", elapsed)
+	}
+}
+
+// TestParseRetryAfter verifies both Retry-After forms
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+
+	testCases := []struct {
+		value string
+		want  time.Duration
+	}{
+		{value: "", want: 0},
+		{value: "5", want: 5 * time.Second},
+		{value: "-1", want: 0},
+		{value: "Mon, 15 Jan 2024 10:00:30 GMT", want: 30 * time.Second},
+		{value: "Mon, 15 Jan 2024 09:59:00 GMT", want: 0},
+		{value: "soon", want: 0},
+	}
+
+	for _, tc := range testCases {
+		if got := parseRetryAfter(tc.value, now); got != tc.want {
+			t.Errorf("parseRetryAfter(%q) = %v, want %v", tc.value, got, tc.want)
+		}
+	}
+}
+
+// TestDoLokiRequest_RateLimited verifies that a 429 is retried once and then surfaces a typed error
+func TestDoLokiRequest_RateLimited(t *testing.T) {
+	t.Setenv(EnvLokiMaxRetries, "3")
+	t.Setenv(EnvLokiRetryBaseDelay, "1ms")
+
+	testCases := []struct {
+		name         string
+		statuses     []int
+		wantAttempts int
+		wantTyped    bool
+	}{
+		{name: "Recovers after one 429", statuses: []int{429, 200}, wantAttempts: 2},
+		{name: "Typed error after second 429", statuses: []int{429, 429, 200}, wantAttempts: 2, wantTyped: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			attempts := 0
+			var waited time.Duration
+			var last time.Time
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if !last.IsZero() {
+					waited = time.Since(last)
+				}
+				last = time.Now()
+				status := tc.statuses[attempts]
+				attempts++
+				if status == http.StatusTooManyRequests {
+					w.Header().Set("Retry-After", "1")
+				}
+				w.WriteHeader(status)
+				w.Write([]byte(`{"status":"success","data":[]}`))
+			}))
+			defer server.Close()
+
+			_, err := doLokiRequest(context.Background(), server.URL, "", "", "", "")
+			if attempts != tc.wantAttempts {
+				t.Errorf("Expected %d attempts, got %d", tc.wantAttempts, attempts)
+			}
+			if waited < 900*time.Millisecond {
+				t.Errorf("Expected the retry to wait for Retry-After, waited %s", waited)
+			}
+
+			var rateLimitErr *LokiRateLimitError
+			if tc.wantTyped {
+				if !errors.As(err, &rateLimitErr) {
+					t.Fatalf("Expected LokiRateLimitError, got %v", err)
+				}
+				if rateLimitErr.RetryAfter != time.Second {
+					t.Errorf("Expected RetryAfter of 1s, got %v", rateLimitErr.RetryAfter)
+				}
+			} else if err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+// TestLokiOrgIDHeader verifies that several org IDs are joined for multi-tenant queries
+func TestLokiOrgIDHeader(t *testing.T) {
+	tests := map[string]string{
+		"":                      "",
+		"tenant-1":              "tenant-1",
+		"tenant-1, tenant-2":    "tenant-1|tenant-2",
+		"tenant-1|tenant-2,, ":  "tenant-1|tenant-2",
+		" tenant-1 | tenant-2 ": "tenant-1|tenant-2",
+	}
+	for orgID, want := range tests {
+		if got := lokiOrgIDHeader(orgID); got != want {
+			t.Errorf("lokiOrgIDHeader(%q) = %q, want %q", orgID, got, want)
+		}
+	}
+}
+
+// TestLabelEndpoints_OrgID verifies that the label and label values requests carry X-Scope-OrgID
+func TestLabelEndpoints_OrgID(t *testing.T) {
+	var orgIDs []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		orgIDs = append(orgIDs, r.Header.Get("X-Scope-OrgID"))
+		w.Write([]byte(`{"status":"success","data":["job"]}`))
+	}))
+	defer server.Close()
+
+	t.Setenv(EnvLokiOrgID, "env-tenant")
+	t.Setenv(EnvLokiLabelCacheTTL, "0")
+	if _, err := NewLokiLabelNamesToolProtocol(); err != nil {
+		t.Fatalf("Failed to create tool: %v", err)
+	}
+	if _, err := NewLokiLabelValuesToolProtocol(); err != nil {
+		t.Fatalf("Failed to create tool: %v", err)
+	}
+
+	calls := []struct {
+		name    string
+		handler func(context.Context, *protocol.CallToolRequest) (*protocol.CallToolResult, error)
+		args    map[string]any
+		want    string
+	}{
+		{"loki_label_names", HandleLokiLabelNamesProtocol, map[string]any{"url": server.URL}, "env-tenant"},
+		{"loki_label_names", HandleLokiLabelNamesProtocol, map[string]any{"url": server.URL, "org": "tenant-1"}, "tenant-1"},
+		{"loki_label_values", HandleLokiLabelValuesProtocol, map[string]any{"url": server.URL, "label": "job", "org": "tenant-1"}, "tenant-1"},
+		{"loki_label_values", HandleLokiLabelValuesProtocol, map[string]any{"url": server.URL, "label": "job", "org": "tenant-1,tenant-2"}, "tenant-1|tenant-2"},
+	}
+	for i, call := range calls {
+		raw, _ := json.Marshal(call.args)
+		if _, err := call.handler(context.Background(), &protocol.CallToolRequest{Name: call.name, RawArguments: raw}); err != nil {
+			t.Fatalf("%s failed: %v", call.name, err)
+		}
+		if len(orgIDs) != i+1 || orgIDs[i] != call.want {
+			t.Errorf("%s with %v: expected X-Scope-OrgID %q, got %v", call.name, call.args, call.want, orgIDs)
+		}
+	}
+}
+
+// TestExecuteLokiQuery_Cancelled verifies that cancelling the context aborts a request in flight,
+// both while waiting for Loki to answer and while reading its answer, and closes the connection
+func TestExecuteLokiQuery_Cancelled(t *testing.T) {
+	t.Setenv(EnvLokiMaxRetries, "3")
+
+	tests := map[string]bool{"waiting for the response": false, "reading the body": true}
+	for name, sendHeaders := range tests {
+		t.Run(name, func(t *testing.T) {
+			aborted := make(chan struct{})
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if sendHeaders {
+					w.Write([]byte(`{"status":"success","data":{"resultType":"streams","result":[`))
+					w.(http.Flusher).Flush()
+				}
+				select {
+				case <-r.Context().Done():
+					close(aborted)
+				case <-time.After(10 * time.Second):
+				}
+			}))
+			defer server.Close()
+
+			ctx, cancel := context.WithCancel(context.Background())
+			time.AfterFunc(100*time.Millisecond, cancel)
+
+			started := time.Now()
+			_, err := executeLokiQuery(ctx, server.URL, "", "", "", "")
+			if !errors.Is(err, context.Canceled) {
+				t.Errorf("Expected a context.Canceled error, got %v", err)
+			}
+			if elapsed := time.Since(started); elapsed > 2*time.Second {
+				t.Errorf("Expected the call to return promptly after cancellation, took %s", elapsed)
+			}
+
+			// The server sees the connection go away, so nothing is left waiting on Loki
+			select {
+			case <-aborted:
+			case <-time.After(2 * time.Second):
+				t.Error("Expected the request to Loki to be aborted")
+			}
+		})
+	}
+}
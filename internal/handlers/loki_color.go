@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"strings"
+)
+
+// ANSI escape sequences used by the color format
+const (
+	ansiReset  = "\x1b[0m"
+	ansiRed    = "\x1b[31m"
+	ansiYellow = "\x1b[33m"
+	ansiDim    = "\x1b[2m"
+)
+
+// lokiLevelKeys lists the field names that may hold the level of a log line, matched case-insensitively
+var lokiLevelKeys = []string{"level", "lvl", "severity", "loglevel"}
+
+// detectLokiLevel returns the lower-case level of a JSON or logfmt log line, or "" if it has none
+func detectLokiLevel(line string) string {
+	trimmed := strings.TrimSpace(line)
+	if strings.HasPrefix(trimmed, "{") {
+		var fields map[string]any
+		if err := json.Unmarshal([]byte(trimmed), &fields); err == nil {
+			for key, value := range fields {
+				if level, ok := value.(string); ok && isLokiLevelKey(key) {
+					return strings.ToLower(level)
+				}
+			}
+			return ""
+		}
+	}
+
+	if pairs, ok := parseLogfmt(trimmed); ok {
+		for _, pair := range pairs {
+			if isLokiLevelKey(pair.Key) {
+				return strings.ToLower(pair.Value)
+			}
+		}
+	}
+	return ""
+}
+
+// isLokiLevelKey reports whether key names the level field of a log line
+func isLokiLevelKey(key string) bool {
+	for _, levelKey := range lokiLevelKeys {
+		if strings.EqualFold(key, levelKey) {
+			return true
+		}
+	}
+	return false
+}
+
+// lokiLevelColor returns the ANSI color for a log level, or "" to leave the line uncolored
+func lokiLevelColor(level string) string {
+	switch level {
+	case "error", "err", "fatal", "critical", "crit", "panic", "alert", "emerg":
+		return ansiRed
+	case "warn", "warning":
+		return ansiYellow
+	case "debug", "trace":
+		return ansiDim
+	default:
+		return ""
+	}
+}
+
+// formatLokiColor formats the results like the text format, coloring each line by its level:
+// errors red, warnings yellow and debug dim. Only callers that asked for the color format get
+// ANSI escapes, so agents and non-terminal consumers never see them.
+func formatLokiColor(result *LokiResult) (string, error) {
+	var b strings.Builder
+	if err := writeLokiColor(&b, result); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// writeLokiColor writes the color format one line at a time
+func writeLokiColor(w io.Writer, result *LokiResult) error {
+	return writeLokiTextLines(w, result, colorLokiLine)
+}
+
+// colorLokiLine wraps a log line in the ANSI color of its level
+func colorLokiLine(line string) string {
+	if color := lokiLevelColor(detectLokiLevel(line)); color != "" {
+		return color + line + ansiReset
+	}
+	return line
+}
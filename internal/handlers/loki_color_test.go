@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestDetectLokiLevel verifies level detection in JSON and logfmt lines
+func TestDetectLokiLevel(t *testing.T) {
+	tests := map[string]string{
+		`{"level":"ERROR","msg":"boom"}`:           "error",
+		`{"msg":"slow","Severity":"warning"}`:      "warning",
+		`level=debug msg="cache miss" key=user:42`: "debug",
+		`ts=2024-01-15T10:00:00Z lvl=info msg=ok`:  "info",
+		`{"msg":"no level"}`:                       "",
+		`plain text line`:                          "",
+	}
+	for line, want := range tests {
+		if got := detectLokiLevel(line); got != want {
+			t.Errorf("detectLokiLevel(%q) = %q, want %q", line, got, want)
+		}
+	}
+}
+
+// TestFormatLokiResults_Color verifies that lines are colored by level and others left as is
+func TestFormatLokiResults_Color(t *testing.T) {
+	result := &LokiResult{Status: "success"}
+	result.Data.Result = []LokiEntry{{
+		Stream: map[string]string{"job": "api"},
+		Values: [][]string{
+			{"1705312800000000000", `level=error msg="db down"`},
+			{"1705312801000000000", `{"level":"warn","msg":"slow"}`},
+			{"1705312802000000000", `level=debug msg=trace`},
+			{"1705312803000000000", `level=info msg=ok`},
+		},
+	}}
+
+	output, err := formatLokiResults(result, "color")
+	if err != nil {
+		t.Fatalf("formatLokiResults failed: %v", err)
+	}
+
+	for _, want := range []string{
+		ansiRed + `level=error msg="db down"` + ansiReset,
+		ansiYellow + `{"level":"warn","msg":"slow"}` + ansiReset,
+		ansiDim + `level=debug msg=trace` + ansiReset,
+		"] level=info msg=ok\n",
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("Expected %q in output:\n%s", want, output)
+		}
+	}
+	if result.Data.Result[0].Values[0][1] != `level=error msg="db down"` {
+		t.Error("Expected the original result to be left unchanged")
+	}
+}
+
+// TestLoadLokiDefaults_RejectsColor verifies that ANSI output cannot become the server-wide default
+func TestLoadLokiDefaults_RejectsColor(t *testing.T) {
+	t.Setenv(EnvLokiDefaults, `{"format":"color"}`)
+	if _, err := LoadLokiDefaults(); err == nil {
+		t.Error("Expected an error for the color format")
+	}
+}
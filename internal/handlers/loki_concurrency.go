@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Environment variable name for the maximum number of requests sent to Loki at the same time
+const EnvLokiMaxConcurrent = "LOKI_MAX_CONCURRENT"
+
+// Default maximum number of requests sent to Loki at the same time
+const DefaultLokiMaxConcurrent = 10
+
+// Slots limiting concurrent Loki requests, one semaphore per configured limit so that a
+// changed limit does not strand requests holding a slot of the previous one
+var (
+	lokiSlotsMu sync.Mutex
+	lokiSlots   = map[int]chan struct{}{}
+)
+
+// loadLokiMaxConcurrent reads the concurrent request limit from the environment
+func loadLokiMaxConcurrent() (int, error) {
+	raw := os.Getenv(EnvLokiMaxConcurrent)
+	if raw == "" {
+		return DefaultLokiMaxConcurrent, nil
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("invalid %s: %q must be a positive integer", EnvLokiMaxConcurrent, raw)
+	}
+	return n, nil
+}
+
+// CheckLokiConcurrency validates the concurrent request limit so that mistakes are reported at startup
+func CheckLokiConcurrency() error {
+	_, err := loadLokiMaxConcurrent()
+	return err
+}
+
+// acquireLokiSlot waits until fewer than LOKI_MAX_CONCURRENT requests are in flight, so that
+// bursts of tool calls queue here instead of overwhelming Loki. The returned function releases
+// the slot. Waiting ends with an error when ctx is canceled or its deadline passes.
+func acquireLokiSlot(ctx context.Context) (func(), error) {
+	limit, err := loadLokiMaxConcurrent()
+	if err != nil {
+		return nil, err
+	}
+
+	lokiSlotsMu.Lock()
+	slots, ok := lokiSlots[limit]
+	if !ok {
+		slots = make(chan struct{}, limit)
+		lokiSlots[limit] = slots
+	}
+	lokiSlotsMu.Unlock()
+
+	start := time.Now()
+	select {
+	case slots <- struct{}{}:
+		return func() { <-slots }, nil
+	case <-ctx.Done():
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return nil, fmt.Errorf("timed out after %s waiting for one of %d Loki request slots (%s); Loki is busy with other calls",
+				time.Since(start).Round(time.Millisecond), limit, EnvLokiMaxConcurrent)
+		}
+		return nil, ctx.Err()
+	}
+}
@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestAcquireLokiSlot_Limit verifies that requests beyond the limit queue instead of reaching Loki
+func TestAcquireLokiSlot_Limit(t *testing.T) {
+	t.Setenv(EnvLokiMaxConcurrent, "2")
+	t.Setenv(EnvLokiMaxRetries, "0")
+
+	var active, peak atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := active.Add(1)
+		defer active.Add(-1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		w.Write([]byte(`{"status":"success","data":[]}`))
+	}))
+	defer server.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 6; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := doLokiRequest(context.Background(), server.URL+"/loki/api/v1/labels", "", "", "", ""); err != nil {
+				t.Errorf("doLokiRequest failed: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := peak.Load(); got > 2 {
+		t.Errorf("Expected at most 2 concurrent requests, got %d", got)
+	}
+}
+
+// TestAcquireLokiSlot_Timeout verifies that waiting for a slot ends with the request timeout
+func TestAcquireLokiSlot_Timeout(t *testing.T) {
+	t.Setenv(EnvLokiMaxConcurrent, "1")
+
+	release, err := acquireLokiSlot(context.Background())
+	if err != nil {
+		t.Fatalf("acquireLokiSlot failed: %v", err)
+	}
+	defer release()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := acquireLokiSlot(ctx); err == nil || !strings.Contains(err.Error(), "waiting for one of 1 Loki request slots") {
+		t.Errorf("Expected a slot timeout error, got %v", err)
+	}
+
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := acquireLokiSlot(canceled); err != context.Canceled {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+}
+
+// TestCheckLokiConcurrency verifies validation of LOKI_MAX_CONCURRENT
+func TestCheckLokiConcurrency(t *testing.T) {
+	for _, valid := range []string{"", "1", "50"} {
+		t.Setenv(EnvLokiMaxConcurrent, valid)
+		if err := CheckLokiConcurrency(); err != nil {
+			t.Errorf("Expected %q to be accepted: %v", valid, err)
+		}
+	}
+	for _, invalid := range []string{"0", "-1", "many"} {
+		t.Setenv(EnvLokiMaxConcurrent, invalid)
+		if err := CheckLokiConcurrency(); err == nil {
+			t.Errorf("Expected an error for %q", invalid)
+		}
+	}
+}
@@ -0,0 +1,219 @@
+package handlers
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Most lines the context option fetches before and after each match
+const lokiMaxContextLines = 20
+
+// Most matches context lines are fetched for, since each costs two extra queries
+const lokiMaxContextMatches = 10
+
+// How far before and after a match its context lines are looked for
+const lokiContextWindow = 10 * time.Minute
+
+// Marker prepended to context lines so that they stand apart from the matches
+const lokiContextMarker = "[context] "
+
+// lokiContextFormats lists the formats that can show marked context lines; the others must stay
+// faithful to Loki's data or parse each line
+var lokiContextFormats = []string{"raw", "text", "color", "markdown"}
+
+// lokiContextFetcher runs a log query over the range from start to end (Unix ns)
+type lokiContextFetcher func(query string, start, end int64, limit int, direction string) (*LokiResult, error)
+
+// resolveLokiContext validates the context option of loki_query and returns the number of lines
+// to fetch on each side of a match, or 0 when no context was requested
+func resolveLokiContext(lines float64, format string, fields []string, summarize, groupByStream bool) (int, error) {
+	if lines == 0 {
+		return 0, nil
+	}
+	if lines < 0 || lines > lokiMaxContextLines || lines != float64(int(lines)) {
+		return 0, fmt.Errorf("invalid context %v: must be a whole number of lines from 1 to %d", lines, lokiMaxContextLines)
+	}
+	if len(fields) > 0 || summarize || groupByStream {
+		return 0, fmt.Errorf("context cannot be combined with fields, summarize or groupByStream")
+	}
+	if !slices.Contains(lokiContextFormats, format) {
+		return 0, fmt.Errorf("context is not supported with format %s, supported formats: %s", format, strings.Join(lokiContextFormats, ", "))
+	}
+	return int(lines), nil
+}
+
+// lokiContextQuery turns a log query into one returning the neighbours of its matches in the
+// stream with the given labels: line filters and label filters are dropped so that every line
+// comes back, the other stages are kept so that parsed labels and formatted lines look the same,
+// and a label filter for each label of the stream keeps only that stream
+func lokiContextQuery(query string, stream map[string]string) (string, error) {
+	open := findLogQLSelector(query)
+	if open < 0 || strings.TrimSpace(query[:open]) != "" {
+		return "", fmt.Errorf("context needs a log query")
+	}
+	closing := strings.IndexByte(query[open:], '}')
+	if closing < 0 {
+		return "", fmt.Errorf("context needs a log query")
+	}
+	closing += open
+
+	parts := []string{query[open : closing+1]}
+	rest := strings.TrimSpace(query[closing+1:])
+	for rest != "" {
+		if op := rest[:min(2, len(rest))]; logqlLineFilterMeanings[op] != "" {
+			rest = strings.TrimSpace(rest[2:])
+			_, n := readLogQLValue(rest)
+			if n == 0 {
+				return "", fmt.Errorf("cannot read the line filter %s", op+" "+rest)
+			}
+			rest = strings.TrimSpace(rest[n:])
+			for strings.HasPrefix(rest, "or ") {
+				_, n := readLogQLValue(strings.TrimSpace(rest[3:]))
+				if n == 0 {
+					break
+				}
+				rest = strings.TrimSpace(strings.TrimSpace(rest[3:])[n:])
+			}
+			continue
+		}
+
+		if rest[0] != '|' {
+			return "", fmt.Errorf("cannot read the pipeline at %s", rest)
+		}
+		n := readLogQLStage(rest[1:])
+		body := strings.TrimSpace(rest[1 : 1+n])
+		rest = strings.TrimSpace(rest[1+n:])
+		if !logqlLabelFilterPattern.MatchString(body) {
+			parts = append(parts, "| "+body)
+		}
+	}
+
+	names := make([]string, 0, len(stream))
+	for name := range stream {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		parts = append(parts, fmt.Sprintf("| %s=%s", name, strconv.Quote(stream[name])))
+	}
+	return strings.Join(parts, " "), nil
+}
+
+// lokiContextMatch is an entry of the result whose neighbours are fetched
+type lokiContextMatch struct {
+	stream int
+	ts     int64
+}
+
+// addLokiContext returns a copy of result in which up to lines entries before and after each
+// match, from the same stream, are merged into its stream marked with lokiContextMarker. Each
+// match takes two queries, one looking back and one looking forward within lokiContextWindow, and
+// only the first lokiMaxContextMatches matches in direction order get context. Context lines are
+// redacted like the matches. It also returns the number of redactions in the context lines and
+// a note for the tool response.
+func addLokiContext(result *LokiResult, query string, lines int, direction string, redact *regexp.Regexp, fetch lokiContextFetcher) (*LokiResult, int, string) {
+	var matches []lokiContextMatch
+	for i, entry := range result.Data.Result {
+		for _, val := range entry.Values {
+			if len(val) < 2 {
+				continue
+			}
+			if ts, err := strconv.ParseInt(val[0], 10, 64); err == nil {
+				matches = append(matches, lokiContextMatch{stream: i, ts: ts})
+			}
+		}
+	}
+	if len(matches) == 0 {
+		return result, 0, ""
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		if direction == "forward" {
+			return matches[i].ts < matches[j].ts
+		}
+		return matches[i].ts > matches[j].ts
+	})
+	total := len(matches)
+	if len(matches) > lokiMaxContextMatches {
+		matches = matches[:lokiMaxContextMatches]
+	}
+
+	withContext := *result
+	withContext.Data.Result = make([]LokiEntry, len(result.Data.Result))
+	seen := make([]map[string]bool, len(result.Data.Result))
+	for i, entry := range result.Data.Result {
+		withContext.Data.Result[i] = LokiEntry{Stream: entry.Stream, Values: slices.Clone(entry.Values)}
+		seen[i] = make(map[string]bool, len(entry.Values))
+		for _, val := range entry.Values {
+			if len(val) >= 2 {
+				seen[i][val[0]+"\x00"+val[1]] = true
+			}
+		}
+	}
+
+	added, redacted, queries := 0, 0, 0
+	var failure error
+	for _, match := range matches {
+		contextQuery, err := lokiContextQuery(query, result.Data.Result[match.stream].Stream)
+		if err != nil {
+			failure = err
+			break
+		}
+		windows := []struct {
+			start, end int64
+			direction  string
+		}{
+			{match.ts - lokiContextWindow.Nanoseconds(), match.ts, "backward"},
+			{match.ts + 1, match.ts + 1 + lokiContextWindow.Nanoseconds(), "forward"},
+		}
+		for _, window := range windows {
+			queries++
+			neighbours, err := fetch(contextQuery, window.start, window.end, lines, window.direction)
+			if err != nil {
+				if failure == nil {
+					failure = err
+				}
+				continue
+			}
+			neighbours, n := redactLokiResult(neighbours, redact)
+			redacted += n
+			for _, entry := range neighbours.Data.Result {
+				for _, val := range entry.Values {
+					if len(val) < 2 || seen[match.stream][val[0]+"\x00"+val[1]] {
+						continue
+					}
+					seen[match.stream][val[0]+"\x00"+val[1]] = true
+					stream := &withContext.Data.Result[match.stream]
+					stream.Values = append(stream.Values, []string{val[0], lokiContextMarker + val[1]})
+					added++
+				}
+			}
+		}
+	}
+
+	// Keep each stream in the order Loki returned it, with the context lines in place
+	for i := range withContext.Data.Result {
+		values := withContext.Data.Result[i].Values
+		sort.SliceStable(values, func(a, b int) bool {
+			ta, _ := strconv.ParseInt(values[a][0], 10, 64)
+			tb, _ := strconv.ParseInt(values[b][0], 10, 64)
+			if direction == "forward" {
+				return ta < tb
+			}
+			return ta > tb
+		})
+	}
+
+	note := fmt.Sprintf("context: %d lines fetched around %d matches with %d extra queries, marked %q", added, len(matches), queries, strings.TrimSpace(lokiContextMarker))
+	if len(matches) < total {
+		note += fmt.Sprintf("; only the first %d of %d matches got context lines", len(matches), total)
+	}
+	if failure != nil {
+		note += fmt.Sprintf("; some context lines could not be fetched: %v", failure)
+	}
+	return &withContext, redacted, note
+}
@@ -0,0 +1,182 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/ThinkInAIXYZ/go-mcp/protocol"
+)
+
+// TestResolveLokiContext verifies the accepted numbers of lines and outputs
+func TestResolveLokiContext(t *testing.T) {
+	if lines, err := resolveLokiContext(0, "json", nil, true, false); err != nil || lines != 0 {
+		t.Errorf("Expected no context, got %d, %v", lines, err)
+	}
+	if lines, err := resolveLokiContext(3, "text", nil, false, false); err != nil || lines != 3 {
+		t.Errorf("Expected 3 lines, got %d, %v", lines, err)
+	}
+	for _, lines := range []float64{-1, 1.5, lokiMaxContextLines + 1} {
+		if _, err := resolveLokiContext(lines, "text", nil, false, false); err == nil {
+			t.Errorf("Expected error for context %v", lines)
+		}
+	}
+	if _, err := resolveLokiContext(2, "json", nil, false, false); err == nil {
+		t.Error("Expected error for json format")
+	}
+	if _, err := resolveLokiContext(2, "text", []string{"msg"}, false, false); err == nil {
+		t.Error("Expected error with fields")
+	}
+}
+
+// TestLokiContextQuery verifies that filters are dropped, other stages kept and the stream pinned
+func TestLokiContextQuery(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{`{app="api"} |= "error"`, `{app="api"} | app="api" | pod="api-1"`},
+		{`{app="api"} |= "error" or "fatal" !~ "health" | json | status >= 500 | line_format "{{.msg}}"`,
+			`{app="api"} | json | line_format "{{.msg}}" | app="api" | pod="api-1"`},
+		{`{app="api"}`, `{app="api"} | app="api" | pod="api-1"`},
+	}
+	for _, tt := range tests {
+		got, err := lokiContextQuery(tt.query, map[string]string{"pod": "api-1", "app": "api"})
+		if err != nil || got != tt.want {
+			t.Errorf("lokiContextQuery(%s) = %s, %v; expected %s", tt.query, got, err, tt.want)
+		}
+	}
+
+	if _, err := lokiContextQuery(`sum(rate({app="api"}[5m]))`, nil); err == nil {
+		t.Error("Expected error for a metric query")
+	}
+}
+
+// TestAddLokiContext verifies that context lines are merged in time order, marked and not repeated
+func TestAddLokiContext(t *testing.T) {
+	result := &LokiResult{Status: "success", Data: LokiData{ResultType: "streams", Result: []LokiEntry{
+		{Stream: map[string]string{"job": "a"}, Values: [][]string{{"50", "error two"}, {"20", "error one"}}},
+	}}}
+
+	var queries []string
+	fetch := func(query string, start, end int64, limit int, direction string) (*LokiResult, error) {
+		queries = append(queries, fmt.Sprintf("%s %s limit=%d", query, direction, limit))
+		var values [][]string
+		if direction == "backward" && end == 50 {
+			values = [][]string{{"40", "before two"}, {"20", "error one"}}
+		} else if direction == "forward" && start == 21 {
+			values = [][]string{{"30", "after one"}, {"40", "before two"}}
+		}
+		return &LokiResult{Data: LokiData{Result: []LokiEntry{{Stream: map[string]string{"job": "a"}, Values: values}}}}, nil
+	}
+
+	withContext, _, note := addLokiContext(result, `{job="a"} |= "error"`, 2, "backward", nil, fetch)
+	var lines []string
+	for _, val := range withContext.Data.Result[0].Values {
+		lines = append(lines, val[0]+" "+val[1])
+	}
+	want := []string{"50 error two", "40 [context] before two", "30 [context] after one", "20 error one"}
+	if strings.Join(lines, "|") != strings.Join(want, "|") {
+		t.Errorf("Expected %q, got %q", want, lines)
+	}
+	if len(result.Data.Result[0].Values) != 2 {
+		t.Error("Expected the original result to be left unchanged")
+	}
+	if len(queries) != 4 || queries[0] != `{job="a"} | job="a" backward limit=2` {
+		t.Errorf("Unexpected queries %q", queries)
+	}
+	if !strings.Contains(note, "2 lines fetched around 2 matches with 4 extra queries") {
+		t.Errorf("Unexpected note %q", note)
+	}
+}
+
+// TestHandleLokiQueryProtocol_Context verifies that context lines come from extra queries and are
+// left out of the metadata
+func TestHandleLokiQueryProtocol_Context(t *testing.T) {
+	var extra atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.Contains(r.URL.Query().Get("query"), "|=") {
+			extra.Add(1)
+			if r.URL.Query().Get("direction") == "backward" {
+				w.Write([]byte(`{"status":"success","data":{"resultType":"streams","result":[{"stream":{"job":"api"},"values":[["1705312801000000000","connecting to db"]]}]}}`))
+				return
+			}
+			w.Write([]byte(`{"status":"success","data":{"resultType":"streams","result":[]}}`))
+			return
+		}
+		w.Write([]byte(`{"status":"success","data":{"resultType":"streams","result":[{"stream":{"job":"api"},"values":[["1705312802000000000","error: db timeout"]]}]}}`))
+	}))
+	defer server.Close()
+
+	if _, err := NewLokiQueryToolProtocol(); err != nil {
+		t.Fatalf("Failed to create tool: %v", err)
+	}
+	raw, _ := json.Marshal(map[string]any{"query": `{job="api"} |= "error"`, "url": server.URL, "format": "raw", "context": 3})
+	result, err := HandleLokiQueryProtocol(context.Background(), &protocol.CallToolRequest{Name: "loki_query", RawArguments: raw})
+	if err != nil {
+		t.Fatalf("HandleLokiQueryProtocol failed: %v", err)
+	}
+
+	var texts []string
+	for _, content := range result.Content {
+		if text, ok := content.(*protocol.TextContent); ok {
+			texts = append(texts, text.Text)
+		}
+	}
+	output := texts[0]
+	if match, before := strings.Index(output, "error: db timeout"), strings.Index(output, "[context] connecting to db"); before < 0 || before < match {
+		t.Errorf("Expected the earlier context line after the match, newest first, got %q", output)
+	}
+	if extra.Load() != 2 {
+		t.Errorf("Expected 2 extra queries, got %d", extra.Load())
+	}
+	if !strings.Contains(texts[1], `"entries": 1`) && !strings.Contains(texts[1], `"entries":1`) {
+		t.Errorf("Expected the metadata to count the match only, got %s", texts[1])
+	}
+	if !strings.Contains(strings.Join(texts, "\n"), "context: 1 lines fetched around 1 matches with 2 extra queries") {
+		t.Errorf("Expected the context note, got %q", texts)
+	}
+
+	raw, _ = json.Marshal(map[string]any{"query": `{job="api"} |= "error"`, "url": server.URL, "format": "json", "context": 3})
+	if _, err := HandleLokiQueryProtocol(context.Background(), &protocol.CallToolRequest{Name: "loki_query", RawArguments: raw}); err == nil {
+		t.Error("Expected error for context with json format")
+	}
+}
+
+// TestHandleLokiQueryProtocol_ContextDedup verifies that dedup keeps the context lines
+func TestHandleLokiQueryProtocol_ContextDedup(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.Contains(r.URL.Query().Get("query"), "|=") {
+			if r.URL.Query().Get("direction") == "backward" {
+				w.Write([]byte(`{"status":"success","data":{"resultType":"streams","result":[{"stream":{"job":"api"},"values":[["1705312801000000000","connecting to db"]]}]}}`))
+				return
+			}
+			w.Write([]byte(`{"status":"success","data":{"resultType":"streams","result":[]}}`))
+			return
+		}
+		w.Write([]byte(`{"status":"success","data":{"resultType":"streams","result":[{"stream":{"job":"api"},"values":[["1705312803000000000","error: db timeout"],["1705312802000000000","error: db timeout"]]}]}}`))
+	}))
+	defer server.Close()
+
+	if _, err := NewLokiQueryToolProtocol(); err != nil {
+		t.Fatalf("Failed to create tool: %v", err)
+	}
+	raw, _ := json.Marshal(map[string]any{"query": `{job="api"} |= "error"`, "url": server.URL, "format": "raw", "context": 3, "dedup": true})
+	result, err := HandleLokiQueryProtocol(context.Background(), &protocol.CallToolRequest{Name: "loki_query", RawArguments: raw})
+	if err != nil {
+		t.Fatalf("HandleLokiQueryProtocol failed: %v", err)
+	}
+
+	output := result.Content[0].(*protocol.TextContent).Text
+	if !strings.Contains(output, "[context] connecting to db") {
+		t.Errorf("Expected the context line to survive dedup, got %q", output)
+	}
+	if !strings.Contains(output, "error: db timeout (x2") {
+		t.Errorf("Expected the repeated match to be collapsed, got %q", output)
+	}
+}
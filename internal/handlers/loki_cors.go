@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+)
+
+// Environment variable name for the comma-separated origins allowed to call the server from a browser
+const EnvCORSAllowedOrigins = "CORS_ALLOWED_ORIGINS"
+
+// Environment variable name for the comma-separated methods allowed in cross-origin requests
+const EnvCORSAllowedMethods = "CORS_ALLOWED_METHODS"
+
+// Environment variable name for the comma-separated request headers allowed in cross-origin requests
+const EnvCORSAllowedHeaders = "CORS_ALLOWED_HEADERS"
+
+// Default methods allowed in cross-origin requests, covering the MCP endpoint and /export
+const DefaultCORSAllowedMethods = "GET, POST, DELETE, OPTIONS"
+
+// Default request headers allowed in cross-origin requests, covering those MCP clients send
+const DefaultCORSAllowedHeaders = "Content-Type, Accept, Authorization, Mcp-Session-Id, Mcp-Protocol-Version, Last-Event-ID, traceparent"
+
+// Response headers exposed to browser scripts
+const corsExposedHeaders = "Mcp-Session-Id"
+
+// How long browsers may cache a preflight response, in seconds
+const corsMaxAge = "600"
+
+// corsPolicy is the cross-origin configuration of the HTTP server
+type corsPolicy struct {
+	origins []string
+	any     bool
+	methods string
+	headers string
+}
+
+// NewCORSHandler wraps next with CORS handling configured by CORS_ALLOWED_ORIGINS,
+// CORS_ALLOWED_METHODS and CORS_ALLOWED_HEADERS. Without allowed origins, next is returned
+// unchanged and browsers keep their same-origin policy.
+func NewCORSHandler(next http.Handler) (http.Handler, error) {
+	policy, err := loadCORSPolicy()
+	if err != nil {
+		return nil, err
+	}
+	if policy == nil {
+		return next, nil
+	}
+	return policy.wrap(next), nil
+}
+
+// loadCORSPolicy reads the CORS configuration from the environment, returning nil when CORS is disabled
+func loadCORSPolicy() (*corsPolicy, error) {
+	value := os.Getenv(EnvCORSAllowedOrigins)
+	if strings.TrimSpace(value) == "" {
+		return nil, nil
+	}
+
+	policy := &corsPolicy{
+		methods: getEnvOrDefault("", EnvCORSAllowedMethods, DefaultCORSAllowedMethods),
+		headers: getEnvOrDefault("", EnvCORSAllowedHeaders, DefaultCORSAllowedHeaders),
+	}
+	for _, origin := range strings.Split(value, ",") {
+		origin = strings.TrimSpace(origin)
+		if origin == "" {
+			continue
+		}
+		if origin == "*" {
+			policy.any = true
+			continue
+		}
+		u, err := url.Parse(origin)
+		if err != nil || u.Scheme == "" || u.Host == "" || (u.Path != "" && u.Path != "/") {
+			return nil, fmt.Errorf("invalid %s: %q is not an origin such as https://agent.example.com", EnvCORSAllowedOrigins, origin)
+		}
+		policy.origins = append(policy.origins, strings.TrimSuffix(origin, "/"))
+	}
+	return policy, nil
+}
+
+// allows reports whether requests from origin are allowed
+func (p *corsPolicy) allows(origin string) bool {
+	return p.any || slices.Contains(p.origins, origin)
+}
+
+// wrap adds CORS headers to responses for allowed origins and answers preflight requests
+func (p *corsPolicy) wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Add("Vary", "Origin")
+		preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+		if !p.allows(origin) {
+			if preflight {
+				http.Error(w, "origin not allowed", http.StatusForbidden)
+				return
+			}
+			// Without CORS headers the browser withholds the response from the calling page
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if p.any {
+			w.Header().Set("Access-Control-Allow-Origin", "*")
+		} else {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+		}
+
+		if preflight {
+			w.Header().Set("Access-Control-Allow-Methods", p.methods)
+			w.Header().Set("Access-Control-Allow-Headers", p.headers)
+			w.Header().Set("Access-Control-Max-Age", corsMaxAge)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		w.Header().Set("Access-Control-Expose-Headers", corsExposedHeaders)
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// corsTestHandler wraps a handler answering 200 OK with the CORS configuration from the environment
+func corsTestHandler(t *testing.T) http.Handler {
+	t.Helper()
+	handler, err := NewCORSHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	if err != nil {
+		t.Fatalf("NewCORSHandler failed: %v", err)
+	}
+	return handler
+}
+
+// TestCORS_DisabledByDefault verifies that no CORS headers are sent without allowed origins
+func TestCORS_DisabledByDefault(t *testing.T) {
+	t.Setenv(EnvCORSAllowedOrigins, "")
+	handler := corsTestHandler(t)
+
+	req := httptest.NewRequest("POST", "/mcp", nil)
+	req.Header.Set("Origin", "http://localhost:5173")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "" {
+		t.Errorf("Expected no Access-Control-Allow-Origin, got %q", got)
+	}
+}
+
+// TestCORS_AllowedOrigin verifies preflight and simple requests from an allowed origin
+func TestCORS_AllowedOrigin(t *testing.T) {
+	t.Setenv(EnvCORSAllowedOrigins, "http://localhost:5173, https://agent.example.com/")
+	t.Setenv(EnvCORSAllowedMethods, "")
+	t.Setenv(EnvCORSAllowedHeaders, "")
+	handler := corsTestHandler(t)
+
+	req := httptest.NewRequest("OPTIONS", "/mcp", nil)
+	req.Header.Set("Origin", "https://agent.example.com")
+	req.Header.Set("Access-Control-Request-Method", "POST")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusNoContent {
+		t.Errorf("Expected 204 for preflight, got %d", rec.Code)
+	}
+	if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "https://agent.example.com" {
+		t.Errorf("Unexpected Access-Control-Allow-Origin %q", got)
+	}
+	if got := rec.Header().Get("Access-Control-Allow-Methods"); got != DefaultCORSAllowedMethods {
+		t.Errorf("Unexpected Access-Control-Allow-Methods %q", got)
+	}
+	if got := rec.Header().Get("Access-Control-Allow-Headers"); got != DefaultCORSAllowedHeaders {
+		t.Errorf("Unexpected Access-Control-Allow-Headers %q", got)
+	}
+	if rec.Body.Len() != 0 {
+		t.Error("Expected preflight not to reach the wrapped handler")
+	}
+
+	req = httptest.NewRequest("POST", "/mcp", nil)
+	req.Header.Set("Origin", "http://localhost:5173")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Body.String() != "ok" {
+		t.Error("Expected the request to reach the wrapped handler")
+	}
+	if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "http://localhost:5173" {
+		t.Errorf("Unexpected Access-Control-Allow-Origin %q", got)
+	}
+	if got := rec.Header().Get("Access-Control-Expose-Headers"); got != "Mcp-Session-Id" {
+		t.Errorf("Unexpected Access-Control-Expose-Headers %q", got)
+	}
+	if got := rec.Header().Get("Vary"); got != "Origin" {
+		t.Errorf("Expected Vary: Origin, got %q", got)
+	}
+}
+
+// TestCORS_DisallowedOrigin verifies that other origins get no CORS headers
+func TestCORS_DisallowedOrigin(t *testing.T) {
+	t.Setenv(EnvCORSAllowedOrigins, "http://localhost:5173")
+	handler := corsTestHandler(t)
+
+	req := httptest.NewRequest("OPTIONS", "/mcp", nil)
+	req.Header.Set("Origin", "https://evil.example.com")
+	req.Header.Set("Access-Control-Request-Method", "POST")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 for preflight, got %d", rec.Code)
+	}
+	if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "" {
+		t.Errorf("Expected no Access-Control-Allow-Origin, got %q", got)
+	}
+
+	req = httptest.NewRequest("GET", "/healthz", nil)
+	req.Header.Set("Origin", "https://evil.example.com")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "" {
+		t.Errorf("Expected no Access-Control-Allow-Origin, got %q", got)
+	}
+}
+
+// TestCORS_Wildcard verifies that a wildcard allows any origin
+func TestCORS_Wildcard(t *testing.T) {
+	t.Setenv(EnvCORSAllowedOrigins, "*")
+	t.Setenv(EnvCORSAllowedHeaders, "Content-Type")
+	handler := corsTestHandler(t)
+
+	req := httptest.NewRequest("OPTIONS", "/mcp", nil)
+	req.Header.Set("Origin", "http://anything.test")
+	req.Header.Set("Access-Control-Request-Method", "POST")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "*" {
+		t.Errorf("Expected Access-Control-Allow-Origin *, got %q", got)
+	}
+	if got := rec.Header().Get("Access-Control-Allow-Headers"); got != "Content-Type" {
+		t.Errorf("Unexpected Access-Control-Allow-Headers %q", got)
+	}
+}
+
+// TestCORS_InvalidOrigin verifies that malformed origins are rejected
+func TestCORS_InvalidOrigin(t *testing.T) {
+	for _, origins := range []string{"localhost:5173", "https://agent.example.com/app"} {
+		t.Setenv(EnvCORSAllowedOrigins, origins)
+		if _, err := NewCORSHandler(http.NotFoundHandler()); err == nil {
+			t.Errorf("Expected an error for %q", origins)
+		}
+	}
+}
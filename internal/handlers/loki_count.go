@@ -0,0 +1,203 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ThinkInAIXYZ/go-mcp/protocol"
+)
+
+// lokiCountFormats lists the output formats supported with countOnly
+var lokiCountFormats = []string{"raw", "json", "text"}
+
+// lokiCountResult is the json output of a countOnly query
+type lokiCountResult struct {
+	Count      int64  `json:"count"`
+	Start      string `json:"start"`
+	End        string `json:"end"`
+	Range      string `json:"range"`
+	CountQuery string `json:"countQuery"`
+}
+
+// checkLokiCountOnly reports an error when countOnly is combined with an option that shapes
+// returned lines, since a count returns none
+func checkLokiCountOnly(req *LokiQueryRequest, format string) error {
+	var options []string
+	if len(req.Fields) > 0 {
+		options = append(options, "fields")
+	}
+	if req.Summarize {
+		options = append(options, "summarize")
+	}
+	if req.Dedup {
+		options = append(options, "dedup")
+	}
+	if req.Sort != "" {
+		options = append(options, "sort")
+	}
+	if req.ShowDeltas {
+		options = append(options, "showDeltas")
+	}
+	if req.GroupByStream {
+		options = append(options, "groupByStream")
+	}
+	if len(req.OutputLabels) > 0 {
+		options = append(options, "outputLabels")
+	}
+	if req.LineRegex != "" {
+		options = append(options, "lineRegex")
+	}
+	if len(req.Redact) > 0 {
+		options = append(options, "redact")
+	}
+	if req.AutoWiden {
+		options = append(options, "autoWiden")
+	}
+	if req.Context > 0 {
+		options = append(options, "context")
+	}
+	if req.Interval != "" {
+		options = append(options, "interval")
+	}
+	if req.JoinMultiline {
+		options = append(options, "joinMultiline")
+	}
+	if req.Explain {
+		options = append(options, "explain")
+	}
+	if len(options) > 0 {
+		return fmt.Errorf("countOnly returns a number without log lines, so it cannot be combined with %s", strings.Join(options, ", "))
+	}
+	if !slices.Contains(lokiCountFormats, format) {
+		return fmt.Errorf("countOnly is only supported with format %s", strings.Join(lokiCountFormats, ", "))
+	}
+	return nil
+}
+
+// lokiCountQuery wraps a log query in sum(count_over_time(...)) over the range from start to end
+// (Unix ns). Only a stream selector with an optional log pipeline can be wrapped; metric queries
+// and pipelines ending in unwrap are rejected.
+func lokiCountQuery(query string, start, end int64) (string, error) {
+	query = strings.TrimSpace(query)
+	// A metric query has a function before its selector, or a range or parenthesis after its pipeline
+	open := findLogQLSelector(query)
+	if open != 0 || endOfLogQLPipeline(query, strings.IndexByte(query, '}')+1) != len(query) {
+		return "", fmt.Errorf("countOnly needs a log query such as {job=\"api\"} |= \"error\" to wrap in count_over_time; %s is already a metric query, so run it without countOnly", query)
+	}
+	for _, stage := range explainLogQL(query).Stages {
+		if strings.HasPrefix(stage, "unwrap") {
+			return "", fmt.Errorf("countOnly cannot count a query with an unwrap stage, which only range aggregations such as sum_over_time accept")
+		}
+	}
+	if end <= start {
+		return "", fmt.Errorf("countOnly needs an end time after the start time")
+	}
+	return fmt.Sprintf("sum(count_over_time(%s [%s]))", query, lokiRangeDuration(time.Duration(end-start))), nil
+}
+
+// lokiRangeDuration renders d as a LogQL range, in seconds when whole and otherwise in
+// milliseconds rounded up, since LogQL ranges have no finer unit
+func lokiRangeDuration(d time.Duration) string {
+	if d%time.Second == 0 {
+		return fmt.Sprintf("%ds", d/time.Second)
+	}
+	return fmt.Sprintf("%dms", (d+time.Millisecond-1)/time.Millisecond)
+}
+
+// buildLokiInstantQueryURL constructs the URL of an instant query evaluated at the given time (Unix ns)
+func buildLokiInstantQueryURL(baseURL, query string, at int64) (string, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return "", err
+	}
+
+	// Add path for Loki instant query API
+	if !strings.Contains(u.Path, "loki/api/v1") {
+		if u.Path == "" || u.Path == "/" {
+			u.Path = "/loki/api/v1/query"
+		} else {
+			u.Path = fmt.Sprintf("%s/loki/api/v1/query", u.Path)
+		}
+	} else {
+		// If path already contains loki/api/v1, just append query if not present
+		if !strings.HasSuffix(u.Path, "/query") {
+			u.Path = fmt.Sprintf("%s/query", u.Path)
+		}
+	}
+
+	// Add query parameters
+	q := u.Query()
+	q.Set("query", query)
+	q.Set("time", fmt.Sprintf("%d", at))
+	u.RawQuery = q.Encode()
+
+	return u.String(), nil
+}
+
+// lokiCountValue returns the count in the vector result of a sum(count_over_time(...)) query,
+// which is empty when nothing matched
+func lokiCountValue(result *LokiMetricResult) (int64, error) {
+	if len(result.Data.Result) == 0 || result.Data.Result[0].Value == nil {
+		return 0, nil
+	}
+	value, err := strconv.ParseFloat(result.Data.Result[0].Value.Value, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid count %q returned by Loki: %v", result.Data.Result[0].Value.Value, err)
+	}
+	return int64(value), nil
+}
+
+// formatLokiCount formats the count of entries matching query between start and end (Unix ns)
+func formatLokiCount(count int64, query, countQuery string, start, end int64, format string) (string, error) {
+	startText := time.Unix(0, start).UTC().Format(time.RFC3339Nano)
+	endText := time.Unix(0, end).UTC().Format(time.RFC3339Nano)
+	span := formatLokiLookback(time.Duration(end - start))
+
+	if format == "json" {
+		jsonBytes, err := json.MarshalIndent(lokiCountResult{Count: count, Start: startText, End: endText, Range: span, CountQuery: countQuery}, "", "  ")
+		if err != nil {
+			return "", fmt.Errorf("failed to marshal JSON: %v", err)
+		}
+		return string(jsonBytes), nil
+	}
+	return fmt.Sprintf("%d log entries matched %s between %s and %s (%s)\nCounted by Loki with %s",
+		count, query, startText, endText, span, countQuery), nil
+}
+
+// handleLokiCountOnly answers a countOnly loki_query with the number of entries matching the
+// query in the resolved range, counted by Loki without returning any line
+func handleLokiCountOnly(ctx context.Context, req *LokiQueryRequest, conn lokiConnection, start, end int64, format string) (*protocol.CallToolResult, error) {
+	countQuery, err := lokiCountQuery(req.Query, start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	queryURL, err := buildLokiInstantQueryURL(conn.URL, countQuery, end)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build query URL: %v", err)
+	}
+	result, err := executeLokiQueryRange(ctx, queryURL, conn.Username, conn.Password, conn.Token, conn.OrgID)
+	if err != nil {
+		return nil, fmt.Errorf("count query execution failed: %v", err)
+	}
+	count, err := lokiCountValue(result)
+	if err != nil {
+		return nil, err
+	}
+	setLokiSpanEntries(ctx, int(count))
+
+	text, err := formatLokiCount(count, req.Query, countQuery, start, end, format)
+	if err != nil {
+		return nil, err
+	}
+	content := []protocol.Content{&protocol.TextContent{Type: "text", Text: text}}
+	return &protocol.CallToolResult{
+		Content: lokiNotesContent(content, lokiResultNotes(result.Status, result.Warnings, nil, 0)),
+	}, nil
+}
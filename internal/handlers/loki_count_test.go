@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ThinkInAIXYZ/go-mcp/protocol"
+)
+
+// TestLokiCountQuery verifies which queries can be wrapped and how
+func TestLokiCountQuery(t *testing.T) {
+	start := time.Date(2024, 1, 15, 9, 0, 0, 0, time.UTC).UnixNano()
+	end := start + time.Hour.Nanoseconds()
+
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{`{job="api"}`, `sum(count_over_time({job="api"} [3600s]))`},
+		{` {job="api"} |= "error" | json | status >= 500 `, `sum(count_over_time({job="api"} |= "error" | json | status >= 500 [3600s]))`},
+		{`{job="api"} |~ "a(b|c)"`, `sum(count_over_time({job="api"} |~ "a(b|c)" [3600s]))`},
+	}
+	for _, tt := range tests {
+		got, err := lokiCountQuery(tt.query, start, end)
+		if err != nil {
+			t.Fatalf("lokiCountQuery(%q) failed: %v", tt.query, err)
+		}
+		if got != tt.want {
+			t.Errorf("lokiCountQuery(%q): expected %q, got %q", tt.query, tt.want, got)
+		}
+	}
+
+	for _, query := range []string{
+		`count_over_time({job="api"}[5m])`,
+		`sum by (level) (rate({job="api"}[1m]))`,
+		`{job="api"} | logfmt | unwrap latency`,
+	} {
+		if _, err := lokiCountQuery(query, start, end); err == nil {
+			t.Errorf("Expected error for %q", query)
+		}
+	}
+	if _, err := lokiCountQuery(`{job="api"}`, end, end); err == nil {
+		t.Error("Expected error for an empty range")
+	}
+}
+
+// TestLokiRangeDuration verifies the LogQL ranges of whole and fractional seconds
+func TestLokiRangeDuration(t *testing.T) {
+	if got := lokiRangeDuration(90 * time.Minute); got != "5400s" {
+		t.Errorf("Expected 5400s, got %s", got)
+	}
+	if got := lokiRangeDuration(1500*time.Millisecond + time.Microsecond); got != "1501ms" {
+		t.Errorf("Expected 1501ms, got %s", got)
+	}
+}
+
+// TestHandleLokiQueryProtocol_CountOnly verifies that the count comes from an instant query at end
+func TestHandleLokiQueryProtocol_CountOnly(t *testing.T) {
+	var gotPath, gotQuery, gotTime string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath, gotQuery, gotTime = r.URL.Path, r.URL.Query().Get("query"), r.URL.Query().Get("time")
+		w.Write([]byte(`{"status":"success","data":{"resultType":"vector","result":[{"metric":{},"value":[1705312800,"1234"]}]}}`))
+	}))
+	defer server.Close()
+
+	if _, err := NewLokiQueryToolProtocol(); err != nil {
+		t.Fatalf("Failed to create tool: %v", err)
+	}
+	call := func(args map[string]any) (*protocol.CallToolResult, error) {
+		args["url"] = server.URL
+		args["countOnly"] = true
+		args["start"] = "2024-01-15T09:00:00Z"
+		args["end"] = "2024-01-15T10:00:00Z"
+		raw, _ := json.Marshal(args)
+		return HandleLokiQueryProtocol(context.Background(), &protocol.CallToolRequest{Name: "loki_query", RawArguments: raw})
+	}
+
+	result, err := call(map[string]any{"query": `{job="api"} |= "error"`, "format": "text"})
+	if err != nil {
+		t.Fatalf("HandleLokiQueryProtocol failed: %v", err)
+	}
+	if gotPath != "/loki/api/v1/query" || gotQuery != `sum(count_over_time({job="api"} |= "error" [3600s]))` || gotTime != "1705312800000000000" {
+		t.Errorf("Unexpected request %s query=%s time=%s", gotPath, gotQuery, gotTime)
+	}
+	text := result.Content[0].(*protocol.TextContent).Text
+	if !strings.HasPrefix(text, `1234 log entries matched {job="api"} |= "error" between 2024-01-15T09:00:00Z and 2024-01-15T10:00:00Z (1h)`) {
+		t.Errorf("Unexpected text %q", text)
+	}
+
+	result, err = call(map[string]any{"query": `{job="api"}`, "format": "json"})
+	if err != nil {
+		t.Fatalf("HandleLokiQueryProtocol failed: %v", err)
+	}
+	var counted lokiCountResult
+	if err := json.Unmarshal([]byte(result.Content[0].(*protocol.TextContent).Text), &counted); err != nil || counted.Count != 1234 || counted.Range != "1h" {
+		t.Errorf("Unexpected json %+v, %v", counted, err)
+	}
+
+	if _, err := call(map[string]any{"query": `{job="api"}`, "lineRegex": "x", "dedup": true}); err == nil || !strings.Contains(err.Error(), "dedup, lineRegex") {
+		t.Errorf("Expected an error naming the line options, got %v", err)
+	}
+	if _, err := call(map[string]any{"query": `{job="api"}`, "format": "push"}); err == nil {
+		t.Error("Expected error for format push")
+	}
+}
+
+// TestLokiCountValue verifies that an empty vector counts as zero
+func TestLokiCountValue(t *testing.T) {
+	count, err := lokiCountValue(&LokiMetricResult{Data: LokiMetricData{ResultType: "vector"}})
+	if err != nil || count != 0 {
+		t.Errorf("Expected 0, got %d, %v", count, err)
+	}
+}
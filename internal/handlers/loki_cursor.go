@@ -0,0 +1,196 @@
+package handlers
+
+import (
+	"fmt"
+	"hash/fnv"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// lokiCursor is a decoded continuation token: the direction, the timestamp (Unix ns) of the last
+// entry returned, and the IDs of the entries returned at that timestamp, which the next page
+// skips. Without IDs the next page starts past the timestamp.
+type lokiCursor struct {
+	direction string
+	ts        int64
+	returned  map[string]bool
+}
+
+// lokiCursorEntryID identifies an entry of a stream within a cursor as a short hash of its
+// labels, timestamp and line
+func lokiCursorEntryID(key string, value []string) string {
+	h := fnv.New64a()
+	h.Write([]byte(key + "\x00" + value[0] + "\x00" + value[1]))
+	return fmt.Sprintf("%016x", h.Sum64())
+}
+
+// formatLokiCursor encodes the continuation token for the page following an entry at ts (Unix ns),
+// listing the IDs of the entries already returned at ts
+func formatLokiCursor(direction string, ts int64, returned map[string]bool) string {
+	if len(returned) == 0 {
+		return fmt.Sprintf("%s:%d", direction, ts)
+	}
+	ids := make([]string, 0, len(returned))
+	for id := range returned {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+	return fmt.Sprintf("%s:%d:%s", direction, ts, strings.Join(ids, ","))
+}
+
+// parseLokiCursor decodes a continuation token created by formatLokiCursor
+func parseLokiCursor(cursor string) (lokiCursor, error) {
+	invalid := fmt.Errorf("invalid cursor: %q, pass the cursor returned by the previous call unchanged", cursor)
+	parts := strings.SplitN(cursor, ":", 3)
+	if len(parts) < 2 || (parts[0] != "forward" && parts[0] != "backward") {
+		return lokiCursor{}, invalid
+	}
+	ts, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil || ts < 0 {
+		return lokiCursor{}, invalid
+	}
+
+	parsed := lokiCursor{direction: parts[0], ts: ts}
+	if len(parts) == 3 {
+		parsed.returned = make(map[string]bool)
+		for _, id := range strings.Split(parts[2], ",") {
+			if _, err := strconv.ParseUint(id, 16, 64); err != nil || len(id) != 16 {
+				return lokiCursor{}, invalid
+			}
+			parsed.returned[id] = true
+		}
+	}
+	return parsed, nil
+}
+
+// applyLokiCursor narrows the range [start, end) (Unix ns) to the entries from the cursor on.
+// Pages resume at the cursor's timestamp, so that entries sharing it with the last entry of the
+// previous page are not lost, and skipLokiCursorEntries drops those already returned; a cursor
+// without entry IDs resumes past its timestamp. The cursor's direction is used when none is
+// requested and must match one that is.
+func applyLokiCursor(cursor, direction string, start, end int64) (lokiCursor, int64, int64, error) {
+	parsed, err := parseLokiCursor(cursor)
+	if err != nil {
+		return lokiCursor{}, 0, 0, err
+	}
+
+	if direction != "" && direction != parsed.direction {
+		return lokiCursor{}, 0, 0, fmt.Errorf("cursor direction %s does not match requested direction %s", parsed.direction, direction)
+	}
+
+	// Forward pages start at the cursor's timestamp and backward pages end just after it, or,
+	// without entry IDs, start just after it and end at it
+	inclusive := len(parsed.returned) > 0
+	if parsed.direction == "forward" {
+		from := parsed.ts + 1
+		if inclusive {
+			from = parsed.ts
+		}
+		start = max(start, from)
+	} else {
+		to := parsed.ts
+		if inclusive {
+			to = parsed.ts + 1
+		}
+		end = min(end, to)
+	}
+	return parsed, start, end, nil
+}
+
+// skipLokiCursorEntries returns result without the entries the cursor lists as already returned,
+// and the number of entries skipped
+func skipLokiCursorEntries(result *LokiResult, cursor lokiCursor) (*LokiResult, int) {
+	if len(cursor.returned) == 0 || result.Data.ResultType != "streams" {
+		return result, 0
+	}
+
+	kept := *result
+	kept.Data.Result = nil
+	skipped := 0
+	for _, entry := range result.Data.Result {
+		key := streamKey(entry.Stream)
+		var values [][]string
+		for _, val := range entry.Values {
+			if len(val) >= 2 && cursor.returned[lokiCursorEntryID(key, val)] {
+				skipped++
+				continue
+			}
+			values = append(values, val)
+		}
+		if len(values) > 0 {
+			kept.Data.Result = append(kept.Data.Result, LokiEntry{Stream: entry.Stream, Values: values})
+		}
+	}
+	return &kept, skipped
+}
+
+// nextLokiCursor returns the cursor for the page after result: the oldest returned timestamp
+// when reading backward, or the newest when reading forward, with the entries returned at that
+// timestamp by this page and, if it did not move, by the pages before. A page holding only
+// entries already returned means more entries share the timestamp than fit in a page, so the
+// cursor then moves past it. Only log stream results can be paged; it returns an empty string
+// for metric results or when no entries were returned.
+func nextLokiCursor(result *LokiResult, direction string, previous lokiCursor) string {
+	if direction == "" {
+		direction = "backward"
+	}
+	boundary, found := lokiBoundaryTimestamp(result, direction == "forward")
+	if !found {
+		return ""
+	}
+
+	returned := make(map[string]bool)
+	if boundary == previous.ts {
+		for id := range previous.returned {
+			returned[id] = true
+		}
+	}
+	added := 0
+	for _, entry := range result.Data.Result {
+		key := streamKey(entry.Stream)
+		for _, val := range entry.Values {
+			if len(val) < 2 {
+				continue
+			}
+			id := lokiCursorEntryID(key, val)
+			if !previous.returned[id] {
+				added++
+			}
+			if ts, err := strconv.ParseInt(val[0], 10, 64); err == nil && ts == boundary {
+				returned[id] = true
+			}
+		}
+	}
+	if added == 0 {
+		return formatLokiCursor(direction, boundary, nil)
+	}
+	return formatLokiCursor(direction, boundary, returned)
+}
+
+// lokiBoundaryTimestamp returns the newest or oldest entry timestamp (Unix ns) of a log stream
+// result, and false for metric results or when no entries were returned
+func lokiBoundaryTimestamp(result *LokiResult, newest bool) (int64, bool) {
+	if result.Data.ResultType != "streams" {
+		return 0, false
+	}
+
+	var boundary int64
+	found := false
+	for _, entry := range result.Data.Result {
+		for _, value := range entry.Values {
+			if len(value) < 1 {
+				continue
+			}
+			ts, err := strconv.ParseInt(value[0], 10, 64)
+			if err != nil {
+				continue
+			}
+			if !found || (newest && ts > boundary) || (!newest && ts < boundary) {
+				boundary = ts
+				found = true
+			}
+		}
+	}
+	return boundary, found
+}
@@ -0,0 +1,232 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/ThinkInAIXYZ/go-mcp/protocol"
+)
+
+// TestApplyLokiCursor verifies how cursors narrow the range in each direction
+func TestApplyLokiCursor(t *testing.T) {
+	testCases := []struct {
+		name          string
+		cursor        string
+		direction     string
+		wantDirection string
+		wantStart     int64
+		wantEnd       int64
+		wantErr       bool
+	}{
+		{name: "Backward moves end", cursor: "backward:150", wantDirection: "backward", wantStart: 100, wantEnd: 150},
+		{name: "Backward with entries keeps the timestamp", cursor: "backward:150:00000000000000ff", wantDirection: "backward", wantStart: 100, wantEnd: 151},
+		{name: "Forward with entries keeps the timestamp", cursor: "forward:150:00000000000000ff,0123456789abcdef", wantDirection: "forward", wantStart: 150, wantEnd: 200},
+		{name: "Forward moves start past entry", cursor: "forward:150", wantDirection: "forward", wantStart: 151, wantEnd: 200},
+		{name: "Matching direction", cursor: "forward:150", direction: "forward", wantDirection: "forward", wantStart: 151, wantEnd: 200},
+		{name: "Outside range keeps bounds", cursor: "backward:500", wantDirection: "backward", wantStart: 100, wantEnd: 200},
+		{name: "Direction mismatch", cursor: "forward:150", direction: "backward", wantErr: true},
+		{name: "Missing timestamp", cursor: "backward", wantErr: true},
+		{name: "Unknown direction", cursor: "sideways:150", wantErr: true},
+		{name: "Bad timestamp", cursor: "backward:soon", wantErr: true},
+		{name: "Bad entry ID", cursor: "backward:150:xyz", wantErr: true},
+		{name: "Empty entry IDs", cursor: "backward:150:", wantErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cursor, start, end, err := applyLokiCursor(tc.cursor, tc.direction, 100, 200)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatal("Expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("applyLokiCursor failed: %v", err)
+			}
+			if cursor.direction != tc.wantDirection || start != tc.wantStart || end != tc.wantEnd {
+				t.Errorf("Expected %s [%d, %d), got %s [%d, %d)", tc.wantDirection, tc.wantStart, tc.wantEnd, cursor.direction, start, end)
+			}
+		})
+	}
+}
+
+// TestNextLokiCursor verifies that the cursor points at the last entry in reading order and lists
+// the entries returned at its timestamp
+func TestNextLokiCursor(t *testing.T) {
+	a := map[string]string{"job": "a"}
+	b := map[string]string{"job": "b"}
+	result := &LokiResult{Data: LokiData{ResultType: "streams", Result: []LokiEntry{
+		{Stream: a, Values: [][]string{{"300", "c"}, {"100", "a"}}},
+		{Stream: b, Values: [][]string{{"200", "b"}, {"100", "a"}}},
+	}}}
+	idA := lokiCursorEntryID(streamKey(a), []string{"100", "a"})
+	idB := lokiCursorEntryID(streamKey(b), []string{"100", "a"})
+
+	if got, want := nextLokiCursor(result, "", lokiCursor{}), formatLokiCursor("backward", 100, map[string]bool{idA: true, idB: true}); got != want {
+		t.Errorf("Expected %s, got %q", want, got)
+	}
+	if got := nextLokiCursor(result, "forward", lokiCursor{}); !strings.HasPrefix(got, "forward:300:") {
+		t.Errorf("Expected a forward cursor at 300, got %q", got)
+	}
+
+	// Entries returned at the same timestamp by an earlier page stay in the cursor
+	previous := lokiCursor{direction: "backward", ts: 100, returned: map[string]bool{"00000000000000ff": true}}
+	parsed, err := parseLokiCursor(nextLokiCursor(result, "", previous))
+	if err != nil || len(parsed.returned) != 3 || !parsed.returned["00000000000000ff"] {
+		t.Errorf("Expected the earlier entries to be kept, got %+v (%v)", parsed, err)
+	}
+
+	// A page of entries that were all returned before moves past their timestamp
+	previous = lokiCursor{direction: "backward", ts: 100, returned: map[string]bool{idA: true, idB: true}}
+	only := &LokiResult{Data: LokiData{ResultType: "streams", Result: []LokiEntry{
+		{Stream: a, Values: [][]string{{"100", "a"}}},
+		{Stream: b, Values: [][]string{{"100", "a"}}},
+	}}}
+	if got := nextLokiCursor(only, "", previous); got != "backward:100" {
+		t.Errorf("Expected the cursor to move past 100, got %q", got)
+	}
+
+	result.Data.ResultType = "matrix"
+	if got := nextLokiCursor(result, "", lokiCursor{}); got != "" {
+		t.Errorf("Expected no cursor for metric results, got %q", got)
+	}
+}
+
+// TestSkipLokiCursorEntries verifies that only the entries listed in the cursor are dropped
+func TestSkipLokiCursorEntries(t *testing.T) {
+	a := map[string]string{"job": "a"}
+	result := &LokiResult{Data: LokiData{ResultType: "streams", Result: []LokiEntry{
+		{Stream: a, Values: [][]string{{"100", "x"}, {"100", "y"}}},
+		{Stream: map[string]string{"job": "b"}, Values: [][]string{{"100", "x"}}},
+	}}}
+	cursor := lokiCursor{direction: "backward", ts: 100, returned: map[string]bool{lokiCursorEntryID(streamKey(a), []string{"100", "x"}): true}}
+
+	kept, skipped := skipLokiCursorEntries(result, cursor)
+	if skipped != 1 || countLokiEntries(kept) != 2 {
+		t.Errorf("Expected 1 entry skipped and 2 kept, got %d and %d", skipped, countLokiEntries(kept))
+	}
+	if kept.Data.Result[0].Values[0][1] != "y" || kept.Data.Result[1].Stream["job"] != "b" {
+		t.Errorf("Unexpected entries kept: %+v", kept.Data.Result)
+	}
+	if countLokiEntries(result) != 3 {
+		t.Error("Expected the original result to be left unchanged")
+	}
+}
+
+// TestHandleLokiQueryProtocol_Pagination pages through a fake Loki until the cursor is omitted,
+// checking that every entry is returned exactly once
+func TestHandleLokiQueryProtocol_Pagination(t *testing.T) {
+	// Entries one second apart, spread over three streams, some of which log at the same
+	// nanosecond so that pages end in the middle of a timestamp
+	const base = int64(1705312200000000000)
+	type logEntry struct {
+		ts  int64
+		job string
+	}
+	var entries []logEntry
+	for i, streams := range []int{1, 2, 1, 3, 2, 1, 2} {
+		for j := 0; j < streams; j++ {
+			entries = append(entries, logEntry{ts: base + int64(i)*1000000000, job: fmt.Sprintf("job%d", j)})
+		}
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		start, _ := strconv.ParseInt(q.Get("start"), 10, 64)
+		end, _ := strconv.ParseInt(q.Get("end"), 10, 64)
+		limit, _ := strconv.Atoi(q.Get("limit"))
+
+		var matched []logEntry
+		for _, entry := range entries {
+			if entry.ts >= start && entry.ts < end {
+				matched = append(matched, entry)
+			}
+		}
+		if q.Get("direction") != "forward" {
+			sort.SliceStable(matched, func(i, j int) bool { return matched[i].ts > matched[j].ts })
+		}
+		if len(matched) > limit {
+			matched = matched[:limit]
+		}
+
+		streams := map[string][][]string{}
+		for _, entry := range matched {
+			streams[entry.job] = append(streams[entry.job], []string{strconv.FormatInt(entry.ts, 10), "line"})
+		}
+		var result []LokiEntry
+		for job, values := range streams {
+			result = append(result, LokiEntry{Stream: map[string]string{"job": job}, Values: values})
+		}
+		json.NewEncoder(w).Encode(LokiResult{Status: "success", Data: LokiData{ResultType: "streams", Result: result}})
+	}))
+	defer server.Close()
+
+	for _, env := range []string{EnvLokiURL, EnvLokiOrgID, EnvLokiUsername, EnvLokiPassword, EnvLokiToken, EnvLokiMaxLimit, EnvLokiDefaultLimit, EnvLokiTimezone} {
+		t.Setenv(env, "")
+	}
+
+	if _, err := NewLokiQueryToolProtocol(); err != nil {
+		t.Fatalf("Failed to create tool: %v", err)
+	}
+
+	for _, direction := range []string{"backward", "forward"} {
+		t.Run(direction, func(t *testing.T) {
+			seen := map[string]bool{}
+			cursor := ""
+			for page := 0; page < 10; page++ {
+				args := map[string]any{
+					"query":     `{job=~"job.*"}`,
+					"url":       server.URL,
+					"start":     "2024-01-15T09:50:00Z",
+					"end":       "2024-01-15T09:51:00Z",
+					"limit":     3,
+					"direction": direction,
+					"format":    "json",
+				}
+				if cursor != "" {
+					args["cursor"] = cursor
+				}
+				raw, _ := json.Marshal(args)
+				result, err := HandleLokiQueryProtocol(context.Background(), &protocol.CallToolRequest{Name: "loki_query", RawArguments: raw})
+				if err != nil {
+					t.Fatalf("HandleLokiQueryProtocol failed on page %d: %v", page, err)
+				}
+
+				var parsed LokiResult
+				if err := json.Unmarshal([]byte(result.Content[0].(*protocol.TextContent).Text), &parsed); err != nil {
+					t.Fatalf("Failed to parse results: %v", err)
+				}
+				for _, entry := range parsed.Data.Result {
+					for _, value := range entry.Values {
+						id := entry.Stream["job"] + "@" + value[0]
+						if seen[id] {
+							t.Errorf("Entry %s returned twice", id)
+						}
+						seen[id] = true
+					}
+				}
+
+				var metadata LokiQueryMetadata
+				if err := json.Unmarshal([]byte(result.Content[1].(*protocol.TextContent).Text), &metadata); err != nil {
+					t.Fatalf("Failed to parse metadata: %v", err)
+				}
+				if metadata.Cursor == "" {
+					break
+				}
+				cursor = metadata.Cursor
+			}
+
+			if len(seen) != len(entries) {
+				t.Errorf("Expected all %d entries across pages, got %d", len(entries), len(seen))
+			}
+		})
+	}
+}
@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// decodeLokiQueryStream decodes a query_range response as it is read from r, one stream at a
+// time, so that a large body is never held in memory next to the result decoded from it. Metric
+// queries such as count_over_time return a matrix or vector, which is kept in the Metric field.
+func decodeLokiQueryStream(r io.Reader) (*LokiResult, error) {
+	dec := json.NewDecoder(r)
+	var result LokiResult
+	var metric *LokiMetricResult
+	err := decodeLokiObject(dec, func(key string) error {
+		switch key {
+		case "status":
+			return dec.Decode(&result.Status)
+		case "error":
+			return dec.Decode(&result.Error)
+		case "warnings":
+			return dec.Decode(&result.Warnings)
+		case "data":
+			return decodeLokiQueryData(dec, &result, &metric)
+		default:
+			return dec.Decode(new(json.RawMessage))
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Check for Loki errors
+	if result.Status == "error" {
+		return nil, fmt.Errorf("loki error: %s", result.Error)
+	}
+
+	if metric != nil {
+		metric.Status, metric.Warnings = result.Status, result.Warnings
+		metric.Data.ResultType, metric.Data.Stats = result.Data.ResultType, result.Data.Stats
+		result.Metric = metric
+	}
+	return &result, nil
+}
+
+// decodeLokiQueryData decodes the data object of a query_range response, decoding log streams one
+// at a time and the series of a metric result into metric
+func decodeLokiQueryData(dec *json.Decoder, result *LokiResult, metric **LokiMetricResult) error {
+	// Loki writes resultType before result; a result that comes first is kept until it is known
+	var pending json.RawMessage
+	err := decodeLokiObject(dec, func(key string) error {
+		switch key {
+		case "resultType":
+			return dec.Decode(&result.Data.ResultType)
+		case "stats":
+			return dec.Decode(&result.Data.Stats)
+		case "result":
+			switch result.Data.ResultType {
+			case "streams":
+				return decodeLokiStreams(dec, result)
+			case "matrix", "vector":
+				*metric = &LokiMetricResult{}
+				return dec.Decode(&(*metric).Data.Result)
+			default:
+				return dec.Decode(&pending)
+			}
+		default:
+			return dec.Decode(new(json.RawMessage))
+		}
+	})
+	if err != nil || pending == nil {
+		return err
+	}
+
+	if result.Data.ResultType == "matrix" || result.Data.ResultType == "vector" {
+		*metric = &LokiMetricResult{}
+		return json.Unmarshal(pending, &(*metric).Data.Result)
+	}
+	return json.Unmarshal(pending, &result.Data.Result)
+}
+
+// decodeLokiStreams decodes the streams of a log result one at a time
+func decodeLokiStreams(dec *json.Decoder, result *LokiResult) error {
+	tok, err := dec.Token()
+	if err != nil || tok == nil {
+		return err
+	}
+	if delim, ok := tok.(json.Delim); !ok || delim != '[' {
+		return fmt.Errorf("invalid Loki response: expected an array of streams, got %v", tok)
+	}
+	for dec.More() {
+		var entry LokiEntry
+		if err := dec.Decode(&entry); err != nil {
+			return err
+		}
+		result.Data.Result = append(result.Data.Result, entry)
+	}
+	_, err = dec.Token()
+	return err
+}
+
+// decodeLokiObject reads a JSON object from dec, calling field with each key to decode its value.
+// A null value is treated as an empty object.
+func decodeLokiObject(dec *json.Decoder, field func(key string) error) error {
+	tok, err := dec.Token()
+	if err != nil || tok == nil {
+		return err
+	}
+	if delim, ok := tok.(json.Delim); !ok || delim != '{' {
+		return fmt.Errorf("invalid Loki response: expected an object, got %v", tok)
+	}
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		key, _ := tok.(string)
+		if err := field(key); err != nil {
+			return err
+		}
+	}
+	_, err = dec.Token()
+	return err
+}
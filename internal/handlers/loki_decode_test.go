@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestDecodeLokiQueryStream verifies log, metric and error responses, whatever the key order
+func TestDecodeLokiQueryStream(t *testing.T) {
+	result, err := decodeLokiQueryStream(strings.NewReader(`{"status":"success","warnings":["partial"],"data":{"resultType":"streams","result":[
+		{"stream":{"job":"a"},"values":[["2","two"],["1","one"]]},
+		{"stream":{"job":"b"},"values":[["3","three"]]}],"stats":{"summary":{"totalLinesProcessed":3}}},"extra":{"ignored":[1,2]}}`))
+	if err != nil {
+		t.Fatalf("decodeLokiQueryStream failed: %v", err)
+	}
+	if result.Status != "success" || len(result.Warnings) != 1 || len(result.Data.Result) != 2 || result.Metric != nil {
+		t.Fatalf("Unexpected result %+v", result)
+	}
+	if result.Data.Result[0].Values[1][1] != "one" || result.Data.Result[1].Stream["job"] != "b" || len(result.Data.Stats) == 0 {
+		t.Errorf("Unexpected streams %+v", result.Data)
+	}
+
+	// A result written before its resultType is decoded once the type is known
+	result, err = decodeLokiQueryStream(strings.NewReader(`{"data":{"result":[{"metric":{"level":"error"},"value":[1705312800,"7"]}],"resultType":"vector"},"status":"success"}`))
+	if err != nil {
+		t.Fatalf("decodeLokiQueryStream failed: %v", err)
+	}
+	if result.Metric == nil || result.Data.ResultType != "vector" || result.Metric.Data.Result[0].Value.Value != "7" || result.Metric.Status != "success" {
+		t.Errorf("Unexpected metric result %+v", result)
+	}
+
+	result, err = decodeLokiQueryStream(strings.NewReader(`{"status":"success","data":{"resultType":"streams","result":null}}`))
+	if err != nil || result.Data.Result != nil {
+		t.Errorf("Expected an empty result, got %+v, %v", result, err)
+	}
+
+	if _, err := decodeLokiQueryStream(strings.NewReader(`{"status":"error","error":"boom"}`)); err == nil || err.Error() != "loki error: boom" {
+		t.Errorf("Expected loki error, got %v", err)
+	}
+	for _, body := range []string{`{"status":"success","data":{"resultType":"streams","result":[{"stream":`, `[]`, `{"data":{"resultType":"streams","result":{}}}`} {
+		if _, err := decodeLokiQueryStream(strings.NewReader(body)); err == nil {
+			t.Errorf("Expected error for %s", body)
+		}
+	}
+}
+
+// TestExecuteLokiQuery_StreamedGzip verifies that a large gzipped response is decoded as it is
+// read, and that LOKI_MAX_RESPONSE_BYTES still bounds it
+func TestExecuteLokiQuery_StreamedGzip(t *testing.T) {
+	var body bytes.Buffer
+	body.WriteString(`{"status":"success","data":{"resultType":"streams","result":[`)
+	for i := 0; i < 2000; i++ {
+		if i > 0 {
+			body.WriteString(",")
+		}
+		fmt.Fprintf(&body, `{"stream":{"pod":"p%d"},"values":[["%d","%s"]]}`, i, i+1, strings.Repeat("x", 100))
+	}
+	body.WriteString(`]}}`)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Encoding", "gzip")
+		gz := gzip.NewWriter(w)
+		gz.Write(body.Bytes())
+		gz.Close()
+	}))
+	defer server.Close()
+
+	result, err := executeLokiQuery(context.Background(), server.URL, "", "", "", "")
+	if err != nil {
+		t.Fatalf("executeLokiQuery failed: %v", err)
+	}
+	if len(result.Data.Result) != 2000 || result.Data.Result[1999].Stream["pod"] != "p1999" {
+		t.Errorf("Expected all 2000 streams, got %d", len(result.Data.Result))
+	}
+
+	t.Setenv(EnvLokiMaxResponseBytes, "64KiB")
+	_, err = executeLokiQuery(context.Background(), server.URL, "", "", "", "")
+	var tooLarge *LokiResponseTooLargeError
+	if !errors.As(err, &tooLarge) {
+		t.Errorf("Expected LokiResponseTooLargeError, got %v", err)
+	}
+}
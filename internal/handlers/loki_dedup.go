@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// lokiDedupFormats lists the formats that can show collapsed lines; the others must stay faithful
+// to Loki's data or parse each line, which the repeat annotation would break
+var lokiDedupFormats = []string{"raw", "text", "color", "markdown"}
+
+// checkLokiDedup reports an error when dedup is requested with an output it cannot annotate
+func checkLokiDedup(dedup bool, format string, fields []string, summarize bool) error {
+	if !dedup {
+		return nil
+	}
+	if len(fields) > 0 || summarize {
+		return fmt.Errorf("dedup cannot be combined with fields or summarize")
+	}
+	if !slices.Contains(lokiDedupFormats, format) {
+		return fmt.Errorf("dedup is not supported with format %s, supported formats: %s", format, strings.Join(lokiDedupFormats, ", "))
+	}
+	return nil
+}
+
+// dedupLokiResult returns a copy of result in which consecutive identical lines of a stream are
+// collapsed into the first occurrence, annotated with the repeat count and the time of the last
+// occurrence, like syslog's "last message repeated" messages
+func dedupLokiResult(result *LokiResult) *LokiResult {
+	deduped := &LokiResult{Status: result.Status, Error: result.Error}
+	deduped.Data.ResultType = result.Data.ResultType
+	deduped.Data.Stats = result.Data.Stats
+	deduped.Data.Result = make([]LokiEntry, len(result.Data.Result))
+
+	for i, entry := range result.Data.Result {
+		var values [][]string
+		for j := 0; j < len(entry.Values); {
+			val := entry.Values[j]
+			k := j + 1
+			for len(val) >= 2 && k < len(entry.Values) && len(entry.Values[k]) >= 2 && entry.Values[k][1] == val[1] {
+				k++
+			}
+
+			if repeats := k - j; repeats > 1 {
+				last := entry.Values[k-1][0]
+				if ts, err := strconv.ParseFloat(last, 64); err == nil {
+					last = time.Unix(0, int64(ts)).Format(time.RFC3339)
+				}
+				val = []string{val[0], fmt.Sprintf("%s (x%d, last at %s)", val[1], repeats, last)}
+			}
+			values = append(values, val)
+			j = k
+		}
+		deduped.Data.Result[i] = LokiEntry{Stream: entry.Stream, Values: values}
+	}
+	return deduped
+}
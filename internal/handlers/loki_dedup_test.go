@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestDedupLokiResult verifies that only consecutive identical lines of a stream are collapsed
+func TestDedupLokiResult(t *testing.T) {
+	result := &LokiResult{
+		Status: "success",
+		Data: LokiData{
+			ResultType: "streams",
+			Result: []LokiEntry{
+				{
+					Stream: map[string]string{"app": "api"},
+					Values: [][]string{
+						{"1705312245000000000", "connection refused"},
+						{"1705312246000000000", "connection refused"},
+						{"1705312247000000000", "connection refused"},
+						{"1705312248000000000", "retrying"},
+						{"1705312249000000000", "connection refused"},
+					},
+				},
+				{
+					Stream: map[string]string{"app": "worker"},
+					Values: [][]string{{"1705312250000000000", "connection refused"}},
+				},
+			},
+		},
+	}
+
+	deduped := dedupLokiResult(result)
+
+	api := deduped.Data.Result[0].Values
+	if len(api) != 3 {
+		t.Fatalf("Expected 3 entries after dedup, got %d: %v", len(api), api)
+	}
+	last := time.Unix(0, 1705312247000000000).Format(time.RFC3339)
+	if api[0][0] != "1705312245000000000" || api[0][1] != "connection refused (x3, last at "+last+")" {
+		t.Errorf("Unexpected collapsed entry %v", api[0])
+	}
+	if api[1][1] != "retrying" || api[2][1] != "connection refused" {
+		t.Errorf("Expected non-consecutive repeats to be kept, got %v", api[1:])
+	}
+	if worker := deduped.Data.Result[1].Values; len(worker) != 1 || worker[0][1] != "connection refused" {
+		t.Errorf("Expected other streams to be deduplicated separately, got %v", worker)
+	}
+	if len(result.Data.Result[0].Values) != 5 {
+		t.Error("Expected the original result to be left unchanged")
+	}
+}
+
+// TestCheckLokiDedup verifies that dedup is refused where the annotation would corrupt the output
+func TestCheckLokiDedup(t *testing.T) {
+	for _, format := range lokiDedupFormats {
+		if err := checkLokiDedup(true, format, nil, false); err != nil {
+			t.Errorf("Expected dedup to be accepted with format %s: %v", format, err)
+		}
+	}
+	for _, format := range []string{"json", "push", "logfmt", "signatures"} {
+		if err := checkLokiDedup(true, format, nil, false); err == nil {
+			t.Errorf("Expected an error for format %s", format)
+		}
+	}
+	if err := checkLokiDedup(true, "raw", []string{"msg"}, false); err == nil {
+		t.Error("Expected an error with fields")
+	}
+	if err := checkLokiDedup(false, "json", nil, false); err != nil {
+		t.Errorf("Expected no error without dedup: %v", err)
+	}
+}
+
+// TestFormatLokiResults_Dedup verifies the annotation in the text output
+func TestFormatLokiResults_Dedup(t *testing.T) {
+	result := &LokiResult{Status: "success", Data: LokiData{ResultType: "streams", Result: []LokiEntry{{
+		Stream: map[string]string{"app": "api"},
+		Values: [][]string{{"1705312245000000000", "tick"}, {"1705312246000000000", "tick"}},
+	}}}}
+
+	output, err := formatLokiResults(dedupLokiResult(result), "text")
+	if err != nil {
+		t.Fatalf("formatLokiResults failed: %v", err)
+	}
+	if !strings.Contains(output, "] tick (x2, last at ") || strings.Count(output, "tick") != 1 {
+		t.Errorf("Unexpected output:\n%s", output)
+	}
+}
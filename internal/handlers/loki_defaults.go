@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+)
+
+// Environment variable name for JSON-encoded Loki defaults
+const EnvLokiDefaults = "LOKI_DEFAULTS"
+
+// LokiDefaults holds operator-supplied defaults applied beneath per-request arguments.
+// Precedence is: request argument > individual env var (LOKI_URL, LOKI_ORG_ID, ...) > LOKI_DEFAULTS > built-in default.
+type LokiDefaults struct {
+	URL     string            `json:"url,omitempty"`
+	Org     string            `json:"org,omitempty"`
+	Limit   int               `json:"limit,omitempty"`
+	Format  string            `json:"format,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Params  map[string]string `json:"params,omitempty"`
+}
+
+// activeLokiDefaults holds the defaults loaded by LoadLokiDefaults
+var activeLokiDefaults = &LokiDefaults{}
+
+// LoadLokiDefaults parses and validates the LOKI_DEFAULTS environment variable and makes
+// the result available to the tool handlers. It should be called once at startup.
+func LoadLokiDefaults() (*LokiDefaults, error) {
+	defaults, err := parseLokiDefaults(os.Getenv(EnvLokiDefaults))
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %v", EnvLokiDefaults, err)
+	}
+	activeLokiDefaults = defaults
+	return defaults, nil
+}
+
+// parseLokiDefaults decodes and validates a LOKI_DEFAULTS JSON object
+func parseLokiDefaults(raw string) (*LokiDefaults, error) {
+	defaults := &LokiDefaults{}
+	if strings.TrimSpace(raw) == "" {
+		return defaults, nil
+	}
+
+	decoder := json.NewDecoder(strings.NewReader(raw))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(defaults); err != nil {
+		return nil, fmt.Errorf("malformed JSON: %v", err)
+	}
+
+	if defaults.URL != "" {
+		u, err := url.Parse(defaults.URL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid url: %v", err)
+		}
+		if u.Scheme != "http" && u.Scheme != "https" {
+			return nil, fmt.Errorf("invalid url %q: scheme must be http or https", defaults.URL)
+		}
+	}
+	if defaults.Limit < 0 {
+		return nil, fmt.Errorf("limit must not be negative, got %d", defaults.Limit)
+	}
+	if defaults.Format != "" && !slices.Contains(lokiQueryFormats, defaults.Format) {
+		return nil, fmt.Errorf("unsupported format %q, supported formats: %s", defaults.Format, strings.Join(lokiQueryFormats, ", "))
+	}
+	if defaults.Format == "color" {
+		return nil, fmt.Errorf("format color must be requested per call, so that clients which cannot display ANSI escapes never receive them")
+	}
+	for name := range defaults.Headers {
+		if strings.TrimSpace(name) == "" {
+			return nil, fmt.Errorf("header names must not be empty")
+		}
+	}
+	for name := range defaults.Params {
+		if strings.TrimSpace(name) == "" {
+			return nil, fmt.Errorf("param names must not be empty")
+		}
+	}
+
+	return defaults, nil
+}
+
+// urlOr returns the default URL, or fallback when none is configured
+func (d *LokiDefaults) urlOr(fallback string) string {
+	if d.URL != "" {
+		return d.URL
+	}
+	return fallback
+}
+
+// limitOr returns the default limit, or fallback when none is configured
+func (d *LokiDefaults) limitOr(fallback int) int {
+	if d.Limit > 0 {
+		return d.Limit
+	}
+	return fallback
+}
+
+// formatOr returns the default format if it is one of the allowed formats, otherwise fallback
+func (d *LokiDefaults) formatOr(fallback string, allowed []string) string {
+	if d.Format != "" && slices.Contains(allowed, d.Format) {
+		return d.Format
+	}
+	return fallback
+}
+
+// applyLokiDefaults adds the default headers and extra query params to an outgoing
+// Loki request without overriding values that are already set
+func applyLokiDefaults(req *http.Request) {
+	defaults := activeLokiDefaults
+
+	for name, value := range defaults.Headers {
+		if req.Header.Get(name) == "" {
+			req.Header.Set(name, value)
+		}
+	}
+
+	if len(defaults.Params) > 0 {
+		q := req.URL.Query()
+		for name, value := range defaults.Params {
+			if !q.Has(name) {
+				q.Set(name, value)
+			}
+		}
+		req.URL.RawQuery = q.Encode()
+	}
+}
@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/ThinkInAIXYZ/go-mcp/protocol"
+)
+
+// TestParseLokiDefaults verifies parsing and validation of the LOKI_DEFAULTS JSON
+func TestParseLokiDefaults(t *testing.T) {
+	testCases := []struct {
+		name    string
+		raw     string
+		wantErr bool
+	}{
+		{name: "Empty", raw: ""},
+		{name: "Full", raw: `{"url":"https://loki.example.com","org":"tenant-1","limit":50,"format":"json","headers":{"X-Api-Key":"k"},"params":{"direction":"forward"}}`},
+		{name: "Malformed JSON", raw: `{"url":`, wantErr: true},
+		{name: "Unknown field", raw: `{"uri":"http://loki:3100"}`, wantErr: true},
+		{name: "Bad scheme", raw: `{"url":"ftp://loki:3100"}`, wantErr: true},
+		{name: "Negative limit", raw: `{"limit":-1}`, wantErr: true},
+		{name: "Unsupported format", raw: `{"format":"yaml"}`, wantErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := parseLokiDefaults(tc.raw)
+			if tc.wantErr && err == nil {
+				t.Errorf("Expected error for %q, got nil", tc.raw)
+			}
+			if !tc.wantErr && err != nil {
+				t.Errorf("Unexpected error for %q: %v", tc.raw, err)
+			}
+		})
+	}
+}
+
+// TestLokiDefaults_MergedUnderRequestOverrides verifies that LOKI_DEFAULTS values are used
+// when the request omits them and that request arguments take precedence
+func TestLokiDefaults_MergedUnderRequestOverrides(t *testing.T) {
+	var lastRequest *http.Request
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lastRequest = r
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"status":"success","data":{"resultType":"streams","result":[{"stream":{"job":"x"},"values":[["1705312245000000000","hello"]]}]}}`))
+	}))
+	defer server.Close()
+
+	for _, env := range []string{EnvLokiURL, EnvLokiOrgID, EnvLokiUsername, EnvLokiPassword, EnvLokiToken} {
+		t.Setenv(env, "")
+	}
+
+	previous := activeLokiDefaults
+	defer func() { activeLokiDefaults = previous }()
+	activeLokiDefaults = &LokiDefaults{
+		URL:     server.URL,
+		Org:     "tenant-default",
+		Limit:   7,
+		Format:  "json",
+		Headers: map[string]string{"X-Api-Key": "secret"},
+		Params:  map[string]string{"direction": "forward"},
+	}
+
+	if _, err := NewLokiQueryToolProtocol(); err != nil {
+		t.Fatalf("Failed to create tool: %v", err)
+	}
+
+	call := func(args map[string]any) string {
+		t.Helper()
+		raw, _ := json.Marshal(args)
+		result, err := HandleLokiQueryProtocol(context.Background(), &protocol.CallToolRequest{Name: "loki_query", RawArguments: raw})
+		if err != nil {
+			t.Fatalf("HandleLokiQueryProtocol failed: %v", err)
+		}
+		return result.Content[0].(*protocol.TextContent).Text
+	}
+
+	// Defaults only
+	output := call(map[string]any{"query": `{job="x"}`})
+	query := lastRequest.URL.Query()
+	if got := lastRequest.Header.Get("X-Scope-OrgID"); got != "tenant-default" {
+		t.Errorf("Expected default org header, got %q", got)
+	}
+	if got := lastRequest.Header.Get("X-Api-Key"); got != "secret" {
+		t.Errorf("Expected default header X-Api-Key, got %q", got)
+	}
+	if got := query.Get("limit"); got != "7" {
+		t.Errorf("Expected default limit 7, got %q", got)
+	}
+	if got := query.Get("direction"); got != "forward" {
+		t.Errorf("Expected default param direction=forward, got %q", got)
+	}
+	if !strings.HasPrefix(strings.TrimSpace(output), "{") {
+		t.Errorf("Expected default json format, got:\n%s", output)
+	}
+
+	// Request overrides
+	output = call(map[string]any{"query": `{job="x"}`, "org": "tenant-request", "limit": 3, "format": "raw"})
+	query = lastRequest.URL.Query()
+	if got := lastRequest.Header.Get("X-Scope-OrgID"); got != "tenant-request" {
+		t.Errorf("Expected request org header to override default, got %q", got)
+	}
+	if got := query.Get("limit"); got != "3" {
+		t.Errorf("Expected request limit 3 to override default, got %q", got)
+	}
+	if strings.HasPrefix(strings.TrimSpace(output), "{") || !strings.Contains(output, "hello") {
+		t.Errorf("Expected raw format output, got:\n%s", output)
+	}
+}
+
+// TestApplyLokiDefaults_DoesNotOverride verifies that default headers and params never clobber existing values
+func TestApplyLokiDefaults_DoesNotOverride(t *testing.T) {
+	previous := activeLokiDefaults
+	defer func() { activeLokiDefaults = previous }()
+	activeLokiDefaults = &LokiDefaults{
+		Headers: map[string]string{"X-Scope-OrgID": "default-org"},
+		Params:  map[string]string{"limit": "999"},
+	}
+
+	u, _ := url.Parse("http://localhost:3100/loki/api/v1/query_range?limit=10")
+	req := &http.Request{URL: u, Header: http.Header{}}
+	req.Header.Set("X-Scope-OrgID", "explicit-org")
+
+	applyLokiDefaults(req)
+
+	if got := req.Header.Get("X-Scope-OrgID"); got != "explicit-org" {
+		t.Errorf("Expected existing header to be preserved, got %q", got)
+	}
+	if got := req.URL.Query().Get("limit"); got != "10" {
+		t.Errorf("Expected existing param to be preserved, got %q", got)
+	}
+}
@@ -0,0 +1,299 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ThinkInAIXYZ/go-mcp/protocol"
+)
+
+// Environment variable name for enabling the loki_delete tool, which deletes logs from Loki
+const EnvLokiAllowDelete = "LOKI_ALLOW_DELETE"
+
+// lokiDeleteFormats lists the output formats of loki_delete
+var lokiDeleteFormats = []string{"json", "text"}
+
+// LokiDeleteRequest represents the arguments for loki_delete tool
+type LokiDeleteRequest struct {
+	Action   string            `json:"action,omitempty" description:"submit to request the deletion of the log lines matching query between start and end, or list to show the delete requests of the tenant (default: submit)"`
+	Query    string            `json:"query,omitempty" description:"LogQL log query selecting the lines to delete, e.g. {job=\"api\"} |= \"password\"; required to submit"`
+	Start    string            `json:"start,omitempty" description:"Start of the time range to delete; required to submit"`
+	End      string            `json:"end,omitempty" description:"End of the time range to delete; required to submit"`
+	Timezone string            `json:"timezone,omitempty" description:"IANA timezone for start and end times without a zone, e.g. America/New_York (default: LOKI_TIMEZONE or UTC)"`
+	URL      string            `json:"url,omitempty" description:"Loki server URL"`
+	Backend  string            `json:"backend,omitempty" description:"Name of a Loki backend from LOKI_BACKENDS, e.g. prod, whose URL and credentials to use; cannot be combined with url, and an explicit credential still wins"`
+	Username string            `json:"username,omitempty" description:"Username for basic authentication"`
+	Password string            `json:"password,omitempty" description:"Password for basic authentication"`
+	Token    string            `json:"token,omitempty" description:"Bearer token for authentication"`
+	Org      string            `json:"org,omitempty" description:"Organization ID whose logs to delete; a single tenant"`
+	Headers  map[string]string `json:"headers,omitempty" description:"Extra HTTP headers to send to Loki, e.g. {\"X-Api-Key\": \"...\"}; never replaces the auth or org headers"`
+	Timeout  string            `json:"timeout,omitempty" description:"Timeout for the Loki request as a duration (e.g. 45s) or seconds (default: LOKI_QUERY_TIMEOUT or 30s)"`
+	Format   string            `json:"format,omitempty" description:"Output format: json or text (default: json)"`
+}
+
+// LokiDeletion represents a delete request as listed by Loki's /loki/api/v1/delete endpoint.
+// Times are Unix seconds.
+type LokiDeletion struct {
+	RequestID string  `json:"request_id"`
+	StartTime float64 `json:"start_time"`
+	EndTime   float64 `json:"end_time"`
+	Query     string  `json:"query"`
+	Status    string  `json:"status"`
+	CreatedAt float64 `json:"created_at"`
+}
+
+// NewLokiDeleteToolProtocol creates a tool using the protocol library
+func NewLokiDeleteToolProtocol() (*protocol.Tool, error) {
+	return protocol.NewTool("loki_delete", "DESTRUCTIVE: permanently delete log lines from Grafana Loki. With action submit, asks Loki to delete every line matching a log query between start and end and returns the delete request ID; once Loki processes the request the lines cannot be recovered. With action list, shows the tenant's delete requests and their status. Only submit a deletion when the user explicitly asked for it, and check the query and range with loki_query first", LokiDeleteRequest{})
+}
+
+// LokiDeleteEnabled reports whether LOKI_ALLOW_DELETE enables the loki_delete tool
+func LokiDeleteEnabled() (bool, error) {
+	value := os.Getenv(EnvLokiAllowDelete)
+	if value == "" {
+		return false, nil
+	}
+	enabled, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("invalid %s: %q must be true or false", EnvLokiAllowDelete, value)
+	}
+	return enabled, nil
+}
+
+// HandleLokiDeleteProtocol handles Loki delete tool requests using protocol library
+func HandleLokiDeleteProtocol(ctx context.Context, request *protocol.CallToolRequest) (*protocol.CallToolResult, error) {
+	req := new(LokiDeleteRequest)
+	if err := protocol.VerifyAndUnmarshal(request.RawArguments, req); err != nil {
+		return nil, err
+	}
+
+	// The tool is only registered with LOKI_ALLOW_DELETE, but check again since it deletes data
+	enabled, err := LokiDeleteEnabled()
+	if err != nil {
+		return nil, err
+	}
+	if !enabled {
+		return nil, fmt.Errorf("loki_delete is disabled: set %s=true to allow deleting logs", EnvLokiAllowDelete)
+	}
+
+	action := valueOrDefault(req.Action, "submit")
+	if action != "submit" && action != "list" {
+		return nil, fmt.Errorf("unsupported action: %s. Supported actions: submit, list", action)
+	}
+	format := valueOrDefault(req.Format, "json")
+	if !slices.Contains(lokiDeleteFormats, format) {
+		return nil, fmt.Errorf("unsupported format: %s. Supported formats: %s", format, strings.Join(lokiDeleteFormats, ", "))
+	}
+
+	ctx, conn, err := resolveLokiCall(ctx, req.Backend, req.URL, req.Username, req.Password, req.Token, req.Org, req.Timeout, req.Headers)
+	if err != nil {
+		return nil, err
+	}
+	lokiURL, username, password, token, orgID := conn.URL, conn.Username, conn.Password, conn.Token, conn.OrgID
+
+	// Deletions apply to one tenant; Loki does not federate them
+	if strings.Contains(lokiOrgIDHeader(orgID), "|") {
+		return nil, fmt.Errorf("loki_delete works on a single tenant, got org %q", orgID)
+	}
+
+	var output any
+	if action == "list" {
+		listURL, err := buildLokiDeleteURL(lokiURL, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to build delete URL: %v", err)
+		}
+		deletions, err := listLokiDeletions(ctx, listURL, username, password, token, orgID)
+		if err != nil {
+			return nil, fmt.Errorf("listing delete requests failed: %v", err)
+		}
+		output = deletions
+	} else {
+		deletion, err := submitLokiDeletion(ctx, req, lokiURL, username, password, token, orgID)
+		if err != nil {
+			return nil, err
+		}
+		output = deletion
+	}
+
+	formattedResult, err := formatLokiDeletions(output, format)
+	if err != nil {
+		return nil, fmt.Errorf("failed to format results: %v", err)
+	}
+
+	return &protocol.CallToolResult{
+		Content: []protocol.Content{
+			&protocol.TextContent{
+				Type: "text",
+				Text: formattedResult,
+			},
+		},
+	}, nil
+}
+
+// submitLokiDeletion asks Loki to delete the lines selected by the request. Loki answers the
+// request without its ID, so the delete requests are listed afterwards to find it: the newest one
+// with the same query and range. When none is found, the deletion is returned without an ID.
+func submitLokiDeletion(ctx context.Context, req *LokiDeleteRequest, lokiURL, username, password, token, orgID string) (*LokiDeletion, error) {
+	if req.Query == "" || req.Start == "" || req.End == "" {
+		return nil, fmt.Errorf("query, start and end are required to submit a deletion, so that a default range never deletes logs by accident")
+	}
+	if err := validateLogQL(req.Query); err != nil {
+		return nil, err
+	}
+	if open := findLogQLSelector(req.Query); open < 0 || strings.TrimSpace(req.Query[:open]) != "" {
+		return nil, fmt.Errorf("loki_delete needs a log query, not a metric query")
+	}
+
+	loc, err := resolveLokiTimezone(req.Timezone)
+	if err != nil {
+		return nil, err
+	}
+	start, err := parseTime(req.Start, loc)
+	if err != nil {
+		return nil, fmt.Errorf("invalid start time: %v", err)
+	}
+	end, err := parseEndTime(req.End, loc)
+	if err != nil {
+		return nil, fmt.Errorf("invalid end time: %v", err)
+	}
+	if !start.Before(end) {
+		return nil, fmt.Errorf("start time %s must be before end time %s", start.Format(time.RFC3339), end.Format(time.RFC3339))
+	}
+
+	params := url.Values{}
+	params.Set("query", req.Query)
+	params.Set("start", lokiDeleteTime(start))
+	params.Set("end", lokiDeleteTime(end))
+	deleteURL, err := buildLokiDeleteURL(lokiURL, params)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build delete URL: %v", err)
+	}
+	if _, err := doLokiRequest(withLokiMethod(ctx, http.MethodPost), deleteURL, username, password, token, orgID); err != nil {
+		return nil, fmt.Errorf("delete request failed: %v", err)
+	}
+
+	deletion := &LokiDeletion{
+		Query:     req.Query,
+		StartTime: float64(start.UnixMilli()) / 1000,
+		EndTime:   float64(end.UnixMilli()) / 1000,
+		Status:    "received",
+	}
+	listURL, err := buildLokiDeleteURL(lokiURL, nil)
+	if err != nil {
+		return deletion, nil
+	}
+	deletions, err := listLokiDeletions(ctx, listURL, username, password, token, orgID)
+	if err != nil {
+		return deletion, nil
+	}
+	var newest *LokiDeletion
+	for i, listed := range deletions {
+		if listed.Query == req.Query && lokiDeleteMillis(listed.StartTime) == start.UnixMilli() &&
+			lokiDeleteMillis(listed.EndTime) == end.UnixMilli() && (newest == nil || listed.CreatedAt > newest.CreatedAt) {
+			newest = &deletions[i]
+		}
+	}
+	if newest == nil {
+		return deletion, nil
+	}
+	return newest, nil
+}
+
+// lokiDeleteTime renders t as the Unix seconds, with millisecond precision, that Loki's delete
+// API expects
+func lokiDeleteTime(t time.Time) string {
+	return strconv.FormatFloat(float64(t.UnixMilli())/1000, 'f', -1, 64)
+}
+
+// lokiDeleteMillis turns Unix seconds listed by Loki's delete API into milliseconds
+func lokiDeleteMillis(seconds float64) int64 {
+	return int64(math.Round(seconds * 1000))
+}
+
+// buildLokiDeleteURL constructs the Loki delete request URL
+func buildLokiDeleteURL(baseURL string, params url.Values) (string, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return "", err
+	}
+
+	// Add path for Loki delete API
+	if !strings.Contains(u.Path, "loki/api/v1") {
+		if u.Path == "" || u.Path == "/" {
+			u.Path = "/loki/api/v1/delete"
+		} else {
+			u.Path = fmt.Sprintf("%s/loki/api/v1/delete", u.Path)
+		}
+	} else {
+		// If path already contains loki/api/v1, just append delete if not present
+		if !strings.HasSuffix(u.Path, "delete") {
+			u.Path = fmt.Sprintf("%s/delete", u.Path)
+		}
+	}
+
+	u.RawQuery = params.Encode()
+	return u.String(), nil
+}
+
+// listLokiDeletions returns the delete requests of the tenant, as listed by Loki
+func listLokiDeletions(ctx context.Context, listURL string, username, password, token, orgID string) ([]LokiDeletion, error) {
+	body, err := doLokiRequest(ctx, listURL, username, password, token, orgID)
+	if err != nil {
+		return nil, err
+	}
+
+	deletions := []LokiDeletion{}
+	if err := json.Unmarshal(body, &deletions); err != nil {
+		return nil, err
+	}
+	return deletions, nil
+}
+
+// formatLokiDeletions renders a deletion or a list of deletions as indented JSON or as text
+func formatLokiDeletions(output any, format string) (string, error) {
+	if format == "json" {
+		jsonBytes, err := json.MarshalIndent(output, "", "  ")
+		if err != nil {
+			return "", fmt.Errorf("failed to marshal JSON: %v", err)
+		}
+		return string(jsonBytes), nil
+	}
+
+	var b strings.Builder
+	switch output := output.(type) {
+	case *LokiDeletion:
+		b.WriteString("Delete request submitted:\n\n")
+		if output.RequestID == "" {
+			b.WriteString("Request ID: unknown (not found among the listed delete requests; check with action list)\n")
+		} else {
+			fmt.Fprintf(&b, "Request ID: %s\n", output.RequestID)
+		}
+		fmt.Fprintf(&b, "Status:     %s\n", output.Status)
+		fmt.Fprintf(&b, "Query:      %s\n", output.Query)
+		fmt.Fprintf(&b, "Range:      %s to %s\n", formatLokiDeleteTime(output.StartTime), formatLokiDeleteTime(output.EndTime))
+	case []LokiDeletion:
+		if len(output) == 0 {
+			return "No delete requests found", nil
+		}
+		fmt.Fprintf(&b, "Found %d delete requests:\n\n", len(output))
+		for _, deletion := range output {
+			fmt.Fprintf(&b, "%s [%s] %s from %s to %s, created %s\n", deletion.RequestID, deletion.Status, deletion.Query,
+				formatLokiDeleteTime(deletion.StartTime), formatLokiDeleteTime(deletion.EndTime), formatLokiDeleteTime(deletion.CreatedAt))
+		}
+	}
+	return b.String(), nil
+}
+
+// formatLokiDeleteTime renders Unix seconds listed by Loki's delete API in RFC3339
+func formatLokiDeleteTime(seconds float64) string {
+	return time.UnixMilli(lokiDeleteMillis(seconds)).UTC().Format(time.RFC3339Nano)
+}
@@ -0,0 +1,168 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ThinkInAIXYZ/go-mcp/protocol"
+)
+
+// callLokiDelete calls the loki_delete tool with args and returns its text
+func callLokiDelete(t *testing.T, args map[string]any) (string, error) {
+	t.Helper()
+	NewLokiDeleteToolProtocol()
+	raw, _ := json.Marshal(args)
+	result, err := HandleLokiDeleteProtocol(context.Background(), &protocol.CallToolRequest{RawArguments: raw})
+	if err != nil {
+		return "", err
+	}
+	return result.Content[0].(*protocol.TextContent).Text, nil
+}
+
+// TestLokiDeleteDisabled verifies that nothing is sent to Loki without LOKI_ALLOW_DELETE
+func TestLokiDeleteDisabled(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+	}))
+	defer server.Close()
+
+	t.Setenv(EnvLokiAllowDelete, "")
+	_, err := callLokiDelete(t, map[string]any{"url": server.URL, "query": `{job="api"}`, "start": "2024-01-15T10:00:00Z", "end": "2024-01-15T11:00:00Z"})
+	if err == nil || !strings.Contains(err.Error(), EnvLokiAllowDelete) {
+		t.Errorf("Expected an error naming %s, got %v", EnvLokiAllowDelete, err)
+	}
+	if requests != 0 {
+		t.Errorf("Expected no request to Loki, got %d", requests)
+	}
+}
+
+// TestLokiDeleteSubmit verifies that a deletion is posted once and its request ID is looked up
+func TestLokiDeleteSubmit(t *testing.T) {
+	t.Setenv(EnvLokiAllowDelete, "true")
+
+	posts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/loki/api/v1/delete" || r.Header.Get("X-Scope-OrgID") != "tenant-1" {
+			t.Errorf("Unexpected request %s with org %q", r.URL.Path, r.Header.Get("X-Scope-OrgID"))
+		}
+		if r.Method == http.MethodPost {
+			posts++
+			q := r.URL.Query()
+			if q.Get("query") != `{job="api"} |= "secret"` || q.Get("start") != "1705312800" || q.Get("end") != "1705316400" {
+				t.Errorf("Unexpected delete parameters %v", q)
+			}
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		w.Write([]byte(`[
+			{"request_id":"old","start_time":1705312800,"end_time":1705316400,"query":"{job=\"api\"} |= \"secret\"","status":"processed","created_at":1705300000},
+			{"request_id":"other","start_time":1705312800,"end_time":1705316400,"query":"{job=\"web\"}","status":"received","created_at":1705400001},
+			{"request_id":"new","start_time":1705312800,"end_time":1705316400,"query":"{job=\"api\"} |= \"secret\"","status":"received","created_at":1705400000}]`))
+	}))
+	defer server.Close()
+
+	text, err := callLokiDelete(t, map[string]any{"url": server.URL, "org": "tenant-1", "query": `{job="api"} |= "secret"`,
+		"start": "2024-01-15T10:00:00Z", "end": "2024-01-15T11:00:00Z", "format": "text"})
+	if err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if posts != 1 || !strings.Contains(text, "Request ID: new") {
+		t.Errorf("Expected one post and request ID new, got %d posts: %s", posts, text)
+	}
+}
+
+// TestLokiDeleteSubmitNewestFirst verifies that the newest of several matching deletions is picked
+// whatever order Loki lists them in
+func TestLokiDeleteSubmitNewestFirst(t *testing.T) {
+	t.Setenv(EnvLokiAllowDelete, "true")
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		w.Write([]byte(`[
+			{"request_id":"new","start_time":1705312800,"end_time":1705316400,"query":"{job=\"api\"}","status":"received","created_at":1705400000},
+			{"request_id":"old","start_time":1705312800,"end_time":1705316400,"query":"{job=\"api\"}","status":"processed","created_at":1705300000}]`))
+	}))
+	defer server.Close()
+
+	text, err := callLokiDelete(t, map[string]any{"url": server.URL, "query": `{job="api"}`,
+		"start": "2024-01-15T10:00:00Z", "end": "2024-01-15T11:00:00Z", "format": "text"})
+	if err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if !strings.Contains(text, "Request ID: new") {
+		t.Errorf("Expected request ID new, got %s", text)
+	}
+}
+
+// TestLokiDeleteNotRetried verifies that a failed deletion is not sent again
+func TestLokiDeleteNotRetried(t *testing.T) {
+	t.Setenv(EnvLokiAllowDelete, "true")
+	t.Setenv(EnvLokiMaxRetries, "3")
+
+	posts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		posts++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	_, err := callLokiDelete(t, map[string]any{"url": server.URL, "query": `{job="api"}`, "start": "2024-01-15T10:00:00Z", "end": "2024-01-15T11:00:00Z"})
+	if err == nil || posts != 1 {
+		t.Errorf("Expected one failed attempt, got %d: %v", posts, err)
+	}
+}
+
+// TestLokiDeleteList verifies that delete requests are listed
+func TestLokiDeleteList(t *testing.T) {
+	t.Setenv(EnvLokiAllowDelete, "1")
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			t.Errorf("Expected GET, got %s", r.Method)
+		}
+		w.Write([]byte(`[{"request_id":"abc","start_time":1705312800,"end_time":1705316400,"query":"{job=\"api\"}","status":"received","created_at":1705400000}]`))
+	}))
+	defer server.Close()
+
+	text, err := callLokiDelete(t, map[string]any{"url": server.URL, "action": "list", "format": "text"})
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	want := `abc [received] {job="api"} from 2024-01-15T10:00:00Z to 2024-01-15T11:00:00Z`
+	if !strings.Contains(text, want) {
+		t.Errorf("Expected %q in %s", want, text)
+	}
+}
+
+// TestLokiDeleteValidation verifies that incomplete or unsafe deletions are refused before reaching Loki
+func TestLokiDeleteValidation(t *testing.T) {
+	t.Setenv(EnvLokiAllowDelete, "true")
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("Unexpected request %s %s", r.Method, r.URL)
+	}))
+	defer server.Close()
+
+	tests := map[string]map[string]any{
+		"no range":        {"query": `{job="api"}`},
+		"no end":          {"query": `{job="api"}`, "start": "2024-01-15T10:00:00Z"},
+		"metric query":    {"query": `count_over_time({job="api"}[5m])`, "start": "2024-01-15T10:00:00Z", "end": "2024-01-15T11:00:00Z"},
+		"reversed range":  {"query": `{job="api"}`, "start": "2024-01-15T11:00:00Z", "end": "2024-01-15T10:00:00Z"},
+		"several tenants": {"query": `{job="api"}`, "start": "2024-01-15T10:00:00Z", "end": "2024-01-15T11:00:00Z", "org": "a,b"},
+		"unknown action":  {"action": "cancel"},
+	}
+	for name, args := range tests {
+		args["url"] = server.URL
+		if _, err := callLokiDelete(t, args); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
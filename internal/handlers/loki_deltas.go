@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// checkLokiDeltas reports an error when showDeltas is requested with an output that is not a
+// single timeline of text lines
+func checkLokiDeltas(showDeltas bool, format, order string, fields []string, summarize bool) error {
+	if !showDeltas {
+		return nil
+	}
+	if len(fields) > 0 || summarize || format != "text" {
+		return fmt.Errorf("showDeltas is only supported with format text, without fields or summarize")
+	}
+	if order == "none" {
+		return fmt.Errorf("showDeltas needs lines ordered by time and cannot be combined with sort none")
+	}
+	return nil
+}
+
+// formatLokiDelta renders the time between two entries as +HH:MM:SS.mmm
+func formatLokiDelta(d time.Duration) string {
+	ms := d.Milliseconds()
+	return fmt.Sprintf("+%02d:%02d:%02d.%03d", ms/3600000, ms/60000%60, ms/1000%60, ms%1000)
+}
+
+// annotateLokiDeltas returns a copy of result in which each line starts with the time since the
+// entry before it in time, whichever order the lines are shown in: the line above for time_asc,
+// the line below for time_desc. The oldest entry starts the timeline at +00:00:00.000.
+func annotateLokiDeltas(result *LokiResult) *LokiResult {
+	annotated := &LokiResult{Status: result.Status, Error: result.Error, Warnings: result.Warnings}
+	annotated.Data.ResultType = result.Data.ResultType
+	annotated.Data.Stats = result.Data.Stats
+	annotated.Data.Result = make([]LokiEntry, len(result.Data.Result))
+
+	// Visit the entries from oldest to newest so that each is compared with the one before it in time
+	type position struct {
+		entry, value int
+		ts           int64
+	}
+	var positions []position
+	for i, entry := range result.Data.Result {
+		annotated.Data.Result[i] = LokiEntry{Stream: entry.Stream, Values: slices.Clone(entry.Values)}
+		for j, val := range entry.Values {
+			if len(val) < 2 {
+				continue
+			}
+			if ts, err := strconv.ParseInt(val[0], 10, 64); err == nil {
+				positions = append(positions, position{i, j, ts})
+			}
+		}
+	}
+	slices.SortStableFunc(positions, func(a, b position) int { return cmp.Compare(a.ts, b.ts) })
+
+	for k, p := range positions {
+		delta := time.Duration(0)
+		if k > 0 {
+			delta = time.Duration(p.ts - positions[k-1].ts)
+		}
+		val := annotated.Data.Result[p.entry].Values[p.value]
+		annotated.Data.Result[p.entry].Values[p.value] = []string{val[0], formatLokiDelta(delta) + " " + val[1]}
+	}
+	return annotated
+}
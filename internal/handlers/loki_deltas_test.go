@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ThinkInAIXYZ/go-mcp/protocol"
+)
+
+// TestFormatLokiDelta verifies the +HH:MM:SS.mmm rendering
+func TestFormatLokiDelta(t *testing.T) {
+	tests := map[time.Duration]string{
+		0:                                     "+00:00:00.000",
+		1234 * time.Millisecond:               "+00:00:01.234",
+		26*time.Hour + 3*time.Minute + 500000: "+26:03:00.000",
+	}
+	for d, want := range tests {
+		if got := formatLokiDelta(d); got != want {
+			t.Errorf("formatLokiDelta(%s): expected %q, got %q", d, want, got)
+		}
+	}
+}
+
+// TestAnnotateLokiDeltas verifies that deltas follow time across streams in both orders
+func TestAnnotateLokiDeltas(t *testing.T) {
+	result := &LokiResult{Data: LokiData{ResultType: "streams", Result: []LokiEntry{
+		{Stream: map[string]string{"job": "a"}, Values: [][]string{{"1000000000", "start"}}},
+		{Stream: map[string]string{"job": "b"}, Values: [][]string{{"2500000000", "slow"}, {"2600000000", "done"}}},
+	}}}
+
+	var lines []string
+	for _, entry := range annotateLokiDeltas(sortLokiResult(result, "time_asc")).Data.Result {
+		for _, val := range entry.Values {
+			lines = append(lines, val[1])
+		}
+	}
+	want := "+00:00:00.000 start|+00:00:01.500 slow|+00:00:00.100 done"
+	if got := strings.Join(lines, "|"); got != want {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+
+	lines = nil
+	for _, entry := range annotateLokiDeltas(sortLokiResult(result, "time_desc")).Data.Result {
+		for _, val := range entry.Values {
+			lines = append(lines, val[1])
+		}
+	}
+	want = "+00:00:00.100 done|+00:00:01.500 slow|+00:00:00.000 start"
+	if got := strings.Join(lines, "|"); got != want {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+	if result.Data.Result[0].Values[0][1] != "start" {
+		t.Error("Expected the original result to be left unchanged")
+	}
+}
+
+// TestHandleLokiQueryProtocol_ShowDeltas verifies the annotated text output and the rejected combinations
+func TestHandleLokiQueryProtocol_ShowDeltas(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"status":"success","data":{"resultType":"streams","result":[{"stream":{"job":"a"},"values":[["1705312802234000000","response sent"],["1705312801000000000","request received"]]}]}}`))
+	}))
+	defer server.Close()
+
+	if _, err := NewLokiQueryToolProtocol(); err != nil {
+		t.Fatalf("Failed to create tool: %v", err)
+	}
+	call := func(extra map[string]any) (*protocol.CallToolResult, error) {
+		args := map[string]any{"query": `{job="a"}`, "url": server.URL, "showDeltas": true}
+		for k, v := range extra {
+			args[k] = v
+		}
+		raw, _ := json.Marshal(args)
+		return HandleLokiQueryProtocol(context.Background(), &protocol.CallToolRequest{Name: "loki_query", RawArguments: raw})
+	}
+
+	result, err := call(map[string]any{"format": "text"})
+	if err != nil {
+		t.Fatalf("HandleLokiQueryProtocol failed: %v", err)
+	}
+	output := result.Content[0].(*protocol.TextContent).Text
+	if !strings.Contains(output, "] +00:00:00.000 request received\n") || !strings.Contains(output, "] +00:00:01.234 response sent\n") {
+		t.Errorf("Expected lines annotated with deltas, got:\n%s", output)
+	}
+
+	for _, extra := range []map[string]any{{"format": "raw"}, {"format": "text", "sort": "none"}} {
+		if _, err := call(extra); err == nil || !strings.Contains(err.Error(), "showDeltas") {
+			t.Errorf("Expected showDeltas with %v to be rejected, got %v", extra, err)
+		}
+	}
+}
@@ -0,0 +1,208 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/ThinkInAIXYZ/go-mcp/protocol"
+)
+
+// LokiDetectedLabelsRequest represents the arguments for loki_detected_labels tool
+type LokiDetectedLabelsRequest struct {
+	Query           string            `json:"query,omitempty" description:"LogQL stream selector limiting the streams inspected, e.g. {job=\"varlogs\"} (default: all streams)"`
+	URL             string            `json:"url,omitempty" description:"Loki server URL"`
+	Backend         string            `json:"backend,omitempty" description:"Name of a Loki backend from LOKI_BACKENDS, e.g. prod, whose URL and credentials to use; cannot be combined with url, and an explicit credential still wins"`
+	Username        string            `json:"username,omitempty" description:"Username for basic authentication"`
+	Password        string            `json:"password,omitempty" description:"Password for basic authentication"`
+	Token           string            `json:"token,omitempty" description:"Bearer token for authentication"`
+	Start           string            `json:"start,omitempty" description:"Start time for the query"`
+	End             string            `json:"end,omitempty" description:"End time for the query"`
+	Timezone        string            `json:"timezone,omitempty" description:"IANA timezone for start and end times without a zone, e.g. America/New_York (default: LOKI_TIMEZONE or UTC)"`
+	AllowLargeRange bool              `json:"allowLargeRange,omitempty" description:"Query a time range longer than LOKI_MAX_TIME_RANGE anyway; long ranges are expensive for Loki, so only set this when a narrower range will not do (default: false)"`
+	Org             string            `json:"org,omitempty" description:"Organization ID for the query; separate several with commas to query tenants together"`
+	Headers         map[string]string `json:"headers,omitempty" description:"Extra HTTP headers to send to Loki, e.g. {\"X-Api-Key\": \"...\"}; never replaces the auth or org headers"`
+	Timeout         string            `json:"timeout,omitempty" description:"Timeout for the Loki request as a duration (e.g. 45s) or seconds (default: LOKI_QUERY_TIMEOUT or 30s)"`
+	Format          string            `json:"format,omitempty" description:"Output format: raw, json, or text"`
+}
+
+// LokiDetectedLabel is a label found in the inspected streams, with its number of distinct values
+// when Loki reports it
+type LokiDetectedLabel struct {
+	Label       string  `json:"label"`
+	Cardinality *uint64 `json:"cardinality,omitempty"`
+}
+
+// LokiDetectedLabelsResult represents the structure of Loki detected labels results
+type LokiDetectedLabelsResult struct {
+	DetectedLabels []LokiDetectedLabel `json:"detectedLabels"`
+}
+
+// NewLokiDetectedLabelsToolProtocol creates a tool using the protocol library
+func NewLokiDetectedLabelsToolProtocol() (*protocol.Tool, error) {
+	return protocol.NewTool("loki_detected_labels", "Get the labels present in a time range from Grafana Loki, with the number of distinct values of each, for exploring unfamiliar logs (requires Loki 3.0 or later)", LokiDetectedLabelsRequest{})
+}
+
+// HandleLokiDetectedLabelsProtocol handles Loki detected labels tool requests using protocol library
+func HandleLokiDetectedLabelsProtocol(ctx context.Context, request *protocol.CallToolRequest) (*protocol.CallToolResult, error) {
+	req := new(LokiDetectedLabelsRequest)
+	if err := protocol.VerifyAndUnmarshal(request.RawArguments, req); err != nil {
+		return nil, err
+	}
+
+	if req.Query != "" {
+		if err := validateLogQL(req.Query); err != nil {
+			return nil, err
+		}
+	}
+
+	ctx, conn, err := resolveLokiCall(ctx, req.Backend, req.URL, req.Username, req.Password, req.Token, req.Org, req.Timeout, req.Headers)
+	if err != nil {
+		return nil, err
+	}
+	lokiURL, username, password, token, orgID := conn.URL, conn.Username, conn.Password, conn.Token, conn.OrgID
+
+	// Fail with a readable error when Loki is known to be too old for the endpoint
+	if err := checkLokiVersion(ctx, conn, "loki_detected_labels", lokiDetectedLabelsVersion); err != nil {
+		return nil, err
+	}
+
+	start, end, err := resolveLokiRange(req.Start, req.End, req.Timezone, req.AllowLargeRange)
+	if err != nil {
+		return nil, err
+	}
+
+	format := resolveLokiFormat(req.Format, lokiLabelFormats)
+
+	detectedURL, err := buildLokiDetectedLabelsURL(lokiURL, req.Query, start, end)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build detected labels URL: %v", err)
+	}
+
+	result, err := executeLokiDetectedLabelsQuery(ctx, detectedURL, username, password, token, orgID)
+	if err != nil {
+		return nil, fmt.Errorf("detected labels query execution failed: %v", err)
+	}
+
+	formattedResult, err := formatLokiDetectedLabelsResults(result, format)
+	if err != nil {
+		return nil, fmt.Errorf("failed to format results: %v", err)
+	}
+
+	return &protocol.CallToolResult{
+		Content: []protocol.Content{
+			&protocol.TextContent{
+				Type: "text",
+				Text: formattedResult,
+			},
+		},
+	}, nil
+}
+
+// buildLokiDetectedLabelsURL constructs the Loki detected labels URL
+func buildLokiDetectedLabelsURL(baseURL, query string, start, end int64) (string, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return "", err
+	}
+
+	// Add path for Loki detected labels API
+	if !strings.Contains(u.Path, "loki/api/v1") {
+		if u.Path == "" || u.Path == "/" {
+			u.Path = "/loki/api/v1/detected_labels"
+		} else {
+			u.Path = fmt.Sprintf("%s/loki/api/v1/detected_labels", u.Path)
+		}
+	} else {
+		// If path already contains loki/api/v1, just append detected_labels if not present
+		if !strings.HasSuffix(u.Path, "detected_labels") {
+			u.Path = fmt.Sprintf("%s/detected_labels", u.Path)
+		}
+	}
+
+	// Add query parameters
+	q := u.Query()
+	if query != "" {
+		q.Set("query", query)
+	}
+	q.Set("start", fmt.Sprintf("%d", start))
+	q.Set("end", fmt.Sprintf("%d", end))
+	u.RawQuery = q.Encode()
+
+	return u.String(), nil
+}
+
+// executeLokiDetectedLabelsQuery sends the HTTP request to Loki detected labels endpoint.
+// Loki versions before 3.0 do not have the endpoint and answer 404, which is reported as such.
+func executeLokiDetectedLabelsQuery(ctx context.Context, queryURL string, username, password, token, orgID string) (*LokiDetectedLabelsResult, error) {
+	body, err := doLokiRequest(ctx, queryURL, username, password, token, orgID)
+	if err != nil {
+		var httpErr *LokiHTTPError
+		if errors.As(err, &httpErr) && httpErr.StatusCode == http.StatusNotFound {
+			return nil, fmt.Errorf("endpoint not supported: this Loki server has no /loki/api/v1/detected_labels endpoint (requires Loki >= %s), use loki_label_names instead", lokiDetectedLabelsVersion)
+		}
+		return nil, err
+	}
+
+	// Parse JSON response
+	var result LokiDetectedLabelsResult
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+// formatLokiDetectedLabelsResults formats Loki detected labels results into a readable string
+func formatLokiDetectedLabelsResults(result *LokiDetectedLabelsResult, format string) (string, error) {
+	if len(result.DetectedLabels) == 0 {
+		switch format {
+		case "json":
+			return "{\"message\": \"No labels detected\"}", nil
+		default:
+			return "No labels detected", nil
+		}
+	}
+
+	switch format {
+	case "json":
+		// Return raw JSON response
+		jsonBytes, err := json.MarshalIndent(result, "", "  ")
+		if err != nil {
+			return "", fmt.Errorf("failed to marshal JSON: %v", err)
+		}
+		return string(jsonBytes), nil
+
+	case "raw":
+		// Return one label per line, followed by its cardinality when known
+		var b strings.Builder
+		for _, label := range result.DetectedLabels {
+			if label.Cardinality != nil {
+				fmt.Fprintf(&b, "%s\t%d\n", label.Label, *label.Cardinality)
+			} else {
+				b.WriteString(label.Label + "\n")
+			}
+		}
+		return b.String(), nil
+
+	case "text":
+		// Return formatted text with numbering
+		var b strings.Builder
+		fmt.Fprintf(&b, "Found %d detected labels:\n\n", len(result.DetectedLabels))
+		for i, label := range result.DetectedLabels {
+			if label.Cardinality != nil {
+				fmt.Fprintf(&b, "%d. %s (%d values)\n", i+1, label.Label, *label.Cardinality)
+			} else {
+				fmt.Fprintf(&b, "%d. %s\n", i+1, label.Label)
+			}
+		}
+		return b.String(), nil
+
+	default:
+		return "", fmt.Errorf("unsupported format: %s. Supported formats: raw, json, text", format)
+	}
+}
@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/ThinkInAIXYZ/go-mcp/protocol"
+)
+
+// TestBuildLokiDetectedLabelsURL verifies the path and that an empty query is left out
+func TestBuildLokiDetectedLabelsURL(t *testing.T) {
+	got, err := buildLokiDetectedLabelsURL("http://localhost:3100", `{job="a"}`, 1705312245, 1705315845)
+	if err != nil {
+		t.Fatalf("buildLokiDetectedLabelsURL failed: %v", err)
+	}
+	u, _ := url.Parse(got)
+	if u.Path != "/loki/api/v1/detected_labels" {
+		t.Errorf("Expected detected_labels path, got %q", u.Path)
+	}
+	if q := u.Query(); q.Get("query") != `{job="a"}` || q.Get("start") != "1705312245" || q.Get("end") != "1705315845" {
+		t.Errorf("Unexpected parameters: %s", u.RawQuery)
+	}
+
+	got, err = buildLokiDetectedLabelsURL("http://localhost:3100/loki/api/v1", "", 1, 2)
+	if err != nil {
+		t.Fatalf("buildLokiDetectedLabelsURL failed: %v", err)
+	}
+	u, _ = url.Parse(got)
+	if u.Path != "/loki/api/v1/detected_labels" || u.Query().Has("query") {
+		t.Errorf("Unexpected URL without query: %s", got)
+	}
+}
+
+// TestFormatLokiDetectedLabelsResults verifies that cardinality is shown only when reported
+func TestFormatLokiDetectedLabelsResults(t *testing.T) {
+	var result LokiDetectedLabelsResult
+	if err := json.Unmarshal([]byte(`{"detectedLabels":[{"label":"cluster","cardinality":3},{"label":"pod"}]}`), &result); err != nil {
+		t.Fatalf("Failed to parse result: %v", err)
+	}
+
+	raw, err := formatLokiDetectedLabelsResults(&result, "raw")
+	if err != nil || raw != "cluster\t3\npod\n" {
+		t.Errorf("Unexpected raw output %q (%v)", raw, err)
+	}
+
+	text, err := formatLokiDetectedLabelsResults(&result, "text")
+	if err != nil || !strings.Contains(text, "1. cluster (3 values)") || !strings.Contains(text, "2. pod\n") {
+		t.Errorf("Unexpected text output %q (%v)", text, err)
+	}
+
+	empty, err := formatLokiDetectedLabelsResults(&LokiDetectedLabelsResult{}, "text")
+	if err != nil || empty != "No labels detected" {
+		t.Errorf("Unexpected empty output %q (%v)", empty, err)
+	}
+}
+
+// TestHandleLokiDetectedLabelsProtocol verifies the results and the error for older Loki versions
+func TestHandleLokiDetectedLabelsProtocol(t *testing.T) {
+	supported := true
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !supported {
+			http.Error(w, "404 page not found", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"detectedLabels":[{"label":"namespace","cardinality":12}]}`))
+	}))
+	defer server.Close()
+
+	for _, env := range []string{EnvLokiURL, EnvLokiOrgID, EnvLokiUsername, EnvLokiPassword, EnvLokiToken} {
+		t.Setenv(env, "")
+	}
+
+	if _, err := NewLokiDetectedLabelsToolProtocol(); err != nil {
+		t.Fatalf("Failed to create tool: %v", err)
+	}
+
+	raw, _ := json.Marshal(map[string]any{"url": server.URL, "format": "text"})
+	request := &protocol.CallToolRequest{Name: "loki_detected_labels", RawArguments: raw}
+
+	result, err := HandleLokiDetectedLabelsProtocol(context.Background(), request)
+	if err != nil {
+		t.Fatalf("HandleLokiDetectedLabelsProtocol failed: %v", err)
+	}
+	if text := result.Content[0].(*protocol.TextContent).Text; !strings.Contains(text, "namespace (12 values)") {
+		t.Errorf("Unexpected output: %q", text)
+	}
+
+	supported = false
+	_, err = HandleLokiDetectedLabelsProtocol(context.Background(), request)
+	if err == nil || !strings.Contains(err.Error(), "endpoint not supported") {
+		t.Errorf("Expected endpoint not supported error, got %v", err)
+	}
+}
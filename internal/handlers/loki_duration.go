@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// lokiDurationUnits maps the units accepted in durations to their length. Besides Go's units,
+// Loki and Prometheus accept d, w and y, counted as 24h, 7d and 365d.
+var lokiDurationUnits = map[string]time.Duration{
+	"ns": time.Nanosecond,
+	"us": time.Microsecond,
+	"µs": time.Microsecond,
+	"ms": time.Millisecond,
+	"s":  time.Second,
+	"m":  time.Minute,
+	"h":  time.Hour,
+	"d":  24 * time.Hour,
+	"w":  7 * 24 * time.Hour,
+	"y":  365 * 24 * time.Hour,
+}
+
+// parseDuration parses durations the way Loki accepts them: Go syntax such as 30s, 1h30m or
+// 500ms, the d, w and y units such as 7d or 1w2d, or a plain number of seconds such as 45 or 1.5.
+// Unlike parseTime, the result is a length of time rather than a point in time.
+func parseDuration(value string) (time.Duration, error) {
+	s := strings.TrimSpace(value)
+	if seconds, err := strconv.ParseFloat(s, 64); err == nil {
+		if math.IsNaN(seconds) || math.IsInf(seconds, 0) || math.Abs(seconds) > math.MaxInt64/float64(time.Second) {
+			return 0, fmt.Errorf("%q is out of range", value)
+		}
+		return time.Duration(seconds * float64(time.Second)), nil
+	}
+
+	negative := strings.HasPrefix(s, "-")
+	s = strings.TrimPrefix(strings.TrimPrefix(s, "-"), "+")
+	if s == "" {
+		return 0, fmt.Errorf("%q is not a duration such as 30s, 5m, 1h30m or 7d", value)
+	}
+
+	var total float64
+	for s != "" {
+		// Each component is a number followed by a unit
+		i := strings.IndexFunc(s, func(r rune) bool { return (r < '0' || r > '9') && r != '.' })
+		if i <= 0 {
+			return 0, fmt.Errorf("%q is not a duration such as 30s, 5m, 1h30m or 7d", value)
+		}
+		n, err := strconv.ParseFloat(s[:i], 64)
+		if err != nil {
+			return 0, fmt.Errorf("%q is not a duration such as 30s, 5m, 1h30m or 7d", value)
+		}
+		s = s[i:]
+
+		j := strings.IndexFunc(s, func(r rune) bool { return (r >= '0' && r <= '9') || r == '.' })
+		if j < 0 {
+			j = len(s)
+		}
+		unit, ok := lokiDurationUnits[s[:j]]
+		if !ok {
+			return 0, fmt.Errorf("%q is not a duration such as 30s, 5m, 1h30m or 7d", value)
+		}
+		s = s[j:]
+		total += n * float64(unit)
+	}
+
+	if total > math.MaxInt64 {
+		return 0, fmt.Errorf("%q is out of range", value)
+	}
+	if negative {
+		return -time.Duration(total), nil
+	}
+	return time.Duration(total), nil
+}
+
+// parsePositiveDuration parses value with parseDuration for the setting called name, such as
+// step or LOKI_QUERY_TIMEOUT, rejecting zero and negative durations
+func parsePositiveDuration(name, value string) (time.Duration, error) {
+	d, err := parseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %v", name, err)
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("invalid %s: %q must be a positive duration", name, value)
+	}
+	return d, nil
+}
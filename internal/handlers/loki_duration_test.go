@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestParseDuration verifies Go syntax, Loki's day, week and year units and plain seconds
+func TestParseDuration(t *testing.T) {
+	day := 24 * time.Hour
+	tests := map[string]time.Duration{
+		"30s":   30 * time.Second,
+		"5m":    5 * time.Minute,
+		"1h30m": 90 * time.Minute,
+		"500ms": 500 * time.Millisecond,
+		"1.5h":  90 * time.Minute,
+		"7d":    7 * day,
+		"1w2d":  9 * day,
+		"1y":    365 * day,
+		"2d12h": 60 * time.Hour,
+		"45":    45 * time.Second,
+		"0.25":  250 * time.Millisecond,
+		" 10m ": 10 * time.Minute,
+		"-1h":   -time.Hour,
+		"0":     0,
+		"0s":    0,
+		"100µs": 100 * time.Microsecond,
+	}
+	for value, want := range tests {
+		if got, err := parseDuration(value); err != nil || got != want {
+			t.Errorf("parseDuration(%q) = %v (%v), want %v", value, got, err, want)
+		}
+	}
+
+	for _, value := range []string{"", "soon", "5x", "m5", "1h-30m", "1..5s", "-", "100000000y", "NaN", "Inf"} {
+		if _, err := parseDuration(value); err == nil {
+			t.Errorf("Expected an error for %q", value)
+		}
+	}
+}
+
+// TestParsePositiveDuration verifies the uniform error messages
+func TestParsePositiveDuration(t *testing.T) {
+	if got, err := parsePositiveDuration("step", "1m"); err != nil || got != time.Minute {
+		t.Errorf("Expected 1m, got %v (%v)", got, err)
+	}
+
+	tests := map[string]string{
+		"soon": `invalid step: "soon" is not a duration such as 30s, 5m, 1h30m or 7d`,
+		"0s":   `invalid step: "0s" must be a positive duration`,
+		"-5m":  `invalid step: "-5m" must be a positive duration`,
+	}
+	for value, want := range tests {
+		if _, err := parsePositiveDuration("step", value); err == nil || err.Error() != want {
+			t.Errorf("parsePositiveDuration(%q) error = %v, want %q", value, err, want)
+		}
+	}
+
+	// The same messages are used by every duration setting
+	t.Setenv(EnvLokiQueryTimeout, "fast")
+	if _, err := resolveLokiTimeout(""); err == nil || !strings.HasPrefix(err.Error(), `invalid LOKI_QUERY_TIMEOUT: "fast" is not a duration`) {
+		t.Errorf("Unexpected error %v", err)
+	}
+	t.Setenv(EnvLokiDefaultLookback, "1w")
+	if got, err := LokiDefaultLookback(); err != nil || got != 7*24*time.Hour {
+		t.Errorf("Expected a week, got %v (%v)", got, err)
+	}
+}
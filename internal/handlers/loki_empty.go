@@ -0,0 +1,13 @@
+package handlers
+
+import (
+	"fmt"
+	"time"
+)
+
+// lokiEmptyResultMessage explains that a query succeeded but matched nothing, with the resolved
+// range (Unix ns), so that agents do not mistake an empty answer for a failed call
+func lokiEmptyResultMessage(what, query string, start, end int64) string {
+	return fmt.Sprintf("No %s matched %s between %s and %s", what, query,
+		time.Unix(0, start).UTC().Format(time.RFC3339Nano), time.Unix(0, end).UTC().Format(time.RFC3339Nano))
+}
@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ThinkInAIXYZ/go-mcp/protocol"
+)
+
+// TestHandleLokiQueryProtocol_Empty verifies the explicit message for queries matching nothing,
+// and that json output keeps an empty result array
+func TestHandleLokiQueryProtocol_Empty(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"status":"success","data":{"resultType":"streams","result":[]}}`))
+	}))
+	defer server.Close()
+
+	if _, err := NewLokiQueryToolProtocol(); err != nil {
+		t.Fatalf("Failed to create tool: %v", err)
+	}
+
+	want := `No log entries matched {job="none"} between 2024-01-15T09:00:00Z and 2024-01-15T10:00:00Z`
+	tests := []struct {
+		name string
+		args map[string]any
+	}{
+		{name: "Raw", args: map[string]any{}},
+		{name: "Text", args: map[string]any{"format": "text"}},
+		{name: "Fields", args: map[string]any{"fields": []string{"msg"}}},
+		{name: "Summarize", args: map[string]any{"summarize": true}},
+	}
+	call := func(extra map[string]any) string {
+		t.Helper()
+		args := map[string]any{"query": `{job="none"}`, "url": server.URL, "start": "2024-01-15T09:00:00Z", "end": "2024-01-15T10:00:00Z"}
+		for k, v := range extra {
+			args[k] = v
+		}
+		raw, _ := json.Marshal(args)
+		result, err := HandleLokiQueryProtocol(context.Background(), &protocol.CallToolRequest{Name: "loki_query", RawArguments: raw})
+		if err != nil {
+			t.Fatalf("HandleLokiQueryProtocol failed: %v", err)
+		}
+		return result.Content[0].(*protocol.TextContent).Text
+	}
+
+	for _, tt := range tests {
+		if got := call(tt.args); got != want {
+			t.Errorf("%s: expected %q, got %q", tt.name, want, got)
+		}
+	}
+
+	var parsed LokiResult
+	output := call(map[string]any{"format": "json"})
+	if err := json.Unmarshal([]byte(output), &parsed); err != nil || parsed.Data.Result == nil || len(parsed.Data.Result) != 0 {
+		t.Errorf("Expected json with an empty result array, got %v:\n%s", err, output)
+	}
+}
+
+// TestHandleLokiQueryRangeProtocol_Empty verifies the explicit message for metric queries matching nothing
+func TestHandleLokiQueryRangeProtocol_Empty(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"status":"success","data":{"resultType":"matrix","result":[]}}`))
+	}))
+	defer server.Close()
+
+	if _, err := NewLokiQueryRangeToolProtocol(); err != nil {
+		t.Fatalf("Failed to create tool: %v", err)
+	}
+
+	call := func(format string) string {
+		t.Helper()
+		raw, _ := json.Marshal(map[string]any{"query": `rate({job="none"}[5m])`, "url": server.URL, "start": "2024-01-15T09:00:00Z", "end": "2024-01-15T10:00:00Z", "format": format})
+		result, err := HandleLokiQueryRangeProtocol(context.Background(), &protocol.CallToolRequest{Name: "loki_query_range", RawArguments: raw})
+		if err != nil {
+			t.Fatalf("HandleLokiQueryRangeProtocol failed: %v", err)
+		}
+		return result.Content[0].(*protocol.TextContent).Text
+	}
+
+	want := `No series matched rate({job="none"}[5m]) between 2024-01-15T09:00:00Z and 2024-01-15T10:00:00Z`
+	if got := call("text"); got != want {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+	if got := call("json"); !strings.Contains(got, `"result": []`) {
+		t.Errorf("Expected json with an empty result array, got:\n%s", got)
+	}
+}
@@ -0,0 +1,301 @@
+package handlers
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// logqlMatcherParts captures the label, operator and value of a stream selector matcher
+var logqlMatcherParts = regexp.MustCompile("^\\s*([a-zA-Z_][a-zA-Z0-9_]*)\\s*(=~|!~|!=|=)\\s*(\"(?:[^\"\\\\]|\\\\.)*\"|`[^`]*`)\\s*$")
+
+// logqlLabelFilterPattern matches the start of a label filter stage such as status >= 500
+var logqlLabelFilterPattern = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*\s*(=~|!~|!=|==|>=|<=|=|>|<)`)
+
+// logqlFunctionPattern matches a function applied before the stream selector of a metric query,
+// with an optional grouping, e.g. sum by (level) (
+var logqlFunctionPattern = regexp.MustCompile(`([a-z_]+)\s*(?:((?:by|without)\s*\([^)]*\))\s*)?\(`)
+
+// logqlGroupingPattern matches a grouping written after the arguments of an aggregation
+var logqlGroupingPattern = regexp.MustCompile(`(?:by|without)\s*\([^)]*\)`)
+
+// logqlRangePattern matches the range of a range aggregation, e.g. [5m]
+var logqlRangePattern = regexp.MustCompile(`\[\s*([0-9a-z.]+)\s*\]`)
+
+// Plain-language meaning of stream selector operators
+var logqlMatcherMeanings = map[string]string{"=": "equals", "!=": "does not equal", "=~": "matches regex", "!~": "does not match regex"}
+
+// Plain-language meaning of line filter operators
+var logqlLineFilterMeanings = map[string]string{"|=": "keep lines containing", "!=": "drop lines containing", "|~": "keep lines matching regex", "!~": "drop lines matching regex"}
+
+// Plain-language meaning of pipeline stages, by their first word
+var logqlStageMeanings = map[string]string{
+	"json":         "parser: extract labels from JSON lines",
+	"logfmt":       "parser: extract labels from logfmt lines",
+	"regexp":       "parser: extract labels with a regular expression",
+	"pattern":      "parser: extract labels with a pattern",
+	"unpack":       "parser: unpack labels embedded by a pack stage",
+	"line_format":  "line format: rewrite each line from a template",
+	"label_format": "label format: rename labels or set them from templates",
+	"drop":         "drop labels",
+	"keep":         "keep only these labels",
+	"decolorize":   "decolorize: strip ANSI color codes from lines",
+	"unwrap":       "unwrap: use a label's value as the sample value",
+}
+
+// logqlExplanation is the breakdown of a LogQL query into its major clauses
+type logqlExplanation struct {
+	Functions []string // functions around the selector of a metric query, outermost first
+	Ranges    []string // range windows of range aggregations
+	Selector  string
+	Matchers  []string
+	Stages    []string
+	Unparsed  []string // segments the explainer did not recognize
+}
+
+// explainLogQL breaks a query into its stream selector, pipeline stages and, for metric queries,
+// the functions and range windows around them. It only covers the major clauses; anything it
+// does not recognize is kept in Unparsed for Loki to interpret.
+func explainLogQL(query string) logqlExplanation {
+	var exp logqlExplanation
+
+	open := findLogQLSelector(query)
+	if open < 0 {
+		exp.Unparsed = append(exp.Unparsed, strings.TrimSpace(query))
+		return exp
+	}
+	closing := strings.IndexByte(query[open:], '}')
+	if closing < 0 {
+		exp.Unparsed = append(exp.Unparsed, strings.TrimSpace(query[open:]))
+		return exp
+	}
+	closing += open
+
+	exp.Selector = query[open : closing+1]
+	for _, matcher := range splitLogQLMatchers(query[open+1 : closing]) {
+		parts := logqlMatcherParts.FindStringSubmatch(matcher)
+		if parts == nil {
+			exp.Unparsed = append(exp.Unparsed, strings.TrimSpace(matcher))
+			continue
+		}
+		exp.Matchers = append(exp.Matchers, fmt.Sprintf("%s %s %s", parts[1], logqlMatcherMeanings[parts[2]], parts[3]))
+	}
+
+	// The log part of a metric query ends at the range window or at the parenthesis closing it
+	end := endOfLogQLPipeline(query, closing+1)
+	exp.Stages, exp.Unparsed = explainLogQLPipeline(query[closing+1:end], exp.Unparsed)
+
+	if prefix := query[:open]; strings.TrimSpace(prefix) != "" {
+		suffix := query[end:]
+		for _, fn := range logqlFunctionPattern.FindAllStringSubmatch(prefix, -1) {
+			exp.Functions = append(exp.Functions, strings.TrimSpace(fn[1]+" "+fn[2]))
+		}
+		for _, grouping := range logqlGroupingPattern.FindAllString(suffix, -1) {
+			exp.Functions = append(exp.Functions, "grouped "+grouping)
+		}
+		for _, window := range logqlRangePattern.FindAllStringSubmatch(suffix, -1) {
+			exp.Ranges = append(exp.Ranges, window[1])
+		}
+		if len(exp.Functions) == 0 {
+			exp.Unparsed = append(exp.Unparsed, strings.TrimSpace(prefix))
+		}
+	}
+	return exp
+}
+
+// findLogQLSelector returns the position of the first { outside string literals, or -1
+func findLogQLSelector(query string) int {
+	for i := 0; i < len(query); i++ {
+		switch query[i] {
+		case '"', '`':
+			if end := skipLogQLString(query, i); end >= 0 {
+				i = end
+			}
+		case '{':
+			return i
+		}
+	}
+	return -1
+}
+
+// endOfLogQLPipeline returns where the log pipeline starting at start ends: at a range window or a
+// closing parenthesis that is not part of the pipeline, or at the end of the query
+func endOfLogQLPipeline(query string, start int) int {
+	depth := 0
+	for i := start; i < len(query); i++ {
+		switch query[i] {
+		case '"', '`':
+			if end := skipLogQLString(query, i); end >= 0 {
+				i = end
+			}
+		case '(':
+			depth++
+		case ')':
+			if depth == 0 {
+				return i
+			}
+			depth--
+		case '[':
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return len(query)
+}
+
+// explainLogQLPipeline describes the line filters and stages following a stream selector,
+// appending the segments it cannot read to unparsed
+func explainLogQLPipeline(pipeline string, unparsed []string) ([]string, []string) {
+	var stages []string
+	rest := strings.TrimSpace(pipeline)
+	for rest != "" {
+		if op := rest[:min(2, len(rest))]; logqlLineFilterMeanings[op] != "" {
+			rest = strings.TrimSpace(rest[2:])
+			value, n := readLogQLValue(rest)
+			if n == 0 {
+				return stages, append(unparsed, op+" "+rest)
+			}
+			values := []string{value}
+			rest = strings.TrimSpace(rest[n:])
+			for strings.HasPrefix(rest, "or ") {
+				value, n := readLogQLValue(strings.TrimSpace(rest[3:]))
+				if n == 0 {
+					break
+				}
+				values = append(values, value)
+				rest = strings.TrimSpace(strings.TrimSpace(rest[3:])[n:])
+			}
+			stages = append(stages, fmt.Sprintf("%s %s (line filter: %s)", op, strings.Join(values, " or "), logqlLineFilterMeanings[op]))
+			continue
+		}
+
+		if rest[0] != '|' {
+			return stages, append(unparsed, rest)
+		}
+		n := readLogQLStage(rest[1:])
+		body := strings.TrimSpace(rest[1 : 1+n])
+		rest = strings.TrimSpace(rest[1+n:])
+
+		word := body
+		if i := strings.IndexFunc(body, func(r rune) bool { return !(r == '_' || r >= 'a' && r <= 'z') }); i >= 0 {
+			word = body[:i]
+		}
+		switch {
+		case logqlStageMeanings[word] != "" && !logqlLabelFilterPattern.MatchString(body):
+			stages = append(stages, fmt.Sprintf("%s (%s)", body, logqlStageMeanings[word]))
+		case logqlLabelFilterPattern.MatchString(body):
+			stages = append(stages, body+" (label filter: keep entries whose labels match)")
+		default:
+			unparsed = append(unparsed, "| "+body)
+		}
+	}
+	return stages, unparsed
+}
+
+// readLogQLValue reads a string literal or a call such as ip("10.0.0.0/8") at the start of s,
+// returning it and its length, or a zero length if s starts with neither
+func readLogQLValue(s string) (string, int) {
+	if s == "" {
+		return "", 0
+	}
+	if s[0] == '"' || s[0] == '`' {
+		end := skipLogQLString(s, 0)
+		if end < 0 {
+			return "", 0
+		}
+		return s[:end+1], end + 1
+	}
+
+	open := strings.IndexByte(s, '(')
+	if open <= 0 || strings.TrimLeft(s[:open], "abcdefghijklmnopqrstuvwxyz_") != "" {
+		return "", 0
+	}
+	for i := open + 1; i < len(s); i++ {
+		switch s[i] {
+		case '"', '`':
+			if end := skipLogQLString(s, i); end >= 0 {
+				i = end
+			}
+		case ')':
+			return s[:i+1], i + 1
+		}
+	}
+	return "", 0
+}
+
+// readLogQLStage returns the length of the pipeline stage at the start of s, which ends at the
+// next | outside string literals and brackets
+func readLogQLStage(s string) int {
+	depth := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '"', '`':
+			if end := skipLogQLString(s, i); end >= 0 {
+				i = end
+			}
+		case '(', '[', '{':
+			depth++
+		case ')', ']', '}':
+			depth--
+		case '|':
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return len(s)
+}
+
+// formatLokiExplain describes what loki_query would ask Loki for, without running the query
+func formatLokiExplain(query string, start, end int64, limit int, limitNote, direction string) string {
+	exp := explainLogQL(query)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Explanation of %s (not executed)\n\n", query)
+
+	if len(exp.Functions) > 0 || len(exp.Ranges) > 0 {
+		b.WriteString("Type: metric query, returning samples computed from log lines\n")
+		if len(exp.Functions) > 0 {
+			fmt.Fprintf(&b, "Functions, outermost first: %s\n", strings.Join(exp.Functions, ", "))
+		}
+		if len(exp.Ranges) > 0 {
+			fmt.Fprintf(&b, "Range windows: %s\n", strings.Join(exp.Ranges, ", "))
+		}
+	} else {
+		b.WriteString("Type: log query, returning log lines\n")
+	}
+
+	if exp.Selector != "" {
+		fmt.Fprintf(&b, "Stream selector: %s\n", exp.Selector)
+		for _, matcher := range exp.Matchers {
+			fmt.Fprintf(&b, "  - %s\n", matcher)
+		}
+	}
+	if len(exp.Stages) == 0 {
+		b.WriteString("Pipeline: none, every line of the selected streams is used\n")
+	} else {
+		b.WriteString("Pipeline, in order:\n")
+		for i, stage := range exp.Stages {
+			fmt.Fprintf(&b, "  %d. %s\n", i+1, stage)
+		}
+	}
+	for _, segment := range exp.Unparsed {
+		fmt.Fprintf(&b, "Unparsed: %s (not recognized by the explainer, left for Loki to interpret)\n", segment)
+	}
+
+	fmt.Fprintf(&b, "Time range: %s to %s (%s)\n", time.Unix(0, start).UTC().Format(time.RFC3339Nano),
+		time.Unix(0, end).UTC().Format(time.RFC3339Nano), formatLokiLookback(time.Duration(end-start)))
+	order := "newest first"
+	if direction == "forward" {
+		order = "oldest first"
+	} else {
+		direction = "backward"
+	}
+	fmt.Fprintf(&b, "Limit: %d entries, direction %s (%s)\n", limit, direction, order)
+	if limitNote != "" {
+		fmt.Fprintf(&b, "Note: %s\n", limitNote)
+	}
+	return b.String()
+}
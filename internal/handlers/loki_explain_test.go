@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ThinkInAIXYZ/go-mcp/protocol"
+)
+
+// TestExplainLogQL verifies the clauses found in log and metric queries, and unparsed segments
+func TestExplainLogQL(t *testing.T) {
+	exp := explainLogQL(`{job="api", env=~"prod|stage"} |= "error" != "timeout" | json | status >= 500 | line_format "{{.msg | lower}}"`)
+	if exp.Selector != `{job="api", env=~"prod|stage"}` || len(exp.Matchers) != 2 || exp.Matchers[1] != `env matches regex "prod|stage"` {
+		t.Errorf("Unexpected selector %q and matchers %v", exp.Selector, exp.Matchers)
+	}
+	wantStages := []string{
+		`|= "error" (line filter: keep lines containing)`,
+		`!= "timeout" (line filter: drop lines containing)`,
+		`json (parser: extract labels from JSON lines)`,
+		`status >= 500 (label filter: keep entries whose labels match)`,
+		`line_format "{{.msg | lower}}" (line format: rewrite each line from a template)`,
+	}
+	if strings.Join(exp.Stages, "\n") != strings.Join(wantStages, "\n") {
+		t.Errorf("Unexpected stages:\n%s", strings.Join(exp.Stages, "\n"))
+	}
+	if len(exp.Functions) != 0 || len(exp.Unparsed) != 0 {
+		t.Errorf("Expected a plain log query, got functions %v and unparsed %v", exp.Functions, exp.Unparsed)
+	}
+
+	exp = explainLogQL(`sum by (level) (count_over_time({job="api"} |= "x" or "y" | logfmt [5m]))`)
+	if strings.Join(exp.Functions, ", ") != "sum by (level), count_over_time" || len(exp.Ranges) != 1 || exp.Ranges[0] != "5m" {
+		t.Errorf("Unexpected functions %v and ranges %v", exp.Functions, exp.Ranges)
+	}
+	if len(exp.Stages) != 2 || exp.Stages[0] != `|= "x" or "y" (line filter: keep lines containing)` {
+		t.Errorf("Unexpected metric pipeline %v", exp.Stages)
+	}
+
+	exp = explainLogQL(`{job="a"} | foo bar`)
+	if len(exp.Unparsed) != 1 || exp.Unparsed[0] != "| foo bar" {
+		t.Errorf("Expected the unknown stage to be unparsed, got %v", exp.Unparsed)
+	}
+}
+
+// TestHandleLokiQueryProtocol_Explain verifies that explain describes the resolved call without querying Loki
+func TestHandleLokiQueryProtocol_Explain(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+	}))
+	defer server.Close()
+
+	if _, err := NewLokiQueryToolProtocol(); err != nil {
+		t.Fatalf("Failed to create tool: %v", err)
+	}
+	raw, _ := json.Marshal(map[string]any{"query": `{job="api"} |= "error"`, "url": server.URL, "explain": true,
+		"start": "2024-01-15T10:00:00Z", "end": "2024-01-15T10:30:00.5Z", "limit": 20, "direction": "forward"})
+	result, err := HandleLokiQueryProtocol(context.Background(), &protocol.CallToolRequest{Name: "loki_query", RawArguments: raw})
+	if err != nil {
+		t.Fatalf("HandleLokiQueryProtocol failed: %v", err)
+	}
+	if calls != 0 {
+		t.Errorf("Expected no request to Loki, got %d", calls)
+	}
+
+	text := result.Content[0].(*protocol.TextContent).Text
+	for _, want := range []string{
+		"(not executed)",
+		"Type: log query",
+		`  - job equals "api"`,
+		`  1. |= "error" (line filter: keep lines containing)`,
+		"Time range: 2024-01-15T10:00:00Z to 2024-01-15T10:30:00.5Z",
+		"Limit: 20 entries, direction forward (oldest first)",
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("Expected %q in %q", want, text)
+		}
+	}
+}
@@ -0,0 +1,330 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+)
+
+// Default size of the chunks written to the client by the export endpoint
+const defaultExportChunkSize = 32 * 1024
+
+// chunkedWriter buffers formatted output and flushes it to the underlying writer in
+// bounded chunks, so large exports never hold the whole formatted result in memory
+type chunkedWriter struct {
+	w       io.Writer
+	flusher http.Flusher
+	buf     []byte
+	size    int
+	peak    int // largest number of bytes held in the buffer, for diagnostics
+}
+
+// newChunkedWriter creates a chunkedWriter that flushes once size bytes are buffered.
+// If w implements http.Flusher, each chunk is pushed to the client immediately.
+func newChunkedWriter(w io.Writer, size int) *chunkedWriter {
+	cw := &chunkedWriter{
+		w:    w,
+		buf:  make([]byte, 0, size),
+		size: size,
+	}
+	if f, ok := w.(http.Flusher); ok {
+		cw.flusher = f
+	}
+	return cw
+}
+
+// Write buffers p and flushes when the chunk size is reached. A write of a chunk or more is sent
+// on its own after whatever is buffered, rather than being copied into the buffer.
+func (cw *chunkedWriter) Write(p []byte) (int, error) {
+	if len(p) >= cw.size {
+		if err := cw.Flush(); err != nil {
+			return 0, err
+		}
+		if _, err := cw.w.Write(p); err != nil {
+			return 0, err
+		}
+		if cw.flusher != nil {
+			cw.flusher.Flush()
+		}
+		return len(p), nil
+	}
+
+	cw.buf = append(cw.buf, p...)
+	if len(cw.buf) > cw.peak {
+		cw.peak = len(cw.buf)
+	}
+	if len(cw.buf) >= cw.size {
+		if err := cw.Flush(); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// Flush writes any buffered bytes and flushes the client connection
+func (cw *chunkedWriter) Flush() error {
+	if len(cw.buf) > 0 {
+		if _, err := cw.w.Write(cw.buf); err != nil {
+			return err
+		}
+		cw.buf = cw.buf[:0]
+	}
+	if cw.flusher != nil {
+		cw.flusher.Flush()
+	}
+	return nil
+}
+
+// writeLokiPush writes results in Loki push format one value at a time
+func writeLokiPush(w io.Writer, result *LokiResult) error {
+	if _, err := io.WriteString(w, "{\"streams\":["); err != nil {
+		return err
+	}
+
+	for i, entry := range result.Data.Result {
+		if i > 0 {
+			if _, err := io.WriteString(w, ","); err != nil {
+				return err
+			}
+		}
+
+		labels := entry.Stream
+		if labels == nil {
+			labels = map[string]string{}
+		}
+		labelsJSON, err := json.Marshal(labels)
+		if err != nil {
+			return fmt.Errorf("failed to marshal JSON: %v", err)
+		}
+		if _, err := fmt.Fprintf(w, "\n{\"stream\":%s,\"values\":[", labelsJSON); err != nil {
+			return err
+		}
+
+		first := true
+		for _, val := range entry.Values {
+			if len(val) < 2 {
+				continue
+			}
+			if _, err := strconv.ParseInt(val[0], 10, 64); err != nil {
+				return fmt.Errorf("invalid nanosecond timestamp %q: %v", val[0], err)
+			}
+			valueJSON, err := json.Marshal([]string{val[0], val[1]})
+			if err != nil {
+				return fmt.Errorf("failed to marshal JSON: %v", err)
+			}
+			if !first {
+				if _, err := io.WriteString(w, ","); err != nil {
+					return err
+				}
+			}
+			if _, err := fmt.Fprintf(w, "\n%s", valueJSON); err != nil {
+				return err
+			}
+			first = false
+		}
+
+		if _, err := io.WriteString(w, "]}"); err != nil {
+			return err
+		}
+	}
+
+	_, err := io.WriteString(w, "]}\n")
+	return err
+}
+
+// writeLokiJSON writes results in the json format one stream at a time, producing the same
+// output as formatLokiResults
+func writeLokiJSON(w io.Writer, result *LokiResult) error {
+	// Render everything but the streams, then write them into the empty result array
+	skeleton := *result
+	skeleton.Data.Result = []LokiEntry{}
+	skeletonJSON, err := json.MarshalIndent(skeleton, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal JSON: %v", err)
+	}
+	const placeholder = `"result": []`
+	i := bytes.Index(skeletonJSON, []byte(placeholder))
+	if i < 0 {
+		return fmt.Errorf("failed to marshal JSON: no result array")
+	}
+	if _, err := w.Write(skeletonJSON[:i+len(placeholder)-1]); err != nil {
+		return err
+	}
+
+	for n, entry := range result.Data.Result {
+		entryJSON, err := json.MarshalIndent(entry, "      ", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal JSON: %v", err)
+		}
+		sep := ",\n      "
+		if n == 0 {
+			sep = "\n      "
+		}
+		if _, err := io.WriteString(w, sep); err != nil {
+			return err
+		}
+		if _, err := w.Write(entryJSON); err != nil {
+			return err
+		}
+	}
+
+	if _, err := io.WriteString(w, "\n    ]"); err != nil {
+		return err
+	}
+	_, err = w.Write(skeletonJSON[i+len(placeholder):])
+	return err
+}
+
+// writeLokiResults streams the formatted results to w one entry at a time. The signatures format,
+// which has to see every line before grouping them, and results without streams are rendered in
+// full by formatLokiResults first.
+func writeLokiResults(w io.Writer, result *LokiResult, format string) error {
+	if len(result.Data.Result) > 0 {
+		switch format {
+		case "raw":
+			if err := writeLokiRaw(w, result); err != nil {
+				return err
+			}
+			_, err := io.WriteString(w, lokiResultFooter(result))
+			return err
+		case "text":
+			if err := writeLokiText(w, result); err != nil {
+				return err
+			}
+			_, err := io.WriteString(w, lokiResultFooter(result))
+			return err
+		case "push":
+			return writeLokiPush(w, result)
+		case "json":
+			return writeLokiJSON(w, result)
+		case "logfmt":
+			if err := writeLokiLogfmt(w, result); err != nil {
+				return err
+			}
+			_, err := io.WriteString(w, lokiResultFooter(result))
+			return err
+		case "color":
+			if err := writeLokiColor(w, result); err != nil {
+				return err
+			}
+			_, err := io.WriteString(w, lokiResultFooter(result))
+			return err
+		case "markdown":
+			if err := writeLokiMarkdown(w, result); err != nil {
+				return err
+			}
+			_, err := io.WriteString(w, lokiResultFooter(result))
+			return err
+		}
+	}
+
+	formatted, err := formatLokiResults(result, format)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, formatted)
+	return err
+}
+
+// HandleLokiExport streams the results of a Loki query over plain HTTP using chunked
+// transfer encoding. It accepts the same query, start, end, limit, direction, org, format,
+// allowLargeRange and redact parameters as the loki_query tool as URL query parameters; the Loki URL and
+// credentials always come from the server configuration, optionally a named backend.
+func HandleLokiExport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	params := r.URL.Query()
+	queryString := params.Get("query")
+	if queryString == "" {
+		http.Error(w, "missing required parameter: query", http.StatusBadRequest)
+		return
+	}
+	if err := validateLogQL(queryString); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	conn, err := resolveLokiConnection(params.Get("backend"), "", "", "", "", params.Get("org"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	lokiURL, username, password, token, orgID := conn.URL, conn.Username, conn.Password, conn.Token, conn.OrgID
+
+	start, end, err := resolveLokiRange(params.Get("start"), params.Get("end"), params.Get("timezone"), params.Get("allowLargeRange") == "true")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	requestedLimit := 0
+	if limitStr := params.Get("limit"); limitStr != "" {
+		limitVal, err := strconv.Atoi(limitStr)
+		if err != nil || limitVal <= 0 {
+			http.Error(w, fmt.Sprintf("invalid limit: %s", limitStr), http.StatusBadRequest)
+			return
+		}
+		requestedLimit = limitVal
+	}
+	limit, limitNote, err := resolveLokiLimit(float64(requestedLimit))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	direction, err := parseDirection(params.Get("direction"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	format := resolveLokiFormat(params.Get("format"), lokiQueryFormats)
+	if !slices.Contains(lokiQueryFormats, format) {
+		http.Error(w, fmt.Sprintf("unsupported format: %s", format), http.StatusBadRequest)
+		return
+	}
+
+	redact, err := compileLokiRedact(params["redact"])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	queryURL, err := buildLokiQueryURL(lokiURL, queryString, start, end, limit, direction)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to build query URL: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	result, err := executeLokiQuery(r.Context(), queryURL, username, password, token, orgID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("query execution failed: %v", err), http.StatusBadGateway)
+		return
+	}
+
+	contentType := "text/plain; charset=utf-8"
+	if format == "json" || format == "push" {
+		contentType = "application/json"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	if limitNote != "" {
+		w.Header().Set("X-Limit-Note", limitNote)
+	}
+
+	result, _ = redactLokiResult(result, redact)
+
+	// Headers are committed with the first chunk, so later errors can only truncate the body
+	cw := newChunkedWriter(w, defaultExportChunkSize)
+	if err := writeLokiResults(cw, result, format); err != nil {
+		fmt.Fprintf(cw, "\nexport aborted: %v\n", err)
+	}
+	cw.Flush()
+}
@@ -0,0 +1,198 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// countingWriter records the largest single write it receives
+type countingWriter struct {
+	total    int
+	maxWrite int
+	writes   int
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	c.total += len(p)
+	c.writes++
+	if len(p) > c.maxWrite {
+		c.maxWrite = len(p)
+	}
+	return len(p), nil
+}
+
+// largeLokiResult builds a result with the given number of entries
+func largeLokiResult(entries int) *LokiResult {
+	values := make([][]string, 0, entries)
+	for i := 0; i < entries; i++ {
+		ts := strconv.FormatInt(1705312245000000000+int64(i), 10)
+		values = append(values, []string{ts, fmt.Sprintf("log line number %d with some padding to make it realistic", i)})
+	}
+	return &LokiResult{
+		Status: "success",
+		Data: LokiData{
+			ResultType: "streams",
+			Result: []LokiEntry{
+				{Stream: map[string]string{"job": "export"}, Values: values},
+			},
+		},
+	}
+}
+
+// TestChunkedWriter_PeakBufferBounded verifies that streaming a large result never buffers
+// more than one chunk (plus a single formatted entry) at a time
+func TestChunkedWriter_PeakBufferBounded(t *testing.T) {
+	const chunkSize = 4 * 1024
+	const maxEntrySize = 256
+
+	for _, format := range []string{"raw", "text", "push", "logfmt", "color", "markdown"} {
+		t.Run(format, func(t *testing.T) {
+			sink := &countingWriter{}
+			cw := newChunkedWriter(sink, chunkSize)
+
+			if err := writeLokiResults(cw, largeLokiResult(50000), format); err != nil {
+				t.Fatalf("writeLokiResults failed: %v", err)
+			}
+			if err := cw.Flush(); err != nil {
+				t.Fatalf("Flush failed: %v", err)
+			}
+
+			if sink.total < 1024*1024 {
+				t.Fatalf("Expected a large export (>1MB), got %d bytes", sink.total)
+			}
+			if cw.peak > chunkSize+maxEntrySize {
+				t.Errorf("Peak buffered size %d exceeded bound %d", cw.peak, chunkSize+maxEntrySize)
+			}
+			if sink.maxWrite > chunkSize+maxEntrySize {
+				t.Errorf("Largest chunk %d exceeded bound %d", sink.maxWrite, chunkSize+maxEntrySize)
+			}
+			if sink.writes < sink.total/(chunkSize+maxEntrySize) {
+				t.Errorf("Expected output to be written in many chunks, got %d writes", sink.writes)
+			}
+		})
+	}
+}
+
+// TestChunkedWriter_LargeWrite verifies that a write longer than a chunk is not copied into the buffer
+func TestChunkedWriter_LargeWrite(t *testing.T) {
+	const chunkSize = 1024
+	sink := &countingWriter{}
+	cw := newChunkedWriter(sink, chunkSize)
+
+	cw.Write([]byte("head"))
+	if _, err := cw.Write(bytes.Repeat([]byte("x"), 8*chunkSize)); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	if cw.peak > chunkSize {
+		t.Errorf("Expected the large write to bypass the buffer, peak was %d", cw.peak)
+	}
+	if sink.writes != 2 || sink.total != 8*chunkSize+len("head") {
+		t.Errorf("Expected the buffered bytes followed by the large write, got %d writes of %d bytes", sink.writes, sink.total)
+	}
+}
+
+// TestChunkedWriter_JSON verifies that the json format is buffered a stream at a time
+func TestChunkedWriter_JSON(t *testing.T) {
+	const chunkSize = 4 * 1024
+	result := &LokiResult{Status: "success", Data: LokiData{ResultType: "streams"}}
+	for i := 0; i < 500; i++ {
+		stream := largeLokiResult(20).Data.Result[0]
+		stream.Stream = map[string]string{"job": "export", "pod": strconv.Itoa(i)}
+		result.Data.Result = append(result.Data.Result, stream)
+	}
+
+	sink := &countingWriter{}
+	cw := newChunkedWriter(sink, chunkSize)
+	if err := writeLokiResults(cw, result, "json"); err != nil {
+		t.Fatalf("writeLokiResults failed: %v", err)
+	}
+	cw.Flush()
+
+	if sink.total < 1024*1024 {
+		t.Fatalf("Expected a large export (>1MB), got %d bytes", sink.total)
+	}
+	if cw.peak > 2*chunkSize {
+		t.Errorf("Peak buffered size %d exceeded bound %d", cw.peak, 2*chunkSize)
+	}
+}
+
+// TestWriteLokiResults_MatchesFormatter verifies streamed output matches the buffered formatter
+func TestWriteLokiResults_MatchesFormatter(t *testing.T) {
+	result := largeLokiResult(10)
+	result.Data.Result = append(result.Data.Result, LokiEntry{
+		Stream: map[string]string{"job": "other"},
+		Values: [][]string{{"1705312246000000000", `level=error msg="it broke"`}},
+	})
+	result.Data.Stats = json.RawMessage(`{"summary":{"totalLinesProcessed":11}}`)
+	result.Warnings = []string{"query was slow"}
+	for _, format := range []string{"raw", "text", "json", "logfmt", "color", "markdown"} {
+		var buf bytes.Buffer
+		if err := writeLokiResults(&buf, result, format); err != nil {
+			t.Fatalf("writeLokiResults failed: %v", err)
+		}
+		expected, err := formatLokiResults(result, format)
+		if err != nil {
+			t.Fatalf("formatLokiResults failed: %v", err)
+		}
+		if buf.String() != expected {
+			t.Errorf("Streamed %s output differs from formatter output", format)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := writeLokiResults(&buf, result, "push"); err != nil {
+		t.Fatalf("writeLokiResults failed: %v", err)
+	}
+	var push LokiPushRequest
+	if err := json.Unmarshal(buf.Bytes(), &push); err != nil {
+		t.Fatalf("Streamed push output is not valid JSON: %v", err)
+	}
+	if len(push.Streams) != 2 || len(push.Streams[0].Values) != 10 {
+		t.Errorf("Unexpected streamed push content: %+v", push)
+	}
+}
+
+// TestHandleLokiExport streams a query through the export endpoint against a mock Loki
+func TestHandleLokiExport(t *testing.T) {
+	body, _ := json.Marshal(largeLokiResult(2000))
+	loki := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("query") != `{job="export"}` {
+			t.Errorf("Unexpected query: %s", r.URL.Query().Get("query"))
+		}
+		w.Write(body)
+	}))
+	defer loki.Close()
+
+	t.Setenv(EnvLokiURL, loki.URL)
+
+	req := httptest.NewRequest(http.MethodGet, `/export?query=`+`%7Bjob%3D%22export%22%7D&format=raw`, nil)
+	rec := httptest.NewRecorder()
+	HandleLokiExport(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if !rec.Flushed {
+		t.Error("Expected the response to be flushed in chunks")
+	}
+	if got := strings.Count(rec.Body.String(), "\n"); got != 2001 {
+		t.Errorf("Expected 2000 lines and a footer, got %d lines", got)
+	}
+	lines := strings.Split(strings.TrimSuffix(rec.Body.String(), "\n"), "\n")
+	if footer := lines[len(lines)-1]; !strings.HasPrefix(footer, "--- 2000 entries, ~") {
+		t.Errorf("Expected a footer counting the entries, got %q", footer)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/export", nil)
+	rec = httptest.NewRecorder()
+	HandleLokiExport(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for a missing query, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,163 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Environment variable name for the replicas of the default Loki, tried in order
+const EnvLokiURLs = "LOKI_URLS"
+
+// How long a replica that failed is tried after the healthy ones
+const lokiFailoverCooldown = 30 * time.Second
+
+// lokiReplicaFailures records when each replica of LOKI_URLS last failed
+var lokiReplicaFailures = struct {
+	sync.Mutex
+	at map[string]time.Time
+}{at: make(map[string]time.Time)}
+
+// lokiReplicaURLs returns the URLs listed in LOKI_URLS, without trailing slashes
+func lokiReplicaURLs() []string {
+	var urls []string
+	for _, u := range strings.Split(os.Getenv(EnvLokiURLs), ",") {
+		if u = strings.TrimRight(strings.TrimSpace(u), "/"); u != "" {
+			urls = append(urls, u)
+		}
+	}
+	return urls
+}
+
+// CheckLokiURLs validates LOKI_URLS so that a malformed replica stops startup instead of failing
+// over on every query. It returns the replica URLs with credentials removed, for logging.
+func CheckLokiURLs() ([]string, error) {
+	var urls []string
+	for _, u := range lokiReplicaURLs() {
+		if err := validateLokiURL(u); err != nil {
+			return nil, fmt.Errorf("invalid %s: %v", EnvLokiURLs, err)
+		}
+		urls = append(urls, redactLokiURL(u))
+	}
+	return urls, nil
+}
+
+// lokiDefaultURL returns the URL used when a request names neither a URL nor a backend: LOKI_URL,
+// then the first replica of LOKI_URLS, then the LOKI_DEFAULTS URL or DefaultLokiURL
+func lokiDefaultURL() string {
+	if urls := lokiReplicaURLs(); len(urls) > 0 {
+		return getEnvOrDefault("", EnvLokiURL, urls[0])
+	}
+	return getEnvOrDefault("", EnvLokiURL, activeLokiDefaults.urlOr(DefaultLokiURL))
+}
+
+// lokiFailoverTargets returns the URLs to try for queryURL. When queryURL is a request to one of
+// the replicas in LOKI_URLS, the same request is addressed to every replica, in the configured
+// order except that replicas which failed within lokiFailoverCooldown come last. Other requests
+// have a single target.
+func lokiFailoverTargets(queryURL string, now time.Time) []string {
+	replicas := lokiReplicaURLs()
+	if len(replicas) < 2 {
+		return []string{queryURL}
+	}
+	_, rest, ok := lokiReplicaOf(queryURL, replicas)
+	if !ok {
+		return []string{queryURL}
+	}
+
+	lokiReplicaFailures.Lock()
+	defer lokiReplicaFailures.Unlock()
+	var healthy, failed []string
+	for _, replica := range replicas {
+		if at, ok := lokiReplicaFailures.at[replica]; ok && now.Sub(at) < lokiFailoverCooldown {
+			failed = append(failed, replica+rest)
+		} else {
+			healthy = append(healthy, replica+rest)
+		}
+	}
+	return append(healthy, failed...)
+}
+
+// lokiReplicaOf returns the replica that requestURL is addressed to and the rest of the URL
+// after it, or false when requestURL is not a request to any of replicas
+func lokiReplicaOf(requestURL string, replicas []string) (string, string, bool) {
+	for _, replica := range replicas {
+		if rest, ok := strings.CutPrefix(requestURL, replica); ok && (rest == "" || rest[0] == '/' || rest[0] == '?') {
+			return replica, rest, true
+		}
+	}
+	return "", "", false
+}
+
+// markLokiReplica records whether the replica that targetURL was sent to failed
+func markLokiReplica(targetURL string, failed bool, now time.Time) {
+	replica, _, ok := lokiReplicaOf(targetURL, lokiReplicaURLs())
+	if !ok {
+		return
+	}
+	lokiReplicaFailures.Lock()
+	defer lokiReplicaFailures.Unlock()
+	if failed {
+		lokiReplicaFailures.at[replica] = now
+	} else {
+		delete(lokiReplicaFailures.at, replica)
+	}
+}
+
+// isLokiFailoverError reports whether err means the replica is unavailable, so that the next one
+// should be tried: a connection error or a 5xx status. Other errors, such as a rejected query or
+// rate limiting, would be the same on every replica.
+func isLokiFailoverError(err error, retryable bool) bool {
+	var httpErr *LokiHTTPError
+	if errors.As(err, &httpErr) {
+		return httpErr.StatusCode >= http.StatusInternalServerError
+	}
+	var rateLimitErr *LokiRateLimitError
+	return retryable && !errors.As(err, &rateLimitErr)
+}
+
+// isLokiDialError reports whether err means the replica could not be connected to, so that the
+// request never reached it
+func isLokiDialError(err error) bool {
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+// sendLokiFailoverRequest performs a single attempt of a request, failing over across the replicas
+// of LOKI_URLS as given by lokiFailoverTargets. All replicas share the deadline of ctx. The returned
+// bool reports whether the failure of the last replica tried is transient. Requests other than GET,
+// such as deletions, may have been carried out by a replica that failed to answer, so they only
+// move on from replicas that could not be connected to.
+func sendLokiFailoverRequest(ctx context.Context, queryURL string, username, password, token, orgID string, read func(io.Reader) error) (bool, error) {
+	targets := lokiFailoverTargets(queryURL, time.Now())
+	for i, target := range targets {
+		retryable, err := sendLokiStreamRequest(ctx, target, username, password, token, orgID, read)
+		if len(targets) == 1 {
+			return retryable, err
+		}
+
+		failed := err != nil && isLokiFailoverError(err, retryable)
+		markLokiReplica(target, failed, time.Now())
+		if failed && lokiRequestMethod(ctx) != http.MethodGet && !isLokiDialError(err) {
+			return retryable, err
+		}
+		if !failed {
+			if err == nil {
+				lokiLogger(ctx).DebugContext(ctx, "Loki replica answered", "url", redactLokiURL(target))
+			}
+			return retryable, err
+		}
+		if i == len(targets)-1 || ctx.Err() != nil {
+			return retryable, err
+		}
+		lokiLogger(ctx).DebugContext(ctx, "Loki replica failed, trying the next one", "url", redactLokiURL(target), "error", err)
+	}
+	return false, nil
+}
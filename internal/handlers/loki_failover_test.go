@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// resetLokiReplicaFailures forgets the replica failures recorded by a test
+func resetLokiReplicaFailures(t *testing.T) {
+	t.Cleanup(func() {
+		lokiReplicaFailures.Lock()
+		clear(lokiReplicaFailures.at)
+		lokiReplicaFailures.Unlock()
+	})
+}
+
+// TestLokiFailoverTargets verifies which requests fail over and in what order
+func TestLokiFailoverTargets(t *testing.T) {
+	resetLokiReplicaFailures(t)
+	t.Setenv(EnvLokiURLs, "http://a:3100/, http://b:3100,http://c:3100")
+	now := time.Now()
+
+	got := lokiFailoverTargets("http://b:3100/loki/api/v1/query_range?query=x", now)
+	want := []string{"http://a:3100/loki/api/v1/query_range?query=x", "http://b:3100/loki/api/v1/query_range?query=x", "http://c:3100/loki/api/v1/query_range?query=x"}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+
+	for _, other := range []string{"http://a:31000/loki/api/v1/query_range", "http://elsewhere:3100/ready"} {
+		if got := lokiFailoverTargets(other, now); len(got) != 1 || got[0] != other {
+			t.Errorf("Expected no failover for %s, got %v", other, got)
+		}
+	}
+
+	// A replica that just failed is tried last until the cooldown has passed
+	markLokiReplica("http://a:3100/loki/api/v1/query_range", true, now)
+	if got := lokiFailoverTargets("http://a:3100/ready", now.Add(time.Second)); got[0] != "http://b:3100/ready" || got[2] != "http://a:3100/ready" {
+		t.Errorf("Expected the failed replica last, got %v", got)
+	}
+	if got := lokiFailoverTargets("http://a:3100/ready", now.Add(lokiFailoverCooldown)); got[0] != "http://a:3100/ready" {
+		t.Errorf("Expected the configured order after the cooldown, got %v", got)
+	}
+
+	t.Setenv(EnvLokiURLs, "http://a:3100")
+	if got := lokiFailoverTargets("http://a:3100/ready", now); len(got) != 1 {
+		t.Errorf("Expected no failover with a single replica, got %v", got)
+	}
+}
+
+// TestLokiDefaultURL verifies that LOKI_URL wins over the first replica of LOKI_URLS
+func TestLokiDefaultURL(t *testing.T) {
+	t.Setenv(EnvLokiURL, "")
+	t.Setenv(EnvLokiURLs, "http://a:3100,http://b:3100")
+	if got := lokiDefaultURL(); got != "http://a:3100" {
+		t.Errorf("Expected the first replica, got %s", got)
+	}
+	t.Setenv(EnvLokiURL, "http://b:3100")
+	if got := lokiDefaultURL(); got != "http://b:3100" {
+		t.Errorf("Expected LOKI_URL, got %s", got)
+	}
+
+	t.Setenv(EnvLokiURLs, "http://a:3100,not a url")
+	if _, err := CheckLokiURLs(); err == nil {
+		t.Error("Expected error for a malformed replica")
+	}
+}
+
+// TestExecuteLokiQuery_Failover verifies that a query moves on from a replica that is down or
+// answers 5xx, but not from one that rejects the query
+func TestExecuteLokiQuery_Failover(t *testing.T) {
+	resetLokiReplicaFailures(t)
+	t.Setenv(EnvLokiMaxRetries, "0")
+
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	down.Close()
+	var failing atomic.Int32
+	unavailable := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		failing.Add(1)
+		http.Error(w, "ingester unavailable", http.StatusInternalServerError)
+	}))
+	defer unavailable.Close()
+	var served atomic.Int32
+	healthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		served.Add(1)
+		if r.URL.Query().Get("query") == "bad" {
+			http.Error(w, "parse error", http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte(`{"status":"success","data":{"resultType":"streams","result":[{"stream":{"job":"a"},"values":[["1","ok"]]}]}}`))
+	}))
+	defer healthy.Close()
+
+	t.Setenv(EnvLokiURLs, strings.Join([]string{down.URL, unavailable.URL, healthy.URL}, ","))
+	result, err := executeLokiQuery(context.Background(), down.URL+"/loki/api/v1/query_range?query=x", "", "", "", "")
+	if err != nil {
+		t.Fatalf("Expected the healthy replica to answer, got %v", err)
+	}
+	if len(result.Data.Result) != 1 || failing.Load() != 1 || served.Load() != 1 {
+		t.Errorf("Unexpected result %+v after %d failing and %d healthy requests", result, failing.Load(), served.Load())
+	}
+
+	// The replicas that failed are now tried last, so the healthy one answers first
+	if _, err := executeLokiQuery(context.Background(), down.URL+"/loki/api/v1/query_range?query=x", "", "", "", ""); err != nil || failing.Load() != 1 {
+		t.Errorf("Expected the healthy replica to be tried first, got %v after %d failing requests", err, failing.Load())
+	}
+
+	// A rejected query is not sent to the other replicas
+	_, err = executeLokiQuery(context.Background(), healthy.URL+"/loki/api/v1/query_range?query=bad", "", "", "", "")
+	if err == nil || !strings.Contains(err.Error(), "parse error") || failing.Load() != 1 {
+		t.Errorf("Expected the rejection without failover, got %v", err)
+	}
+}
+
+// TestDoLokiRequest_FailoverPost verifies that a POST moves on from a replica that cannot be reached,
+// but is not sent again after a replica that received it failed
+func TestDoLokiRequest_FailoverPost(t *testing.T) {
+	resetLokiReplicaFailures(t)
+	t.Setenv(EnvLokiMaxRetries, "0")
+
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	down.Close()
+	var failing atomic.Int32
+	unavailable := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		failing.Add(1)
+		http.Error(w, "ingester unavailable", http.StatusInternalServerError)
+	}))
+	defer unavailable.Close()
+	var served atomic.Int32
+	healthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		served.Add(1)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer healthy.Close()
+
+	ctx := withLokiMethod(context.Background(), http.MethodPost)
+	t.Setenv(EnvLokiURLs, strings.Join([]string{down.URL, healthy.URL}, ","))
+	if _, err := doLokiRequest(ctx, down.URL+"/loki/api/v1/delete", "", "", "", ""); err != nil || served.Load() != 1 {
+		t.Errorf("Expected the POST to reach the healthy replica, got %v after %d requests", err, served.Load())
+	}
+
+	resetLokiReplicaFailures(t)
+	t.Setenv(EnvLokiURLs, strings.Join([]string{unavailable.URL, healthy.URL}, ","))
+	_, err := doLokiRequest(ctx, unavailable.URL+"/loki/api/v1/delete", "", "", "", "")
+	if err == nil || failing.Load() != 1 || served.Load() != 1 {
+		t.Errorf("Expected the POST not to be sent again, got %v after %d requests to the other replica", err, served.Load()-1)
+	}
+}
@@ -0,0 +1,174 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// lokiNonJSONModes lists how field projection treats lines that are not JSON objects: skip them,
+// pass them through unchanged, or pass them through with a marker
+var lokiNonJSONModes = []string{"skip", "pass", "flag"}
+
+// Marker shown before lines that are not JSON objects in the flag mode
+const lokiNonJSONMarker = "[not JSON]"
+
+// Placeholder shown for fields missing from a line
+const lokiMissingField = "-"
+
+// resolveLokiFields validates the fields to project and how lines that are not JSON are treated
+func resolveLokiFields(fields []string, nonJSON, format string) (string, error) {
+	if len(fields) == 0 {
+		if nonJSON != "" {
+			return "", fmt.Errorf("nonJson requires fields")
+		}
+		return "", nil
+	}
+	if format != "" {
+		return "", fmt.Errorf("fields cannot be combined with format %q: projected fields are shown as a table", format)
+	}
+	for _, field := range fields {
+		if strings.TrimSpace(field) == "" {
+			return "", fmt.Errorf("fields must not contain empty names")
+		}
+	}
+
+	if nonJSON == "" {
+		return "skip", nil
+	}
+	if !slices.Contains(lokiNonJSONModes, nonJSON) {
+		return "", fmt.Errorf("invalid nonJson %q: must be one of %s", nonJSON, strings.Join(lokiNonJSONModes, ", "))
+	}
+	return nonJSON, nil
+}
+
+// lookupLokiField returns the value of field in a JSON object as text. A dotted name such as
+// http.status reaches into nested objects when no top-level key has that name.
+func lookupLokiField(object map[string]any, field string) (string, bool) {
+	value, ok := object[field]
+	if !ok {
+		var current any = object
+		for _, part := range strings.Split(field, ".") {
+			nested, isObject := current.(map[string]any)
+			if !isObject {
+				return "", false
+			}
+			if current, ok = nested[part]; !ok {
+				return "", false
+			}
+		}
+		value = current
+	}
+
+	var text string
+	switch v := value.(type) {
+	case string:
+		text = v
+	case nil:
+		text = "null"
+	default:
+		encoded, err := json.Marshal(v)
+		if err != nil {
+			return "", false
+		}
+		text = string(encoded)
+	}
+	// Keep each entry on a single row
+	return strings.NewReplacer("\n", `\n`, "\r", `\r`, "\t", `\t`).Replace(text), true
+}
+
+// formatLokiFields formats results as one table per stream with a timestamp column followed by a
+// column per requested JSON field. Lines that are not JSON objects are skipped, passed through
+// or flagged according to nonJSON.
+func formatLokiFields(result *LokiResult, fields []string, nonJSON string) string {
+	if len(result.Data.Result) == 0 {
+		return "No logs found matching the query"
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Found %d streams:\n\n", len(result.Data.Result))
+
+	skipped := 0
+	for i, entry := range result.Data.Result {
+		fmt.Fprintf(&b, "Stream %d %s:\n", i+1, formatMetricLabels(entry.Stream))
+
+		// Each row holds the timestamp and the field values, or the timestamp and a raw line
+		header := append([]string{"timestamp"}, fields...)
+		rows := [][]string{header}
+		raw := []bool{false}
+		for _, val := range entry.Values {
+			if len(val) < 2 {
+				continue
+			}
+			timestamp := val[0]
+			if ts, err := strconv.ParseFloat(val[0], 64); err == nil {
+				timestamp = time.Unix(0, int64(ts)).Format(time.RFC3339)
+			}
+
+			var object map[string]any
+			if err := json.Unmarshal([]byte(val[1]), &object); err != nil || object == nil {
+				switch nonJSON {
+				case "pass":
+					rows, raw = append(rows, []string{timestamp, val[1]}), append(raw, true)
+				case "flag":
+					rows, raw = append(rows, []string{timestamp, lokiNonJSONMarker + " " + val[1]}), append(raw, true)
+				default:
+					skipped++
+				}
+				continue
+			}
+
+			row := []string{timestamp}
+			for _, field := range fields {
+				value, ok := lookupLokiField(object, field)
+				if !ok {
+					value = lokiMissingField
+				}
+				row = append(row, value)
+			}
+			rows, raw = append(rows, row), append(raw, false)
+		}
+
+		writeLokiFieldRows(&b, rows, raw)
+		b.WriteString("\n")
+	}
+
+	if skipped > 0 {
+		fmt.Fprintf(&b, "Skipped %d lines that are not JSON objects\n", skipped)
+	}
+	return b.String()
+}
+
+// writeLokiFieldRows writes rows as aligned columns. Raw rows do not take part in the alignment.
+func writeLokiFieldRows(b *strings.Builder, rows [][]string, raw []bool) {
+	var widths []int
+	for i, row := range rows {
+		if raw[i] {
+			continue
+		}
+		for j, cell := range row {
+			if j == len(widths) {
+				widths = append(widths, 0)
+			}
+			widths[j] = max(widths[j], len(cell))
+		}
+	}
+
+	for i, row := range rows {
+		if raw[i] {
+			fmt.Fprintf(b, "%-*s  %s\n", widths[0], row[0], row[1])
+			continue
+		}
+		for j, cell := range row {
+			if j == len(row)-1 {
+				b.WriteString(cell)
+				break
+			}
+			fmt.Fprintf(b, "%-*s  ", widths[j], cell)
+		}
+		b.WriteString("\n")
+	}
+}
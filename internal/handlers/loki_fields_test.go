@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ThinkInAIXYZ/go-mcp/protocol"
+)
+
+// fieldsTestResult returns a stream mixing JSON and plain text lines
+func fieldsTestResult() *LokiResult {
+	return &LokiResult{
+		Status: "success",
+		Data: LokiData{
+			ResultType: "streams",
+			Result: []LokiEntry{
+				{
+					Stream: map[string]string{"app": "api"},
+					Values: [][]string{
+						{"1705312245000000000", `{"msg":"request done","trace_id":"abc123","http":{"status":200}}`},
+						{"1705312246000000000", "panic: runtime error"},
+						{"1705312247000000000", `{"msg":"multi\nline"}`},
+					},
+				},
+			},
+		},
+	}
+}
+
+// TestFormatLokiFields verifies projected columns, nested fields and missing values
+func TestFormatLokiFields(t *testing.T) {
+	output := formatLokiFields(fieldsTestResult(), []string{"msg", "trace_id", "http.status"}, "skip")
+
+	lines := strings.Split(output, "\n")
+	var header, first, second string
+	for i, line := range lines {
+		if strings.HasPrefix(line, "timestamp") {
+			header, first, second = line, lines[i+1], lines[i+2]
+			break
+		}
+	}
+	if !strings.HasPrefix(header, "timestamp") || !strings.Contains(header, "msg           trace_id  http.status") {
+		t.Errorf("Unexpected header %q in:\n%s", header, output)
+	}
+	if !strings.Contains(first, "request done  abc123    200") {
+		t.Errorf("Unexpected first row %q", first)
+	}
+	if !strings.Contains(second, `multi\nline   -         -`) {
+		t.Errorf("Unexpected second row %q", second)
+	}
+	if strings.Contains(output, "panic") || !strings.Contains(output, "Skipped 1 lines that are not JSON objects") {
+		t.Errorf("Expected the plain text line to be skipped and counted:\n%s", output)
+	}
+}
+
+// TestFormatLokiFields_NonJSON verifies that plain text lines can be passed through or flagged
+func TestFormatLokiFields_NonJSON(t *testing.T) {
+	passed := formatLokiFields(fieldsTestResult(), []string{"msg"}, "pass")
+	if !strings.Contains(passed, "  panic: runtime error\n") || strings.Contains(passed, lokiNonJSONMarker) {
+		t.Errorf("Expected the plain text line unchanged:\n%s", passed)
+	}
+
+	flagged := formatLokiFields(fieldsTestResult(), []string{"msg"}, "flag")
+	if !strings.Contains(flagged, lokiNonJSONMarker+" panic: runtime error\n") {
+		t.Errorf("Expected the plain text line to be flagged:\n%s", flagged)
+	}
+}
+
+// TestResolveLokiFields verifies validation of the fields and nonJson parameters
+func TestResolveLokiFields(t *testing.T) {
+	if mode, err := resolveLokiFields([]string{"msg"}, "", ""); err != nil || mode != "skip" {
+		t.Errorf("Expected skip by default, got %q (%v)", mode, err)
+	}
+
+	invalid := []struct {
+		fields  []string
+		nonJSON string
+		format  string
+	}{
+		{nil, "pass", ""},
+		{[]string{"msg"}, "drop", ""},
+		{[]string{"msg"}, "", "json"},
+		{[]string{"msg", " "}, "", ""},
+	}
+	for _, tc := range invalid {
+		if _, err := resolveLokiFields(tc.fields, tc.nonJSON, tc.format); err == nil {
+			t.Errorf("Expected an error for fields %v, nonJson %q and format %q", tc.fields, tc.nonJSON, tc.format)
+		}
+	}
+}
+
+// TestHandleLokiQueryProtocol_Fields verifies that the fields parameter reaches the formatter
+func TestHandleLokiQueryProtocol_Fields(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(fieldsTestResult())
+	}))
+	defer server.Close()
+
+	for _, env := range []string{EnvLokiURL, EnvLokiOrgID, EnvLokiUsername, EnvLokiPassword, EnvLokiToken} {
+		t.Setenv(env, "")
+	}
+	if _, err := NewLokiQueryToolProtocol(); err != nil {
+		t.Fatalf("Failed to create tool: %v", err)
+	}
+
+	raw, _ := json.Marshal(map[string]any{"query": `{app="api"}`, "url": server.URL, "fields": []string{"trace_id"}, "nonJson": "flag"})
+	result, err := HandleLokiQueryProtocol(context.Background(), &protocol.CallToolRequest{Name: "loki_query", RawArguments: raw})
+	if err != nil {
+		t.Fatalf("HandleLokiQueryProtocol failed: %v", err)
+	}
+
+	text := result.Content[0].(*protocol.TextContent).Text
+	if !strings.Contains(text, "abc123") || !strings.Contains(text, lokiNonJSONMarker) {
+		t.Errorf("Unexpected output:\n%s", text)
+	}
+}
@@ -0,0 +1,40 @@
+package handlers
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+)
+
+// Environment variable name for the output format used when a call does not set one
+const EnvLokiDefaultFormat = "LOKI_DEFAULT_FORMAT"
+
+// CheckLokiDefaultFormat validates LOKI_DEFAULT_FORMAT against the loki_query formats and returns
+// it, so that a typo stops the server at startup instead of being silently ignored
+func CheckLokiDefaultFormat() (string, error) {
+	format := os.Getenv(EnvLokiDefaultFormat)
+	if format == "" {
+		return "", nil
+	}
+	if !slices.Contains(lokiQueryFormats, format) {
+		return "", fmt.Errorf("invalid %s: unsupported format %q, supported formats: %s", EnvLokiDefaultFormat, format, strings.Join(lokiQueryFormats, ", "))
+	}
+	if format == "color" {
+		return "", fmt.Errorf("invalid %s: format color must be requested per call, so that clients which cannot display ANSI escapes never receive them", EnvLokiDefaultFormat)
+	}
+	return format, nil
+}
+
+// resolveLokiFormat returns the output format for a call: the requested format, then
+// LOKI_DEFAULT_FORMAT, then the LOKI_DEFAULTS format, then raw. A default the tool does not
+// support, such as signatures for the label tools, is skipped.
+func resolveLokiFormat(requested string, allowed []string) string {
+	if requested != "" {
+		return requested
+	}
+	if format, err := CheckLokiDefaultFormat(); err == nil && slices.Contains(allowed, format) {
+		return format
+	}
+	return activeLokiDefaults.formatOr("raw", allowed)
+}
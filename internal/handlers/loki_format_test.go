@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ThinkInAIXYZ/go-mcp/protocol"
+)
+
+// TestResolveLokiFormat verifies the request > LOKI_DEFAULT_FORMAT > LOKI_DEFAULTS > raw precedence
+func TestResolveLokiFormat(t *testing.T) {
+	defer func(saved *LokiDefaults) { activeLokiDefaults = saved }(activeLokiDefaults)
+	activeLokiDefaults = &LokiDefaults{}
+
+	t.Setenv(EnvLokiDefaultFormat, "")
+	if got := resolveLokiFormat("", lokiQueryFormats); got != "raw" {
+		t.Errorf("Expected raw without defaults, got %q", got)
+	}
+
+	activeLokiDefaults = &LokiDefaults{Format: "text"}
+	if got := resolveLokiFormat("", lokiQueryFormats); got != "text" {
+		t.Errorf("Expected the LOKI_DEFAULTS format, got %q", got)
+	}
+
+	t.Setenv(EnvLokiDefaultFormat, "json")
+	if got := resolveLokiFormat("", lokiQueryFormats); got != "json" {
+		t.Errorf("Expected the environment format, got %q", got)
+	}
+	if got := resolveLokiFormat("raw", lokiQueryFormats); got != "raw" {
+		t.Errorf("Expected the requested format, got %q", got)
+	}
+
+	// A default the tool does not support is skipped
+	t.Setenv(EnvLokiDefaultFormat, "signatures")
+	if got := resolveLokiFormat("", lokiQueryFormats); got != "signatures" {
+		t.Errorf("Expected signatures for loki_query, got %q", got)
+	}
+	if got := resolveLokiFormat("", lokiLabelFormats); got != "text" {
+		t.Errorf("Expected the label tools to skip signatures, got %q", got)
+	}
+}
+
+// TestCheckLokiDefaultFormat verifies that unknown formats and color are rejected
+func TestCheckLokiDefaultFormat(t *testing.T) {
+	for value, wantErr := range map[string]string{"": "", "json": "", "xml": "unsupported format \"xml\"", "color": "must be requested per call"} {
+		t.Setenv(EnvLokiDefaultFormat, value)
+		got, err := CheckLokiDefaultFormat()
+		if wantErr == "" && (err != nil || got != value) {
+			t.Errorf("%q: expected it to be accepted, got %q (%v)", value, got, err)
+		}
+		if wantErr != "" && (err == nil || !strings.Contains(err.Error(), wantErr)) {
+			t.Errorf("%q: expected error containing %q, got %v", value, wantErr, err)
+		}
+	}
+}
+
+// TestHandleLokiQueryProtocol_DefaultFormat verifies that LOKI_DEFAULT_FORMAT applies to calls without a format
+func TestHandleLokiQueryProtocol_DefaultFormat(t *testing.T) {
+	t.Setenv(EnvLokiDefaultFormat, "json")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"status":"success","data":{"resultType":"streams","result":[{"stream":{"job":"a"},"values":[["1705312800000000000","hello"]]}]}}`))
+	}))
+	defer server.Close()
+
+	if _, err := NewLokiQueryToolProtocol(); err != nil {
+		t.Fatalf("Failed to create tool: %v", err)
+	}
+	for format, want := range map[string]string{"": `"resultType": "streams"`, "raw": "hello"} {
+		args := map[string]any{"query": `{job="a"}`, "url": server.URL}
+		if format != "" {
+			args["format"] = format
+		}
+		raw, _ := json.Marshal(args)
+		result, err := HandleLokiQueryProtocol(context.Background(), &protocol.CallToolRequest{Name: "loki_query", RawArguments: raw})
+		if err != nil {
+			t.Fatalf("HandleLokiQueryProtocol failed: %v", err)
+		}
+		if text := result.Content[0].(*protocol.TextContent).Text; !strings.Contains(text, want) || (format == "raw" && strings.Contains(text, "resultType")) {
+			t.Errorf("format %q: expected %q in %q", format, want, text)
+		}
+	}
+}
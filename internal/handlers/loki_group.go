@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// lokiStreamGroup holds all entries of one stream of a grouped result
+type lokiStreamGroup struct {
+	Stream map[string]string `json:"stream"`
+	Count  int               `json:"count"`
+	Values [][]string        `json:"values"`
+}
+
+// checkLokiGroupByStream reports an error when groupByStream is requested with an output that
+// cannot show streams as sections
+func checkLokiGroupByStream(groupByStream, showDeltas bool, format string, fields []string, summarize bool) error {
+	if !groupByStream {
+		return nil
+	}
+	if len(fields) > 0 || summarize || (format != "text" && format != "json") {
+		return fmt.Errorf("groupByStream is only supported with format text or json, without fields or summarize")
+	}
+	if showDeltas {
+		return fmt.Errorf("groupByStream cannot be combined with showDeltas, which measures gaps across streams")
+	}
+	return nil
+}
+
+// groupLokiStreams merges the entries of each stream of result into one group. Groups are ordered
+// by their first entry in result, and the entries of a group keep their order, so that a result
+// sorted by time gives each stream's entries in that order with the most recently active streams
+// first for time_desc.
+func groupLokiStreams(result *LokiResult) []lokiStreamGroup {
+	groups := []lokiStreamGroup{}
+	index := make(map[string]int)
+	for _, entry := range result.Data.Result {
+		key := streamKey(entry.Stream)
+		i, ok := index[key]
+		if !ok {
+			i = len(groups)
+			index[key] = i
+			groups = append(groups, lokiStreamGroup{Stream: entry.Stream, Values: [][]string{}})
+		}
+		groups[i].Values = append(groups[i].Values, entry.Values...)
+		groups[i].Count += len(entry.Values)
+	}
+	return groups
+}
+
+// formatLokiGroupedResults formats a log result as one section per stream, each headed by the
+// stream's labels and entry count, like Grafana's log view
+func formatLokiGroupedResults(result *LokiResult, format string) (string, error) {
+	groups := groupLokiStreams(result)
+
+	switch format {
+	case "json":
+		// Return the groups instead of Loki's streams, which may split a stream in several parts
+		grouped := struct {
+			Status  string            `json:"status"`
+			Streams []lokiStreamGroup `json:"streams"`
+		}{Status: result.Status, Streams: groups}
+		jsonBytes, err := json.MarshalIndent(grouped, "", "  ")
+		if err != nil {
+			return "", fmt.Errorf("failed to marshal JSON: %v", err)
+		}
+		return string(jsonBytes), nil
+
+	case "text":
+		if len(groups) == 0 {
+			return "No logs found matching the query", nil
+		}
+
+		var b strings.Builder
+		fmt.Fprintf(&b, "Found %d streams:\n\n", len(groups))
+		for i, group := range groups {
+			keys := make([]string, 0, len(group.Stream))
+			for k := range group.Stream {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			labels := make([]string, 0, len(keys))
+			for _, k := range keys {
+				labels = append(labels, fmt.Sprintf("%s=%s", k, group.Stream[k]))
+			}
+
+			fmt.Fprintf(&b, "Stream %d (%s): %d entries\n", i+1, strings.Join(labels, ", "), group.Count)
+			for _, val := range group.Values {
+				if len(val) < 2 {
+					continue
+				}
+				timestamp := val[0]
+				if ts, err := strconv.ParseInt(val[0], 10, 64); err == nil {
+					timestamp = time.Unix(0, ts).Format(time.RFC3339)
+				}
+				fmt.Fprintf(&b, "  [%s] %s\n", timestamp, val[1])
+			}
+			b.WriteString("\n")
+		}
+		return b.String() + lokiResultFooter(result), nil
+
+	default:
+		return "", fmt.Errorf("groupByStream is not supported with format %s", format)
+	}
+}
@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ThinkInAIXYZ/go-mcp/protocol"
+)
+
+// TestGroupLokiStreams verifies that the parts of a stream split by sorting are merged in order
+func TestGroupLokiStreams(t *testing.T) {
+	result := &LokiResult{Data: LokiData{ResultType: "streams", Result: []LokiEntry{
+		{Stream: map[string]string{"job": "a"}, Values: [][]string{{"3000000000", "a3"}}},
+		{Stream: map[string]string{"job": "b"}, Values: [][]string{{"2000000000", "b2"}}},
+		{Stream: map[string]string{"job": "a"}, Values: [][]string{{"1000000000", "a1"}}},
+	}}}
+
+	groups := groupLokiStreams(result)
+	if len(groups) != 2 || groups[0].Stream["job"] != "a" || groups[1].Stream["job"] != "b" {
+		t.Fatalf("Expected groups a and b in order of first entry, got %+v", groups)
+	}
+	if groups[0].Count != 2 || groups[0].Values[0][1] != "a3" || groups[0].Values[1][1] != "a1" {
+		t.Errorf("Expected both entries of a in their order, got %+v", groups[0])
+	}
+}
+
+// TestCheckLokiGroupByStream verifies the supported formats and combinations
+func TestCheckLokiGroupByStream(t *testing.T) {
+	for _, format := range []string{"text", "json"} {
+		if err := checkLokiGroupByStream(true, false, format, nil, false); err != nil {
+			t.Errorf("Unexpected error for %s: %v", format, err)
+		}
+	}
+	if err := checkLokiGroupByStream(true, false, "raw", nil, false); err == nil {
+		t.Error("Expected error for raw format")
+	}
+	if err := checkLokiGroupByStream(true, false, "text", []string{"level"}, false); err == nil {
+		t.Error("Expected error with fields")
+	}
+	if err := checkLokiGroupByStream(true, true, "text", nil, false); err == nil || !strings.Contains(err.Error(), "showDeltas") {
+		t.Errorf("Expected showDeltas error, got %v", err)
+	}
+	if err := checkLokiGroupByStream(false, false, "raw", nil, true); err != nil {
+		t.Errorf("Unexpected error without groupByStream: %v", err)
+	}
+}
+
+// TestHandleLokiQueryProtocol_GroupByStream verifies the text and json sections of a grouped result
+func TestHandleLokiQueryProtocol_GroupByStream(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"status":"success","data":{"resultType":"streams","result":[
+			{"stream":{"job":"api","pod":"a"},"values":[["1705312803000000000","a late"],["1705312801000000000","a early"]]},
+			{"stream":{"job":"api","pod":"b"},"values":[["1705312802000000000","b only"]]}]}}`))
+	}))
+	defer server.Close()
+
+	if _, err := NewLokiQueryToolProtocol(); err != nil {
+		t.Fatalf("Failed to create tool: %v", err)
+	}
+	call := func(format string) string {
+		raw, _ := json.Marshal(map[string]any{"query": `{job="api"}`, "url": server.URL, "format": format, "groupByStream": true})
+		result, err := HandleLokiQueryProtocol(context.Background(), &protocol.CallToolRequest{Name: "loki_query", RawArguments: raw})
+		if err != nil {
+			t.Fatalf("HandleLokiQueryProtocol failed: %v", err)
+		}
+		return result.Content[0].(*protocol.TextContent).Text
+	}
+
+	text := call("text")
+	for _, want := range []string{"Found 2 streams", "Stream 1 (job=api, pod=a): 2 entries\n", "Stream 2 (job=api, pod=b): 1 entries\n"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("Expected %q in text output %q", want, text)
+		}
+	}
+	if strings.Index(text, "a late") > strings.Index(text, "a early") || strings.Index(text, "a early") > strings.Index(text, "b only") {
+		t.Errorf("Expected the entries of pod a together, newest first, got %q", text)
+	}
+
+	var grouped struct {
+		Streams []lokiStreamGroup `json:"streams"`
+	}
+	if err := json.Unmarshal([]byte(call("json")), &grouped); err != nil {
+		t.Fatalf("Expected parseable json: %v", err)
+	}
+	if len(grouped.Streams) != 2 || grouped.Streams[0].Count != 2 || grouped.Streams[1].Count != 1 {
+		t.Errorf("Unexpected json groups %+v", grouped.Streams)
+	}
+}
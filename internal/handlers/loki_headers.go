@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// Environment variable name for extra headers sent with every Loki request, as k1=v1,k2=v2
+const EnvLokiExtraHeaders = "LOKI_EXTRA_HEADERS"
+
+// Headers managed by the HTTP client that extra headers may never set
+var reservedLokiHeaders = map[string]bool{
+	"Accept-Encoding":   true,
+	"Connection":        true,
+	"Content-Length":    true,
+	"Host":              true,
+	"Transfer-Encoding": true,
+	"Upgrade":           true,
+}
+
+// lokiHeadersKey is the context key holding the extra headers requested for Loki calls
+type lokiHeadersKey struct{}
+
+// withLokiHeaders records per-request headers that setLokiRequestHeaders adds to calls made with ctx
+func withLokiHeaders(ctx context.Context, headers map[string]string) context.Context {
+	if len(headers) == 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, lokiHeadersKey{}, headers)
+}
+
+// parseLokiExtraHeaders parses a k1=v1,k2=v2 header list. Values may contain '=' but not ','.
+func parseLokiExtraHeaders(raw string) (map[string]string, error) {
+	headers := make(map[string]string)
+	for _, part := range strings.Split(raw, ",") {
+		if strings.TrimSpace(part) == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(part, "=")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid %s entry %q: expected name=value", EnvLokiExtraHeaders, strings.TrimSpace(part))
+		}
+		headers[name] = strings.TrimSpace(value)
+	}
+	return headers, nil
+}
+
+// applyLokiExtraHeaders adds the per-request headers from ctx, then LOKI_EXTRA_HEADERS.
+// Headers already on the request, such as the Authorization and X-Scope-OrgID headers set
+// from the auth and org options, are never replaced; they can only be supplied this way
+// when the corresponding option is unset.
+func applyLokiExtraHeaders(ctx context.Context, req *http.Request) error {
+	requested, _ := ctx.Value(lokiHeadersKey{}).(map[string]string)
+	if err := addLokiHeaders(req, requested, "headers"); err != nil {
+		return err
+	}
+
+	raw := os.Getenv(EnvLokiExtraHeaders)
+	if raw == "" {
+		return nil
+	}
+	configured, err := parseLokiExtraHeaders(raw)
+	if err != nil {
+		return err
+	}
+	return addLokiHeaders(req, configured, EnvLokiExtraHeaders)
+}
+
+// addLokiHeaders sets each header that is not already present on req
+func addLokiHeaders(req *http.Request, headers map[string]string, source string) error {
+	for name, value := range headers {
+		canonical := http.CanonicalHeaderKey(strings.TrimSpace(name))
+		if canonical == "" {
+			return fmt.Errorf("invalid %s: empty header name", source)
+		}
+		if reservedLokiHeaders[canonical] {
+			return fmt.Errorf("invalid %s: header %q is managed by the client and cannot be set", source, canonical)
+		}
+		if req.Header.Get(canonical) == "" {
+			req.Header.Set(canonical, value)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ThinkInAIXYZ/go-mcp/protocol"
+)
+
+// TestParseLokiExtraHeaders verifies parsing of the LOKI_EXTRA_HEADERS list
+func TestParseLokiExtraHeaders(t *testing.T) {
+	headers, err := parseLokiExtraHeaders("X-Api-Key=abc, Cookie=session=xyz,,")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if headers["X-Api-Key"] != "abc" || headers["Cookie"] != "session=xyz" || len(headers) != 2 {
+		t.Errorf("Unexpected headers: %v", headers)
+	}
+
+	for _, invalid := range []string{"X-Api-Key", "=value"} {
+		if _, err := parseLokiExtraHeaders(invalid); err == nil {
+			t.Errorf("Expected error for %q", invalid)
+		}
+	}
+}
+
+// TestHandleLokiLabelNamesProtocol_ExtraHeaders verifies precedence of request, environment and built-in headers
+func TestHandleLokiLabelNamesProtocol_ExtraHeaders(t *testing.T) {
+	var lastRequest *http.Request
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lastRequest = r
+		w.Write([]byte(`{"status":"success","data":["job"]}`))
+	}))
+	defer server.Close()
+
+	for _, env := range []string{EnvLokiURL, EnvLokiOrgID, EnvLokiUsername, EnvLokiPassword, EnvLokiToken} {
+		t.Setenv(env, "")
+	}
+	t.Setenv(EnvLokiExtraHeaders, "X-Api-Key=from-env,X-Proxy=proxy-1,X-Scope-OrgID=env-org")
+
+	if _, err := NewLokiLabelNamesToolProtocol(); err != nil {
+		t.Fatalf("Failed to create tool: %v", err)
+	}
+
+	call := func(args map[string]any) error {
+		t.Helper()
+		args["url"] = server.URL
+		raw, _ := json.Marshal(args)
+		_, err := HandleLokiLabelNamesProtocol(context.Background(), &protocol.CallToolRequest{Name: "loki_label_names", RawArguments: raw})
+		return err
+	}
+
+	err := call(map[string]any{
+		"token":   "secret",
+		"org":     "tenant-1",
+		"headers": map[string]string{"X-Api-Key": "from-request", "Authorization": "Basic clobber"},
+	})
+	if err != nil {
+		t.Fatalf("HandleLokiLabelNamesProtocol failed: %v", err)
+	}
+
+	expected := map[string]string{
+		"X-Api-Key":     "from-request",
+		"X-Proxy":       "proxy-1",
+		"Authorization": "Bearer secret",
+		"X-Scope-Orgid": "tenant-1",
+	}
+	for name, want := range expected {
+		if got := lastRequest.Header.Get(name); got != want {
+			t.Errorf("Header %s: expected %q, got %q", name, want, got)
+		}
+	}
+
+	// Without an org option, the extra header supplies it
+	if err := call(map[string]any{}); err != nil {
+		t.Fatalf("HandleLokiLabelNamesProtocol failed: %v", err)
+	}
+	if got := lastRequest.Header.Get("X-Scope-OrgID"); got != "env-org" {
+		t.Errorf("Expected X-Scope-OrgID from LOKI_EXTRA_HEADERS, got %q", got)
+	}
+
+	// Headers managed by the client are rejected
+	err = call(map[string]any{"headers": map[string]string{"Host": "evil.example.com"}})
+	if err == nil || !strings.Contains(err.Error(), "cannot be set") {
+		t.Errorf("Expected reserved header error, got %v", err)
+	}
+}
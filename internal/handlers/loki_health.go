@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Environment variable name for also requiring a successful Loki /ready check in the readiness probe
+const EnvLokiReadyCheck = "LOKI_READY_CHECK"
+
+// Maximum time the readiness probe waits for Loki's /ready endpoint
+const lokiReadyTimeout = 2 * time.Second
+
+// How long the result of a Loki /ready check is reused by later probes
+const lokiReadyCacheTTL = 5 * time.Second
+
+// HandleHealthz is the liveness probe; it answers 200 OK as long as the process serves HTTP
+func HandleHealthz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte("ok\n"))
+}
+
+// LokiReadiness is the readiness probe. It answers 503 until MarkReady is called once the
+// tools are registered and, when LOKI_READY_CHECK is enabled, while Loki's /ready fails.
+type LokiReadiness struct {
+	ready      atomic.Bool
+	checkLoki  bool
+	mu         sync.Mutex
+	checkedAt  time.Time
+	lastErr    error
+	now        func() time.Time
+	checkReady func(ctx context.Context) error
+}
+
+// NewLokiReadiness creates a readiness probe configured from the environment
+func NewLokiReadiness() (*LokiReadiness, error) {
+	r := &LokiReadiness{
+		now:        time.Now,
+		checkReady: checkLokiReady,
+	}
+
+	if value := os.Getenv(EnvLokiReadyCheck); value != "" {
+		checkLoki, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %q must be true or false", EnvLokiReadyCheck, value)
+		}
+		r.checkLoki = checkLoki
+	}
+
+	return r, nil
+}
+
+// MarkReady records that the server has finished starting up
+func (r *LokiReadiness) MarkReady() {
+	r.ready.Store(true)
+}
+
+// ServeHTTP answers 200 OK when the server is ready and 503 Service Unavailable otherwise
+func (r *LokiReadiness) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if err := r.check(req.Context()); err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprintf(w, "not ready: %v\n", err)
+		return
+	}
+	w.Write([]byte("ready\n"))
+}
+
+// check reports why the server is not ready, reusing a recent Loki result so that frequent
+// probes do not each reach Loki
+func (r *LokiReadiness) check(ctx context.Context) error {
+	if !r.ready.Load() {
+		return fmt.Errorf("tools are not registered yet")
+	}
+	if !r.checkLoki {
+		return nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.checkedAt.IsZero() || r.now().Sub(r.checkedAt) >= lokiReadyCacheTTL {
+		ctx, cancel := context.WithTimeout(ctx, lokiReadyTimeout)
+		defer cancel()
+		r.lastErr = r.checkReady(ctx)
+		r.checkedAt = r.now()
+	}
+	return r.lastErr
+}
+
+// checkLokiReady makes a single request, without retries, to the /ready endpoint of the configured Loki
+func checkLokiReady(ctx context.Context) error {
+	lokiURL := lokiDefaultURL()
+	username := os.Getenv(EnvLokiUsername)
+	password := os.Getenv(EnvLokiPassword)
+	token := os.Getenv(EnvLokiToken)
+	orgID := getEnvOrDefault("", EnvLokiOrgID, activeLokiDefaults.Org)
+
+	readyURL, err := buildLokiReadyURL(lokiURL)
+	if err != nil {
+		return fmt.Errorf("failed to build ready URL: %v", err)
+	}
+
+	if _, _, err := sendLokiRequest(ctx, readyURL, username, password, token, orgID); err != nil {
+		return fmt.Errorf("loki is not ready: %v", err)
+	}
+	return nil
+}
+
+// buildLokiReadyURL constructs the URL of Loki's /ready endpoint, which sits next to /loki/api/v1
+func buildLokiReadyURL(baseURL string) (string, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return "", err
+	}
+
+	path := u.Path
+	if i := strings.Index(path, "/loki/api/v1"); i >= 0 {
+		path = path[:i]
+	}
+	u.Path = strings.TrimSuffix(path, "/") + "/ready"
+	u.RawQuery = ""
+
+	return u.String(), nil
+}
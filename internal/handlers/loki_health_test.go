@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestHandleHealthz verifies that the liveness probe always succeeds
+func TestHandleHealthz(t *testing.T) {
+	rec := httptest.NewRecorder()
+	HandleHealthz(rec, httptest.NewRequest("GET", "/healthz", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected 200, got %d", rec.Code)
+	}
+}
+
+// TestLokiReadiness_Startup verifies that the readiness probe fails until the server is marked ready
+func TestLokiReadiness_Startup(t *testing.T) {
+	t.Setenv(EnvLokiReadyCheck, "")
+	readiness, err := NewLokiReadiness()
+	if err != nil {
+		t.Fatalf("NewLokiReadiness failed: %v", err)
+	}
+
+	rec := httptest.NewRecorder()
+	readiness.ServeHTTP(rec, httptest.NewRequest("GET", "/readyz", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503 before startup, got %d", rec.Code)
+	}
+
+	readiness.MarkReady()
+	rec = httptest.NewRecorder()
+	readiness.ServeHTTP(rec, httptest.NewRequest("GET", "/readyz", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected 200 after startup, got %d", rec.Code)
+	}
+}
+
+// TestLokiReadiness_InvalidCheck verifies that an invalid LOKI_READY_CHECK is rejected
+func TestLokiReadiness_InvalidCheck(t *testing.T) {
+	t.Setenv(EnvLokiReadyCheck, "sometimes")
+	if _, err := NewLokiReadiness(); err == nil {
+		t.Error("Expected an error for an invalid LOKI_READY_CHECK")
+	}
+}
+
+// TestLokiReadiness_CachesLokiCheck verifies that Loki results are reused for a short time
+func TestLokiReadiness_CachesLokiCheck(t *testing.T) {
+	t.Setenv(EnvLokiReadyCheck, "true")
+	readiness, err := NewLokiReadiness()
+	if err != nil {
+		t.Fatalf("NewLokiReadiness failed: %v", err)
+	}
+	readiness.MarkReady()
+
+	now := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+	readiness.now = func() time.Time { return now }
+	var checks int
+	var lokiErr error
+	readiness.checkReady = func(ctx context.Context) error {
+		checks++
+		return lokiErr
+	}
+
+	lokiErr = fmt.Errorf("loki is not ready")
+	for i := 0; i < 3; i++ {
+		rec := httptest.NewRecorder()
+		readiness.ServeHTTP(rec, httptest.NewRequest("GET", "/readyz", nil))
+		if rec.Code != http.StatusServiceUnavailable {
+			t.Errorf("Expected 503 while Loki is not ready, got %d", rec.Code)
+		}
+	}
+	if checks != 1 {
+		t.Errorf("Expected 1 Loki check, got %d", checks)
+	}
+
+	lokiErr = nil
+	now = now.Add(lokiReadyCacheTTL)
+	rec := httptest.NewRecorder()
+	readiness.ServeHTTP(rec, httptest.NewRequest("GET", "/readyz", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected 200 once Loki is ready, got %d", rec.Code)
+	}
+	if checks != 2 {
+		t.Errorf("Expected 2 Loki checks, got %d", checks)
+	}
+}
+
+// TestCheckLokiReady verifies the request made to Loki's /ready endpoint
+func TestCheckLokiReady(t *testing.T) {
+	var status atomic.Int32
+	status.Store(http.StatusOK)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/ready" {
+			t.Errorf("Expected path /ready, got %s", r.URL.Path)
+		}
+		if got := r.Header.Get("X-Scope-OrgID"); got != "tenant-1" {
+			t.Errorf("Expected org header tenant-1, got %q", got)
+		}
+		w.WriteHeader(int(status.Load()))
+		w.Write([]byte("ready"))
+	}))
+	defer server.Close()
+
+	t.Setenv(EnvLokiURL, server.URL+"/loki/api/v1")
+	t.Setenv(EnvLokiOrgID, "tenant-1")
+	if err := checkLokiReady(context.Background()); err != nil {
+		t.Errorf("Expected Loki to be ready, got %v", err)
+	}
+
+	status.Store(http.StatusServiceUnavailable)
+	if err := checkLokiReady(context.Background()); err == nil {
+		t.Error("Expected an error when Loki answers 503")
+	}
+}
+
+// TestBuildLokiReadyURL verifies that /ready is placed at the root of the Loki API
+func TestBuildLokiReadyURL(t *testing.T) {
+	tests := map[string]string{
+		"http://localhost:3100":                       "http://localhost:3100/ready",
+		"http://localhost:3100/":                      "http://localhost:3100/ready",
+		"http://gateway/loki-prod":                    "http://gateway/loki-prod/ready",
+		"http://localhost:3100/loki/api/v1":           "http://localhost:3100/ready",
+		"http://gateway/prefix/loki/api/v1/query?x=1": "http://gateway/prefix/ready",
+	}
+	for baseURL, want := range tests {
+		got, err := buildLokiReadyURL(baseURL)
+		if err != nil {
+			t.Errorf("buildLokiReadyURL(%q) failed: %v", baseURL, err)
+			continue
+		}
+		if got != want {
+			t.Errorf("buildLokiReadyURL(%q) = %q, want %q", baseURL, got, want)
+		}
+	}
+}
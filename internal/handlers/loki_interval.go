@@ -0,0 +1,37 @@
+package handlers
+
+import (
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// resolveLokiInterval validates the interval option of loki_query and returns it, or 0 when no
+// interval was requested
+func resolveLokiInterval(value string) (time.Duration, error) {
+	if value == "" {
+		return 0, nil
+	}
+	return parsePositiveDuration("interval", value)
+}
+
+// buildLokiIntervalQueryURL constructs the Loki query URL like buildLokiQueryURL, adding the
+// interval parameter so that Loki returns only entries at least interval apart. A zero interval
+// leaves it out.
+func buildLokiIntervalQueryURL(baseURL, query string, start, end int64, limit int, direction string, interval time.Duration) (string, error) {
+	queryURL, err := buildLokiQueryURL(baseURL, query, start, end, limit, direction)
+	if err != nil || interval == 0 {
+		return queryURL, err
+	}
+
+	u, err := url.Parse(queryURL)
+	if err != nil {
+		return "", err
+	}
+
+	q := u.Query()
+	q.Set("interval", strconv.FormatFloat(interval.Seconds(), 'f', -1, 64))
+	u.RawQuery = q.Encode()
+
+	return u.String(), nil
+}
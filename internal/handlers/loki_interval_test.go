@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ThinkInAIXYZ/go-mcp/protocol"
+)
+
+// TestResolveLokiInterval verifies that intervals are durations or seconds and positive
+func TestResolveLokiInterval(t *testing.T) {
+	tests := map[string]time.Duration{"": 0, "30s": 30 * time.Second, "5m": 5 * time.Minute, "90": 90 * time.Second}
+	for value, want := range tests {
+		if got, err := resolveLokiInterval(value); err != nil || got != want {
+			t.Errorf("resolveLokiInterval(%q) = %v, %v, want %v", value, got, err, want)
+		}
+	}
+	for _, value := range []string{"0s", "-1m", "often"} {
+		if _, err := resolveLokiInterval(value); err == nil {
+			t.Errorf("Expected error for %q", value)
+		}
+	}
+}
+
+// TestBuildLokiIntervalQueryURL verifies that the interval is sent in seconds and left out when zero
+func TestBuildLokiIntervalQueryURL(t *testing.T) {
+	queryURL, err := buildLokiIntervalQueryURL("http://loki:3100", `{job="a"}`, 1, 2, 10, "forward", 1500*time.Millisecond)
+	if err != nil {
+		t.Fatalf("Failed to build URL: %v", err)
+	}
+	u, _ := url.Parse(queryURL)
+	if q := u.Query(); q.Get("interval") != "1.5" || q.Get("limit") != "10" || q.Get("direction") != "forward" {
+		t.Errorf("Unexpected parameters %v", q)
+	}
+
+	queryURL, _ = buildLokiIntervalQueryURL("http://loki:3100", `{job="a"}`, 1, 2, 10, "", 0)
+	if strings.Contains(queryURL, "interval") {
+		t.Errorf("Expected no interval, got %s", queryURL)
+	}
+}
+
+// TestHandleLokiQueryProtocol_Interval verifies that the interval reaches Loki and that options it
+// cannot apply to are refused
+func TestHandleLokiQueryProtocol_Interval(t *testing.T) {
+	var intervals []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		intervals = append(intervals, r.URL.Query().Get("interval"))
+		if strings.HasPrefix(r.URL.Query().Get("query"), "rate(") {
+			w.Write([]byte(`{"status":"success","data":{"resultType":"matrix","result":[]}}`))
+			return
+		}
+		w.Write([]byte(`{"status":"success","data":{"resultType":"streams","result":[{"stream":{"job":"a"},"values":[["1705312800000000000","sampled"]]}]}}`))
+	}))
+	defer server.Close()
+
+	NewLokiQueryToolProtocol()
+	call := func(args map[string]any) (*protocol.CallToolResult, error) {
+		args["url"] = server.URL
+		raw, _ := json.Marshal(args)
+		return HandleLokiQueryProtocol(context.Background(), &protocol.CallToolRequest{RawArguments: raw})
+	}
+
+	result, err := call(map[string]any{"query": `{job="a"}`, "interval": "5m", "format": "raw"})
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if len(intervals) != 1 || intervals[0] != "300" {
+		t.Errorf("Expected interval 300, got %q", intervals)
+	}
+	if text := result.Content[0].(*protocol.TextContent).Text; !strings.Contains(text, "sampled") {
+		t.Errorf("Expected the sampled entry, got %s", text)
+	}
+
+	if _, err := call(map[string]any{"query": `{job="a"}`, "interval": "soon"}); err == nil {
+		t.Error("Expected error for an invalid interval")
+	}
+	if _, err := call(map[string]any{"query": `{job="a"}`, "interval": "1m", "countOnly": true}); err == nil || !strings.Contains(err.Error(), "interval") {
+		t.Errorf("Expected countOnly to refuse interval, got %v", err)
+	}
+	if _, err := call(map[string]any{"query": `rate({job="a"}[5m])`, "interval": "1m"}); err == nil || !strings.Contains(err.Error(), "interval") {
+		t.Errorf("Expected a metric query to refuse interval, got %v", err)
+	}
+}
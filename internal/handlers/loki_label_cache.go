@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Environment variable name for how long label names and values are cached, 0 disables the cache
+const EnvLokiLabelCacheTTL = "LOKI_LABEL_CACHE_TTL"
+
+// Environment variable name for the maximum number of cached label responses
+const EnvLokiLabelCacheSize = "LOKI_LABEL_CACHE_SIZE"
+
+// Default time label names and values are cached
+const DefaultLokiLabelCacheTTL = 60 * time.Second
+
+// Default maximum number of cached label responses
+const DefaultLokiLabelCacheSize = 256
+
+// newLokiLabelCache creates an empty label cache
+func newLokiLabelCache() *lokiCache[[]string] {
+	return newLokiCache(func(data []string) []string { return append([]string(nil), data...) })
+}
+
+// Cache shared by the label names and label values executors
+var lokiLabels = newLokiLabelCache()
+
+// resolveLokiLabelCache returns the cache TTL and size from the environment. A TTL of 0, in any
+// unit such as 0s, disables the cache and is returned as 0.
+func resolveLokiLabelCache() (time.Duration, int, error) {
+	ttl := DefaultLokiLabelCacheTTL
+	if value := os.Getenv(EnvLokiLabelCacheTTL); value != "" {
+		parsed, err := parseDuration(value)
+		if err != nil {
+			return 0, 0, fmt.Errorf("invalid %s: %v", EnvLokiLabelCacheTTL, err)
+		}
+		if parsed < 0 {
+			return 0, 0, fmt.Errorf("invalid %s: %q must not be negative", EnvLokiLabelCacheTTL, value)
+		}
+		if parsed == 0 {
+			return 0, 0, nil
+		}
+		ttl = parsed
+	}
+
+	size, err := lokiLimitFromEnv(EnvLokiLabelCacheSize, DefaultLokiLabelCacheSize)
+	if err != nil {
+		return 0, 0, err
+	}
+	return ttl, size, nil
+}
+
+// CheckLokiLabelCache validates the label cache settings so that mistakes are reported at
+// startup, and returns the TTL, 0 if the cache is disabled, and the size
+func CheckLokiLabelCache() (time.Duration, int, error) {
+	return resolveLokiLabelCache()
+}
+
+// lokiLabelCacheKey identifies a label request by its URL, tenant and credentials. The start and
+// end parameters are rounded down to multiples of ttl, so that repeated calls with a default
+// range ending now share an entry for up to ttl. The key is a digest, so no credentials are kept.
+func lokiLabelCacheKey(ctx context.Context, queryURL string, ttl time.Duration, username, password, token, orgID string) (string, error) {
+	u, err := url.Parse(queryURL)
+	if err != nil {
+		return "", err
+	}
+
+	q := u.Query()
+	for _, name := range []string{"start", "end"} {
+		if t, ok := parseUnixTimestamp(q.Get(name)); ok {
+			q.Set(name, strconv.FormatInt(t.UnixNano()/int64(ttl), 10))
+		}
+	}
+	u.RawQuery = q.Encode()
+
+	return lokiRequestKey(ctx, u.String(), username, password, token, orgID), nil
+}
+
+// cachedLokiLabels returns the cached data for a label request, or calls fetch and caches its result
+func cachedLokiLabels(ctx context.Context, queryURL, username, password, token, orgID string, fetch func() ([]string, error)) ([]string, error) {
+	ttl, size, err := resolveLokiLabelCache()
+	if err != nil || ttl <= 0 {
+		return fetch() // invalid settings are reported at startup by CheckLokiLabelCache
+	}
+
+	key, err := lokiLabelCacheKey(ctx, queryURL, ttl, username, password, token, orgID)
+	if err != nil {
+		return fetch()
+	}
+	if data, ok := lokiLabels.get(key); ok {
+		lokiLogger(ctx).Debug("Label cache hit", "url", redactLokiURL(queryURL))
+		return data, nil
+	}
+
+	data, err := fetch()
+	if err != nil {
+		return nil, err
+	}
+	lokiLabels.put(key, data, ttl, size)
+	return data, nil
+}
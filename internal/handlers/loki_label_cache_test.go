@@ -0,0 +1,164 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestLokiLabelCache_TTLAndLRU verifies expiry and least recently used eviction
+func TestLokiLabelCache_TTLAndLRU(t *testing.T) {
+	now := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+	cache := newLokiLabelCache()
+	cache.now = func() time.Time { return now }
+
+	cache.put("a", []string{"job"}, time.Minute, 2)
+	cache.put("b", []string{"host"}, time.Minute, 2)
+	if _, ok := cache.get("a"); !ok {
+		t.Fatal("Expected a to be cached")
+	}
+
+	// b is now the least recently used entry
+	cache.put("c", []string{"level"}, time.Minute, 2)
+	if _, ok := cache.get("b"); ok {
+		t.Error("Expected b to be evicted")
+	}
+	if data, ok := cache.get("c"); !ok || data[0] != "level" {
+		t.Errorf("Expected c to be cached, got %v", data)
+	}
+
+	now = now.Add(time.Minute)
+	if _, ok := cache.get("a"); ok {
+		t.Error("Expected a to expire")
+	}
+	if len(cache.entries) != 1 || cache.order.Len() != 1 {
+		t.Errorf("Expected expired entry to be removed, %d entries left", len(cache.entries))
+	}
+}
+
+// TestResolveLokiLabelCache verifies the defaults, disabling and validation of the label cache settings
+func TestResolveLokiLabelCache(t *testing.T) {
+	t.Setenv(EnvLokiLabelCacheTTL, "")
+	t.Setenv(EnvLokiLabelCacheSize, "")
+	if ttl, size, err := resolveLokiLabelCache(); err != nil || ttl != DefaultLokiLabelCacheTTL || size != DefaultLokiLabelCacheSize {
+		t.Errorf("Expected the defaults, got %s, %d, %v", ttl, size, err)
+	}
+
+	t.Setenv(EnvLokiLabelCacheSize, "10")
+	for _, value := range []string{"0", "0s", "0m"} {
+		t.Setenv(EnvLokiLabelCacheTTL, value)
+		if ttl, _, err := resolveLokiLabelCache(); err != nil || ttl != 0 {
+			t.Errorf("Expected %q to disable the cache, got %s, %v", value, ttl, err)
+		}
+	}
+
+	t.Setenv(EnvLokiLabelCacheTTL, "5m")
+	if ttl, size, err := resolveLokiLabelCache(); err != nil || ttl != 5*time.Minute || size != 10 {
+		t.Errorf("Expected 5m and 10 entries, got %s, %d, %v", ttl, size, err)
+	}
+
+	for _, tt := range []struct{ ttl, size string }{{"soon", "10"}, {"-1m", "10"}, {"5m", "0"}, {"5m", "many"}} {
+		t.Setenv(EnvLokiLabelCacheTTL, tt.ttl)
+		t.Setenv(EnvLokiLabelCacheSize, tt.size)
+		if _, _, err := CheckLokiLabelCache(); err == nil {
+			t.Errorf("Expected TTL %q with size %q to be rejected", tt.ttl, tt.size)
+		}
+	}
+}
+
+// TestLokiLabelCache_Copies verifies that callers cannot modify cached data
+func TestLokiLabelCache_Copies(t *testing.T) {
+	cache := newLokiLabelCache()
+	data := []string{"b", "a"}
+	cache.put("k", data, time.Minute, 10)
+	data[0] = "changed"
+
+	got, _ := cache.get("k")
+	got[1] = "changed"
+	if again, _ := cache.get("k"); again[0] != "b" || again[1] != "a" {
+		t.Errorf("Expected cached data to be unchanged, got %v", again)
+	}
+}
+
+// TestLokiLabelCacheKey verifies time bucketing and separation of tenants and credentials
+func TestLokiLabelCacheKey(t *testing.T) {
+	ctx := context.Background()
+	key := func(ctx context.Context, queryURL, token, org string) string {
+		k, err := lokiLabelCacheKey(ctx, queryURL, time.Minute, "", "", token, org)
+		if err != nil {
+			t.Fatalf("lokiLabelCacheKey failed: %v", err)
+		}
+		return k
+	}
+
+	base := key(ctx, "http://loki/loki/api/v1/labels?start=1705312200&end=1705315800", "", "")
+	if key(ctx, "http://loki/loki/api/v1/labels?start=1705312230&end=1705315830", "", "") != base {
+		t.Error("Expected ranges within the same minute to share a key")
+	}
+	if key(ctx, "http://loki/loki/api/v1/labels?start=1705312260&end=1705315860", "", "") == base {
+		t.Error("Expected ranges in the next minute to use another key")
+	}
+	if key(ctx, "http://loki/loki/api/v1/labels?start=1705312200&end=1705315800", "", "tenant-2") == base {
+		t.Error("Expected another org to use another key")
+	}
+	if key(ctx, "http://loki/loki/api/v1/labels?start=1705312200&end=1705315800", "secret", "") == base {
+		t.Error("Expected other credentials to use another key")
+	}
+	withHeaders := withLokiHeaders(ctx, map[string]string{"X-Tenant": "b"})
+	if key(withHeaders, "http://loki/loki/api/v1/labels?start=1705312200&end=1705315800", "", "") == base {
+		t.Error("Expected extra headers to use another key")
+	}
+	if key(ctx, "http://loki/loki/api/v1/label/job/values?start=1705312200&end=1705315800", "", "") == base {
+		t.Error("Expected another endpoint to use another key")
+	}
+}
+
+// TestExecuteLokiLabelValuesQuery_Cached verifies that repeated calls are served from the cache
+func TestExecuteLokiLabelValuesQuery_Cached(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"status":"success","data":["api","web"]}`))
+	}))
+	defer server.Close()
+
+	queryURL := server.URL + "/loki/api/v1/label/job/values?start=1705312200&end=1705315800"
+
+	t.Setenv(EnvLokiLabelCacheTTL, "60s")
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := executeLokiLabelValuesQuery(context.Background(), queryURL, "", "", "", ""); err != nil {
+				t.Errorf("executeLokiLabelValuesQuery failed: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	before := requests.Load()
+	result, err := executeLokiLabelValuesQuery(context.Background(), queryURL, "", "", "", "")
+	if err != nil {
+		t.Fatalf("executeLokiLabelValuesQuery failed: %v", err)
+	}
+	if requests.Load() != before {
+		t.Error("Expected a cached response")
+	}
+	if len(result.Data) != 2 || result.Status != "success" {
+		t.Errorf("Unexpected cached result: %+v", result)
+	}
+
+	t.Setenv(EnvLokiLabelCacheTTL, "0")
+	if _, err := executeLokiLabelValuesQuery(context.Background(), queryURL, "", "", "", ""); err != nil {
+		t.Fatalf("executeLokiLabelValuesQuery failed: %v", err)
+	}
+	if requests.Load() != before+1 {
+		t.Error("Expected a TTL of 0 to bypass the cache")
+	}
+}
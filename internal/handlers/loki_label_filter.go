@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// compileLokiLabelMatch compiles the match filter of loki_label_values, anchored at both ends like
+// LogQL's =~ so that it selects the same values on both sides, or returns nil when none was given
+func compileLokiLabelMatch(match string) (*regexp.Regexp, error) {
+	if match == "" {
+		return nil, nil
+	}
+	re, err := regexp.Compile("^(?:" + match + ")$")
+	if err != nil {
+		return nil, fmt.Errorf("invalid match: %v", err)
+	}
+	return re, nil
+}
+
+// lokiLabelValuesSelector returns a stream selector that lets Loki filter the values of label by
+// match and prefix itself, or "" when there is nothing to filter. Loki refuses selectors whose
+// matchers all accept the empty value, so a match that accepts it is left to filterLokiLabelValues.
+func lokiLabelValuesSelector(label, match, prefix string, re *regexp.Regexp) string {
+	var matchers []string
+	if re != nil && !re.MatchString("") {
+		matchers = append(matchers, label+"=~"+strconv.Quote(match))
+	}
+	if prefix != "" {
+		matchers = append(matchers, label+"=~"+strconv.Quote(regexp.QuoteMeta(prefix)+".*"))
+	}
+	if len(matchers) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(matchers, ", ") + "}"
+}
+
+// filterLokiLabelValues returns the values that match re and start with prefix, sorted. Loki
+// normally filtered them already, but versions that ignore the selector return every value.
+func filterLokiLabelValues(values []string, re *regexp.Regexp, prefix string) []string {
+	filtered := make([]string, 0, len(values))
+	for _, value := range values {
+		if strings.HasPrefix(value, prefix) && (re == nil || re.MatchString(value)) {
+			filtered = append(filtered, value)
+		}
+	}
+	slices.Sort(filtered)
+	return filtered
+}
+
+// resolveLokiLabelValuesLimit validates the limit on the number of label values returned, 0 for no limit
+func resolveLokiLabelValuesLimit(value float64) (int, error) {
+	if value < 0 || value != float64(int(value)) {
+		return 0, fmt.Errorf("invalid limit: %v must be a positive integer", value)
+	}
+	return int(value), nil
+}
+
+// limitLokiLabelValues returns the first limit values and, when some were cut off, a note saying
+// how many there are in total
+func limitLokiLabelValues(values []string, limit int) ([]string, string) {
+	if limit == 0 || len(values) <= limit {
+		return values, ""
+	}
+	return values[:limit], fmt.Sprintf("Showing the first %d of %d values; narrow them down with match or prefix, or raise limit", limit, len(values))
+}
+
+// mergeLokiSelectors combines the query of a loki_label_values call with the selector of its
+// filters into one selector. A query with a pipeline cannot take more matchers, so it is sent as
+// is and the filters are left to filterLokiLabelValues.
+func mergeLokiSelectors(query, filter string) string {
+	query = strings.TrimSpace(query)
+	if query == "" || filter == "" {
+		return query + filter
+	}
+	if !strings.HasPrefix(query, "{") || !strings.HasSuffix(query, "}") || strings.Count(query, "}") != 1 {
+		return query
+	}
+	return strings.TrimSuffix(query, "}") + ", " + strings.TrimPrefix(filter, "{")
+}
@@ -0,0 +1,154 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ThinkInAIXYZ/go-mcp/protocol"
+)
+
+// TestLokiLabelValuesSelector verifies the selectors sent to Loki for match and prefix filters
+func TestLokiLabelValuesSelector(t *testing.T) {
+	tests := []struct {
+		name, match, prefix, want string
+	}{
+		{name: "None"},
+		{name: "Match", match: "api-.*", want: `{pod=~"api-.*"}`},
+		{name: "Prefix", prefix: "web.1", want: `{pod=~"web\\.1.*"}`},
+		{name: "Both", match: ".*-0", prefix: "db", want: `{pod=~".*-0", pod=~"db.*"}`},
+		{name: "Match accepting empty values", match: "a*"},
+	}
+	for _, tt := range tests {
+		re, err := compileLokiLabelMatch(tt.match)
+		if err != nil {
+			t.Fatalf("%s: compileLokiLabelMatch failed: %v", tt.name, err)
+		}
+		if got := lokiLabelValuesSelector("pod", tt.match, tt.prefix, re); got != tt.want {
+			t.Errorf("%s: expected %q, got %q", tt.name, tt.want, got)
+		}
+	}
+
+	if _, err := compileLokiLabelMatch("(api"); err == nil {
+		t.Error("Expected an invalid match to be rejected")
+	}
+}
+
+// TestFilterLokiLabelValues verifies anchored matching, prefixes, sorting and truncation
+func TestFilterLokiLabelValues(t *testing.T) {
+	values := []string{"api-2", "web-1", "api-1", "my-api-1"}
+	re, _ := compileLokiLabelMatch("api-.*")
+	if got := filterLokiLabelValues(values, re, ""); strings.Join(got, ",") != "api-1,api-2" {
+		t.Errorf("Expected the values matching in full, sorted, got %v", got)
+	}
+	if got := filterLokiLabelValues(values, nil, "web"); strings.Join(got, ",") != "web-1" {
+		t.Errorf("Expected the values with the prefix, got %v", got)
+	}
+
+	limited, note := limitLokiLabelValues([]string{"a", "b", "c"}, 2)
+	if strings.Join(limited, ",") != "a,b" || !strings.Contains(note, "first 2 of 3 values") {
+		t.Errorf("Expected two values and a note, got %v, %q", limited, note)
+	}
+	if _, note := limitLokiLabelValues([]string{"a"}, 2); note != "" {
+		t.Errorf("Expected no note below the limit, got %q", note)
+	}
+	if _, err := resolveLokiLabelValuesLimit(2.5); err == nil {
+		t.Error("Expected a fractional limit to be rejected")
+	}
+}
+
+// TestHandleLokiLabelValuesProtocol_Filter verifies that the filter is sent to Loki and applied to
+// the values of a Loki that ignores it
+func TestHandleLokiLabelValuesProtocol_Filter(t *testing.T) {
+	var query string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.Query().Get("query")
+		w.Write([]byte(`{"status":"success","data":["checkout-7","api-3","checkout-2","checkout-10"]}`))
+	}))
+	defer server.Close()
+
+	if _, err := NewLokiLabelValuesToolProtocol(); err != nil {
+		t.Fatalf("Failed to create tool: %v", err)
+	}
+	raw, _ := json.Marshal(map[string]any{"label": "pod", "url": server.URL, "prefix": "checkout-", "limit": 2})
+	result, err := HandleLokiLabelValuesProtocol(context.Background(), &protocol.CallToolRequest{Name: "loki_label_values", RawArguments: raw})
+	if err != nil {
+		t.Fatalf("HandleLokiLabelValuesProtocol failed: %v", err)
+	}
+
+	if query != `{pod=~"checkout-.*"}` {
+		t.Errorf("Expected the prefix to be sent as a selector, got %q", query)
+	}
+	if output := result.Content[0].(*protocol.TextContent).Text; output != "checkout-10\ncheckout-2\n" {
+		t.Errorf("Expected the first two matching values, got %q", output)
+	}
+	if len(result.Content) != 2 || !strings.Contains(result.Content[1].(*protocol.TextContent).Text, "first 2 of 3 values") {
+		t.Errorf("Expected a note about the truncation, got %v", result.Content)
+	}
+}
+
+// TestMergeLokiSelectors verifies that filters join a plain selector and leave pipelines alone
+func TestMergeLokiSelectors(t *testing.T) {
+	tests := []struct {
+		query, filter, want string
+	}{
+		{query: "", filter: "", want: ""},
+		{query: `{namespace="foo"}`, filter: "", want: `{namespace="foo"}`},
+		{query: "", filter: `{pod=~"api.*"}`, want: `{pod=~"api.*"}`},
+		{query: ` {namespace="foo"} `, filter: `{pod=~"api.*"}`, want: `{namespace="foo", pod=~"api.*"}`},
+		{query: `{namespace="foo"} |= "x"`, filter: `{pod=~"api.*"}`, want: `{namespace="foo"} |= "x"`},
+	}
+	for _, tt := range tests {
+		if got := mergeLokiSelectors(tt.query, tt.filter); got != tt.want {
+			t.Errorf("mergeLokiSelectors(%q, %q): expected %q, got %q", tt.query, tt.filter, tt.want, got)
+		}
+	}
+}
+
+// TestHandleLokiLabelValuesProtocol_Query verifies that the query is sent to Loki, joined with the
+// filters, and that malformed selectors are rejected before any request
+func TestHandleLokiLabelValuesProtocol_Query(t *testing.T) {
+	var query string
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		query = r.URL.Query().Get("query")
+		w.Write([]byte(`{"status":"success","data":["api-1","worker-1"]}`))
+	}))
+	defer server.Close()
+
+	if _, err := NewLokiLabelValuesToolProtocol(); err != nil {
+		t.Fatalf("Failed to create tool: %v", err)
+	}
+	call := func(args map[string]any) (*protocol.CallToolResult, error) {
+		args["label"] = "pod"
+		args["url"] = server.URL
+		raw, _ := json.Marshal(args)
+		return HandleLokiLabelValuesProtocol(context.Background(), &protocol.CallToolRequest{Name: "loki_label_values", RawArguments: raw})
+	}
+
+	if _, err := call(map[string]any{"query": `{namespace="foo"}`}); err != nil {
+		t.Fatalf("HandleLokiLabelValuesProtocol failed: %v", err)
+	}
+	if query != `{namespace="foo"}` {
+		t.Errorf("Expected the query to be sent unchanged, got %q", query)
+	}
+
+	if _, err := call(map[string]any{"query": `{namespace="foo"}`, "prefix": "api"}); err != nil {
+		t.Fatalf("HandleLokiLabelValuesProtocol failed: %v", err)
+	}
+	if query != `{namespace="foo", pod=~"api.*"}` {
+		t.Errorf("Expected the prefix to join the query, got %q", query)
+	}
+
+	requests = 0
+	if _, err := call(map[string]any{"query": `{namespace="foo"`}); err == nil {
+		t.Error("Expected a malformed query to be rejected")
+	}
+	if requests != 0 {
+		t.Errorf("Expected no request to Loki for a malformed query, got %d", requests)
+	}
+}
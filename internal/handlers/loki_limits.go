@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+)
+
+// Environment variable name for the largest limit a Loki query may request
+const EnvLokiMaxLimit = "LOKI_MAX_LIMIT"
+
+// Environment variable name for the limit used when a Loki query does not set one
+const EnvLokiDefaultLimit = "LOKI_DEFAULT_LIMIT"
+
+// Default largest limit a Loki query may request
+const DefaultLokiMaxLimit = 5000
+
+// Default limit used when a Loki query does not set one
+const DefaultLokiLimit = 100
+
+// resolveLokiLimit returns the number of entries to request from Loki. An unset (zero) request
+// falls back to LOKI_DEFAULT_LIMIT, then LOKI_DEFAULTS, then DefaultLokiLimit. Limits above
+// LOKI_MAX_LIMIT are reduced to it, in which case the returned note explains the change.
+func resolveLokiLimit(requested float64) (int, string, error) {
+	if requested < 0 {
+		return 0, "", fmt.Errorf("invalid limit: %v must not be negative", requested)
+	}
+	if requested != math.Trunc(requested) {
+		return 0, "", fmt.Errorf("invalid limit: %v must be a whole number", requested)
+	}
+
+	maxLimit, err := lokiLimitFromEnv(EnvLokiMaxLimit, DefaultLokiMaxLimit)
+	if err != nil {
+		return 0, "", err
+	}
+
+	// Compare before converting, since a huge float would overflow int
+	if requested > float64(maxLimit) {
+		return maxLimit, fmt.Sprintf("limit reduced from %s to %d", strconv.FormatFloat(requested, 'f', -1, 64), maxLimit), nil
+	}
+	limit := int(requested)
+	if limit == 0 {
+		if limit, err = lokiLimitFromEnv(EnvLokiDefaultLimit, activeLokiDefaults.limitOr(DefaultLokiLimit)); err != nil {
+			return 0, "", err
+		}
+	}
+
+	if limit > maxLimit {
+		return maxLimit, fmt.Sprintf("limit reduced from %d to %d", limit, maxLimit), nil
+	}
+	return limit, "", nil
+}
+
+// lokiLimitFromEnv reads a positive integer limit from the environment variable key
+func lokiLimitFromEnv(key string, fallback int) (int, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback, nil
+	}
+	limit, err := strconv.Atoi(value)
+	if err != nil || limit <= 0 {
+		return 0, fmt.Errorf("invalid %s: %q must be a positive integer", key, value)
+	}
+	return limit, nil
+}
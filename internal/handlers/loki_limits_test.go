@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ThinkInAIXYZ/go-mcp/protocol"
+)
+
+// TestResolveLokiLimit verifies defaults, clamping and rejection of negative limits
+func TestResolveLokiLimit(t *testing.T) {
+	previous := activeLokiDefaults
+	defer func() { activeLokiDefaults = previous }()
+	activeLokiDefaults = &LokiDefaults{}
+
+	testCases := []struct {
+		name         string
+		maxLimit     string
+		defaultLimit string
+		requested    float64
+		want         int
+		wantNote     string
+		wantErr      bool
+	}{
+		{name: "Built-in default", want: 100},
+		{name: "Default from env", defaultLimit: "250", want: 250},
+		{name: "Requested", requested: 42, want: 42},
+		{name: "Clamped to built-in max", requested: 1000000, want: 5000, wantNote: "limit reduced from 1000000 to 5000"},
+		{name: "Clamped to env max", maxLimit: "50", requested: 80, want: 50, wantNote: "limit reduced from 80 to 50"},
+		{name: "Huge limit clamped", requested: 1e30, want: 5000, wantNote: "limit reduced from 1000000000000000000000000000000 to 5000"},
+		{name: "Fractional limit", requested: 10.5, wantErr: true},
+		{name: "Default clamped to max", maxLimit: "50", defaultLimit: "80", want: 50, wantNote: "limit reduced from 80 to 50"},
+		{name: "Negative", requested: -1, wantErr: true},
+		{name: "Invalid max", maxLimit: "lots", requested: 10, wantErr: true},
+		{name: "Invalid default", defaultLimit: "0", wantErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv(EnvLokiMaxLimit, tc.maxLimit)
+			t.Setenv(EnvLokiDefaultLimit, tc.defaultLimit)
+
+			got, note, err := resolveLokiLimit(tc.requested)
+			if tc.wantErr {
+				if err == nil {
+					t.Errorf("Expected error, got limit %d", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if got != tc.want || note != tc.wantNote {
+				t.Errorf("resolveLokiLimit(%v) = %d, %q; want %d, %q", tc.requested, got, note, tc.want, tc.wantNote)
+			}
+		})
+	}
+}
+
+// TestHandleLokiQueryProtocol_LimitNote verifies that clamping is reported alongside the results
+func TestHandleLokiQueryProtocol_LimitNote(t *testing.T) {
+	var lastLimit string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lastLimit = r.URL.Query().Get("limit")
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"status":"success","data":{"resultType":"streams","result":[{"stream":{"job":"x"},"values":[["1705312245000000000","hello"]]}]}}`))
+	}))
+	defer server.Close()
+
+	for _, env := range []string{EnvLokiURL, EnvLokiOrgID, EnvLokiUsername, EnvLokiPassword, EnvLokiToken, EnvLokiMaxLimit, EnvLokiDefaultLimit} {
+		t.Setenv(env, "")
+	}
+
+	if _, err := NewLokiQueryToolProtocol(); err != nil {
+		t.Fatalf("Failed to create tool: %v", err)
+	}
+
+	raw, _ := json.Marshal(map[string]any{"query": `{job="x"}`, "url": server.URL, "limit": 1000000, "format": "json"})
+	result, err := HandleLokiQueryProtocol(context.Background(), &protocol.CallToolRequest{Name: "loki_query", RawArguments: raw})
+	if err != nil {
+		t.Fatalf("HandleLokiQueryProtocol failed: %v", err)
+	}
+
+	if lastLimit != "5000" {
+		t.Errorf("Expected clamped limit 5000 to be sent, got %q", lastLimit)
+	}
+	if len(result.Content) != 3 {
+		t.Fatalf("Expected results, metadata and a note, got %d content items", len(result.Content))
+	}
+	if !json.Valid([]byte(result.Content[0].(*protocol.TextContent).Text)) {
+		t.Error("Expected the json results to stay valid JSON")
+	}
+	if got := result.Content[2].(*protocol.TextContent).Text; got != "Note: limit reduced from 1000000 to 5000" {
+		t.Errorf("Unexpected note: %q", got)
+	}
+}
@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// compileLokiLineRegex compiles the lineRegex of a loki_query call, or returns nil when none was
+// given, so that an invalid pattern is reported before anything is fetched
+func compileLokiLineRegex(pattern string, invert bool) (*regexp.Regexp, error) {
+	if pattern == "" {
+		if invert {
+			return nil, fmt.Errorf("invert requires lineRegex")
+		}
+		return nil, nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid lineRegex: %v", err)
+	}
+	return re, nil
+}
+
+// filterLokiLines returns a copy of result with only the lines re matches, or with invert only
+// those it does not match. Streams left without lines are dropped. Metric results have no lines
+// and are returned unchanged.
+func filterLokiLines(result *LokiResult, re *regexp.Regexp, invert bool) *LokiResult {
+	if result.Data.ResultType != "" && result.Data.ResultType != "streams" {
+		return result
+	}
+
+	filtered := &LokiResult{Status: result.Status, Error: result.Error, Warnings: result.Warnings}
+	filtered.Data.ResultType = result.Data.ResultType
+	filtered.Data.Stats = result.Data.Stats
+	filtered.Data.Result = []LokiEntry{}
+
+	for _, entry := range result.Data.Result {
+		var values [][]string
+		for _, val := range entry.Values {
+			if len(val) >= 2 && re.MatchString(val[1]) != invert {
+				values = append(values, val)
+			}
+		}
+		if len(values) > 0 {
+			filtered.Data.Result = append(filtered.Data.Result, LokiEntry{Stream: entry.Stream, Values: values})
+		}
+	}
+	return filtered
+}
+
+// countLokiEntries returns the number of lines in result, or of samples for a metric result
+func countLokiEntries(result *LokiResult) int {
+	if result.Metric != nil {
+		return countLokiSamples(result.Metric)
+	}
+	count := 0
+	for _, entry := range result.Data.Result {
+		count += len(entry.Values)
+	}
+	return count
+}
+
+// lokiLineRegexNote reports how many of the fetched entries lineRegex kept. The filter runs after
+// Loki applied the limit, so when the limit was hit more matching lines may exist on later pages.
+func lokiLineRegexNote(kept int, metadata LokiQueryMetadata) string {
+	note := fmt.Sprintf("lineRegex kept %d of the %d entries returned by Loki", kept, metadata.Entries)
+	if metadata.LimitHit {
+		note += "; the limit was hit before filtering, so pass the cursor to search further or use a LogQL line filter such as |~ to filter in Loki"
+	}
+	return note
+}
@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ThinkInAIXYZ/go-mcp/protocol"
+)
+
+// TestFilterLokiLines verifies matching and inverted filtering, and that emptied streams are dropped
+func TestFilterLokiLines(t *testing.T) {
+	result := &LokiResult{Status: "success", Data: LokiData{ResultType: "streams", Result: []LokiEntry{
+		{Stream: map[string]string{"job": "a"}, Values: [][]string{{"3", "GET /health 200"}, {"2", "GET /api 500"}}},
+		{Stream: map[string]string{"job": "b"}, Values: [][]string{{"1", "GET /health 200"}}},
+	}}}
+
+	re, err := compileLokiLineRegex(`\s5\d\d$`, false)
+	if err != nil {
+		t.Fatalf("compileLokiLineRegex failed: %v", err)
+	}
+	filtered := filterLokiLines(result, re, false)
+	if len(filtered.Data.Result) != 1 || countLokiEntries(filtered) != 1 || filtered.Data.Result[0].Values[0][1] != "GET /api 500" {
+		t.Errorf("Expected only the 500 line, got %+v", filtered.Data.Result)
+	}
+	if countLokiEntries(result) != 3 {
+		t.Error("Expected the original result to be left unchanged")
+	}
+
+	inverted := filterLokiLines(result, re, true)
+	if len(inverted.Data.Result) != 2 || countLokiEntries(inverted) != 2 {
+		t.Errorf("Expected both health lines, got %+v", inverted.Data.Result)
+	}
+
+	if _, err := compileLokiLineRegex(`(unclosed`, false); err == nil || !strings.Contains(err.Error(), "invalid lineRegex") {
+		t.Errorf("Expected an invalid pattern to be rejected, got %v", err)
+	}
+	if _, err := compileLokiLineRegex("", true); err == nil {
+		t.Error("Expected invert without lineRegex to be rejected")
+	}
+}
+
+// TestHandleLokiQueryProtocol_LineRegex verifies that lines are filtered after fetching, that the
+// metadata still describes what Loki returned, and that invalid patterns fail before any request
+func TestHandleLokiQueryProtocol_LineRegex(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Write([]byte(`{"status":"success","data":{"resultType":"streams","result":[{"stream":{"job":"a"},"values":[["1705312800000000000","user=alice ok"],["1705312790000000000","user=bob failed"]]}]}}`))
+	}))
+	defer server.Close()
+
+	if _, err := NewLokiQueryToolProtocol(); err != nil {
+		t.Fatalf("Failed to create tool: %v", err)
+	}
+	call := func(extra map[string]any) (*protocol.CallToolResult, error) {
+		args := map[string]any{"query": `{job="a"}`, "url": server.URL, "limit": 2, "format": "text"}
+		for k, v := range extra {
+			args[k] = v
+		}
+		raw, _ := json.Marshal(args)
+		return HandleLokiQueryProtocol(context.Background(), &protocol.CallToolRequest{Name: "loki_query", RawArguments: raw})
+	}
+
+	result, err := call(map[string]any{"lineRegex": "user=(alice|carol)"})
+	if err != nil {
+		t.Fatalf("HandleLokiQueryProtocol failed: %v", err)
+	}
+	output := result.Content[0].(*protocol.TextContent).Text
+	if !strings.Contains(output, "alice") || strings.Contains(output, "bob") {
+		t.Errorf("Expected only alice's line, got:\n%s", output)
+	}
+	var metadata LokiQueryMetadata
+	if err := json.Unmarshal([]byte(result.Content[1].(*protocol.TextContent).Text), &metadata); err != nil {
+		t.Fatalf("Expected metadata to be JSON: %v", err)
+	}
+	if metadata.Entries != 2 || !metadata.LimitHit || metadata.Cursor == "" {
+		t.Errorf("Expected the metadata to describe both fetched entries, got %+v", metadata)
+	}
+	note := result.Content[len(result.Content)-1].(*protocol.TextContent).Text
+	if !strings.Contains(note, "kept 1 of the 2 entries") || !strings.Contains(note, "limit was hit") {
+		t.Errorf("Expected a note about the filter and the limit, got %q", note)
+	}
+
+	result, err = call(map[string]any{"lineRegex": "user=", "invert": true})
+	if err != nil {
+		t.Fatalf("HandleLokiQueryProtocol failed: %v", err)
+	}
+	if output := result.Content[0].(*protocol.TextContent).Text; !strings.Contains(output, "All of the 2 log entries") {
+		t.Errorf("Expected a message that every line was filtered out, got %q", output)
+	}
+
+	requests = 0
+	if _, err := call(map[string]any{"lineRegex": "[z-a]"}); err == nil {
+		t.Error("Expected an invalid lineRegex to be rejected")
+	}
+	if requests != 0 {
+		t.Errorf("Expected no request to Loki for an invalid lineRegex, got %d", requests)
+	}
+}
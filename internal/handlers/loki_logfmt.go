@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// logfmtPair is a single key=value pair parsed from a logfmt line
+type logfmtPair struct {
+	Key   string
+	Value string
+}
+
+// parseLogfmt parses a logfmt line such as `level=info msg="request done" latency=5ms`.
+// Quoted values may contain spaces and backslash-escaped quotes. It returns false when the
+// line is not logfmt: every token must be a key=value pair and quotes must be terminated.
+func parseLogfmt(line string) ([]logfmtPair, bool) {
+	var pairs []logfmtPair
+	i, n := 0, len(line)
+
+	for {
+		// Skip whitespace between pairs
+		for i < n && (line[i] == ' ' || line[i] == '\t') {
+			i++
+		}
+		if i >= n {
+			break
+		}
+
+		// Read the key up to '='
+		start := i
+		for i < n && line[i] != '=' && line[i] != ' ' && line[i] != '\t' && line[i] != '"' {
+			i++
+		}
+		if i == start || i >= n || line[i] != '=' {
+			return nil, false
+		}
+		key := line[start:i]
+		i++ // skip '='
+
+		// Read a quoted or bare value
+		var value string
+		if i < n && line[i] == '"' {
+			var b strings.Builder
+			i++
+			closed := false
+			for i < n {
+				c := line[i]
+				if c == '\\' && i+1 < n {
+					switch next := line[i+1]; next {
+					case '"', '\\':
+						b.WriteByte(next)
+					case 'n':
+						b.WriteByte('\n')
+					case 't':
+						b.WriteByte('\t')
+					default:
+						b.WriteByte(c)
+						b.WriteByte(next)
+					}
+					i += 2
+					continue
+				}
+				if c == '"' {
+					closed = true
+					i++
+					break
+				}
+				b.WriteByte(c)
+				i++
+			}
+			if !closed || (i < n && line[i] != ' ' && line[i] != '\t') {
+				return nil, false
+			}
+			value = b.String()
+		} else {
+			start = i
+			for i < n && line[i] != ' ' && line[i] != '\t' {
+				if line[i] == '"' {
+					return nil, false
+				}
+				i++
+			}
+			value = line[start:i]
+		}
+
+		pairs = append(pairs, logfmtPair{Key: key, Value: value})
+	}
+
+	return pairs, len(pairs) > 0
+}
+
+// formatLokiLogfmt formats results with each logfmt line expanded into an aligned key/value
+// table. Lines that are not logfmt are printed unchanged after their timestamp.
+func formatLokiLogfmt(result *LokiResult) string {
+	var b strings.Builder
+	writeLokiLogfmt(&b, result)
+	return b.String()
+}
+
+// writeLokiLogfmt writes the logfmt format one entry at a time
+func writeLokiLogfmt(w io.Writer, result *LokiResult) error {
+	if _, err := fmt.Fprintf(w, "Found %d streams:\n\n", len(result.Data.Result)); err != nil {
+		return err
+	}
+
+	for i, entry := range result.Data.Result {
+		if _, err := fmt.Fprintf(w, "Stream %d %s:\n", i+1, formatMetricLabels(entry.Stream)); err != nil {
+			return err
+		}
+
+		for _, val := range entry.Values {
+			if len(val) < 2 {
+				continue
+			}
+			if _, err := io.WriteString(w, formatLogfmtEntry(val[0], val[1])); err != nil {
+				return err
+			}
+		}
+		if _, err := io.WriteString(w, "\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// formatLogfmtEntry formats one entry of the logfmt format, expanding the line into a table if it is logfmt
+func formatLogfmtEntry(ts, line string) string {
+	timestamp := ts
+	if nanos, err := strconv.ParseFloat(ts, 64); err == nil {
+		timestamp = time.Unix(0, int64(nanos)).Format(time.RFC3339)
+	}
+
+	pairs, ok := parseLogfmt(line)
+	if !ok {
+		return fmt.Sprintf("[%s] %s\n", timestamp, line)
+	}
+
+	width := 0
+	for _, pair := range pairs {
+		width = max(width, len(pair.Key))
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "[%s]\n", timestamp)
+	for _, pair := range pairs {
+		fmt.Fprintf(&b, "  %-*s = %s\n", width, pair.Key, pair.Value)
+	}
+	return b.String()
+}
@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestParseLogfmt verifies quoted values, escaped quotes and rejection of non-logfmt lines
+func TestParseLogfmt(t *testing.T) {
+	testCases := []struct {
+		name string
+		line string
+		want []logfmtPair
+		ok   bool
+	}{
+		{
+			name: "Bare values",
+			line: "level=info latency=5ms",
+			want: []logfmtPair{{"level", "info"}, {"latency", "5ms"}},
+			ok:   true,
+		},
+		{
+			name: "Quoted value with spaces",
+			line: `level=info msg="request done" status=200`,
+			want: []logfmtPair{{"level", "info"}, {"msg", "request done"}, {"status", "200"}},
+			ok:   true,
+		},
+		{
+			name: "Escaped quotes",
+			line: `msg="user \"bob\" logged in" path=C:\\tmp`,
+			want: []logfmtPair{{"msg", `user "bob" logged in`}, {"path", `C:\\tmp`}},
+			ok:   true,
+		},
+		{
+			name: "Empty value",
+			line: `err= retry=true`,
+			want: []logfmtPair{{"err", ""}, {"retry", "true"}},
+			ok:   true,
+		},
+		{name: "Plain text", line: "connection refused by upstream", ok: false},
+		{name: "Mixed text", line: "error: timeout=5s exceeded", ok: false},
+		{name: "Unterminated quote", line: `msg="oops level=info`, ok: false},
+		{name: "JSON", line: `{"level":"info"}`, ok: false},
+		{name: "Empty", line: "", ok: false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, ok := parseLogfmt(tc.line)
+			if ok != tc.ok {
+				t.Fatalf("parseLogfmt(%q) ok = %v, want %v", tc.line, ok, tc.ok)
+			}
+			if ok && !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("parseLogfmt(%q) = %v, want %v", tc.line, got, tc.want)
+			}
+		})
+	}
+}
+
+// TestFormatLokiResults_Logfmt verifies aligned tables for logfmt lines and untouched fallback lines
+func TestFormatLokiResults_Logfmt(t *testing.T) {
+	result := &LokiResult{
+		Status: "success",
+		Data: LokiData{
+			ResultType: "streams",
+			Result: []LokiEntry{
+				{
+					Stream: map[string]string{"app": "api"},
+					Values: [][]string{
+						{"1705312245000000000", `level=info msg="request done" latency=5ms`},
+						{"1705312246000000000", "panic: runtime error"},
+					},
+				},
+			},
+		},
+	}
+
+	output, err := formatLokiResults(result, "logfmt")
+	if err != nil {
+		t.Fatalf("formatLokiResults failed: %v", err)
+	}
+
+	for _, want := range []string{
+		`Stream 1 {app="api"}:`,
+		"  level   = info\n",
+		"  msg     = request done\n",
+		"  latency = 5ms\n",
+		"] panic: runtime error\n",
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("Expected output to contain %q, got:\n%s", want, output)
+		}
+	}
+}
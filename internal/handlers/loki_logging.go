@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// Environment variable name for the minimum log level: debug, info, warn or error
+const EnvLogLevel = "LOG_LEVEL"
+
+// Environment variable name for the log output format: text or json
+const EnvLogFormat = "LOG_FORMAT"
+
+// NewLogger creates a logger writing to w with the level and format from LOG_LEVEL and LOG_FORMAT,
+// defaulting to info and text
+func NewLogger(w io.Writer) (*slog.Logger, error) {
+	level := slog.LevelInfo
+	if value := os.Getenv(EnvLogLevel); value != "" {
+		if err := level.UnmarshalText([]byte(value)); err != nil {
+			return nil, fmt.Errorf("invalid %s: %q must be debug, info, warn or error", EnvLogLevel, value)
+		}
+	}
+	opts := &slog.HandlerOptions{Level: level}
+
+	switch format := strings.ToLower(os.Getenv(EnvLogFormat)); format {
+	case "", "text":
+		return slog.New(slog.NewTextHandler(w, opts)), nil
+	case "json":
+		return slog.New(slog.NewJSONHandler(w, opts)), nil
+	default:
+		return nil, fmt.Errorf("invalid %s: %q must be text or json", EnvLogFormat, format)
+	}
+}
+
+// SetupLogging installs the logger configured by LOG_LEVEL and LOG_FORMAT as the default logger,
+// writing to stderr. Output of the standard log package is routed through it at info level.
+func SetupLogging() error {
+	logger, err := NewLogger(os.Stderr)
+	if err != nil {
+		return err
+	}
+	slog.SetDefault(logger)
+	return nil
+}
+
+// lokiLoggerKey is the context key holding the logger of a tool call
+type lokiLoggerKey struct{}
+
+// withLokiLogger attaches a logger to ctx, so that logs about a tool call carry its attributes
+func withLokiLogger(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, lokiLoggerKey{}, logger)
+}
+
+// lokiLogger returns the logger attached to ctx, or the default logger
+func lokiLogger(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(lokiLoggerKey{}).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
+
+// logLokiURL logs the URL of a Loki request at debug level, so that users can check how
+// parameters such as start and end were encoded
+func logLokiURL(ctx context.Context, queryURL string) {
+	logger := lokiLogger(ctx)
+	if !logger.Enabled(ctx, slog.LevelDebug) {
+		return
+	}
+	logger.DebugContext(ctx, "Loki request", "endpoint", lokiEndpoint(queryURL), "url", redactLokiURL(queryURL))
+}
+
+// redactLokiURL removes credentials from a URL before it is logged: user info is dropped and
+// the values of parameters that look like secrets are replaced
+func redactLokiURL(queryURL string) string {
+	u, err := url.Parse(queryURL)
+	if err != nil {
+		return "(unparseable URL)"
+	}
+	u.User = nil
+
+	q := u.Query()
+	redacted := false
+	for name := range q {
+		lower := strings.ToLower(name)
+		for _, secret := range []string{"token", "password", "secret", "key", "auth"} {
+			if strings.Contains(lower, secret) {
+				q[name] = []string{"REDACTED"}
+				redacted = true
+				break
+			}
+		}
+	}
+	if redacted {
+		u.RawQuery = q.Encode()
+	}
+	return u.String()
+}
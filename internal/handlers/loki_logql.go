@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// logqlMatcherPattern matches a single label matcher inside a stream selector, e.g. job=~"api|web"
+var logqlMatcherPattern = regexp.MustCompile("^\\s*[a-zA-Z_][a-zA-Z0-9_]*\\s*(=~|!~|!=|=)\\s*(\"(?:[^\"\\\\]|\\\\.)*\"|`[^`]*`)\\s*$")
+
+// validateLogQL performs a lightweight syntax check of a LogQL query before it is sent to Loki.
+// It checks that the query is non-empty, that brackets outside string literals are balanced,
+// and that it contains at least one well-formed stream selector such as {job="varlogs"}.
+// Everything else (pipelines, parsers, aggregations) is left for Loki to validate.
+func validateLogQL(query string) error {
+	if strings.TrimSpace(query) == "" {
+		return fmt.Errorf("invalid LogQL: query is empty")
+	}
+
+	closing := map[byte]byte{')': '(', ']': '[', '}': '{'}
+	names := map[byte]string{'(': "parentheses", '[': "brackets", '{': "braces"}
+
+	type open struct {
+		char byte
+		pos  int
+	}
+	var stack []open
+	selectors := 0
+
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		switch c {
+		case '"', '`':
+			end := skipLogQLString(query, i)
+			if end < 0 {
+				return fmt.Errorf("invalid LogQL: unterminated string at position %d", i+1)
+			}
+			i = end
+
+		case '(', '[', '{':
+			stack = append(stack, open{char: c, pos: i})
+
+		case ')', ']', '}':
+			if len(stack) == 0 || stack[len(stack)-1].char != closing[c] {
+				return fmt.Errorf("invalid LogQL: unbalanced %s at position %d", names[closing[c]], i+1)
+			}
+			top := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+
+			if c == '}' {
+				if err := validateLogQLSelector(query[top.pos+1:i], top.pos); err != nil {
+					return err
+				}
+				selectors++
+			}
+		}
+	}
+
+	if len(stack) > 0 {
+		top := stack[len(stack)-1]
+		return fmt.Errorf("invalid LogQL: unbalanced %s at position %d", names[top.char], top.pos+1)
+	}
+	if selectors == 0 {
+		return fmt.Errorf("invalid LogQL: missing stream selector, e.g. {job=\"varlogs\"}")
+	}
+	return nil
+}
+
+// skipLogQLString returns the index of the quote closing the string literal starting at start,
+// or -1 if the string is not terminated. Double-quoted strings may contain escaped quotes.
+func skipLogQLString(query string, start int) int {
+	quote := query[start]
+	for i := start + 1; i < len(query); i++ {
+		if quote == '"' && query[i] == '\\' {
+			i++
+			continue
+		}
+		if query[i] == quote {
+			return i
+		}
+	}
+	return -1
+}
+
+// validateLogQLSelector checks the contents of a {...} stream selector opened at position pos
+func validateLogQLSelector(body string, pos int) error {
+	if strings.TrimSpace(body) == "" {
+		return fmt.Errorf("invalid LogQL: empty stream selector at position %d, expected at least one label matcher", pos+1)
+	}
+
+	for _, matcher := range splitLogQLMatchers(body) {
+		if !logqlMatcherPattern.MatchString(matcher) {
+			return fmt.Errorf("invalid LogQL: malformed label matcher %q in stream selector at position %d, expected label=\"value\"", strings.TrimSpace(matcher), pos+1)
+		}
+	}
+	return nil
+}
+
+// splitLogQLMatchers splits a selector body on commas that are not inside string literals
+func splitLogQLMatchers(body string) []string {
+	var matchers []string
+	start := 0
+	for i := 0; i < len(body); i++ {
+		switch body[i] {
+		case '"', '`':
+			if end := skipLogQLString(body, i); end >= 0 {
+				i = end
+			}
+		case ',':
+			matchers = append(matchers, body[start:i])
+			start = i + 1
+		}
+	}
+	return append(matchers, body[start:])
+}
@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestValidateLogQL verifies that common mistakes are caught while valid advanced queries pass
+func TestValidateLogQL(t *testing.T) {
+	valid := []string{
+		`{job="varlogs"}`,
+		`{job="varlogs", level!="debug"}`,
+		`{app=~"api|web"} |= "error" != "timeout"`,
+		`{job="x"} | json | line_format "{{.msg}} took {{.duration}}"`,
+		`{job="x"} | logfmt | duration > 10s`,
+		`sum by (level) (count_over_time({job="x"} |~ "err(or)?" [5m]))`,
+		`topk(5, rate({namespace=` + "`prod`" + `}[1m]))`,
+		`{job="x"} |= "brace } in string" | label_format msg="{{ .a }}"`,
+		`{job="esc\"aped"}`,
+	}
+	for _, query := range valid {
+		if err := validateLogQL(query); err != nil {
+			t.Errorf("Expected %q to be valid, got %v", query, err)
+		}
+	}
+
+	invalid := []struct {
+		query string
+		want  string
+	}{
+		{query: "", want: "query is empty"},
+		{query: "   ", want: "query is empty"},
+		{query: `{job="varlogs"`, want: "unbalanced braces at position 1"},
+		{query: `{job="x"}}`, want: "unbalanced braces at position 10"},
+		{query: `rate({job="x"}[5m]`, want: "unbalanced parentheses at position 5"},
+		{query: `rate({job="x"}[5m)`, want: "unbalanced parentheses at position 18"},
+		{query: `{job="x}`, want: "unterminated string at position 6"},
+		{query: `{}`, want: "empty stream selector"},
+		{query: `{job=varlogs}`, want: "malformed label matcher"},
+		{query: `{job="x" level="y"}`, want: "malformed label matcher"},
+		{query: `sum(rate([5m]))`, want: "missing stream selector"},
+		{query: `job="varlogs"`, want: "missing stream selector"},
+	}
+	for _, tc := range invalid {
+		err := validateLogQL(tc.query)
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("validateLogQL(%q): expected error containing %q, got %v", tc.query, tc.want, err)
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package handlers
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// Environment variable name for how far back queries start when no start time is given
+const EnvLokiDefaultLookback = "LOKI_DEFAULT_LOOKBACK"
+
+// Default time window of queries without a start time
+const DefaultLokiLookback = time.Hour
+
+// LokiDefaultLookback returns how far back queries start when the request gives no start time:
+// LOKI_DEFAULT_LOOKBACK when it is a positive duration such as 15m or 24h, and one hour otherwise.
+// The error describes an invalid value that was ignored, so it can be reported at startup.
+func LokiDefaultLookback() (time.Duration, error) {
+	value := os.Getenv(EnvLokiDefaultLookback)
+	if value == "" {
+		return DefaultLokiLookback, nil
+	}
+
+	lookback, err := parsePositiveDuration(EnvLokiDefaultLookback, value)
+	if err != nil {
+		return DefaultLokiLookback, fmt.Errorf("%v, using %s", err, DefaultLokiLookback)
+	}
+	return lookback, nil
+}
+
+// defaultLokiStart returns the start of the default time window ending now
+func defaultLokiStart() time.Time {
+	lookback, _ := LokiDefaultLookback()
+	return time.Now().Add(-lookback)
+}
@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/ThinkInAIXYZ/go-mcp/protocol"
+)
+
+// TestLokiDefaultLookback verifies parsing and the fallback to one hour
+func TestLokiDefaultLookback(t *testing.T) {
+	testCases := []struct {
+		value   string
+		want    time.Duration
+		wantErr bool
+	}{
+		{value: "", want: time.Hour},
+		{value: "15m", want: 15 * time.Minute},
+		{value: "24h", want: 24 * time.Hour},
+		{value: "0s", want: time.Hour, wantErr: true},
+		{value: "-5m", want: time.Hour, wantErr: true},
+		{value: "a day", want: time.Hour, wantErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Setenv(EnvLokiDefaultLookback, tc.value)
+		got, err := LokiDefaultLookback()
+		if got != tc.want || (err != nil) != tc.wantErr {
+			t.Errorf("LokiDefaultLookback(%q) = %s, %v; want %s, error %v", tc.value, got, err, tc.want, tc.wantErr)
+		}
+	}
+}
+
+// TestHandleLokiQueryProtocol_DefaultLookback verifies that the lookback applies only without a start time
+func TestHandleLokiQueryProtocol_DefaultLookback(t *testing.T) {
+	var lastStart, lastEnd int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lastStart, _ = strconv.ParseInt(r.URL.Query().Get("start"), 10, 64)
+		lastEnd, _ = strconv.ParseInt(r.URL.Query().Get("end"), 10, 64)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"status":"success","data":{"resultType":"streams","result":[]}}`))
+	}))
+	defer server.Close()
+
+	for _, env := range []string{EnvLokiURL, EnvLokiOrgID, EnvLokiUsername, EnvLokiPassword, EnvLokiToken, EnvLokiTimezone} {
+		t.Setenv(env, "")
+	}
+	t.Setenv(EnvLokiDefaultLookback, "15m")
+
+	if _, err := NewLokiQueryToolProtocol(); err != nil {
+		t.Fatalf("Failed to create tool: %v", err)
+	}
+
+	call := func(args map[string]any) {
+		args["query"] = `{job="x"}`
+		args["url"] = server.URL
+		raw, _ := json.Marshal(args)
+		if _, err := HandleLokiQueryProtocol(context.Background(), &protocol.CallToolRequest{Name: "loki_query", RawArguments: raw}); err != nil {
+			t.Fatalf("HandleLokiQueryProtocol failed: %v", err)
+		}
+	}
+
+	call(map[string]any{})
+	if window := time.Duration(lastEnd - lastStart); window < 15*time.Minute-time.Second || window > 15*time.Minute+time.Second {
+		t.Errorf("Expected a 15m default window, got %s", window)
+	}
+
+	call(map[string]any{"start": "-2h"})
+	if window := time.Duration(lastEnd - lastStart); window < 2*time.Hour-time.Second || window > 2*time.Hour+time.Second {
+		t.Errorf("Expected the requested start to win, got a %s window", window)
+	}
+}
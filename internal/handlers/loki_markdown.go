@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Environment variable name for the number of characters a line may take in the markdown format
+const EnvLokiMarkdownMaxWidth = "LOKI_MARKDOWN_MAX_WIDTH"
+
+// Default number of characters a line may take in the markdown format
+const DefaultLokiMarkdownMaxWidth = 200
+
+// CheckLokiMarkdownMaxWidth validates LOKI_MARKDOWN_MAX_WIDTH so that mistakes are reported at
+// startup, returning the width
+func CheckLokiMarkdownMaxWidth() (int, error) {
+	return lokiLimitFromEnv(EnvLokiMarkdownMaxWidth, DefaultLokiMarkdownMaxWidth)
+}
+
+// formatLokiMarkdown formats the results as a Markdown table with a row per entry, in the order of
+// the result, for chat interfaces that render Markdown. Lines longer than LOKI_MARKDOWN_MAX_WIDTH
+// characters are cut with an ellipsis.
+func formatLokiMarkdown(result *LokiResult) (string, error) {
+	var b strings.Builder
+	if err := writeLokiMarkdown(&b, result); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// writeLokiMarkdown writes the markdown format one row at a time
+func writeLokiMarkdown(w io.Writer, result *LokiResult) error {
+	width, err := CheckLokiMarkdownMaxWidth()
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.WriteString(w, "| Time | Labels | Line |\n| --- | --- | --- |\n"); err != nil {
+		return err
+	}
+	for _, entry := range result.Data.Result {
+		labels := escapeLokiMarkdown(formatLokiMarkdownLabels(entry.Stream))
+		for _, val := range entry.Values {
+			if len(val) < 2 {
+				continue
+			}
+			timestamp := val[0]
+			if ts, err := strconv.ParseInt(val[0], 10, 64); err == nil {
+				timestamp = time.Unix(0, ts).UTC().Format("2006-01-02T15:04:05.000Z07:00")
+			}
+			if _, err := fmt.Fprintf(w, "| %s | %s | %s |\n", timestamp, labels, escapeLokiMarkdown(truncateLokiLine(val[1], width))); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// formatLokiMarkdownLabels renders stream labels compactly as k=v pairs sorted by name
+func formatLokiMarkdownLabels(labels map[string]string) string {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	parts := make([]string, 0, len(names))
+	for _, name := range names {
+		parts = append(parts, name+"="+labels[name])
+	}
+	return strings.Join(parts, " ")
+}
+
+// escapeLokiMarkdown makes text safe for a Markdown table cell: pipes and backslashes are escaped
+// so that they do not end the cell, and line breaks become spaces so that they do not end the row
+func escapeLokiMarkdown(text string) string {
+	return strings.NewReplacer(`\`, `\\`, "|", `\|`, "\r\n", " ", "\n", " ", "\r", " ").Replace(text)
+}
+
+// truncateLokiLine cuts line to width characters, the last one an ellipsis, when it is longer
+func truncateLokiLine(line string, width int) string {
+	runes := []rune(line)
+	if len(runes) <= width {
+		return line
+	}
+	return string(runes[:width-1]) + "…"
+}
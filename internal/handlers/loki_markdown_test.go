@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestFormatLokiMarkdown verifies the table layout, label rendering and escaping
+func TestFormatLokiMarkdown(t *testing.T) {
+	result := &LokiResult{Status: "success", Data: LokiData{ResultType: "streams", Result: []LokiEntry{
+		{Stream: map[string]string{"pod": "api-1", "job": "api"}, Values: [][]string{
+			{"1705312800500000000", "GET /a|b 200"},
+			{"1705312801000000000", "panic: boom\n\tat main.go:1"},
+		}},
+	}}}
+
+	output, err := formatLokiResults(result, "markdown")
+	if err != nil {
+		t.Fatalf("formatLokiResults failed: %v", err)
+	}
+	want := "| Time | Labels | Line |\n" +
+		"| --- | --- | --- |\n" +
+		"| 2024-01-15T10:00:00.500Z | job=api pod=api-1 | GET /a\\|b 200 |\n" +
+		"| 2024-01-15T10:00:01.000Z | job=api pod=api-1 | panic: boom \tat main.go:1 |\n"
+	if !strings.HasPrefix(output, want) {
+		t.Errorf("Expected table\n%s\ngot\n%s", want, output)
+	}
+	if !strings.Contains(output, "--- 2 entries") {
+		t.Errorf("Expected the footer, got %s", output)
+	}
+}
+
+// TestFormatLokiMarkdownWidth verifies that long lines are cut to LOKI_MARKDOWN_MAX_WIDTH
+func TestFormatLokiMarkdownWidth(t *testing.T) {
+	result := &LokiResult{Data: LokiData{Result: []LokiEntry{
+		{Stream: map[string]string{"job": "api"}, Values: [][]string{{"1705312800000000000", "ééééééééééé"}}},
+	}}}
+
+	t.Setenv(EnvLokiMarkdownMaxWidth, "5")
+	output, err := formatLokiMarkdown(result)
+	if err != nil {
+		t.Fatalf("formatLokiMarkdown failed: %v", err)
+	}
+	if !strings.Contains(output, "| éééé… |") {
+		t.Errorf("Expected the line cut to 5 characters, got %s", output)
+	}
+
+	t.Setenv(EnvLokiMarkdownMaxWidth, "0")
+	if _, err := formatLokiMarkdown(result); err == nil {
+		t.Error("Expected error for a width of 0")
+	}
+}
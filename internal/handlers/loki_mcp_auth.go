@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// Environment variable name for the bearer token, or comma-separated tokens, that clients must
+// present to call the server
+const EnvMCPAuthToken = "MCP_AUTH_TOKEN"
+
+// NewMCPAuthHandler wraps next so that requests must carry an Authorization: Bearer header with
+// one of the tokens in MCP_AUTH_TOKEN, answering 401 Unauthorized otherwise. Without tokens,
+// next is returned unchanged.
+func NewMCPAuthHandler(next http.Handler) http.Handler {
+	var digests [][sha256.Size]byte
+	for _, token := range strings.Split(os.Getenv(EnvMCPAuthToken), ",") {
+		if token = strings.TrimSpace(token); token != "" {
+			digests = append(digests, sha256.Sum256([]byte(token)))
+		}
+	}
+	if len(digests) == 0 {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !validMCPAuth(r.Header.Get("Authorization"), digests) {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="loki-mcp"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// validMCPAuth reports whether header holds a bearer token with one of the given digests. Digests
+// are compared in constant time so that response timing does not reveal the tokens.
+func validMCPAuth(header string, digests [][sha256.Size]byte) bool {
+	scheme, token, ok := strings.Cut(header, " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return false
+	}
+	digest := sha256.Sum256([]byte(strings.TrimSpace(token)))
+
+	valid := 0
+	for _, allowed := range digests {
+		valid |= subtle.ConstantTimeCompare(digest[:], allowed[:])
+	}
+	return valid == 1
+}
@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestMCPAuthHandler verifies that only requests with a configured bearer token are served
+func TestMCPAuthHandler(t *testing.T) {
+	t.Setenv(EnvMCPAuthToken, "first-token, second-token")
+	handler := NewMCPAuthHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+
+	tests := []struct {
+		header string
+		want   int
+	}{
+		{"Bearer first-token", http.StatusOK},
+		{"bearer second-token", http.StatusOK},
+		{"", http.StatusUnauthorized},
+		{"Bearer wrong-token", http.StatusUnauthorized},
+		{"Bearer ", http.StatusUnauthorized},
+		{"Basic Zmlyc3QtdG9rZW4=", http.StatusUnauthorized},
+		{"first-token", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("POST", "/mcp", nil)
+		if tt.header != "" {
+			req.Header.Set("Authorization", tt.header)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		if rec.Code != tt.want {
+			t.Errorf("Authorization %q: expected %d, got %d", tt.header, tt.want, rec.Code)
+		}
+		if tt.want == http.StatusUnauthorized && rec.Header().Get("WWW-Authenticate") == "" {
+			t.Errorf("Authorization %q: expected a WWW-Authenticate header", tt.header)
+		}
+	}
+}
+
+// TestMCPAuthHandler_Disabled verifies that the endpoint stays open without tokens
+func TestMCPAuthHandler_Disabled(t *testing.T) {
+	t.Setenv(EnvMCPAuthToken, " , ")
+	handler := NewMCPAuthHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("POST", "/mcp", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected 200 without configured tokens, got %d", rec.Code)
+	}
+}
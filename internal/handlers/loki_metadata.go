@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/ThinkInAIXYZ/go-mcp/protocol"
+)
+
+// LokiQueryMetadata summarizes a query result so that agents can decide whether to paginate
+// or narrow the query without parsing the formatted output
+type LokiQueryMetadata struct {
+	Entries    int    `json:"entries"`
+	Streams    int    `json:"streams"`
+	Start      string `json:"start"`
+	End        string `json:"end"`
+	Limit      int    `json:"limit"`
+	LimitHit   bool   `json:"limitHit"`
+	Direction  string `json:"direction"`
+	Cursor     string `json:"cursor,omitempty"`
+	SinceToken string `json:"sinceToken,omitempty"`
+}
+
+// buildLokiQueryMetadata describes result for the effective range (Unix ns), limit and direction of
+// the query. The limit counts as hit when Loki returned as many entries as were requested, in which
+// case more entries may exist in the range and a cursor for the next page is included, continuing
+// from cursor, the one the call was given. For metric results, entries and streams count samples
+// and series, and the limit does not apply.
+func buildLokiQueryMetadata(result *LokiResult, start, end int64, limit int, direction string, cursor lokiCursor) LokiQueryMetadata {
+	entries := countLokiEntries(result)
+	streams := len(result.Data.Result)
+	if result.Metric != nil {
+		streams = len(result.Metric.Data.Result)
+	}
+	if direction == "" {
+		direction = "backward"
+	}
+
+	metadata := LokiQueryMetadata{
+		Entries:   entries,
+		Streams:   streams,
+		Start:     time.Unix(0, start).UTC().Format(time.RFC3339Nano),
+		End:       time.Unix(0, end).UTC().Format(time.RFC3339Nano),
+		Limit:     limit,
+		LimitHit:  result.Metric == nil && limit > 0 && entries >= limit,
+		Direction: direction,
+	}
+	if metadata.LimitHit {
+		metadata.Cursor = nextLokiCursor(result, direction, cursor)
+	}
+	return metadata
+}
+
+// lokiMetadataContent encodes metadata as a JSON text content item
+func lokiMetadataContent(metadata LokiQueryMetadata) (*protocol.TextContent, error) {
+	data, err := json.Marshal(metadata)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode metadata: %v", err)
+	}
+	return &protocol.TextContent{
+		Type: "text",
+		Text: string(data),
+	}, nil
+}
@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ThinkInAIXYZ/go-mcp/protocol"
+)
+
+// TestBuildLokiQueryMetadata verifies entry and stream counts and limit detection
+func TestBuildLokiQueryMetadata(t *testing.T) {
+	result := &LokiResult{Data: LokiData{Result: []LokiEntry{
+		{Stream: map[string]string{"job": "a"}, Values: [][]string{{"1", "x"}, {"2", "y"}}},
+		{Stream: map[string]string{"job": "b"}, Values: [][]string{{"3", "z"}}},
+	}}}
+
+	metadata := buildLokiQueryMetadata(result, 1704067200000000000, 1704070800000000000, 3, "", lokiCursor{})
+	want := LokiQueryMetadata{
+		Entries:   3,
+		Streams:   2,
+		Start:     "2024-01-01T00:00:00Z",
+		End:       "2024-01-01T01:00:00Z",
+		Limit:     3,
+		LimitHit:  true,
+		Direction: "backward",
+	}
+	if metadata != want {
+		t.Errorf("Expected %+v, got %+v", want, metadata)
+	}
+
+	if metadata := buildLokiQueryMetadata(result, 0, 0, 100, "forward", lokiCursor{}); metadata.LimitHit || metadata.Direction != "forward" {
+		t.Errorf("Expected limit not hit in forward direction, got %+v", metadata)
+	}
+	if metadata := buildLokiQueryMetadata(&LokiResult{}, 0, 0, 100, "", lokiCursor{}); metadata.Entries != 0 || metadata.Streams != 0 {
+		t.Errorf("Expected empty result to have no entries, got %+v", metadata)
+	}
+}
+
+// TestHandleLokiQueryProtocol_Metadata verifies that the metadata follows the formatted results
+func TestHandleLokiQueryProtocol_Metadata(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"status":"success","data":{"resultType":"streams","result":[{"stream":{"job":"x"},"values":[["1705312245000000000","one"],["1705312244000000000","two"]]}]}}`))
+	}))
+	defer server.Close()
+
+	for _, env := range []string{EnvLokiURL, EnvLokiOrgID, EnvLokiUsername, EnvLokiPassword, EnvLokiToken, EnvLokiMaxLimit, EnvLokiDefaultLimit, EnvLokiTimezone} {
+		t.Setenv(env, "")
+	}
+
+	if _, err := NewLokiQueryToolProtocol(); err != nil {
+		t.Fatalf("Failed to create tool: %v", err)
+	}
+
+	raw, _ := json.Marshal(map[string]any{
+		"query":  `{job="x"}`,
+		"url":    server.URL,
+		"start":  "2024-01-15T09:00:00Z",
+		"end":    "2024-01-15T10:00:00Z",
+		"limit":  2,
+		"format": "text",
+	})
+	result, err := HandleLokiQueryProtocol(context.Background(), &protocol.CallToolRequest{Name: "loki_query", RawArguments: raw})
+	if err != nil {
+		t.Fatalf("HandleLokiQueryProtocol failed: %v", err)
+	}
+	if len(result.Content) != 2 {
+		t.Fatalf("Expected results and metadata, got %d content items", len(result.Content))
+	}
+
+	var metadata LokiQueryMetadata
+	if err := json.Unmarshal([]byte(result.Content[1].(*protocol.TextContent).Text), &metadata); err != nil {
+		t.Fatalf("Expected metadata to be JSON: %v", err)
+	}
+	want := LokiQueryMetadata{
+		Entries:    2,
+		Streams:    1,
+		Start:      "2024-01-15T09:00:00Z",
+		End:        "2024-01-15T10:00:00Z",
+		Limit:      2,
+		LimitHit:   true,
+		Direction:  "backward",
+		Cursor:     formatLokiCursor("backward", 1705312244000000000, map[string]bool{lokiCursorEntryID(`job="x"`, []string{"1705312244000000000", "two"}): true}),
+		SinceToken: "1705312245000000000",
+	}
+	if metadata != want {
+		t.Errorf("Expected %+v, got %+v", want, metadata)
+	}
+}
@@ -0,0 +1,210 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ThinkInAIXYZ/go-mcp/protocol"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Registry holding the server metrics, exposed by MetricsHandler
+var metricsRegistry = prometheus.NewRegistry()
+
+var (
+	toolInvocations = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "loki_mcp_tool_invocations_total",
+		Help: "Number of MCP tool calls by tool and outcome.",
+	}, []string{"tool", "status"})
+
+	toolErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "loki_mcp_tool_errors_total",
+		Help: "Number of failed MCP tool calls by tool and error type.",
+	}, []string{"tool", "type"})
+
+	toolDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "loki_mcp_tool_duration_seconds",
+		Help:    "Duration of MCP tool calls by tool and outcome.",
+		Buckets: prometheus.ExponentialBuckets(0.01, 2, 12),
+	}, []string{"tool", "status"})
+
+	lokiRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "loki_mcp_loki_request_duration_seconds",
+		Help:    "Duration of HTTP requests to Loki by endpoint and status code, or \"error\" when no response was received.",
+		Buckets: prometheus.ExponentialBuckets(0.01, 2, 12),
+	}, []string{"endpoint", "code"})
+)
+
+func init() {
+	metricsRegistry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		toolInvocations,
+		toolErrors,
+		toolDuration,
+		lokiRequestDuration,
+	)
+}
+
+// MetricsHandler serves the server metrics in the Prometheus exposition format
+func MetricsHandler() http.Handler {
+	return promhttp.HandlerFor(metricsRegistry, promhttp.HandlerOpts{})
+}
+
+// lokiCallsKey is the context key holding the record of the Loki calls made by a tool call
+type lokiCallsKey struct{}
+
+// lokiCalls records the Loki requests made on behalf of one tool call, so that a failure can
+// be attributed to Loki or to the request itself
+type lokiCalls struct {
+	mu      sync.Mutex
+	count   int
+	err     error           // last failed Loki request, nil if all succeeded
+	charged map[string]bool // tenants already counted against LOKI_RATE_LIMIT
+}
+
+// recordLokiCall notes the outcome of a Loki request in the record attached to ctx, if any
+func recordLokiCall(ctx context.Context, err error) {
+	calls, ok := ctx.Value(lokiCallsKey{}).(*lokiCalls)
+	if !ok {
+		return
+	}
+	calls.mu.Lock()
+	defer calls.mu.Unlock()
+	calls.count++
+	calls.err = err
+}
+
+// InstrumentLokiTool wraps a tool handler to record invocation, error and latency metrics under
+// the given tool name, to trace each call in a span and to log it with its request ID
+func InstrumentLokiTool(tool string, handler func(context.Context, *protocol.CallToolRequest) (*protocol.CallToolResult, error)) func(context.Context, *protocol.CallToolRequest) (*protocol.CallToolResult, error) {
+	return func(ctx context.Context, request *protocol.CallToolRequest) (*protocol.CallToolResult, error) {
+		calls := &lokiCalls{}
+		start := time.Now()
+
+		// Calls over stdio, or from a server not using RequestIDHandler, get an ID of their own
+		requestID := lokiRequestID(ctx)
+		if requestID == "" {
+			requestID = newLokiRequestID()
+			ctx = withLokiRequestID(ctx, requestID)
+		}
+
+		query, org := lokiToolArguments(request.RawArguments)
+		logger := slog.Default().With("tool", tool, "request_id", requestID)
+		ctx = withLokiLogger(ctx, logger)
+		logger.Debug("Tool call started", "query", query, "org", org)
+
+		ctx, span := startLokiToolSpan(ctx, tool, query, org)
+		result, err := handler(context.WithValue(ctx, lokiCallsKey{}, calls), request)
+		if err == nil && result != nil && result.IsError {
+			endLokiSpan(span, fmt.Errorf("tool returned an error result"))
+		} else {
+			endLokiSpan(span, err)
+		}
+
+		duration := time.Since(start)
+		status := "success"
+		if err != nil || (result != nil && result.IsError) {
+			status = "error"
+			errorType := lokiToolErrorType(calls)
+			toolErrors.WithLabelValues(tool, errorType).Inc()
+			logger.Warn("Tool call failed", "query", query, "org", org,
+				"duration_ms", duration.Milliseconds(), "error_type", errorType, "error", err)
+		} else {
+			logger.Info("Tool call completed", "query", query, "org", org,
+				"duration_ms", duration.Milliseconds())
+		}
+		toolInvocations.WithLabelValues(tool, status).Inc()
+		toolDuration.WithLabelValues(tool, status).Observe(duration.Seconds())
+
+		// Quote the request ID so that users can refer to the call in support tickets
+		if err != nil {
+			err = fmt.Errorf("%v (request ID: %s)", err, requestID)
+		}
+		return result, err
+	}
+}
+
+// lokiToolArguments returns the query and effective org of a tool call for logs and spans. The
+// arguments are not logged as a whole since they may hold credentials.
+func lokiToolArguments(rawArguments json.RawMessage) (string, string) {
+	var args struct {
+		Query string `json:"query"`
+		Org   string `json:"org"`
+	}
+	_ = json.Unmarshal(rawArguments, &args)
+	return args.Query, getEnvOrDefault(args.Org, EnvLokiOrgID, activeLokiDefaults.Org)
+}
+
+// lokiToolErrorType classifies a failed tool call by the Loki requests it made:
+// invalid_request when it failed before reaching Loki, response when Loki answered but the
+// answer could not be used, and otherwise the kind of failure of the last Loki request
+func lokiToolErrorType(calls *lokiCalls) string {
+	calls.mu.Lock()
+	defer calls.mu.Unlock()
+
+	if calls.count == 0 {
+		return "invalid_request"
+	}
+	if calls.err == nil {
+		return "response"
+	}
+
+	var tenantRateLimitErr *LokiTenantRateLimitError
+	var rateLimitErr *LokiRateLimitError
+	var httpErr *LokiHTTPError
+	switch {
+	case errors.As(calls.err, &tenantRateLimitErr):
+		return "throttled"
+	case errors.As(calls.err, &rateLimitErr):
+		return "rate_limited"
+	case errors.As(calls.err, &httpErr) && httpErr.StatusCode >= 500:
+		return "loki_5xx"
+	case errors.As(calls.err, &httpErr):
+		return "loki_4xx"
+	case errors.Is(calls.err, context.DeadlineExceeded):
+		return "timeout"
+	case errors.Is(calls.err, context.Canceled):
+		return "canceled"
+	default:
+		return "connection"
+	}
+}
+
+// observeLokiRequest records the duration of a request to Loki that started at start
+func observeLokiRequest(queryURL, code string, start time.Time) {
+	lokiRequestDuration.WithLabelValues(lokiEndpoint(queryURL), code).Observe(time.Since(start).Seconds())
+}
+
+// lokiEndpoint names the Loki API endpoint of a request URL for use as a metric label, leaving
+// out path prefixes and label names so that the number of label values stays small
+func lokiEndpoint(queryURL string) string {
+	u, err := url.Parse(queryURL)
+	if err != nil {
+		return "unknown"
+	}
+
+	path := u.Path
+	if i := strings.Index(path, "/loki/api/v1/"); i >= 0 {
+		path = path[i+len("/loki/api/v1/"):]
+	} else {
+		path = path[strings.LastIndex(path, "/")+1:]
+	}
+	if strings.HasPrefix(path, "label/") && strings.HasSuffix(path, "/values") {
+		return "label_values"
+	}
+	if path == "" {
+		return "unknown"
+	}
+	return path
+}
@@ -0,0 +1,150 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ThinkInAIXYZ/go-mcp/protocol"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// TestInstrumentLokiTool verifies invocation counts by outcome
+func TestInstrumentLokiTool(t *testing.T) {
+	tool := "test_instrument"
+	ok := InstrumentLokiTool(tool, func(ctx context.Context, request *protocol.CallToolRequest) (*protocol.CallToolResult, error) {
+		return &protocol.CallToolResult{}, nil
+	})
+	failing := InstrumentLokiTool(tool, func(ctx context.Context, request *protocol.CallToolRequest) (*protocol.CallToolResult, error) {
+		return nil, fmt.Errorf("invalid start time")
+	})
+
+	ok(context.Background(), &protocol.CallToolRequest{})
+	ok(context.Background(), &protocol.CallToolRequest{})
+	failing(context.Background(), &protocol.CallToolRequest{})
+
+	if got := testutil.ToFloat64(toolInvocations.WithLabelValues(tool, "success")); got != 2 {
+		t.Errorf("Expected 2 successful calls, got %v", got)
+	}
+	if got := testutil.ToFloat64(toolInvocations.WithLabelValues(tool, "error")); got != 1 {
+		t.Errorf("Expected 1 failed call, got %v", got)
+	}
+	if got := testutil.ToFloat64(toolErrors.WithLabelValues(tool, "invalid_request")); got != 1 {
+		t.Errorf("Expected 1 invalid_request error, got %v", got)
+	}
+}
+
+// TestInstrumentLokiTool_LokiErrors verifies that failures are classified by the Loki response
+func TestInstrumentLokiTool_LokiErrors(t *testing.T) {
+	t.Setenv(EnvLokiMaxRetries, "0")
+
+	tests := []struct {
+		name     string
+		handler  http.HandlerFunc
+		timeout  string
+		wantType string
+	}{
+		{
+			name: "server error",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusBadGateway)
+			},
+			wantType: "loki_5xx",
+		},
+		{
+			name: "client error",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusBadRequest)
+			},
+			wantType: "loki_4xx",
+		},
+		{
+			name: "timeout",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				time.Sleep(200 * time.Millisecond)
+			},
+			timeout:  "50ms",
+			wantType: "timeout",
+		},
+		{
+			name: "unusable response",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte("not json"))
+			},
+			wantType: "response",
+		},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(tt.handler)
+			defer server.Close()
+
+			tool := fmt.Sprintf("test_loki_errors_%d", i)
+			handler := InstrumentLokiTool(tool, HandleLokiSeriesProtocol)
+			args, _ := json.Marshal(map[string]any{
+				"match":   `{job="api"}`,
+				"url":     server.URL,
+				"timeout": tt.timeout,
+			})
+			if _, err := handler(context.Background(), &protocol.CallToolRequest{RawArguments: args}); err == nil {
+				t.Fatal("Expected an error")
+			}
+
+			if got := testutil.ToFloat64(toolErrors.WithLabelValues(tool, tt.wantType)); got != 1 {
+				t.Errorf("Expected 1 %s error, got %v", tt.wantType, got)
+			}
+		})
+	}
+}
+
+// TestMetricsHandler verifies that tool and Loki request metrics are exposed
+func TestMetricsHandler(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"status":"success","data":[{"job":"api"}]}`))
+	}))
+	defer server.Close()
+
+	handler := InstrumentLokiTool("test_metrics_handler", HandleLokiSeriesProtocol)
+	args, _ := json.Marshal(map[string]any{"match": `{job="api"}`, "url": server.URL})
+	if _, err := handler(context.Background(), &protocol.CallToolRequest{RawArguments: args}); err != nil {
+		t.Fatalf("Tool call failed: %v", err)
+	}
+
+	rec := httptest.NewRecorder()
+	MetricsHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body := rec.Body.String()
+
+	for _, want := range []string{
+		`loki_mcp_tool_invocations_total{status="success",tool="test_metrics_handler"} 1`,
+		`loki_mcp_tool_duration_seconds_count{status="success",tool="test_metrics_handler"} 1`,
+		`loki_mcp_loki_request_duration_seconds_count{code="200",endpoint="series"}`,
+		`go_goroutines`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Expected metrics output to contain %s", want)
+		}
+	}
+}
+
+// TestLokiEndpoint verifies that endpoint labels leave out prefixes and label names
+func TestLokiEndpoint(t *testing.T) {
+	tests := map[string]string{
+		"http://loki:3100/loki/api/v1/query_range?query=x": "query_range",
+		"http://gateway/prefix/loki/api/v1/labels":         "labels",
+		"http://loki:3100/loki/api/v1/label/job/values":    "label_values",
+		"http://loki:3100/loki/api/v1/index/stats":         "index/stats",
+		"http://loki:3100/ready":                           "ready",
+		"http://loki:3100/":                                "unknown",
+	}
+	for queryURL, want := range tests {
+		if got := lokiEndpoint(queryURL); got != want {
+			t.Errorf("lokiEndpoint(%q) = %q, want %q", queryURL, got, want)
+		}
+	}
+}
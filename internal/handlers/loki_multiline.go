@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// lokiIndentedLine matches the lines that continue an entry under the default heuristic whatever
+// the entry looks like: indented lines and the unindented lines of Java stack traces
+var lokiIndentedLine = regexp.MustCompile(`^(\s|Caused by: |Suppressed: |\.\.\. \d+ (more|common frames omitted))`)
+
+// lokiEntryPrefix matches lines that begin with a timestamp or a level, as most log lines written
+// by an application do and the continuation lines of their stack traces do not
+var lokiEntryPrefix = regexp.MustCompile(`(?i)^\[?(\d{4}-\d{2}-\d{2}[T ]\d{2}:\d{2}|\d{2}:\d{2}:\d{2}|[a-z]{3} [ \d]\d \d{2}:\d{2}|\d{10}|(trace|debug|info|warn|warning|error|fatal|critical|panic)\b|(level|lvl|ts|time)=)`)
+
+// lokiMultiline decides which lines continue the entry before them when joinMultiline is set
+type lokiMultiline struct {
+	// pattern matches continuation lines; nil selects the default heuristic
+	pattern *regexp.Regexp
+}
+
+// resolveLokiMultiline validates the joinMultiline options of loki_query and returns how to join
+// lines, or nil when they should be left alone
+func resolveLokiMultiline(join bool, pattern string) (*lokiMultiline, error) {
+	if !join {
+		if pattern != "" {
+			return nil, fmt.Errorf("multilineRegex requires joinMultiline")
+		}
+		return nil, nil
+	}
+	if pattern == "" {
+		return &lokiMultiline{}, nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid multilineRegex: %v", err)
+	}
+	return &lokiMultiline{pattern: re}, nil
+}
+
+// continues reports whether line continues the entry whose first line is head. By default, an
+// indented line always does, and so does a line without a timestamp or level prefix after an
+// entry that has one; lines of logs without such prefixes, such as JSON, are joined only when
+// indented.
+func (m *lokiMultiline) continues(head, line string) bool {
+	if m.pattern != nil {
+		return m.pattern.MatchString(line)
+	}
+	if lokiIndentedLine.MatchString(line) {
+		return true
+	}
+	return lokiEntryPrefix.MatchString(head) && !lokiEntryPrefix.MatchString(line)
+}
+
+// joinLokiMultiline returns a copy of result in which the continuation lines of each stream, such
+// as the frames of a stack trace, are merged into the entry before them in time, separated by
+// newlines and keeping that entry's timestamp. A continuation line without an entry before it in
+// the result, for example because the limit cut the stream, is kept as an entry. It also returns
+// the number of lines merged. Metric results are returned unchanged.
+func joinLokiMultiline(result *LokiResult, m *lokiMultiline, direction string) (*LokiResult, int) {
+	if result.Data.ResultType != "" && result.Data.ResultType != "streams" {
+		return result, 0
+	}
+
+	joined := *result
+	joined.Data.Result = make([]LokiEntry, len(result.Data.Result))
+	merged := 0
+	for i, entry := range result.Data.Result {
+		// Walk the stream oldest first, since a continuation follows its entry in time
+		values := slices.Clone(entry.Values)
+		if direction != "forward" {
+			slices.Reverse(values)
+		}
+
+		var out [][]string
+		head := ""
+		for _, val := range values {
+			if len(val) < 2 {
+				out = append(out, val)
+				continue
+			}
+			if len(out) > 0 && len(out[len(out)-1]) >= 2 && m.continues(head, val[1]) {
+				last := out[len(out)-1]
+				out[len(out)-1] = []string{last[0], strings.TrimRight(last[1], "\r\n") + "\n" + strings.TrimRight(val[1], "\r\n")}
+				merged++
+				continue
+			}
+			head = val[1]
+			out = append(out, val)
+		}
+
+		if direction != "forward" {
+			slices.Reverse(out)
+		}
+		joined.Data.Result[i] = LokiEntry{Stream: entry.Stream, Values: out}
+	}
+	return &joined, merged
+}
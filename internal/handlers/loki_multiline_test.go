@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/ThinkInAIXYZ/go-mcp/protocol"
+)
+
+// multilineResult returns a single stream result holding lines, given oldest first, in the order
+// Loki returns them for direction
+func multilineResult(direction string, lines ...string) *LokiResult {
+	values := make([][]string, len(lines))
+	for i, line := range lines {
+		values[i] = []string{strconv.Itoa(1705312800000000000 + i), line}
+	}
+	if direction != "forward" {
+		for i, j := 0, len(values)-1; i < j; i, j = i+1, j-1 {
+			values[i], values[j] = values[j], values[i]
+		}
+	}
+	return &LokiResult{Status: "success", Data: LokiData{ResultType: "streams", Result: []LokiEntry{{Stream: map[string]string{"job": "api"}, Values: values}}}}
+}
+
+// multilineLines returns the lines of the single stream of result
+func multilineLines(result *LokiResult) []string {
+	var lines []string
+	for _, val := range result.Data.Result[0].Values {
+		lines = append(lines, val[1])
+	}
+	return lines
+}
+
+// TestJoinLokiMultiline verifies that stack traces are merged into the line before them
+func TestJoinLokiMultiline(t *testing.T) {
+	lines := []string{
+		"2024-01-15 10:00:00 INFO starting",
+		"2024-01-15 10:00:01 ERROR request failed",
+		"java.lang.IllegalStateException: boom",
+		"\tat com.example.Api.handle(Api.java:42)",
+		"Caused by: java.io.IOException: closed",
+		"\t... 12 more",
+		"2024-01-15 10:00:02 INFO recovered",
+	}
+	m, _ := resolveLokiMultiline(true, "")
+
+	for _, direction := range []string{"backward", "forward"} {
+		joined, merged := joinLokiMultiline(multilineResult(direction, lines...), m, direction)
+		got := multilineLines(joined)
+		if direction == "backward" {
+			got[0], got[2] = got[2], got[0]
+		}
+		want := []string{lines[0], strings.Join(lines[1:6], "\n"), lines[6]}
+		if merged != 4 || strings.Join(got, "|") != strings.Join(want, "|") {
+			t.Errorf("%s: expected %q with 4 merged, got %q with %d", direction, want, got, merged)
+		}
+		if ts := joined.Data.Result[0].Values[1][0]; ts != "1705312800000000001" {
+			t.Errorf("%s: expected the timestamp of the first line, got %s", direction, ts)
+		}
+	}
+}
+
+// TestJoinLokiMultilineJSON verifies that lines without a prefix are only joined when indented
+func TestJoinLokiMultilineJSON(t *testing.T) {
+	lines := []string{`{"msg":"one"}`, `{"msg":"two"}`, "  indented"}
+	m, _ := resolveLokiMultiline(true, "")
+	joined, merged := joinLokiMultiline(multilineResult("forward", lines...), m, "forward")
+	if got := multilineLines(joined); merged != 1 || len(got) != 2 || got[1] != "{\"msg\":\"two\"}\n  indented" {
+		t.Errorf("Unexpected %q with %d merged", got, merged)
+	}
+
+	// A custom pattern replaces the heuristic
+	m, _ = resolveLokiMultiline(true, `^\+`)
+	joined, merged = joinLokiMultiline(multilineResult("forward", "head", "+ more", "  not joined"), m, "forward")
+	if got := multilineLines(joined); merged != 1 || len(got) != 2 {
+		t.Errorf("Unexpected %q with %d merged", got, merged)
+	}
+}
+
+// TestResolveLokiMultiline verifies the validation of the joinMultiline options
+func TestResolveLokiMultiline(t *testing.T) {
+	if m, err := resolveLokiMultiline(false, ""); m != nil || err != nil {
+		t.Errorf("Expected nothing to join, got %v, %v", m, err)
+	}
+	if _, err := resolveLokiMultiline(false, `^\s`); err == nil {
+		t.Error("Expected error for multilineRegex without joinMultiline")
+	}
+	if _, err := resolveLokiMultiline(true, `(`); err == nil {
+		t.Error("Expected error for an invalid multilineRegex")
+	}
+}
+
+// TestHandleLokiQueryProtocol_JoinMultiline verifies that lineRegex sees the joined entries
+func TestHandleLokiQueryProtocol_JoinMultiline(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(multilineResult("backward",
+			"10:00:00 INFO ok",
+			"10:00:01 ERROR failed",
+			"\tat handler.go:10",
+		))
+	}))
+	defer server.Close()
+
+	NewLokiQueryToolProtocol()
+	args, _ := json.Marshal(map[string]any{"query": `{job="api"}`, "url": server.URL, "format": "raw", "joinMultiline": true, "lineRegex": "handler.go"})
+	result, err := HandleLokiQueryProtocol(context.Background(), &protocol.CallToolRequest{RawArguments: args})
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	text := result.Content[0].(*protocol.TextContent).Text
+	if !strings.Contains(text, "10:00:01 ERROR failed\n\tat handler.go:10") || strings.Contains(text, "INFO ok") {
+		t.Errorf("Expected only the joined error entry, got %s", text)
+	}
+	var notes string
+	for _, c := range result.Content[1:] {
+		notes += c.(*protocol.TextContent).Text
+	}
+	if !strings.Contains(notes, "joinMultiline: 1 continuation lines merged") {
+		t.Errorf("Expected a joinMultiline note, got %s", notes)
+	}
+}
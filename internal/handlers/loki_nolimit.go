@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// checkLokiNoLimit reports an error when noLimit is requested for a range that is still growing,
+// or together with an option that sets the limit or the range itself
+func checkLokiNoLimit(req *LokiQueryRequest, end int64, now time.Time) error {
+	if !req.NoLimit {
+		return nil
+	}
+	var options []string
+	if req.Limit > 0 {
+		options = append(options, "limit")
+	}
+	if req.Cursor != "" {
+		options = append(options, "cursor")
+	}
+	if req.SinceToken != "" {
+		options = append(options, "sinceToken")
+	}
+	if req.AutoWiden {
+		options = append(options, "autoWiden")
+	}
+	if req.CountOnly {
+		options = append(options, "countOnly")
+	}
+	if len(options) > 0 {
+		return fmt.Errorf("noLimit fetches every entry in the range, so it cannot be combined with %s", strings.Join(options, ", "))
+	}
+	if value := strings.TrimSpace(req.End); value == "" || value == "now" || end > now.UnixNano() {
+		return fmt.Errorf("noLimit needs an end time in the past, since a range ending now keeps growing; set end, e.g. to now-5m or an RFC3339 time")
+	}
+	return nil
+}
+
+// fetchAllLokiPages runs a log query over the range from start to end (Unix ns) in pages of
+// pageSize entries until a page comes back short, and merges the pages into one result. Each page
+// resumes at the timestamp where the previous one stopped, skipping the entries already returned
+// at that timestamp, so that entries sharing a timestamp across pages are neither lost nor
+// repeated. It fails once the merged lines exceed maxBytes. It also returns the number of pages.
+func fetchAllLokiPages(start, end int64, pageSize int, direction string, maxBytes int64, fetch func(start, end int64) (*LokiResult, error)) (*LokiResult, int, error) {
+	merged := &LokiResult{Status: "success", Data: LokiData{ResultType: "streams"}}
+	streams := make(map[string]int)
+	var seen map[string]bool
+	var size int64
+	var previous int64 = -1
+
+	for pages := 1; ; pages++ {
+		page, err := fetch(start, end)
+		if err != nil {
+			return nil, pages, err
+		}
+		// Metric queries return every series at once
+		if page.Metric != nil {
+			return page, pages, nil
+		}
+		merged.Status = page.Status
+		merged.Data.Stats = page.Data.Stats
+		for _, warning := range page.Warnings {
+			if !slices.Contains(merged.Warnings, warning) {
+				merged.Warnings = append(merged.Warnings, warning)
+			}
+		}
+
+		// Entries at the new boundary are skipped by the next page; if the boundary did not move,
+		// so are those skipped by this one
+		boundary, found := lokiBoundaryTimestamp(page, direction == "forward")
+		atBoundary := make(map[string]bool)
+		if boundary == previous {
+			for id := range seen {
+				atBoundary[id] = true
+			}
+		}
+
+		added := 0
+		for _, entry := range page.Data.Result {
+			key := streamKey(entry.Stream)
+			for _, val := range entry.Values {
+				if len(val) < 2 {
+					continue
+				}
+				id := key + "\x00" + val[0] + "\x00" + val[1]
+				if seen[id] {
+					continue
+				}
+				if ts, err := strconv.ParseInt(val[0], 10, 64); err == nil && ts == boundary {
+					atBoundary[id] = true
+				}
+				i, ok := streams[key]
+				if !ok {
+					i = len(merged.Data.Result)
+					streams[key] = i
+					merged.Data.Result = append(merged.Data.Result, LokiEntry{Stream: entry.Stream})
+				}
+				merged.Data.Result[i].Values = append(merged.Data.Result[i].Values, val)
+				size += int64(len(val[1]))
+				added++
+			}
+		}
+		if size > maxBytes {
+			return nil, pages, fmt.Errorf("noLimit results exceeded %d bytes (%s) after %d pages; narrow the time range or the query",
+				maxBytes, EnvLokiMaxResponseBytes, pages)
+		}
+		if !found || countLokiEntries(page) < pageSize {
+			return merged, pages, nil
+		}
+
+		// A page holding only entries already returned means more entries share the boundary
+		// timestamp than fit in a page, so move past it rather than asking for it again
+		if added == 0 {
+			seen, previous = nil, -1
+			if direction == "forward" {
+				start = boundary + 1
+			} else {
+				end = boundary
+			}
+			continue
+		}
+		seen, previous = atBoundary, boundary
+		if direction == "forward" {
+			start = boundary
+		} else {
+			end = boundary + 1
+		}
+	}
+}
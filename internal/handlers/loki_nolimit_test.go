@@ -0,0 +1,157 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ThinkInAIXYZ/go-mcp/protocol"
+)
+
+// fakeLokiPages serves a single stream of entries (timestamp, line) like query_range does, with
+// start inclusive, end exclusive, the direction and the limit applied
+func fakeLokiPages(entries [][2]int64) func(start, end int64, limit int, direction string) *LokiResult {
+	return func(start, end int64, limit int, direction string) *LokiResult {
+		var values [][]string
+		for _, e := range entries {
+			if e[0] >= start && e[0] < end {
+				values = append(values, []string{strconv.FormatInt(e[0], 10), fmt.Sprintf("line %d", e[1])})
+			}
+		}
+		sort.SliceStable(values, func(i, j int) bool {
+			ti, _ := strconv.ParseInt(values[i][0], 10, 64)
+			tj, _ := strconv.ParseInt(values[j][0], 10, 64)
+			if direction == "forward" {
+				return ti < tj
+			}
+			return ti > tj
+		})
+		if len(values) > limit {
+			values = values[:limit]
+		}
+		return &LokiResult{Status: "success", Data: LokiData{ResultType: "streams", Result: []LokiEntry{{Stream: map[string]string{"job": "a"}, Values: values}}}}
+	}
+}
+
+// TestCheckLokiNoLimit verifies that noLimit needs a fixed past end and no paging options
+func TestCheckLokiNoLimit(t *testing.T) {
+	now := time.Now()
+	past := now.Add(-time.Hour).UnixNano()
+	if err := checkLokiNoLimit(&LokiQueryRequest{NoLimit: true, End: "-1h"}, past, now); err != nil {
+		t.Errorf("Expected a past end to be accepted, got %v", err)
+	}
+	invalid := []*LokiQueryRequest{
+		{NoLimit: true},
+		{NoLimit: true, End: "now"},
+		{NoLimit: true, End: "-1h", Limit: 10},
+		{NoLimit: true, End: "-1h", Cursor: "backward:1"},
+		{NoLimit: true, End: "-1h", AutoWiden: true},
+	}
+	for _, req := range invalid {
+		if err := checkLokiNoLimit(req, past, now); err == nil {
+			t.Errorf("Expected error for %+v", req)
+		}
+	}
+	if err := checkLokiNoLimit(&LokiQueryRequest{NoLimit: true, End: "+1h"}, now.Add(time.Hour).UnixNano(), now); err == nil {
+		t.Error("Expected error for an end in the future")
+	}
+}
+
+// TestFetchAllLokiPages verifies that pages are merged without losing or repeating entries that
+// share a timestamp across a page boundary
+func TestFetchAllLokiPages(t *testing.T) {
+	entries := [][2]int64{{10, 1}, {20, 2}, {20, 3}, {20, 4}, {30, 5}, {40, 6}, {40, 7}, {50, 8}}
+	serve := fakeLokiPages(entries)
+
+	for _, direction := range []string{"backward", "forward"} {
+		result, pages, err := fetchAllLokiPages(0, 100, 3, direction, 1<<20, func(start, end int64) (*LokiResult, error) {
+			return serve(start, end, 3, direction), nil
+		})
+		if err != nil {
+			t.Fatalf("fetchAllLokiPages(%s) failed: %v", direction, err)
+		}
+		var lines []string
+		for _, val := range result.Data.Result[0].Values {
+			lines = append(lines, val[1])
+		}
+		if len(lines) != len(entries) || pages < 3 {
+			t.Errorf("%s: expected all %d entries, got %d in %d pages: %v", direction, len(entries), len(lines), pages, lines)
+		}
+		seen := map[string]bool{}
+		for _, line := range lines {
+			if seen[line] {
+				t.Errorf("%s: %s repeated", direction, line)
+			}
+			seen[line] = true
+		}
+	}
+
+	// More entries at one timestamp than a page holds cannot all be fetched, but paging moves on
+	tied := fakeLokiPages([][2]int64{{5, 1}, {20, 2}, {20, 3}, {20, 4}, {20, 5}})
+	result, _, err := fetchAllLokiPages(0, 100, 2, "backward", 1<<20, func(start, end int64) (*LokiResult, error) {
+		return tied(start, end, 2, "backward"), nil
+	})
+	if err != nil || countLokiEntries(result) != 3 {
+		t.Errorf("Expected to move past the crowded timestamp, got %d entries, %v", countLokiEntries(result), err)
+	}
+
+	if _, _, err := fetchAllLokiPages(0, 100, 3, "backward", 10, func(start, end int64) (*LokiResult, error) {
+		return serve(start, end, 3, "backward"), nil
+	}); err == nil || !strings.Contains(err.Error(), EnvLokiMaxResponseBytes) {
+		t.Errorf("Expected the size guard to stop paging, got %v", err)
+	}
+}
+
+// TestHandleLokiQueryProtocol_NoLimit verifies that noLimit returns the whole range without a cursor
+func TestHandleLokiQueryProtocol_NoLimit(t *testing.T) {
+	t.Setenv(EnvLokiMaxLimit, "2")
+	base := time.Now().Add(-2 * time.Hour).UnixNano()
+	var entries [][2]int64
+	for i := int64(0); i < 7; i++ {
+		entries = append(entries, [2]int64{base + i/2*int64(time.Second), i})
+	}
+	serve := fakeLokiPages(entries)
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		q := r.URL.Query()
+		start, _ := strconv.ParseInt(q.Get("start"), 10, 64)
+		end, _ := strconv.ParseInt(q.Get("end"), 10, 64)
+		limit, _ := strconv.Atoi(q.Get("limit"))
+		json.NewEncoder(w).Encode(serve(start, end, limit, q.Get("direction")))
+	}))
+	defer server.Close()
+
+	if _, err := NewLokiQueryToolProtocol(); err != nil {
+		t.Fatalf("Failed to create tool: %v", err)
+	}
+	raw, _ := json.Marshal(map[string]any{"query": `{job="a"}`, "url": server.URL, "format": "raw", "start": "-3h", "end": "-1h", "noLimit": true})
+	result, err := HandleLokiQueryProtocol(context.Background(), &protocol.CallToolRequest{Name: "loki_query", RawArguments: raw})
+	if err != nil {
+		t.Fatalf("HandleLokiQueryProtocol failed: %v", err)
+	}
+	var metadata LokiQueryMetadata
+	if err := json.Unmarshal([]byte(result.Content[1].(*protocol.TextContent).Text), &metadata); err != nil {
+		t.Fatalf("Invalid metadata: %v", err)
+	}
+	if metadata.Entries != 7 || metadata.LimitHit || metadata.Cursor != "" || requests < 4 {
+		t.Errorf("Expected all 7 entries without a cursor, got %+v after %d requests", metadata, requests)
+	}
+	for i := 0; i < 7; i++ {
+		if !strings.Contains(result.Content[0].(*protocol.TextContent).Text, fmt.Sprintf("line %d\n", i)) {
+			t.Errorf("Expected line %d in the output", i)
+		}
+	}
+
+	raw, _ = json.Marshal(map[string]any{"query": `{job="a"}`, "url": server.URL, "noLimit": true})
+	if _, err := HandleLokiQueryProtocol(context.Background(), &protocol.CallToolRequest{Name: "loki_query", RawArguments: raw}); err == nil {
+		t.Error("Expected error for noLimit up to now")
+	}
+}
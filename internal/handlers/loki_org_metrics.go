@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"fmt"
+	"hash/fnv"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Environment variable name for the org IDs reported under their own name in the per-org metrics
+const EnvLokiMetricsOrgs = "LOKI_METRICS_ORGS"
+
+// Environment variable name for the number of buckets other org IDs are hashed into in the
+// per-org metrics
+const EnvLokiMetricsOrgBuckets = "LOKI_METRICS_ORG_BUCKETS"
+
+var (
+	orgRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "loki_mcp_org_requests_total",
+		Help: "Number of requests sent to Loki by org ID and endpoint.",
+	}, []string{"org", "endpoint"})
+
+	orgResponseBytes = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "loki_mcp_org_response_bytes",
+		Help:    "Size of the Loki responses read for each request, after decompression, by org ID and endpoint.",
+		Buckets: prometheus.ExponentialBuckets(1024, 4, 10),
+	}, []string{"org", "endpoint"})
+)
+
+func init() {
+	metricsRegistry.MustRegister(orgRequests, orgResponseBytes)
+}
+
+// loadLokiMetricsOrgs reads the org IDs reported under their own name and the number of buckets
+// for the others from the environment
+func loadLokiMetricsOrgs() ([]string, int, error) {
+	var orgs []string
+	for _, org := range strings.Split(os.Getenv(EnvLokiMetricsOrgs), ",") {
+		if org = strings.TrimSpace(org); org != "" {
+			orgs = append(orgs, org)
+		}
+	}
+
+	buckets := 0
+	if raw := os.Getenv(EnvLokiMetricsOrgBuckets); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 0 {
+			return nil, 0, fmt.Errorf("invalid %s: %q must be a non-negative integer", EnvLokiMetricsOrgBuckets, raw)
+		}
+		buckets = n
+	}
+	return orgs, buckets, nil
+}
+
+// CheckLokiMetricsOrgs validates the per-org metrics settings so that mistakes are reported at
+// startup. It returns the org IDs reported under their own name and the number of buckets.
+func CheckLokiMetricsOrgs() ([]string, int, error) {
+	return loadLokiMetricsOrgs()
+}
+
+// lokiMetricsOrg returns the org label for orgID. Without LOKI_METRICS_ORGS or
+// LOKI_METRICS_ORG_BUCKETS every org ID is its own label. Otherwise only the listed org IDs are,
+// and the others share the label other, or with buckets a label such as bucket-3 picked by a hash
+// of the org ID, so that unknown tenants cannot grow the number of series without bound.
+func lokiMetricsOrg(orgID string) string {
+	if orgID == "" {
+		return "none"
+	}
+	orgs, buckets, err := loadLokiMetricsOrgs()
+	if err != nil {
+		return "other" // already reported at startup by CheckLokiMetricsOrgs
+	}
+	if slices.Contains(orgs, orgID) || (len(orgs) == 0 && buckets == 0) {
+		return orgID
+	}
+	if buckets == 0 {
+		return "other"
+	}
+	h := fnv.New32a()
+	h.Write([]byte(orgID))
+	return fmt.Sprintf("bucket-%d", h.Sum32()%uint32(buckets))
+}
+
+// lokiCountingReader counts the bytes read through it
+type lokiCountingReader struct {
+	r io.Reader
+	n *int64
+}
+
+func (c lokiCountingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	*c.n += int64(n)
+	return n, err
+}
+
+// countLokiOrgRequest wraps read so that the bytes it reads, over all attempts of a request, are
+// counted for orgID. The returned function records the request in the per-org metrics.
+func countLokiOrgRequest(orgID, queryURL string, read func(io.Reader) error) (func(io.Reader) error, func()) {
+	var size int64
+	counted := func(r io.Reader) error {
+		return read(lokiCountingReader{r: r, n: &size})
+	}
+	observe := func() {
+		org, endpoint := lokiMetricsOrg(orgID), lokiEndpoint(queryURL)
+		orgRequests.WithLabelValues(org, endpoint).Inc()
+		orgResponseBytes.WithLabelValues(org, endpoint).Observe(float64(size))
+	}
+	return counted, observe
+}
@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// TestLokiMetricsOrg verifies how org IDs are turned into metric labels
+func TestLokiMetricsOrg(t *testing.T) {
+	if got := lokiMetricsOrg("team-a"); got != "team-a" {
+		t.Errorf("Expected every org as its own label by default, got %q", got)
+	}
+	if got := lokiMetricsOrg(""); got != "none" {
+		t.Errorf("Expected none without an org, got %q", got)
+	}
+
+	t.Setenv(EnvLokiMetricsOrgs, "team-a, team-b")
+	if got := lokiMetricsOrg("team-b"); got != "team-b" {
+		t.Errorf("Expected a listed org as its own label, got %q", got)
+	}
+	if got := lokiMetricsOrg("team-c"); got != "other" {
+		t.Errorf("Expected other for an unlisted org, got %q", got)
+	}
+
+	t.Setenv(EnvLokiMetricsOrgBuckets, "4")
+	got := lokiMetricsOrg("team-c")
+	if got != lokiMetricsOrg("team-c") || len(got) != len("bucket-0") || got[:7] != "bucket-" {
+		t.Errorf("Expected a stable bucket for an unlisted org, got %q", got)
+	}
+	if got := lokiMetricsOrg("team-a"); got != "team-a" {
+		t.Errorf("Expected a listed org as its own label, got %q", got)
+	}
+
+	t.Setenv(EnvLokiMetricsOrgBuckets, "-1")
+	if _, _, err := CheckLokiMetricsOrgs(); err == nil {
+		t.Error("Expected error for a negative number of buckets")
+	}
+}
+
+// TestCountLokiOrgRequest verifies that requests and response bytes are counted for their org
+func TestCountLokiOrgRequest(t *testing.T) {
+	body := `{"status":"success","data":[{"job":"api"}]}`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(body))
+	}))
+	defer server.Close()
+
+	for i := 0; i < 2; i++ {
+		err := streamLokiRequest(context.Background(), server.URL+"/loki/api/v1/series", "", "", "", "test-org-metrics", func(r io.Reader) error {
+			_, err := io.ReadAll(r)
+			return err
+		})
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+	}
+
+	if got := testutil.ToFloat64(orgRequests.WithLabelValues("test-org-metrics", "series")); got != 2 {
+		t.Errorf("Expected 2 requests, got %v", got)
+	}
+	rec := httptest.NewRecorder()
+	MetricsHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	want := fmt.Sprintf(`loki_mcp_org_response_bytes_sum{endpoint="series",org="test-org-metrics"} %d`, 2*len(body))
+	if !strings.Contains(rec.Body.String(), want) {
+		t.Errorf("Expected metrics output to contain %s", want)
+	}
+}
@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// lokiOutputLabelFormats lists the formats that show a stream identifier built from its labels;
+// the others must stay faithful to Loki's data or do not show labels at all
+var lokiOutputLabelFormats = []string{"raw", "text", "logfmt", "color", "markdown"}
+
+// checkLokiOutputLabels reports an error when outputLabels is requested with an output that does
+// not show stream labels, or names an empty label
+func checkLokiOutputLabels(labels []string, format string, fields []string, summarize bool) error {
+	if len(labels) == 0 {
+		return nil
+	}
+	if len(fields) > 0 || summarize {
+		return fmt.Errorf("outputLabels cannot be combined with fields or summarize")
+	}
+	if !slices.Contains(lokiOutputLabelFormats, format) {
+		return fmt.Errorf("outputLabels is not supported with format %s, supported formats: %s", format, strings.Join(lokiOutputLabelFormats, ", "))
+	}
+	for _, label := range labels {
+		if strings.TrimSpace(label) == "" {
+			return fmt.Errorf("outputLabels must not contain empty label names")
+		}
+	}
+	return nil
+}
+
+// selectLokiOutputLabels returns a copy of result in which each stream keeps only the given label
+// keys, so that high-cardinality label sets do not crowd out the lines. Labels a stream does not
+// have are omitted.
+func selectLokiOutputLabels(result *LokiResult, labels []string) *LokiResult {
+	if len(labels) == 0 {
+		return result
+	}
+
+	selected := *result
+	selected.Data.Result = make([]LokiEntry, len(result.Data.Result))
+	for i, entry := range result.Data.Result {
+		stream := make(map[string]string, len(labels))
+		for _, label := range labels {
+			label = strings.TrimSpace(label)
+			if value, ok := entry.Stream[label]; ok {
+				stream[label] = value
+			}
+		}
+		selected.Data.Result[i] = LokiEntry{Stream: stream, Values: entry.Values}
+	}
+	return &selected
+}
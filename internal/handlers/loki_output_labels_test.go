@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ThinkInAIXYZ/go-mcp/protocol"
+)
+
+// outputLabelsTestResult holds two streams with high-cardinality labels
+func outputLabelsTestResult() *LokiResult {
+	return &LokiResult{Status: "success", Data: LokiData{ResultType: "streams", Result: []LokiEntry{
+		{Stream: map[string]string{"pod": "api-7f9c", "container": "api", "node": "ip-10-0-0-1", "filename": "/var/log/pods/api.log"}, Values: [][]string{{"200", "api line"}}},
+		{Stream: map[string]string{"pod": "web-1a2b", "node": "ip-10-0-0-2"}, Values: [][]string{{"100", "web line"}}},
+	}}}
+}
+
+// TestSelectLokiOutputLabels verifies that only the requested labels are kept and unknown ones are omitted
+func TestSelectLokiOutputLabels(t *testing.T) {
+	result := outputLabelsTestResult()
+	selected := selectLokiOutputLabels(result, []string{"pod", " container", "missing"})
+
+	if got := selected.Data.Result[0].Stream; len(got) != 2 || got["pod"] != "api-7f9c" || got["container"] != "api" {
+		t.Errorf("Unexpected labels for the first stream: %v", got)
+	}
+	if got := selected.Data.Result[1].Stream; len(got) != 1 || got["pod"] != "web-1a2b" {
+		t.Errorf("Unexpected labels for the second stream: %v", got)
+	}
+	if len(result.Data.Result[0].Stream) != 4 {
+		t.Errorf("Expected the original result to be left unchanged, got %v", result.Data.Result[0].Stream)
+	}
+	if selectLokiOutputLabels(result, nil) != result {
+		t.Error("Expected the result to be returned as is without outputLabels")
+	}
+}
+
+// TestCheckLokiOutputLabels verifies the outputs outputLabels can be combined with
+func TestCheckLokiOutputLabels(t *testing.T) {
+	tests := []struct {
+		labels    []string
+		format    string
+		fields    []string
+		summarize bool
+		wantErr   bool
+	}{
+		{format: "json"},
+		{labels: []string{"pod"}, format: "raw"},
+		{labels: []string{"pod"}, format: "logfmt"},
+		{labels: []string{"pod"}, format: "json", wantErr: true},
+		{labels: []string{"pod"}, format: "push", wantErr: true},
+		{labels: []string{"pod"}, format: "raw", fields: []string{"msg"}, wantErr: true},
+		{labels: []string{"pod"}, format: "raw", summarize: true, wantErr: true},
+		{labels: []string{"pod", " "}, format: "text", wantErr: true},
+	}
+	for _, tt := range tests {
+		err := checkLokiOutputLabels(tt.labels, tt.format, tt.fields, tt.summarize)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("checkLokiOutputLabels(%v, %q, %v, %v) = %v", tt.labels, tt.format, tt.fields, tt.summarize, err)
+		}
+	}
+}
+
+// TestHandleLokiQueryProtocol_OutputLabels verifies that formatted output shows only the selected
+// labels while json output keeps them all
+func TestHandleLokiQueryProtocol_OutputLabels(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(outputLabelsTestResult())
+	}))
+	defer server.Close()
+
+	if _, err := NewLokiQueryToolProtocol(); err != nil {
+		t.Fatalf("Failed to create tool: %v", err)
+	}
+
+	query := func(format string, labels []string) (string, error) {
+		args := map[string]any{"query": `{pod=~".+"}`, "url": server.URL, "format": format}
+		if labels != nil {
+			args["outputLabels"] = labels
+		}
+		raw, _ := json.Marshal(args)
+		result, err := HandleLokiQueryProtocol(context.Background(), &protocol.CallToolRequest{Name: "loki_query", RawArguments: raw})
+		if err != nil {
+			return "", err
+		}
+		return result.Content[0].(*protocol.TextContent).Text, nil
+	}
+
+	text, err := query("text", []string{"pod"})
+	if err != nil {
+		t.Fatalf("HandleLokiQueryProtocol failed: %v", err)
+	}
+	if !strings.Contains(text, "Stream (pod=api-7f9c) 1:") || !strings.Contains(text, "Stream (pod=web-1a2b) 2:") || strings.Contains(text, "node=") {
+		t.Errorf("Unexpected text output:\n%s", text)
+	}
+
+	raw, err := query("raw", []string{"container"})
+	if err != nil {
+		t.Fatalf("HandleLokiQueryProtocol failed: %v", err)
+	}
+	if !strings.Contains(raw, "{container=api} api line") || !strings.Contains(raw, "web line") || strings.Contains(raw, "pod=") {
+		t.Errorf("Unexpected raw output:\n%s", raw)
+	}
+
+	if _, err := query("json", []string{"pod"}); err == nil {
+		t.Error("Expected outputLabels to be rejected with json format")
+	}
+	full, err := query("json", nil)
+	if err != nil || !strings.Contains(full, "ip-10-0-0-1") {
+		t.Errorf("Expected json output to keep every label, got %v:\n%s", err, full)
+	}
+}
@@ -0,0 +1,242 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ThinkInAIXYZ/go-mcp/protocol"
+)
+
+// LokiPatternsRequest represents the arguments for loki_patterns tool
+type LokiPatternsRequest struct {
+	Query           string            `json:"query" description:"LogQL stream selector whose lines to cluster into patterns, e.g. {job=\"varlogs\"}"`
+	URL             string            `json:"url,omitempty" description:"Loki server URL"`
+	Backend         string            `json:"backend,omitempty" description:"Name of a Loki backend from LOKI_BACKENDS, e.g. prod, whose URL and credentials to use; cannot be combined with url, and an explicit credential still wins"`
+	Username        string            `json:"username,omitempty" description:"Username for basic authentication"`
+	Password        string            `json:"password,omitempty" description:"Password for basic authentication"`
+	Token           string            `json:"token,omitempty" description:"Bearer token for authentication"`
+	Start           string            `json:"start,omitempty" description:"Start time for the query"`
+	End             string            `json:"end,omitempty" description:"End time for the query"`
+	Timezone        string            `json:"timezone,omitempty" description:"IANA timezone for start and end times without a zone, e.g. America/New_York (default: LOKI_TIMEZONE or UTC)"`
+	AllowLargeRange bool              `json:"allowLargeRange,omitempty" description:"Query a time range longer than LOKI_MAX_TIME_RANGE anyway; long ranges are expensive for Loki, so only set this when a narrower range will not do (default: false)"`
+	Step            string            `json:"step,omitempty" description:"Width of the buckets pattern counts are reported in, as a duration (e.g. 5m) or seconds (default: chosen by Loki)"`
+	Org             string            `json:"org,omitempty" description:"Organization ID for the query; separate several with commas to query tenants together"`
+	Headers         map[string]string `json:"headers,omitempty" description:"Extra HTTP headers to send to Loki, e.g. {\"X-Api-Key\": \"...\"}; never replaces the auth or org headers"`
+	Timeout         string            `json:"timeout,omitempty" description:"Timeout for the Loki request as a duration (e.g. 45s) or seconds (default: LOKI_QUERY_TIMEOUT or 30s)"`
+	Format          string            `json:"format,omitempty" description:"Output format: raw (total count and pattern per line), json, or text (patterns with their counts over time)"`
+}
+
+// LokiPattern is a template of similar log lines, in which the varying parts are shown as <_>,
+// with the number of matching lines per step
+type LokiPattern struct {
+	Pattern string       `json:"pattern"`
+	Level   string       `json:"level,omitempty"`
+	Samples [][2]float64 `json:"samples"` // [Unix seconds, count]
+}
+
+// LokiPatternsResult represents the structure of Loki patterns results
+type LokiPatternsResult struct {
+	Status string        `json:"status"`
+	Data   []LokiPattern `json:"data"`
+	Error  string        `json:"error,omitempty"`
+}
+
+// NewLokiPatternsToolProtocol creates a tool using the protocol library
+func NewLokiPatternsToolProtocol() (*protocol.Tool, error) {
+	return protocol.NewTool("loki_patterns", "Get the patterns Grafana Loki detected in the lines of a stream selector, with their counts over time, for a compact overview of noisy logs (requires Loki 3.0 or later with pattern detection enabled)", LokiPatternsRequest{})
+}
+
+// HandleLokiPatternsProtocol handles Loki patterns tool requests using protocol library
+func HandleLokiPatternsProtocol(ctx context.Context, request *protocol.CallToolRequest) (*protocol.CallToolResult, error) {
+	req := new(LokiPatternsRequest)
+	if err := protocol.VerifyAndUnmarshal(request.RawArguments, req); err != nil {
+		return nil, err
+	}
+
+	if err := validateLogQL(req.Query); err != nil {
+		return nil, err
+	}
+
+	ctx, conn, err := resolveLokiCall(ctx, req.Backend, req.URL, req.Username, req.Password, req.Token, req.Org, req.Timeout, req.Headers)
+	if err != nil {
+		return nil, err
+	}
+	lokiURL, username, password, token, orgID := conn.URL, conn.Username, conn.Password, conn.Token, conn.OrgID
+
+	// Fail with a readable error when Loki is known to be too old for the endpoint
+	if err := checkLokiVersion(ctx, conn, "loki_patterns", lokiPatternsVersion); err != nil {
+		return nil, err
+	}
+
+	start, end, err := resolveLokiRange(req.Start, req.End, req.Timezone, req.AllowLargeRange)
+	if err != nil {
+		return nil, err
+	}
+
+	var step time.Duration
+	if req.Step != "" {
+		if step, err = parsePositiveDuration("step", req.Step); err != nil {
+			return nil, err
+		}
+	}
+
+	format := resolveLokiFormat(req.Format, lokiLabelFormats)
+
+	patternsURL, err := buildLokiPatternsURL(lokiURL, req.Query, start, end, step)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build patterns URL: %v", err)
+	}
+
+	result, err := executeLokiPatternsQuery(ctx, patternsURL, username, password, token, orgID)
+	if err != nil {
+		return nil, fmt.Errorf("patterns query execution failed: %v", err)
+	}
+
+	formattedResult, err := formatLokiPatternsResults(result, format)
+	if err != nil {
+		return nil, fmt.Errorf("failed to format results: %v", err)
+	}
+
+	return &protocol.CallToolResult{
+		Content: []protocol.Content{
+			&protocol.TextContent{
+				Type: "text",
+				Text: formattedResult,
+			},
+		},
+	}, nil
+}
+
+// buildLokiPatternsURL constructs the Loki patterns URL; a zero step leaves the bucket width to Loki
+func buildLokiPatternsURL(baseURL, query string, start, end int64, step time.Duration) (string, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return "", err
+	}
+
+	// Add path for Loki patterns API
+	if !strings.Contains(u.Path, "loki/api/v1") {
+		if u.Path == "" || u.Path == "/" {
+			u.Path = "/loki/api/v1/patterns"
+		} else {
+			u.Path = fmt.Sprintf("%s/loki/api/v1/patterns", u.Path)
+		}
+	} else {
+		// If path already contains loki/api/v1, just append patterns if not present
+		if !strings.HasSuffix(u.Path, "patterns") {
+			u.Path = fmt.Sprintf("%s/patterns", u.Path)
+		}
+	}
+
+	// Add query parameters
+	q := u.Query()
+	q.Set("query", query)
+	q.Set("start", fmt.Sprintf("%d", start))
+	q.Set("end", fmt.Sprintf("%d", end))
+	if step > 0 {
+		q.Set("step", strconv.FormatFloat(step.Seconds(), 'f', -1, 64))
+	}
+	u.RawQuery = q.Encode()
+
+	return u.String(), nil
+}
+
+// executeLokiPatternsQuery sends the HTTP request to Loki patterns endpoint. Loki versions before
+// 3.0, and those without pattern detection enabled, answer 404, which is reported as such.
+func executeLokiPatternsQuery(ctx context.Context, queryURL string, username, password, token, orgID string) (*LokiPatternsResult, error) {
+	body, err := doLokiRequest(ctx, queryURL, username, password, token, orgID)
+	if err != nil {
+		var httpErr *LokiHTTPError
+		if errors.As(err, &httpErr) && httpErr.StatusCode == http.StatusNotFound {
+			return nil, fmt.Errorf("endpoint not supported: this Loki server has no /loki/api/v1/patterns endpoint (requires Loki >= %s with pattern detection enabled), use loki_query with format signatures instead", lokiPatternsVersion)
+		}
+		return nil, err
+	}
+
+	// Parse JSON response
+	var result LokiPatternsResult
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, err
+	}
+
+	// Check for Loki errors
+	if result.Status == "error" {
+		return nil, fmt.Errorf("loki error: %s", result.Error)
+	}
+
+	return &result, nil
+}
+
+// lokiPatternTotal returns the number of lines matching a pattern over the whole range
+func lokiPatternTotal(pattern LokiPattern) int64 {
+	var total float64
+	for _, sample := range pattern.Samples {
+		total += sample[1]
+	}
+	return int64(total)
+}
+
+// formatLokiPatternsResults formats Loki patterns results into a readable string, most frequent
+// patterns first
+func formatLokiPatternsResults(result *LokiPatternsResult, format string) (string, error) {
+	if len(result.Data) == 0 {
+		switch format {
+		case "json":
+			return "{\"message\": \"No patterns detected\"}", nil
+		default:
+			return "No patterns detected", nil
+		}
+	}
+
+	patterns := make([]LokiPattern, len(result.Data))
+	copy(patterns, result.Data)
+	sort.SliceStable(patterns, func(i, j int) bool {
+		return lokiPatternTotal(patterns[i]) > lokiPatternTotal(patterns[j])
+	})
+
+	switch format {
+	case "json":
+		// Return raw JSON response
+		jsonBytes, err := json.MarshalIndent(result, "", "  ")
+		if err != nil {
+			return "", fmt.Errorf("failed to marshal JSON: %v", err)
+		}
+		return string(jsonBytes), nil
+
+	case "raw":
+		// Return one pattern per line, preceded by its total count and a tab
+		var b strings.Builder
+		for _, pattern := range patterns {
+			fmt.Fprintf(&b, "%d\t%s\n", lokiPatternTotal(pattern), pattern.Pattern)
+		}
+		return b.String(), nil
+
+	case "text":
+		// Return numbered patterns with their total and the count per step
+		var b strings.Builder
+		fmt.Fprintf(&b, "Found %d patterns:\n\n", len(patterns))
+		for i, pattern := range patterns {
+			fmt.Fprintf(&b, "%d. %s\n", i+1, pattern.Pattern)
+			if pattern.Level != "" {
+				fmt.Fprintf(&b, "   level: %s\n", pattern.Level)
+			}
+			fmt.Fprintf(&b, "   total: %d\n", lokiPatternTotal(pattern))
+			for _, sample := range pattern.Samples {
+				fmt.Fprintf(&b, "   [%s] %d\n", time.Unix(int64(sample[0]), 0).UTC().Format(time.RFC3339), int64(sample[1]))
+			}
+			b.WriteString("\n")
+		}
+		return b.String(), nil
+
+	default:
+		return "", fmt.Errorf("unsupported format: %s. Supported formats: raw, json, text", format)
+	}
+}
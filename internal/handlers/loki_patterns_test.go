@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ThinkInAIXYZ/go-mcp/protocol"
+)
+
+// TestBuildLokiPatternsURL verifies the path, and that the step is sent only when given
+func TestBuildLokiPatternsURL(t *testing.T) {
+	got, err := buildLokiPatternsURL("http://localhost:3100", `{job="a"}`, 1705312245, 1705315845, 5*time.Minute)
+	if err != nil {
+		t.Fatalf("buildLokiPatternsURL failed: %v", err)
+	}
+	u, _ := url.Parse(got)
+	if u.Path != "/loki/api/v1/patterns" {
+		t.Errorf("Expected patterns path, got %q", u.Path)
+	}
+	if q := u.Query(); q.Get("query") != `{job="a"}` || q.Get("start") != "1705312245" || q.Get("end") != "1705315845" || q.Get("step") != "300" {
+		t.Errorf("Unexpected parameters: %s", u.RawQuery)
+	}
+
+	got, err = buildLokiPatternsURL("http://localhost:3100/loki/api/v1", `{job="a"}`, 1, 2, 0)
+	if err != nil {
+		t.Fatalf("buildLokiPatternsURL failed: %v", err)
+	}
+	u, _ = url.Parse(got)
+	if u.Path != "/loki/api/v1/patterns" || u.Query().Has("step") {
+		t.Errorf("Unexpected URL without step: %s", got)
+	}
+}
+
+// TestFormatLokiPatternsResults verifies that patterns are ordered by count and shown over time
+func TestFormatLokiPatternsResults(t *testing.T) {
+	var result LokiPatternsResult
+	if err := json.Unmarshal([]byte(`{"status":"success","data":[
+		{"pattern":"GET <_> 200","samples":[[1705312800,2],[1705312860,1]]},
+		{"pattern":"disk <_> full","level":"error","samples":[[1705312800,7]]}]}`), &result); err != nil {
+		t.Fatalf("Failed to parse result: %v", err)
+	}
+
+	raw, err := formatLokiPatternsResults(&result, "raw")
+	if err != nil || raw != "7\tdisk <_> full\n3\tGET <_> 200\n" {
+		t.Errorf("Unexpected raw output %q (%v)", raw, err)
+	}
+
+	text, err := formatLokiPatternsResults(&result, "text")
+	for _, want := range []string{"Found 2 patterns", "1. disk <_> full\n   level: error\n   total: 7", "[2024-01-15T10:01:00Z] 1"} {
+		if err != nil || !strings.Contains(text, want) {
+			t.Errorf("Expected %q in text output %q (%v)", want, text, err)
+		}
+	}
+
+	empty, err := formatLokiPatternsResults(&LokiPatternsResult{}, "text")
+	if err != nil || empty != "No patterns detected" {
+		t.Errorf("Unexpected empty output %q (%v)", empty, err)
+	}
+}
+
+// TestHandleLokiPatternsProtocol verifies the results and the error for Loki without the endpoint
+func TestHandleLokiPatternsProtocol(t *testing.T) {
+	supported := true
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !supported {
+			http.Error(w, "404 page not found", http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(`{"status":"success","data":[{"pattern":"user <_> logged in","samples":[[1705312800,4]]}]}`))
+	}))
+	defer server.Close()
+
+	if _, err := NewLokiPatternsToolProtocol(); err != nil {
+		t.Fatalf("Failed to create tool: %v", err)
+	}
+	raw, _ := json.Marshal(map[string]any{"query": `{job="a"}`, "url": server.URL})
+	request := &protocol.CallToolRequest{Name: "loki_patterns", RawArguments: raw}
+
+	result, err := HandleLokiPatternsProtocol(context.Background(), request)
+	if err != nil {
+		t.Fatalf("HandleLokiPatternsProtocol failed: %v", err)
+	}
+	if text := result.Content[0].(*protocol.TextContent).Text; text != "4\tuser <_> logged in\n" {
+		t.Errorf("Unexpected output: %q", text)
+	}
+
+	supported = false
+	_, err = HandleLokiPatternsProtocol(context.Background(), request)
+	if err == nil || !strings.Contains(err.Error(), "endpoint not supported") {
+		t.Errorf("Expected endpoint not supported error, got %v", err)
+	}
+}
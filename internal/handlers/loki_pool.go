@@ -0,0 +1,145 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Environment variable name for the maximum number of idle connections kept open to Loki
+const EnvLokiMaxIdleConns = "LOKI_MAX_IDLE_CONNS"
+
+// Environment variable name for the maximum number of idle connections kept open per Loki host
+const EnvLokiMaxIdleConnsPerHost = "LOKI_MAX_IDLE_CONNS_PER_HOST"
+
+// Environment variable name for how long an idle connection to Loki is kept open
+const EnvLokiIdleConnTimeout = "LOKI_IDLE_CONN_TIMEOUT"
+
+// Default maximum number of idle connections kept open to Loki
+const DefaultLokiMaxIdleConns = 100
+
+// Default maximum number of idle connections kept open per Loki host. Go's default of 2 would
+// make concurrent tool calls open and close connections to the same Loki constantly.
+const DefaultLokiMaxIdleConnsPerHost = 20
+
+// Default time an idle connection to Loki is kept open
+const DefaultLokiIdleConnTimeout = 90 * time.Second
+
+// lokiPoolSettings holds the connection pool options read from the environment
+type lokiPoolSettings struct {
+	MaxIdleConns        int
+	MaxIdleConnsPerHost int
+	IdleConnTimeout     time.Duration
+}
+
+// lokiClientSettings identifies a configured client; clients are shared by all calls with the same settings
+type lokiClientSettings struct {
+	TLS   lokiTLSSettings
+	Pool  lokiPoolSettings
+	Proxy lokiProxySettings
+}
+
+// Clients built for each distinct configuration, so certificates are read once and
+// keep-alive connections are reused across tool calls
+var (
+	lokiClientsMu sync.Mutex
+	lokiClients   = map[lokiClientSettings]*http.Client{}
+)
+
+// loadLokiPoolSettings reads the connection pool options from the environment
+func loadLokiPoolSettings() (lokiPoolSettings, error) {
+	settings := lokiPoolSettings{
+		MaxIdleConns:        DefaultLokiMaxIdleConns,
+		MaxIdleConnsPerHost: DefaultLokiMaxIdleConnsPerHost,
+		IdleConnTimeout:     DefaultLokiIdleConnTimeout,
+	}
+
+	for _, option := range []struct {
+		env   string
+		value *int
+	}{
+		{EnvLokiMaxIdleConns, &settings.MaxIdleConns},
+		{EnvLokiMaxIdleConnsPerHost, &settings.MaxIdleConnsPerHost},
+	} {
+		raw := os.Getenv(option.env)
+		if raw == "" {
+			continue
+		}
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 {
+			return lokiPoolSettings{}, fmt.Errorf("invalid %s: %q must be a positive integer", option.env, raw)
+		}
+		*option.value = n
+	}
+
+	if raw := os.Getenv(EnvLokiIdleConnTimeout); raw != "" {
+		timeout, err := parsePositiveDuration(EnvLokiIdleConnTimeout, raw)
+		if err != nil {
+			return lokiPoolSettings{}, err
+		}
+		settings.IdleConnTimeout = timeout
+	}
+
+	return settings, nil
+}
+
+// lokiHTTPClient returns the HTTP client for Loki requests, configured with the TLS, connection
+// pool and proxy options from the environment. The client is built on first use and then shared; http.Client
+// and its transport are safe for concurrent use by simultaneous tool calls.
+func lokiHTTPClient() (*http.Client, error) {
+	tlsSettings, err := loadLokiTLSSettings()
+	if err != nil {
+		return nil, err
+	}
+	poolSettings, err := loadLokiPoolSettings()
+	if err != nil {
+		return nil, err
+	}
+	proxySettings, err := loadLokiProxySettings()
+	if err != nil {
+		return nil, err
+	}
+	settings := lokiClientSettings{TLS: tlsSettings, Pool: poolSettings, Proxy: proxySettings}
+
+	lokiClientsMu.Lock()
+	defer lokiClientsMu.Unlock()
+
+	if client, ok := lokiClients[settings]; ok {
+		return client, nil
+	}
+
+	tlsConfig, err := buildLokiTLSConfig(tlsSettings)
+	if err != nil {
+		return nil, err
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	transport.MaxIdleConns = poolSettings.MaxIdleConns
+	transport.MaxIdleConnsPerHost = poolSettings.MaxIdleConnsPerHost
+	transport.IdleConnTimeout = poolSettings.IdleConnTimeout
+	transport.Proxy = proxySettings.proxyFunc()
+
+	client := &http.Client{Transport: transport}
+	lokiClients[settings] = client
+	return client, nil
+}
+
+// lokiTransport returns the transport of the shared Loki client, for connections such as the
+// tail WebSocket that are not made through the client
+func lokiTransport() (*http.Transport, error) {
+	client, err := lokiHTTPClient()
+	if err != nil {
+		return nil, err
+	}
+	return client.Transport.(*http.Transport), nil
+}
+
+// CheckLokiPool validates the connection pool options so that mistakes are reported at startup
+func CheckLokiPool() error {
+	_, err := loadLokiPoolSettings()
+	return err
+}
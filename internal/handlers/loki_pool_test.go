@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestLoadLokiPoolSettings verifies defaults, overrides and rejection of invalid values
+func TestLoadLokiPoolSettings(t *testing.T) {
+	testCases := []struct {
+		name        string
+		maxIdle     string
+		maxIdleHost string
+		idleTimeout string
+		want        lokiPoolSettings
+		wantErr     bool
+	}{
+		{name: "Defaults", want: lokiPoolSettings{MaxIdleConns: 100, MaxIdleConnsPerHost: 20, IdleConnTimeout: 90 * time.Second}},
+		{name: "Overrides", maxIdle: "50", maxIdleHost: "50", idleTimeout: "2m", want: lokiPoolSettings{MaxIdleConns: 50, MaxIdleConnsPerHost: 50, IdleConnTimeout: 2 * time.Minute}},
+		{name: "Timeout in seconds", idleTimeout: "30", want: lokiPoolSettings{MaxIdleConns: 100, MaxIdleConnsPerHost: 20, IdleConnTimeout: 30 * time.Second}},
+		{name: "Zero connections", maxIdle: "0", wantErr: true},
+		{name: "Not a number", maxIdleHost: "many", wantErr: true},
+		{name: "Bad timeout", idleTimeout: "forever", wantErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv(EnvLokiMaxIdleConns, tc.maxIdle)
+			t.Setenv(EnvLokiMaxIdleConnsPerHost, tc.maxIdleHost)
+			t.Setenv(EnvLokiIdleConnTimeout, tc.idleTimeout)
+
+			got, err := loadLokiPoolSettings()
+			if tc.wantErr {
+				if err == nil {
+					t.Fatal("Expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("loadLokiPoolSettings failed: %v", err)
+			}
+			if got != tc.want {
+				t.Errorf("Expected %+v, got %+v", tc.want, got)
+			}
+		})
+	}
+}
+
+// TestLokiHTTPClient_Shared verifies that the client is reused until its configuration changes
+func TestLokiHTTPClient_Shared(t *testing.T) {
+	for _, env := range []string{EnvLokiCACert, EnvLokiTLSInsecure, EnvLokiClientCert, EnvLokiClientKey, EnvLokiMaxIdleConns, EnvLokiMaxIdleConnsPerHost, EnvLokiIdleConnTimeout} {
+		t.Setenv(env, "")
+	}
+
+	first, err := lokiHTTPClient()
+	if err != nil {
+		t.Fatalf("lokiHTTPClient failed: %v", err)
+	}
+	second, err := lokiHTTPClient()
+	if err != nil {
+		t.Fatalf("lokiHTTPClient failed: %v", err)
+	}
+	if first != second {
+		t.Error("Expected the same client for the same configuration")
+	}
+
+	t.Setenv(EnvLokiMaxIdleConnsPerHost, "7")
+	third, err := lokiHTTPClient()
+	if err != nil {
+		t.Fatalf("lokiHTTPClient failed: %v", err)
+	}
+	if third == first {
+		t.Error("Expected a new client after the configuration changed")
+	}
+	if got := third.Transport.(*http.Transport).MaxIdleConnsPerHost; got != 7 {
+		t.Errorf("Expected MaxIdleConnsPerHost 7, got %d", got)
+	}
+}
+
+// TestDoLokiRequest_ReusesConnections verifies that concurrent calls share keep-alive connections
+func TestDoLokiRequest_ReusesConnections(t *testing.T) {
+	var mu sync.Mutex
+	connections := 0
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"status":"success","data":[]}`))
+	}))
+	server.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			mu.Lock()
+			connections++
+			mu.Unlock()
+		}
+	}
+	server.Start()
+	defer server.Close()
+
+	for _, env := range []string{EnvLokiCACert, EnvLokiTLSInsecure, EnvLokiClientCert, EnvLokiClientKey, EnvLokiMaxIdleConns, EnvLokiMaxIdleConnsPerHost, EnvLokiIdleConnTimeout} {
+		t.Setenv(env, "")
+	}
+
+	const workers, rounds = 5, 10
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < rounds; i++ {
+				if _, err := doLokiRequest(context.Background(), server.URL+"/loki/api/v1/labels", "", "", "", ""); err != nil {
+					t.Errorf("doLokiRequest failed: %v", err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	mu.Lock()
+	defer mu.Unlock()
+	// Without keep-alive every request would dial; a few extra dials can race with idle returns
+	if connections > 2*workers {
+		t.Errorf("Expected connections to be reused across %d requests, got %d connections", workers*rounds, connections)
+	}
+}
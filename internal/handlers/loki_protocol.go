@@ -11,41 +11,86 @@ import (
 
 // LokiQueryRequest represents the arguments for loki_query tool
 type LokiQueryRequest struct {
-	Query    string  `json:"query" description:"LogQL query string"`
-	URL      string  `json:"url,omitempty" description:"Loki server URL"`
-	Username string  `json:"username,omitempty" description:"Username for basic authentication"`
-	Password string  `json:"password,omitempty" description:"Password for basic authentication"`
-	Token    string  `json:"token,omitempty" description:"Bearer token for authentication"`
-	Start    string  `json:"start,omitempty" description:"Start time for the query"`
-	End      string  `json:"end,omitempty" description:"End time for the query"`
-	Limit    float64 `json:"limit,omitempty" description:"Maximum number of entries to return"`
-	Org      string  `json:"org,omitempty" description:"Organization ID for the query"`
-	Format   string  `json:"format,omitempty" description:"Output format: raw, json, or text"`
+	Query           string            `json:"query" description:"LogQL query string"`
+	URL             string            `json:"url,omitempty" description:"Loki server URL"`
+	Backend         string            `json:"backend,omitempty" description:"Name of a Loki backend from LOKI_BACKENDS, e.g. prod, whose URL and credentials to use; cannot be combined with url, and an explicit credential still wins"`
+	Username        string            `json:"username,omitempty" description:"Username for basic authentication"`
+	Password        string            `json:"password,omitempty" description:"Password for basic authentication"`
+	Token           string            `json:"token,omitempty" description:"Bearer token for authentication"`
+	Start           string            `json:"start,omitempty" description:"Start time for the query"`
+	End             string            `json:"end,omitempty" description:"End time for the query"`
+	Timezone        string            `json:"timezone,omitempty" description:"IANA timezone for start and end times without a zone, e.g. America/New_York (default: LOKI_TIMEZONE or UTC)"`
+	AllowLargeRange bool              `json:"allowLargeRange,omitempty" description:"Query a time range longer than LOKI_MAX_TIME_RANGE anyway; long ranges are expensive for Loki, so only set this when a narrower range will not do (default: false)"`
+	Limit           float64           `json:"limit,omitempty" description:"Maximum number of entries to return (default: LOKI_DEFAULT_LIMIT or 100, capped at LOKI_MAX_LIMIT or 5000)"`
+	NoLimit         bool              `json:"noLimit,omitempty" description:"Fetch every entry in the range instead of stopping at limit, paging through Loki in pages of LOKI_MAX_LIMIT; stops with an error once the lines exceed LOKI_MAX_RESPONSE_BYTES. Needs an end time in the past, not now, and cannot be combined with limit, cursor, sinceToken or autoWiden (default: false)"`
+	Interval        string            `json:"interval,omitempty" description:"Return only entries at least this far apart, as a duration (e.g. 30s, 5m) or seconds, to sample high-volume logs without fetching every line; limit still caps the entries returned, so they span up to limit times interval. Log queries only; for metric queries use step with loki_query_range (default: every entry)"`
+	Direction       string            `json:"direction,omitempty" description:"Which entries to return when the limit is hit: backward (newest first) or forward (oldest first) (default: backward)"`
+	Org             string            `json:"org,omitempty" description:"Organization ID for the query; separate several with commas to query tenants together"`
+	Headers         map[string]string `json:"headers,omitempty" description:"Extra HTTP headers to send to Loki, e.g. {\"X-Api-Key\": \"...\"}; never replaces the auth or org headers"`
+	Timeout         string            `json:"timeout,omitempty" description:"Timeout for the Loki request as a duration (e.g. 45s) or seconds (default: LOKI_QUERY_TIMEOUT or 30s)"`
+	Format          string            `json:"format,omitempty" description:"Output format: raw, json, text, signatures (lines grouped by normalized signature), push (Loki push API body for replay), logfmt (logfmt lines as aligned key/value tables), color (text with ANSI colors by log level, for terminals only), or markdown (a Time | Labels | Line table for chat interfaces that render Markdown)"`
+	Cursor          string            `json:"cursor,omitempty" description:"Continuation token from the metadata of a previous call with the same query and range, to fetch the next page"`
+	Fields          []string          `json:"fields,omitempty" description:"JSON keys to project from each line, e.g. [\"msg\", \"trace_id\"]; dotted names such as http.status reach nested objects. Results are shown as a table with a column per field; cannot be combined with format"`
+	NonJSON         string            `json:"nonJson,omitempty" description:"With fields, what to do with lines that are not JSON objects: skip (default), pass (show them unchanged), or flag (show them with a [not JSON] marker)"`
+	Summarize       bool              `json:"summarize,omitempty" description:"Return line counts per level or label plus the oldest and newest lines instead of every line, for an overview of large results; cannot be combined with format or fields"`
+	SummarizeBy     string            `json:"summarizeBy,omitempty" description:"With summarize, the stream label to count lines by, or level to count by the level detected in each line (default: level)"`
+	SummaryLines    float64           `json:"summaryLines,omitempty" description:"With summarize, how many of the oldest and of the newest lines to include, up to 100 (default: 5)"`
+	Dedup           bool              `json:"dedup,omitempty" description:"Collapse consecutive identical lines of a stream into the first one, annotated with the repeat count and the time of the last repeat, e.g. (x42, last at 2024-01-15T10:00:05Z); raw, text, color and markdown formats only (default: false)"`
+	Sort            string            `json:"sort,omitempty" description:"Order of the displayed lines across streams: time_desc (newest first), time_asc (oldest first), or none (grouped by stream as Loki returns them); raw, text, color and markdown formats only (default: time_desc, or none for other outputs)"`
+	ShowDeltas      bool              `json:"showDeltas,omitempty" description:"Start each line with the time since the entry before it, e.g. +00:00:01.234, for a timeline of gaps between lines; text format only, with lines sorted by time (default: false)"`
+	GroupByStream   bool              `json:"groupByStream,omitempty" description:"Show the entries grouped under their stream, each stream headed by its labels and entry count, instead of one interleaved list; text and json formats only. Many small streams make long output, so prefer the flat list or outputLabels when the query matches hundreds of streams (default: false)"`
+	OutputLabels    []string          `json:"outputLabels,omitempty" description:"Label keys to show in the stream identifier of each entry, e.g. [\"pod\", \"container\"]; the other labels are dropped and labels a stream lacks are omitted. raw, text, logfmt, color and markdown formats only (default: all labels)"`
+	NoCache         bool              `json:"noCache,omitempty" description:"Fetch the result from Loki even when LOKI_QUERY_CACHE_TTL is set and an identical query over the same past range was cached (default: false)"`
+	SinceToken      string            `json:"sinceToken,omitempty" description:"sinceToken from the metadata of a previous call, to fetch only the entries newer than those it returned, up to now and oldest first; for watching for new lines in a loop. Cannot be combined with start, end or cursor"`
+	LineRegex       string            `json:"lineRegex,omitempty" description:"Go regular expression that lines must match to be returned, applied by this server after Loki has returned up to limit entries, so fewer lines than limit may come back and more matches may exist on later pages; prefer LogQL line filters such as |~ where possible"`
+	Invert          bool              `json:"invert,omitempty" description:"With lineRegex, return the lines it does not match instead (default: false)"`
+	Redact          []string          `json:"redact,omitempty" description:"Patterns to mask with *** in the returned lines: names of built-in patterns (email, token, credit_card, ipv4, plus any from LOKI_REDACT_PATTERNS) or custom Go regular expressions, e.g. [\"email\", \"user-[0-9]+\"]; the patterns of LOKI_REDACT always apply"`
+	AutoWiden       bool              `json:"autoWiden,omitempty" description:"When nothing matches, retry over the last 1h, 6h, 24h and 7d up to the end time until something does; a note names the range the results come from. Cannot be combined with cursor or sinceToken (default: false)"`
+	Explain         bool              `json:"explain,omitempty" description:"Describe what the query would do instead of running it: its stream selector, line and label filters, pipeline stages, absolute time range and effective limit; nothing is sent to Loki (default: false)"`
+	CountOnly       bool              `json:"countOnly,omitempty" description:"Return only the number of entries matching the query in the time range, counted by Loki with count_over_time, instead of the lines; cheaper than fetching them. The query must be a stream selector with an optional log pipeline, e.g. {app=\"api\"} |= \"error\" (default: false)"`
+	JoinMultiline   bool              `json:"joinMultiline,omitempty" description:"Merge continuation lines, such as the frames of a stack trace, into the entry before them in the same stream, so that each exception reads as one entry. By default a line continues the entry before it when it is indented, or when it lacks the timestamp or level prefix the entry starts with (default: false)"`
+	MultilineRegex  string            `json:"multilineRegex,omitempty" description:"With joinMultiline, a Go regular expression matching continuation lines, used instead of the default heuristic, e.g. ^(\\s|Caused by:)"`
+	Context         float64           `json:"context,omitempty" description:"Like grep -C, also show up to this many lines before and after each match from the same stream, marked [context]; fetched with two extra queries per match for the first 10 matches, which drop the line and label filters and look 10 minutes either way. raw, text, color and markdown formats only, up to 20 (default: 0)"`
 }
 
 // LokiLabelNamesRequest represents the arguments for loki_label_names tool
 type LokiLabelNamesRequest struct {
-	URL      string `json:"url,omitempty" description:"Loki server URL"`
-	Username string `json:"username,omitempty" description:"Username for basic authentication"`
-	Password string `json:"password,omitempty" description:"Password for basic authentication"`
-	Token    string `json:"token,omitempty" description:"Bearer token for authentication"`
-	Start    string `json:"start,omitempty" description:"Start time for the query"`
-	End      string `json:"end,omitempty" description:"End time for the query"`
-	Org      string `json:"org,omitempty" description:"Organization ID for the query"`
-	Format   string `json:"format,omitempty" description:"Output format: raw, json, or text"`
+	Query           string            `json:"query,omitempty" description:"Stream selector limiting the names to labels of matching streams, e.g. {app=\"checkout\"}; Loki versions without support for it return the labels of all streams (default: all streams)"`
+	URL             string            `json:"url,omitempty" description:"Loki server URL"`
+	Backend         string            `json:"backend,omitempty" description:"Name of a Loki backend from LOKI_BACKENDS, e.g. prod, whose URL and credentials to use; cannot be combined with url, and an explicit credential still wins"`
+	Username        string            `json:"username,omitempty" description:"Username for basic authentication"`
+	Password        string            `json:"password,omitempty" description:"Password for basic authentication"`
+	Token           string            `json:"token,omitempty" description:"Bearer token for authentication"`
+	Start           string            `json:"start,omitempty" description:"Start time for the query"`
+	End             string            `json:"end,omitempty" description:"End time for the query"`
+	Timezone        string            `json:"timezone,omitempty" description:"IANA timezone for start and end times without a zone, e.g. America/New_York (default: LOKI_TIMEZONE or UTC)"`
+	AllowLargeRange bool              `json:"allowLargeRange,omitempty" description:"Query a time range longer than LOKI_MAX_TIME_RANGE anyway; long ranges are expensive for Loki, so only set this when a narrower range will not do (default: false)"`
+	Org             string            `json:"org,omitempty" description:"Organization ID for the query; separate several with commas to query tenants together"`
+	Headers         map[string]string `json:"headers,omitempty" description:"Extra HTTP headers to send to Loki, e.g. {\"X-Api-Key\": \"...\"}; never replaces the auth or org headers"`
+	Timeout         string            `json:"timeout,omitempty" description:"Timeout for the Loki request as a duration (e.g. 45s) or seconds (default: LOKI_QUERY_TIMEOUT or 30s)"`
+	Format          string            `json:"format,omitempty" description:"Output format: raw, json, or text"`
 }
 
 // LokiLabelValuesRequest represents the arguments for loki_label_values tool
 type LokiLabelValuesRequest struct {
-	Label    string `json:"label" description:"Label name to get values for"`
-	URL      string `json:"url,omitempty" description:"Loki server URL"`
-	Username string `json:"username,omitempty" description:"Username for basic authentication"`
-	Password string `json:"password,omitempty" description:"Password for basic authentication"`
-	Token    string `json:"token,omitempty" description:"Bearer token for authentication"`
-	Start    string `json:"start,omitempty" description:"Start time for the query"`
-	End      string `json:"end,omitempty" description:"End time for the query"`
-	Org      string `json:"org,omitempty" description:"Organization ID for the query"`
-	Format   string `json:"format,omitempty" description:"Output format: raw, json, or text"`
+	Label           string            `json:"label" description:"Label name to get values for"`
+	Query           string            `json:"query,omitempty" description:"Stream selector limiting the values to those of matching streams, e.g. {namespace=\"foo\"} to list the pods of namespace foo (default: all streams)"`
+	URL             string            `json:"url,omitempty" description:"Loki server URL"`
+	Backend         string            `json:"backend,omitempty" description:"Name of a Loki backend from LOKI_BACKENDS, e.g. prod, whose URL and credentials to use; cannot be combined with url, and an explicit credential still wins"`
+	Username        string            `json:"username,omitempty" description:"Username for basic authentication"`
+	Password        string            `json:"password,omitempty" description:"Password for basic authentication"`
+	Token           string            `json:"token,omitempty" description:"Bearer token for authentication"`
+	Start           string            `json:"start,omitempty" description:"Start time for the query"`
+	End             string            `json:"end,omitempty" description:"End time for the query"`
+	Timezone        string            `json:"timezone,omitempty" description:"IANA timezone for start and end times without a zone, e.g. America/New_York (default: LOKI_TIMEZONE or UTC)"`
+	AllowLargeRange bool              `json:"allowLargeRange,omitempty" description:"Query a time range longer than LOKI_MAX_TIME_RANGE anyway; long ranges are expensive for Loki, so only set this when a narrower range will not do (default: false)"`
+	Org             string            `json:"org,omitempty" description:"Organization ID for the query; separate several with commas to query tenants together"`
+	Headers         map[string]string `json:"headers,omitempty" description:"Extra HTTP headers to send to Loki, e.g. {\"X-Api-Key\": \"...\"}; never replaces the auth or org headers"`
+	Timeout         string            `json:"timeout,omitempty" description:"Timeout for the Loki request as a duration (e.g. 45s) or seconds (default: LOKI_QUERY_TIMEOUT or 30s)"`
+	Format          string            `json:"format,omitempty" description:"Output format: raw, json, or text"`
+	Match           string            `json:"match,omitempty" description:"Regular expression the values must match in full, like LogQL =~, e.g. api-.*"`
+	Prefix          string            `json:"prefix,omitempty" description:"Prefix the values must start with, e.g. checkout- for autocompletion"`
+	Limit           float64           `json:"limit,omitempty" description:"Maximum number of values to return, in sorted order; the result says when values were cut off (default: no limit)"`
 }
 
 // NewLokiQueryToolProtocol creates a tool using the protocol library
@@ -70,63 +115,351 @@ func HandleLokiQueryProtocol(ctx context.Context, request *protocol.CallToolRequ
 		return nil, err
 	}
 
-	lokiURL := getEnvOrDefault(req.URL, EnvLokiURL, DefaultLokiURL)
-	username := getEnvOrDefault(req.Username, EnvLokiUsername, "")
-	password := getEnvOrDefault(req.Password, EnvLokiPassword, "")
-	token := getEnvOrDefault(req.Token, EnvLokiToken, "")
-	orgID := getEnvOrDefault(req.Org, EnvLokiOrgID, "")
+	if err := validateLogQL(req.Query); err != nil {
+		return nil, err
+	}
 
-	start := time.Now().Add(-1 * time.Hour).Unix()
-	end := time.Now().Unix()
-	limit := 100
+	ctx, conn, err := resolveLokiCall(ctx, req.Backend, req.URL, req.Username, req.Password, req.Token, req.Org, req.Timeout, req.Headers)
+	if err != nil {
+		return nil, err
+	}
+	lokiURL, username, password, token, orgID := conn.URL, conn.Username, conn.Password, conn.Token, conn.OrgID
 
-	if req.Start != "" {
-		startTime, err := parseTime(req.Start)
-		if err != nil {
-			return nil, fmt.Errorf("invalid start time: %v", err)
+	// Nanosecond precision lets cursors resume exactly at the last returned entry. The range is
+	// checked against LOKI_MAX_TIME_RANGE once the cursor or sinceToken has been applied.
+	start, end, err := parseLokiRange(req.Start, req.End, req.Timezone)
+	if err != nil {
+		return nil, err
+	}
+
+	limit, limitNote, err := resolveLokiLimit(req.Limit)
+	if err != nil {
+		return nil, err
+	}
+
+	direction, err := parseDirection(req.Direction)
+	if err != nil {
+		return nil, err
+	}
+
+	var cursor lokiCursor
+	if req.Cursor != "" {
+		if cursor, start, end, err = applyLokiCursor(req.Cursor, direction, start, end); err != nil {
+			return nil, err
 		}
-		start = startTime.Unix()
+		direction = cursor.direction
 	}
 
-	if req.End != "" {
-		endTime, err := parseTime(req.End)
-		if err != nil {
-			return nil, fmt.Errorf("invalid end time: %v", err)
+	// Continue from the last entry of a previous call; end is still now since no end was given
+	if req.SinceToken != "" {
+		if start, end, direction, err = applyLokiSinceToken(req.SinceToken, req.Start, req.End, req.Cursor, direction, end); err != nil {
+			return nil, err
 		}
-		end = endTime.Unix()
 	}
 
-	if req.Limit > 0 {
-		limit = int(req.Limit)
+	if err := checkLokiAutoWiden(req.AutoWiden, req.Cursor, req.SinceToken); err != nil {
+		return nil, err
+	}
+
+	if err := checkLokiNoLimit(req, end, time.Now()); err != nil {
+		return nil, err
 	}
 
-	format := "raw"
-	if req.Format != "" {
-		format = req.Format
+	// Page through the whole range with the largest limit allowed, within the response size guard
+	var maxBytes int64
+	if req.NoLimit {
+		if limit, err = lokiLimitFromEnv(EnvLokiMaxLimit, DefaultLokiMaxLimit); err != nil {
+			return nil, err
+		}
+		if maxBytes, err = lokiMaxResponseBytes(); err != nil {
+			return nil, err
+		}
+		limitNote = fmt.Sprintf("noLimit: every entry in the range is fetched in pages of %d", limit)
 	}
 
-	queryURL, err := buildLokiQueryURL(lokiURL, req.Query, start, end, limit)
+	// Refuse ranges longer than LOKI_MAX_TIME_RANGE before scanning them
+	if err := checkLokiTimeRange(time.Unix(0, start), time.Unix(0, end), req.AllowLargeRange); err != nil {
+		return nil, err
+	}
+
+	nonJSON, err := resolveLokiFields(req.Fields, req.NonJSON, req.Format)
 	if err != nil {
-		return nil, fmt.Errorf("failed to build query URL: %v", err)
+		return nil, err
 	}
 
-	result, err := executeLokiQuery(ctx, queryURL, username, password, token, orgID)
+	summarizeBy, summaryLines, err := resolveLokiSummary(req.Summarize, req.SummarizeBy, req.SummaryLines, req.Format, req.Fields)
 	if err != nil {
-		return nil, fmt.Errorf("query execution failed: %v", err)
+		return nil, err
 	}
 
-	formattedResult, err := formatLokiResults(result, format)
+	format := resolveLokiFormat(req.Format, lokiQueryFormats)
+
+	// Let Loki count the matching entries instead of fetching and discarding them
+	if req.CountOnly {
+		countFormat := resolveLokiFormat(req.Format, lokiCountFormats)
+		if err := checkLokiCountOnly(req, countFormat); err != nil {
+			return nil, err
+		}
+		return handleLokiCountOnly(ctx, req, conn, start, end, countFormat)
+	}
+
+	if err := checkLokiDedup(req.Dedup, format, req.Fields, req.Summarize); err != nil {
+		return nil, err
+	}
+
+	order, err := resolveLokiSort(req.Sort, format, req.Fields, req.Summarize)
 	if err != nil {
+		return nil, err
+	}
+
+	if err := checkLokiOutputLabels(req.OutputLabels, format, req.Fields, req.Summarize); err != nil {
+		return nil, err
+	}
+
+	if err := checkLokiDeltas(req.ShowDeltas, format, order, req.Fields, req.Summarize); err != nil {
+		return nil, err
+	}
+
+	if err := checkLokiGroupByStream(req.GroupByStream, req.ShowDeltas, format, req.Fields, req.Summarize); err != nil {
+		return nil, err
+	}
+
+	contextLines, err := resolveLokiContext(req.Context, format, req.Fields, req.Summarize, req.GroupByStream)
+	if err != nil {
+		return nil, err
+	}
+
+	interval, err := resolveLokiInterval(req.Interval)
+	if err != nil {
+		return nil, err
+	}
+
+	multiline, err := resolveLokiMultiline(req.JoinMultiline, req.MultilineRegex)
+	if err != nil {
+		return nil, err
+	}
+
+	lineRegex, err := compileLokiLineRegex(req.LineRegex, req.Invert)
+	if err != nil {
+		return nil, err
+	}
+
+	redact, err := compileLokiRedact(req.Redact)
+	if err != nil {
+		return nil, err
+	}
+
+	// Describe the query with its resolved range and limit instead of running it
+	if req.Explain {
+		return &protocol.CallToolResult{
+			Content: []protocol.Content{
+				&protocol.TextContent{
+					Type: "text",
+					Text: formatLokiExplain(req.Query, start, end, limit, limitNote, direction),
+				},
+			},
+		}, nil
+	}
+
+	// Results of ranges fully in the past do not change, so identical calls may share them
+	cacheTTL, cacheSize, err := resolveLokiQueryCache()
+	useCache := err == nil && cacheTTL > 0 && !req.NoCache && !req.NoLimit && lokiQueryCacheable(req.Start, req.End, end, time.Now())
+	pages := 0
+	fetch := func(start int64) (*LokiResult, bool, error) {
+		if req.NoLimit {
+			result, n, err := fetchAllLokiPages(start, end, limit, direction, maxBytes, func(start, end int64) (*LokiResult, error) {
+				queryURL, err := buildLokiIntervalQueryURL(lokiURL, req.Query, start, end, limit, direction, interval)
+				if err != nil {
+					return nil, fmt.Errorf("failed to build query URL: %v", err)
+				}
+				return executeLokiQuery(ctx, queryURL, username, password, token, orgID)
+			})
+			pages = n
+			if err != nil {
+				return nil, false, fmt.Errorf("query execution failed: %v", err)
+			}
+			return result, false, nil
+		}
+		queryURL, err := buildLokiIntervalQueryURL(lokiURL, req.Query, start, end, limit, direction, interval)
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to build query URL: %v", err)
+		}
+		var result *LokiResult
+		cached := false
+		if useCache {
+			result, cached, err = executeCachedLokiQuery(ctx, queryURL, cacheTTL, cacheSize, username, password, token, orgID)
+		} else {
+			result, err = executeLokiQuery(ctx, queryURL, username, password, token, orgID)
+		}
+		if err != nil {
+			return nil, false, fmt.Errorf("query execution failed: %v", err)
+		}
+		return result, cached, nil
+	}
+
+	// The last page of a cursor may leave nothing to ask Loki for
+	result := &LokiResult{Status: "success", Data: LokiData{ResultType: "streams"}}
+	cached := false
+	if req.Cursor == "" || end > start {
+		if result, cached, err = fetch(start); err != nil {
+			return nil, err
+		}
+	}
+
+	// Look further back when nothing matched, since the range was often just too narrow; the
+	// widened range stays within LOKI_MAX_TIME_RANGE unless allowLargeRange is set
+	requested := time.Duration(end - start)
+	if req.AutoWiden && countLokiEntries(result) == 0 {
+		maxRange, _ := LokiMaxTimeRange() // already validated by checkLokiTimeRange
+		if req.AllowLargeRange {
+			maxRange = 0
+		}
+		for _, lookback := range lokiAutoWidenSteps(requested, maxRange) {
+			if result, cached, err = fetch(end - lookback.Nanoseconds()); err != nil {
+				return nil, err
+			}
+			start = end - lookback.Nanoseconds()
+			if countLokiEntries(result) > 0 {
+				break
+			}
+		}
+	}
+
+	// Metric queries such as count_over_time are formatted as series, without the line options
+	if result.Metric != nil {
+		if err := checkLokiMetricQueryOptions(req); err != nil {
+			return nil, err
+		}
+	}
+
+	// Drop the entries at the cursor's timestamp that the previous page returned; the limit still
+	// counts them, since Loki did
+	page := result
+	result, skipped := skipLokiCursorEntries(result, cursor)
+
+	// lineRegex filters the entries Loki returned, so pagination and the sinceToken still follow
+	// those rather than the lines kept
+	fetched := result
+
+	// Mask sensitive data before anything else sees the lines, so that lineRegex cannot match it either
+	result, redacted := redactLokiResult(result, redact)
+
+	// Rebuild multiline entries before lineRegex, so that it can match any line of a stack trace
+	var multilineNote string
+	if multiline != nil && result.Metric == nil {
+		var merged int
+		result, merged = joinLokiMultiline(result, multiline, direction)
+		multilineNote = fmt.Sprintf("joinMultiline: %d continuation lines merged into the entries before them", merged)
+	}
+	if lineRegex != nil {
+		result = filterLokiLines(result, lineRegex, req.Invert)
+	}
+
+	// Add the lines around each match from their streams, which costs two queries per match
+	formatted := result
+	var contextNote string
+	if contextLines > 0 && result.Metric == nil {
+		fetchContext := func(query string, start, end int64, limit int, direction string) (*LokiResult, error) {
+			queryURL, err := buildLokiQueryURL(lokiURL, query, start, end, limit, direction)
+			if err != nil {
+				return nil, fmt.Errorf("failed to build query URL: %v", err)
+			}
+			return executeLokiQuery(ctx, queryURL, username, password, token, orgID)
+		}
+		var contextRedacted int
+		formatted, contextRedacted, contextNote = addLokiContext(result, req.Query, contextLines, direction, redact, fetchContext)
+		redacted += contextRedacted
+	}
+
+	// Collapse repeated lines, trim stream labels, merge streams by time and show the gaps between
+	// lines for display only; the summary below still counts every entry
+	if req.Dedup {
+		formatted = dedupLokiResult(formatted)
+	}
+	formatted = selectLokiOutputLabels(formatted, req.OutputLabels)
+	formatted = sortLokiResult(formatted, order)
+	if req.ShowDeltas {
+		formatted = annotateLokiDeltas(formatted)
+	}
+
+	var formattedResult string
+	if req.Summarize {
+		formattedResult = formatLokiSummary(result, summarizeBy, summaryLines)
+	} else if len(req.Fields) > 0 {
+		formattedResult = formatLokiFields(result, req.Fields, nonJSON)
+	} else if req.GroupByStream {
+		if formattedResult, err = formatLokiGroupedResults(formatted, format); err != nil {
+			return nil, fmt.Errorf("failed to format results: %v", err)
+		}
+	} else if formattedResult, err = formatLokiResults(formatted, format); err != nil {
 		return nil, fmt.Errorf("failed to format results: %v", err)
 	}
 
+	// Every entry was fetched, so there is no limit to hit and no next page
+	if req.NoLimit {
+		limit = 0
+		limitNote = fmt.Sprintf("noLimit: all %d entries in the range fetched in %d pages", countLokiEntries(fetched), pages)
+	}
+
+	// Follow the formatted results with a JSON summary that agents can use to decide whether to paginate
+	summary := buildLokiQueryMetadata(page, start, end, limit, direction, cursor)
+	summary.Entries -= skipped
+	summary.SinceToken = nextLokiSinceToken(fetched, end)
+
+	// Say plainly that nothing matched; json and push output keep their usual shape instead
+	kept := countLokiEntries(result)
+	if kept == 0 && (req.Summarize || len(req.Fields) > 0 || (format != "json" && format != "push")) {
+		if result.Metric != nil {
+			formattedResult = lokiEmptyResultMessage("series", req.Query, start, end)
+		} else if summary.Entries == 0 {
+			formattedResult = lokiEmptyResultMessage("log entries", req.Query, start, end)
+		} else {
+			formattedResult = fmt.Sprintf("None of the %d log entries returned by Loki matched lineRegex %q", summary.Entries, req.LineRegex)
+			if req.Invert {
+				formattedResult = fmt.Sprintf("All of the %d log entries returned by Loki matched lineRegex %q", summary.Entries, req.LineRegex)
+			}
+		}
+	}
+	setLokiSpanEntries(ctx, summary.Entries)
+	metadata, err := lokiMetadataContent(summary)
+	if err != nil {
+		return nil, err
+	}
+
+	// Large results are handed out as a resource link, which keeps the metadata and notes inline
+	content, err := lokiResultContent("loki_query", formattedResult)
+	if err != nil {
+		return nil, err
+	}
+	content = append(content, metadata)
+	// Report clamping and degraded results separately so that json and push output stay parseable
+	var notes []string
+	if widened := time.Duration(end - start); widened != requested {
+		notes = append(notes, lokiAutoWidenNote(requested, widened, start, end, summary.Entries > 0))
+	}
+	if limitNote != "" {
+		notes = append(notes, limitNote)
+	}
+	notes = append(notes, lokiResultNotes(result.Status, result.Warnings, result.Data.Stats, limit)...)
+	if lineRegex != nil {
+		notes = append(notes, lokiLineRegexNote(kept, summary))
+	}
+	if multilineNote != "" {
+		notes = append(notes, multilineNote)
+	}
+	if contextNote != "" {
+		notes = append(notes, contextNote)
+	}
+	if redacted > 0 {
+		notes = append(notes, fmt.Sprintf("redact: %d matches masked with %s", redacted, lokiRedactMask))
+	}
+	if cached {
+		notes = append(notes, "Result served from the query cache ("+EnvLokiQueryCacheTTL+"); set noCache to fetch it from Loki again")
+	}
+	content = lokiNotesContent(content, notes)
+
 	return &protocol.CallToolResult{
-		Content: []protocol.Content{
-			&protocol.TextContent{
-				Type: "text",
-				Text: formattedResult,
-			},
-		},
+		Content: content,
 	}, nil
 }
 
@@ -137,37 +470,26 @@ func HandleLokiLabelNamesProtocol(ctx context.Context, request *protocol.CallToo
 		return nil, err
 	}
 
-	lokiURL := getEnvOrDefault(req.URL, EnvLokiURL, DefaultLokiURL)
-	username := getEnvOrDefault(req.Username, EnvLokiUsername, "")
-	password := getEnvOrDefault(req.Password, EnvLokiPassword, "")
-	token := getEnvOrDefault(req.Token, EnvLokiToken, "")
-	orgID := getEnvOrDefault(req.Org, EnvLokiOrgID, "")
-
-	start := time.Now().Add(-1 * time.Hour).Unix()
-	end := time.Now().Unix()
-
-	if req.Start != "" {
-		startTime, err := parseTime(req.Start)
-		if err != nil {
-			return nil, fmt.Errorf("invalid start time: %v", err)
+	if req.Query != "" {
+		if err := validateLogQL(req.Query); err != nil {
+			return nil, err
 		}
-		start = startTime.Unix()
 	}
 
-	if req.End != "" {
-		endTime, err := parseTime(req.End)
-		if err != nil {
-			return nil, fmt.Errorf("invalid end time: %v", err)
-		}
-		end = endTime.Unix()
+	ctx, conn, err := resolveLokiCall(ctx, req.Backend, req.URL, req.Username, req.Password, req.Token, req.Org, req.Timeout, req.Headers)
+	if err != nil {
+		return nil, err
 	}
+	lokiURL, username, password, token, orgID := conn.URL, conn.Username, conn.Password, conn.Token, conn.OrgID
 
-	format := "raw"
-	if req.Format != "" {
-		format = req.Format
+	start, end, err := resolveLokiRange(req.Start, req.End, req.Timezone, req.AllowLargeRange)
+	if err != nil {
+		return nil, err
 	}
 
-	labelsURL, err := buildLokiLabelsURL(lokiURL, start, end)
+	format := resolveLokiFormat(req.Format, lokiLabelFormats)
+
+	labelsURL, err := buildLokiLabelsURL(lokiURL, req.Query, start, end)
 	if err != nil {
 		return nil, fmt.Errorf("failed to build labels URL: %v", err)
 	}
@@ -199,37 +521,37 @@ func HandleLokiLabelValuesProtocol(ctx context.Context, request *protocol.CallTo
 		return nil, err
 	}
 
-	lokiURL := getEnvOrDefault(req.URL, EnvLokiURL, DefaultLokiURL)
-	username := getEnvOrDefault(req.Username, EnvLokiUsername, "")
-	password := getEnvOrDefault(req.Password, EnvLokiPassword, "")
-	token := getEnvOrDefault(req.Token, EnvLokiToken, "")
-	orgID := getEnvOrDefault(req.Org, EnvLokiOrgID, "")
-
-	start := time.Now().Add(-1 * time.Hour).Unix()
-	end := time.Now().Unix()
-
-	if req.Start != "" {
-		startTime, err := parseTime(req.Start)
-		if err != nil {
-			return nil, fmt.Errorf("invalid start time: %v", err)
+	if req.Query != "" {
+		if err := validateLogQL(req.Query); err != nil {
+			return nil, err
 		}
-		start = startTime.Unix()
 	}
 
-	if req.End != "" {
-		endTime, err := parseTime(req.End)
-		if err != nil {
-			return nil, fmt.Errorf("invalid end time: %v", err)
-		}
-		end = endTime.Unix()
+	ctx, conn, err := resolveLokiCall(ctx, req.Backend, req.URL, req.Username, req.Password, req.Token, req.Org, req.Timeout, req.Headers)
+	if err != nil {
+		return nil, err
 	}
+	lokiURL, username, password, token, orgID := conn.URL, conn.Username, conn.Password, conn.Token, conn.OrgID
 
-	format := "raw"
-	if req.Format != "" {
-		format = req.Format
+	start, end, err := resolveLokiRange(req.Start, req.End, req.Timezone, req.AllowLargeRange)
+	if err != nil {
+		return nil, err
+	}
+
+	format := resolveLokiFormat(req.Format, lokiLabelFormats)
+
+	match, err := compileLokiLabelMatch(req.Match)
+	if err != nil {
+		return nil, err
+	}
+	limit, err := resolveLokiLabelValuesLimit(req.Limit)
+	if err != nil {
+		return nil, err
 	}
 
-	labelValuesURL, err := buildLokiLabelValuesURL(lokiURL, req.Label, start, end)
+	// Let Loki filter the values where it can; they are filtered again below for older versions
+	selector := mergeLokiSelectors(req.Query, lokiLabelValuesSelector(req.Label, req.Match, req.Prefix, match))
+	labelValuesURL, err := buildLokiLabelValuesURL(lokiURL, req.Label, selector, start, end)
 	if err != nil {
 		return nil, fmt.Errorf("failed to build label values URL: %v", err)
 	}
@@ -239,18 +561,29 @@ func HandleLokiLabelValuesProtocol(ctx context.Context, request *protocol.CallTo
 		return nil, fmt.Errorf("label values query execution failed: %v", err)
 	}
 
+	var notes []string
+	if match != nil || req.Prefix != "" || limit > 0 {
+		values, note := limitLokiLabelValues(filterLokiLabelValues(result.Data, match, req.Prefix), limit)
+		result = &LokiLabelValuesResult{Status: result.Status, Data: values}
+		if note != "" {
+			notes = append(notes, note)
+		}
+	}
+
 	formattedResult, err := formatLokiLabelValuesResults(req.Label, result, format)
 	if err != nil {
 		return nil, fmt.Errorf("failed to format results: %v", err)
 	}
 
-	return &protocol.CallToolResult{
-		Content: []protocol.Content{
-			&protocol.TextContent{
-				Type: "text",
-				Text: formattedResult,
-			},
+	// Report truncation separately so that json output stays parseable
+	content := []protocol.Content{
+		&protocol.TextContent{
+			Type: "text",
+			Text: formattedResult,
 		},
+	}
+	return &protocol.CallToolResult{
+		Content: lokiNotesContent(content, notes),
 	}, nil
 }
 
@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+)
+
+// LokiPushRequest represents the body accepted by Loki's /loki/api/v1/push endpoint
+type LokiPushRequest struct {
+	Streams []LokiPushStream `json:"streams"`
+}
+
+// LokiPushStream represents a single stream in a Loki push request
+type LokiPushStream struct {
+	Stream map[string]string `json:"stream"`
+	Values [][]string        `json:"values"` // [nanosecond timestamp, log line]
+}
+
+// buildLokiPushRequest converts query results into a push request that can be replayed into another Loki
+func buildLokiPushRequest(result *LokiResult) (*LokiPushRequest, error) {
+	push := &LokiPushRequest{Streams: make([]LokiPushStream, 0, len(result.Data.Result))}
+
+	for _, entry := range result.Data.Result {
+		stream := LokiPushStream{
+			Stream: entry.Stream,
+			Values: make([][]string, 0, len(entry.Values)),
+		}
+		if stream.Stream == nil {
+			stream.Stream = map[string]string{}
+		}
+
+		for _, val := range entry.Values {
+			if len(val) < 2 {
+				continue
+			}
+			// Push timestamps must be integer nanoseconds encoded as strings
+			if _, err := strconv.ParseInt(val[0], 10, 64); err != nil {
+				return nil, fmt.Errorf("invalid nanosecond timestamp %q: %v", val[0], err)
+			}
+			stream.Values = append(stream.Values, []string{val[0], val[1]})
+		}
+
+		push.Streams = append(push.Streams, stream)
+	}
+
+	return push, nil
+}
+
+// formatLokiPush formats the Loki query results in Loki push format
+func formatLokiPush(result *LokiResult) (string, error) {
+	push, err := buildLokiPushRequest(result)
+	if err != nil {
+		return "", err
+	}
+
+	jsonBytes, err := json.MarshalIndent(push, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal JSON: %v", err)
+	}
+	return string(jsonBytes), nil
+}
@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"encoding/json"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// labelNamePattern matches valid Prometheus/Loki label names
+var labelNamePattern = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// TestFormatLokiResults_PushRoundTrip verifies the push format is structurally valid push
+// input and that labels and nanosecond timestamps round-trip unchanged
+func TestFormatLokiResults_PushRoundTrip(t *testing.T) {
+	result := &LokiResult{
+		Status: "success",
+		Data: LokiData{
+			ResultType: "streams",
+			Result: []LokiEntry{
+				{
+					Stream: map[string]string{"job": "api", "level": "error"},
+					Values: [][]string{
+						{"1705312245123456789", "first line"},
+						{"1705312246000000001", "second line with \"quotes\""},
+					},
+				},
+				{
+					Stream: map[string]string{"job": "worker"},
+					Values: [][]string{
+						{"1705312247000000000", "third line"},
+					},
+				},
+			},
+		},
+	}
+
+	output, err := formatLokiResults(result, "push")
+	if err != nil {
+		t.Fatalf("formatLokiResults failed: %v", err)
+	}
+
+	// Validate the output against the push schema: only a "streams" array whose items
+	// have exactly a "stream" label map and "values" pairs of [ns timestamp, line]
+	decoder := json.NewDecoder(strings.NewReader(output))
+	decoder.DisallowUnknownFields()
+	var push LokiPushRequest
+	if err := decoder.Decode(&push); err != nil {
+		t.Fatalf("Push output is not valid push JSON: %v\n%s", err, output)
+	}
+
+	var generic map[string][]map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(output), &generic); err != nil {
+		t.Fatalf("Push output has unexpected shape: %v", err)
+	}
+	for _, stream := range generic["streams"] {
+		if len(stream) != 2 || stream["stream"] == nil || stream["values"] == nil {
+			t.Errorf("Expected each stream to have exactly 'stream' and 'values' keys, got %v", stream)
+		}
+	}
+
+	if len(push.Streams) != len(result.Data.Result) {
+		t.Fatalf("Expected %d streams, got %d", len(result.Data.Result), len(push.Streams))
+	}
+
+	for i, stream := range push.Streams {
+		original := result.Data.Result[i]
+		if !reflect.DeepEqual(stream.Stream, original.Stream) {
+			t.Errorf("Stream %d labels did not round-trip: got %v, expected %v", i, stream.Stream, original.Stream)
+		}
+		for name := range stream.Stream {
+			if !labelNamePattern.MatchString(name) {
+				t.Errorf("Invalid label name %q", name)
+			}
+		}
+		if !reflect.DeepEqual(stream.Values, original.Values) {
+			t.Errorf("Stream %d values did not round-trip: got %v, expected %v", i, stream.Values, original.Values)
+		}
+		for _, val := range stream.Values {
+			if len(val) != 2 {
+				t.Errorf("Expected [timestamp, line] pairs, got %v", val)
+				continue
+			}
+			if _, err := strconv.ParseInt(val[0], 10, 64); err != nil {
+				t.Errorf("Timestamp %q is not an integer nanosecond value", val[0])
+			}
+		}
+	}
+}
+
+// TestFormatLokiResults_PushInvalidTimestamp verifies non-numeric timestamps are rejected
+func TestFormatLokiResults_PushInvalidTimestamp(t *testing.T) {
+	result := &LokiResult{
+		Status: "success",
+		Data: LokiData{
+			ResultType: "streams",
+			Result: []LokiEntry{
+				{
+					Stream: map[string]string{"job": "api"},
+					Values: [][]string{{"invalid-timestamp", "line"}},
+				},
+			},
+		},
+	}
+
+	if _, err := formatLokiResults(result, "push"); err == nil {
+		t.Error("Expected an error for a non-numeric timestamp, got nil")
+	}
+}
+
+// TestFormatLokiResults_PushEmpty verifies an empty result renders an empty push body
+func TestFormatLokiResults_PushEmpty(t *testing.T) {
+	result := &LokiResult{Status: "success", Data: LokiData{ResultType: "streams"}}
+
+	output, err := formatLokiResults(result, "push")
+	if err != nil {
+		t.Fatalf("formatLokiResults failed: %v", err)
+	}
+
+	var push LokiPushRequest
+	if err := json.Unmarshal([]byte(output), &push); err != nil {
+		t.Fatalf("Empty push output is not valid JSON: %v", err)
+	}
+	if push.Streams == nil || len(push.Streams) != 0 {
+		t.Errorf("Expected an empty streams array, got %v", push.Streams)
+	}
+}
@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// Environment variable name for how long loki_query results of past time ranges are cached, 0 or
+// unset disables the cache
+const EnvLokiQueryCacheTTL = "LOKI_QUERY_CACHE_TTL"
+
+// Environment variable name for the maximum number of cached loki_query responses
+const EnvLokiQueryCacheSize = "LOKI_QUERY_CACHE_SIZE"
+
+// Default maximum number of cached loki_query responses
+const DefaultLokiQueryCacheSize = 64
+
+// Cache of loki_query response bodies. Bodies rather than parsed results are kept, so that every
+// hit decodes a fresh result that later steps are free to modify.
+var lokiQueries = newLokiCache(func(body []byte) []byte { return append([]byte(nil), body...) })
+
+// resolveLokiQueryCache returns the cache TTL and size from the environment. The cache is off
+// unless a TTL is set; a TTL of 0, in any unit such as 0s, also disables it and is returned as 0.
+func resolveLokiQueryCache() (time.Duration, int, error) {
+	value := os.Getenv(EnvLokiQueryCacheTTL)
+	if value == "" {
+		return 0, 0, nil
+	}
+	ttl, err := parseDuration(value)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid %s: %v", EnvLokiQueryCacheTTL, err)
+	}
+	if ttl < 0 {
+		return 0, 0, fmt.Errorf("invalid %s: %q must not be negative", EnvLokiQueryCacheTTL, value)
+	}
+	if ttl == 0 {
+		return 0, 0, nil
+	}
+
+	size, err := lokiLimitFromEnv(EnvLokiQueryCacheSize, DefaultLokiQueryCacheSize)
+	if err != nil {
+		return 0, 0, err
+	}
+	return ttl, size, nil
+}
+
+// CheckLokiQueryCache validates the query cache settings so that mistakes are reported at
+// startup, and returns the TTL, 0 if the cache is disabled, and the size
+func CheckLokiQueryCache() (time.Duration, int, error) {
+	return resolveLokiQueryCache()
+}
+
+// lokiAbsoluteTime reports whether a start or end argument names a fixed point in time, as opposed
+// to an empty default, "now" expressions such as now-5m or relative times such as -1h
+func lokiAbsoluteTime(value string) bool {
+	value = strings.TrimSpace(value)
+	return value != "" && !strings.HasPrefix(value, "now") && value[0] != '-'
+}
+
+// lokiQueryCacheable reports whether a loki_query range is fully bounded in the past, so that
+// Loki would keep returning the same result for it. Ranges ending now never are: new lines may
+// still arrive.
+func lokiQueryCacheable(startArg, endArg string, end int64, now time.Time) bool {
+	return lokiAbsoluteTime(startArg) && lokiAbsoluteTime(endArg) && end < now.UnixNano()
+}
+
+// executeCachedLokiQuery runs a query like executeLokiQuery, answering from the query cache when
+// the same URL was fetched with the same tenant, credentials and headers within the TTL. It
+// reports whether the result came from the cache.
+func executeCachedLokiQuery(ctx context.Context, queryURL string, ttl time.Duration, size int, username, password, token, orgID string) (*LokiResult, bool, error) {
+	key := lokiRequestKey(ctx, queryURL, username, password, token, orgID)
+	if body, ok := lokiQueries.get(key); ok {
+		lokiLogger(ctx).Debug("Query cache hit", "url", redactLokiURL(queryURL))
+		result, err := decodeLokiQueryResult(body)
+		return result, true, err
+	}
+
+	body, err := doLokiRequest(ctx, queryURL, username, password, token, orgID)
+	if err != nil {
+		return nil, false, err
+	}
+	result, err := decodeLokiQueryResult(body)
+	if err != nil {
+		return nil, false, err
+	}
+	lokiQueries.put(key, body, ttl, size)
+	return result, false, nil
+}
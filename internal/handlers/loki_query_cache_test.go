@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ThinkInAIXYZ/go-mcp/protocol"
+)
+
+// TestLokiQueryCacheable verifies that only ranges with fixed start and end in the past are cached
+func TestLokiQueryCacheable(t *testing.T) {
+	now := time.Date(2024, 1, 15, 12, 0, 0, 0, time.UTC)
+	past := now.Add(-time.Hour).UnixNano()
+	tests := []struct {
+		start, end string
+		endNanos   int64
+		want       bool
+	}{
+		{start: "2024-01-15T10:00:00Z", end: "2024-01-15T11:00:00Z", endNanos: past, want: true},
+		{start: "1705312800", end: "1705316400", endNanos: past, want: true},
+		{start: "2024-01-15T10:00:00Z", endNanos: now.UnixNano()},
+		{start: "2024-01-15T10:00:00Z", end: "now", endNanos: now.UnixNano()},
+		{start: "2024-01-15T10:00:00Z", end: "now-5m", endNanos: now.Add(-5 * time.Minute).UnixNano()},
+		{start: "-2h", end: "2024-01-15T11:00:00Z", endNanos: past},
+		{end: "2024-01-15T11:00:00Z", endNanos: past},
+		{start: "2024-01-15T10:00:00Z", end: "2024-01-16T00:00:00Z", endNanos: now.Add(12 * time.Hour).UnixNano()},
+	}
+	for _, tt := range tests {
+		if got := lokiQueryCacheable(tt.start, tt.end, tt.endNanos, now); got != tt.want {
+			t.Errorf("lokiQueryCacheable(%q, %q) = %v, want %v", tt.start, tt.end, got, tt.want)
+		}
+	}
+}
+
+// TestResolveLokiQueryCache verifies that the cache is off by default and invalid settings are rejected
+func TestResolveLokiQueryCache(t *testing.T) {
+	tests := []struct {
+		ttl, size string
+		wantTTL   time.Duration
+		wantSize  int
+		wantErr   bool
+	}{
+		{},
+		{ttl: "0"},
+		{ttl: "0s", size: "soon"},
+		{ttl: "soon", wantErr: true},
+		{ttl: "-5m", wantErr: true},
+		{ttl: "5m", wantTTL: 5 * time.Minute, wantSize: DefaultLokiQueryCacheSize},
+		{ttl: "30", size: "8", wantTTL: 30 * time.Second, wantSize: 8},
+		{ttl: "30s", size: "-1", wantErr: true},
+		{ttl: "30s", size: "many", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Setenv(EnvLokiQueryCacheTTL, tt.ttl)
+		t.Setenv(EnvLokiQueryCacheSize, tt.size)
+		ttl, size, err := CheckLokiQueryCache()
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("TTL %q, size %q: expected an error", tt.ttl, tt.size)
+			}
+			continue
+		}
+		if err != nil || ttl != tt.wantTTL || size != tt.wantSize {
+			t.Errorf("TTL %q, size %q: expected (%v, %d), got (%v, %d, %v)", tt.ttl, tt.size, tt.wantTTL, tt.wantSize, ttl, size, err)
+		}
+	}
+}
+
+// TestHandleLokiQueryProtocol_Cache verifies hits for past ranges, bypass with noCache, and that
+// ranges ending now and other tenants are fetched from Loki
+func TestHandleLokiQueryProtocol_Cache(t *testing.T) {
+	var hits atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.Write([]byte(`{"status":"success","data":{"resultType":"streams","result":[{"stream":{"job":"a"},"values":[["1705312800000000000","hello"]]}]}}`))
+	}))
+	defer server.Close()
+
+	t.Setenv(EnvLokiQueryCacheTTL, "1m")
+	t.Setenv(EnvLokiOrgID, "")
+	if _, err := NewLokiQueryToolProtocol(); err != nil {
+		t.Fatalf("Failed to create tool: %v", err)
+	}
+
+	call := func(extra map[string]any) string {
+		t.Helper()
+		args := map[string]any{"query": `{job="a"}`, "url": server.URL, "start": "2024-01-15T10:00:00Z", "end": "2024-01-15T11:00:00Z"}
+		for k, v := range extra {
+			args[k] = v
+		}
+		raw, _ := json.Marshal(args)
+		result, err := HandleLokiQueryProtocol(context.Background(), &protocol.CallToolRequest{Name: "loki_query", RawArguments: raw})
+		if err != nil {
+			t.Fatalf("HandleLokiQueryProtocol failed: %v", err)
+		}
+		if !strings.Contains(result.Content[0].(*protocol.TextContent).Text, "hello") {
+			t.Errorf("Unexpected output: %v", result.Content[0])
+		}
+		var text strings.Builder
+		for _, content := range result.Content[1:] {
+			if c, ok := content.(*protocol.TextContent); ok {
+				text.WriteString(c.Text)
+			}
+		}
+		return text.String()
+	}
+
+	steps := []struct {
+		name       string
+		extra      map[string]any
+		wantHits   int32
+		wantCached bool
+	}{
+		{name: "First call", wantHits: 1},
+		{name: "Repeat", wantHits: 1, wantCached: true},
+		{name: "Other format", extra: map[string]any{"format": "json"}, wantHits: 1, wantCached: true},
+		{name: "Bypass", extra: map[string]any{"noCache": true}, wantHits: 2},
+		{name: "Other tenant", extra: map[string]any{"org": "tenant-2"}, wantHits: 3},
+		{name: "Ends now", extra: map[string]any{"end": "now"}, wantHits: 4},
+		{name: "Ends now again", extra: map[string]any{"end": "now"}, wantHits: 5},
+	}
+	for _, step := range steps {
+		notes := call(step.extra)
+		if got := hits.Load(); got != step.wantHits {
+			t.Errorf("%s: expected %d requests to Loki, got %d", step.name, step.wantHits, got)
+		}
+		if cached := strings.Contains(notes, "query cache"); cached != step.wantCached {
+			t.Errorf("%s: expected cached %v, notes:\n%s", step.name, step.wantCached, notes)
+		}
+	}
+}
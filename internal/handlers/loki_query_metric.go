@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// lokiMetricQueryFormats lists the loki_query formats that can show the series of a metric query;
+// the others work on log lines
+var lokiMetricQueryFormats = []string{"raw", "json", "text"}
+
+// formatLokiQueryMetric formats the series of a metric query like loki_query_range does, one
+// table of samples per series; formats that work on log lines are rejected
+func formatLokiQueryMetric(result *LokiMetricResult, format string) (string, error) {
+	if !slices.Contains(lokiMetricQueryFormats, format) {
+		return "", fmt.Errorf("format %s is not supported for metric query results (%s), supported formats: %s",
+			format, result.Data.ResultType, strings.Join(lokiMetricQueryFormats, ", "))
+	}
+	return formatLokiMetricResults(result, format)
+}
+
+// checkLokiMetricQueryOptions reports an error when a metric query result meets an option that
+// only applies to log lines, which would otherwise be silently ignored
+func checkLokiMetricQueryOptions(req *LokiQueryRequest) error {
+	var options []string
+	if len(req.Fields) > 0 {
+		options = append(options, "fields")
+	}
+	if req.Summarize {
+		options = append(options, "summarize")
+	}
+	if req.Dedup {
+		options = append(options, "dedup")
+	}
+	if req.Sort != "" {
+		options = append(options, "sort")
+	}
+	if req.ShowDeltas {
+		options = append(options, "showDeltas")
+	}
+	if req.GroupByStream {
+		options = append(options, "groupByStream")
+	}
+	if len(req.OutputLabels) > 0 {
+		options = append(options, "outputLabels")
+	}
+	if req.LineRegex != "" {
+		options = append(options, "lineRegex")
+	}
+	if req.Context > 0 {
+		options = append(options, "context")
+	}
+	if req.Interval != "" {
+		options = append(options, "interval")
+	}
+	if req.JoinMultiline {
+		options = append(options, "joinMultiline")
+	}
+	if len(options) == 0 {
+		return nil
+	}
+	return fmt.Errorf("the query returned a metric result, which has no log lines for %s; use loki_query_range for metric queries or drop these options",
+		strings.Join(options, ", "))
+}
@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ThinkInAIXYZ/go-mcp/protocol"
+)
+
+// TestHandleLokiQueryProtocol_Metric verifies that matrix and vector results of loki_query are
+// formatted as series, and that options for log lines are rejected for them
+func TestHandleLokiQueryProtocol_Metric(t *testing.T) {
+	responses := map[string]string{
+		"matrix": `{"status":"success","data":{"resultType":"matrix","result":[{"metric":{"level":"error"},"values":[[1705312800,"3"],[1705312860,"5"]]}]}}`,
+		"vector": `{"status":"success","data":{"resultType":"vector","result":[{"metric":{"level":"warn"},"value":[1705312800.5,"7"]}]}}`,
+	}
+	var response string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(response))
+	}))
+	defer server.Close()
+
+	if _, err := NewLokiQueryToolProtocol(); err != nil {
+		t.Fatalf("Failed to create tool: %v", err)
+	}
+	call := func(extra map[string]any) (*protocol.CallToolResult, error) {
+		args := map[string]any{"query": `sum by (level) (count_over_time({job="a"}[1m]))`, "url": server.URL}
+		for k, v := range extra {
+			args[k] = v
+		}
+		raw, _ := json.Marshal(args)
+		return HandleLokiQueryProtocol(context.Background(), &protocol.CallToolRequest{Name: "loki_query", RawArguments: raw})
+	}
+
+	response = responses["matrix"]
+	result, err := call(map[string]any{"format": "text"})
+	if err != nil {
+		t.Fatalf("HandleLokiQueryProtocol failed: %v", err)
+	}
+	output := result.Content[0].(*protocol.TextContent).Text
+	for _, want := range []string{"Found 1 series (matrix)", `{level="error"}`, "[2024-01-15T10:01:00Z] 5"} {
+		if !strings.Contains(output, want) {
+			t.Errorf("Expected %q in output:\n%s", want, output)
+		}
+	}
+	var metadata LokiQueryMetadata
+	if err := json.Unmarshal([]byte(result.Content[1].(*protocol.TextContent).Text), &metadata); err != nil {
+		t.Fatalf("Expected metadata to be JSON: %v", err)
+	}
+	if metadata.Entries != 2 || metadata.Streams != 1 || metadata.LimitHit || metadata.SinceToken != "" {
+		t.Errorf("Expected 2 samples in 1 series, got %+v", metadata)
+	}
+
+	response = responses["vector"]
+	result, err = call(map[string]any{"format": "json"})
+	if err != nil {
+		t.Fatalf("HandleLokiQueryProtocol failed: %v", err)
+	}
+	var parsed LokiMetricResult
+	if err := json.Unmarshal([]byte(result.Content[0].(*protocol.TextContent).Text), &parsed); err != nil {
+		t.Fatalf("Expected json output to parse as a metric result: %v", err)
+	}
+	if len(parsed.Data.Result) != 1 || parsed.Data.Result[0].Value == nil || parsed.Data.Result[0].Value.Value != "7" {
+		t.Errorf("Expected the vector sample, got %+v", parsed.Data.Result)
+	}
+
+	if _, err := call(map[string]any{"format": "logfmt"}); err == nil || !strings.Contains(err.Error(), "not supported for metric query results") {
+		t.Errorf("Expected logfmt to be rejected for metric results, got %v", err)
+	}
+	if _, err := call(map[string]any{"summarize": true}); err == nil || !strings.Contains(err.Error(), "summarize") {
+		t.Errorf("Expected summarize to be rejected for metric results, got %v", err)
+	}
+}
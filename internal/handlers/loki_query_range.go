@@ -0,0 +1,332 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ThinkInAIXYZ/go-mcp/protocol"
+)
+
+// Number of points a default step aims to produce across the query range
+const defaultRangePoints = 250
+
+// Maximum number of points Loki returns per series before rejecting the query
+const maxRangePoints = 11000
+
+// LokiQueryRangeRequest represents the arguments for loki_query_range tool
+type LokiQueryRangeRequest struct {
+	Query           string            `json:"query" description:"LogQL metric query string, e.g. rate({job=\"x\"}[5m])"`
+	URL             string            `json:"url,omitempty" description:"Loki server URL"`
+	Backend         string            `json:"backend,omitempty" description:"Name of a Loki backend from LOKI_BACKENDS, e.g. prod, whose URL and credentials to use; cannot be combined with url, and an explicit credential still wins"`
+	Username        string            `json:"username,omitempty" description:"Username for basic authentication"`
+	Password        string            `json:"password,omitempty" description:"Password for basic authentication"`
+	Token           string            `json:"token,omitempty" description:"Bearer token for authentication"`
+	Start           string            `json:"start,omitempty" description:"Start time for the query"`
+	End             string            `json:"end,omitempty" description:"End time for the query"`
+	Timezone        string            `json:"timezone,omitempty" description:"IANA timezone for start and end times without a zone, e.g. America/New_York (default: LOKI_TIMEZONE or UTC)"`
+	AllowLargeRange bool              `json:"allowLargeRange,omitempty" description:"Query a time range longer than LOKI_MAX_TIME_RANGE anyway; long ranges are expensive for Loki, so only set this when a narrower range will not do (default: false)"`
+	Step            string            `json:"step,omitempty" description:"Query resolution step as a duration (e.g. 30s, 5m) or seconds (default: range/250, at least 1s)"`
+	Limit           float64           `json:"limit,omitempty" description:"Maximum number of series to return"`
+	Org             string            `json:"org,omitempty" description:"Organization ID for the query; separate several with commas to query tenants together"`
+	Headers         map[string]string `json:"headers,omitempty" description:"Extra HTTP headers to send to Loki, e.g. {\"X-Api-Key\": \"...\"}; never replaces the auth or org headers"`
+	Timeout         string            `json:"timeout,omitempty" description:"Timeout for the Loki request as a duration (e.g. 45s) or seconds (default: LOKI_QUERY_TIMEOUT or 30s)"`
+	Format          string            `json:"format,omitempty" description:"Output format: raw, json, or text"`
+}
+
+// LokiMetricResult represents the structure of Loki metric query results
+type LokiMetricResult struct {
+	Status   string         `json:"status"`
+	Data     LokiMetricData `json:"data"`
+	Error    string         `json:"error,omitempty"`
+	Warnings []string       `json:"warnings,omitempty"`
+}
+
+// LokiMetricData represents the data portion of Loki metric results
+type LokiMetricData struct {
+	ResultType string             `json:"resultType"`
+	Result     []LokiMetricSeries `json:"result"`
+	Stats      json.RawMessage    `json:"stats,omitempty"`
+}
+
+// LokiMetricSeries represents a single series of a matrix or vector result
+type LokiMetricSeries struct {
+	Metric map[string]string `json:"metric"`
+	Values []LokiSample      `json:"values,omitempty"` // matrix results
+	Value  *LokiSample       `json:"value,omitempty"`  // vector results
+}
+
+// LokiSample represents a single [timestamp, value] sample. Loki encodes the timestamp
+// as a float number of seconds and the value as a string.
+type LokiSample struct {
+	Timestamp float64
+	Value     string
+}
+
+// UnmarshalJSON decodes a [timestamp, "value"] pair
+func (s *LokiSample) UnmarshalJSON(data []byte) error {
+	var pair []json.RawMessage
+	if err := json.Unmarshal(data, &pair); err != nil {
+		return err
+	}
+	if len(pair) != 2 {
+		return fmt.Errorf("expected [timestamp, value] sample, got %d elements", len(pair))
+	}
+	if err := json.Unmarshal(pair[0], &s.Timestamp); err != nil {
+		return fmt.Errorf("invalid sample timestamp: %v", err)
+	}
+	if err := json.Unmarshal(pair[1], &s.Value); err != nil {
+		return fmt.Errorf("invalid sample value: %v", err)
+	}
+	return nil
+}
+
+// MarshalJSON encodes the sample in Loki's [timestamp, "value"] form
+func (s LokiSample) MarshalJSON() ([]byte, error) {
+	return json.Marshal([]any{s.Timestamp, s.Value})
+}
+
+// Time returns the sample timestamp as a time.Time
+func (s LokiSample) Time() time.Time {
+	sec, frac := math.Modf(s.Timestamp)
+	return time.Unix(int64(sec), int64(math.Round(frac*1e9)))
+}
+
+// NewLokiQueryRangeToolProtocol creates a tool using the protocol library
+func NewLokiQueryRangeToolProtocol() (*protocol.Tool, error) {
+	return protocol.NewTool("loki_query_range", "Run a LogQL metric query over a time range against Grafana Loki, returning time series", LokiQueryRangeRequest{})
+}
+
+// HandleLokiQueryRangeProtocol handles Loki range query tool requests using protocol library
+func HandleLokiQueryRangeProtocol(ctx context.Context, request *protocol.CallToolRequest) (*protocol.CallToolResult, error) {
+	req := new(LokiQueryRangeRequest)
+	if err := protocol.VerifyAndUnmarshal(request.RawArguments, req); err != nil {
+		return nil, err
+	}
+
+	if err := validateLogQL(req.Query); err != nil {
+		return nil, err
+	}
+
+	ctx, conn, err := resolveLokiCall(ctx, req.Backend, req.URL, req.Username, req.Password, req.Token, req.Org, req.Timeout, req.Headers)
+	if err != nil {
+		return nil, err
+	}
+	lokiURL, username, password, token, orgID := conn.URL, conn.Username, conn.Password, conn.Token, conn.OrgID
+
+	limit, limitNote, err := resolveLokiLimit(req.Limit)
+	if err != nil {
+		return nil, err
+	}
+
+	start, end, err := resolveLokiRange(req.Start, req.End, req.Timezone, req.AllowLargeRange)
+	if err != nil {
+		return nil, err
+	}
+	startTime, endTime := time.Unix(0, start), time.Unix(0, end)
+
+	step := defaultRangeStep(startTime, endTime)
+	if req.Step != "" {
+		parsed, err := parsePositiveDuration("step", req.Step)
+		if err != nil {
+			return nil, err
+		}
+		step = parsed
+	}
+	if step <= 0 {
+		return nil, fmt.Errorf("step must be positive, got %s", step)
+	}
+	if points := endTime.Sub(startTime) / step; points > maxRangePoints {
+		return nil, fmt.Errorf("step %s is too small for the requested range: it would produce %d points per series (max %d)", step, points, maxRangePoints)
+	}
+
+	format := resolveLokiFormat(req.Format, lokiLabelFormats)
+
+	queryURL, err := buildLokiQueryRangeURL(lokiURL, req.Query, startTime.UnixNano(), endTime.UnixNano(), limit, step)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build query URL: %v", err)
+	}
+
+	result, err := executeLokiQueryRange(ctx, queryURL, username, password, token, orgID)
+	if err != nil {
+		return nil, fmt.Errorf("range query execution failed: %v", err)
+	}
+	setLokiSpanEntries(ctx, countLokiSamples(result))
+
+	formattedResult, err := formatLokiMetricResults(result, format)
+	if err != nil {
+		return nil, fmt.Errorf("failed to format results: %v", err)
+	}
+	if len(result.Data.Result) == 0 && format != "json" {
+		formattedResult = lokiEmptyResultMessage("series", req.Query, startTime.UnixNano(), endTime.UnixNano())
+	}
+
+	content, err := lokiResultContent("loki_query_range", formattedResult)
+	if err != nil {
+		return nil, err
+	}
+	// Series are not capped by an entry limit, so only the status, warnings and limit note apply
+	notes := lokiResultNotes(result.Status, result.Warnings, nil, 0)
+	if limitNote != "" {
+		notes = append(notes, limitNote)
+	}
+	content = lokiNotesContent(content, notes)
+
+	return &protocol.CallToolResult{
+		Content: content,
+	}, nil
+}
+
+// defaultRangeStep picks a step that yields about defaultRangePoints points, rounded up to whole
+// seconds and at least 1s, so that tiny ranges never get a zero step
+func defaultRangeStep(start, end time.Time) time.Duration {
+	step := end.Sub(start) / defaultRangePoints
+	if step%time.Second != 0 {
+		step = step.Truncate(time.Second) + time.Second
+	}
+	return max(step, time.Second)
+}
+
+// buildLokiQueryRangeURL constructs the Loki query_range URL including the step parameter
+func buildLokiQueryRangeURL(baseURL, query string, start, end int64, limit int, step time.Duration) (string, error) {
+	queryURL, err := buildLokiQueryURL(baseURL, query, start, end, limit, "")
+	if err != nil {
+		return "", err
+	}
+
+	u, err := url.Parse(queryURL)
+	if err != nil {
+		return "", err
+	}
+
+	q := u.Query()
+	q.Set("step", strconv.FormatFloat(step.Seconds(), 'f', -1, 64))
+	u.RawQuery = q.Encode()
+
+	return u.String(), nil
+}
+
+// countLokiSamples returns the number of samples in a metric result
+func countLokiSamples(result *LokiMetricResult) int {
+	count := 0
+	for _, series := range result.Data.Result {
+		count += len(series.Values)
+		if series.Value != nil {
+			count++
+		}
+	}
+	return count
+}
+
+// executeLokiQueryRange sends the HTTP request to Loki and decodes a metric result
+func executeLokiQueryRange(ctx context.Context, queryURL string, username, password, token, orgID string) (*LokiMetricResult, error) {
+	body, err := doLokiRequest(ctx, queryURL, username, password, token, orgID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Log queries return streams, which cannot be decoded as samples
+	var probe struct {
+		Status string `json:"status"`
+		Error  string `json:"error,omitempty"`
+		Data   struct {
+			ResultType string `json:"resultType"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &probe); err != nil {
+		return nil, err
+	}
+	if probe.Status == "error" {
+		return nil, fmt.Errorf("loki error: %s", probe.Error)
+	}
+	if probe.Data.ResultType == "streams" {
+		return nil, fmt.Errorf("query returned log streams, not a metric result; use loki_query for log queries")
+	}
+
+	// Parse JSON response
+	var result LokiMetricResult
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+// formatMetricLabels renders a metric label set as {k="v", ...} with sorted keys
+func formatMetricLabels(metric map[string]string) string {
+	keys := make([]string, 0, len(metric))
+	for k := range metric {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		parts = append(parts, fmt.Sprintf("%s=%q", k, metric[k]))
+	}
+	return "{" + strings.Join(parts, ", ") + "}"
+}
+
+// formatLokiMetricResults formats Loki matrix or vector results into a readable string
+func formatLokiMetricResults(result *LokiMetricResult, format string) (string, error) {
+	if len(result.Data.Result) == 0 && format != "json" {
+		return "No series found matching the query", nil
+	}
+
+	switch format {
+	case "json":
+		// Return raw JSON response; a result without series keeps an empty array so that it
+		// parses like any other
+		if result.Data.Result == nil {
+			empty := *result
+			empty.Data.Result = []LokiMetricSeries{}
+			result = &empty
+		}
+		jsonBytes, err := json.MarshalIndent(result, "", "  ")
+		if err != nil {
+			return "", fmt.Errorf("failed to marshal JSON: %v", err)
+		}
+		return string(jsonBytes), nil
+
+	case "raw":
+		// Return one sample per line prefixed by the series labels
+		var b strings.Builder
+		for _, series := range result.Data.Result {
+			labels := formatMetricLabels(series.Metric)
+			for _, sample := range seriesSamples(series) {
+				fmt.Fprintf(&b, "%s %s %s\n", sample.Time().Format(time.RFC3339), labels, sample.Value)
+			}
+		}
+		return b.String(), nil
+
+	case "text":
+		// Return samples grouped under a header per series
+		var b strings.Builder
+		fmt.Fprintf(&b, "Found %d series (%s):\n\n", len(result.Data.Result), result.Data.ResultType)
+		for i, series := range result.Data.Result {
+			fmt.Fprintf(&b, "Series %d %s:\n", i+1, formatMetricLabels(series.Metric))
+			for _, sample := range seriesSamples(series) {
+				fmt.Fprintf(&b, "  [%s] %s\n", sample.Time().Format(time.RFC3339), sample.Value)
+			}
+			b.WriteString("\n")
+		}
+		return b.String(), nil
+
+	default:
+		return "", fmt.Errorf("unsupported format: %s. Supported formats: raw, json, text", format)
+	}
+}
+
+// seriesSamples returns the samples of a matrix series, or the single sample of a vector series
+func seriesSamples(series LokiMetricSeries) []LokiSample {
+	if series.Value != nil {
+		return []LokiSample{*series.Value}
+	}
+	return series.Values
+}
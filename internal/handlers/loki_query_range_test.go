@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ThinkInAIXYZ/go-mcp/protocol"
+)
+
+// TestParseStep verifies step parsing and validation
+func TestParseStep(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected time.Duration
+		wantErr  bool
+	}{
+		{input: "30s", expected: 30 * time.Second},
+		{input: "5m", expected: 5 * time.Minute},
+		{input: "1h30m", expected: 90 * time.Minute},
+		{input: "15", expected: 15 * time.Second},
+		{input: "0.5", expected: 500 * time.Millisecond},
+		{input: "0s", wantErr: true},
+		{input: "-1m", wantErr: true},
+		{input: "abc", wantErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.input, func(t *testing.T) {
+			got, err := parsePositiveDuration("step", tc.input)
+			if tc.wantErr {
+				if err == nil {
+					t.Errorf("Expected error for %q, got %v", tc.input, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error for %q: %v", tc.input, err)
+			}
+			if got != tc.expected {
+				t.Errorf("step %q = %v, expected %v", tc.input, got, tc.expected)
+			}
+		})
+	}
+}
+
+// TestDefaultRangeStep verifies the default step targets ~250 points in whole seconds
+func TestDefaultRangeStep(t *testing.T) {
+	start := time.Unix(1705312245, 0)
+	if got := defaultRangeStep(start, start.Add(time.Hour)); got != 15*time.Second {
+		t.Errorf("Expected 15s step for a 1h range, got %v", got)
+	}
+	if got := defaultRangeStep(start, start.Add(time.Minute)); got != time.Second {
+		t.Errorf("Expected 1s minimum step for a 1m range, got %v", got)
+	}
+	if got := defaultRangeStep(start, start.Add(100*time.Nanosecond)); got != time.Second {
+		t.Errorf("Expected 1s minimum step for a 100ns range, got %v", got)
+	}
+}
+
+// TestBuildLokiQueryRangeURL verifies the step parameter is encoded in seconds
+func TestBuildLokiQueryRangeURL(t *testing.T) {
+	got, err := buildLokiQueryRangeURL("http://localhost:3100", `rate({job="x"}[5m])`, 100, 200, 50, 90*time.Second)
+	if err != nil {
+		t.Fatalf("buildLokiQueryRangeURL failed: %v", err)
+	}
+	u, _ := url.Parse(got)
+	if u.Path != "/loki/api/v1/query_range" {
+		t.Errorf("Unexpected path %q", u.Path)
+	}
+	if step := u.Query().Get("step"); step != "90" {
+		t.Errorf("Expected step=90, got %q", step)
+	}
+	if query := u.Query().Get("query"); query != `rate({job="x"}[5m])` {
+		t.Errorf("Unexpected query %q", query)
+	}
+}
+
+// TestHandleLokiQueryRangeProtocol verifies a matrix result is fetched and formatted
+func TestHandleLokiQueryRangeProtocol(t *testing.T) {
+	var lastQuery url.Values
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lastQuery = r.URL.Query()
+		if strings.Contains(lastQuery.Get("query"), "rate") {
+			w.Write([]byte(`{"status":"success","data":{"resultType":"matrix","result":[{"metric":{"job":"x"},"values":[[1705312245,"1.5"],[1705312260.5,"2"]]}]}}`))
+			return
+		}
+		w.Write([]byte(`{"status":"success","data":{"resultType":"streams","result":[]}}`))
+	}))
+	defer server.Close()
+
+	if _, err := NewLokiQueryRangeToolProtocol(); err != nil {
+		t.Fatalf("Failed to create tool: %v", err)
+	}
+
+	call := func(args map[string]any) (*protocol.CallToolResult, error) {
+		raw, _ := json.Marshal(args)
+		return HandleLokiQueryRangeProtocol(context.Background(), &protocol.CallToolRequest{Name: "loki_query_range", RawArguments: raw})
+	}
+
+	result, err := call(map[string]any{"query": `rate({job="x"}[5m])`, "url": server.URL, "step": "1m", "format": "text"})
+	if err != nil {
+		t.Fatalf("HandleLokiQueryRangeProtocol failed: %v", err)
+	}
+	if lastQuery.Get("step") != "60" {
+		t.Errorf("Expected step=60, got %q", lastQuery.Get("step"))
+	}
+	text := result.Content[0].(*protocol.TextContent).Text
+	if !strings.Contains(text, `Series 1 {job="x"}`) || !strings.Contains(text, "2024-01-15T") || !strings.Contains(text, "] 1.5") {
+		t.Errorf("Unexpected formatted output:\n%s", text)
+	}
+
+	// The limit honors LOKI_DEFAULT_LIMIT and LOKI_MAX_LIMIT like the other tools
+	t.Setenv(EnvLokiDefaultLimit, "30")
+	t.Setenv(EnvLokiMaxLimit, "50")
+	if _, err := call(map[string]any{"query": `rate({job="x"}[5m])`, "url": server.URL}); err != nil || lastQuery.Get("limit") != "30" {
+		t.Errorf("Expected limit=30 from LOKI_DEFAULT_LIMIT, got %q, %v", lastQuery.Get("limit"), err)
+	}
+	result, err = call(map[string]any{"query": `rate({job="x"}[5m])`, "url": server.URL, "limit": 80})
+	if err != nil || lastQuery.Get("limit") != "50" {
+		t.Fatalf("Expected limit=50 from LOKI_MAX_LIMIT, got %q, %v", lastQuery.Get("limit"), err)
+	}
+	if notes := result.Content[len(result.Content)-1].(*protocol.TextContent).Text; !strings.Contains(notes, "limit reduced from 80 to 50") {
+		t.Errorf("Expected the limit note, got %q", notes)
+	}
+	t.Setenv(EnvLokiDefaultLimit, "")
+	t.Setenv(EnvLokiMaxLimit, "")
+
+	// A range shorter than the number of default points still gets a usable step
+	if _, err := call(map[string]any{"query": `rate({job="x"}[5m])`, "url": server.URL,
+		"start": "2024-01-15T10:00:00.000000000Z", "end": "2024-01-15T10:00:00.000000100Z"}); err != nil {
+		t.Errorf("Expected a tiny range to be accepted, got %v", err)
+	} else if lastQuery.Get("step") != "1" {
+		t.Errorf("Expected step=1 for a tiny range, got %q", lastQuery.Get("step"))
+	}
+
+	if _, err := call(map[string]any{"query": `rate({job="x"}[5m])`, "url": server.URL, "step": "-5s"}); err == nil {
+		t.Error("Expected an error for a negative step")
+	}
+
+	if _, err := call(map[string]any{"query": `{job="x"}`, "url": server.URL}); err == nil || !strings.Contains(err.Error(), "loki_query") {
+		t.Errorf("Expected a streams result to point at loki_query, got %v", err)
+	}
+}
@@ -0,0 +1,173 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Environment variable name for the number of requests per second each tenant may send to Loki;
+// unset disables rate limiting
+const EnvLokiRateLimit = "LOKI_RATE_LIMIT"
+
+// Environment variable name for the number of requests a tenant may send at once before
+// LOKI_RATE_LIMIT applies
+const EnvLokiRateLimitBurst = "LOKI_RATE_LIMIT_BURST"
+
+// LokiTenantRateLimitError is returned when a tenant exceeds LOKI_RATE_LIMIT; the request is not
+// sent to Loki
+type LokiTenantRateLimitError struct {
+	Tenant     string
+	Rate       float64
+	Burst      int
+	RetryAfter time.Duration
+}
+
+// Error implements the error interface
+func (e *LokiTenantRateLimitError) Error() string {
+	return fmt.Sprintf("rate limit exceeded for %s: at most %g requests per second with bursts of %d (%s), retry after %s",
+		e.Tenant, e.Rate, e.Burst, EnvLokiRateLimit, (e.RetryAfter + time.Millisecond - 1).Truncate(time.Millisecond))
+}
+
+// lokiTokenBucket holds the requests a tenant may still send, refilled at rate per second up to burst
+type lokiTokenBucket struct {
+	rate   float64
+	burst  int
+	tokens float64
+	last   time.Time
+}
+
+// take removes a token from the bucket if one is available at now, or otherwise returns how long
+// until the next one is
+func (b *lokiTokenBucket) take(now time.Time) (bool, time.Duration) {
+	b.tokens = math.Min(float64(b.burst), b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	return false, time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+}
+
+// Token buckets by tenant; a bucket is replaced when the configured rate or burst changes
+var (
+	lokiBucketsMu sync.Mutex
+	lokiBuckets   = map[string]*lokiTokenBucket{}
+	lokiBucketsAt = lokiBucketsSweepMin // number of buckets at which idle ones are next dropped
+)
+
+// lokiBucketsSweepMin is the smallest number of buckets at which idle buckets are dropped
+const lokiBucketsSweepMin = 64
+
+// full reports whether the bucket has refilled up to its burst at now, in which case it is no
+// different from a new one and can be dropped
+func (b *lokiTokenBucket) full(now time.Time) bool {
+	return b.tokens+now.Sub(b.last).Seconds()*b.rate >= float64(b.burst)
+}
+
+// sweepLokiBuckets drops the buckets of tenants idle long enough to have refilled, so that org IDs
+// supplied by callers cannot grow the map without bound. It runs whenever the map has doubled
+// since the last sweep, which keeps its cost constant per request. lokiBucketsMu must be held.
+func sweepLokiBuckets(now time.Time) {
+	if len(lokiBuckets) < lokiBucketsAt {
+		return
+	}
+	for tenant, bucket := range lokiBuckets {
+		if bucket.full(now) {
+			delete(lokiBuckets, tenant)
+		}
+	}
+	lokiBucketsAt = max(lokiBucketsSweepMin, 2*len(lokiBuckets))
+}
+
+// loadLokiRateLimit reads the per-tenant rate limit from the environment. A rate of 0 means
+// rate limiting is disabled. The burst defaults to the rate rounded up, and at least 1.
+func loadLokiRateLimit() (float64, int, error) {
+	raw := os.Getenv(EnvLokiRateLimit)
+	if raw == "" {
+		return 0, 0, nil
+	}
+	rate, err := strconv.ParseFloat(raw, 64)
+	if err != nil || rate <= 0 || math.IsInf(rate, 0) {
+		return 0, 0, fmt.Errorf("invalid %s: %q must be a positive number of requests per second", EnvLokiRateLimit, raw)
+	}
+
+	burst := max(1, int(math.Ceil(rate)))
+	if raw := os.Getenv(EnvLokiRateLimitBurst); raw != "" {
+		if burst, err = strconv.Atoi(raw); err != nil || burst < 1 {
+			return 0, 0, fmt.Errorf("invalid %s: %q must be a positive integer", EnvLokiRateLimitBurst, raw)
+		}
+	}
+	return rate, burst, nil
+}
+
+// CheckLokiRateLimit validates the per-tenant rate limit so that mistakes are reported at
+// startup, and returns the rate and burst, a rate of 0 if rate limiting is disabled
+func CheckLokiRateLimit() (float64, int, error) {
+	return loadLokiRateLimit()
+}
+
+// lokiRateLimitTenant names the tenant a request is counted against: its org ID, or, for requests
+// without one, the token or username they authenticate with. The credential is hashed so that it
+// is not kept in memory or shown in errors.
+func lokiRateLimitTenant(username, token, orgID string) string {
+	switch {
+	case orgID != "":
+		return fmt.Sprintf("org %q", orgID)
+	case token != "":
+		sum := sha256.Sum256([]byte(token))
+		return "token " + hex.EncodeToString(sum[:4])
+	case username != "":
+		return fmt.Sprintf("user %q", username)
+	default:
+		return "requests without an org"
+	}
+}
+
+// checkLokiRateLimit reports a LokiTenantRateLimitError when the tenant of a request has used up
+// its LOKI_RATE_LIMIT, so that a runaway client cannot flood a shared Loki. Requests are refused
+// rather than delayed, which lets agents see the limit and slow down. A tool call wrapped by
+// InstrumentLokiTool is charged once per tenant, however many requests it sends to Loki.
+func checkLokiRateLimit(ctx context.Context, username, token, orgID string) error {
+	rate, burst, err := loadLokiRateLimit()
+	if err != nil || rate == 0 {
+		return err
+	}
+
+	tenant := lokiRateLimitTenant(username, token, orgID)
+	calls, ok := ctx.Value(lokiCallsKey{}).(*lokiCalls)
+	if ok {
+		calls.mu.Lock()
+		defer calls.mu.Unlock()
+		if calls.charged[tenant] {
+			return nil
+		}
+	}
+	now := time.Now()
+
+	lokiBucketsMu.Lock()
+	defer lokiBucketsMu.Unlock()
+	bucket, found := lokiBuckets[tenant]
+	if !found || bucket.rate != rate || bucket.burst != burst {
+		sweepLokiBuckets(now)
+		bucket = &lokiTokenBucket{rate: rate, burst: burst, tokens: float64(burst), last: now}
+		lokiBuckets[tenant] = bucket
+	}
+	if allowed, wait := bucket.take(now); !allowed {
+		return &LokiTenantRateLimitError{Tenant: tenant, Rate: rate, Burst: burst, RetryAfter: wait}
+	}
+
+	if ok {
+		if calls.charged == nil {
+			calls.charged = map[string]bool{}
+		}
+		calls.charged[tenant] = true
+	}
+	return nil
+}
@@ -0,0 +1,153 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ThinkInAIXYZ/go-mcp/protocol"
+)
+
+// TestLokiTokenBucket verifies that a bucket allows a burst, then refills at its rate
+func TestLokiTokenBucket(t *testing.T) {
+	start := time.Unix(1705312800, 0)
+	bucket := &lokiTokenBucket{rate: 2, burst: 2, tokens: 2, last: start}
+
+	for i := 0; i < 2; i++ {
+		if ok, _ := bucket.take(start); !ok {
+			t.Fatalf("Expected request %d of the burst to be allowed", i+1)
+		}
+	}
+	ok, wait := bucket.take(start)
+	if ok || wait != 500*time.Millisecond {
+		t.Errorf("Expected a refusal with a 500ms wait, got %v, %s", ok, wait)
+	}
+	if ok, _ := bucket.take(start.Add(500 * time.Millisecond)); !ok {
+		t.Error("Expected a request to be allowed once a token was refilled")
+	}
+	if ok, _ := bucket.take(start.Add(10 * time.Second)); !ok || bucket.tokens != 1 {
+		t.Errorf("Expected the bucket to refill up to its burst only, got %v tokens", bucket.tokens)
+	}
+}
+
+// TestLoadLokiRateLimit verifies the defaults and the validation of the rate limit settings
+func TestLoadLokiRateLimit(t *testing.T) {
+	t.Setenv(EnvLokiRateLimit, "")
+	if rate, _, err := loadLokiRateLimit(); err != nil || rate != 0 {
+		t.Errorf("Expected rate limiting to be disabled by default, got %v, %v", rate, err)
+	}
+
+	t.Setenv(EnvLokiRateLimit, "2.5")
+	t.Setenv(EnvLokiRateLimitBurst, "")
+	if rate, burst, err := loadLokiRateLimit(); err != nil || rate != 2.5 || burst != 3 {
+		t.Errorf("Expected 2.5 requests per second with bursts of 3, got %v, %d, %v", rate, burst, err)
+	}
+
+	for _, tt := range []struct{ rate, burst string }{{"fast", ""}, {"0", ""}, {"-1", ""}, {"5", "0"}, {"5", "many"}} {
+		t.Setenv(EnvLokiRateLimit, tt.rate)
+		t.Setenv(EnvLokiRateLimitBurst, tt.burst)
+		if _, _, err := CheckLokiRateLimit(); err == nil {
+			t.Errorf("Expected rate %q with burst %q to be rejected", tt.rate, tt.burst)
+		}
+	}
+}
+
+// TestHandleLokiQueryProtocol_RateLimit verifies that requests over a tenant's limit are refused
+// without reaching Loki, and that other tenants are unaffected
+func TestHandleLokiQueryProtocol_RateLimit(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Write([]byte(`{"status":"success","data":{"resultType":"streams","result":[]}}`))
+	}))
+	defer server.Close()
+
+	t.Setenv(EnvLokiRateLimit, "0.01")
+	t.Setenv(EnvLokiRateLimitBurst, "2")
+	if _, err := NewLokiQueryToolProtocol(); err != nil {
+		t.Fatalf("Failed to create tool: %v", err)
+	}
+	call := func(org string) error {
+		raw, _ := json.Marshal(map[string]any{"query": `{job="a"}`, "url": server.URL, "org": org})
+		_, err := HandleLokiQueryProtocol(context.Background(), &protocol.CallToolRequest{Name: "loki_query", RawArguments: raw})
+		return err
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := call("rate-limit-test-a"); err != nil {
+			t.Fatalf("Expected call %d to be allowed, got %v", i+1, err)
+		}
+	}
+	if err := call("rate-limit-test-a"); err == nil || !strings.Contains(err.Error(), `rate limit exceeded for org "rate-limit-test-a"`) {
+		t.Fatalf("Expected a rate limit error naming the org, got %v", err)
+	}
+	if requests != 2 {
+		t.Errorf("Expected the refused call not to reach Loki, got %d requests", requests)
+	}
+
+	if err := call("rate-limit-test-b"); err != nil {
+		t.Errorf("Expected another org to have its own limit, got %v", err)
+	}
+}
+
+// TestInstrumentLokiTool_RateLimitPerCall verifies that a tool call is charged once, however many
+// requests it sends to Loki
+func TestInstrumentLokiTool_RateLimitPerCall(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if strings.Contains(r.URL.Query().Get("query"), "|=") {
+			w.Write([]byte(`{"status":"success","data":{"resultType":"streams","result":[{"stream":{"job":"api"},"values":[["1705312802000000000","error: db timeout"]]}]}}`))
+			return
+		}
+		w.Write([]byte(`{"status":"success","data":{"resultType":"streams","result":[]}}`))
+	}))
+	defer server.Close()
+
+	t.Setenv(EnvLokiRateLimit, "0.01")
+	t.Setenv(EnvLokiRateLimitBurst, "1")
+	if _, err := NewLokiQueryToolProtocol(); err != nil {
+		t.Fatalf("Failed to create tool: %v", err)
+	}
+	handler := InstrumentLokiTool("loki_query", HandleLokiQueryProtocol)
+	raw, _ := json.Marshal(map[string]any{"query": `{job="api"} |= "error"`, "url": server.URL, "org": "rate-limit-test-call", "format": "raw", "context": 3})
+
+	if _, err := handler(context.Background(), &protocol.CallToolRequest{Name: "loki_query", RawArguments: raw}); err != nil {
+		t.Fatalf("Expected the call to be allowed, got %v", err)
+	}
+	if requests != 3 {
+		t.Errorf("Expected the call to send 3 requests, got %d", requests)
+	}
+	if _, err := handler(context.Background(), &protocol.CallToolRequest{Name: "loki_query", RawArguments: raw}); err == nil || !strings.Contains(err.Error(), "rate limit exceeded") {
+		t.Errorf("Expected the second call to be refused, got %v", err)
+	}
+}
+
+// TestSweepLokiBuckets verifies that the buckets of idle tenants are dropped
+func TestSweepLokiBuckets(t *testing.T) {
+	lokiBucketsMu.Lock()
+	defer lokiBucketsMu.Unlock()
+	saved, savedAt := lokiBuckets, lokiBucketsAt
+	defer func() { lokiBuckets, lokiBucketsAt = saved, savedAt }()
+
+	now := time.Unix(1705312800, 0)
+	lokiBuckets = map[string]*lokiTokenBucket{}
+	for i := 0; i < lokiBucketsSweepMin; i++ {
+		lokiBuckets[fmt.Sprintf("org %d", i)] = &lokiTokenBucket{rate: 1, burst: 1, tokens: 0, last: now.Add(-time.Minute)}
+	}
+	lokiBuckets["busy"] = &lokiTokenBucket{rate: 1, burst: 1, tokens: 0, last: now}
+	lokiBucketsAt = lokiBucketsSweepMin
+
+	sweepLokiBuckets(now)
+	if len(lokiBuckets) != 1 || lokiBuckets["busy"] == nil {
+		t.Errorf("Expected only the busy bucket to be kept, got %d buckets", len(lokiBuckets))
+	}
+	if lokiBucketsAt != lokiBucketsSweepMin {
+		t.Errorf("Expected the next sweep at %d buckets, got %d", lokiBucketsSweepMin, lokiBucketsAt)
+	}
+}
@@ -0,0 +1,154 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// Environment variable name for named redaction patterns added to or replacing the built-in ones
+const EnvLokiRedactPatterns = "LOKI_REDACT_PATTERNS"
+
+// Environment variable name for the redaction patterns applied to every call
+const EnvLokiRedact = "LOKI_REDACT"
+
+// Text that replaces redacted matches
+const lokiRedactMask = "***"
+
+// lokiBuiltinRedactPatterns are the named patterns a redact list may refer to
+var lokiBuiltinRedactPatterns = map[string]string{
+	"email":       `[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`,
+	"credit_card": `\b(?:\d[ -]?){12,18}\d\b`,
+	"token":       `(?i:bearer)\s+[A-Za-z0-9._~+/=-]+|\beyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+|(?i:api[_-]?key|access[_-]?token|secret|password)\s*[=:]\s*[^\s,;&"']+`,
+	"ipv4":        `\b(?:\d{1,3}\.){3}\d{1,3}\b`,
+}
+
+// lokiRedactPatterns returns the named patterns: the built-in ones, with those of
+// LOKI_REDACT_PATTERNS added or replacing built-ins of the same name
+func lokiRedactPatterns() (map[string]string, error) {
+	patterns := make(map[string]string, len(lokiBuiltinRedactPatterns))
+	for name, pattern := range lokiBuiltinRedactPatterns {
+		patterns[name] = pattern
+	}
+
+	value := os.Getenv(EnvLokiRedactPatterns)
+	if strings.TrimSpace(value) == "" {
+		return patterns, nil
+	}
+	var custom map[string]string
+	if err := json.Unmarshal([]byte(value), &custom); err != nil {
+		return nil, fmt.Errorf("invalid %s: malformed JSON object of name to regex: %v", EnvLokiRedactPatterns, err)
+	}
+	for name, pattern := range custom {
+		if strings.TrimSpace(name) == "" {
+			return nil, fmt.Errorf("invalid %s: pattern names must not be empty", EnvLokiRedactPatterns)
+		}
+		if _, err := regexp.Compile(pattern); err != nil {
+			return nil, fmt.Errorf("invalid %s: pattern %s: %v", EnvLokiRedactPatterns, name, err)
+		}
+		patterns[name] = pattern
+	}
+	return patterns, nil
+}
+
+// lokiAlwaysRedact returns the pattern names listed in LOKI_REDACT
+func lokiAlwaysRedact() []string {
+	var names []string
+	for _, name := range strings.Split(os.Getenv(EnvLokiRedact), ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// CheckLokiRedact validates LOKI_REDACT_PATTERNS and LOKI_REDACT, returning the names of the
+// patterns applied to every call, so that a typo stops startup instead of leaking data
+func CheckLokiRedact() ([]string, error) {
+	patterns, err := lokiRedactPatterns()
+	if err != nil {
+		return nil, err
+	}
+	names := lokiAlwaysRedact()
+	for _, name := range names {
+		if _, ok := patterns[name]; !ok {
+			return nil, fmt.Errorf("invalid %s: unknown pattern %q, known patterns: %s", EnvLokiRedact, name, strings.Join(lokiRedactPatternNames(patterns), ", "))
+		}
+	}
+	return names, nil
+}
+
+// lokiRedactPatternNames returns the names of patterns in sorted order
+func lokiRedactPatternNames(patterns map[string]string) []string {
+	names := make([]string, 0, len(patterns))
+	for name := range patterns {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// compileLokiRedact combines the requested patterns and those of LOKI_REDACT into one expression,
+// or returns nil when there is nothing to redact. Each item is the name of a pattern, or else a
+// custom regular expression.
+func compileLokiRedact(requested []string) (*regexp.Regexp, error) {
+	always, err := CheckLokiRedact()
+	if err != nil {
+		return nil, err
+	}
+	patterns, err := lokiRedactPatterns()
+	if err != nil {
+		return nil, err
+	}
+
+	var parts []string
+	for _, item := range append(always, requested...) {
+		pattern, ok := patterns[item]
+		if !ok {
+			if _, err := regexp.Compile(item); err != nil {
+				return nil, fmt.Errorf("invalid redact pattern %q: not one of %s, nor a valid regex: %v", item, strings.Join(lokiRedactPatternNames(patterns), ", "), err)
+			}
+			pattern = item
+		}
+		if pattern = "(?:" + pattern + ")"; !slices.Contains(parts, pattern) {
+			parts = append(parts, pattern)
+		}
+	}
+	if len(parts) == 0 {
+		return nil, nil
+	}
+	return regexp.MustCompile(strings.Join(parts, "|")), nil
+}
+
+// redactLokiResult returns a copy of result in which every match of re in a line is replaced by
+// ***, and the number of matches replaced. Metric results have no lines and are returned as is.
+func redactLokiResult(result *LokiResult, re *regexp.Regexp) (*LokiResult, int) {
+	if re == nil || result.Metric != nil {
+		return result, 0
+	}
+
+	redacted := *result
+	redacted.Data.Result = make([]LokiEntry, len(result.Data.Result))
+	matches := 0
+	for i, entry := range result.Data.Result {
+		values := make([][]string, len(entry.Values))
+		for j, val := range entry.Values {
+			values[j] = val
+			if len(val) < 2 {
+				continue
+			}
+			if found := re.FindAllStringIndex(val[1], -1); len(found) > 0 {
+				matches += len(found)
+				line := slices.Clone(val)
+				line[1] = re.ReplaceAllLiteralString(val[1], lokiRedactMask)
+				values[j] = line
+			}
+		}
+		redacted.Data.Result[i] = LokiEntry{Stream: entry.Stream, Values: values}
+	}
+	return &redacted, matches
+}
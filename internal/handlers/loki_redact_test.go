@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ThinkInAIXYZ/go-mcp/protocol"
+)
+
+// TestCompileLokiRedact verifies the built-in patterns and custom regexes
+func TestCompileLokiRedact(t *testing.T) {
+	tests := []struct {
+		redact []string
+		line   string
+		want   string
+	}{
+		{[]string{"email"}, "login by jane.doe@example.com ok", "login by *** ok"},
+		{[]string{"credit_card"}, "card 4111 1111 1111 1111 charged", "card *** charged"},
+		{[]string{"token"}, "Authorization: Bearer abc.def-123 sent", "Authorization: *** sent"},
+		{[]string{"token"}, "retry with api_key=s3cr3t&x=1", "retry with ***&x=1"},
+		{[]string{"ipv4"}, "from 10.1.2.3 port 80", "from *** port 80"},
+		{[]string{"email", "ipv4"}, "a@b.io from 10.0.0.1", "*** from ***"},
+		{[]string{`user=\w+`}, "user=bob action=delete", "*** action=delete"},
+	}
+	for _, tt := range tests {
+		re, err := compileLokiRedact(tt.redact)
+		if err != nil {
+			t.Fatalf("compileLokiRedact(%v) failed: %v", tt.redact, err)
+		}
+		if got := re.ReplaceAllLiteralString(tt.line, lokiRedactMask); got != tt.want {
+			t.Errorf("redact %v of %q: expected %q, got %q", tt.redact, tt.line, tt.want, got)
+		}
+	}
+
+	if re, err := compileLokiRedact(nil); err != nil || re != nil {
+		t.Errorf("Expected nothing to redact, got %v, %v", re, err)
+	}
+	if _, err := compileLokiRedact([]string{"(unclosed"}); err == nil || !strings.Contains(err.Error(), "email") {
+		t.Errorf("Expected an error listing the known patterns, got %v", err)
+	}
+}
+
+// TestCheckLokiRedact verifies LOKI_REDACT_PATTERNS and LOKI_REDACT
+func TestCheckLokiRedact(t *testing.T) {
+	t.Setenv(EnvLokiRedactPatterns, `{"email":"@example\\.com","employee":"EMP-\\d+"}`)
+	t.Setenv(EnvLokiRedact, "employee, email")
+
+	names, err := CheckLokiRedact()
+	if err != nil || len(names) != 2 {
+		t.Fatalf("Expected both names, got %v, %v", names, err)
+	}
+	re, err := compileLokiRedact(nil)
+	if err != nil {
+		t.Fatalf("compileLokiRedact failed: %v", err)
+	}
+	if got := re.ReplaceAllLiteralString("EMP-42 mailed jane@example.com", lokiRedactMask); got != "*** mailed jane***" {
+		t.Errorf("Expected the overridden email pattern and always-applied patterns, got %q", got)
+	}
+
+	t.Setenv(EnvLokiRedact, "emial")
+	if _, err := CheckLokiRedact(); err == nil || !strings.Contains(err.Error(), "emial") {
+		t.Errorf("Expected unknown pattern error, got %v", err)
+	}
+
+	t.Setenv(EnvLokiRedact, "")
+	for _, value := range []string{`["email"]`, `{"bad":"(unclosed"}`, `{"":"x"}`} {
+		t.Setenv(EnvLokiRedactPatterns, value)
+		if _, err := CheckLokiRedact(); err == nil {
+			t.Errorf("Expected error for %s=%s", EnvLokiRedactPatterns, value)
+		}
+	}
+}
+
+// TestHandleLokiQueryProtocol_Redact verifies that lines are masked before lineRegex and formatting
+func TestHandleLokiQueryProtocol_Redact(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"status":"success","data":{"resultType":"streams","result":[
+			{"stream":{"job":"api"},"values":[
+				["1705312802000000000","signup jane@example.com from 10.0.0.7"],
+				["1705312801000000000","healthy"]]}]}}`))
+	}))
+	defer server.Close()
+
+	if _, err := NewLokiQueryToolProtocol(); err != nil {
+		t.Fatalf("Failed to create tool: %v", err)
+	}
+	call := func(args map[string]any) string {
+		args["query"] = `{job="api"}`
+		args["url"] = server.URL
+		args["format"] = "text"
+		raw, _ := json.Marshal(args)
+		result, err := HandleLokiQueryProtocol(context.Background(), &protocol.CallToolRequest{Name: "loki_query", RawArguments: raw})
+		if err != nil {
+			t.Fatalf("HandleLokiQueryProtocol failed: %v", err)
+		}
+		var texts []string
+		for _, content := range result.Content {
+			texts = append(texts, content.(*protocol.TextContent).Text)
+		}
+		return strings.Join(texts, "\n")
+	}
+
+	text := call(map[string]any{"redact": []string{"email", "ipv4"}})
+	if strings.Contains(text, "jane@example.com") || strings.Contains(text, "10.0.0.7") {
+		t.Errorf("Expected sensitive values masked, got %q", text)
+	}
+	for _, want := range []string{"signup *** from ***", "healthy", "redact: 2 matches masked with ***"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("Expected %q in %q", want, text)
+		}
+	}
+
+	// A lineRegex must not reveal redacted values by matching them
+	text = call(map[string]any{"redact": []string{"email"}, "lineRegex": "jane"})
+	if strings.Contains(text, "signup") {
+		t.Errorf("Expected lineRegex not to match redacted text, got %q", text)
+	}
+}
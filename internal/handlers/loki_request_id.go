@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+)
+
+// Header carrying the ID that correlates a call across clients, server logs and Loki access logs
+const RequestIDHeader = "X-Request-ID"
+
+// Longest request ID accepted from a client; longer IDs are replaced by a generated one
+const maxRequestIDLength = 128
+
+// lokiRequestIDKey is the context key holding the request ID of a call
+type lokiRequestIDKey struct{}
+
+// withLokiRequestID attaches a request ID to ctx
+func withLokiRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, lokiRequestIDKey{}, id)
+}
+
+// lokiRequestID returns the request ID attached to ctx, or an empty string
+func lokiRequestID(ctx context.Context) string {
+	id, _ := ctx.Value(lokiRequestIDKey{}).(string)
+	return id
+}
+
+// newLokiRequestID generates a random request ID
+func newLokiRequestID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// validRequestID reports whether a request ID sent by a client can be logged and forwarded as is:
+// non-empty, not too long and made of printable ASCII only
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// RequestIDHandler attaches a request ID to each request: the client's X-Request-ID when it is
+// valid, or a generated one. The ID is echoed in the X-Request-ID response header, logged with
+// every tool call made by the request and forwarded to Loki.
+func RequestIDHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID(id) {
+			id = newLokiRequestID()
+		}
+		w.Header().Set(RequestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(withLokiRequestID(r.Context(), id)))
+	})
+}
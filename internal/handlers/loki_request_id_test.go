@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/ThinkInAIXYZ/go-mcp/protocol"
+)
+
+// TestValidRequestID verifies which client-supplied IDs are kept
+func TestValidRequestID(t *testing.T) {
+	tests := map[string]bool{
+		"abc-123":                      true,
+		"4bf92f3577b34da6a3ce929d0e0e": true,
+		"":                             false,
+		"has space":                    false,
+		"line\nbreak":                  false,
+		strings.Repeat("a", 129):       false,
+	}
+	for id, want := range tests {
+		if got := validRequestID(id); got != want {
+			t.Errorf("validRequestID(%q) = %v, want %v", id, got, want)
+		}
+	}
+}
+
+// TestRequestIDHandler verifies that a client's ID is kept and echoed, and that one is generated otherwise
+func TestRequestIDHandler(t *testing.T) {
+	var seen string
+	handler := RequestIDHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = lokiRequestID(r.Context())
+	}))
+
+	req := httptest.NewRequest(http.MethodPost, "/mcp", nil)
+	req.Header.Set(RequestIDHeader, "ticket-42")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if seen != "ticket-42" || rec.Header().Get(RequestIDHeader) != "ticket-42" {
+		t.Errorf("Expected the client's ID to be used, got %q and header %q", seen, rec.Header().Get(RequestIDHeader))
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/mcp", nil)
+	req.Header.Set(RequestIDHeader, "not valid")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if !regexp.MustCompile(`^[0-9a-f]{32}$`).MatchString(seen) || rec.Header().Get(RequestIDHeader) != seen {
+		t.Errorf("Expected a generated ID, got %q and header %q", seen, rec.Header().Get(RequestIDHeader))
+	}
+}
+
+// TestInstrumentLokiTool_RequestID verifies that the request ID is forwarded to Loki and quoted in errors
+func TestInstrumentLokiTool_RequestID(t *testing.T) {
+	var forwarded []string
+	fail := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		forwarded = append(forwarded, r.Header.Get(RequestIDHeader))
+		if fail {
+			http.Error(w, "parse error", http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte(`{"status":"success","data":[{"job":"api"}]}`))
+	}))
+	defer server.Close()
+
+	t.Setenv(EnvLokiMaxRetries, "0")
+	if _, err := NewLokiSeriesToolProtocol(); err != nil {
+		t.Fatalf("Failed to create tool: %v", err)
+	}
+	handler := InstrumentLokiTool("loki_series", HandleLokiSeriesProtocol)
+	args, _ := json.Marshal(map[string]any{"match": `{job="api"}`, "url": server.URL})
+
+	ctx := withLokiRequestID(context.Background(), "ticket-42")
+	if _, err := handler(ctx, &protocol.CallToolRequest{Name: "loki_series", RawArguments: args}); err != nil {
+		t.Fatalf("Tool call failed: %v", err)
+	}
+	if len(forwarded) != 1 || forwarded[0] != "ticket-42" {
+		t.Errorf("Expected the request ID to be forwarded to Loki, got %v", forwarded)
+	}
+
+	// Without an ID from the HTTP layer, each call gets its own
+	fail = true
+	_, err := handler(context.Background(), &protocol.CallToolRequest{Name: "loki_series", RawArguments: args})
+	if err == nil || len(forwarded) != 2 || forwarded[1] == "" {
+		t.Fatalf("Expected a failed call with a generated request ID, got %v, %v", err, forwarded)
+	}
+	if !strings.Contains(err.Error(), "(request ID: "+forwarded[1]+")") {
+		t.Errorf("Expected the error to quote the request ID %s: %v", forwarded[1], err)
+	}
+}
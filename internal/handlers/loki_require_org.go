@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// Environment variable name for refusing requests that name no tenant, for multi-tenant Loki
+const EnvLokiRequireOrg = "LOKI_REQUIRE_ORG"
+
+// LokiRequireOrg reports whether LOKI_REQUIRE_ORG asks for every request to name its tenant
+func LokiRequireOrg() (bool, error) {
+	value := os.Getenv(EnvLokiRequireOrg)
+	if value == "" {
+		return false, nil
+	}
+	required, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("invalid %s: %q must be true or false", EnvLokiRequireOrg, value)
+	}
+	return required, nil
+}
+
+// requireLokiOrg reports an error when LOKI_REQUIRE_ORG is set and orgID, the tenant resolved for
+// a request to backend or to the default Loki, names no tenant once turned into the X-Scope-OrgID
+// header, as when it is blank or only separators. Without it, a multi-tenant Loki would answer for
+// whichever tenant its gateway falls back to.
+func requireLokiOrg(backend, orgID string) error {
+	required, err := LokiRequireOrg()
+	if err != nil {
+		return err
+	}
+	if !required || lokiOrgIDHeader(orgID) != "" {
+		return nil
+	}
+	if backend != "" {
+		return fmt.Errorf("no org ID for backend %q: %s is set, so pass the org argument or set %s",
+			backend, EnvLokiRequireOrg, lokiBackendEnvPrefix+lokiBackendEnvName(backend)+"_ORG_ID")
+	}
+	return fmt.Errorf("no org ID: %s is set, so pass the org argument or set a default org with %s", EnvLokiRequireOrg, EnvLokiOrgID)
+}
@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ThinkInAIXYZ/go-mcp/protocol"
+)
+
+// TestLokiRequireOrg verifies that with LOKI_REQUIRE_ORG each tool refuses a request without an
+// org before reaching Loki, and that without it the request is sent without a tenant as before
+func TestLokiRequireOrg(t *testing.T) {
+	var orgs []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		orgs = append(orgs, r.Header.Get("X-Scope-OrgID"))
+		if strings.Contains(r.URL.Path, "query_range") {
+			w.Write([]byte(`{"status":"success","data":{"resultType":"streams","result":[]}}`))
+			return
+		}
+		w.Write([]byte(`{"status":"success","data":["api"]}`))
+	}))
+	defer server.Close()
+
+	NewLokiQueryToolProtocol()
+	NewLokiLabelNamesToolProtocol()
+	NewLokiLabelValuesToolProtocol()
+	tools := map[string]struct {
+		handler func(context.Context, *protocol.CallToolRequest) (*protocol.CallToolResult, error)
+		args    map[string]any
+	}{
+		"loki_query":        {HandleLokiQueryProtocol, map[string]any{"query": `{job="api"}`}},
+		"loki_label_names":  {HandleLokiLabelNamesProtocol, map[string]any{}},
+		"loki_label_values": {HandleLokiLabelValuesProtocol, map[string]any{"label": "job"}},
+	}
+
+	call := func(name, org string) error {
+		tool := tools[name]
+		args := map[string]any{"url": server.URL}
+		for k, v := range tool.args {
+			args[k] = v
+		}
+		if org != "" {
+			args["org"] = org
+		}
+		raw, _ := json.Marshal(args)
+		_, err := tool.handler(context.Background(), &protocol.CallToolRequest{RawArguments: raw})
+		return err
+	}
+
+	for name := range tools {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv(EnvLokiOrgID, "")
+
+			t.Setenv(EnvLokiRequireOrg, "false")
+			orgs = nil
+			if err := call(name, ""); err != nil || len(orgs) != 1 || orgs[0] != "" {
+				t.Errorf("Expected a request without a tenant when not required, got %v, %q", err, orgs)
+			}
+
+			t.Setenv(EnvLokiRequireOrg, "true")
+			orgs = nil
+			err := call(name, "")
+			if err == nil || !strings.Contains(err.Error(), EnvLokiRequireOrg) {
+				t.Errorf("Expected an error naming %s, got %v", EnvLokiRequireOrg, err)
+			}
+			if len(orgs) != 0 {
+				t.Errorf("Expected no request to Loki, got %d", len(orgs))
+			}
+
+			if err := call(name, "tenant-1"); err != nil || len(orgs) != 1 || orgs[0] != "tenant-1" {
+				t.Errorf("Expected the org argument to be accepted, got %v, %q", err, orgs)
+			}
+
+			t.Setenv(EnvLokiOrgID, "tenant-2")
+			orgs = nil
+			if err := call(name, ""); err != nil || len(orgs) != 1 || orgs[0] != "tenant-2" {
+				t.Errorf("Expected the default org to be accepted, got %v, %q", err, orgs)
+			}
+		})
+	}
+}
+
+// TestRequireLokiOrgBackend verifies that the error names the variable of the backend's default org
+func TestRequireLokiOrgBackend(t *testing.T) {
+	t.Setenv(EnvLokiRequireOrg, "yes")
+	if _, err := LokiRequireOrg(); err == nil {
+		t.Error("Expected error for an invalid value")
+	}
+
+	t.Setenv(EnvLokiRequireOrg, "true")
+	err := requireLokiOrg("prod-eu", "")
+	if err == nil || !strings.Contains(err.Error(), "LOKI_BACKEND_PROD_EU_ORG_ID") {
+		t.Errorf("Expected an error naming LOKI_BACKEND_PROD_EU_ORG_ID, got %v", err)
+	}
+}
+
+// TestRequireLokiOrgBlank verifies that orgs naming no tenant in the X-Scope-OrgID header are refused
+func TestRequireLokiOrgBlank(t *testing.T) {
+	t.Setenv(EnvLokiRequireOrg, "true")
+	for _, org := range []string{"", "   ", " , ", "|", ",|,"} {
+		if err := requireLokiOrg("", org); err == nil {
+			t.Errorf("Expected org %q to be refused", org)
+		}
+	}
+	if err := requireLokiOrg("", " team-a , "); err != nil {
+		t.Errorf("Expected org with a tenant to be accepted, got %v", err)
+	}
+}
@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ThinkInAIXYZ/go-mcp/protocol"
+)
+
+// Environment variable name for the size above which query results are returned as a resource
+// link instead of inline text; unset keeps every result inline
+const EnvLokiResourceThreshold = "LOKI_RESOURCE_THRESHOLD"
+
+// Environment variable name for how long results returned as resource links can be read
+const EnvLokiResourceTTL = "LOKI_RESOURCE_TTL"
+
+// Environment variable name for the maximum number of results kept for resource links
+const EnvLokiResourceMax = "LOKI_RESOURCE_MAX"
+
+// Default time results returned as resource links can be read
+const DefaultLokiResourceTTL = 15 * time.Minute
+
+// Default maximum number of results kept for resource links
+const DefaultLokiResourceMax = 32
+
+// Scheme of the URIs of stored query results
+const lokiResultScheme = "loki-result://"
+
+// Results returned as resource links, keyed by ID. Strings are immutable, so no copies are needed.
+var lokiResults = newLokiCache(func(text string) string { return text })
+
+// lokiResourceThreshold returns the size above which results are returned as resource links, or
+// 0 when LOKI_RESOURCE_THRESHOLD is unset
+func lokiResourceThreshold() (int64, error) {
+	value := strings.TrimSpace(os.Getenv(EnvLokiResourceThreshold))
+	if value == "" {
+		return 0, nil
+	}
+	return parseLokiByteSize(EnvLokiResourceThreshold, value)
+}
+
+// resolveLokiResourceStore returns how long and how many results are kept for resource links
+func resolveLokiResourceStore() (time.Duration, int, error) {
+	ttl := DefaultLokiResourceTTL
+	if value := os.Getenv(EnvLokiResourceTTL); value != "" {
+		parsed, err := parsePositiveDuration(EnvLokiResourceTTL, value)
+		if err != nil {
+			return 0, 0, err
+		}
+		ttl = parsed
+	}
+
+	size, err := lokiLimitFromEnv(EnvLokiResourceMax, DefaultLokiResourceMax)
+	if err != nil {
+		return 0, 0, err
+	}
+	return ttl, size, nil
+}
+
+// CheckLokiResourceThreshold validates LOKI_RESOURCE_THRESHOLD so that mistakes are reported at
+// startup, and returns the threshold, 0 if results are always inline
+func CheckLokiResourceThreshold() (int64, error) {
+	return lokiResourceThreshold()
+}
+
+// CheckLokiResourceStore validates LOKI_RESOURCE_TTL and LOKI_RESOURCE_MAX so that mistakes are
+// reported at startup, and returns how long and how many linked results are kept
+func CheckLokiResourceStore() (time.Duration, int, error) {
+	return resolveLokiResourceStore()
+}
+
+// lokiResultContent returns a formatted tool result as inline text, or, when it is larger than
+// LOKI_RESOURCE_THRESHOLD, stores it and returns a link to it with a short note, so that large
+// results do not fill up the conversation
+func lokiResultContent(tool, text string) ([]protocol.Content, error) {
+	inline := []protocol.Content{&protocol.TextContent{Type: "text", Text: text}}
+	threshold, err := lokiResourceThreshold()
+	if err != nil {
+		return nil, err
+	}
+	if threshold == 0 || int64(len(text)) <= threshold {
+		return inline, nil
+	}
+
+	ttl, size, err := resolveLokiResourceStore()
+	if err != nil {
+		return nil, err
+	}
+	id := newLokiRequestID()
+	lokiResults.put(id, text, ttl, size)
+
+	uri := lokiResultScheme + id
+	summary := fmt.Sprintf("%s result of %s, more than %s allows inline; read resource %s for the full result, available for %s",
+		tool, formatByteSize(int64(len(text))), EnvLokiResourceThreshold, uri, ttl)
+	return []protocol.Content{
+		&protocol.TextContent{Type: "text", Text: summary},
+		&protocol.ResourceLink{
+			Type:        "resource_link",
+			URI:         uri,
+			Name:        tool + " result",
+			Description: fmt.Sprintf("Full %s result, %s", tool, formatByteSize(int64(len(text)))),
+			MIMEType:    "text/plain",
+		},
+	}, nil
+}
+
+// NewLokiResultResourceTemplate creates the resource template under which results returned as
+// resource links can be read
+func NewLokiResultResourceTemplate() *protocol.ResourceTemplate {
+	return &protocol.ResourceTemplate{
+		Name:        "loki_result",
+		URITemplate: lokiResultScheme + "{id}",
+		Description: fmt.Sprintf("Full result of a Loki query that was too large to return inline (see %s)", EnvLokiResourceThreshold),
+		MimeType:    "text/plain",
+	}
+}
+
+// HandleLokiResultResource returns a result stored by lokiResultContent
+func HandleLokiResultResource(ctx context.Context, request *protocol.ReadResourceRequest) (*protocol.ReadResourceResult, error) {
+	id := strings.TrimPrefix(request.URI, lokiResultScheme)
+	text, ok := lokiResults.get(id)
+	if !ok {
+		return nil, fmt.Errorf("result %s has expired or does not exist; run the query again", request.URI)
+	}
+	return &protocol.ReadResourceResult{
+		Contents: []protocol.ResourceContents{
+			&protocol.TextResourceContents{URI: request.URI, Text: text, MimeType: "text/plain"},
+		},
+	}, nil
+}
@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ThinkInAIXYZ/go-mcp/protocol"
+)
+
+// TestLokiResultContent verifies inline results below the threshold and resource links above it
+func TestLokiResultContent(t *testing.T) {
+	t.Setenv(EnvLokiResourceThreshold, "")
+	content, err := lokiResultContent("loki_query", strings.Repeat("x", 4096))
+	if err != nil || len(content) != 1 || content[0].(*protocol.TextContent).Text != strings.Repeat("x", 4096) {
+		t.Fatalf("Expected inline text without a threshold, got %v, %v", content, err)
+	}
+
+	t.Setenv(EnvLokiResourceThreshold, "1KiB")
+	content, err = lokiResultContent("loki_query", "short")
+	if err != nil || len(content) != 1 || content[0].(*protocol.TextContent).Text != "short" {
+		t.Fatalf("Expected inline text below the threshold, got %v, %v", content, err)
+	}
+
+	full := strings.Repeat("line\n", 1000)
+	content, err = lokiResultContent("loki_query", full)
+	if err != nil || len(content) != 2 {
+		t.Fatalf("Expected a note and a resource link, got %v, %v", content, err)
+	}
+	link, ok := content[1].(*protocol.ResourceLink)
+	if !ok || !strings.HasPrefix(link.URI, lokiResultScheme) || link.Type != "resource_link" {
+		t.Fatalf("Expected a resource link, got %#v", content[1])
+	}
+	if note := content[0].(*protocol.TextContent).Text; !strings.Contains(note, link.URI) {
+		t.Errorf("Expected the note to name the resource, got %q", note)
+	}
+
+	read, err := HandleLokiResultResource(context.Background(), &protocol.ReadResourceRequest{URI: link.URI})
+	if err != nil {
+		t.Fatalf("HandleLokiResultResource failed: %v", err)
+	}
+	if text := read.Contents[0].(*protocol.TextResourceContents).Text; text != full {
+		t.Errorf("Expected the full result, got %d bytes", len(text))
+	}
+
+	if _, err := HandleLokiResultResource(context.Background(), &protocol.ReadResourceRequest{URI: lokiResultScheme + "missing"}); err == nil {
+		t.Error("Expected an error for an unknown result")
+	}
+
+	t.Setenv(EnvLokiResourceThreshold, "lots")
+	if _, err := CheckLokiResourceThreshold(); err == nil {
+		t.Error("Expected an invalid threshold to be rejected")
+	}
+}
+
+// TestCheckLokiResourceStore verifies the defaults and that invalid settings are rejected
+func TestCheckLokiResourceStore(t *testing.T) {
+	t.Setenv(EnvLokiResourceTTL, "")
+	t.Setenv(EnvLokiResourceMax, "")
+	if ttl, size, err := CheckLokiResourceStore(); err != nil || ttl != DefaultLokiResourceTTL || size != DefaultLokiResourceMax {
+		t.Errorf("Expected the defaults, got %v, %d, %v", ttl, size, err)
+	}
+
+	t.Setenv(EnvLokiResourceTTL, "1h")
+	t.Setenv(EnvLokiResourceMax, "5")
+	if ttl, size, err := CheckLokiResourceStore(); err != nil || ttl != time.Hour || size != 5 {
+		t.Errorf("Expected 1h and 5, got %v, %d, %v", ttl, size, err)
+	}
+
+	for _, tc := range []struct{ ttl, max string }{{"soon", "5"}, {"0s", "5"}, {"1h", "0"}, {"1h", "many"}} {
+		t.Setenv(EnvLokiResourceTTL, tc.ttl)
+		t.Setenv(EnvLokiResourceMax, tc.max)
+		if _, _, err := CheckLokiResourceStore(); err == nil {
+			t.Errorf("Expected TTL %q and max %q to be rejected", tc.ttl, tc.max)
+		}
+	}
+}
+
+// TestHandleLokiQueryProtocol_ResourceLink verifies that a large loki_query result is linked while
+// the metadata stays inline
+func TestHandleLokiQueryProtocol_ResourceLink(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		values := make([][]string, 200)
+		for i := range values {
+			values[i] = []string{"1705312800000000000", strings.Repeat("payload ", 10)}
+		}
+		json.NewEncoder(w).Encode(&LokiResult{Status: "success", Data: LokiData{ResultType: "streams", Result: []LokiEntry{
+			{Stream: map[string]string{"job": "a"}, Values: values},
+		}}})
+	}))
+	defer server.Close()
+
+	t.Setenv(EnvLokiResourceThreshold, "4KiB")
+	if _, err := NewLokiQueryToolProtocol(); err != nil {
+		t.Fatalf("Failed to create tool: %v", err)
+	}
+	raw, _ := json.Marshal(map[string]any{"query": `{job="a"}`, "url": server.URL, "limit": 200})
+	result, err := HandleLokiQueryProtocol(context.Background(), &protocol.CallToolRequest{Name: "loki_query", RawArguments: raw})
+	if err != nil {
+		t.Fatalf("HandleLokiQueryProtocol failed: %v", err)
+	}
+
+	if len(result.Content) < 3 {
+		t.Fatalf("Expected a note, a resource link and metadata, got %d contents", len(result.Content))
+	}
+	link, ok := result.Content[1].(*protocol.ResourceLink)
+	if !ok {
+		t.Fatalf("Expected a resource link, got %#v", result.Content[1])
+	}
+	if metadata := result.Content[2].(*protocol.TextContent).Text; !strings.Contains(metadata, `"entries"`) {
+		t.Errorf("Expected the metadata to stay inline, got %q", metadata)
+	}
+
+	read, err := HandleLokiResultResource(context.Background(), &protocol.ReadResourceRequest{URI: link.URI})
+	if err != nil {
+		t.Fatalf("HandleLokiResultResource failed: %v", err)
+	}
+	if text := read.Contents[0].(*protocol.TextResourceContents).Text; strings.Count(text, "payload") != 2000 {
+		t.Errorf("Expected every line in the stored result, got %d bytes", len(text))
+	}
+}
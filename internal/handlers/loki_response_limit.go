@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Environment variable name for the largest Loki response body read, after decompression
+const EnvLokiMaxResponseBytes = "LOKI_MAX_RESPONSE_BYTES"
+
+// Default largest Loki response body read, 50 MiB
+const DefaultLokiMaxResponseBytes = 50 << 20
+
+// lokiByteUnits maps the size suffixes accepted in byte size settings to their multiplier
+var lokiByteUnits = map[string]int64{
+	"":    1,
+	"b":   1,
+	"kb":  1000,
+	"mb":  1000 * 1000,
+	"gb":  1000 * 1000 * 1000,
+	"kib": 1 << 10,
+	"mib": 1 << 20,
+	"gib": 1 << 30,
+}
+
+// lokiMaxResponseBytes returns the largest response body to read from Loki, from
+// LOKI_MAX_RESPONSE_BYTES as a number of bytes or a size such as 50MiB or 200MB
+func lokiMaxResponseBytes() (int64, error) {
+	value := strings.TrimSpace(os.Getenv(EnvLokiMaxResponseBytes))
+	if value == "" {
+		return DefaultLokiMaxResponseBytes, nil
+	}
+	return parseLokiByteSize(EnvLokiMaxResponseBytes, value)
+}
+
+// parseLokiByteSize parses the value of the named setting as a positive number of bytes or a
+// size with one of the lokiByteUnits suffixes
+func parseLokiByteSize(name, value string) (int64, error) {
+	i := strings.IndexFunc(value, func(r rune) bool { return r < '0' || r > '9' })
+	if i < 0 {
+		i = len(value)
+	}
+	n, err := strconv.ParseInt(value[:i], 10, 64)
+	unit, ok := lokiByteUnits[strings.ToLower(strings.TrimSpace(value[i:]))]
+	if err != nil || !ok || n <= 0 || n > (1<<62)/unit {
+		return 0, fmt.Errorf("invalid %s: %q must be a positive number of bytes or a size such as 50MiB or 200MB", name, value)
+	}
+	return n * unit, nil
+}
+
+// CheckLokiMaxResponseBytes validates LOKI_MAX_RESPONSE_BYTES so that mistakes are reported at startup
+func CheckLokiMaxResponseBytes() error {
+	_, err := lokiMaxResponseBytes()
+	return err
+}
+
+// LokiResponseTooLargeError reports a Loki response body larger than LOKI_MAX_RESPONSE_BYTES
+type LokiResponseTooLargeError struct {
+	Limit int64
+}
+
+func (e *LokiResponseTooLargeError) Error() string {
+	return fmt.Sprintf("loki response exceeded %d bytes (%s); narrow your query with a shorter time range, a more specific selector or a lower limit",
+		e.Limit, EnvLokiMaxResponseBytes)
+}
+
+// readLokiLimited reads r up to maxBytes. Larger responses fail without being read further, so a
+// query matching everything cannot exhaust the server's memory.
+func readLokiLimited(r io.Reader, maxBytes int64) ([]byte, error) {
+	body, err := io.ReadAll(newLokiLimitedReader(r, maxBytes))
+	if err != nil {
+		return nil, err
+	}
+	return body, nil
+}
+
+// lokiLimitedReader reads from r until more than limit bytes have been read, then fails with a
+// LokiResponseTooLargeError, so that a body decoded as it arrives is bounded like one read in full
+type lokiLimitedReader struct {
+	r         io.Reader
+	limit     int64
+	remaining int64
+}
+
+// newLokiLimitedReader returns a reader of at most maxBytes of r
+func newLokiLimitedReader(r io.Reader, maxBytes int64) *lokiLimitedReader {
+	return &lokiLimitedReader{r: r, limit: maxBytes, remaining: maxBytes}
+}
+
+func (l *lokiLimitedReader) Read(p []byte) (int, error) {
+	if l.remaining < 0 {
+		return 0, &LokiResponseTooLargeError{Limit: l.limit}
+	}
+	// Read one byte past the limit to tell a body of exactly limit bytes from a larger one
+	if int64(len(p)) > l.remaining+1 {
+		p = p[:l.remaining+1]
+	}
+	n, err := l.r.Read(p)
+	l.remaining -= int64(n)
+	if l.remaining < 0 {
+		return n + int(l.remaining), &LokiResponseTooLargeError{Limit: l.limit}
+	}
+	return n, err
+}
@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ThinkInAIXYZ/go-mcp/protocol"
+)
+
+// TestLokiMaxResponseBytes verifies the default, byte counts, size suffixes and rejection of invalid values
+func TestLokiMaxResponseBytes(t *testing.T) {
+	testCases := []struct {
+		value   string
+		want    int64
+		wantErr bool
+	}{
+		{value: "", want: DefaultLokiMaxResponseBytes},
+		{value: "1048576", want: 1 << 20},
+		{value: "50MiB", want: 50 << 20},
+		{value: "200MB", want: 200 * 1000 * 1000},
+		{value: "1 gib", want: 1 << 30},
+		{value: "512b", want: 512},
+		{value: "0", wantErr: true},
+		{value: "-5", wantErr: true},
+		{value: "10XB", wantErr: true},
+		{value: "MiB", wantErr: true},
+		{value: "99999999999GiB", wantErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.value, func(t *testing.T) {
+			t.Setenv(EnvLokiMaxResponseBytes, tc.value)
+
+			got, err := lokiMaxResponseBytes()
+			if tc.wantErr {
+				if err == nil || CheckLokiMaxResponseBytes() == nil {
+					t.Fatalf("Expected error for %q", tc.value)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("lokiMaxResponseBytes failed: %v", err)
+			}
+			if got != tc.want {
+				t.Errorf("Expected %d, got %d", tc.want, got)
+			}
+		})
+	}
+}
+
+// TestReadLokiLimited verifies that a body at the limit is read and a larger one is rejected
+func TestReadLokiLimited(t *testing.T) {
+	body, err := readLokiLimited(strings.NewReader("0123456789"), 10)
+	if err != nil || string(body) != "0123456789" {
+		t.Fatalf("Expected full body at the limit, got %q, %v", body, err)
+	}
+
+	_, err = readLokiLimited(strings.NewReader("0123456789A"), 10)
+	var tooLarge *LokiResponseTooLargeError
+	if !errors.As(err, &tooLarge) || tooLarge.Limit != 10 {
+		t.Fatalf("Expected LokiResponseTooLargeError, got %v", err)
+	}
+}
+
+// TestOpenLokiBody_GzipLimit verifies that the limit applies to the decompressed body, both when
+// reading a response directly and through a request to Loki
+func TestOpenLokiBody_GzipLimit(t *testing.T) {
+	t.Setenv(EnvLokiMaxResponseBytes, "1KiB")
+
+	var compressed bytes.Buffer
+	gz := gzip.NewWriter(&compressed)
+	gz.Write(bytes.Repeat([]byte("a"), 4096))
+	gz.Close()
+
+	resp := &http.Response{
+		Header: http.Header{"Content-Encoding": []string{"gzip"}},
+		Body:   io.NopCloser(bytes.NewReader(compressed.Bytes())),
+	}
+	r, err := openLokiBody(resp)
+	if err != nil {
+		t.Fatalf("openLokiBody failed: %v", err)
+	}
+	_, err = io.ReadAll(r)
+	var tooLarge *LokiResponseTooLargeError
+	if !errors.As(err, &tooLarge) {
+		t.Fatalf("Expected LokiResponseTooLargeError, got %v", err)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Write(compressed.Bytes())
+	}))
+	defer server.Close()
+
+	t.Setenv(EnvLokiMaxRetries, "0")
+	_, err = doLokiRequest(context.Background(), server.URL+"/loki/api/v1/labels", "", "", "", "")
+	if !errors.As(err, &tooLarge) || tooLarge.Limit != 1024 {
+		t.Fatalf("Expected LokiResponseTooLargeError through the request, got %v", err)
+	}
+}
+
+// TestHandleLokiSeriesProtocol_ResponseTooLarge verifies that an oversized Loki response fails the tool call
+func TestHandleLokiSeriesProtocol_ResponseTooLarge(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"status":"success","data":[{"job":"` + strings.Repeat("x", 4096) + `"}]}`))
+	}))
+	defer server.Close()
+
+	for _, env := range []string{EnvLokiURL, EnvLokiOrgID, EnvLokiUsername, EnvLokiPassword, EnvLokiToken} {
+		t.Setenv(env, "")
+	}
+	t.Setenv(EnvLokiMaxResponseBytes, "1KiB")
+
+	if _, err := NewLokiSeriesToolProtocol(); err != nil {
+		t.Fatalf("Failed to create tool: %v", err)
+	}
+
+	args := `{"url":"` + server.URL + `","match":"{job=\"a\"}"}`
+	_, err := HandleLokiSeriesProtocol(context.Background(), &protocol.CallToolRequest{Name: "loki_series", RawArguments: []byte(args)})
+	if err == nil || !strings.Contains(err.Error(), "exceeded 1024 bytes") {
+		t.Fatalf("Expected response size error, got %v", err)
+	}
+}
@@ -0,0 +1,216 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/ThinkInAIXYZ/go-mcp/protocol"
+)
+
+// LokiSeriesRequest represents the arguments for loki_series tool
+type LokiSeriesRequest struct {
+	Match           LokiMatchers      `json:"match" description:"One or more LogQL stream selectors, e.g. {job=\"varlogs\"}; a single string is also accepted"`
+	URL             string            `json:"url,omitempty" description:"Loki server URL"`
+	Backend         string            `json:"backend,omitempty" description:"Name of a Loki backend from LOKI_BACKENDS, e.g. prod, whose URL and credentials to use; cannot be combined with url, and an explicit credential still wins"`
+	Username        string            `json:"username,omitempty" description:"Username for basic authentication"`
+	Password        string            `json:"password,omitempty" description:"Password for basic authentication"`
+	Token           string            `json:"token,omitempty" description:"Bearer token for authentication"`
+	Start           string            `json:"start,omitempty" description:"Start time for the query"`
+	End             string            `json:"end,omitempty" description:"End time for the query"`
+	Timezone        string            `json:"timezone,omitempty" description:"IANA timezone for start and end times without a zone, e.g. America/New_York (default: LOKI_TIMEZONE or UTC)"`
+	AllowLargeRange bool              `json:"allowLargeRange,omitempty" description:"Query a time range longer than LOKI_MAX_TIME_RANGE anyway; long ranges are expensive for Loki, so only set this when a narrower range will not do (default: false)"`
+	Org             string            `json:"org,omitempty" description:"Organization ID for the query; separate several with commas to query tenants together"`
+	Headers         map[string]string `json:"headers,omitempty" description:"Extra HTTP headers to send to Loki, e.g. {\"X-Api-Key\": \"...\"}; never replaces the auth or org headers"`
+	Timeout         string            `json:"timeout,omitempty" description:"Timeout for the Loki request as a duration (e.g. 45s) or seconds (default: LOKI_QUERY_TIMEOUT or 30s)"`
+	Format          string            `json:"format,omitempty" description:"Output format: raw, json, or text"`
+}
+
+// LokiMatchers is a list of stream selectors that decodes from either a JSON string or an array of strings
+type LokiMatchers []string
+
+// UnmarshalJSON accepts "selector" as well as ["selector", ...]
+func (m *LokiMatchers) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*m = LokiMatchers{single}
+		return nil
+	}
+
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return fmt.Errorf("match must be a string or an array of strings")
+	}
+	*m = list
+	return nil
+}
+
+// LokiSeriesResult represents the structure of Loki series results
+type LokiSeriesResult struct {
+	Status string              `json:"status"`
+	Data   []map[string]string `json:"data"`
+	Error  string              `json:"error,omitempty"`
+}
+
+// NewLokiSeriesToolProtocol creates a tool using the protocol library
+func NewLokiSeriesToolProtocol() (*protocol.Tool, error) {
+	return protocol.NewTool("loki_series", "Get the label sets of all series matching one or more stream selectors from Grafana Loki", LokiSeriesRequest{})
+}
+
+// HandleLokiSeriesProtocol handles Loki series tool requests using protocol library
+func HandleLokiSeriesProtocol(ctx context.Context, request *protocol.CallToolRequest) (*protocol.CallToolResult, error) {
+	// The generated schema only describes the array form of match, so decode without
+	// schema validation and check the arguments here instead
+	req := new(LokiSeriesRequest)
+	if len(request.RawArguments) == 0 {
+		return nil, fmt.Errorf("request arguments is empty")
+	}
+	if err := json.Unmarshal(request.RawArguments, req); err != nil {
+		return nil, fmt.Errorf("invalid arguments: %v", err)
+	}
+
+	var matchers []string
+	for _, m := range req.Match {
+		if m = strings.TrimSpace(m); m != "" {
+			matchers = append(matchers, m)
+		}
+	}
+	if len(matchers) == 0 {
+		return nil, fmt.Errorf("match must contain at least one stream selector")
+	}
+
+	ctx, conn, err := resolveLokiCall(ctx, req.Backend, req.URL, req.Username, req.Password, req.Token, req.Org, req.Timeout, req.Headers)
+	if err != nil {
+		return nil, err
+	}
+	lokiURL, username, password, token, orgID := conn.URL, conn.Username, conn.Password, conn.Token, conn.OrgID
+
+	start, end, err := resolveLokiRange(req.Start, req.End, req.Timezone, req.AllowLargeRange)
+	if err != nil {
+		return nil, err
+	}
+
+	format := resolveLokiFormat(req.Format, lokiLabelFormats)
+
+	seriesURL, err := buildLokiSeriesURL(lokiURL, matchers, start, end)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build series URL: %v", err)
+	}
+
+	result, err := executeLokiSeriesQuery(ctx, seriesURL, username, password, token, orgID)
+	if err != nil {
+		return nil, fmt.Errorf("series query execution failed: %v", err)
+	}
+
+	formattedResult, err := formatLokiSeriesResults(result, format)
+	if err != nil {
+		return nil, fmt.Errorf("failed to format results: %v", err)
+	}
+
+	return &protocol.CallToolResult{
+		Content: []protocol.Content{
+			&protocol.TextContent{
+				Type: "text",
+				Text: formattedResult,
+			},
+		},
+	}, nil
+}
+
+// buildLokiSeriesURL constructs the Loki series URL with one match[] parameter per selector
+func buildLokiSeriesURL(baseURL string, matchers []string, start, end int64) (string, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return "", err
+	}
+
+	// Add path for Loki series API
+	if !strings.Contains(u.Path, "loki/api/v1") {
+		if u.Path == "" || u.Path == "/" {
+			u.Path = "/loki/api/v1/series"
+		} else {
+			u.Path = fmt.Sprintf("%s/loki/api/v1/series", u.Path)
+		}
+	} else {
+		// If path already contains loki/api/v1, just append series if not present
+		if !strings.HasSuffix(u.Path, "series") {
+			u.Path = fmt.Sprintf("%s/series", u.Path)
+		}
+	}
+
+	// Add query parameters
+	q := u.Query()
+	for _, m := range matchers {
+		q.Add("match[]", m)
+	}
+	q.Set("start", fmt.Sprintf("%d", start))
+	q.Set("end", fmt.Sprintf("%d", end))
+	u.RawQuery = q.Encode()
+
+	return u.String(), nil
+}
+
+// executeLokiSeriesQuery sends the HTTP request to Loki series endpoint
+func executeLokiSeriesQuery(ctx context.Context, queryURL string, username, password, token, orgID string) (*LokiSeriesResult, error) {
+	body, err := doLokiRequest(ctx, queryURL, username, password, token, orgID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Parse JSON response
+	var result LokiSeriesResult
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, err
+	}
+
+	// Check for Loki errors
+	if result.Status == "error" {
+		return nil, fmt.Errorf("loki error: %s", result.Error)
+	}
+
+	return &result, nil
+}
+
+// formatLokiSeriesResults formats Loki series results into a readable string
+func formatLokiSeriesResults(result *LokiSeriesResult, format string) (string, error) {
+	if len(result.Data) == 0 {
+		switch format {
+		case "json":
+			return "{\"message\": \"No series found\"}", nil
+		default:
+			return "No series found", nil
+		}
+	}
+
+	switch format {
+	case "json":
+		// Return raw JSON response
+		jsonBytes, err := json.MarshalIndent(result, "", "  ")
+		if err != nil {
+			return "", fmt.Errorf("failed to marshal JSON: %v", err)
+		}
+		return string(jsonBytes), nil
+
+	case "raw":
+		// Return one label set per line
+		var b strings.Builder
+		for _, series := range result.Data {
+			b.WriteString(formatMetricLabels(series) + "\n")
+		}
+		return b.String(), nil
+
+	case "text":
+		// Return formatted text with numbering
+		var b strings.Builder
+		fmt.Fprintf(&b, "Found %d series:\n\n", len(result.Data))
+		for i, series := range result.Data {
+			fmt.Fprintf(&b, "%d. %s\n", i+1, formatMetricLabels(series))
+		}
+		return b.String(), nil
+
+	default:
+		return "", fmt.Errorf("unsupported format: %s. Supported formats: raw, json, text", format)
+	}
+}
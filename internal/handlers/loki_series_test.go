@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/ThinkInAIXYZ/go-mcp/protocol"
+)
+
+// TestBuildLokiSeriesURL verifies that each selector is sent as a separate match[] parameter
+func TestBuildLokiSeriesURL(t *testing.T) {
+	got, err := buildLokiSeriesURL("http://localhost:3100", []string{`{job="a"}`, `{job="b"}`}, 1705312245, 1705315845)
+	if err != nil {
+		t.Fatalf("buildLokiSeriesURL failed: %v", err)
+	}
+
+	u, _ := url.Parse(got)
+	if u.Path != "/loki/api/v1/series" {
+		t.Errorf("Expected series path, got %q", u.Path)
+	}
+	matchers := u.Query()["match[]"]
+	if len(matchers) != 2 || matchers[0] != `{job="a"}` || matchers[1] != `{job="b"}` {
+		t.Errorf("Expected repeated match[] parameters, got %v", matchers)
+	}
+	if u.Query().Get("start") != "1705312245" || u.Query().Get("end") != "1705315845" {
+		t.Errorf("Unexpected time range: %s", u.RawQuery)
+	}
+}
+
+// TestHandleLokiSeriesProtocol verifies that match is accepted as a string or an array
+func TestHandleLokiSeriesProtocol(t *testing.T) {
+	var lastQuery url.Values
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lastQuery = r.URL.Query()
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"status":"success","data":[{"job":"a","host":"h1"},{"job":"b"}]}`))
+	}))
+	defer server.Close()
+
+	for _, env := range []string{EnvLokiURL, EnvLokiOrgID, EnvLokiUsername, EnvLokiPassword, EnvLokiToken} {
+		t.Setenv(env, "")
+	}
+
+	if _, err := NewLokiSeriesToolProtocol(); err != nil {
+		t.Fatalf("Failed to create tool: %v", err)
+	}
+
+	testCases := []struct {
+		name      string
+		args      string
+		wantMatch int
+		wantErr   bool
+	}{
+		{name: "Single string", args: `{"match":"{job=\"a\"}","format":"text"}`, wantMatch: 1},
+		{name: "Array", args: `{"match":["{job=\"a\"}","{job=\"b\"}"],"format":"text"}`, wantMatch: 2},
+		{name: "Missing match", args: `{"format":"text"}`, wantErr: true},
+		{name: "Empty array", args: `{"match":[]}`, wantErr: true},
+		{name: "Wrong type", args: `{"match":42}`, wantErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			args := strings.Replace(tc.args, "{", `{"url":"`+server.URL+`",`, 1)
+			result, err := HandleLokiSeriesProtocol(context.Background(), &protocol.CallToolRequest{Name: "loki_series", RawArguments: []byte(args)})
+			if tc.wantErr {
+				if err == nil {
+					t.Errorf("Expected error for %s", tc.args)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("HandleLokiSeriesProtocol failed: %v", err)
+			}
+			if got := len(lastQuery["match[]"]); got != tc.wantMatch {
+				t.Errorf("Expected %d match[] parameters, got %d", tc.wantMatch, got)
+			}
+			output := result.Content[0].(*protocol.TextContent).Text
+			if !strings.Contains(output, "Found 2 series") || !strings.Contains(output, `{host="h1", job="a"}`) {
+				t.Errorf("Unexpected output:\n%s", output)
+			}
+		})
+	}
+}
@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"net/http"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// Environment variable name for how long shutdown waits for in-flight requests to finish
+const EnvShutdownTimeout = "SHUTDOWN_TIMEOUT"
+
+// Default time shutdown waits for in-flight requests to finish
+const DefaultShutdownTimeout = 15 * time.Second
+
+// ShutdownTimeout returns how long shutdown waits for in-flight requests, from SHUTDOWN_TIMEOUT
+func ShutdownTimeout() (time.Duration, error) {
+	value := os.Getenv(EnvShutdownTimeout)
+	if value == "" {
+		return DefaultShutdownTimeout, nil
+	}
+
+	return parsePositiveDuration(EnvShutdownTimeout, value)
+}
+
+// InFlightRequests counts the HTTP requests being served so that shutdown can report how many it drained
+type InFlightRequests struct {
+	active atomic.Int64
+}
+
+// Track wraps next so that its requests are counted while they are served
+func (f *InFlightRequests) Track(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f.active.Add(1)
+		defer f.active.Add(-1)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Active returns the number of requests currently being served
+func (f *InFlightRequests) Active() int64 {
+	return f.active.Load()
+}
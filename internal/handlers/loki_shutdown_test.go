@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestShutdownTimeout verifies the default, a configured value and rejection of invalid values
+func TestShutdownTimeout(t *testing.T) {
+	t.Setenv(EnvShutdownTimeout, "")
+	if got, err := ShutdownTimeout(); err != nil || got != DefaultShutdownTimeout {
+		t.Errorf("Expected the default %s, got %s (%v)", DefaultShutdownTimeout, got, err)
+	}
+
+	t.Setenv(EnvShutdownTimeout, "45s")
+	if got, err := ShutdownTimeout(); err != nil || got != 45*time.Second {
+		t.Errorf("Expected 45s, got %s (%v)", got, err)
+	}
+
+	// Plain numbers are seconds, as for the other duration settings
+	t.Setenv(EnvShutdownTimeout, "15")
+	if got, err := ShutdownTimeout(); err != nil || got != 15*time.Second {
+		t.Errorf("Expected 15s, got %s (%v)", got, err)
+	}
+
+	for _, value := range []string{"0", "-5s", "0s", "soon"} {
+		t.Setenv(EnvShutdownTimeout, value)
+		if _, err := ShutdownTimeout(); err == nil {
+			t.Errorf("Expected an error for %q", value)
+		}
+	}
+}
+
+// TestInFlightRequests verifies that requests are counted only while they are served
+func TestInFlightRequests(t *testing.T) {
+	var inFlight InFlightRequests
+	started := make(chan struct{})
+	release := make(chan struct{})
+	handler := inFlight.Track(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+	}))
+
+	done := make(chan struct{})
+	go func() {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/mcp", nil))
+		close(done)
+	}()
+
+	<-started
+	if got := inFlight.Active(); got != 1 {
+		t.Errorf("Expected 1 request in flight, got %d", got)
+	}
+	close(release)
+	<-done
+	if got := inFlight.Active(); got != 0 {
+		t.Errorf("Expected no requests in flight, got %d", got)
+	}
+}
@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// signatureReplacements are applied in order to turn a log line into its signature.
+// More specific patterns (UUIDs, timestamps) must run before the generic number pattern.
+var signatureReplacements = []struct {
+	pattern     *regexp.Regexp
+	replacement string
+}{
+	{regexp.MustCompile(`(?i)\b[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}\b`), "<uuid>"},
+	{regexp.MustCompile(`\d{4}-\d{2}-\d{2}[T ]\d{2}:\d{2}:\d{2}(\.\d+)?(Z|[+-]\d{2}:?\d{2})?`), "<ts>"},
+	{regexp.MustCompile(`\b\d{1,3}\.\d{1,3}\.\d{1,3}\.\d{1,3}(:\d+)?\b`), "<ip>"},
+	{regexp.MustCompile(`(?i)\b0x[0-9a-f]+\b`), "<hex>"},
+	{regexp.MustCompile(`(?i)\b[0-9a-f]{8,}\b`), "<hex>"},
+	{regexp.MustCompile(`\d+(\.\d+)?`), "<num>"},
+}
+
+// LogSignature represents a group of log lines sharing the same normalized signature
+type LogSignature struct {
+	Signature string `json:"signature"`
+	Count     int    `json:"count"`
+	Example   string `json:"example"`
+}
+
+// normalizeLogSignature strips variable parts (numbers, UUIDs, timestamps, addresses)
+// from a log line so that similar lines produce the same signature
+func normalizeLogSignature(line string) string {
+	signature := line
+	for _, r := range signatureReplacements {
+		signature = r.pattern.ReplaceAllStringFunc(signature, func(match string) string {
+			// Long runs of plain digits are numbers, not hex identifiers
+			if r.replacement == "<hex>" && strings.Trim(match, "0123456789") == "" {
+				return "<num>"
+			}
+			return r.replacement
+		})
+	}
+	return strings.Join(strings.Fields(signature), " ")
+}
+
+// groupBySignature clusters all log lines in the result by their normalized signature,
+// ordered by descending count
+func groupBySignature(result *LokiResult) []LogSignature {
+	index := make(map[string]int)
+	var signatures []LogSignature
+
+	for _, entry := range result.Data.Result {
+		for _, val := range entry.Values {
+			if len(val) < 2 {
+				continue
+			}
+			signature := normalizeLogSignature(val[1])
+			if i, ok := index[signature]; ok {
+				signatures[i].Count++
+				continue
+			}
+			index[signature] = len(signatures)
+			signatures = append(signatures, LogSignature{
+				Signature: signature,
+				Count:     1,
+				Example:   val[1],
+			})
+		}
+	}
+
+	sort.SliceStable(signatures, func(i, j int) bool {
+		return signatures[i].Count > signatures[j].Count
+	})
+
+	return signatures
+}
+
+// formatLokiSignatures formats the Loki query results grouped by error signature
+func formatLokiSignatures(result *LokiResult) string {
+	signatures := groupBySignature(result)
+
+	total := 0
+	for _, s := range signatures {
+		total += s.Count
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Found %d signatures across %d entries:\n\n", len(signatures), total)
+	for _, s := range signatures {
+		fmt.Fprintf(&b, "[%d] %s\n", s.Count, s.Signature)
+		fmt.Fprintf(&b, "    e.g. %s\n", s.Example)
+	}
+	return b.String()
+}
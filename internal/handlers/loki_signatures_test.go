@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestNormalizeLogSignature verifies that variable parts of a line are replaced with placeholders
+func TestNormalizeLogSignature(t *testing.T) {
+	testCases := []struct {
+		name     string
+		line     string
+		expected string
+	}{
+		{
+			name:     "Numbers",
+			line:     "user 123 failed after 45.6ms",
+			expected: "user <num> failed after <num>ms",
+		},
+		{
+			name:     "UUID",
+			line:     "request 3f2b8c1e-9d4a-4e7b-8a51-2c6f0e9d1b37 failed",
+			expected: "request <uuid> failed",
+		},
+		{
+			name:     "Timestamp",
+			line:     "job started at 2024-01-15T10:30:45.123Z and crashed",
+			expected: "job started at <ts> and crashed",
+		},
+		{
+			name:     "IP address",
+			line:     "connection refused from 10.0.12.7:5432",
+			expected: "connection refused from <ip>",
+		},
+		{
+			name:     "Hex identifier",
+			line:     "trace 4bf92f3577b34da6a3ce929d0e0e4736 dropped",
+			expected: "trace <hex> dropped",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := normalizeLogSignature(tc.line)
+			if got != tc.expected {
+				t.Errorf("normalizeLogSignature(%q) = %q, expected %q", tc.line, got, tc.expected)
+			}
+		})
+	}
+}
+
+// TestGroupBySignature_CollapsesSimilarLines verifies that lines differing only in
+// variable parts collapse into a single signature with the correct count
+func TestGroupBySignature_CollapsesSimilarLines(t *testing.T) {
+	result := &LokiResult{
+		Status: "success",
+		Data: LokiData{
+			ResultType: "streams",
+			Result: []LokiEntry{
+				{
+					Stream: map[string]string{"job": "api"},
+					Values: [][]string{
+						{"1705312245000000000", "ERROR user 17 not found (request 3f2b8c1e-9d4a-4e7b-8a51-2c6f0e9d1b37)"},
+						{"1705312246000000000", "ERROR user 42 not found (request 7a1d0c2e-1b3f-4c5d-9e8f-0a1b2c3d4e5f)"},
+						{"1705312247000000000", "ERROR database timeout after 30s"},
+					},
+				},
+				{
+					Stream: map[string]string{"job": "worker"},
+					Values: [][]string{
+						{"1705312248000000000", "ERROR user 99 not found (request 00000000-0000-4000-8000-000000000000)"},
+					},
+				},
+			},
+		},
+	}
+
+	signatures := groupBySignature(result)
+	if len(signatures) != 2 {
+		t.Fatalf("Expected 2 signatures, got %d: %+v", len(signatures), signatures)
+	}
+
+	if signatures[0].Count != 3 {
+		t.Errorf("Expected most frequent signature to have count 3, got %d", signatures[0].Count)
+	}
+	if signatures[0].Signature != "ERROR user <num> not found (request <uuid>)" {
+		t.Errorf("Unexpected signature: %q", signatures[0].Signature)
+	}
+	if !strings.Contains(signatures[0].Example, "user 17") {
+		t.Errorf("Expected example to be the first occurrence, got %q", signatures[0].Example)
+	}
+	if signatures[1].Count != 1 {
+		t.Errorf("Expected second signature to have count 1, got %d", signatures[1].Count)
+	}
+}
+
+// TestFormatLokiResults_Signatures verifies the signatures output format
+func TestFormatLokiResults_Signatures(t *testing.T) {
+	result := &LokiResult{
+		Status: "success",
+		Data: LokiData{
+			ResultType: "streams",
+			Result: []LokiEntry{
+				{
+					Stream: map[string]string{"job": "api"},
+					Values: [][]string{
+						{"1705312245000000000", "retry 1 of 5"},
+						{"1705312246000000000", "retry 2 of 5"},
+					},
+				},
+			},
+		},
+	}
+
+	output, err := formatLokiResults(result, "signatures")
+	if err != nil {
+		t.Fatalf("formatLokiResults failed: %v", err)
+	}
+
+	if !strings.Contains(output, "Found 1 signatures across 2 entries") {
+		t.Errorf("Expected summary line in output, got:\n%s", output)
+	}
+	if !strings.Contains(output, "[2] retry <num> of <num>") {
+		t.Errorf("Expected grouped signature in output, got:\n%s", output)
+	}
+	if !strings.Contains(output, "e.g. retry 1 of 5") {
+		t.Errorf("Expected example line in output, got:\n%s", output)
+	}
+}
@@ -0,0 +1,41 @@
+package handlers
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// applyLokiSinceToken returns the range (Unix ns) and direction of a call that continues from a
+// sinceToken: from just after the last entry seen up to now, read oldest first so that a result
+// cut off by the limit leaves no gap before the next call
+func applyLokiSinceToken(token, start, end, cursor, direction string, now int64) (int64, int64, string, error) {
+	if start != "" || end != "" || cursor != "" {
+		return 0, 0, "", fmt.Errorf("sinceToken cannot be combined with start, end or cursor")
+	}
+	if direction == "backward" {
+		return 0, 0, "", fmt.Errorf("sinceToken reads entries oldest first and cannot be combined with direction backward")
+	}
+
+	ts, err := strconv.ParseInt(strings.TrimSpace(token), 10, 64)
+	if err != nil || ts < 0 {
+		return 0, 0, "", fmt.Errorf("invalid sinceToken: %q, pass the sinceToken returned by the previous call unchanged", token)
+	}
+	if ts >= now {
+		return 0, 0, "", fmt.Errorf("invalid sinceToken: %q lies in the future", token)
+	}
+	return ts + 1, now, "forward", nil
+}
+
+// nextLokiSinceToken returns the sinceToken for the call after result: the newest entry returned,
+// or, when nothing was returned, the end of the range (Unix ns) so that the next call starts there.
+// Metric results have no entries to continue from, so their token is empty.
+func nextLokiSinceToken(result *LokiResult, end int64) string {
+	if result.Data.ResultType != "" && result.Data.ResultType != "streams" {
+		return ""
+	}
+	if newest, ok := lokiBoundaryTimestamp(result, true); ok {
+		return strconv.FormatInt(newest, 10)
+	}
+	return strconv.FormatInt(end-1, 10)
+}
@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/ThinkInAIXYZ/go-mcp/protocol"
+)
+
+// TestApplyLokiSinceToken verifies the range after a token and the arguments it cannot be combined with
+func TestApplyLokiSinceToken(t *testing.T) {
+	const now = int64(1705312800000000000)
+
+	start, end, direction, err := applyLokiSinceToken("1705312700000000000", "", "", "", "", now)
+	if err != nil || start != 1705312700000000001 || end != now || direction != "forward" {
+		t.Errorf("Expected (1705312700000000001, %d, forward), got (%d, %d, %s, %v)", now, start, end, direction, err)
+	}
+
+	tests := []struct {
+		name                                 string
+		token, start, end, cursor, direction string
+	}{
+		{name: "With start", token: "1", start: "-1h"},
+		{name: "With end", token: "1", end: "now"},
+		{name: "With cursor", token: "1", cursor: "forward:1"},
+		{name: "Backward", token: "1", direction: "backward"},
+		{name: "Not a number", token: "yesterday"},
+		{name: "Negative", token: "-5"},
+		{name: "Future", token: strconv.FormatInt(now, 10)},
+	}
+	for _, tt := range tests {
+		if _, _, _, err := applyLokiSinceToken(tt.token, tt.start, tt.end, tt.cursor, tt.direction, now); err == nil {
+			t.Errorf("%s: expected an error", tt.name)
+		}
+	}
+}
+
+// TestNextLokiSinceToken verifies that the token advances to the newest entry or to the end of an empty range
+func TestNextLokiSinceToken(t *testing.T) {
+	result := &LokiResult{Data: LokiData{ResultType: "streams", Result: []LokiEntry{
+		{Values: [][]string{{"300", "a"}, {"100", "b"}}},
+		{Values: [][]string{{"500", "c"}}},
+	}}}
+	if got := nextLokiSinceToken(result, 1000); got != "500" {
+		t.Errorf("Expected the newest entry, got %q", got)
+	}
+	if got := nextLokiSinceToken(&LokiResult{Data: LokiData{ResultType: "streams"}}, 1000); got != "999" {
+		t.Errorf("Expected the end of the range, got %q", got)
+	}
+	if got := nextLokiSinceToken(&LokiResult{Data: LokiData{ResultType: "matrix"}}, 1000); got != "" {
+		t.Errorf("Expected no token for metric results, got %q", got)
+	}
+}
+
+// TestHandleLokiQueryProtocol_SinceToken verifies that a call with a sinceToken asks Loki for the
+// entries after it, oldest first, and returns the token for the next call
+func TestHandleLokiQueryProtocol_SinceToken(t *testing.T) {
+	var query map[string]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = map[string]string{}
+		for name := range r.URL.Query() {
+			query[name] = r.URL.Query().Get(name)
+		}
+		w.Write([]byte(`{"status":"success","data":{"resultType":"streams","result":[{"stream":{"job":"a"},"values":[["1705312750000000000","error again"]]}]}}`))
+	}))
+	defer server.Close()
+
+	if _, err := NewLokiQueryToolProtocol(); err != nil {
+		t.Fatalf("Failed to create tool: %v", err)
+	}
+	raw, _ := json.Marshal(map[string]any{"query": `{job="a"} |= "error"`, "url": server.URL, "sinceToken": "1705312700000000000"})
+	result, err := HandleLokiQueryProtocol(context.Background(), &protocol.CallToolRequest{Name: "loki_query", RawArguments: raw})
+	if err != nil {
+		t.Fatalf("HandleLokiQueryProtocol failed: %v", err)
+	}
+
+	if query["start"] != "1705312700000000001" || query["direction"] != "forward" {
+		t.Errorf("Expected the range to start after the token, oldest first, got %v", query)
+	}
+	var metadata LokiQueryMetadata
+	if err := json.Unmarshal([]byte(result.Content[1].(*protocol.TextContent).Text), &metadata); err != nil {
+		t.Fatalf("Expected metadata to be JSON: %v", err)
+	}
+	if metadata.SinceToken != "1705312750000000000" {
+		t.Errorf("Expected the token of the newest entry, got %q", metadata.SinceToken)
+	}
+}
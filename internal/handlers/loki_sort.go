@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// lokiSortOrders lists the accepted values of the loki_query sort argument
+var lokiSortOrders = []string{"time_desc", "time_asc", "none"}
+
+// Default order of loki_query results, newest first as in most log viewers
+const DefaultLokiSort = "time_desc"
+
+// lokiSortFormats lists the formats that show one line per entry and can therefore interleave
+// streams; the others group lines per stream or must stay faithful to Loki's data
+var lokiSortFormats = []string{"raw", "text", "color", "markdown"}
+
+// resolveLokiSort returns the effective sort order for a query. Without an explicit order,
+// outputs that cannot interleave streams keep Loki's order instead of failing.
+func resolveLokiSort(order, format string, fields []string, summarize bool) (string, error) {
+	supported := len(fields) == 0 && !summarize && slices.Contains(lokiSortFormats, format)
+	if order == "" {
+		if !supported {
+			return "none", nil
+		}
+		return DefaultLokiSort, nil
+	}
+	if !slices.Contains(lokiSortOrders, order) {
+		return "", fmt.Errorf("invalid sort: %s, supported orders: %s", order, strings.Join(lokiSortOrders, ", "))
+	}
+	if order != "none" && !supported {
+		return "", fmt.Errorf("sort %s is only supported with the %s formats, without fields or summarize", order, strings.Join(lokiSortFormats, ", "))
+	}
+	return order, nil
+}
+
+// sortLokiResult returns a copy of result with the entries of all streams merged and ordered by
+// timestamp. The sort is stable, so entries with the same timestamp keep Loki's stream order, and
+// consecutive entries of a stream stay together as one stream of the copy.
+func sortLokiResult(result *LokiResult, order string) *LokiResult {
+	if order == "none" || len(result.Data.Result) < 2 {
+		return result
+	}
+
+	type lokiSortEntry struct {
+		stream int
+		ts     int64
+		value  []string
+	}
+	var entries []lokiSortEntry
+	for i, entry := range result.Data.Result {
+		for _, val := range entry.Values {
+			var ts int64
+			if len(val) > 0 {
+				ts, _ = strconv.ParseInt(val[0], 10, 64)
+			}
+			entries = append(entries, lokiSortEntry{stream: i, ts: ts, value: val})
+		}
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		if order == "time_asc" {
+			return entries[i].ts < entries[j].ts
+		}
+		return entries[i].ts > entries[j].ts
+	})
+
+	sorted := *result
+	sorted.Data.Result = nil
+	for i, entry := range entries {
+		if i == 0 || entries[i-1].stream != entry.stream {
+			sorted.Data.Result = append(sorted.Data.Result, LokiEntry{Stream: result.Data.Result[entry.stream].Stream})
+		}
+		last := &sorted.Data.Result[len(sorted.Data.Result)-1]
+		last.Values = append(last.Values, entry.value)
+	}
+	return &sorted
+}
@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ThinkInAIXYZ/go-mcp/protocol"
+)
+
+// sortTestResult holds two streams whose entries interleave in time
+func sortTestResult() *LokiResult {
+	return &LokiResult{Status: "success", Data: LokiData{ResultType: "streams", Result: []LokiEntry{
+		{Stream: map[string]string{"app": "api"}, Values: [][]string{{"400", "api 4"}, {"300", "api 3"}, {"100", "api 1"}}},
+		{Stream: map[string]string{"app": "web"}, Values: [][]string{{"300", "web 3"}, {"200", "web 2"}}},
+	}}}
+}
+
+// TestSortLokiResult verifies the global order and that ties keep the stream order
+func TestSortLokiResult(t *testing.T) {
+	tests := map[string][]string{
+		"time_desc": {"api 4", "api 3", "web 3", "web 2", "api 1"},
+		"time_asc":  {"api 1", "web 2", "api 3", "web 3", "api 4"},
+		"none":      {"api 4", "api 3", "api 1", "web 3", "web 2"},
+	}
+	for order, want := range tests {
+		result := sortTestResult()
+		sorted := sortLokiResult(result, order)
+
+		var lines []string
+		for _, entry := range sorted.Data.Result {
+			for _, val := range entry.Values {
+				lines = append(lines, val[1])
+			}
+		}
+		if strings.Join(lines, ",") != strings.Join(want, ",") {
+			t.Errorf("%s: expected %v, got %v", order, want, lines)
+		}
+		if len(result.Data.Result[0].Values) != 3 {
+			t.Errorf("%s: expected the original result to be left unchanged", order)
+		}
+	}
+
+	// Consecutive entries of a stream stay in one stream
+	if sorted := sortLokiResult(sortTestResult(), "time_desc"); len(sorted.Data.Result) != 3 {
+		t.Errorf("Expected 3 stream runs, got %d", len(sorted.Data.Result))
+	}
+}
+
+// TestResolveLokiSort verifies defaults and the outputs that cannot be sorted
+func TestResolveLokiSort(t *testing.T) {
+	tests := []struct {
+		order, format string
+		fields        []string
+		summarize     bool
+		want          string
+		wantErr       bool
+	}{
+		{"", "raw", nil, false, "time_desc", false},
+		{"time_asc", "text", nil, false, "time_asc", false},
+		{"", "json", nil, false, "none", false},
+		{"", "raw", []string{"msg"}, false, "none", false},
+		{"none", "push", nil, false, "none", false},
+		{"time_asc", "push", nil, false, "", true},
+		{"time_desc", "raw", nil, true, "", true},
+		{"newest", "raw", nil, false, "", true},
+	}
+	for _, tt := range tests {
+		got, err := resolveLokiSort(tt.order, tt.format, tt.fields, tt.summarize)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("resolveLokiSort(%q, %q, %v, %v) = %q, %v", tt.order, tt.format, tt.fields, tt.summarize, got, err)
+		}
+	}
+}
+
+// TestHandleLokiQueryProtocol_Sort verifies that text output interleaves streams under stable numbers
+func TestHandleLokiQueryProtocol_Sort(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(sortTestResult())
+	}))
+	defer server.Close()
+
+	if _, err := NewLokiQueryToolProtocol(); err != nil {
+		t.Fatalf("Failed to create tool: %v", err)
+	}
+	raw, _ := json.Marshal(map[string]any{"query": `{app=~".+"}`, "url": server.URL, "format": "text", "sort": "time_asc"})
+	result, err := HandleLokiQueryProtocol(context.Background(), &protocol.CallToolRequest{Name: "loki_query", RawArguments: raw})
+	if err != nil {
+		t.Fatalf("HandleLokiQueryProtocol failed: %v", err)
+	}
+
+	text := result.Content[0].(*protocol.TextContent).Text
+	if !strings.HasPrefix(text, "Found 2 streams:") || strings.Count(text, "Stream (app=api) 1:") != 3 || strings.Count(text, "Stream (app=web) 2:") != 2 {
+		t.Errorf("Unexpected output:\n%s", text)
+	}
+	if strings.Index(text, "api 1") > strings.Index(text, "web 2") {
+		t.Errorf("Expected the oldest line first:\n%s", text)
+	}
+}
@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Environment variable name for checking at startup whether Loki's /ready endpoint responds
+const EnvLokiStartupProbe = "LOKI_STARTUP_PROBE"
+
+// Maximum time the startup probe waits for Loki's /ready endpoint
+const lokiStartupProbeTimeout = 5 * time.Second
+
+// validateLokiURL reports an error unless raw is an absolute http or https URL with a host
+func validateLokiURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return fmt.Errorf("%q is not a valid URL: %v", redactLokiURL(raw), err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("%q must use http or https, e.g. http://loki:3100", redactLokiURL(raw))
+	}
+	if u.Host == "" {
+		return fmt.Errorf("%q has no host, e.g. http://loki:3100", redactLokiURL(raw))
+	}
+	return nil
+}
+
+// CheckLokiURL validates the default Loki URL from LOKI_URL, LOKI_URLS, LOKI_DEFAULTS or
+// DefaultLokiURL so that a malformed value stops startup instead of failing the first query. It
+// returns the URL with credentials removed, for logging.
+func CheckLokiURL() (string, error) {
+	lokiURL := lokiDefaultURL()
+	if err := validateLokiURL(lokiURL); err != nil {
+		return "", fmt.Errorf("invalid %s: %v", EnvLokiURL, err)
+	}
+	return redactLokiURL(lokiURL), nil
+}
+
+// LokiStartupProbeEnabled reports whether LOKI_STARTUP_PROBE asks for a startup check of Loki
+func LokiStartupProbeEnabled() (bool, error) {
+	value := os.Getenv(EnvLokiStartupProbe)
+	if value == "" {
+		return false, nil
+	}
+	enabled, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("invalid %s: %q must be true or false", EnvLokiStartupProbe, value)
+	}
+	return enabled, nil
+}
+
+// ProbeLoki checks once whether the default Loki answers its /ready endpoint. The result is meant
+// to be logged; an unreachable Loki does not stop startup, since it may come up later.
+func ProbeLoki(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, lokiStartupProbeTimeout)
+	defer cancel()
+	return checkLokiReady(ctx)
+}
@@ -0,0 +1,196 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/ThinkInAIXYZ/go-mcp/protocol"
+)
+
+// LokiStatsRequest represents the arguments for loki_stats tool
+type LokiStatsRequest struct {
+	Query           string            `json:"query" description:"LogQL stream selector to estimate, e.g. {job=\"varlogs\"}"`
+	URL             string            `json:"url,omitempty" description:"Loki server URL"`
+	Backend         string            `json:"backend,omitempty" description:"Name of a Loki backend from LOKI_BACKENDS, e.g. prod, whose URL and credentials to use; cannot be combined with url, and an explicit credential still wins"`
+	Username        string            `json:"username,omitempty" description:"Username for basic authentication"`
+	Password        string            `json:"password,omitempty" description:"Password for basic authentication"`
+	Token           string            `json:"token,omitempty" description:"Bearer token for authentication"`
+	Start           string            `json:"start,omitempty" description:"Start time for the query"`
+	End             string            `json:"end,omitempty" description:"End time for the query"`
+	Timezone        string            `json:"timezone,omitempty" description:"IANA timezone for start and end times without a zone, e.g. America/New_York (default: LOKI_TIMEZONE or UTC)"`
+	AllowLargeRange bool              `json:"allowLargeRange,omitempty" description:"Query a time range longer than LOKI_MAX_TIME_RANGE anyway; long ranges are expensive for Loki, so only set this when a narrower range will not do (default: false)"`
+	Org             string            `json:"org,omitempty" description:"Organization ID for the query; separate several with commas to query tenants together"`
+	Headers         map[string]string `json:"headers,omitempty" description:"Extra HTTP headers to send to Loki, e.g. {\"X-Api-Key\": \"...\"}; never replaces the auth or org headers"`
+	Timeout         string            `json:"timeout,omitempty" description:"Timeout for the Loki request as a duration (e.g. 45s) or seconds (default: LOKI_QUERY_TIMEOUT or 30s)"`
+	Format          string            `json:"format,omitempty" description:"Output format: raw, json, or text"`
+}
+
+// LokiStatsResult represents the structure of Loki index stats results
+type LokiStatsResult struct {
+	Streams int64 `json:"streams"`
+	Chunks  int64 `json:"chunks"`
+	Entries int64 `json:"entries"`
+	Bytes   int64 `json:"bytes"`
+}
+
+// NewLokiStatsToolProtocol creates a tool using the protocol library
+func NewLokiStatsToolProtocol() (*protocol.Tool, error) {
+	return protocol.NewTool("loki_stats", "Get the number of streams, chunks, entries and bytes a stream selector matches in Grafana Loki, to estimate the cost of a query before running it", LokiStatsRequest{})
+}
+
+// HandleLokiStatsProtocol handles Loki index stats tool requests using protocol library
+func HandleLokiStatsProtocol(ctx context.Context, request *protocol.CallToolRequest) (*protocol.CallToolResult, error) {
+	req := new(LokiStatsRequest)
+	if err := protocol.VerifyAndUnmarshal(request.RawArguments, req); err != nil {
+		return nil, err
+	}
+
+	if err := validateLogQL(req.Query); err != nil {
+		return nil, err
+	}
+
+	ctx, conn, err := resolveLokiCall(ctx, req.Backend, req.URL, req.Username, req.Password, req.Token, req.Org, req.Timeout, req.Headers)
+	if err != nil {
+		return nil, err
+	}
+	lokiURL, username, password, token, orgID := conn.URL, conn.Username, conn.Password, conn.Token, conn.OrgID
+
+	// Fail with a readable error when Loki is known to be too old for the endpoint
+	if err := checkLokiVersion(ctx, conn, "loki_stats", lokiIndexStatsVersion); err != nil {
+		return nil, err
+	}
+
+	start, end, err := resolveLokiRange(req.Start, req.End, req.Timezone, req.AllowLargeRange)
+	if err != nil {
+		return nil, err
+	}
+
+	format := resolveLokiFormat(req.Format, lokiLabelFormats)
+
+	statsURL, err := buildLokiStatsURL(lokiURL, req.Query, start, end)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build stats URL: %v", err)
+	}
+
+	result, err := executeLokiStatsQuery(ctx, statsURL, username, password, token, orgID)
+	if err != nil {
+		return nil, fmt.Errorf("stats query execution failed: %v", err)
+	}
+
+	formattedResult, err := formatLokiStatsResults(result, format)
+	if err != nil {
+		return nil, fmt.Errorf("failed to format results: %v", err)
+	}
+
+	return &protocol.CallToolResult{
+		Content: []protocol.Content{
+			&protocol.TextContent{
+				Type: "text",
+				Text: formattedResult,
+			},
+		},
+	}, nil
+}
+
+// buildLokiStatsURL constructs the Loki index stats URL
+func buildLokiStatsURL(baseURL, query string, start, end int64) (string, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return "", err
+	}
+
+	// Add path for Loki index stats API
+	if !strings.Contains(u.Path, "loki/api/v1") {
+		if u.Path == "" || u.Path == "/" {
+			u.Path = "/loki/api/v1/index/stats"
+		} else {
+			u.Path = fmt.Sprintf("%s/loki/api/v1/index/stats", u.Path)
+		}
+	} else {
+		// If path already contains loki/api/v1, just append index/stats if not present
+		if !strings.HasSuffix(u.Path, "index/stats") {
+			u.Path = fmt.Sprintf("%s/index/stats", u.Path)
+		}
+	}
+
+	// Add query parameters
+	q := u.Query()
+	q.Set("query", query)
+	q.Set("start", fmt.Sprintf("%d", start))
+	q.Set("end", fmt.Sprintf("%d", end))
+	u.RawQuery = q.Encode()
+
+	return u.String(), nil
+}
+
+// executeLokiStatsQuery sends the HTTP request to Loki index stats endpoint. Unlike the other
+// endpoints, the response is the bare counters without a status envelope. Loki versions before
+// 2.8 do not have the endpoint and answer 404, which is reported as such.
+func executeLokiStatsQuery(ctx context.Context, queryURL string, username, password, token, orgID string) (*LokiStatsResult, error) {
+	body, err := doLokiRequest(ctx, queryURL, username, password, token, orgID)
+	if err != nil {
+		var httpErr *LokiHTTPError
+		if errors.As(err, &httpErr) && httpErr.StatusCode == http.StatusNotFound {
+			return nil, fmt.Errorf("endpoint not supported: this Loki server has no /loki/api/v1/index/stats endpoint (requires Loki >= %s)", lokiIndexStatsVersion)
+		}
+		return nil, err
+	}
+
+	// Parse JSON response
+	var result LokiStatsResult
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+// formatLokiStatsResults formats Loki index stats results into a readable string
+func formatLokiStatsResults(result *LokiStatsResult, format string) (string, error) {
+	switch format {
+	case "json":
+		// Return raw JSON response
+		jsonBytes, err := json.MarshalIndent(result, "", "  ")
+		if err != nil {
+			return "", fmt.Errorf("failed to marshal JSON: %v", err)
+		}
+		return string(jsonBytes), nil
+
+	case "raw":
+		// Return one counter per line
+		return fmt.Sprintf("streams=%d\nchunks=%d\nentries=%d\nbytes=%d\n",
+			result.Streams, result.Chunks, result.Entries, result.Bytes), nil
+
+	case "text":
+		// Return formatted text with human readable sizes
+		var b strings.Builder
+		b.WriteString("Index stats:\n\n")
+		fmt.Fprintf(&b, "Streams: %d\n", result.Streams)
+		fmt.Fprintf(&b, "Chunks:  %d\n", result.Chunks)
+		fmt.Fprintf(&b, "Entries: %d\n", result.Entries)
+		fmt.Fprintf(&b, "Bytes:   %d (%s)\n", result.Bytes, formatByteSize(result.Bytes))
+		return b.String(), nil
+
+	default:
+		return "", fmt.Errorf("unsupported format: %s. Supported formats: raw, json, text", format)
+	}
+}
+
+// formatByteSize renders a byte count with a binary unit, e.g. 1.5 GiB
+func formatByteSize(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
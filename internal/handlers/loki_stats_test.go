@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/ThinkInAIXYZ/go-mcp/protocol"
+)
+
+// TestBuildLokiStatsURL verifies the index stats path and parameters
+func TestBuildLokiStatsURL(t *testing.T) {
+	testCases := []struct {
+		baseURL  string
+		wantPath string
+	}{
+		{baseURL: "http://localhost:3100", wantPath: "/loki/api/v1/index/stats"},
+		{baseURL: "http://gateway/tenant", wantPath: "/tenant/loki/api/v1/index/stats"},
+		{baseURL: "http://localhost:3100/loki/api/v1", wantPath: "/loki/api/v1/index/stats"},
+	}
+
+	for _, tc := range testCases {
+		got, err := buildLokiStatsURL(tc.baseURL, `{job="a"}`, 1705312245, 1705315845)
+		if err != nil {
+			t.Fatalf("buildLokiStatsURL failed: %v", err)
+		}
+		u, _ := url.Parse(got)
+		if u.Path != tc.wantPath {
+			t.Errorf("Expected path %q for %s, got %q", tc.wantPath, tc.baseURL, u.Path)
+		}
+		q := u.Query()
+		if q.Get("query") != `{job="a"}` || q.Get("start") != "1705312245" || q.Get("end") != "1705315845" {
+			t.Errorf("Unexpected parameters: %s", u.RawQuery)
+		}
+	}
+}
+
+// TestFormatLokiStatsResults verifies the raw, json and text formats
+func TestFormatLokiStatsResults(t *testing.T) {
+	result := &LokiStatsResult{Streams: 12, Chunks: 340, Entries: 98765, Bytes: 1610612736}
+
+	raw, err := formatLokiStatsResults(result, "raw")
+	if err != nil || raw != "streams=12\nchunks=340\nentries=98765\nbytes=1610612736\n" {
+		t.Errorf("Unexpected raw output %q (%v)", raw, err)
+	}
+
+	text, err := formatLokiStatsResults(result, "text")
+	if err != nil || !strings.Contains(text, "Entries: 98765") || !strings.Contains(text, "1610612736 (1.5 GiB)") {
+		t.Errorf("Unexpected text output %q (%v)", text, err)
+	}
+
+	jsonText, err := formatLokiStatsResults(result, "json")
+	if err != nil {
+		t.Fatalf("json format failed: %v", err)
+	}
+	var decoded LokiStatsResult
+	if err := json.Unmarshal([]byte(jsonText), &decoded); err != nil || decoded != *result {
+		t.Errorf("Expected json to round trip, got %q (%v)", jsonText, err)
+	}
+
+	if _, err := formatLokiStatsResults(result, "push"); err == nil {
+		t.Error("Expected error for unsupported format")
+	}
+}
+
+// TestFormatByteSize verifies unit selection
+func TestFormatByteSize(t *testing.T) {
+	testCases := map[int64]string{
+		0:          "0 B",
+		1023:       "1023 B",
+		1024:       "1.0 KiB",
+		1536:       "1.5 KiB",
+		1048576:    "1.0 MiB",
+		1610612736: "1.5 GiB",
+	}
+	for n, want := range testCases {
+		if got := formatByteSize(n); got != want {
+			t.Errorf("formatByteSize(%d) = %q, want %q", n, got, want)
+		}
+	}
+}
+
+// TestHandleLokiStatsProtocol verifies the request sent to Loki and the formatted counters
+func TestHandleLokiStatsProtocol(t *testing.T) {
+	var lastPath, lastQuery string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lastPath = r.URL.Path
+		lastQuery = r.URL.Query().Get("query")
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"streams":3,"chunks":10,"entries":2500,"bytes":4096}`))
+	}))
+	defer server.Close()
+
+	for _, env := range []string{EnvLokiURL, EnvLokiOrgID, EnvLokiUsername, EnvLokiPassword, EnvLokiToken} {
+		t.Setenv(env, "")
+	}
+
+	if _, err := NewLokiStatsToolProtocol(); err != nil {
+		t.Fatalf("Failed to create tool: %v", err)
+	}
+
+	raw, _ := json.Marshal(map[string]any{"query": `{job="a"}`, "url": server.URL, "format": "text"})
+	result, err := HandleLokiStatsProtocol(context.Background(), &protocol.CallToolRequest{Name: "loki_stats", RawArguments: raw})
+	if err != nil {
+		t.Fatalf("HandleLokiStatsProtocol failed: %v", err)
+	}
+	if lastPath != "/loki/api/v1/index/stats" || lastQuery != `{job="a"}` {
+		t.Errorf("Unexpected request: path %q, query %q", lastPath, lastQuery)
+	}
+	if text := result.Content[0].(*protocol.TextContent).Text; !strings.Contains(text, "Entries: 2500") || !strings.Contains(text, "4.0 KiB") {
+		t.Errorf("Unexpected output: %q", text)
+	}
+
+	raw, _ = json.Marshal(map[string]any{"query": `job="a"`, "url": server.URL})
+	if _, err := HandleLokiStatsProtocol(context.Background(), &protocol.CallToolRequest{Name: "loki_stats", RawArguments: raw}); err == nil {
+		t.Error("Expected invalid selector to be rejected")
+	}
+}
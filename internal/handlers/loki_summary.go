@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Grouping used by summaries unless a label is chosen
+const lokiSummaryByLevel = "level"
+
+// Default number of lines shown at each end of a summary
+const DefaultLokiSummaryLines = 5
+
+// Maximum number of lines shown at each end of a summary
+const MaxLokiSummaryLines = 100
+
+// Group shown for lines without a level or without the chosen label
+const lokiSummaryNone = "(none)"
+
+// lokiSummaryEntry is a log line with its parsed timestamp and stream labels
+type lokiSummaryEntry struct {
+	ts     int64
+	value  []string
+	stream map[string]string
+}
+
+// resolveLokiSummary validates the summary parameters and returns the grouping and line count
+func resolveLokiSummary(summarize bool, by string, lines float64, format string, fields []string) (string, int, error) {
+	if !summarize {
+		if by != "" || lines != 0 {
+			return "", 0, fmt.Errorf("summarizeBy and summaryLines require summarize")
+		}
+		return "", 0, nil
+	}
+	if format != "" || len(fields) > 0 {
+		return "", 0, fmt.Errorf("summarize cannot be combined with format or fields")
+	}
+	if lines < 0 || lines != float64(int(lines)) || lines > MaxLokiSummaryLines {
+		return "", 0, fmt.Errorf("summaryLines must be a whole number between 0 and %d, got %v", MaxLokiSummaryLines, lines)
+	}
+
+	n := int(lines)
+	if lines == 0 {
+		n = DefaultLokiSummaryLines
+	}
+	if by == "" {
+		by = lokiSummaryByLevel
+	}
+	return by, n, nil
+}
+
+// lokiSummaryGroup returns the group of a line: its stream label value when grouping by a label,
+// or its detected level, falling back to a level or detected_level stream label
+func lokiSummaryGroup(entry lokiSummaryEntry, by string) string {
+	if by != lokiSummaryByLevel {
+		if value, ok := entry.stream[by]; ok {
+			return value
+		}
+		return lokiSummaryNone
+	}
+
+	if level := detectLokiLevel(entry.value[1]); level != "" {
+		return level
+	}
+	for _, label := range []string{"level", "detected_level"} {
+		if value, ok := entry.stream[label]; ok {
+			return strings.ToLower(value)
+		}
+	}
+	return lokiSummaryNone
+}
+
+// formatLokiSummary formats results as line counts per group followed by the oldest and newest
+// lines, giving an overview of large results without returning every line
+func formatLokiSummary(result *LokiResult, by string, lines int) string {
+	var entries []lokiSummaryEntry
+	for _, stream := range result.Data.Result {
+		for _, val := range stream.Values {
+			if len(val) < 2 {
+				continue
+			}
+			ts, _ := strconv.ParseInt(val[0], 10, 64)
+			entries = append(entries, lokiSummaryEntry{ts: ts, value: val, stream: stream.Stream})
+		}
+	}
+	if len(entries) == 0 {
+		return "No logs found matching the query"
+	}
+	slices.SortStableFunc(entries, func(a, b lokiSummaryEntry) int { return cmp.Compare(a.ts, b.ts) })
+
+	counts := make(map[string]int)
+	for _, entry := range entries {
+		counts[lokiSummaryGroup(entry, by)]++
+	}
+	groups := make([]string, 0, len(counts))
+	width := 0
+	for group := range counts {
+		groups = append(groups, group)
+		width = max(width, len(group))
+	}
+	// Largest groups first, ties by name
+	slices.SortFunc(groups, func(a, b string) int {
+		if c := cmp.Compare(counts[b], counts[a]); c != 0 {
+			return c
+		}
+		return cmp.Compare(a, b)
+	})
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Summary of %d entries in %d streams\n\n", len(entries), len(result.Data.Result))
+	fmt.Fprintf(&b, "By %s:\n", by)
+	for _, group := range groups {
+		fmt.Fprintf(&b, "  %-*s  %d\n", width, group, counts[group])
+	}
+
+	if lines > 0 {
+		if len(entries) <= 2*lines {
+			b.WriteString("\nAll lines:\n")
+			writeLokiSummaryLines(&b, entries)
+		} else {
+			fmt.Fprintf(&b, "\nFirst %d lines:\n", lines)
+			writeLokiSummaryLines(&b, entries[:lines])
+			fmt.Fprintf(&b, "\nLast %d lines:\n", lines)
+			writeLokiSummaryLines(&b, entries[len(entries)-lines:])
+		}
+	}
+	return b.String()
+}
+
+// writeLokiSummaryLines writes lines with their timestamps and stream labels
+func writeLokiSummaryLines(b *strings.Builder, entries []lokiSummaryEntry) {
+	for _, entry := range entries {
+		timestamp := time.Unix(0, entry.ts).Format(time.RFC3339)
+		fmt.Fprintf(b, "[%s] %s %s\n", timestamp, formatMetricLabels(entry.stream), entry.value[1])
+	}
+}
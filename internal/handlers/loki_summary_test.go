@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// summaryTestResult returns two streams with lines of mixed levels, interleaved in time
+func summaryTestResult() *LokiResult {
+	api := LokiEntry{Stream: map[string]string{"app": "api"}}
+	worker := LokiEntry{Stream: map[string]string{"app": "worker", "level": "WARN"}}
+	for i := 0; i < 10; i++ {
+		ts := fmt.Sprintf("17053122%02d000000000", 2*i)
+		level := "info"
+		if i%4 == 0 {
+			level = "error"
+		}
+		api.Values = append(api.Values, []string{ts, fmt.Sprintf("level=%s msg=api-%d", level, i)})
+	}
+	worker.Values = [][]string{
+		{"1705312201000000000", "worker started"},
+		{"1705312299000000000", `{"level":"debug","msg":"worker idle"}`},
+	}
+	return &LokiResult{Status: "success", Data: LokiData{ResultType: "streams", Result: []LokiEntry{api, worker}}}
+}
+
+// TestFormatLokiSummary_ByLevel verifies counts by detected level and the oldest and newest lines
+func TestFormatLokiSummary_ByLevel(t *testing.T) {
+	output := formatLokiSummary(summaryTestResult(), lokiSummaryByLevel, 2)
+
+	for _, want := range []string{
+		"Summary of 12 entries in 2 streams\n",
+		"By level:\n  info   7\n  error  3\n  debug  1\n  warn   1\n",
+		"First 2 lines:\n",
+		`{app="api"} level=error msg=api-0`,
+		`{app="worker", level="WARN"} worker started`,
+		"Last 2 lines:\n",
+		`{app="api"} level=info msg=api-9`,
+		`worker idle`,
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("Expected %q in output:\n%s", want, output)
+		}
+	}
+	if strings.Contains(output, "api-5") {
+		t.Errorf("Expected lines in the middle to be left out:\n%s", output)
+	}
+}
+
+// TestFormatLokiSummary_ByLabel verifies counts by a stream label
+func TestFormatLokiSummary_ByLabel(t *testing.T) {
+	output := formatLokiSummary(summaryTestResult(), "level", 0)
+	if !strings.Contains(output, "info   7") {
+		t.Errorf("Expected level grouping, got:\n%s", output)
+	}
+
+	output = formatLokiSummary(summaryTestResult(), "app", 100)
+	if !strings.Contains(output, "By app:\n  api     10\n  worker  2\n") || !strings.Contains(output, "All lines:\n") {
+		t.Errorf("Unexpected output:\n%s", output)
+	}
+	if strings.Contains(output, "First") {
+		t.Errorf("Expected all lines once when they fit, got:\n%s", output)
+	}
+
+	output = formatLokiSummary(summaryTestResult(), "host", 0)
+	if !strings.Contains(output, lokiSummaryNone+"  12") {
+		t.Errorf("Expected lines without the label to be grouped together, got:\n%s", output)
+	}
+}
+
+// TestResolveLokiSummary verifies defaults and validation of the summary parameters
+func TestResolveLokiSummary(t *testing.T) {
+	by, lines, err := resolveLokiSummary(true, "", 0, "", nil)
+	if err != nil || by != lokiSummaryByLevel || lines != DefaultLokiSummaryLines {
+		t.Errorf("Unexpected defaults %q, %d (%v)", by, lines, err)
+	}
+
+	invalid := []struct {
+		summarize bool
+		by        string
+		lines     float64
+		format    string
+		fields    []string
+	}{
+		{false, "app", 0, "", nil},
+		{true, "", 2.5, "", nil},
+		{true, "", 101, "", nil},
+		{true, "", 0, "json", nil},
+		{true, "", 0, "", []string{"msg"}},
+	}
+	for _, tc := range invalid {
+		if _, _, err := resolveLokiSummary(tc.summarize, tc.by, tc.lines, tc.format, tc.fields); err == nil {
+			t.Errorf("Expected an error for %+v", tc)
+		}
+	}
+}
@@ -0,0 +1,316 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ThinkInAIXYZ/go-mcp/protocol"
+	"github.com/gorilla/websocket"
+)
+
+// Default time a loki_tail call keeps the connection open
+const defaultTailDuration = 10 * time.Second
+
+// Maximum time a loki_tail call may keep the connection open
+const maxTailDuration = 5 * time.Minute
+
+// LokiTailRequest represents the arguments for loki_tail tool
+type LokiTailRequest struct {
+	Query    string            `json:"query" description:"LogQL query string"`
+	URL      string            `json:"url,omitempty" description:"Loki server URL"`
+	Backend  string            `json:"backend,omitempty" description:"Name of a Loki backend from LOKI_BACKENDS, e.g. prod, whose URL and credentials to use; cannot be combined with url, and an explicit credential still wins"`
+	Username string            `json:"username,omitempty" description:"Username for basic authentication"`
+	Password string            `json:"password,omitempty" description:"Password for basic authentication"`
+	Token    string            `json:"token,omitempty" description:"Bearer token for authentication"`
+	Duration string            `json:"duration,omitempty" description:"How long to tail before returning, e.g. 30s (default: 10s, max: 5m)"`
+	Limit    float64           `json:"limit,omitempty" description:"Stop early once this many entries have been received (default: 100)"`
+	Start    string            `json:"start,omitempty" description:"Time to tail from, e.g. the timestamp after the last entry of a previous call in Unix nanoseconds, so that no entry is missed between calls; entries since then are returned first (default: now)"`
+	Org      string            `json:"org,omitempty" description:"Organization ID for the query; separate several with commas to query tenants together"`
+	Headers  map[string]string `json:"headers,omitempty" description:"Extra HTTP headers to send to Loki, e.g. {\"X-Api-Key\": \"...\"}; never replaces the auth or org headers"`
+	Format   string            `json:"format,omitempty" description:"Output format: raw, json, or text"`
+	Redact   []string          `json:"redact,omitempty" description:"Patterns to mask with *** in the returned lines, as for loki_query; the patterns of LOKI_REDACT always apply"`
+}
+
+// lokiTailFrame represents a single message received from Loki's tail WebSocket
+type lokiTailFrame struct {
+	Streams        []LokiEntry `json:"streams"`
+	DroppedEntries []struct {
+		Labels    map[string]string `json:"labels"`
+		Timestamp string            `json:"timestamp"`
+	} `json:"dropped_entries"`
+}
+
+// NewLokiTailToolProtocol creates a tool using the protocol library
+func NewLokiTailToolProtocol() (*protocol.Tool, error) {
+	return protocol.NewTool("loki_tail", "Live-tail a LogQL query from Grafana Loki for a bounded duration and return the received entries", LokiTailRequest{})
+}
+
+// HandleLokiTailProtocol handles Loki tail tool requests using protocol library
+func HandleLokiTailProtocol(ctx context.Context, request *protocol.CallToolRequest) (*protocol.CallToolResult, error) {
+	req := new(LokiTailRequest)
+	if err := protocol.VerifyAndUnmarshal(request.RawArguments, req); err != nil {
+		return nil, err
+	}
+
+	// Catch malformed queries before making any network call
+	if err := validateLogQL(req.Query); err != nil {
+		return nil, err
+	}
+
+	conn, err := resolveLokiConnection(req.Backend, req.URL, req.Username, req.Password, req.Token, req.Org)
+	if err != nil {
+		return nil, err
+	}
+	lokiURL, username, password, token, orgID := conn.URL, conn.Username, conn.Password, conn.Token, conn.OrgID
+	ctx = withLokiHeaders(ctx, req.Headers)
+
+	duration := defaultTailDuration
+	if req.Duration != "" {
+		parsed, err := parsePositiveDuration("duration", req.Duration)
+		if err != nil {
+			return nil, err
+		}
+		if parsed > maxTailDuration {
+			return nil, fmt.Errorf("invalid duration: %s exceeds the maximum of %s", parsed, maxTailDuration)
+		}
+		duration = parsed
+	}
+
+	limit, _, err := resolveLokiLimit(req.Limit)
+	if err != nil {
+		return nil, err
+	}
+
+	format := resolveLokiFormat(req.Format, lokiQueryFormats)
+
+	redact, err := compileLokiRedact(req.Redact)
+	if err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	if req.Start != "" {
+		loc, err := resolveLokiTimezone("")
+		if err != nil {
+			return nil, err
+		}
+		if start, err = parseTime(req.Start, loc); err != nil {
+			return nil, fmt.Errorf("invalid start time: %v", err)
+		}
+	}
+
+	tailURL, err := buildLokiTailURL(lokiURL, req.Query, start, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build tail URL: %v", err)
+	}
+
+	result, dropped, err := executeLokiTailQuery(ctx, tailURL, username, password, token, orgID, duration, limit)
+	if err != nil {
+		return nil, fmt.Errorf("tail execution failed: %v", err)
+	}
+
+	result, _ = redactLokiResult(result, redact)
+	formattedResult, err := formatLokiResults(result, format)
+	if err != nil {
+		return nil, fmt.Errorf("failed to format results: %v", err)
+	}
+	if dropped > 0 && format != "json" && format != "push" {
+		formattedResult += fmt.Sprintf("\nWarning: Loki dropped %d entries while tailing\n", dropped)
+	}
+
+	return &protocol.CallToolResult{
+		Content: []protocol.Content{
+			&protocol.TextContent{
+				Type: "text",
+				Text: formattedResult,
+			},
+		},
+	}, nil
+}
+
+// buildLokiTailURL constructs the Loki tail WebSocket URL
+func buildLokiTailURL(baseURL, query string, start time.Time, limit int) (string, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return "", err
+	}
+
+	// The tail endpoint is served over WebSocket on the same host
+	switch u.Scheme {
+	case "http", "ws":
+		u.Scheme = "ws"
+	case "https", "wss":
+		u.Scheme = "wss"
+	default:
+		return "", fmt.Errorf("unsupported URL scheme: %q", u.Scheme)
+	}
+
+	// Add path for Loki tail API
+	if !strings.Contains(u.Path, "loki/api/v1") {
+		u.Path = strings.TrimSuffix(u.Path, "/") + "/loki/api/v1/tail"
+	} else if !strings.HasSuffix(u.Path, "tail") {
+		u.Path = fmt.Sprintf("%s/tail", u.Path)
+	}
+
+	// Add query parameters
+	q := u.Query()
+	q.Set("query", query)
+	q.Set("start", fmt.Sprintf("%d", start.UnixNano()))
+	q.Set("limit", fmt.Sprintf("%d", limit))
+	u.RawQuery = q.Encode()
+
+	return u.String(), nil
+}
+
+// executeLokiTailQuery opens Loki's tail WebSocket and accumulates entries until the duration
+// elapses, limit entries have been received, or ctx is cancelled. The socket is always closed
+// with a normal closure message before returning. It also returns the number of entries Loki
+// reported as dropped because the client could not keep up.
+func executeLokiTailQuery(ctx context.Context, tailURL string, username, password, token, orgID string, duration time.Duration, limit int) (*LokiResult, int, error) {
+	ctx, cancel := context.WithTimeout(ctx, duration)
+	defer cancel()
+	logLokiURL(ctx, tailURL)
+
+	// Refuse the tail outright when its tenant is over LOKI_RATE_LIMIT
+	if err := checkLokiRateLimit(ctx, username, token, orgID); err != nil {
+		return nil, 0, err
+	}
+
+	// Count the tail and the frame bytes it receives for the tenant, like other Loki requests
+	var frame lokiTailFrame
+	read, observeOrg := countLokiOrgRequest(orgID, tailURL, func(r io.Reader) error {
+		// An empty message is malformed rather than the end of the tail
+		if err := json.NewDecoder(r).Decode(&frame); err != io.EOF {
+			return err
+		}
+		return io.ErrUnexpectedEOF
+	})
+	defer observeOrg()
+
+	// Hold one of the LOKI_MAX_CONCURRENT slots for as long as the socket is open
+	release, err := acquireLokiSlot(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer release()
+
+	// Build the handshake request with the same auth and tenant headers as the HTTP executors
+	req, err := http.NewRequestWithContext(ctx, "GET", tailURL, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	if err := setLokiRequestHeaders(req, username, password, token, orgID); err != nil {
+		return nil, 0, err
+	}
+	if err := signLokiRequest(ctx, req); err != nil {
+		return nil, 0, err
+	}
+
+	// Dial with the same TLS settings as the HTTP executors
+	transport, err := lokiTransport()
+	if err != nil {
+		return nil, 0, err
+	}
+	dialer := &websocket.Dialer{
+		Proxy:            transport.Proxy,
+		TLSClientConfig:  transport.TLSClientConfig,
+		HandshakeTimeout: websocket.DefaultDialer.HandshakeTimeout,
+	}
+
+	conn, resp, err := dialer.DialContext(ctx, req.URL.String(), req.Header)
+	if err != nil {
+		if resp != nil {
+			// Only the start of the body is quoted, so don't buffer more of it than that
+			body, _ := io.ReadAll(io.LimitReader(resp.Body, maxLokiErrorBodyBytes))
+			resp.Body.Close()
+			return nil, 0, &LokiHTTPError{StatusCode: resp.StatusCode, Body: string(body)}
+		}
+		return nil, 0, err
+	}
+	defer conn.Close()
+
+	// Close the socket as soon as the duration elapses or the caller goes away,
+	// which also unblocks the pending read below
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""),
+				time.Now().Add(time.Second))
+			conn.Close()
+		case <-done:
+		}
+	}()
+
+	streams := make(map[string]*LokiEntry)
+	var order []string
+	received, dropped := 0, 0
+
+	for limit <= 0 || received < limit {
+		frame = lokiTailFrame{}
+		_, r, err := conn.NextReader()
+		if err == nil {
+			err = read(r)
+		}
+		if err != nil {
+			if ctx.Err() != nil || websocket.IsCloseError(err, websocket.CloseNormalClosure) || errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, 0, err
+		}
+
+		dropped += len(frame.DroppedEntries)
+		for _, stream := range frame.Streams {
+			// A frame may carry more entries than the limit leaves room for
+			values := stream.Values
+			if limit > 0 {
+				if received >= limit {
+					break
+				}
+				values = values[:min(len(values), limit-received)]
+			}
+
+			key := streamKey(stream.Stream)
+			entry, ok := streams[key]
+			if !ok {
+				entry = &LokiEntry{Stream: stream.Stream}
+				streams[key] = entry
+				order = append(order, key)
+			}
+			entry.Values = append(entry.Values, values...)
+			received += len(values)
+		}
+	}
+
+	result := &LokiResult{Status: "success", Data: LokiData{ResultType: "streams"}}
+	for _, key := range order {
+		result.Data.Result = append(result.Data.Result, *streams[key])
+	}
+
+	return result, dropped, nil
+}
+
+// streamKey returns a stable identifier for a stream label set
+func streamKey(labels map[string]string) string {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		parts = append(parts, fmt.Sprintf("%s=%q", k, labels[k]))
+	}
+	return strings.Join(parts, ",")
+}
@@ -0,0 +1,301 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ThinkInAIXYZ/go-mcp/protocol"
+	"github.com/gorilla/websocket"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// newTailServer starts a mock Loki tail endpoint that sends frames and then keeps the socket open
+func newTailServer(t *testing.T, frames []string, onHandshake func(r *http.Request)) *httptest.Server {
+	t.Helper()
+	upgrader := websocket.Upgrader{}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if onHandshake != nil {
+			onHandshake(r)
+		}
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for _, frame := range frames {
+			if err := conn.WriteMessage(websocket.TextMessage, []byte(frame)); err != nil {
+				return
+			}
+		}
+		// Block until the client closes the connection
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}))
+}
+
+// TestBuildLokiTailURL verifies the WebSocket scheme, path and parameters of the tail URL
+func TestBuildLokiTailURL(t *testing.T) {
+	start := time.Unix(1705312245, 0)
+
+	testCases := []struct {
+		base string
+		want string
+	}{
+		{"http://localhost:3100", "ws://localhost:3100/loki/api/v1/tail"},
+		{"https://loki.example.com/", "wss://loki.example.com/loki/api/v1/tail"},
+		{"https://loki.example.com/loki/api/v1", "wss://loki.example.com/loki/api/v1/tail"},
+	}
+
+	for _, tc := range testCases {
+		got, err := buildLokiTailURL(tc.base, `{job="x"}`, start, 50)
+		if err != nil {
+			t.Fatalf("buildLokiTailURL(%q) failed: %v", tc.base, err)
+		}
+		u, _ := url.Parse(got)
+		if base := u.Scheme + "://" + u.Host + u.Path; base != tc.want {
+			t.Errorf("buildLokiTailURL(%q) = %q, want %q", tc.base, base, tc.want)
+		}
+		q := u.Query()
+		if q.Get("query") != `{job="x"}` || q.Get("limit") != "50" || q.Get("start") != "1705312245000000000" {
+			t.Errorf("Unexpected query parameters: %s", u.RawQuery)
+		}
+	}
+
+	if _, err := buildLokiTailURL("ftp://loki:3100", `{job="x"}`, start, 10); err == nil {
+		t.Error("Expected error for unsupported scheme")
+	}
+}
+
+// TestHandleLokiTailProtocol verifies that frames are merged per stream and that auth headers are sent
+func TestHandleLokiTailProtocol(t *testing.T) {
+	var handshake *http.Request
+	server := newTailServer(t, []string{
+		`{"streams":[{"stream":{"job":"x"},"values":[["1705312245000000000","first"]]}]}`,
+		`{"streams":[{"stream":{"job":"y"},"values":[["1705312246000000000","other"]]},{"stream":{"job":"x"},"values":[["1705312247000000000","second"]]}],"dropped_entries":[{"labels":{"job":"x"},"timestamp":"1705312246500000000"}]}`,
+	}, func(r *http.Request) { handshake = r })
+	defer server.Close()
+
+	for _, env := range []string{EnvLokiURL, EnvLokiOrgID, EnvLokiUsername, EnvLokiPassword, EnvLokiToken} {
+		t.Setenv(env, "")
+	}
+
+	if _, err := NewLokiTailToolProtocol(); err != nil {
+		t.Fatalf("Failed to create tool: %v", err)
+	}
+
+	raw, _ := json.Marshal(map[string]any{
+		"query":    `{job=~"x|y"}`,
+		"url":      server.URL,
+		"token":    "secret",
+		"org":      "tenant-1",
+		"duration": "2s",
+		"limit":    3,
+		"format":   "text",
+	})
+
+	started := time.Now()
+	result, err := HandleLokiTailProtocol(context.Background(), &protocol.CallToolRequest{Name: "loki_tail", RawArguments: raw})
+	if err != nil {
+		t.Fatalf("HandleLokiTailProtocol failed: %v", err)
+	}
+	if elapsed := time.Since(started); elapsed > time.Second {
+		t.Errorf("Expected tail to return once the limit was reached, took %s", elapsed)
+	}
+
+	if got := handshake.Header.Get("Authorization"); got != "Bearer secret" {
+		t.Errorf("Expected bearer token on handshake, got %q", got)
+	}
+	if got := handshake.Header.Get("X-Scope-OrgID"); got != "tenant-1" {
+		t.Errorf("Expected org header on handshake, got %q", got)
+	}
+
+	output := result.Content[0].(*protocol.TextContent).Text
+	if !strings.Contains(output, "Found 2 streams") {
+		t.Errorf("Expected entries merged into 2 streams, got:\n%s", output)
+	}
+	for _, line := range []string{"first", "second", "other", "dropped 1 entries"} {
+		if !strings.Contains(output, line) {
+			t.Errorf("Expected output to contain %q, got:\n%s", line, output)
+		}
+	}
+}
+
+// TestExecuteLokiTailQuery_Cancellation verifies that tailing stops promptly when the caller cancels
+func TestExecuteLokiTailQuery_Cancellation(t *testing.T) {
+	server := newTailServer(t, []string{
+		`{"streams":[{"stream":{"job":"x"},"values":[["1705312245000000000","only"]]}]}`,
+	}, nil)
+	defer server.Close()
+
+	tailURL, err := buildLokiTailURL(server.URL, `{job="x"}`, time.Now(), 100)
+	if err != nil {
+		t.Fatalf("buildLokiTailURL failed: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	started := time.Now()
+	result, dropped, err := executeLokiTailQuery(ctx, tailURL, "", "", "", "", time.Minute, 100)
+	if err != nil {
+		t.Fatalf("executeLokiTailQuery failed: %v", err)
+	}
+	if elapsed := time.Since(started); elapsed > 2*time.Second {
+		t.Errorf("Expected tail to stop on cancellation, took %s", elapsed)
+	}
+	if dropped != 0 {
+		t.Errorf("Expected no dropped entries, got %d", dropped)
+	}
+	if len(result.Data.Result) != 1 || len(result.Data.Result[0].Values) != 1 {
+		t.Errorf("Expected the single received entry, got %+v", result.Data.Result)
+	}
+}
+
+// TestExecuteLokiTailQuery_FrameOverLimit verifies that a frame with more entries than the limit
+// is cut to it
+func TestExecuteLokiTailQuery_FrameOverLimit(t *testing.T) {
+	server := newTailServer(t, []string{
+		`{"streams":[{"stream":{"job":"x"},"values":[["1705312245000000000","one"],["1705312246000000000","two"]]},{"stream":{"job":"y"},"values":[["1705312247000000000","three"],["1705312248000000000","four"]]}]}`,
+	}, nil)
+	defer server.Close()
+
+	tailURL, err := buildLokiTailURL(server.URL, `{job=~"x|y"}`, time.Now(), 3)
+	if err != nil {
+		t.Fatalf("buildLokiTailURL failed: %v", err)
+	}
+
+	result, _, err := executeLokiTailQuery(context.Background(), tailURL, "", "", "", "", time.Minute, 3)
+	if err != nil {
+		t.Fatalf("executeLokiTailQuery failed: %v", err)
+	}
+	if got := countLokiEntries(result); got != 3 {
+		t.Errorf("Expected 3 entries, got %d: %+v", got, result.Data.Result)
+	}
+	if len(result.Data.Result) != 2 || result.Data.Result[1].Values[0][1] != "three" {
+		t.Errorf("Expected the first entry of the second stream to be kept, got %+v", result.Data.Result)
+	}
+}
+
+// TestHandleLokiTailProtocol_Start verifies that a tail resumes from the given start
+func TestHandleLokiTailProtocol_Start(t *testing.T) {
+	var start string
+	server := newTailServer(t, nil, func(r *http.Request) { start = r.URL.Query().Get("start") })
+	defer server.Close()
+
+	if _, err := NewLokiTailToolProtocol(); err != nil {
+		t.Fatalf("Failed to create tool: %v", err)
+	}
+	call := func(args map[string]any) error {
+		raw, _ := json.Marshal(args)
+		_, err := HandleLokiTailProtocol(context.Background(), &protocol.CallToolRequest{Name: "loki_tail", RawArguments: raw})
+		return err
+	}
+
+	if err := call(map[string]any{"query": `{job="x"}`, "url": server.URL, "duration": "100ms", "start": "1705312245000000001"}); err != nil {
+		t.Fatalf("HandleLokiTailProtocol failed: %v", err)
+	}
+	if start != "1705312245000000001" {
+		t.Errorf("Expected the tail to start at the given nanosecond, got %q", start)
+	}
+	if err := call(map[string]any{"query": `{job="x"}`, "url": server.URL, "start": "soon"}); err == nil {
+		t.Error("Expected an error for an invalid start")
+	}
+}
+
+// TestExecuteLokiTailQuery_Concurrency verifies that a tail waits for a LOKI_MAX_CONCURRENT slot
+func TestExecuteLokiTailQuery_Concurrency(t *testing.T) {
+	server := newTailServer(t, nil, nil)
+	defer server.Close()
+
+	t.Setenv(EnvLokiMaxConcurrent, "1")
+	release, err := acquireLokiSlot(context.Background())
+	if err != nil {
+		t.Fatalf("acquireLokiSlot failed: %v", err)
+	}
+	tailURL, _ := buildLokiTailURL(server.URL, `{job="x"}`, time.Now(), 10)
+	if _, _, err := executeLokiTailQuery(context.Background(), tailURL, "", "", "", "", 100*time.Millisecond, 10); err == nil || !strings.Contains(err.Error(), "Loki request slots") {
+		t.Errorf("Expected the tail to wait for a slot, got %v", err)
+	}
+	release()
+
+	if _, _, err := executeLokiTailQuery(context.Background(), tailURL, "", "", "", "", 100*time.Millisecond, 10); err != nil {
+		t.Errorf("Expected the tail to run once the slot was released, got %v", err)
+	}
+}
+
+// TestExecuteLokiTailQuery_RateLimit verifies that tails count against the tenant's rate limit
+func TestExecuteLokiTailQuery_RateLimit(t *testing.T) {
+	handshakes := 0
+	server := newTailServer(t, nil, func(r *http.Request) { handshakes++ })
+	defer server.Close()
+
+	t.Setenv(EnvLokiRateLimit, "0.01")
+	t.Setenv(EnvLokiRateLimitBurst, "1")
+	tailURL, _ := buildLokiTailURL(server.URL, `{job="x"}`, time.Now(), 10)
+	if _, _, err := executeLokiTailQuery(context.Background(), tailURL, "", "", "", "tail-rate-limit-test", 50*time.Millisecond, 10); err != nil {
+		t.Fatalf("Expected the first tail to be allowed, got %v", err)
+	}
+	_, _, err := executeLokiTailQuery(context.Background(), tailURL, "", "", "", "tail-rate-limit-test", 50*time.Millisecond, 10)
+	if err == nil || !strings.Contains(err.Error(), "rate limit exceeded") {
+		t.Errorf("Expected the second tail to be refused, got %v", err)
+	}
+	if handshakes != 1 {
+		t.Errorf("Expected the refused tail not to reach Loki, got %d handshakes", handshakes)
+	}
+}
+
+// TestExecuteLokiTailQuery_OrgMetrics verifies that a tail and its frame bytes are counted for its org
+func TestExecuteLokiTailQuery_OrgMetrics(t *testing.T) {
+	frame := `{"streams":[{"stream":{"job":"x"},"values":[["1","a"]]}]}`
+	server := newTailServer(t, []string{frame}, nil)
+	defer server.Close()
+
+	tailURL, _ := buildLokiTailURL(server.URL, `{job="x"}`, time.Now(), 10)
+	if _, _, err := executeLokiTailQuery(context.Background(), tailURL, "", "", "", "test-org-tail", 100*time.Millisecond, 1); err != nil {
+		t.Fatalf("Tail failed: %v", err)
+	}
+
+	if got := testutil.ToFloat64(orgRequests.WithLabelValues("test-org-tail", "tail")); got != 1 {
+		t.Errorf("Expected 1 tail request, got %v", got)
+	}
+	rec := httptest.NewRecorder()
+	MetricsHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	want := fmt.Sprintf(`loki_mcp_org_response_bytes_sum{endpoint="tail",org="test-org-tail"} %d`, len(frame))
+	if !strings.Contains(rec.Body.String(), want) {
+		t.Errorf("Expected metrics output to contain %s", want)
+	}
+}
+
+// TestExecuteLokiTailQuery_RefusedBody verifies that only the start of a refused handshake's body is read
+func TestExecuteLokiTailQuery_RefusedBody(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("parse error"))
+		w.Write([]byte(strings.Repeat("x", 64*maxLokiErrorBodyBytes)))
+	}))
+	defer server.Close()
+
+	tailURL, _ := buildLokiTailURL(server.URL, `{job="x"}`, time.Now(), 10)
+	_, _, err := executeLokiTailQuery(context.Background(), tailURL, "", "", "", "", time.Second, 10)
+	var httpErr *LokiHTTPError
+	if !errors.As(err, &httpErr) {
+		t.Fatalf("Expected a LokiHTTPError, got %v", err)
+	}
+	if httpErr.StatusCode != http.StatusBadRequest || !strings.HasPrefix(httpErr.Body, "parse error") {
+		t.Errorf("Expected the status and body of the refusal, got %d %q", httpErr.StatusCode, httpErr.Body[:20])
+	}
+	if len(httpErr.Body) > maxLokiErrorBodyBytes {
+		t.Errorf("Expected the body to be cut to %d bytes, got %d", maxLokiErrorBodyBytes, len(httpErr.Body))
+	}
+}
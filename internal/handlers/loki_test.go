@@ -1,10 +1,17 @@
 package handlers
 
 import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"strconv"
 	"strings"
 	"testing"
 	"time"
+
+	"github.com/ThinkInAIXYZ/go-mcp/protocol"
 )
 
 // TestFormatLokiResults_TimestampParsing tests that timestamps from Loki are correctly parsed
@@ -35,7 +42,7 @@ func TestFormatLokiResults_TimestampParsing(t *testing.T) {
 	}
 
 	// Format the results
-	output, err := formatLokiResults(result)
+	output, err := formatLokiResults(result, "text")
 	if err != nil {
 		t.Fatalf("formatLokiResults failed: %v", err)
 	}
@@ -83,7 +90,7 @@ func TestFormatLokiResults_MultipleTimestamps(t *testing.T) {
 		},
 	}
 
-	output, err := formatLokiResults(result)
+	output, err := formatLokiResults(result, "text")
 	if err != nil {
 		t.Fatalf("formatLokiResults failed: %v", err)
 	}
@@ -119,7 +126,7 @@ func TestFormatLokiResults_InvalidTimestamp(t *testing.T) {
 		},
 	}
 
-	output, err := formatLokiResults(result)
+	output, err := formatLokiResults(result, "text")
 	if err != nil {
 		t.Fatalf("formatLokiResults failed: %v", err)
 	}
@@ -145,7 +152,7 @@ func TestFormatLokiResults_EmptyResult(t *testing.T) {
 		},
 	}
 
-	output, err := formatLokiResults(result)
+	output, err := formatLokiResults(result, "text")
 	if err != nil {
 		t.Fatalf("formatLokiResults failed: %v", err)
 	}
@@ -180,7 +187,7 @@ func TestFormatLokiResults_RecentTimestamp(t *testing.T) {
 		},
 	}
 
-	output, err := formatLokiResults(result)
+	output, err := formatLokiResults(result, "text")
 	if err != nil {
 		t.Fatalf("formatLokiResults failed: %v", err)
 	}
@@ -241,7 +248,7 @@ func TestFormatLokiResults_NoYear2262Bug(t *testing.T) {
 				},
 			}
 
-			output, err := formatLokiResults(result)
+			output, err := formatLokiResults(result, "text")
 			if err != nil {
 				t.Fatalf("formatLokiResults failed: %v", err)
 			}
@@ -258,3 +265,184 @@ func TestFormatLokiResults_NoYear2262Bug(t *testing.T) {
 		})
 	}
 }
+
+// TestBuildLokiQueryURL_Direction verifies the direction parameter is only sent when set
+func TestBuildLokiQueryURL_Direction(t *testing.T) {
+	testCases := []struct {
+		direction string
+		want      string
+	}{
+		{direction: "", want: ""},
+		{direction: "forward", want: "forward"},
+		{direction: "backward", want: "backward"},
+	}
+
+	for _, tc := range testCases {
+		queryURL, err := buildLokiQueryURL("http://localhost:3100", `{job="x"}`, 100, 200, 10, tc.direction)
+		if err != nil {
+			t.Fatalf("buildLokiQueryURL failed: %v", err)
+		}
+		u, _ := url.Parse(queryURL)
+		if got := u.Query().Get("direction"); got != tc.want {
+			t.Errorf("direction %q: expected parameter %q, got %q", tc.direction, tc.want, got)
+		}
+	}
+}
+
+// TestBuildLokiLabelsURL_Query verifies that a query selector is sent only when given, for label
+// names and label values alike
+func TestBuildLokiLabelsURL_Query(t *testing.T) {
+	for _, query := range []string{"", `{app="checkout"}`} {
+		labelsURL, err := buildLokiLabelsURL("http://localhost:3100", query, 100, 200)
+		if err != nil {
+			t.Fatalf("buildLokiLabelsURL failed: %v", err)
+		}
+		valuesURL, err := buildLokiLabelValuesURL("http://localhost:3100", "pod", query, 100, 200)
+		if err != nil {
+			t.Fatalf("buildLokiLabelValuesURL failed: %v", err)
+		}
+		for _, raw := range []string{labelsURL, valuesURL} {
+			u, _ := url.Parse(raw)
+			if got, ok := u.Query()["query"]; (query == "") == ok || (ok && got[0] != query) {
+				t.Errorf("query %q: expected it in %s only when set, got %v", query, raw, got)
+			}
+		}
+	}
+}
+
+// TestLokiHandlers_SubSecondRange verifies that a 500ms range reaches Loki as nanoseconds instead of
+// being widened to whole seconds
+func TestLokiHandlers_SubSecondRange(t *testing.T) {
+	var got url.Values
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.URL.Query()
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/labels"), strings.HasSuffix(r.URL.Path, "/values"):
+			w.Write([]byte(`{"status":"success","data":["a"]}`))
+		case strings.HasSuffix(r.URL.Path, "/series"):
+			w.Write([]byte(`{"status":"success","data":[]}`))
+		case strings.HasSuffix(r.URL.Path, "/index/stats"):
+			w.Write([]byte(`{"streams":1,"chunks":1,"entries":1,"bytes":1}`))
+		case strings.HasPrefix(r.URL.Query().Get("query"), "count_over_time"):
+			w.Write([]byte(`{"status":"success","data":{"resultType":"matrix","result":[]}}`))
+		default:
+			w.Write([]byte(`{"status":"success","data":{"resultType":"streams","result":[]}}`))
+		}
+	}))
+	defer server.Close()
+
+	for _, create := range []func() (*protocol.Tool, error){NewLokiQueryToolProtocol, NewLokiQueryRangeToolProtocol,
+		NewLokiLabelNamesToolProtocol, NewLokiLabelValuesToolProtocol, NewLokiSeriesToolProtocol, NewLokiStatsToolProtocol} {
+		if _, err := create(); err != nil {
+			t.Fatalf("Failed to create tool: %v", err)
+		}
+	}
+
+	start, end := "2024-01-15T10:00:00.250Z", "2024-01-15T10:00:00.750Z"
+	testCases := []struct {
+		name   string
+		handle func(context.Context, *protocol.CallToolRequest) (*protocol.CallToolResult, error)
+		args   map[string]any
+	}{
+		{"loki_query", HandleLokiQueryProtocol, map[string]any{"query": `{job="a"}`}},
+		{"loki_query_range", HandleLokiQueryRangeProtocol, map[string]any{"query": `count_over_time({job="a"}[1s])`}},
+		{"loki_label_names", HandleLokiLabelNamesProtocol, map[string]any{}},
+		{"loki_label_values", HandleLokiLabelValuesProtocol, map[string]any{"label": "job"}},
+		{"loki_series", HandleLokiSeriesProtocol, map[string]any{"match": `{job="a"}`}},
+		{"loki_stats", HandleLokiStatsProtocol, map[string]any{"query": `{job="a"}`}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got = nil
+			tc.args["url"], tc.args["start"], tc.args["end"] = server.URL, start, end
+			raw, _ := json.Marshal(tc.args)
+			if _, err := tc.handle(context.Background(), &protocol.CallToolRequest{Name: tc.name, RawArguments: raw}); err != nil {
+				t.Fatalf("%s failed: %v", tc.name, err)
+			}
+			if got.Get("start") != "1705312800250000000" || got.Get("end") != "1705312800750000000" {
+				t.Errorf("Expected the 500ms range in nanoseconds, got start=%s end=%s", got.Get("start"), got.Get("end"))
+			}
+		})
+	}
+}
+
+// TestParseDirection verifies that only forward and backward are accepted
+func TestParseDirection(t *testing.T) {
+	for _, valid := range []string{"", "forward", "backward"} {
+		if _, err := parseDirection(valid); err != nil {
+			t.Errorf("Unexpected error for %q: %v", valid, err)
+		}
+	}
+	for _, invalid := range []string{"up", "Forward", "asc"} {
+		if _, err := parseDirection(invalid); err == nil || !strings.Contains(err.Error(), "must be forward or backward") {
+			t.Errorf("Expected clear error for %q, got %v", invalid, err)
+		}
+	}
+}
+
+// TestParseTime verifies absolute, relative and Unix timestamp formats
+func TestParseTime(t *testing.T) {
+	testCases := []struct {
+		name  string
+		input string
+		want  time.Time
+	}{
+		{name: "RFC3339 UTC", input: "2024-01-02T15:04:05Z", want: time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC)},
+		{name: "RFC3339 offset", input: "2024-01-02T15:04:05+02:00", want: time.Date(2024, 1, 2, 13, 4, 5, 0, time.UTC)},
+		{name: "RFC3339Nano", input: "2024-01-02T15:04:05.123456789Z", want: time.Date(2024, 1, 2, 15, 4, 5, 123456789, time.UTC)},
+		{name: "Date and time", input: "2024-01-02 15:04:05", want: time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC)},
+		{name: "Date only", input: "2024-01-02", want: time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)},
+		{name: "Unix seconds", input: "1705312245", want: time.Unix(1705312245, 0)},
+		{name: "Unix fractional seconds", input: "1705312245.5", want: time.Unix(1705312245, 500000000)},
+		{name: "Unix milliseconds", input: "1705312245123", want: time.UnixMilli(1705312245123)},
+		{name: "Unix microseconds", input: "1705312245123456", want: time.UnixMicro(1705312245123456)},
+		{name: "Unix nanoseconds", input: "1705312245123456789", want: time.Unix(0, 1705312245123456789)},
+		{name: "Unix zero", input: "0", want: time.Unix(0, 0)},
+		{name: "Largest seconds", input: "99999999999", want: time.Unix(99999999999, 0)},
+		{name: "Smallest milliseconds", input: "100000000000", want: time.UnixMilli(100000000000)},
+		{name: "Surrounding whitespace", input: " 1705312245 ", want: time.Unix(1705312245, 0)},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := parseTime(tc.input, time.UTC)
+			if err != nil {
+				t.Fatalf("parseTime(%q) failed: %v", tc.input, err)
+			}
+			if !got.Equal(tc.want) {
+				t.Errorf("parseTime(%q) = %v, want %v", tc.input, got, tc.want)
+			}
+		})
+	}
+}
+
+// TestParseTime_Relative verifies "now" and relative durations
+func TestParseTime_Relative(t *testing.T) {
+	before := time.Now()
+	got, err := parseTime("-1h", time.UTC)
+	if err != nil {
+		t.Fatalf("parseTime(-1h) failed: %v", err)
+	}
+	if diff := before.Add(-time.Hour).Sub(got); diff > time.Second || diff < -time.Second {
+		t.Errorf("Expected about one hour ago, got %v", got)
+	}
+
+	got, err = parseTime("now", time.UTC)
+	if err != nil || got.Before(before) {
+		t.Errorf("Expected now, got %v (%v)", got, err)
+	}
+}
+
+// TestParseTime_Invalid verifies that unsupported input lists the accepted formats
+func TestParseTime_Invalid(t *testing.T) {
+	for _, input := range []string{"", "yesterday", "-5", "+1705312245", "1705312245.5.1", "2024-13-45", "100000000000.5"} {
+		_, err := parseTime(input, time.UTC)
+		if err == nil {
+			t.Errorf("Expected error for %q", input)
+			continue
+		}
+		if !strings.Contains(err.Error(), "accepted formats") || !strings.Contains(err.Error(), "Unix timestamps") {
+			t.Errorf("Expected error listing accepted formats for %q, got %v", input, err)
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package handlers
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// Environment variable name for the longest time range a query may cover
+const EnvLokiMaxTimeRange = "LOKI_MAX_TIME_RANGE"
+
+// LokiMaxTimeRange returns the longest time range a query may cover from LOKI_MAX_TIME_RANGE, as a
+// duration such as 168h or seconds. Zero means the variable is unset and ranges are not limited.
+func LokiMaxTimeRange() (time.Duration, error) {
+	value := os.Getenv(EnvLokiMaxTimeRange)
+	if value == "" {
+		return 0, nil
+	}
+	return parsePositiveDuration(EnvLokiMaxTimeRange, value)
+}
+
+// checkLokiTimeRange reports an error when the range from start to end is longer than
+// LOKI_MAX_TIME_RANGE, unless the caller set allowLargeRange to scan it anyway
+func checkLokiTimeRange(start, end time.Time, allowLargeRange bool) error {
+	maxRange, err := LokiMaxTimeRange()
+	if err != nil || maxRange == 0 || allowLargeRange {
+		return err
+	}
+
+	if span := end.Sub(start); span > maxRange {
+		return fmt.Errorf("time range of %s exceeds %s of %s: narrow start and end, e.g. start=now-%s, or set allowLargeRange to query the whole range anyway",
+			formatLokiLookback(span), EnvLokiMaxTimeRange, formatLokiLookback(maxRange), formatLokiLookback(maxRange))
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ThinkInAIXYZ/go-mcp/protocol"
+)
+
+// TestCheckLokiTimeRange verifies the limit, the override and invalid values
+func TestCheckLokiTimeRange(t *testing.T) {
+	end := time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)
+
+	t.Setenv(EnvLokiMaxTimeRange, "")
+	if err := checkLokiTimeRange(end.Add(-365*24*time.Hour), end, false); err != nil {
+		t.Errorf("Expected no limit when unset, got %v", err)
+	}
+
+	t.Setenv(EnvLokiMaxTimeRange, "168h")
+	if err := checkLokiTimeRange(end.Add(-168*time.Hour), end, false); err != nil {
+		t.Errorf("Expected a range of exactly 168h to pass, got %v", err)
+	}
+	err := checkLokiTimeRange(end.Add(-30*24*time.Hour), end, false)
+	want := "time range of 30d exceeds LOKI_MAX_TIME_RANGE of 7d: narrow start and end, e.g. start=now-7d, or set allowLargeRange"
+	if err == nil || !strings.Contains(err.Error(), want) {
+		t.Errorf("Expected error containing %q, got %v", want, err)
+	}
+	if err := checkLokiTimeRange(end.Add(-30*24*time.Hour), end, true); err != nil {
+		t.Errorf("Expected allowLargeRange to lift the limit, got %v", err)
+	}
+
+	t.Setenv(EnvLokiMaxTimeRange, "a week")
+	if err := checkLokiTimeRange(end.Add(-time.Hour), end, true); err == nil || !strings.Contains(err.Error(), "invalid LOKI_MAX_TIME_RANGE") {
+		t.Errorf("Expected invalid LOKI_MAX_TIME_RANGE error, got %v", err)
+	}
+}
+
+// TestLokiMaxTimeRange_Handlers verifies that the tools refuse long ranges without calling Loki,
+// unless allowLargeRange is set
+func TestLokiMaxTimeRange_Handlers(t *testing.T) {
+	t.Setenv(EnvLokiMaxTimeRange, "24h")
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if strings.HasSuffix(r.URL.Path, "/labels") {
+			w.Write([]byte(`{"status":"success","data":["job"]}`))
+			return
+		}
+		w.Write([]byte(`{"status":"success","data":{"resultType":"streams","result":[]}}`))
+	}))
+	defer server.Close()
+
+	if _, err := NewLokiQueryToolProtocol(); err != nil {
+		t.Fatalf("Failed to create tool: %v", err)
+	}
+	if _, err := NewLokiLabelNamesToolProtocol(); err != nil {
+		t.Fatalf("Failed to create tool: %v", err)
+	}
+
+	handlers := map[string]func(context.Context, *protocol.CallToolRequest) (*protocol.CallToolResult, error){
+		"loki_query":       HandleLokiQueryProtocol,
+		"loki_label_names": HandleLokiLabelNamesProtocol,
+	}
+	for name, handle := range handlers {
+		args := map[string]any{"query": `{job="a"}`, "url": server.URL, "start": "2024-01-01T00:00:00Z", "end": "2024-01-03T00:00:00Z"}
+		raw, _ := json.Marshal(args)
+		_, err := handle(context.Background(), &protocol.CallToolRequest{Name: name, RawArguments: raw})
+		if err == nil || !strings.Contains(err.Error(), "time range of 2d exceeds LOKI_MAX_TIME_RANGE of 1d") {
+			t.Errorf("%s: expected time range error, got %v", name, err)
+		}
+		if calls != 0 {
+			t.Errorf("%s: expected no request to Loki, got %d", name, calls)
+		}
+
+		args["allowLargeRange"] = true
+		raw, _ = json.Marshal(args)
+		if _, err := handle(context.Background(), &protocol.CallToolRequest{Name: name, RawArguments: raw}); err != nil {
+			t.Errorf("%s: expected allowLargeRange to pass, got %v", name, err)
+		}
+		if calls != 1 {
+			t.Errorf("%s: expected one request to Loki, got %d", name, calls)
+		}
+		calls = 0
+	}
+}
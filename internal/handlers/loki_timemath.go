@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Units accepted in Grafana-style time expressions
+const timeMathUnits = "s, m, h, d or w"
+
+// parseTimeMath evaluates a Grafana-style relative time expression such as now-15m, now/d or
+// now-1w/w, following the grammar now([-+]<num><unit>|/<unit>)*. Offsets and rounding are applied
+// left to right in loc, so days and weeks follow its calendar and daylight saving changes, and
+// weeks start on Monday. Rounding truncates to the start of the unit, or with roundUp, moves to
+// its last millisecond like Grafana does for the end of a range. ok is false when expr does not
+// start with "now"; err reports a malformed expression that does.
+func parseTimeMath(expr string, now time.Time, loc *time.Location, roundUp bool) (t time.Time, ok bool, err error) {
+	if len(expr) < 3 || expr[:3] != "now" {
+		return time.Time{}, false, nil
+	}
+
+	t = now.In(loc)
+	rest := expr[3:]
+	for rest != "" {
+		op := rest[0]
+		rest = rest[1:]
+
+		switch op {
+		case '/':
+			if rest == "" {
+				return time.Time{}, true, fmt.Errorf("invalid time expression %q: missing unit after '/'", expr)
+			}
+			if t, err = roundTimeMath(t, rest[0], roundUp); err != nil {
+				return time.Time{}, true, fmt.Errorf("invalid time expression %q: %v", expr, err)
+			}
+			rest = rest[1:]
+
+		case '-', '+':
+			digits := 0
+			for digits < len(rest) && rest[digits] >= '0' && rest[digits] <= '9' {
+				digits++
+			}
+			if digits == 0 || digits == len(rest) {
+				return time.Time{}, true, fmt.Errorf("invalid time expression %q: expected a number and unit after '%c'", expr, op)
+			}
+			var n int
+			if n, err = strconv.Atoi(rest[:digits]); err != nil {
+				return time.Time{}, true, fmt.Errorf("invalid time expression %q: %v", expr, err)
+			}
+			if op == '-' {
+				n = -n
+			}
+			if t, err = offsetTimeMath(t, n, rest[digits]); err != nil {
+				return time.Time{}, true, fmt.Errorf("invalid time expression %q: %v", expr, err)
+			}
+			rest = rest[digits+1:]
+
+		default:
+			return time.Time{}, true, fmt.Errorf("invalid time expression %q: unexpected %q, expected '-', '+' or '/'", expr, op)
+		}
+	}
+	return t, true, nil
+}
+
+// offsetTimeMath moves t by n units
+func offsetTimeMath(t time.Time, n int, unit byte) (time.Time, error) {
+	switch unit {
+	case 's':
+		return t.Add(time.Duration(n) * time.Second), nil
+	case 'm':
+		return t.Add(time.Duration(n) * time.Minute), nil
+	case 'h':
+		return t.Add(time.Duration(n) * time.Hour), nil
+	case 'd':
+		return t.AddDate(0, 0, n), nil
+	case 'w':
+		return t.AddDate(0, 0, 7*n), nil
+	default:
+		return time.Time{}, fmt.Errorf("unknown unit %q, expected %s", unit, timeMathUnits)
+	}
+}
+
+// roundTimeMath truncates t to the start of its unit, or with roundUp, to the last millisecond of it
+func roundTimeMath(t time.Time, unit byte, roundUp bool) (time.Time, error) {
+	year, month, day := t.Date()
+	loc := t.Location()
+
+	var start, next time.Time
+	switch unit {
+	case 's':
+		start = time.Date(year, month, day, t.Hour(), t.Minute(), t.Second(), 0, loc)
+		next = start.Add(time.Second)
+	case 'm':
+		start = time.Date(year, month, day, t.Hour(), t.Minute(), 0, 0, loc)
+		next = start.Add(time.Minute)
+	case 'h':
+		start = time.Date(year, month, day, t.Hour(), 0, 0, 0, loc)
+		next = start.Add(time.Hour)
+	case 'd':
+		start = time.Date(year, month, day, 0, 0, 0, 0, loc)
+		next = start.AddDate(0, 0, 1)
+	case 'w':
+		sinceMonday := (int(t.Weekday()) + 6) % 7
+		start = time.Date(year, month, day-sinceMonday, 0, 0, 0, 0, loc)
+		next = start.AddDate(0, 0, 7)
+	default:
+		return time.Time{}, fmt.Errorf("unknown unit %q, expected %s", unit, timeMathUnits)
+	}
+
+	if roundUp {
+		return next.Add(-time.Millisecond), nil
+	}
+	return start, nil
+}
@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestParseTimeMath verifies offsets, rounding and their combinations
+func TestParseTimeMath(t *testing.T) {
+	// Thursday 2024-03-14 15:37:42.5 UTC
+	now := time.Date(2024, 3, 14, 15, 37, 42, 500000000, time.UTC)
+
+	testCases := []struct {
+		expr    string
+		roundUp bool
+		want    time.Time
+	}{
+		{expr: "now", want: now},
+		{expr: "now-5m", want: time.Date(2024, 3, 14, 15, 32, 42, 500000000, time.UTC)},
+		{expr: "now+2h", want: time.Date(2024, 3, 14, 17, 37, 42, 500000000, time.UTC)},
+		{expr: "now-90s", want: time.Date(2024, 3, 14, 15, 36, 12, 500000000, time.UTC)},
+		{expr: "now-1d", want: time.Date(2024, 3, 13, 15, 37, 42, 500000000, time.UTC)},
+		{expr: "now-2w", want: time.Date(2024, 2, 29, 15, 37, 42, 500000000, time.UTC)},
+		{expr: "now/s", want: time.Date(2024, 3, 14, 15, 37, 42, 0, time.UTC)},
+		{expr: "now/m", want: time.Date(2024, 3, 14, 15, 37, 0, 0, time.UTC)},
+		{expr: "now/h", want: time.Date(2024, 3, 14, 15, 0, 0, 0, time.UTC)},
+		{expr: "now/d", want: time.Date(2024, 3, 14, 0, 0, 0, 0, time.UTC)},
+		{expr: "now/w", want: time.Date(2024, 3, 11, 0, 0, 0, 0, time.UTC)},
+		{expr: "now-1d/d", want: time.Date(2024, 3, 13, 0, 0, 0, 0, time.UTC)},
+		{expr: "now-1w/w", want: time.Date(2024, 3, 4, 0, 0, 0, 0, time.UTC)},
+		{expr: "now/d-6h", want: time.Date(2024, 3, 13, 18, 0, 0, 0, time.UTC)},
+		{expr: "now-1d-12h", want: time.Date(2024, 3, 13, 3, 37, 42, 500000000, time.UTC)},
+		{expr: "now/d", roundUp: true, want: time.Date(2024, 3, 14, 23, 59, 59, 999000000, time.UTC)},
+		{expr: "now-1d/d", roundUp: true, want: time.Date(2024, 3, 13, 23, 59, 59, 999000000, time.UTC)},
+		{expr: "now-1w/w", roundUp: true, want: time.Date(2024, 3, 10, 23, 59, 59, 999000000, time.UTC)},
+		{expr: "now/h", roundUp: true, want: time.Date(2024, 3, 14, 15, 59, 59, 999000000, time.UTC)},
+		{expr: "now-5m", roundUp: true, want: time.Date(2024, 3, 14, 15, 32, 42, 500000000, time.UTC)},
+	}
+
+	for _, tc := range testCases {
+		got, ok, err := parseTimeMath(tc.expr, now, time.UTC, tc.roundUp)
+		if !ok || err != nil {
+			t.Errorf("parseTimeMath(%q) failed: ok=%v err=%v", tc.expr, ok, err)
+			continue
+		}
+		if !got.Equal(tc.want) {
+			t.Errorf("parseTimeMath(%q, roundUp=%v) = %v, want %v", tc.expr, tc.roundUp, got, tc.want)
+		}
+	}
+}
+
+// TestParseTimeMath_Sunday verifies that weeks start on Monday even when now is a Sunday
+func TestParseTimeMath_Sunday(t *testing.T) {
+	now := time.Date(2024, 3, 17, 10, 0, 0, 0, time.UTC)
+	got, _, err := parseTimeMath("now/w", now, time.UTC, false)
+	if err != nil {
+		t.Fatalf("parseTimeMath failed: %v", err)
+	}
+	if want := time.Date(2024, 3, 11, 0, 0, 0, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+}
+
+// TestParseTimeMath_Timezone verifies that rounding follows the calendar of the location
+func TestParseTimeMath_Timezone(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatalf("Failed to load location: %v", err)
+	}
+
+	// 02:00 UTC on March 10th is still March 9th in New York
+	now := time.Date(2024, 3, 10, 2, 0, 0, 0, time.UTC)
+	got, _, err := parseTimeMath("now/d", now, newYork, false)
+	if err != nil {
+		t.Fatalf("parseTimeMath failed: %v", err)
+	}
+	if want := time.Date(2024, 3, 9, 0, 0, 0, 0, newYork); !got.Equal(want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+
+	// March 10th 2024 is 23 hours long in New York; a day offset keeps the wall clock time
+	now = time.Date(2024, 3, 10, 5, 0, 0, 0, time.UTC)
+	got, _, err = parseTimeMath("now+1d", now, newYork, false)
+	if err != nil {
+		t.Fatalf("parseTimeMath failed: %v", err)
+	}
+	if want := time.Date(2024, 3, 11, 0, 0, 0, 0, newYork); !got.Equal(want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+}
+
+// TestParseTimeMath_Invalid verifies malformed expressions and inputs that are not expressions
+func TestParseTimeMath_Invalid(t *testing.T) {
+	now := time.Now()
+	for _, expr := range []string{"now-", "now-5", "now-m", "now/", "now/x", "now-5y", "now*2", "now 5m", "nowish"} {
+		_, ok, err := parseTimeMath(expr, now, time.UTC, false)
+		if !ok || err == nil || !strings.Contains(err.Error(), "invalid time expression") {
+			t.Errorf("Expected invalid time expression error for %q, got ok=%v err=%v", expr, ok, err)
+		}
+	}
+
+	for _, value := range []string{"", "-1h", "2024-01-02", "1705312245"} {
+		if _, ok, _ := parseTimeMath(value, now, time.UTC, false); ok {
+			t.Errorf("Expected %q not to be treated as a time expression", value)
+		}
+	}
+}
+
+// TestParseEndTime verifies that only end times round up to the end of the unit
+func TestParseEndTime(t *testing.T) {
+	start, err := parseTime("now/d", time.UTC)
+	if err != nil {
+		t.Fatalf("parseTime failed: %v", err)
+	}
+	end, err := parseEndTime("now/d", time.UTC)
+	if err != nil {
+		t.Fatalf("parseEndTime failed: %v", err)
+	}
+	if got := end.Sub(start); got != 24*time.Hour-time.Millisecond {
+		t.Errorf("Expected now/d to now/d to span a whole day, got %v", got)
+	}
+
+	if _, err := parseTime("now-15m", time.UTC); err != nil {
+		t.Errorf("parseTime(now-15m) failed: %v", err)
+	}
+	if _, err := parseTime("now-15x", time.UTC); err == nil || !strings.Contains(err.Error(), "unknown unit") {
+		t.Errorf("Expected unknown unit error, got %v", err)
+	}
+}
@@ -0,0 +1,29 @@
+package handlers
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// Environment variable name for the IANA timezone used to read times given without a zone
+const EnvLokiTimezone = "LOKI_TIMEZONE"
+
+// resolveLokiTimezone returns the location used for absolute times without an explicit zone,
+// taken from the request, then LOKI_TIMEZONE, and defaulting to UTC
+func resolveLokiTimezone(value string) (*time.Location, error) {
+	source := "timezone"
+	if value == "" {
+		value = os.Getenv(EnvLokiTimezone)
+		source = EnvLokiTimezone
+	}
+	if value == "" {
+		return time.UTC, nil
+	}
+
+	loc, err := time.LoadLocation(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s %q: expected an IANA zone name such as America/New_York or UTC", source, value)
+	}
+	return loc, nil
+}
@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ThinkInAIXYZ/go-mcp/protocol"
+)
+
+// TestResolveLokiTimezone verifies request, environment and default timezones
+func TestResolveLokiTimezone(t *testing.T) {
+	testCases := []struct {
+		name      string
+		requested string
+		env       string
+		want      string
+		wantErr   string
+	}{
+		{name: "Default UTC", want: "UTC"},
+		{name: "From env", env: "America/New_York", want: "America/New_York"},
+		{name: "Request overrides env", requested: "Asia/Tokyo", env: "America/New_York", want: "Asia/Tokyo"},
+		{name: "Invalid request", requested: "Mars/Olympus", wantErr: `invalid timezone "Mars/Olympus"`},
+		{name: "Invalid env", env: "Nowhere", wantErr: `invalid LOKI_TIMEZONE "Nowhere"`},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv(EnvLokiTimezone, tc.env)
+
+			loc, err := resolveLokiTimezone(tc.requested)
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("Expected error containing %q, got %v", tc.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("resolveLokiTimezone failed: %v", err)
+			}
+			if loc.String() != tc.want {
+				t.Errorf("Expected %s, got %s", tc.want, loc)
+			}
+		})
+	}
+}
+
+// TestParseTime_Timezone verifies that only times without a zone are read in the location
+func TestParseTime_Timezone(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatalf("Failed to load location: %v", err)
+	}
+
+	testCases := []struct {
+		input string
+		want  time.Time
+	}{
+		{input: "2024-01-02 15:04:05", want: time.Date(2024, 1, 2, 20, 4, 5, 0, time.UTC)},
+		{input: "2024-07-02T15:04:05", want: time.Date(2024, 7, 2, 19, 4, 5, 0, time.UTC)},
+		{input: "2024-01-02", want: time.Date(2024, 1, 2, 5, 0, 0, 0, time.UTC)},
+		{input: "2024-01-02T15:04:05Z", want: time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC)},
+		{input: "1705312245", want: time.Unix(1705312245, 0)},
+	}
+
+	for _, tc := range testCases {
+		got, err := parseTime(tc.input, newYork)
+		if err != nil {
+			t.Fatalf("parseTime(%q) failed: %v", tc.input, err)
+		}
+		if !got.Equal(tc.want) {
+			t.Errorf("parseTime(%q) = %v, want %v", tc.input, got.UTC(), tc.want)
+		}
+	}
+}
+
+// TestHandleLokiQueryProtocol_Timezone verifies that the timezone shifts the range sent to Loki
+func TestHandleLokiQueryProtocol_Timezone(t *testing.T) {
+	var lastStart string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lastStart = r.URL.Query().Get("start")
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"status":"success","data":{"resultType":"streams","result":[]}}`))
+	}))
+	defer server.Close()
+
+	for _, env := range []string{EnvLokiURL, EnvLokiOrgID, EnvLokiUsername, EnvLokiPassword, EnvLokiToken, EnvLokiTimezone} {
+		t.Setenv(env, "")
+	}
+
+	if _, err := NewLokiQueryToolProtocol(); err != nil {
+		t.Fatalf("Failed to create tool: %v", err)
+	}
+
+	call := func(timezone string) error {
+		args := map[string]any{"query": `{job="x"}`, "url": server.URL, "start": "2024-01-02 00:00:00", "end": "2024-01-03 00:00:00"}
+		if timezone != "" {
+			args["timezone"] = timezone
+		}
+		raw, _ := json.Marshal(args)
+		_, err := HandleLokiQueryProtocol(context.Background(), &protocol.CallToolRequest{Name: "loki_query", RawArguments: raw})
+		return err
+	}
+
+	if err := call(""); err != nil {
+		t.Fatalf("HandleLokiQueryProtocol failed: %v", err)
+	}
+	if lastStart != "1704153600000000000" {
+		t.Errorf("Expected start at UTC midnight 1704153600000000000, got %s", lastStart)
+	}
+
+	if err := call("Asia/Kolkata"); err != nil {
+		t.Fatalf("HandleLokiQueryProtocol failed: %v", err)
+	}
+	if lastStart != "1704133800000000000" {
+		t.Errorf("Expected start at Kolkata midnight 1704133800000000000, got %s", lastStart)
+	}
+
+	if err := call("Not/AZone"); err == nil || !strings.Contains(err.Error(), "IANA") {
+		t.Errorf("Expected invalid timezone error, got %v", err)
+	}
+}
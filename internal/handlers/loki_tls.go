@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+)
+
+// Environment variable name for a PEM bundle of CA certificates trusted for Loki
+const EnvLokiCACert = "LOKI_CA_CERT"
+
+// Environment variable name for skipping TLS certificate verification of Loki
+const EnvLokiTLSInsecure = "LOKI_TLS_INSECURE"
+
+// Environment variable name for the PEM client certificate presented to Loki
+const EnvLokiClientCert = "LOKI_CLIENT_CERT"
+
+// Environment variable name for the PEM private key of the Loki client certificate
+const EnvLokiClientKey = "LOKI_CLIENT_KEY"
+
+// lokiTLSSettings holds the TLS options read from the environment
+type lokiTLSSettings struct {
+	CACert     string
+	Insecure   bool
+	ClientCert string
+	ClientKey  string
+}
+
+// loadLokiTLSSettings reads the TLS options from the environment
+func loadLokiTLSSettings() (lokiTLSSettings, error) {
+	settings := lokiTLSSettings{
+		CACert:     os.Getenv(EnvLokiCACert),
+		ClientCert: os.Getenv(EnvLokiClientCert),
+		ClientKey:  os.Getenv(EnvLokiClientKey),
+	}
+
+	if (settings.ClientCert == "") != (settings.ClientKey == "") {
+		return lokiTLSSettings{}, fmt.Errorf("%s and %s must be set together", EnvLokiClientCert, EnvLokiClientKey)
+	}
+
+	if value := os.Getenv(EnvLokiTLSInsecure); value != "" {
+		insecure, err := strconv.ParseBool(value)
+		if err != nil {
+			return lokiTLSSettings{}, fmt.Errorf("invalid %s: %q must be true or false", EnvLokiTLSInsecure, value)
+		}
+		settings.Insecure = insecure
+	}
+
+	return settings, nil
+}
+
+// CheckLokiTLS loads the TLS configuration from the environment so that missing or invalid
+// certificates are reported at startup rather than on the first query
+func CheckLokiTLS() error {
+	_, err := lokiHTTPClient()
+	return err
+}
+
+// buildLokiTLSConfig creates a TLS configuration trusting the system roots plus any CA bundle,
+// and presenting the client certificate when one is configured
+func buildLokiTLSConfig(settings lokiTLSSettings) (*tls.Config, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if settings.CACert != "" {
+		pem, err := os.ReadFile(settings.CACert)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %v", EnvLokiCACert, err)
+		}
+
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("failed to parse %s: no PEM certificates found in %s", EnvLokiCACert, settings.CACert)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if settings.ClientCert != "" {
+		cert, err := tls.LoadX509KeyPair(settings.ClientCert, settings.ClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate from %s and %s: %v", EnvLokiClientCert, EnvLokiClientKey, err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	if settings.Insecure {
+		slog.Warn(fmt.Sprintf("%s is enabled, TLS certificates presented by Loki will not be verified", EnvLokiTLSInsecure))
+		tlsConfig.InsecureSkipVerify = true
+	}
+
+	return tlsConfig, nil
+}
@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestLokiTransport_TLS verifies that a private CA bundle and the insecure toggle are honored
+func TestLokiTransport_TLS(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"status":"success","data":["job"]}`))
+	}))
+	defer server.Close()
+
+	caPath := filepath.Join(t.TempDir(), "ca.pem")
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err := os.WriteFile(caPath, caPEM, 0o600); err != nil {
+		t.Fatalf("Failed to write CA bundle: %v", err)
+	}
+	badPath := filepath.Join(t.TempDir(), "bad.pem")
+	if err := os.WriteFile(badPath, []byte("not a certificate"), 0o600); err != nil {
+		t.Fatalf("Failed to write bad bundle: %v", err)
+	}
+
+	t.Setenv(EnvLokiMaxRetries, "0")
+
+	testCases := []struct {
+		name     string
+		caCert   string
+		insecure string
+		wantErr  string
+	}{
+		{name: "Untrusted", wantErr: "certificate"},
+		{name: "Custom CA", caCert: caPath},
+		{name: "Insecure", insecure: "true"},
+		{name: "Missing CA file", caCert: filepath.Join(t.TempDir(), "missing.pem"), wantErr: "failed to read LOKI_CA_CERT"},
+		{name: "Invalid CA file", caCert: badPath, wantErr: "no PEM certificates found"},
+		{name: "Invalid insecure flag", insecure: "maybe", wantErr: "invalid LOKI_TLS_INSECURE"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv(EnvLokiCACert, tc.caCert)
+			t.Setenv(EnvLokiTLSInsecure, tc.insecure)
+
+			_, err := doLokiRequest(context.Background(), server.URL, "", "", "", "")
+			if tc.wantErr == "" && err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+			if tc.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tc.wantErr)) {
+				t.Errorf("Expected error containing %q, got %v", tc.wantErr, err)
+			}
+		})
+	}
+}
+
+// writeTestClientCert generates a self-signed client certificate and returns its PEM paths
+func writeTestClientCert(t *testing.T) (*x509.Certificate, string, string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "loki-mcp-test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("Failed to marshal key: %v", err)
+	}
+
+	dir := t.TempDir()
+	certPath := filepath.Join(dir, "client.pem")
+	keyPath := filepath.Join(dir, "client-key.pem")
+	os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600)
+	os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600)
+	return cert, certPath, keyPath
+}
+
+// TestLokiTransport_ClientCertificate verifies mutual TLS against a server requiring client certificates
+func TestLokiTransport_ClientCertificate(t *testing.T) {
+	clientCert, certPath, keyPath := writeTestClientCert(t)
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"status":"success","data":["job"]}`))
+	}))
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(clientCert)
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clientCAs}
+	server.StartTLS()
+	defer server.Close()
+
+	caPath := filepath.Join(t.TempDir(), "ca.pem")
+	os.WriteFile(caPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0o600)
+
+	t.Setenv(EnvLokiMaxRetries, "0")
+	t.Setenv(EnvLokiTLSInsecure, "")
+	t.Setenv(EnvLokiCACert, caPath)
+
+	testCases := []struct {
+		name    string
+		cert    string
+		key     string
+		wantErr string
+	}{
+		{name: "With client certificate", cert: certPath, key: keyPath},
+		{name: "Without client certificate", wantErr: "tls"},
+		{name: "Only certificate", cert: certPath, wantErr: "must be set together"},
+		{name: "Only key", key: keyPath, wantErr: "must be set together"},
+		{name: "Mismatched pair", cert: certPath, key: caPath, wantErr: "failed to load client certificate"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv(EnvLokiClientCert, tc.cert)
+			t.Setenv(EnvLokiClientKey, tc.key)
+
+			_, err := doLokiRequest(context.Background(), server.URL, "", "", "", "")
+			if tc.wantErr == "" && err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+			if tc.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tc.wantErr)) {
+				t.Errorf("Expected error containing %q, got %v", tc.wantErr, err)
+			}
+		})
+	}
+}
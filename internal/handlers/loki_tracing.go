@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Environment variable name for the OTLP collector endpoint; tracing is enabled only when it is set
+const EnvOTelExporterEndpoint = "OTEL_EXPORTER_OTLP_ENDPOINT"
+
+// Environment variable name for an OTLP endpoint used for traces only
+const EnvOTelExporterTracesEndpoint = "OTEL_EXPORTER_OTLP_TRACES_ENDPOINT"
+
+// Service name reported with spans unless OTEL_SERVICE_NAME is set
+const defaultTracingServiceName = "loki-mcp-server"
+
+// Name of the tracer creating the spans of this package
+const tracerName = "github.com/scottlepp/loki-mcp/internal/handlers"
+
+// InitLokiTracing sets up OpenTelemetry tracing with an OTLP/HTTP exporter when an OTLP
+// endpoint is configured. Otherwise the global no-op tracer stays in place, so spans cost
+// nothing. The returned function flushes pending spans and must be called on shutdown.
+func InitLokiTracing(ctx context.Context) (func(context.Context) error, error) {
+	if os.Getenv(EnvOTelExporterEndpoint) == "" && os.Getenv(EnvOTelExporterTracesEndpoint) == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	// The exporter reads the endpoint, headers and protocol options from the standard OTEL_* variables
+	exporter, err := otlptracehttp.New(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create OTLP trace exporter: %v", err)
+	}
+
+	res, err := resource.New(ctx,
+		resource.WithAttributes(attribute.String("service.name", defaultTracingServiceName)),
+		resource.WithFromEnv(),
+		resource.WithTelemetrySDK(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create trace resource: %v", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	return provider.Shutdown, nil
+}
+
+// TraceHTTPHandler continues the trace of incoming requests that carry W3C trace context headers
+func TraceHTTPHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// lokiTracer returns the tracer of the current global provider
+func lokiTracer() trace.Tracer {
+	return otel.Tracer(tracerName)
+}
+
+// startLokiToolSpan starts the span of a tool call
+func startLokiToolSpan(ctx context.Context, tool, query, org string) (context.Context, trace.Span) {
+	ctx, span := lokiTracer().Start(ctx, "tool "+tool,
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(attribute.String("mcp.tool.name", tool)))
+	if query != "" {
+		span.SetAttributes(attribute.String("loki.query", query))
+	}
+	if org != "" {
+		span.SetAttributes(attribute.String("loki.org", org))
+	}
+	return ctx, span
+}
+
+// startLokiRequestSpan starts the client span of an HTTP request to Loki
+func startLokiRequestSpan(ctx context.Context, req *http.Request, orgID string) (context.Context, trace.Span) {
+	ctx, span := lokiTracer().Start(ctx, "loki "+lokiEndpoint(req.URL.String()),
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("http.request.method", req.Method),
+			attribute.String("server.address", req.URL.Host),
+			attribute.String("url.path", req.URL.Path),
+		))
+	if orgID != "" {
+		span.SetAttributes(attribute.String("loki.org", orgID))
+	}
+	if query := req.URL.Query().Get("query"); query != "" {
+		span.SetAttributes(attribute.String("loki.query", query))
+	}
+
+	// Propagate the trace context to Loki
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+	return ctx, span
+}
+
+// setLokiSpanStatusCode records the status code of a Loki response on the span in ctx
+func setLokiSpanStatusCode(ctx context.Context, statusCode int) {
+	trace.SpanFromContext(ctx).SetAttributes(attribute.Int("http.response.status_code", statusCode))
+}
+
+// endLokiSpan marks span as failed when err is set and ends it
+func endLokiSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// setLokiSpanEntries records the number of log entries or samples a tool call returned
+func setLokiSpanEntries(ctx context.Context, entries int) {
+	trace.SpanFromContext(ctx).SetAttributes(attribute.Int("loki.entries", entries))
+}
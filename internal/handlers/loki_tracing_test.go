@@ -0,0 +1,164 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ThinkInAIXYZ/go-mcp/protocol"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// useTestTracer installs a tracer provider recording spans in memory for the duration of the test
+func useTestTracer(t *testing.T) *tracetest.SpanRecorder {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+	previousProvider := otel.GetTracerProvider()
+	previousPropagator := otel.GetTextMapPropagator()
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		otel.SetTracerProvider(previousProvider)
+		otel.SetTextMapPropagator(previousPropagator)
+	})
+	return recorder
+}
+
+// spanAttributes returns the attributes of a span as a map
+func spanAttributes(span sdktrace.ReadOnlySpan) map[attribute.Key]attribute.Value {
+	attrs := make(map[attribute.Key]attribute.Value)
+	for _, kv := range span.Attributes() {
+		attrs[kv.Key] = kv.Value
+	}
+	return attrs
+}
+
+// TestInitLokiTracing_Disabled verifies that tracing stays a no-op without an OTLP endpoint
+func TestInitLokiTracing_Disabled(t *testing.T) {
+	t.Setenv(EnvOTelExporterEndpoint, "")
+	t.Setenv(EnvOTelExporterTracesEndpoint, "")
+	before := otel.GetTracerProvider()
+
+	shutdown, err := InitLokiTracing(context.Background())
+	if err != nil {
+		t.Fatalf("InitLokiTracing failed: %v", err)
+	}
+	if err := shutdown(context.Background()); err != nil {
+		t.Errorf("shutdown failed: %v", err)
+	}
+	if otel.GetTracerProvider() != before {
+		t.Error("Expected the global tracer provider to be left alone")
+	}
+
+	_, span := lokiTracer().Start(context.Background(), "test")
+	if span.IsRecording() {
+		t.Error("Expected spans to be no-ops")
+	}
+}
+
+// TestInstrumentLokiTool_Spans verifies the tool and Loki request spans and trace propagation
+func TestInstrumentLokiTool_Spans(t *testing.T) {
+	recorder := useTestTracer(t)
+
+	var traceparent string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get("traceparent")
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"status":"success","data":{"resultType":"streams","result":[{"stream":{"job":"api"},"values":[["1705312200000000000","a"],["1705312201000000000","b"]]}]}}`))
+	}))
+	defer server.Close()
+
+	handler := InstrumentLokiTool("loki_query", HandleLokiQueryProtocol)
+	args, _ := json.Marshal(map[string]any{"query": `{job="api"}`, "url": server.URL, "org": "tenant-1"})
+	if _, err := NewLokiQueryToolProtocol(); err != nil {
+		t.Fatalf("NewLokiQueryToolProtocol failed: %v", err)
+	}
+	if _, err := handler(context.Background(), &protocol.CallToolRequest{RawArguments: args}); err != nil {
+		t.Fatalf("Tool call failed: %v", err)
+	}
+
+	spans := recorder.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("Expected 2 spans, got %d", len(spans))
+	}
+	request, tool := spans[0], spans[1]
+
+	if tool.Name() != "tool loki_query" {
+		t.Errorf("Unexpected tool span name %q", tool.Name())
+	}
+	attrs := spanAttributes(tool)
+	if attrs["mcp.tool.name"].AsString() != "loki_query" || attrs["loki.query"].AsString() != `{job="api"}` ||
+		attrs["loki.org"].AsString() != "tenant-1" || attrs["loki.entries"].AsInt64() != 2 {
+		t.Errorf("Unexpected tool span attributes: %v", attrs)
+	}
+
+	if request.Parent().SpanID() != tool.SpanContext().SpanID() {
+		t.Error("Expected the Loki request span to be a child of the tool span")
+	}
+	if request.SpanKind() != trace.SpanKindClient {
+		t.Errorf("Expected a client span, got %v", request.SpanKind())
+	}
+	attrs = spanAttributes(request)
+	if attrs["http.response.status_code"].AsInt64() != 200 || attrs["loki.org"].AsString() != "tenant-1" {
+		t.Errorf("Unexpected request span attributes: %v", attrs)
+	}
+
+	want := "00-" + request.SpanContext().TraceID().String() + "-" + request.SpanContext().SpanID().String() + "-01"
+	if traceparent != want {
+		t.Errorf("Expected traceparent %q, got %q", want, traceparent)
+	}
+}
+
+// TestInstrumentLokiTool_ErrorSpan verifies that failed Loki requests mark both spans as errors
+func TestInstrumentLokiTool_ErrorSpan(t *testing.T) {
+	recorder := useTestTracer(t)
+	t.Setenv(EnvLokiMaxRetries, "0")
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("parse error"))
+	}))
+	defer server.Close()
+
+	handler := InstrumentLokiTool("loki_series", HandleLokiSeriesProtocol)
+	args, _ := json.Marshal(map[string]any{"match": `{job="api"}`, "url": server.URL})
+	if _, err := handler(context.Background(), &protocol.CallToolRequest{RawArguments: args}); err == nil {
+		t.Fatal("Expected an error")
+	}
+
+	for _, span := range recorder.Ended() {
+		if span.Status().Code != codes.Error {
+			t.Errorf("Expected span %q to have error status", span.Name())
+		}
+	}
+	if got := spanAttributes(recorder.Ended()[0])["http.response.status_code"].AsInt64(); got != 400 {
+		t.Errorf("Expected status code 400, got %d", got)
+	}
+}
+
+// TestTraceHTTPHandler verifies that incoming W3C trace context is continued
+func TestTraceHTTPHandler(t *testing.T) {
+	useTestTracer(t)
+
+	var got trace.SpanContext
+	handler := TraceHTTPHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = trace.SpanContextFromContext(r.Context())
+	}))
+
+	req := httptest.NewRequest("POST", "/mcp", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	if got.TraceID().String() != "4bf92f3577b34da6a3ce929d0e0e4736" || !got.IsRemote() {
+		t.Errorf("Expected the remote trace to be continued, got %v", got)
+	}
+}
@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ThinkInAIXYZ/go-mcp/protocol"
+)
+
+// lokiStatsSummary is the part of the statistics Loki returns with query results that shows
+// how much work a query did and whether it stopped early
+type lokiStatsSummary struct {
+	Summary struct {
+		ExecTime             float64 `json:"execTime"`
+		TotalEntriesReturned int     `json:"totalEntriesReturned"`
+		TotalLinesProcessed  int64   `json:"totalLinesProcessed"`
+		TotalBytesProcessed  int64   `json:"totalBytesProcessed"`
+	} `json:"summary"`
+}
+
+// lokiResultFooter summarizes the weight of a query result in one line for the end of the
+// formatted output: the number of entries and the approximate size of their log text, or the
+// bytes Loki reports having processed when the response carries stats
+func lokiResultFooter(result *LokiResult) string {
+	entries := 0
+	var size int64
+	for _, entry := range result.Data.Result {
+		for _, val := range entry.Values {
+			entries++
+			if len(val) >= 2 {
+				size += int64(len(val[1]))
+			}
+		}
+	}
+
+	weight := "~" + formatByteSize(size) + " of log text"
+	var summary lokiStatsSummary
+	if len(result.Data.Stats) > 0 && json.Unmarshal(result.Data.Stats, &summary) == nil && summary.Summary.TotalBytesProcessed > 0 {
+		weight = formatByteSize(summary.Summary.TotalBytesProcessed) + " processed by Loki"
+	}
+	return fmt.Sprintf("--- %d entries, %s ---\n", entries, weight)
+}
+
+// lokiResultNotes explains degraded or truncated results from the status, warnings and stats of
+// a Loki response. The limit counts as hit when Loki returned as many entries as were requested.
+func lokiResultNotes(status string, warnings []string, stats json.RawMessage, limit int) []string {
+	var notes []string
+	if status != "" && status != "success" {
+		notes = append(notes, fmt.Sprintf("Loki answered with status %q; results may be partial", status))
+	}
+	for _, warning := range warnings {
+		if warning = strings.TrimSpace(warning); warning != "" {
+			notes = append(notes, "Loki warning: "+warning)
+		}
+	}
+
+	var summary lokiStatsSummary
+	if len(stats) == 0 || json.Unmarshal(stats, &summary) != nil {
+		return notes
+	}
+	if returned := summary.Summary.TotalEntriesReturned; limit > 0 && returned >= limit {
+		elapsed := time.Duration(summary.Summary.ExecTime * float64(time.Second)).Round(time.Millisecond)
+		notes = append(notes, fmt.Sprintf("Loki stopped at the limit of %d entries after processing %d lines in %s; more lines may match, so narrow the query or page with the cursor",
+			limit, summary.Summary.TotalLinesProcessed, elapsed))
+	}
+	return notes
+}
+
+// lokiNotesContent appends notes to content as a single text item, leaving the formatted
+// results untouched so that json and push output stay parseable
+func lokiNotesContent(content []protocol.Content, notes []string) []protocol.Content {
+	if len(notes) == 0 {
+		return content
+	}
+	return append(content, &protocol.TextContent{
+		Type: "text",
+		Text: "Note: " + strings.Join(notes, "\nNote: "),
+	})
+}
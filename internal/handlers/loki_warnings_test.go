@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ThinkInAIXYZ/go-mcp/protocol"
+)
+
+// TestLokiResultNotes verifies the notes derived from status, warnings and stats
+func TestLokiResultNotes(t *testing.T) {
+	stats := json.RawMessage(`{"summary":{"execTime":1.5,"totalEntriesReturned":100,"totalLinesProcessed":250000}}`)
+	notes := lokiResultNotes("success", []string{"query was limited to 30d by max_query_lookback", " "}, stats, 100)
+	want := []string{
+		"Loki warning: query was limited to 30d by max_query_lookback",
+		"Loki stopped at the limit of 100 entries after processing 250000 lines in 1.5s; more lines may match, so narrow the query or page with the cursor",
+	}
+	if strings.Join(notes, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Unexpected notes:\n%s", strings.Join(notes, "\n"))
+	}
+
+	if notes := lokiResultNotes("success", nil, stats, 500); len(notes) != 0 {
+		t.Errorf("Expected no notes below the limit, got %v", notes)
+	}
+	if notes := lokiResultNotes("partial", nil, nil, 0); len(notes) != 1 || !strings.Contains(notes[0], `status "partial"`) {
+		t.Errorf("Expected a note for the status, got %v", notes)
+	}
+}
+
+// TestHandleLokiQueryProtocol_Warnings verifies that warnings follow the results without changing them
+func TestHandleLokiQueryProtocol_Warnings(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"status":"success","warnings":["max entries limit per query exceeded"],"data":{"resultType":"streams",` +
+			`"result":[{"stream":{"job":"api"},"values":[["1705312800000000000","hello"]]}],` +
+			`"stats":{"summary":{"execTime":0.2,"totalEntriesReturned":1,"totalLinesProcessed":42}}}}`))
+	}))
+	defer server.Close()
+
+	if _, err := NewLokiQueryToolProtocol(); err != nil {
+		t.Fatalf("Failed to create tool: %v", err)
+	}
+	raw, _ := json.Marshal(map[string]any{"query": `{job="api"}`, "url": server.URL, "limit": 1, "format": "json"})
+	result, err := HandleLokiQueryProtocol(context.Background(), &protocol.CallToolRequest{Name: "loki_query", RawArguments: raw})
+	if err != nil {
+		t.Fatalf("HandleLokiQueryProtocol failed: %v", err)
+	}
+	if len(result.Content) != 3 {
+		t.Fatalf("Expected results, metadata and notes, got %d content items", len(result.Content))
+	}
+
+	var parsed LokiResult
+	if err := json.Unmarshal([]byte(result.Content[0].(*protocol.TextContent).Text), &parsed); err != nil {
+		t.Fatalf("Expected the json output to stay parseable: %v", err)
+	}
+	notes := result.Content[2].(*protocol.TextContent).Text
+	if !strings.Contains(notes, "Note: Loki warning: max entries limit per query exceeded") ||
+		!strings.Contains(notes, "Note: Loki stopped at the limit of 1 entries after processing 42 lines") {
+		t.Errorf("Unexpected notes %q", notes)
+	}
+}
+
+// TestLokiResultFooter verifies the entry count and the preference for Loki's processed bytes
+func TestLokiResultFooter(t *testing.T) {
+	result := &LokiResult{Status: "success", Data: LokiData{ResultType: "streams", Result: []LokiEntry{
+		{Stream: map[string]string{"app": "api"}, Values: [][]string{{"1705312800000000000", strings.Repeat("a", 1000)}, {"1705312801000000000", strings.Repeat("b", 1048)}}},
+		{Stream: map[string]string{"app": "web"}, Values: [][]string{{"1705312802000000000", "ok"}}},
+	}}}
+	if got := lokiResultFooter(result); got != "--- 3 entries, ~2.0 KiB of log text ---\n" {
+		t.Errorf("Unexpected footer %q", got)
+	}
+
+	result.Data.Stats = json.RawMessage(`{"summary":{"totalBytesProcessed":1572864}}`)
+	if got := lokiResultFooter(result); got != "--- 3 entries, 1.5 MiB processed by Loki ---\n" {
+		t.Errorf("Unexpected footer %q", got)
+	}
+
+	output, err := formatLokiResults(result, "raw")
+	if err != nil || !strings.HasSuffix(output, "ok\n--- 3 entries, 1.5 MiB processed by Loki ---\n") {
+		t.Errorf("Expected the raw output to end with the footer, got %q (%v)", output, err)
+	}
+	if output, _ := formatLokiResults(result, "json"); strings.Contains(output, "---") {
+		t.Error("Expected no footer in json output")
+	}
+}
@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"fmt"
+	"time"
+)
+
+// Ranges tried by autoWiden, each ending at the end of the original range. A week keeps widened
+// queries within Loki's default max_query_length of 721h.
+var lokiAutoWidenLookbacks = []time.Duration{time.Hour, 6 * time.Hour, 24 * time.Hour, 7 * 24 * time.Hour}
+
+// checkLokiAutoWiden reports an error when autoWiden is combined with arguments that continue a
+// previous call, whose range must not move
+func checkLokiAutoWiden(autoWiden bool, cursor, sinceToken string) error {
+	if autoWiden && (cursor != "" || sinceToken != "") {
+		return fmt.Errorf("autoWiden cannot be combined with cursor or sinceToken")
+	}
+	return nil
+}
+
+// lokiAutoWidenSteps returns the lookbacks to try, in order, after a range of length requested
+// matched nothing. Lookbacks longer than maxRange are skipped; zero leaves them unlimited.
+func lokiAutoWidenSteps(requested, maxRange time.Duration) []time.Duration {
+	var steps []time.Duration
+	for _, lookback := range lokiAutoWidenLookbacks {
+		if lookback > requested && (maxRange == 0 || lookback <= maxRange) {
+			steps = append(steps, lookback)
+		}
+	}
+	return steps
+}
+
+// formatLokiLookback renders a lookback as whole days, hours or minutes where possible, e.g. 7d or 6h
+func formatLokiLookback(d time.Duration) string {
+	d = d.Round(time.Second)
+	switch {
+	case d >= 24*time.Hour && d%(24*time.Hour) == 0:
+		return fmt.Sprintf("%dd", d/(24*time.Hour))
+	case d >= time.Hour && d%time.Hour == 0:
+		return fmt.Sprintf("%dh", d/time.Hour)
+	case d >= time.Minute && d%time.Minute == 0:
+		return fmt.Sprintf("%dm", d/time.Minute)
+	default:
+		return d.String()
+	}
+}
+
+// lokiAutoWidenNote describes the range autoWiden settled on (Unix ns), and whether anything matched there
+func lokiAutoWidenNote(requested, widened time.Duration, start, end int64, found bool) string {
+	span := fmt.Sprintf("%s to %s", time.Unix(0, start).UTC().Format(time.RFC3339), time.Unix(0, end).UTC().Format(time.RFC3339))
+	if found {
+		return fmt.Sprintf("autoWiden: nothing matched in the requested %s, so the range was widened to the last %s (%s), where the results above were found",
+			formatLokiLookback(requested), formatLokiLookback(widened), span)
+	}
+	return fmt.Sprintf("autoWiden: nothing matched in the requested %s, nor after widening the range to the last %s (%s)",
+		formatLokiLookback(requested), formatLokiLookback(widened), span)
+}
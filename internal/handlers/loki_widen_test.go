@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ThinkInAIXYZ/go-mcp/protocol"
+)
+
+// TestLokiAutoWidenSteps verifies that only ranges wider than the requested one are tried
+func TestLokiAutoWidenSteps(t *testing.T) {
+	steps := lokiAutoWidenSteps(time.Hour+time.Millisecond, 0)
+	if len(steps) != 3 || steps[0] != 6*time.Hour || steps[2] != 7*24*time.Hour {
+		t.Errorf("Expected 6h, 24h and 7d, got %v", steps)
+	}
+	if steps := lokiAutoWidenSteps(30*24*time.Hour, 0); len(steps) != 0 {
+		t.Errorf("Expected no wider ranges than 30 days, got %v", steps)
+	}
+	if steps := lokiAutoWidenSteps(time.Hour, 24*time.Hour); len(steps) != 2 || steps[1] != 24*time.Hour {
+		t.Errorf("Expected 6h and 24h within a 24h maximum range, got %v", steps)
+	}
+	if got := formatLokiLookback(7 * 24 * time.Hour); got != "7d" {
+		t.Errorf("Expected 7d, got %q", got)
+	}
+	if got := formatLokiLookback(30*time.Minute + time.Millisecond); got != "30m" {
+		t.Errorf("Expected 30m, got %q", got)
+	}
+}
+
+// TestHandleLokiQueryProtocol_AutoWiden verifies that an empty result is retried over wider
+// ranges until one matches, and that the range used is reported
+func TestHandleLokiQueryProtocol_AutoWiden(t *testing.T) {
+	end := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+	var starts []string
+	found := end.Add(-5 * time.Hour)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := r.URL.Query().Get("start")
+		starts = append(starts, start)
+		if ns, _ := strconv.ParseInt(start, 10, 64); ns > found.UnixNano() {
+			w.Write([]byte(`{"status":"success","data":{"resultType":"streams","result":[]}}`))
+			return
+		}
+		w.Write([]byte(`{"status":"success","data":{"resultType":"streams","result":[{"stream":{"job":"a"},"values":[["` +
+			strconv.FormatInt(found.UnixNano(), 10) + `","disk full"]]}]}}`))
+	}))
+	defer server.Close()
+
+	if _, err := NewLokiQueryToolProtocol(); err != nil {
+		t.Fatalf("Failed to create tool: %v", err)
+	}
+	call := func(args map[string]any) (*protocol.CallToolResult, error) {
+		args["query"] = `{job="a"}`
+		args["url"] = server.URL
+		args["autoWiden"] = true
+		raw, _ := json.Marshal(args)
+		return HandleLokiQueryProtocol(context.Background(), &protocol.CallToolRequest{Name: "loki_query", RawArguments: raw})
+	}
+
+	result, err := call(map[string]any{"start": "2024-01-15T09:30:00Z", "end": "2024-01-15T10:00:00Z"})
+	if err != nil {
+		t.Fatalf("HandleLokiQueryProtocol failed: %v", err)
+	}
+	if len(starts) != 3 {
+		t.Errorf("Expected the 30m, 1h and 6h ranges to be queried, got starts %v", starts)
+	}
+	if output := result.Content[0].(*protocol.TextContent).Text; !strings.Contains(output, "disk full") {
+		t.Errorf("Expected the entry found in the wider range, got %q", output)
+	}
+	var metadata LokiQueryMetadata
+	if err := json.Unmarshal([]byte(result.Content[1].(*protocol.TextContent).Text), &metadata); err != nil {
+		t.Fatalf("Expected metadata to be JSON: %v", err)
+	}
+	if metadata.Start != "2024-01-15T04:00:00Z" {
+		t.Errorf("Expected the metadata to give the widened start, got %q", metadata.Start)
+	}
+	want := "widened to the last 6h (2024-01-15T04:00:00Z to 2024-01-15T10:00:00Z)"
+	if note := result.Content[2].(*protocol.TextContent).Text; !strings.Contains(note, want) || !strings.Contains(note, "requested 30m") {
+		t.Errorf("Expected a note naming the widened range, got %q", note)
+	}
+
+	starts = nil
+	found = end.Add(-30 * 24 * time.Hour)
+	result, err = call(map[string]any{"start": "2024-01-15T09:00:00Z", "end": "2024-01-15T10:00:00Z"})
+	if err != nil {
+		t.Fatalf("HandleLokiQueryProtocol failed: %v", err)
+	}
+	if len(starts) != 4 {
+		t.Errorf("Expected the 1h, 6h, 24h and 7d ranges to be queried, got starts %v", starts)
+	}
+	if note := result.Content[len(result.Content)-1].(*protocol.TextContent).Text; !strings.Contains(note, "nor after widening the range to the last 7d") {
+		t.Errorf("Expected a note saying nothing was found, got %q", note)
+	}
+
+	if _, err := call(map[string]any{"cursor": "backward:1705312800000000000"}); err == nil {
+		t.Error("Expected autoWiden with a cursor to be rejected")
+	}
+}